@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
 )
 
@@ -15,8 +16,11 @@ func BenchmarkStorageInsertSearch(b *testing.B) {
 	}
 	defer func() { _ = pager.Close() }()
 
-	tree := storage.NewBPlusTree(16, pager)
 	ctx := context.Background()
+	tree, err := storage.NewBPlusTree(ctx, buffer.NewBufferPoolManager(256, pager))
+	if err != nil {
+		b.Fatalf("NewBPlusTree() error = %v", err)
+	}
 
 	b.Run("insert", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"path/filepath"
 	"syscall"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/executor"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/server"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
@@ -38,12 +41,30 @@ func main() {
 		_ = walWriter.Close()
 	}()
 
-	tree := storage.NewBPlusTree(16, pageManager)
-	engine := executor.NewWithDefaults(tree, walWriter)
-
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	// 数据文件的第 0 页是系统目录的头页，新文件则在其上创建空目录。
+	bufferPool := buffer.NewBufferPoolManager(1024, pageManager)
+	defer func() {
+		if flushErr := bufferPool.FlushAllPages(context.Background()); flushErr != nil {
+			logger.Error("flush buffer pool failed", "error", flushErr)
+		}
+	}()
+	cat, err := catalog.Open(ctx, bufferPool, 0)
+	if errors.Is(err, storage.ErrPageNotFound) {
+		cat, err = catalog.Create(ctx, bufferPool)
+	}
+	if err != nil {
+		logger.Error("open catalog failed", "error", err)
+		os.Exit(1)
+	}
+	engine, err := executor.NewWithDefaults(ctx, cat, walWriter)
+	if err != nil {
+		logger.Error("create executor failed", "error", err)
+		os.Exit(1)
+	}
+
 	tcpServer := server.NewTCPServer("127.0.0.1:13306", engine, logger)
 	if err = tcpServer.Start(ctx); err != nil {
 		logger.Error("tcp server stopped with error", "error", err)
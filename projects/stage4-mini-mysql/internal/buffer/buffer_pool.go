@@ -8,7 +8,12 @@ import (
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
 )
 
-var ErrNoFrameAvailable = errors.New("no frame available")
+var (
+	ErrNoFrameAvailable = errors.New("no frame available")
+	ErrPagePinned       = errors.New("page is pinned")
+)
+
+var _ storage.BufferPool = (*BufferPoolManager)(nil)
 
 // BufferPoolManager Buffer Pool 管理器。
 type BufferPoolManager struct {
@@ -59,25 +64,31 @@ func (b *BufferPoolManager) FetchPage(ctx context.Context, id storage.PageID) (*
 		b.mu.Unlock()
 		return p, nil
 	}
-	frameID, ok := b.acquireFrameLocked(ctx)
-	if !ok {
-		b.mu.Unlock()
-		return nil, ErrNoFrameAvailable
-	}
+	frameID, err := b.acquireFrameLocked(ctx)
 	b.mu.Unlock()
-
-	page, err := b.disk.ReadPage(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	page, err := b.disk.ReadPage(ctx, id)
 	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.freeList = append(b.freeList, frameID)
+		return nil, err
+	}
+	// 读盘期间其他调用方可能已载入同一页，此时沿用已有的页并归还帧。
+	if p, ok := b.pages[id]; ok {
+		b.freeList = append(b.freeList, frameID)
+		p.PinCount++
+		b.replacer.Pin(b.frameByPID[id])
+		return p, nil
+	}
 	page.PinCount = 1
 	b.pages[id] = page
 	b.frameByPID[id] = frameID
 	b.pidByFrame[frameID] = id
 	b.replacer.Pin(frameID)
-	b.mu.Unlock()
 	return page, nil
 }
 
@@ -142,10 +153,11 @@ func (b *BufferPoolManager) NewPage(ctx context.Context) (*storage.Page, error)
 	page := &storage.Page{ID: pageID, Dirty: true, PinCount: 1}
 
 	b.mu.Lock()
-	frameID, ok := b.acquireFrameLocked(ctx)
-	if !ok {
+	frameID, err := b.acquireFrameLocked(ctx)
+	if err != nil {
 		b.mu.Unlock()
-		return nil, ErrNoFrameAvailable
+		_ = b.disk.FreePage(ctx, pageID)
+		return nil, err
 	}
 	b.pages[pageID] = page
 	b.frameByPID[pageID] = frameID
@@ -155,6 +167,32 @@ func (b *BufferPoolManager) NewPage(ctx context.Context) (*storage.Page, error)
 	return page, nil
 }
 
+// DeletePage 从 Buffer Pool 移除页并交还磁盘回收，页仍被 pin 时返回 ErrPagePinned。
+func (b *BufferPoolManager) DeletePage(ctx context.Context, id storage.PageID) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	if page, ok := b.pages[id]; ok {
+		if page.PinCount > 0 {
+			b.mu.Unlock()
+			return ErrPagePinned
+		}
+		frameID := b.frameByPID[id]
+		b.replacer.Pin(frameID)
+		delete(b.pages, id)
+		delete(b.frameByPID, id)
+		delete(b.pidByFrame, frameID)
+		b.freeList = append(b.freeList, frameID)
+	}
+	b.mu.Unlock()
+	return b.disk.FreePage(ctx, id)
+}
+
 // FlushAllPages 刷新全部页。
 func (b *BufferPoolManager) FlushAllPages(ctx context.Context) error {
 	if ctx == nil {
@@ -179,27 +217,31 @@ func (b *BufferPoolManager) FlushAllPages(ctx context.Context) error {
 	return nil
 }
 
-func (b *BufferPoolManager) acquireFrameLocked(ctx context.Context) (FrameID, bool) {
+func (b *BufferPoolManager) acquireFrameLocked(ctx context.Context) (FrameID, error) {
 	if len(b.freeList) > 0 {
 		last := len(b.freeList) - 1
 		frameID := b.freeList[last]
 		b.freeList = b.freeList[:last]
-		return frameID, true
+		return frameID, nil
 	}
 	victim, ok := b.replacer.Victim()
 	if !ok {
-		return 0, false
+		return 0, ErrNoFrameAvailable
 	}
 	pid, exists := b.pidByFrame[victim]
 	if !exists {
-		return victim, true
+		return victim, nil
 	}
 	page := b.pages[pid]
 	if page != nil && page.Dirty {
-		_ = b.disk.WritePage(ctx, page)
+		// 脏页写回失败时保留该页，避免丢失修改。
+		if err := b.disk.WritePage(ctx, page); err != nil {
+			b.replacer.Unpin(victim)
+			return 0, err
+		}
 	}
 	delete(b.pages, pid)
 	delete(b.frameByPID, pid)
 	delete(b.pidByFrame, victim)
-	return victim, true
+	return victim, nil
 }
@@ -2,6 +2,7 @@ package buffer
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 
@@ -51,3 +52,39 @@ func TestLRUReplacer(t *testing.T) {
 		t.Fatalf("Victim() = (%d, %v), want (1, true)", victim, ok)
 	}
 }
+
+func TestBufferPoolDeletePage(t *testing.T) {
+	pager, err := storage.NewFilePageManager(filepath.Join(t.TempDir(), "buffer.db"))
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	defer func() {
+		_ = pager.Close()
+	}()
+
+	bpm := NewBufferPoolManager(1, pager)
+	ctx := context.Background()
+	page, err := bpm.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("NewPage() error = %v", err)
+	}
+	if err = bpm.DeletePage(ctx, page.ID); !errors.Is(err, ErrPagePinned) {
+		t.Fatalf("DeletePage(pinned) error = %v, want %v", err, ErrPagePinned)
+	}
+	if _, err = bpm.NewPage(ctx); !errors.Is(err, ErrNoFrameAvailable) {
+		t.Fatalf("NewPage(full) error = %v, want %v", err, ErrNoFrameAvailable)
+	}
+	if err = bpm.UnpinPage(ctx, page.ID, true); err != nil {
+		t.Fatalf("UnpinPage() error = %v", err)
+	}
+	if err = bpm.DeletePage(ctx, page.ID); err != nil {
+		t.Fatalf("DeletePage() error = %v", err)
+	}
+	reused, err := bpm.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("NewPage() error = %v", err)
+	}
+	if reused.ID != page.ID {
+		t.Fatalf("NewPage() id = %d, want reused %d", reused.ID, page.ID)
+	}
+}
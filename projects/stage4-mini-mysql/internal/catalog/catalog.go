@@ -0,0 +1,394 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+var (
+	ErrTableExists   = errors.New("table already exists")
+	ErrTableNotFound = errors.New("table not found")
+	ErrSystemTable   = errors.New("system table is read-only")
+	ErrNotCatalog    = errors.New("page is not a catalog header")
+)
+
+// 系统表名。
+const (
+	SysTables  = "sys_tables"
+	SysColumns = "sys_columns"
+)
+
+// 目录头页：魔数(4) + sys_tables 元数据页号(4) + sys_columns 元数据页号(4)。
+var catalogMagic = []byte("CAT1")
+
+// 系统表自身的结构，用与用户表相同的元组编码存放。
+var (
+	sysTablesSchema = mustSchema(SysTables, []Column{
+		{Name: "id", Type: types.TypeBigInt},
+		{Name: "name", Type: types.TypeVarchar, Length: MaxNameLength},
+		{Name: "meta_page", Type: types.TypeBigInt},
+		{Name: "next_row_id", Type: types.TypeBigInt},
+	}, []string{"id"})
+	sysColumnsSchema = mustSchema(SysColumns, []Column{
+		{Name: "table_id", Type: types.TypeBigInt},
+		{Name: "ordinal", Type: types.TypeInt},
+		{Name: "name", Type: types.TypeVarchar, Length: MaxNameLength},
+		{Name: "type", Type: types.TypeVarchar, Length: 16},
+		{Name: "length", Type: types.TypeInt},
+		{Name: "nullable", Type: types.TypeBool},
+		{Name: "pk_position", Type: types.TypeInt, Nullable: true},
+	}, []string{"table_id", "ordinal"})
+)
+
+func mustSchema(name string, columns []Column, primaryKey []string) *Schema {
+	s, err := NewSchema(name, columns, primaryKey)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Table 目录中的一张表。System 为 true 的系统表只读。
+type Table struct {
+	ID     int64
+	Schema *Schema
+	Tree   *storage.BPlusTree
+	System bool
+
+	nextRowID int64
+}
+
+// Catalog 系统目录。表结构保存在 sys_tables / sys_columns 两张系统表中，它们的 B+Tree 元数据页号记录在目录头页，
+// 打开时据此加载全部表结构。目录的修改直接写入 B+Tree，持久化依赖缓冲池刷盘。
+type Catalog struct {
+	mu          sync.RWMutex
+	pool        storage.BufferPool
+	headerID    storage.PageID
+	tables      map[string]*Table
+	nextTableID int64
+}
+
+// Create 在缓冲池上新建空目录，pool 为 nil 时使用内存页。头页号由 HeaderPageID 返回，在空数据文件上总是 0。
+func Create(ctx context.Context, pool storage.BufferPool) (*Catalog, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		pool = storage.NewMemoryPool()
+	}
+
+	header, err := pool.NewPage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headerID := header.ID
+	if err = pool.UnpinPage(ctx, headerID, true); err != nil {
+		return nil, err
+	}
+	sysTables, err := storage.NewBPlusTree(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	sysColumns, err := storage.NewBPlusTree(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	if header, err = pool.FetchPage(ctx, headerID); err != nil {
+		return nil, err
+	}
+	copy(header.Data[:], catalogMagic)
+	binary.LittleEndian.PutUint32(header.Data[4:], uint32(sysTables.MetaPageID()))
+	binary.LittleEndian.PutUint32(header.Data[8:], uint32(sysColumns.MetaPageID()))
+	if err = pool.UnpinPage(ctx, headerID, true); err != nil {
+		return nil, err
+	}
+	return newCatalog(pool, headerID, sysTables, sysColumns), nil
+}
+
+// Open 从头页打开已有目录并加载全部表结构。
+func Open(ctx context.Context, pool storage.BufferPool, headerID storage.PageID) (*Catalog, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	header, err := pool.FetchPage(ctx, headerID)
+	if err != nil {
+		return nil, err
+	}
+	magic := bytes.Equal(header.Data[:4], catalogMagic)
+	sysTablesMeta := storage.PageID(binary.LittleEndian.Uint32(header.Data[4:]))
+	sysColumnsMeta := storage.PageID(binary.LittleEndian.Uint32(header.Data[8:]))
+	if err = pool.UnpinPage(ctx, headerID, false); err != nil {
+		return nil, err
+	}
+	if !magic {
+		return nil, ErrNotCatalog
+	}
+	sysTables, err := storage.OpenBPlusTree(ctx, pool, sysTablesMeta)
+	if err != nil {
+		return nil, err
+	}
+	sysColumns, err := storage.OpenBPlusTree(ctx, pool, sysColumnsMeta)
+	if err != nil {
+		return nil, err
+	}
+	c := newCatalog(pool, headerID, sysTables, sysColumns)
+
+	tableRows, err := scanRows(ctx, sysTables, sysTablesSchema, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range tableRows {
+		id, name := row[0].Int, row[1].Str
+		schema, err := c.loadSchema(ctx, id, name)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := storage.OpenBPlusTree(ctx, pool, storage.PageID(row[2].Int))
+		if err != nil {
+			return nil, fmt.Errorf("open table %s: %w", name, err)
+		}
+		c.tables[name] = &Table{ID: id, Schema: schema, Tree: tree, nextRowID: row[3].Int}
+		c.nextTableID = max(c.nextTableID, id+1)
+	}
+	return c, nil
+}
+
+func newCatalog(pool storage.BufferPool, headerID storage.PageID, sysTables, sysColumns *storage.BPlusTree) *Catalog {
+	return &Catalog{
+		pool:     pool,
+		headerID: headerID,
+		tables: map[string]*Table{
+			SysTables:  {Schema: sysTablesSchema, Tree: sysTables, System: true},
+			SysColumns: {Schema: sysColumnsSchema, Tree: sysColumns, System: true},
+		},
+		nextTableID: 1,
+	}
+}
+
+// loadSchema 从 sys_columns 读取表 id 的列定义。
+func (c *Catalog) loadSchema(ctx context.Context, id int64, name string) (*Schema, error) {
+	prefix, err := EncodeKey(sysColumnsSchema, []types.Value{types.NewInt(id)})
+	if err != nil {
+		return nil, err
+	}
+	end, err := EncodeKey(sysColumnsSchema, []types.Value{types.NewInt(id + 1)})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := scanRows(ctx, c.tables[SysColumns].Tree, sysColumnsSchema, prefix, end)
+	if err != nil {
+		return nil, err
+	}
+	schema := &Schema{Name: name}
+	pkColumns := make(map[int64]int)
+	for _, row := range rows {
+		typ, err := types.ParseType(row[3].Str, int(row[4].Int))
+		if err != nil {
+			return nil, fmt.Errorf("table %s column %s: %w", name, row[2].Str, err)
+		}
+		schema.Columns = append(schema.Columns, Column{Name: row[2].Str, Type: typ, Length: int(row[4].Int), Nullable: row[5].Bool})
+		if !row[6].IsNull() {
+			pkColumns[row[6].Int] = len(schema.Columns) - 1
+		}
+	}
+	if len(schema.Columns) == 0 {
+		return nil, fmt.Errorf("%w: table %s has no columns in %s", ErrInvalidSchema, name, SysColumns)
+	}
+	for pos := range int64(len(pkColumns)) {
+		i, ok := pkColumns[pos]
+		if !ok {
+			return nil, fmt.Errorf("%w: table %s primary key position %d missing", ErrInvalidSchema, name, pos)
+		}
+		schema.PrimaryKey = append(schema.PrimaryKey, i)
+	}
+	return schema, nil
+}
+
+// HeaderPageID 返回目录头页号，重新打开时传给 Open。
+func (c *Catalog) HeaderPageID() storage.PageID {
+	return c.headerID
+}
+
+// Pool 返回目录与表所在的缓冲池。
+func (c *Catalog) Pool() storage.BufferPool {
+	return c.pool
+}
+
+// CreateTable 为 schema 新建表：分配 B+Tree 并写入 sys_tables 与 sys_columns。
+func (c *Catalog) CreateTable(ctx context.Context, schema *Schema) (*Table, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tables[schema.Name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableExists, schema.Name)
+	}
+	tree, err := storage.NewBPlusTree(ctx, c.pool)
+	if err != nil {
+		return nil, err
+	}
+	table := &Table{ID: c.nextTableID, Schema: schema, Tree: tree, nextRowID: 1}
+	if err = c.writeTableRowLocked(ctx, table); err != nil {
+		return nil, err
+	}
+	for i, col := range schema.Columns {
+		pkPosition := types.Null()
+		for pos, pk := range schema.PrimaryKey {
+			if pk == i {
+				pkPosition = types.NewInt(int64(pos))
+			}
+		}
+		row := []types.Value{
+			types.NewInt(table.ID), types.NewInt(int64(i)), types.NewString(col.Name),
+			types.NewString(col.Type.String()), types.NewInt(int64(col.Length)), types.NewBool(col.Nullable), pkPosition,
+		}
+		if err = insertRow(ctx, c.tables[SysColumns].Tree, sysColumnsSchema, row); err != nil {
+			return nil, err
+		}
+	}
+	c.tables[schema.Name] = table
+	c.nextTableID++
+	return table, nil
+}
+
+// DropTable 删除表的目录记录并释放其 B+Tree 的全部页。
+func (c *Catalog) DropTable(ctx context.Context, name string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	table, ok := c.tables[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, name)
+	}
+	if table.System {
+		return fmt.Errorf("%w: %s", ErrSystemTable, name)
+	}
+	key, err := EncodeKey(sysTablesSchema, []types.Value{types.NewInt(table.ID)})
+	if err != nil {
+		return err
+	}
+	if err = c.tables[SysTables].Tree.Delete(ctx, key); err != nil {
+		return err
+	}
+	for i := range table.Schema.Columns {
+		key, err = EncodeKey(sysColumnsSchema, []types.Value{types.NewInt(table.ID), types.NewInt(int64(i))})
+		if err != nil {
+			return err
+		}
+		if err = c.tables[SysColumns].Tree.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	delete(c.tables, name)
+	return table.Tree.Destroy(ctx)
+}
+
+// Table 按名称查找表，包括系统表。
+func (c *Catalog) Table(name string) (*Table, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	table, ok := c.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, name)
+	}
+	return table, nil
+}
+
+// TableNames 返回按名称排序的用户表名，不含系统表。
+func (c *Catalog) TableNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.tables))
+	for name, table := range c.tables {
+		if !table.System {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NextRowID 为无主键的表分配隐藏行号，并把下一个可用行号写回 sys_tables。
+func (c *Catalog) NextRowID(ctx context.Context, table *Table) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := table.nextRowID
+	table.nextRowID++
+	if err := c.writeTableRowLocked(ctx, table); err != nil {
+		table.nextRowID--
+		return 0, err
+	}
+	return id, nil
+}
+
+func (c *Catalog) writeTableRowLocked(ctx context.Context, table *Table) error {
+	row := []types.Value{
+		types.NewInt(table.ID), types.NewString(table.Schema.Name),
+		types.NewInt(int64(table.Tree.MetaPageID())), types.NewInt(table.nextRowID),
+	}
+	return insertRow(ctx, c.tables[SysTables].Tree, sysTablesSchema, row)
+}
+
+// insertRow 校验并写入一行有主键的系统表记录，已存在时覆盖。
+func insertRow(ctx context.Context, tree *storage.BPlusTree, schema *Schema, row []types.Value) error {
+	row, err := schema.CheckRow(row)
+	if err != nil {
+		return err
+	}
+	key, err := RowKey(schema, row, 0)
+	if err != nil {
+		return err
+	}
+	value, err := EncodeTuple(schema, row)
+	if err != nil {
+		return err
+	}
+	return tree.Insert(ctx, key, value)
+}
+
+// scanRows 读取键位于 [start, end) 的全部行，end 为空表示到末尾。
+func scanRows(ctx context.Context, tree *storage.BPlusTree, schema *Schema, start, end []byte) ([][]types.Value, error) {
+	it, err := tree.RangeScan(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]types.Value
+	for it.Next() {
+		item := it.Item()
+		if len(end) > 0 && bytes.Equal(item.Key, end) {
+			break
+		}
+		row, err := DecodeTuple(schema, item.Value)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, it.Err()
+}
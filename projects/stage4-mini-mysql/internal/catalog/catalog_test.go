@@ -0,0 +1,274 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+func TestNewSchemaValidation(t *testing.T) {
+	cases := []struct {
+		name    string
+		table   string
+		columns []Column
+		pk      []string
+		want    error
+	}{
+		{"no columns", "t", nil, nil, ErrInvalidSchema},
+		{"empty table name", "", []Column{{Name: "a", Type: types.TypeInt}}, nil, ErrInvalidSchema},
+		{"duplicate column", "t", []Column{{Name: "a", Type: types.TypeInt}, {Name: "A", Type: types.TypeBigInt}}, nil, ErrInvalidSchema},
+		{"unknown type", "t", []Column{{Name: "a"}}, nil, ErrInvalidSchema},
+		{"missing pk column", "t", []Column{{Name: "a", Type: types.TypeInt}}, []string{"b"}, ErrColumnNotFound},
+		{"duplicate pk column", "t", []Column{{Name: "a", Type: types.TypeInt}}, []string{"a", "a"}, ErrInvalidSchema},
+		{"text pk", "t", []Column{{Name: "a", Type: types.TypeText}}, []string{"a"}, ErrInvalidSchema},
+	}
+	for _, tc := range cases {
+		if _, err := NewSchema(tc.table, tc.columns, tc.pk); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: NewSchema() error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	s, err := NewSchema("t", []Column{
+		{Name: "a", Type: types.TypeInt, Nullable: true},
+		{Name: "b", Type: types.TypeVarchar, Length: 4, Nullable: true},
+	}, []string{"b", "a"})
+	if err != nil {
+		t.Fatalf("NewSchema() error = %v", err)
+	}
+	if !reflect.DeepEqual(s.PrimaryKey, []int{1, 0}) || s.Columns[0].Nullable || s.Columns[1].Nullable {
+		t.Fatalf("schema = %+v, want primary key [1 0] and NOT NULL key columns", s)
+	}
+	if _, err = s.CheckRow([]types.Value{types.NewInt(1)}); !errors.Is(err, ErrColumnCount) {
+		t.Fatalf("CheckRow(short) error = %v, want %v", err, ErrColumnCount)
+	}
+	if _, err = s.CheckRow([]types.Value{types.Null(), types.NewString("x")}); !errors.Is(err, types.ErrNotNull) {
+		t.Fatalf("CheckRow(null key) error = %v, want %v", err, types.ErrNotNull)
+	}
+}
+
+func TestTupleRoundTrip(t *testing.T) {
+	s, err := NewSchema("t", []Column{
+		{Name: "i", Type: types.TypeInt, Nullable: true},
+		{Name: "b", Type: types.TypeBigInt, Nullable: true},
+		{Name: "d", Type: types.TypeDouble, Nullable: true},
+		{Name: "v", Type: types.TypeVarchar, Length: 8, Nullable: true},
+		{Name: "x", Type: types.TypeText, Nullable: true},
+		{Name: "f", Type: types.TypeBool, Nullable: true},
+		{Name: "ts", Type: types.TypeDatetime, Nullable: true},
+		{Name: "n", Type: types.TypeInt, Nullable: true},
+		{Name: "m", Type: types.TypeText, Nullable: true},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewSchema() error = %v", err)
+	}
+	rows := [][]types.Value{
+		{
+			types.NewInt(math.MinInt32), types.NewInt(math.MaxInt64), types.NewFloat(-0.125),
+			types.NewString("héllo"), types.NewString(""), types.NewBool(true),
+			types.NewTime(time.Date(2024, 2, 29, 23, 59, 58, 123456000, time.UTC)), types.Null(), types.NewString("tail"),
+		},
+		make([]types.Value, 9),
+	}
+	for _, row := range rows {
+		data, err := EncodeTuple(s, row)
+		if err != nil {
+			t.Fatalf("EncodeTuple() error = %v", err)
+		}
+		got, err := DecodeTuple(s, data)
+		if err != nil {
+			t.Fatalf("DecodeTuple() error = %v", err)
+		}
+		for i := range row {
+			if got[i].Kind != row[i].Kind || got[i].String() != row[i].String() {
+				t.Fatalf("column %d = %v, want %v", i, got[i], row[i])
+			}
+		}
+	}
+	data, _ := EncodeTuple(s, rows[0])
+	if _, err = DecodeTuple(s, data[:len(data)-1]); !errors.Is(err, ErrCorruptTuple) {
+		t.Fatalf("DecodeTuple(truncated) error = %v, want %v", err, ErrCorruptTuple)
+	}
+	if _, err = EncodeTuple(s, []types.Value{types.NewString("x"), {}, {}, {}, {}, {}, {}, {}, {}}); !errors.Is(err, types.ErrTypeMismatch) {
+		t.Fatalf("EncodeTuple(mismatch) error = %v, want %v", err, types.ErrTypeMismatch)
+	}
+}
+
+func TestEncodeKeyPreservesOrder(t *testing.T) {
+	intSchema := mustSchema("i", []Column{{Name: "k", Type: types.TypeBigInt}}, []string{"k"})
+	floatSchema := mustSchema("f", []Column{{Name: "k", Type: types.TypeDouble}}, []string{"k"})
+	strSchema := mustSchema("s", []Column{{Name: "k", Type: types.TypeVarchar, Length: 16}}, []string{"k"})
+	pairSchema := mustSchema("p", []Column{
+		{Name: "a", Type: types.TypeVarchar, Length: 16},
+		{Name: "b", Type: types.TypeInt},
+	}, []string{"a", "b"})
+
+	cases := []struct {
+		schema *Schema
+		keys   [][]types.Value
+	}{
+		{intSchema, [][]types.Value{
+			{types.NewInt(math.MinInt64)}, {types.NewInt(-256)}, {types.NewInt(-1)}, {types.NewInt(0)},
+			{types.NewInt(1)}, {types.NewInt(255)}, {types.NewInt(math.MaxInt64)},
+		}},
+		{floatSchema, [][]types.Value{
+			{types.NewFloat(math.Inf(-1))}, {types.NewFloat(-1e10)}, {types.NewFloat(-0.5)}, {types.NewFloat(0)},
+			{types.NewFloat(1e-300)}, {types.NewFloat(2.5)}, {types.NewFloat(math.Inf(1))},
+		}},
+		{strSchema, [][]types.Value{
+			{types.NewString("")}, {types.NewString("\x00")}, {types.NewString("\x00\x00")}, {types.NewString("\x00a")},
+			{types.NewString("a")}, {types.NewString("a\x00")}, {types.NewString("ab")}, {types.NewString("b")},
+		}},
+		{pairSchema, [][]types.Value{
+			{types.NewString("a"), types.NewInt(5)}, {types.NewString("a"), types.NewInt(6)},
+			{types.NewString("a\x00"), types.NewInt(-9)}, {types.NewString("ab"), types.NewInt(-10)},
+			{types.NewString("b"), types.NewInt(0)},
+		}},
+	}
+	for _, tc := range cases {
+		encoded := make([][]byte, len(tc.keys))
+		for i, key := range tc.keys {
+			var err error
+			if encoded[i], err = EncodeKey(tc.schema, key); err != nil {
+				t.Fatalf("%s: EncodeKey(%v) error = %v", tc.schema.Name, key, err)
+			}
+		}
+		for i := 1; i < len(encoded); i++ {
+			if bytes.Compare(encoded[i-1], encoded[i]) >= 0 {
+				t.Fatalf("%s: key %v does not sort before %v", tc.schema.Name, tc.keys[i-1], tc.keys[i])
+			}
+		}
+	}
+}
+
+func TestCatalogPersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "catalog.db")
+
+	pager, err := storage.NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	pool := buffer.NewBufferPoolManager(8, pager)
+	cat, err := Create(ctx, pool)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	users := mustSchema("users", []Column{
+		{Name: "id", Type: types.TypeBigInt},
+		{Name: "name", Type: types.TypeVarchar, Length: 32, Nullable: true},
+		{Name: "created", Type: types.TypeDatetime, Nullable: true},
+	}, []string{"id"})
+	events := mustSchema("events", []Column{{Name: "payload", Type: types.TypeText, Nullable: true}}, nil)
+	if _, err = cat.CreateTable(ctx, users); err != nil {
+		t.Fatalf("CreateTable(users) error = %v", err)
+	}
+	if _, err = cat.CreateTable(ctx, users); !errors.Is(err, ErrTableExists) {
+		t.Fatalf("CreateTable(users) again error = %v, want %v", err, ErrTableExists)
+	}
+	table, err := cat.CreateTable(ctx, events)
+	if err != nil {
+		t.Fatalf("CreateTable(events) error = %v", err)
+	}
+	for want := int64(1); want <= 3; want++ {
+		if id, err := cat.NextRowID(ctx, table); err != nil || id != want {
+			t.Fatalf("NextRowID() = (%d, %v), want %d", id, err, want)
+		}
+	}
+	header := cat.HeaderPageID()
+	if err = pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("FlushAllPages() error = %v", err)
+	}
+	if err = pager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	pager, err = storage.NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("reopen NewFilePageManager() error = %v", err)
+	}
+	defer func() { _ = pager.Close() }()
+	reopened, err := Open(ctx, buffer.NewBufferPoolManager(8, pager), header)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if names := reopened.TableNames(); !reflect.DeepEqual(names, []string{"events", "users"}) {
+		t.Fatalf("TableNames() = %v", names)
+	}
+	got, err := reopened.Table("users")
+	if err != nil {
+		t.Fatalf("Table(users) error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Schema, users) {
+		t.Fatalf("users schema = %+v, want %+v", got.Schema, users)
+	}
+	table, err = reopened.Table("events")
+	if err != nil {
+		t.Fatalf("Table(events) error = %v", err)
+	}
+	if id, err := reopened.NextRowID(ctx, table); err != nil || id != 4 {
+		t.Fatalf("NextRowID() after reopen = (%d, %v), want 4", id, err)
+	}
+	if _, err = reopened.CreateTable(ctx, mustSchema("more", []Column{{Name: "a", Type: types.TypeInt}}, nil)); err != nil {
+		t.Fatalf("CreateTable(more) error = %v", err)
+	}
+	more, _ := reopened.Table("more")
+	if more.ID <= got.ID || more.ID <= table.ID {
+		t.Fatalf("table id %d reused after reopen", more.ID)
+	}
+}
+
+func TestCatalogDropTable(t *testing.T) {
+	ctx := context.Background()
+	pool := storage.NewMemoryPool()
+	cat, err := Create(ctx, pool)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	s := mustSchema("t", []Column{{Name: "k", Type: types.TypeBigInt}, {Name: "v", Type: types.TypeText, Nullable: true}}, []string{"k"})
+	table, err := cat.CreateTable(ctx, s)
+	if err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	for i := int64(0); i < 300; i++ {
+		key, _ := EncodeKey(s, []types.Value{types.NewInt(i)})
+		value, _ := EncodeTuple(s, []types.Value{types.NewInt(i), types.NewString("some payload to fill the leaves")})
+		if err = table.Tree.Insert(ctx, key, value); err != nil {
+			t.Fatalf("Insert(%d) error = %v", i, err)
+		}
+	}
+	meta := table.Tree.MetaPageID()
+
+	if err = cat.DropTable(ctx, SysTables); !errors.Is(err, ErrSystemTable) {
+		t.Fatalf("DropTable(sys_tables) error = %v, want %v", err, ErrSystemTable)
+	}
+	if err = cat.DropTable(ctx, "t"); err != nil {
+		t.Fatalf("DropTable() error = %v", err)
+	}
+	if err = cat.DropTable(ctx, "t"); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("DropTable() again error = %v, want %v", err, ErrTableNotFound)
+	}
+	if _, err = pool.FetchPage(ctx, meta); !errors.Is(err, storage.ErrPageNotFound) {
+		t.Fatalf("FetchPage(meta) after drop error = %v, want %v", err, storage.ErrPageNotFound)
+	}
+	if len(cat.TableNames()) != 0 {
+		t.Fatalf("TableNames() = %v after drop", cat.TableNames())
+	}
+	for _, sys := range []string{SysTables, SysColumns} {
+		sysTable, _ := cat.Table(sys)
+		if n := sysTable.Tree.Len(); n != 0 {
+			t.Fatalf("%s has %d rows after drop", sys, n)
+		}
+	}
+	if _, err = Open(ctx, pool, meta); err == nil {
+		t.Fatal("Open() on a freed page succeeded")
+	}
+}
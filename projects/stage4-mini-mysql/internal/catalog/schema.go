@@ -0,0 +1,121 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+// MaxNameLength 表名与列名的最大字符数。
+const MaxNameLength = 64
+
+var (
+	ErrInvalidSchema  = errors.New("invalid schema")
+	ErrColumnNotFound = errors.New("column not found")
+	ErrColumnCount    = errors.New("column count does not match value count")
+)
+
+// Column 列定义。
+type Column struct {
+	Name     string
+	Type     types.Type
+	Length   int
+	Nullable bool
+}
+
+// Schema 表结构。PrimaryKey 为主键列在 Columns 中的下标，按主键顺序排列；为空时行以自增的隐藏行号为键。
+type Schema struct {
+	Name       string
+	Columns    []Column
+	PrimaryKey []int
+}
+
+// NewSchema 校验并创建表结构，主键列总是 NOT NULL。
+func NewSchema(name string, columns []Column, primaryKey []string) (*Schema, error) {
+	if err := checkName("table", name); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: table %s has no columns", ErrInvalidSchema, name)
+	}
+	s := &Schema{Name: name, Columns: append([]Column(nil), columns...)}
+	for i, col := range s.Columns {
+		if err := checkName("column", col.Name); err != nil {
+			return nil, err
+		}
+		if !col.Type.Valid() {
+			return nil, fmt.Errorf("%w: column %s has unknown type", ErrInvalidSchema, col.Name)
+		}
+		if s.ColumnIndex(col.Name) != i {
+			return nil, fmt.Errorf("%w: duplicate column %s", ErrInvalidSchema, col.Name)
+		}
+	}
+	for _, pk := range primaryKey {
+		i := s.ColumnIndex(pk)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: primary key column %s", ErrColumnNotFound, pk)
+		}
+		for _, prev := range s.PrimaryKey {
+			if prev == i {
+				return nil, fmt.Errorf("%w: duplicate primary key column %s", ErrInvalidSchema, pk)
+			}
+		}
+		if s.Columns[i].Type == types.TypeText {
+			return nil, fmt.Errorf("%w: TEXT column %s cannot be a primary key", ErrInvalidSchema, pk)
+		}
+		s.Columns[i].Nullable = false
+		s.PrimaryKey = append(s.PrimaryKey, i)
+	}
+	return s, nil
+}
+
+func checkName(kind, name string) error {
+	if name == "" || len([]rune(name)) > MaxNameLength {
+		return fmt.Errorf("%w: %s name %q must be 1 to %d characters", ErrInvalidSchema, kind, name, MaxNameLength)
+	}
+	return nil
+}
+
+// ColumnIndex 按名称（不区分大小写）查找列下标，不存在时返回 -1。
+func (s *Schema) ColumnIndex(name string) int {
+	for i, col := range s.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsPrimaryKey 报告第 i 列是否属于主键。
+func (s *Schema) IsPrimaryKey(i int) bool {
+	for _, pk := range s.PrimaryKey {
+		if pk == i {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRow 按列类型转换并校验一行值，返回可直接编码的行。
+func (s *Schema) CheckRow(row []types.Value) ([]types.Value, error) {
+	if len(row) != len(s.Columns) {
+		return nil, fmt.Errorf("%w: %d columns, %d values", ErrColumnCount, len(s.Columns), len(row))
+	}
+	checked := make([]types.Value, len(row))
+	for i, col := range s.Columns {
+		if row[i].IsNull() {
+			if !col.Nullable {
+				return nil, fmt.Errorf("%w: %s", types.ErrNotNull, col.Name)
+			}
+			continue
+		}
+		v, err := types.Coerce(row[i], col.Type, col.Length)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		checked[i] = v
+	}
+	return checked, nil
+}
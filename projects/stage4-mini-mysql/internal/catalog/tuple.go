@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+var ErrCorruptTuple = errors.New("corrupt tuple")
+
+// EncodeTuple 将一行编码为 B+Tree 中的值：NULL 位图（每列一位，置位表示 NULL）后按列顺序跟随非 NULL 列：
+// INT 4 字节、BIGINT / DOUBLE / DATETIME（Unix 微秒）8 字节小端，BOOL 1 字节，VARCHAR / TEXT 为 uvarint 长度加内容。
+// row 应已经过 Schema.CheckRow。
+func EncodeTuple(s *Schema, row []types.Value) ([]byte, error) {
+	if len(row) != len(s.Columns) {
+		return nil, fmt.Errorf("%w: %d columns, %d values", ErrColumnCount, len(s.Columns), len(row))
+	}
+	buf := make([]byte, (len(row)+7)/8, 64)
+	for i, col := range s.Columns {
+		v := row[i]
+		if v.IsNull() {
+			buf[i/8] |= 1 << (i % 8)
+			continue
+		}
+		if !kindMatches(col.Type, v.Kind) {
+			return nil, fmt.Errorf("%w: column %s", types.ErrTypeMismatch, col.Name)
+		}
+		switch col.Type {
+		case types.TypeInt:
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(v.Int)))
+		case types.TypeBigInt:
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(v.Int))
+		case types.TypeDouble:
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float))
+		case types.TypeDatetime:
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(v.Time.UnixMicro()))
+		case types.TypeBool:
+			if v.Bool {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		case types.TypeVarchar, types.TypeText:
+			buf = binary.AppendUvarint(buf, uint64(len(v.Str)))
+			buf = append(buf, v.Str...)
+		}
+	}
+	return buf, nil
+}
+
+// DecodeTuple 解码 EncodeTuple 的结果。
+func DecodeTuple(s *Schema, data []byte) ([]types.Value, error) {
+	bitmap := (len(s.Columns) + 7) / 8
+	if len(data) < bitmap {
+		return nil, ErrCorruptTuple
+	}
+	row := make([]types.Value, len(s.Columns))
+	off := bitmap
+	take := func(n int) ([]byte, error) {
+		if n < 0 || off+n > len(data) {
+			return nil, ErrCorruptTuple
+		}
+		b := data[off : off+n]
+		off += n
+		return b, nil
+	}
+	for i, col := range s.Columns {
+		if data[i/8]&(1<<(i%8)) != 0 {
+			continue
+		}
+		var b []byte
+		var err error
+		switch col.Type {
+		case types.TypeInt:
+			if b, err = take(4); err == nil {
+				row[i] = types.NewInt(int64(int32(binary.LittleEndian.Uint32(b))))
+			}
+		case types.TypeBigInt:
+			if b, err = take(8); err == nil {
+				row[i] = types.NewInt(int64(binary.LittleEndian.Uint64(b)))
+			}
+		case types.TypeDouble:
+			if b, err = take(8); err == nil {
+				row[i] = types.NewFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			}
+		case types.TypeDatetime:
+			if b, err = take(8); err == nil {
+				row[i] = types.NewTime(time.UnixMicro(int64(binary.LittleEndian.Uint64(b))))
+			}
+		case types.TypeBool:
+			if b, err = take(1); err == nil {
+				row[i] = types.NewBool(b[0] != 0)
+			}
+		case types.TypeVarchar, types.TypeText:
+			n, size := binary.Uvarint(data[off:])
+			if size <= 0 || n > uint64(len(data)) {
+				return nil, ErrCorruptTuple
+			}
+			off += size
+			if b, err = take(int(n)); err == nil {
+				row[i] = types.NewString(string(b))
+			}
+		default:
+			err = ErrCorruptTuple
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if off != len(data) {
+		return nil, ErrCorruptTuple
+	}
+	return row, nil
+}
+
+// EncodeKey 将主键值（按主键列顺序）编码为可按字节比较的 B+Tree 键，字节序与值的大小顺序一致：
+// 整数与 DATETIME 翻转符号位后大端存放；DOUBLE 按 IEEE 754 全序变换；字符串中的 0x00 转义为 0x00 0xFF 并以 0x00 0x01 结尾，
+// 使复合主键中较短的前缀排在前面。values 也可以只包含主键的前若干列，用于范围扫描的边界。
+func EncodeKey(s *Schema, values []types.Value) ([]byte, error) {
+	if len(values) > len(s.PrimaryKey) {
+		return nil, fmt.Errorf("%w: %d primary key columns, %d values", ErrColumnCount, len(s.PrimaryKey), len(values))
+	}
+	var key []byte
+	for i, v := range values {
+		col := s.Columns[s.PrimaryKey[i]]
+		if v.IsNull() || !kindMatches(col.Type, v.Kind) {
+			return nil, fmt.Errorf("%w: primary key column %s", types.ErrTypeMismatch, col.Name)
+		}
+		switch col.Type {
+		case types.TypeInt, types.TypeBigInt:
+			key = binary.BigEndian.AppendUint64(key, uint64(v.Int)^(1<<63))
+		case types.TypeDatetime:
+			key = binary.BigEndian.AppendUint64(key, uint64(v.Time.UnixMicro())^(1<<63))
+		case types.TypeDouble:
+			bits := math.Float64bits(v.Float)
+			if bits&(1<<63) != 0 {
+				bits = ^bits
+			} else {
+				bits |= 1 << 63
+			}
+			key = binary.BigEndian.AppendUint64(key, bits)
+		case types.TypeBool:
+			if v.Bool {
+				key = append(key, 1)
+			} else {
+				key = append(key, 0)
+			}
+		case types.TypeVarchar:
+			for j := 0; j < len(v.Str); j++ {
+				key = append(key, v.Str[j])
+				if v.Str[j] == 0 {
+					key = append(key, 0xFF)
+				}
+			}
+			key = append(key, 0x00, 0x01)
+		}
+	}
+	return key, nil
+}
+
+// RowKey 返回一行在表 B+Tree 中的键：有主键时为主键编码，否则为 rowID 的 8 字节大端编码。
+func RowKey(s *Schema, row []types.Value, rowID int64) ([]byte, error) {
+	if len(s.PrimaryKey) == 0 {
+		return binary.BigEndian.AppendUint64(nil, uint64(rowID)), nil
+	}
+	values := make([]types.Value, len(s.PrimaryKey))
+	for i, pk := range s.PrimaryKey {
+		values[i] = row[pk]
+	}
+	return EncodeKey(s, values)
+}
+
+func kindMatches(t types.Type, kind types.Kind) bool {
+	switch t {
+	case types.TypeInt, types.TypeBigInt:
+		return kind == types.KindInt
+	case types.TypeDouble:
+		return kind == types.KindFloat
+	case types.TypeVarchar, types.TypeText:
+		return kind == types.KindString
+	case types.TypeBool:
+		return kind == types.KindBool
+	case types.TypeDatetime:
+		return kind == types.KindTime
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+// aggregate 编译后的聚合函数调用，COUNT(*) 的 arg 为 nil。
+type aggregate struct {
+	name     string
+	arg      evalFunc
+	distinct bool
+}
+
+// aggState 某个分组上一个聚合函数的中间状态，count 为参与计算的非 NULL 值个数。
+type aggState struct {
+	count    int64
+	sumInt   int64
+	sumFloat float64
+	isFloat  bool
+	best     types.Value
+	seen     map[string]struct{}
+}
+
+type aggGroup struct {
+	keys   Row
+	states []aggState
+}
+
+// HashAggregate 哈希分组聚合：Open 时读完全部输入按分组键建哈希表，之后按分组首次出现的顺序逐组输出
+// 分组键与各聚合结果。没有 GROUP BY 时整个输入为一组，输入为空也输出一行。
+type HashAggregate struct {
+	child   Operator
+	groupBy []evalFunc
+	aggs    []aggregate
+	fields  []Field
+
+	groups []*aggGroup
+	pos    int
+}
+
+// NewHashAggregate 创建聚合算子。输出列依次为分组表达式与聚合调用：分组列保留原列名，其他表达式以其文本命名，
+// 之后的 HAVING、ORDER BY 与查询列表据此引用它们。
+func NewHashAggregate(child Operator, groupBy []parser.Expr, calls []*parser.FuncCall) (*HashAggregate, error) {
+	h := &HashAggregate{child: child}
+	input := child.Fields()
+	for _, expr := range groupBy {
+		eval, err := compileExpr(expr, input)
+		if err != nil {
+			return nil, err
+		}
+		field := Field{Name: expr.String()}
+		if ref, ok := expr.(*parser.ColumnRef); ok {
+			i, _ := resolveColumn(input, ref)
+			field = input[i]
+		}
+		h.groupBy = append(h.groupBy, eval)
+		h.fields = append(h.fields, field)
+	}
+	for _, call := range calls {
+		agg := aggregate{name: call.Name, distinct: call.Distinct}
+		switch {
+		case !isAggregate(call.Name):
+			return nil, fmt.Errorf("%w: function %s", ErrUnsupported, call.Name)
+		case call.Star && call.Name != "COUNT":
+			return nil, fmt.Errorf("%w: %s", ErrUnsupported, call)
+		case !call.Star && len(call.Args) != 1:
+			return nil, fmt.Errorf("%w: %s takes exactly one argument", ErrUnsupported, call.Name)
+		case !call.Star:
+			eval, err := compileExpr(call.Args[0], input)
+			if err != nil {
+				return nil, err
+			}
+			agg.arg = eval
+		}
+		h.aggs = append(h.aggs, agg)
+		h.fields = append(h.fields, Field{Name: call.String()})
+	}
+	return h, nil
+}
+
+func (h *HashAggregate) Fields() []Field { return h.fields }
+
+func (h *HashAggregate) Open(ctx context.Context) error {
+	if err := h.child.Open(ctx); err != nil {
+		return err
+	}
+	h.groups, h.pos = nil, 0
+	index := make(map[string]*aggGroup)
+	keys := make(Row, len(h.groupBy))
+	var buf []byte
+	for {
+		row, err := h.child.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for i, eval := range h.groupBy {
+			if keys[i], err = eval(row); err != nil {
+				return err
+			}
+		}
+		buf = appendRow(buf[:0], keys)
+		g := index[string(buf)]
+		if g == nil {
+			g = &aggGroup{keys: append(Row(nil), keys...), states: make([]aggState, len(h.aggs))}
+			index[string(buf)] = g
+			h.groups = append(h.groups, g)
+		}
+		for i := range h.aggs {
+			if err = h.aggs[i].add(&g.states[i], row); err != nil {
+				return err
+			}
+		}
+	}
+	if len(h.groupBy) == 0 && len(h.groups) == 0 {
+		h.groups = append(h.groups, &aggGroup{states: make([]aggState, len(h.aggs))})
+	}
+	return nil
+}
+
+func (h *HashAggregate) Next(ctx context.Context) (Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if h.pos >= len(h.groups) {
+		return nil, io.EOF
+	}
+	g := h.groups[h.pos]
+	h.pos++
+	out := append(make(Row, 0, len(h.fields)), g.keys...)
+	for i := range h.aggs {
+		out = append(out, h.aggs[i].result(&g.states[i]))
+	}
+	return out, nil
+}
+
+func (h *HashAggregate) Close() error {
+	h.groups = nil
+	return h.child.Close()
+}
+
+func (a *aggregate) add(st *aggState, row Row) error {
+	if a.arg == nil {
+		st.count++
+		return nil
+	}
+	v, err := a.arg(row)
+	if err != nil || v.IsNull() {
+		return err
+	}
+	if a.distinct {
+		key := string(appendRow(nil, Row{v}))
+		if _, dup := st.seen[key]; dup {
+			return nil
+		}
+		if st.seen == nil {
+			st.seen = make(map[string]struct{})
+		}
+		st.seen[key] = struct{}{}
+	}
+	switch a.name {
+	case "SUM", "AVG":
+		i, f, isInt, err := numeric(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.name, err)
+		}
+		st.sumFloat += f
+		if !isInt {
+			st.isFloat = true
+		} else if a.name == "SUM" && !st.isFloat {
+			sum := st.sumInt + i
+			if (sum > st.sumInt) != (i > 0) {
+				return fmt.Errorf("%w: SUM overflows BIGINT", types.ErrOutOfRange)
+			}
+			st.sumInt = sum
+		}
+	case "MIN", "MAX":
+		if st.count > 0 {
+			c, err := types.Compare(v, st.best)
+			if err != nil {
+				return err
+			}
+			if (a.name == "MIN" && c >= 0) || (a.name == "MAX" && c <= 0) {
+				break
+			}
+		}
+		st.best = v
+	}
+	st.count++
+	return nil
+}
+
+// result 返回聚合结果：COUNT 为整数，SUM 在输入都是整数时为整数，AVG 为浮点数；没有非 NULL 输入时除 COUNT 外都为 NULL。
+func (a *aggregate) result(st *aggState) types.Value {
+	if a.name == "COUNT" {
+		return types.NewInt(st.count)
+	}
+	if st.count == 0 {
+		return types.Null()
+	}
+	switch a.name {
+	case "SUM":
+		if st.isFloat {
+			return types.NewFloat(st.sumFloat)
+		}
+		return types.NewInt(st.sumInt)
+	case "AVG":
+		return types.NewFloat(st.sumFloat / float64(st.count))
+	default:
+		return st.best
+	}
+}
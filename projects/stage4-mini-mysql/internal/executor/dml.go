@@ -0,0 +1,251 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+// storedRow 表中的一行及其 B+Tree 键。
+type storedRow struct {
+	key    []byte
+	values []types.Value
+}
+
+func (e *Engine) writableTable(name string) (*catalog.Table, error) {
+	table, err := e.catalog.Table(name)
+	if err != nil {
+		return nil, err
+	}
+	if table.System {
+		return nil, fmt.Errorf("%w: %s", catalog.ErrSystemTable, name)
+	}
+	return table, nil
+}
+
+func (e *Engine) execInsert(ctx context.Context, sessionID string, stmt *parser.InsertStmt) (string, error) {
+	table, err := e.writableTable(stmt.Table)
+	if err != nil {
+		return "", err
+	}
+	schema := table.Schema
+	positions := make([]int, len(schema.Columns))
+	for i := range positions {
+		positions[i] = i
+	}
+	if len(stmt.Columns) > 0 {
+		positions = positions[:0]
+		for _, name := range stmt.Columns {
+			i := schema.ColumnIndex(name)
+			if i < 0 {
+				return "", fmt.Errorf("%w: %s", catalog.ErrColumnNotFound, name)
+			}
+			positions = append(positions, i)
+		}
+	}
+
+	// 先校验全部行并检查主键冲突，再逐行写入，避免多行 INSERT 写入一半后失败。
+	rows := make([]storedRow, 0, len(stmt.Rows))
+	seen := make(map[string]bool, len(stmt.Rows))
+	for _, exprs := range stmt.Rows {
+		if len(exprs) != len(positions) {
+			return "", fmt.Errorf("%w: %d columns, %d values", catalog.ErrColumnCount, len(positions), len(exprs))
+		}
+		values := make([]types.Value, len(schema.Columns))
+		for i, expr := range exprs {
+			if values[positions[i]], err = evalConst(expr); err != nil {
+				return "", err
+			}
+		}
+		if values, err = schema.CheckRow(values); err != nil {
+			return "", err
+		}
+		var key []byte
+		if len(schema.PrimaryKey) == 0 {
+			rowID, err := e.catalog.NextRowID(ctx, table)
+			if err != nil {
+				return "", err
+			}
+			key, err = catalog.RowKey(schema, values, rowID)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			if key, err = catalog.RowKey(schema, values, 0); err != nil {
+				return "", err
+			}
+			if seen[string(key)] {
+				return "", ErrDuplicateKey
+			}
+			if _, err = table.Tree.Search(ctx, key); err == nil {
+				return "", ErrDuplicateKey
+			} else if !errors.Is(err, storage.ErrKeyNotFound) {
+				return "", err
+			}
+			seen[string(key)] = true
+		}
+		rows = append(rows, storedRow{key: key, values: values})
+	}
+	for _, row := range rows {
+		if err = e.putRow(ctx, sessionID, table, row); err != nil {
+			return "", err
+		}
+	}
+	return "OK", nil
+}
+
+func (e *Engine) execUpdate(ctx context.Context, sessionID string, stmt *parser.UpdateStmt) (string, error) {
+	table, err := e.writableTable(stmt.Table)
+	if err != nil {
+		return "", err
+	}
+	schema := table.Schema
+	// SET 的表达式按修改前的行求值，例如 SET a = b, b = a 交换两列。
+	fields := tableFields(table, table.Schema.Name)
+	targets := make([]int, len(stmt.Set))
+	assignments := make([]evalFunc, len(stmt.Set))
+	for n, set := range stmt.Set {
+		if targets[n] = schema.ColumnIndex(set.Column); targets[n] < 0 {
+			return "", fmt.Errorf("%w: %s", catalog.ErrColumnNotFound, set.Column)
+		}
+		if assignments[n], err = compileExpr(set.Value, fields); err != nil {
+			return "", err
+		}
+	}
+	rows, err := e.matchRows(ctx, table, stmt.Where)
+	if err != nil {
+		return "", err
+	}
+	updated := make([]storedRow, len(rows))
+	for r, row := range rows {
+		values := append([]types.Value(nil), row.values...)
+		for n, eval := range assignments {
+			if values[targets[n]], err = eval(row.values); err != nil {
+				return "", err
+			}
+		}
+		if values, err = schema.CheckRow(values); err != nil {
+			return "", err
+		}
+		key := row.key
+		if len(schema.PrimaryKey) > 0 {
+			if key, err = catalog.RowKey(schema, values, 0); err != nil {
+				return "", err
+			}
+		}
+		updated[r] = storedRow{key: key, values: values}
+	}
+	// 修改主键的行先删除旧键，再检查新键是否与表中其他行冲突。
+	moved := make(map[string]bool)
+	for r, row := range updated {
+		if !bytes.Equal(row.key, rows[r].key) {
+			moved[string(rows[r].key)] = true
+		}
+	}
+	for r, row := range updated {
+		if bytes.Equal(row.key, rows[r].key) {
+			continue
+		}
+		if _, err = table.Tree.Search(ctx, row.key); err == nil && !moved[string(row.key)] {
+			return "", ErrDuplicateKey
+		} else if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+			return "", err
+		}
+	}
+	for r := range updated {
+		if !bytes.Equal(updated[r].key, rows[r].key) {
+			if err = e.deleteRow(ctx, sessionID, table, rows[r].key); err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, row := range updated {
+		if err = e.putRow(ctx, sessionID, table, row); err != nil {
+			return "", err
+		}
+	}
+	return "OK", nil
+}
+
+func (e *Engine) execDelete(ctx context.Context, sessionID string, stmt *parser.DeleteStmt) (string, error) {
+	table, err := e.writableTable(stmt.Table)
+	if err != nil {
+		return "", err
+	}
+	rows, err := e.matchRows(ctx, table, stmt.Where)
+	if err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		if err = e.deleteRow(ctx, sessionID, table, row.key); err != nil {
+			return "", err
+		}
+	}
+	return "OK", nil
+}
+
+// putRow 写入一行，会话处于事务中时经事务管理器写入。
+func (e *Engine) putRow(ctx context.Context, sessionID string, table *catalog.Table, row storedRow) error {
+	value, err := catalog.EncodeTuple(table.Schema, row.values)
+	if err != nil {
+		return err
+	}
+	if tx := e.sessionTx(sessionID); tx != nil {
+		return e.txMgr.Put(ctx, tx, table.Tree, row.key, value)
+	}
+	return table.Tree.Insert(ctx, row.key, value)
+}
+
+func (e *Engine) deleteRow(ctx context.Context, sessionID string, table *catalog.Table, key []byte) error {
+	if tx := e.sessionTx(sessionID); tx != nil {
+		return e.txMgr.Delete(ctx, tx, table.Tree, key)
+	}
+	err := table.Tree.Delete(ctx, key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+// matchRows 读取表中满足 where 的行。结果先全部读出再由调用方改写，避免边扫描边修改 B+Tree。
+func (e *Engine) matchRows(ctx context.Context, table *catalog.Table, where parser.Expr) (rows []storedRow, err error) {
+	scan, err := planScan(table, table.Schema.Name, where)
+	if err != nil {
+		return nil, err
+	}
+	match := func(Row) (bool, error) { return true, nil }
+	if where != nil {
+		if match, err = predicate(where, scan.Fields()); err != nil {
+			return nil, err
+		}
+	}
+	if err = scan.Open(ctx); err != nil {
+		return nil, errors.Join(err, scan.Close())
+	}
+	defer func() {
+		err = errors.Join(err, scan.Close())
+	}()
+	for {
+		row, err := scan.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ok, err := match(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, storedRow{key: bytes.Clone(scan.lastKey()), values: row})
+		}
+	}
+}
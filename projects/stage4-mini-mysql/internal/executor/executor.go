@@ -4,39 +4,70 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
-	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/txn"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/wal"
 )
 
 var (
-	ErrTableNotFound = errors.New("table not found")
+	ErrTableNotFound = catalog.ErrTableNotFound
+	ErrUnsupported   = errors.New("unsupported statement")
+	ErrDuplicateKey  = errors.New("duplicate primary key")
 )
 
-// Engine 执行引擎。
+// Engine 执行引擎。表结构与表数据都经 catalog 访问。
 type Engine struct {
 	mu       sync.RWMutex
-	tables   map[string]*storage.BPlusTree
+	catalog  *catalog.Catalog
 	txMgr    *txn.Manager
 	activeTx map[string]*txn.Transaction
+
+	workMem      int
+	tempDir      string
+	joinStrategy JoinStrategy
 }
 
 // NewEngine 创建执行引擎。
-func NewEngine(txMgr *txn.Manager) *Engine {
-	return &Engine{tables: make(map[string]*storage.BPlusTree), txMgr: txMgr, activeTx: make(map[string]*txn.Transaction)}
+func NewEngine(cat *catalog.Catalog, txMgr *txn.Manager) *Engine {
+	return &Engine{catalog: cat, txMgr: txMgr, activeTx: make(map[string]*txn.Transaction), workMem: DefaultWorkMem}
 }
 
-// CreateTable 创建表。
-func (e *Engine) CreateTable(name string, tree *storage.BPlusTree) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	e.tables[name] = tree
+// SetWorkMem 设置排序等算子可使用的内存上限（字节），超出后溢出到临时文件。
+func (e *Engine) SetWorkMem(bytes int) {
+	e.workMem = bytes
+}
+
+// SetJoinStrategy 指定连接算法，默认 JoinAuto 由规划器选择。
+func (e *Engine) SetJoinStrategy(strategy JoinStrategy) {
+	e.joinStrategy = strategy
+}
+
+// SetTempDir 设置溢出临时文件所在的目录，为空时使用系统临时目录。
+func (e *Engine) SetTempDir(dir string) {
+	e.tempDir = dir
+}
+
+// Catalog 返回引擎使用的系统目录。
+func (e *Engine) Catalog() *catalog.Catalog {
+	return e.catalog
+}
+
+// ExecuteSQL 解析并执行一条 SQL 语句。
+func (e *Engine) ExecuteSQL(ctx context.Context, sessionID string, sql string) (string, error) {
+	statement, err := parser.Parse(sql)
+	if err != nil {
+		return "", err
+	}
+	return e.Execute(ctx, sessionID, statement)
 }
 
-// Execute 执行 SQL 语句。
+// Execute 执行 SQL 语句。查询结果每行的列以 | 分隔、行之间以 , 分隔，没有结果时返回 NULL；
+// 需要逐行读取查询结果时使用 Query。
 func (e *Engine) Execute(ctx context.Context, sessionID string, statement parser.Statement) (string, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -47,13 +78,21 @@ func (e *Engine) Execute(ctx context.Context, sessionID string, statement parser
 
 	switch s := statement.(type) {
 	case *parser.CreateTableStmt:
-		return e.execCreateTable(s)
+		return e.execCreateTable(ctx, s)
+	case *parser.DropTableStmt:
+		return e.execDropTable(ctx, s)
+	case *parser.ShowTablesStmt:
+		return strings.Join(e.catalog.TableNames(), ","), nil
+	case *parser.DescribeStmt:
+		return e.execDescribe(s)
 	case *parser.InsertStmt:
 		return e.execInsert(ctx, sessionID, s)
 	case *parser.SelectStmt:
 		return e.execSelect(ctx, s)
-	case *parser.SelectRangeStmt:
-		return e.execSelectRange(ctx, s)
+	case *parser.UpdateStmt:
+		return e.execUpdate(ctx, sessionID, s)
+	case *parser.DeleteStmt:
+		return e.execDelete(ctx, sessionID, s)
 	case *parser.TxStmt:
 		return e.execTx(ctx, sessionID, s)
 	default:
@@ -61,73 +100,56 @@ func (e *Engine) Execute(ctx context.Context, sessionID string, statement parser
 	}
 }
 
-func (e *Engine) execCreateTable(stmt *parser.CreateTableStmt) (string, error) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	if _, ok := e.tables[stmt.Table]; ok {
-		return "OK", nil
+func (e *Engine) execCreateTable(ctx context.Context, stmt *parser.CreateTableStmt) (string, error) {
+	if stmt.IfNotExists {
+		if _, err := e.catalog.Table(stmt.Table); err == nil {
+			return "OK", nil
+		}
 	}
-	e.tables[stmt.Table] = storage.NewBPlusTree(16, nil)
-	return "OK", nil
-}
-
-func (e *Engine) execInsert(ctx context.Context, sessionID string, stmt *parser.InsertStmt) (string, error) {
-	tree, err := e.getTable(stmt.Table)
+	columns := make([]catalog.Column, len(stmt.Columns))
+	for i, def := range stmt.Columns {
+		typ, err := types.ParseType(def.Type, def.Length)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %w", def.Name, err)
+		}
+		columns[i] = catalog.Column{Name: def.Name, Type: typ, Length: def.Length, Nullable: !def.NotNull}
+	}
+	schema, err := catalog.NewSchema(stmt.Table, columns, stmt.PrimaryKey)
 	if err != nil {
 		return "", err
 	}
-
-	e.mu.Lock()
-	tx := e.activeTx[sessionID]
-	e.mu.Unlock()
-	if tx != nil {
-		if err = e.txMgr.Put(ctx, tx, []byte(stmt.Key), []byte(stmt.Value)); err != nil {
-			return "", err
-		}
-		return "OK", nil
-	}
-	if err = tree.Insert(ctx, []byte(stmt.Key), []byte(stmt.Value)); err != nil {
+	if _, err = e.catalog.CreateTable(ctx, schema); err != nil {
 		return "", err
 	}
 	return "OK", nil
 }
 
-func (e *Engine) execSelect(ctx context.Context, stmt *parser.SelectStmt) (string, error) {
-	tree, err := e.getTable(stmt.Table)
-	if err != nil {
-		return "", err
-	}
-	value, err := tree.Search(ctx, []byte(stmt.Key))
-	if err != nil {
-		if errors.Is(err, storage.ErrKeyNotFound) {
-			return "NULL", nil
-		}
+func (e *Engine) execDropTable(ctx context.Context, stmt *parser.DropTableStmt) (string, error) {
+	err := e.catalog.DropTable(ctx, stmt.Table)
+	if err != nil && !(stmt.IfExists && errors.Is(err, catalog.ErrTableNotFound)) {
 		return "", err
 	}
-	return string(value), nil
+	return "OK", nil
 }
 
-func (e *Engine) execSelectRange(ctx context.Context, stmt *parser.SelectRangeStmt) (string, error) {
-	tree, err := e.getTable(stmt.Table)
-	if err != nil {
-		return "", err
-	}
-	iterator, err := tree.RangeScan(ctx, []byte(stmt.Start), []byte(stmt.End))
+// execDescribe 每列一行：列名|类型|是否可空|是否主键。
+func (e *Engine) execDescribe(stmt *parser.DescribeStmt) (string, error) {
+	table, err := e.catalog.Table(stmt.Table)
 	if err != nil {
 		return "", err
 	}
-	result := ""
-	for iterator.Next() {
-		item := iterator.Item()
-		if result != "" {
-			result += ","
+	rows := make([]string, len(table.Schema.Columns))
+	for i, col := range table.Schema.Columns {
+		nullable, key := "NO", ""
+		if col.Nullable {
+			nullable = "YES"
 		}
-		result += fmt.Sprintf("%s=%s", string(item.Key), string(item.Value))
-	}
-	if result == "" {
-		return "NULL", nil
+		if table.Schema.IsPrimaryKey(i) {
+			key = "PRI"
+		}
+		rows[i] = strings.Join([]string{col.Name, col.Type.Format(col.Length), nullable, key}, "|")
 	}
-	return result, nil
+	return strings.Join(rows, ","), nil
 }
 
 func (e *Engine) execTx(ctx context.Context, sessionID string, stmt *parser.TxStmt) (string, error) {
@@ -167,25 +189,20 @@ func (e *Engine) execTx(ctx context.Context, sessionID string, stmt *parser.TxSt
 	}
 }
 
-func (e *Engine) getTable(name string) (*storage.BPlusTree, error) {
+func (e *Engine) sessionTx(sessionID string) *txn.Transaction {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	table, ok := e.tables[name]
-	if !ok {
-		return nil, ErrTableNotFound
-	}
-	return table, nil
+	return e.activeTx[sessionID]
 }
 
-// BootstrapDefaultTable 初始化默认表。
-func BootstrapDefaultTable(engine *Engine, tree *storage.BPlusTree) {
-	engine.CreateTable("kv", tree)
-}
+// DefaultTable 默认表的建表语句，NewWithDefaults 在目录中没有该表时创建。
+const DefaultTable = "CREATE TABLE IF NOT EXISTS kv (key VARCHAR(255) PRIMARY KEY, value TEXT)"
 
-// NewWithDefaults 创建默认引擎。
-func NewWithDefaults(tree *storage.BPlusTree, walWriter *wal.Writer) *Engine {
-	txMgr := txn.NewManager(walWriter, tree)
-	engine := NewEngine(txMgr)
-	BootstrapDefaultTable(engine, tree)
-	return engine
+// NewWithDefaults 创建默认引擎并确保默认表 kv 存在。
+func NewWithDefaults(ctx context.Context, cat *catalog.Catalog, walWriter *wal.Writer) (*Engine, error) {
+	engine := NewEngine(cat, txn.NewManager(walWriter))
+	if _, err := engine.ExecuteSQL(ctx, "", DefaultTable); err != nil {
+		return nil, err
+	}
+	return engine, nil
 }
@@ -2,11 +2,16 @@ package executor
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/txn"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/wal"
 )
 
@@ -27,15 +32,125 @@ func TestEngineExecute(t *testing.T) {
 		_ = walWriter.Close()
 	}()
 
-	tree := storage.NewBPlusTree(16, pager)
-	engine := NewWithDefaults(tree, walWriter)
 	ctx := context.Background()
+	cat, err := catalog.Create(ctx, buffer.NewBufferPoolManager(16, pager))
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine, err := NewWithDefaults(ctx, cat, walWriter)
+	if err != nil {
+		t.Fatalf("NewWithDefaults() error = %v", err)
+	}
 
-	_, _ = engine.Execute(ctx, "s1", &parser.CreateTableStmt{Table: "kv"})
-	if result, execErr := engine.Execute(ctx, "s1", &parser.InsertStmt{Table: "kv", Key: "a", Value: "1"}); execErr != nil || result != "OK" {
+	if result, execErr := engine.ExecuteSQL(ctx, "s1", "CREATE TABLE kv (key VARCHAR(64) PRIMARY KEY, value TEXT)"); !errors.Is(execErr, catalog.ErrTableExists) {
+		t.Fatalf("create existing table = (%q, %v), want %v", result, execErr, catalog.ErrTableExists)
+	}
+	if result, execErr := engine.ExecuteSQL(ctx, "s1", "INSERT INTO kv VALUES ('a', '1')"); execErr != nil || result != "OK" {
 		t.Fatalf("insert result = (%q, %v)", result, execErr)
 	}
-	if result, execErr := engine.Execute(ctx, "s1", &parser.SelectStmt{Table: "kv", Key: "a"}); execErr != nil || result != "1" {
+	if result, execErr := engine.ExecuteSQL(ctx, "s1", "SELECT value FROM kv WHERE key = 'a'"); execErr != nil || result != "1" {
 		t.Fatalf("select result = (%q, %v)", result, execErr)
 	}
 }
+
+func TestEngineExecuteSQLStatements(t *testing.T) {
+	ctx := context.Background()
+	cat, err := catalog.Create(ctx, nil)
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	walWriter, err := wal.NewWriter(filepath.Join(t.TempDir(), "exec.wal"))
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	defer func() {
+		_ = walWriter.Close()
+	}()
+	engine, err := NewWithDefaults(ctx, cat, walWriter)
+	if err != nil {
+		t.Fatalf("NewWithDefaults() error = %v", err)
+	}
+
+	steps := []struct {
+		sql  string
+		want string
+	}{
+		{"INSERT INTO kv (value, key) VALUES ('1', 'a'), ('2', 'b'), ('3', 'c')", "OK"},
+		{"SELECT * FROM kv WHERE key BETWEEN 'a' AND 'b'", "a|1,b|2"},
+		{"UPDATE kv SET value = '20' WHERE key = 'b'", "OK"},
+		{"UPDATE kv SET value = 'x' WHERE key = 'missing'", "OK"},
+		{"DELETE FROM kv WHERE key = 'a'", "OK"},
+		{"SELECT * FROM kv", "b|20,c|3"},
+		{"SELECT value FROM kv WHERE key = 'missing'", "NULL"},
+		{"DROP TABLE kv", "OK"},
+		{"DROP TABLE IF EXISTS kv", "OK"},
+	}
+	for _, step := range steps {
+		if result, execErr := engine.ExecuteSQL(ctx, "s1", step.sql); execErr != nil || result != step.want {
+			t.Fatalf("ExecuteSQL(%q) = (%q, %v), want %q", step.sql, result, execErr, step.want)
+		}
+	}
+	if _, err = engine.ExecuteSQL(ctx, "s1", "SELECT * FROM kv"); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("SELECT dropped table error = %v, want %v", err, ErrTableNotFound)
+	}
+	if _, err = engine.ExecuteSQL(ctx, "s1", "SELEC 1"); !errors.Is(err, parser.ErrInvalidSQL) {
+		t.Fatalf("ExecuteSQL(invalid) error = %v, want %v", err, parser.ErrInvalidSQL)
+	}
+}
+
+func TestEngineTypedTables(t *testing.T) {
+	ctx := context.Background()
+	cat, err := catalog.Create(ctx, nil)
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine := NewEngine(cat, txn.NewManager(nil))
+
+	steps := []struct {
+		sql  string
+		want string
+	}{
+		{"CREATE TABLE users (id BIGINT PRIMARY KEY, name VARCHAR(8) NOT NULL, score DOUBLE, active BOOL)", "OK"},
+		{"CREATE TABLE logs (msg TEXT)", "OK"},
+		{"SHOW TABLES", "logs,users"},
+		{"DESCRIBE users", "id|BIGINT|NO|PRI,name|VARCHAR(8)|NO|,score|DOUBLE|YES|,active|BOOL|YES|"},
+		{"INSERT INTO users VALUES (2, 'bob', 1.5, TRUE), (-1, 'eve', NULL, FALSE)", "OK"},
+		{"INSERT INTO users (name, id) VALUES ('al', 10)", "OK"},
+		{"SELECT * FROM users", "-1|eve|NULL|FALSE,2|bob|1.5|TRUE,10|al|NULL|NULL"},
+		{"SELECT name FROM users WHERE id BETWEEN -1 AND 2", "eve,bob"},
+		{"UPDATE users SET id = 3, score = 7 WHERE id = 2", "OK"},
+		{"SELECT id, score FROM users WHERE id = 3", "3|7"},
+		{"SELECT * FROM users WHERE name = 'al'", "10|al|NULL|NULL"},
+		{"INSERT INTO logs VALUES ('first'), ('second')", "OK"},
+		{"SELECT * FROM logs", "first,second"},
+	}
+	for _, step := range steps {
+		if result, execErr := engine.ExecuteSQL(ctx, "s1", step.sql); execErr != nil || result != step.want {
+			t.Fatalf("ExecuteSQL(%q) = (%q, %v), want %q", step.sql, result, execErr, step.want)
+		}
+	}
+
+	failures := []struct {
+		sql  string
+		want error
+	}{
+		{"INSERT INTO users VALUES (3, 'dup', NULL, NULL)", ErrDuplicateKey},
+		{"INSERT INTO users VALUES (4, 'x', NULL, NULL), (4, 'y', NULL, NULL)", ErrDuplicateKey},
+		{"INSERT INTO users VALUES ('abc', 'x', NULL, NULL)", types.ErrTypeMismatch},
+		{"INSERT INTO users VALUES (5, 'toolongname', NULL, NULL)", types.ErrTooLong},
+		{"INSERT INTO users (id) VALUES (5)", types.ErrNotNull},
+		{"INSERT INTO users (id, nope) VALUES (5, 1)", catalog.ErrColumnNotFound},
+		{"UPDATE users SET id = 10 WHERE id = 3", ErrDuplicateKey},
+		{"SELECT UPPER(name) FROM users", ErrUnsupported},
+		{"DELETE FROM sys_tables", catalog.ErrSystemTable},
+		{"DESCRIBE missing", ErrTableNotFound},
+	}
+	for _, tc := range failures {
+		if result, execErr := engine.ExecuteSQL(ctx, "s1", tc.sql); !errors.Is(execErr, tc.want) {
+			t.Fatalf("ExecuteSQL(%q) = (%q, %v), want %v", tc.sql, result, execErr, tc.want)
+		}
+	}
+	if result, execErr := engine.ExecuteSQL(ctx, "s1", "SELECT id FROM users WHERE id = 4"); execErr != nil || result != "NULL" {
+		t.Fatalf("failed batch insert left rows: (%q, %v)", result, execErr)
+	}
+}
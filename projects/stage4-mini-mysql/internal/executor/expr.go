@@ -0,0 +1,498 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+var (
+	ErrAmbiguousColumn = errors.New("ambiguous column")
+	ErrNotGrouped      = errors.New("column must appear in GROUP BY or be used in an aggregate function")
+)
+
+// evalFunc 编译后的表达式，对一行求值。
+type evalFunc func(Row) (types.Value, error)
+
+// resolveColumn 在 fields 中查找列引用：列名不区分大小写，表名限定须完全一致；未限定且多张表都有同名列时报错。
+func resolveColumn(fields []Field, ref *parser.ColumnRef) (int, error) {
+	found := -1
+	for i, f := range fields {
+		if !strings.EqualFold(f.Name, ref.Name) || (ref.Table != "" && f.Table != ref.Table) {
+			continue
+		}
+		if found >= 0 && fields[found] != f {
+			return -1, fmt.Errorf("%w: %s", ErrAmbiguousColumn, ref)
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("%w: %s", catalog.ErrColumnNotFound, ref)
+	}
+	return found, nil
+}
+
+// compileExpr 将表达式编译为对 fields 描述的行求值的函数。与某个计算列的表达式文本相同的子表达式直接读取该列，
+// 聚合之后的 HAVING、ORDER BY 与查询列表由此引用分组表达式与聚合结果。
+func compileExpr(expr parser.Expr, fields []Field) (evalFunc, error) {
+	switch e := expr.(type) {
+	case *parser.Literal:
+		v, err := literalValue(e)
+		if err != nil {
+			return nil, err
+		}
+		return func(Row) (types.Value, error) { return v, nil }, nil
+	case *parser.ColumnRef:
+		i, err := resolveColumn(fields, e)
+		if err != nil {
+			return nil, err
+		}
+		return columnAt(i), nil
+	}
+
+	name := expr.String()
+	for i, f := range fields {
+		if f.Table == "" && f.Name == name {
+			return columnAt(i), nil
+		}
+	}
+
+	switch e := expr.(type) {
+	case *parser.UnaryExpr:
+		operand, err := compileExpr(e.Expr, fields)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == "NOT" {
+			return func(r Row) (types.Value, error) {
+				v, err := operand(r)
+				if err != nil {
+					return types.Value{}, err
+				}
+				b, null, err := truth(v)
+				if err != nil || null {
+					return types.Value{}, err
+				}
+				return types.NewBool(!b), nil
+			}, nil
+		}
+		return func(r Row) (types.Value, error) {
+			v, err := operand(r)
+			if err != nil {
+				return types.Value{}, err
+			}
+			return negate(v)
+		}, nil
+	case *parser.BinaryExpr:
+		return compileBinary(e, fields)
+	case *parser.InExpr:
+		return compileIn(e, fields)
+	case *parser.BetweenExpr:
+		// BETWEEN 按 expr >= low AND expr <= high 求值。
+		and := &parser.BinaryExpr{Op: "AND",
+			Left:  &parser.BinaryExpr{Op: ">=", Left: e.Expr, Right: e.Low},
+			Right: &parser.BinaryExpr{Op: "<=", Left: e.Expr, Right: e.High},
+		}
+		if e.Not {
+			return compileExpr(&parser.UnaryExpr{Op: "NOT", Expr: and}, fields)
+		}
+		return compileExpr(and, fields)
+	case *parser.LikeExpr:
+		return compileLike(e, fields)
+	case *parser.IsNullExpr:
+		operand, err := compileExpr(e.Expr, fields)
+		if err != nil {
+			return nil, err
+		}
+		return func(r Row) (types.Value, error) {
+			v, err := operand(r)
+			if err != nil {
+				return types.Value{}, err
+			}
+			return types.NewBool(v.IsNull() != e.Not), nil
+		}, nil
+	case *parser.FuncCall:
+		if isAggregate(e.Name) {
+			return nil, fmt.Errorf("%w: aggregate %s is not allowed here", ErrUnsupported, e)
+		}
+		return nil, fmt.Errorf("%w: function %s", ErrUnsupported, e.Name)
+	case *parser.StarExpr:
+		return nil, fmt.Errorf("%w: %s outside the select list", ErrUnsupported, e)
+	}
+	return nil, fmt.Errorf("%w: expression %s", ErrUnsupported, expr)
+}
+
+func columnAt(i int) evalFunc {
+	return func(r Row) (types.Value, error) { return r[i], nil }
+}
+
+func compileBinary(e *parser.BinaryExpr, fields []Field) (evalFunc, error) {
+	left, err := compileExpr(e.Left, fields)
+	if err != nil {
+		return nil, err
+	}
+	right, err := compileExpr(e.Right, fields)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "AND", "OR":
+		// 三值逻辑：AND 遇到 FALSE、OR 遇到 TRUE 即可确定结果，否则任一侧为 NULL 时结果为 NULL。
+		decisive := e.Op == "OR"
+		return func(r Row) (types.Value, error) {
+			sawNull := false
+			for _, side := range []evalFunc{left, right} {
+				v, err := side(r)
+				if err != nil {
+					return types.Value{}, err
+				}
+				b, null, err := truth(v)
+				if err != nil {
+					return types.Value{}, err
+				}
+				if null {
+					sawNull = true
+				} else if b == decisive {
+					return types.NewBool(decisive), nil
+				}
+			}
+			if sawNull {
+				return types.Null(), nil
+			}
+			return types.NewBool(!decisive), nil
+		}, nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		return func(r Row) (types.Value, error) {
+			a, err := left(r)
+			if err != nil {
+				return types.Value{}, err
+			}
+			b, err := right(r)
+			if err != nil || a.IsNull() || b.IsNull() {
+				return types.Value{}, err
+			}
+			c, err := types.Compare(a, b)
+			if err != nil {
+				return types.Value{}, err
+			}
+			return types.NewBool(compareResult(e.Op, c)), nil
+		}, nil
+	case "+", "-", "*", "/", "%":
+		return func(r Row) (types.Value, error) {
+			a, err := left(r)
+			if err != nil {
+				return types.Value{}, err
+			}
+			b, err := right(r)
+			if err != nil {
+				return types.Value{}, err
+			}
+			return arithmetic(e.Op, a, b)
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: operator %s", ErrUnsupported, e.Op)
+}
+
+func compileIn(e *parser.InExpr, fields []Field) (evalFunc, error) {
+	operand, err := compileExpr(e.Expr, fields)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]evalFunc, len(e.List))
+	for i, item := range e.List {
+		if list[i], err = compileExpr(item, fields); err != nil {
+			return nil, err
+		}
+	}
+	return func(r Row) (types.Value, error) {
+		v, err := operand(r)
+		if err != nil || v.IsNull() {
+			return types.Value{}, err
+		}
+		sawNull := false
+		for _, item := range list {
+			candidate, err := item(r)
+			if err != nil {
+				return types.Value{}, err
+			}
+			if candidate.IsNull() {
+				sawNull = true
+				continue
+			}
+			c, err := types.Compare(v, candidate)
+			if err != nil {
+				return types.Value{}, err
+			}
+			if c == 0 {
+				return types.NewBool(!e.Not), nil
+			}
+		}
+		if sawNull {
+			return types.Null(), nil
+		}
+		return types.NewBool(e.Not), nil
+	}, nil
+}
+
+func compileLike(e *parser.LikeExpr, fields []Field) (evalFunc, error) {
+	operand, err := compileExpr(e.Expr, fields)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := compileExpr(e.Pattern, fields)
+	if err != nil {
+		return nil, err
+	}
+	return func(r Row) (types.Value, error) {
+		v, err := operand(r)
+		if err != nil {
+			return types.Value{}, err
+		}
+		p, err := pattern(r)
+		if err != nil || v.IsNull() || p.IsNull() {
+			return types.Value{}, err
+		}
+		return types.NewBool(likeMatch([]rune(v.String()), parseLike(p.String())) != e.Not), nil
+	}, nil
+}
+
+// predicate 编译过滤条件，只有求值为 TRUE 的行满足条件，NULL 与 FALSE 一样被过滤掉。
+func predicate(expr parser.Expr, fields []Field) (func(Row) (bool, error), error) {
+	eval, err := compileExpr(expr, fields)
+	if err != nil {
+		return nil, err
+	}
+	return func(r Row) (bool, error) {
+		v, err := eval(r)
+		if err != nil {
+			return false, err
+		}
+		b, null, err := truth(v)
+		return b && !null, err
+	}, nil
+}
+
+// evalConst 对不引用任何列的表达式求值，例如 INSERT 的 VALUES。
+func evalConst(expr parser.Expr) (types.Value, error) {
+	eval, err := compileExpr(expr, nil)
+	if err != nil {
+		return types.Value{}, err
+	}
+	return eval(nil)
+}
+
+// literalValue 将字面量转换为值，列类型的检查与转换由 Schema.CheckRow 完成。
+func literalValue(lit *parser.Literal) (types.Value, error) {
+	switch lit.Kind {
+	case parser.LiteralInt:
+		v, err := strconv.ParseInt(lit.Value, 10, 64)
+		if err != nil {
+			return types.Value{}, fmt.Errorf("%w: %s", types.ErrOutOfRange, lit.Value)
+		}
+		return types.NewInt(v), nil
+	case parser.LiteralFloat:
+		v, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return types.Value{}, fmt.Errorf("%w: %s", types.ErrOutOfRange, lit.Value)
+		}
+		return types.NewFloat(v), nil
+	case parser.LiteralString:
+		return types.NewString(lit.Value), nil
+	case parser.LiteralBool:
+		return types.NewBool(lit.Value == "TRUE"), nil
+	default:
+		return types.Null(), nil
+	}
+}
+
+// truth 返回值的真假；null 为 true 表示 NULL（未知）。数值非零为真。
+func truth(v types.Value) (b, null bool, err error) {
+	switch v.Kind {
+	case types.KindNull:
+		return false, true, nil
+	case types.KindBool:
+		return v.Bool, false, nil
+	case types.KindInt:
+		return v.Int != 0, false, nil
+	case types.KindFloat:
+		return v.Float != 0, false, nil
+	}
+	return false, false, fmt.Errorf("%w: %s is not a boolean", types.ErrTypeMismatch, v)
+}
+
+func compareResult(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// numeric 返回数值类的值：整数与布尔值以 int64 返回（isInt 为 true），浮点数以 float64 返回。
+func numeric(v types.Value) (i int64, f float64, isInt bool, err error) {
+	switch v.Kind {
+	case types.KindInt:
+		return v.Int, float64(v.Int), true, nil
+	case types.KindBool:
+		if v.Bool {
+			return 1, 1, true, nil
+		}
+		return 0, 0, true, nil
+	case types.KindFloat:
+		return 0, v.Float, false, nil
+	}
+	return 0, 0, false, fmt.Errorf("%w: %s is not a number", types.ErrTypeMismatch, v)
+}
+
+func negate(v types.Value) (types.Value, error) {
+	if v.IsNull() {
+		return v, nil
+	}
+	i, f, isInt, err := numeric(v)
+	if err != nil {
+		return types.Value{}, err
+	}
+	if !isInt {
+		return types.NewFloat(-f), nil
+	}
+	if i == math.MinInt64 {
+		return types.Value{}, fmt.Errorf("%w: -(%d)", types.ErrOutOfRange, i)
+	}
+	return types.NewInt(-i), nil
+}
+
+// arithmetic 计算四则运算与取模：整数运算溢出时报错，/ 总是得到浮点数，除数为 0 时结果为 NULL。
+func arithmetic(op string, a, b types.Value) (types.Value, error) {
+	if a.IsNull() || b.IsNull() {
+		return types.Null(), nil
+	}
+	x, fx, xInt, err := numeric(a)
+	if err != nil {
+		return types.Value{}, err
+	}
+	y, fy, yInt, err := numeric(b)
+	if err != nil {
+		return types.Value{}, err
+	}
+	if op == "/" || ((op == "%") && !(xInt && yInt)) {
+		if fy == 0 {
+			return types.Null(), nil
+		}
+		if op == "/" {
+			return types.NewFloat(fx / fy), nil
+		}
+		return types.NewFloat(math.Mod(fx, fy)), nil
+	}
+	if !xInt || !yInt {
+		switch op {
+		case "+":
+			return types.NewFloat(fx + fy), nil
+		case "-":
+			return types.NewFloat(fx - fy), nil
+		default:
+			return types.NewFloat(fx * fy), nil
+		}
+	}
+	var result int64
+	overflow := false
+	switch op {
+	case "+":
+		result = x + y
+		overflow = (result > x) != (y > 0)
+	case "-":
+		result = x - y
+		overflow = (result < x) != (y > 0)
+	case "*":
+		result = x * y
+		overflow = x != 0 && (result/x != y || (x == -1 && y == math.MinInt64))
+	case "%":
+		if y == 0 {
+			return types.Null(), nil
+		}
+		result = x % y
+	}
+	if overflow {
+		return types.Value{}, fmt.Errorf("%w: %d %s %d", types.ErrOutOfRange, x, op, y)
+	}
+	return types.NewInt(result), nil
+}
+
+// likeToken LIKE 模式中的一个元素：'%' 匹配任意长度，'_' 匹配单个字符，0 为字面字符。
+type likeToken struct {
+	wildcard rune
+	r        rune
+}
+
+// parseLike 解析 LIKE 模式，反斜杠转义其后的字符。匹配区分大小写。
+func parseLike(pattern string) []likeToken {
+	var tokens []likeToken
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			tokens = append(tokens, likeToken{r: r})
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%' || r == '_':
+			tokens = append(tokens, likeToken{wildcard: r})
+		default:
+			tokens = append(tokens, likeToken{r: r})
+		}
+	}
+	if escaped {
+		tokens = append(tokens, likeToken{r: '\\'})
+	}
+	return tokens
+}
+
+// likeMatch 贪心匹配，遇到失配时回退到最近一个 '%' 多吞一个字符。
+func likeMatch(s []rune, p []likeToken) bool {
+	si, pi := 0, 0
+	star, mark := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(p) && p[pi].wildcard == '%':
+			star, mark = pi, si
+			pi++
+		case pi < len(p) && (p[pi].wildcard == '_' || (p[pi].wildcard == 0 && p[pi].r == s[si])):
+			si++
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi].wildcard == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func isAggregate(name string) bool {
+	switch name {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		return true
+	}
+	return false
+}
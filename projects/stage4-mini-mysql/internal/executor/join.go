@@ -0,0 +1,698 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+var ErrNotUniqueTable = errors.New("not unique table/alias")
+
+// JoinStrategy 连接算法。
+type JoinStrategy int
+
+const (
+	// JoinAuto 由规划器选择：等值条件能确定内表主键前缀时用索引嵌套循环，有其他等值条件时用哈希连接，否则用嵌套循环。
+	JoinAuto JoinStrategy = iota
+	JoinNestedLoop
+	JoinIndexNestedLoop
+	JoinHash
+	JoinSortMerge
+)
+
+// graceFanout 哈希连接超出内存预算后两侧输入划分的分区数。
+const graceFanout = 8
+
+// innerSource 为连接中的一个外表行依次提供候选内表行。
+type innerSource interface {
+	reset(ctx context.Context, outer Row) error
+	next(ctx context.Context) (Row, error)
+	close() error
+}
+
+// joinLoop 各连接算子共用的驱动逻辑：对每个外表行遍历候选内表行，输出满足 ON 条件的组合；
+// LEFT JOIN 中没有任何匹配的外表行与一行 NULL 组合后输出。候选行只是缩小范围，ON 条件总是完整地再判断一次。
+type joinLoop struct {
+	fields   []Field
+	leftJoin bool
+	width    int
+	match    func(Row) (bool, error)
+
+	outer   Row
+	matched bool
+}
+
+func newJoinLoop(left, right []Field, leftJoin bool, on parser.Expr) (joinLoop, error) {
+	l := joinLoop{fields: append(slices.Clip(left), right...), leftJoin: leftJoin, width: len(right)}
+	if on != nil {
+		var err error
+		if l.match, err = predicate(on, l.fields); err != nil {
+			return joinLoop{}, err
+		}
+	}
+	return l, nil
+}
+
+func (l *joinLoop) Fields() []Field { return l.fields }
+
+func (l *joinLoop) next(ctx context.Context, nextOuter func(context.Context) (Row, error), inner innerSource) (Row, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if l.outer == nil {
+			row, err := nextOuter(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if err = inner.reset(ctx, row); err != nil {
+				return nil, err
+			}
+			l.outer, l.matched = row, false
+		}
+		row, err := inner.next(ctx)
+		if errors.Is(err, io.EOF) {
+			outer := l.outer
+			l.outer = nil
+			if l.leftJoin && !l.matched {
+				return l.combine(outer, make(Row, l.width)), nil
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out := l.combine(l.outer, row)
+		if l.match != nil {
+			ok, err := l.match(out)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		l.matched = true
+		return out, nil
+	}
+}
+
+func (l *joinLoop) combine(left, right Row) Row {
+	out := make(Row, 0, len(l.fields))
+	return append(append(out, left...), right...)
+}
+
+// NestedLoopJoin 嵌套循环连接：每个外表行都重新扫描一遍内表，适用于任意连接条件。
+type NestedLoopJoin struct {
+	joinLoop
+	left  Operator
+	inner rescan
+}
+
+// NewNestedLoopJoin 创建嵌套循环连接，on 为 nil 时输出笛卡尔积。
+func NewNestedLoopJoin(left, right Operator, leftJoin bool, on parser.Expr) (*NestedLoopJoin, error) {
+	loop, err := newJoinLoop(left.Fields(), right.Fields(), leftJoin, on)
+	if err != nil {
+		return nil, err
+	}
+	return &NestedLoopJoin{joinLoop: loop, left: left, inner: rescan{op: right}}, nil
+}
+
+func (j *NestedLoopJoin) Open(ctx context.Context) error {
+	j.outer = nil
+	return j.left.Open(ctx)
+}
+
+func (j *NestedLoopJoin) Next(ctx context.Context) (Row, error) {
+	return j.next(ctx, j.left.Next, &j.inner)
+}
+
+func (j *NestedLoopJoin) Close() error {
+	return errors.Join(j.inner.close(), j.left.Close())
+}
+
+// rescan 每次 reset 都重新打开内表算子。
+type rescan struct {
+	op     Operator
+	opened bool
+}
+
+func (r *rescan) reset(ctx context.Context, _ Row) error {
+	if err := r.close(); err != nil {
+		return err
+	}
+	r.opened = true
+	return r.op.Open(ctx)
+}
+
+func (r *rescan) next(ctx context.Context) (Row, error) { return r.op.Next(ctx) }
+
+func (r *rescan) close() error {
+	if !r.opened {
+		return nil
+	}
+	r.opened = false
+	return r.op.Close()
+}
+
+// IndexNestedLoopJoin 索引嵌套循环连接：用外表行上的连接键在内表主键 B+Tree 上查找，
+// keys 依次对应内表主键的前若干列，覆盖全部主键列时为点查，否则为前缀范围扫描。
+type IndexNestedLoopJoin struct {
+	joinLoop
+	left   Operator
+	lookup indexLookup
+}
+
+// NewIndexNestedLoopJoin 创建索引嵌套循环连接，keys 按外表的输出列编译。
+func NewIndexNestedLoopJoin(left Operator, table *catalog.Table, alias string, leftJoin bool, on parser.Expr, keys []parser.Expr) (*IndexNestedLoopJoin, error) {
+	scan := newTableScan(table, alias, nil, nil)
+	loop, err := newJoinLoop(left.Fields(), scan.Fields(), leftJoin, on)
+	if err != nil {
+		return nil, err
+	}
+	j := &IndexNestedLoopJoin{joinLoop: loop, left: left, lookup: indexLookup{scan: scan}}
+	for _, key := range keys {
+		eval, err := compileExpr(key, left.Fields())
+		if err != nil {
+			return nil, err
+		}
+		j.lookup.keys = append(j.lookup.keys, eval)
+	}
+	return j, nil
+}
+
+func (j *IndexNestedLoopJoin) Open(ctx context.Context) error {
+	j.outer = nil
+	return j.left.Open(ctx)
+}
+
+func (j *IndexNestedLoopJoin) Next(ctx context.Context) (Row, error) {
+	return j.next(ctx, j.left.Next, &j.lookup)
+}
+
+func (j *IndexNestedLoopJoin) Close() error {
+	return errors.Join(j.lookup.close(), j.left.Close())
+}
+
+// indexLookup 按外表行的连接键扫描内表主键上的对应范围。
+type indexLookup struct {
+	scan  tableScan
+	keys  []evalFunc
+	empty bool
+}
+
+func (l *indexLookup) reset(ctx context.Context, outer Row) error {
+	schema := l.scan.table.Schema
+	values := make([]types.Value, len(l.keys))
+	l.empty = true
+	for i, eval := range l.keys {
+		v, err := eval(outer)
+		if err != nil || v.IsNull() {
+			return err
+		}
+		ok := false
+		if values[i], ok, err = lookupKey(v, schema.Columns[schema.PrimaryKey[i]]); !ok {
+			return err
+		}
+	}
+	key, err := catalog.EncodeKey(schema, values)
+	if err != nil {
+		return err
+	}
+	l.scan.start, l.scan.end = key, key
+	if len(values) < len(schema.PrimaryKey) {
+		l.scan.end = prefixSuccessor(key)
+	}
+	l.empty = false
+	return l.scan.Open(ctx)
+}
+
+func (l *indexLookup) next(ctx context.Context) (Row, error) {
+	if l.empty {
+		return nil, io.EOF
+	}
+	return l.scan.Next(ctx)
+}
+
+func (l *indexLookup) close() error { return l.scan.Close() }
+
+// lookupKey 将外表的连接键转换为内表主键列的类型。数值无法精确存入该列（非整数、越界、过长）时不可能有相等的行，ok 为 false；
+// 两者不可比较时与 types.Compare 一样返回 ErrTypeMismatch。
+func lookupKey(v types.Value, col catalog.Column) (key types.Value, ok bool, err error) {
+	switch {
+	case v.Kind == types.KindBool && col.Type != types.TypeBool:
+		v = boolToInt(v)
+	case v.Kind == types.KindFloat && col.Type != types.TypeDouble && v.Float == math.Trunc(v.Float) && math.Abs(v.Float) < math.MaxInt64:
+		v = types.NewInt(int64(v.Float))
+	}
+	if key, err = types.Coerce(v, col.Type, col.Length); err == nil {
+		return key, true, nil
+	}
+	isNumber := v.Kind == types.KindInt || v.Kind == types.KindFloat
+	switch col.Type {
+	case types.TypeInt, types.TypeBigInt, types.TypeDouble, types.TypeBool:
+		if isNumber {
+			return types.Value{}, false, nil
+		}
+	case types.TypeVarchar:
+		if v.Kind == types.KindString {
+			return types.Value{}, false, nil
+		}
+	}
+	return types.Value{}, false, err
+}
+
+// HashJoin 哈希连接：以内表（右侧）建哈希表，逐个外表行探测。内表超出内存预算时转为 grace 哈希连接，
+// 两侧按连接键的哈希值划分到 graceFanout 对临时文件中，再逐对分区建表探测；单个分区仍按全部载入内存处理。
+type HashJoin struct {
+	joinLoop
+	left, right         Operator
+	leftKeys, rightKeys []evalFunc
+	budget              int
+	dir                 string
+
+	probe hashProbe
+	parts []gracePartition
+	part  int
+}
+
+// gracePartition grace 哈希连接中连接键哈希值相同的一对分区。
+type gracePartition struct {
+	left, right *spillFile
+}
+
+// NewHashJoin 创建哈希连接，leftKeys 与 rightKeys 为 ON 中的等值连接键，分别按两侧的输出列编译。
+func NewHashJoin(left, right Operator, leftJoin bool, on parser.Expr, leftKeys, rightKeys []parser.Expr, budget int, dir string) (*HashJoin, error) {
+	loop, err := newJoinLoop(left.Fields(), right.Fields(), leftJoin, on)
+	if err != nil {
+		return nil, err
+	}
+	j := &HashJoin{joinLoop: loop, left: left, right: right, budget: budget, dir: dir}
+	if j.leftKeys, err = compileExprs(leftKeys, left.Fields()); err != nil {
+		return nil, err
+	}
+	if j.rightKeys, err = compileExprs(rightKeys, right.Fields()); err != nil {
+		return nil, err
+	}
+	j.probe.keys = j.leftKeys
+	return j, nil
+}
+
+func (j *HashJoin) Open(ctx context.Context) error {
+	j.outer = nil
+	if err := j.right.Open(ctx); err != nil {
+		return err
+	}
+	if err := j.build(ctx); err != nil {
+		return err
+	}
+	if err := j.left.Open(ctx); err != nil {
+		return err
+	}
+	if j.parts == nil {
+		return nil
+	}
+	for {
+		row, err := j.left.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		key, ok, err := hashKey(j.probe.buf[:0], j.leftKeys, row)
+		if err != nil {
+			return err
+		}
+		j.probe.buf = key
+		// 连接键为 NULL 的外表行不会匹配，LEFT JOIN 仍需输出，放入任意一个分区即可。
+		p := 0
+		if ok {
+			p = partitionOf(key)
+		} else if !j.leftJoin {
+			continue
+		}
+		if err = j.parts[p].left.write(row); err != nil {
+			return err
+		}
+	}
+	for _, part := range j.parts {
+		if err := errors.Join(part.left.rewind(), part.right.rewind()); err != nil {
+			return err
+		}
+	}
+	j.part = 0
+	return j.loadPartition()
+}
+
+// build 读取内表建哈希表，连接键含 NULL 的行不会匹配，直接丢弃。
+func (j *HashJoin) build(ctx context.Context) error {
+	j.probe.table = make(map[string][]Row)
+	size := 0
+	var buf []byte
+	for {
+		row, err := j.right.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key, ok, err := hashKey(buf[:0], j.rightKeys, row)
+		if err != nil {
+			return err
+		}
+		buf = key
+		if !ok {
+			continue
+		}
+		if j.parts != nil {
+			if err = j.parts[partitionOf(key)].right.write(row); err != nil {
+				return err
+			}
+			continue
+		}
+		j.probe.table[string(key)] = append(j.probe.table[string(key)], slices.Clone(row))
+		if size += row.size(); size > j.budget {
+			if err = j.spill(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// spill 创建全部分区文件，并把已经建好的哈希表按键写入内表一侧的分区。
+func (j *HashJoin) spill() error {
+	for range graceFanout {
+		left, err := newSpillFile(j.dir)
+		if err != nil {
+			return err
+		}
+		right, err := newSpillFile(j.dir)
+		if err != nil {
+			return errors.Join(err, left.remove())
+		}
+		j.parts = append(j.parts, gracePartition{left: left, right: right})
+	}
+	for key, rows := range j.probe.table {
+		for _, row := range rows {
+			if err := j.parts[partitionOf([]byte(key))].right.write(row); err != nil {
+				return err
+			}
+		}
+	}
+	j.probe.table = make(map[string][]Row)
+	return nil
+}
+
+// loadPartition 把当前分区的内表行载入哈希表。
+func (j *HashJoin) loadPartition() error {
+	j.probe.table = make(map[string][]Row)
+	var buf []byte
+	for {
+		row, err := j.parts[j.part].right.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key, _, err := hashKey(buf[:0], j.rightKeys, row)
+		if err != nil {
+			return err
+		}
+		buf = key
+		j.probe.table[string(key)] = append(j.probe.table[string(key)], row)
+	}
+}
+
+func (j *HashJoin) Next(ctx context.Context) (Row, error) {
+	return j.next(ctx, j.nextOuter, &j.probe)
+}
+
+// nextOuter 返回下一个外表行：内存中建表时直接读外表，grace 模式下依次读各分区的外表文件。
+func (j *HashJoin) nextOuter(ctx context.Context) (Row, error) {
+	if j.parts == nil {
+		return j.left.Next(ctx)
+	}
+	for {
+		row, err := j.parts[j.part].left.read()
+		if !errors.Is(err, io.EOF) {
+			return row, err
+		}
+		if j.part+1 >= len(j.parts) {
+			return nil, io.EOF
+		}
+		j.part++
+		if err = j.loadPartition(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (j *HashJoin) Close() error {
+	var errs []error
+	for _, part := range j.parts {
+		errs = append(errs, part.left.remove(), part.right.remove())
+	}
+	j.parts, j.probe.table = nil, nil
+	errs = append(errs, j.left.Close(), j.right.Close())
+	return errors.Join(errs...)
+}
+
+// hashProbe 在哈希表中查找与外表行连接键相等的内表行。
+type hashProbe struct {
+	table  map[string][]Row
+	keys   []evalFunc
+	buf    []byte
+	bucket []Row
+}
+
+func (p *hashProbe) reset(_ context.Context, outer Row) error {
+	key, ok, err := hashKey(p.buf[:0], p.keys, outer)
+	p.buf, p.bucket = key, nil
+	if ok {
+		p.bucket = p.table[string(key)]
+	}
+	return err
+}
+
+func (p *hashProbe) next(context.Context) (Row, error) {
+	if len(p.bucket) == 0 {
+		return nil, io.EOF
+	}
+	row := p.bucket[0]
+	p.bucket = p.bucket[1:]
+	return row, nil
+}
+
+func (p *hashProbe) close() error { return nil }
+
+// hashKey 计算一行的连接键并编码到 buf，任一键为 NULL 时 ok 为 false。数值统一编码，
+// 使按 types.Compare 相等的整数、整数值的浮点数与布尔值得到相同的键。
+func hashKey(buf []byte, keys []evalFunc, row Row) (key []byte, ok bool, err error) {
+	values := make(Row, len(keys))
+	for i, eval := range keys {
+		v, err := eval(row)
+		if err != nil || v.IsNull() {
+			return buf, false, err
+		}
+		switch {
+		case v.Kind == types.KindBool:
+			v = boolToInt(v)
+		case v.Kind == types.KindFloat && v.Float == math.Trunc(v.Float) && math.Abs(v.Float) < math.MaxInt64:
+			v = types.NewInt(int64(v.Float))
+		}
+		values[i] = v
+	}
+	return appendRow(buf, values), true, nil
+}
+
+func boolToInt(v types.Value) types.Value {
+	if v.Bool {
+		return types.NewInt(1)
+	}
+	return types.NewInt(0)
+}
+
+func partitionOf(key []byte) int {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % graceFanout)
+}
+
+// SortMergeJoin 排序归并连接：两侧先按连接键排序（超出内存预算时溢出到临时文件），再同步推进；
+// 内表中连接键相同的一组行缓存在内存中，供键相同的连续外表行重复使用。
+type SortMergeJoin struct {
+	joinLoop
+	left  Operator
+	merge mergeCursor
+}
+
+// NewSortMergeJoin 创建排序归并连接，参数含义同 NewHashJoin。
+func NewSortMergeJoin(left, right Operator, leftJoin bool, on parser.Expr, leftKeys, rightKeys []parser.Expr, budget int, dir string) (*SortMergeJoin, error) {
+	loop, err := newJoinLoop(left.Fields(), right.Fields(), leftJoin, on)
+	if err != nil {
+		return nil, err
+	}
+	sortedLeft, err := NewSort(left, orderItems(leftKeys), budget, dir)
+	if err != nil {
+		return nil, err
+	}
+	sortedRight, err := NewSort(right, orderItems(rightKeys), budget, dir)
+	if err != nil {
+		return nil, err
+	}
+	j := &SortMergeJoin{joinLoop: loop, left: sortedLeft, merge: mergeCursor{right: sortedRight}}
+	if j.merge.leftKeys, err = compileExprs(leftKeys, left.Fields()); err != nil {
+		return nil, err
+	}
+	if j.merge.rightKeys, err = compileExprs(rightKeys, right.Fields()); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *SortMergeJoin) Open(ctx context.Context) error {
+	j.outer = nil
+	if err := j.left.Open(ctx); err != nil {
+		return err
+	}
+	return j.merge.open(ctx)
+}
+
+func (j *SortMergeJoin) Next(ctx context.Context) (Row, error) {
+	return j.next(ctx, j.left.Next, &j.merge)
+}
+
+func (j *SortMergeJoin) Close() error {
+	return errors.Join(j.merge.close(), j.left.Close())
+}
+
+func orderItems(exprs []parser.Expr) []parser.OrderItem {
+	items := make([]parser.OrderItem, len(exprs))
+	for i, expr := range exprs {
+		items[i] = parser.OrderItem{Expr: expr}
+	}
+	return items
+}
+
+// mergeCursor 在按连接键升序排列的内表上前进。外表行也按键升序到达，因此游标只需向前移动。
+type mergeCursor struct {
+	right               Operator
+	leftKeys, rightKeys []evalFunc
+
+	head      Row
+	headKeys  Row
+	group     []Row
+	groupKeys Row
+	pos       int
+}
+
+func (m *mergeCursor) open(ctx context.Context) error {
+	m.group, m.groupKeys = nil, nil
+	if err := m.right.Open(ctx); err != nil {
+		return err
+	}
+	return m.advance(ctx)
+}
+
+func (m *mergeCursor) advance(ctx context.Context) error {
+	row, err := m.right.Next(ctx)
+	if errors.Is(err, io.EOF) {
+		m.head, m.headKeys = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.head = row
+	m.headKeys, err = evalAll(m.rightKeys, row)
+	return err
+}
+
+func (m *mergeCursor) reset(ctx context.Context, outer Row) error {
+	m.pos = 0
+	keys, err := evalAll(m.leftKeys, outer)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(keys, types.Value.IsNull) {
+		m.pos = len(m.group)
+		return nil
+	}
+	if m.groupKeys != nil {
+		if c, err := compareKeys(m.groupKeys, keys); c == 0 || err != nil {
+			return err
+		}
+	}
+	m.group, m.groupKeys = m.group[:0], keys
+	for m.head != nil {
+		c, err := compareKeys(m.headKeys, keys)
+		if err != nil {
+			return err
+		}
+		if c > 0 {
+			break
+		}
+		if c == 0 {
+			m.group = append(m.group, slices.Clone(m.head))
+		}
+		if err = m.advance(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mergeCursor) next(context.Context) (Row, error) {
+	if m.pos >= len(m.group) {
+		return nil, io.EOF
+	}
+	m.pos++
+	return m.group[m.pos-1], nil
+}
+
+func (m *mergeCursor) close() error {
+	m.group, m.head = nil, nil
+	return m.right.Close()
+}
+
+// compareKeys 按 Sort 的顺序（NULL 最小）逐列比较两组连接键。
+func compareKeys(a, b Row) (int, error) {
+	for i := range a {
+		if c, err := compareNullsFirst(a[i], b[i]); c != 0 || err != nil {
+			return c, err
+		}
+	}
+	return 0, nil
+}
+
+func compileExprs(exprs []parser.Expr, fields []Field) ([]evalFunc, error) {
+	evals := make([]evalFunc, len(exprs))
+	for i, expr := range exprs {
+		var err error
+		if evals[i], err = compileExpr(expr, fields); err != nil {
+			return nil, err
+		}
+	}
+	return evals, nil
+}
+
+func evalAll(evals []evalFunc, row Row) (Row, error) {
+	values := make(Row, len(evals))
+	for i, eval := range evals {
+		var err error
+		if values[i], err = eval(row); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
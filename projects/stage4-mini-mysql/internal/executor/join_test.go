@@ -0,0 +1,272 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+)
+
+func planOf(t *testing.T, engine *Engine, sql string) Operator {
+	t.Helper()
+	statement, err := parser.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", sql, err)
+	}
+	op, err := engine.planSelect(statement.(*parser.SelectStmt))
+	if err != nil {
+		t.Fatalf("planSelect(%q) error = %v", sql, err)
+	}
+	return op
+}
+
+func TestJoinQueries(t *testing.T) {
+	engine := newTestEngine(t,
+		"CREATE TABLE dept (id INT PRIMARY KEY, name VARCHAR(8) NOT NULL)",
+		"CREATE TABLE staff (id INT PRIMARY KEY, name VARCHAR(8) NOT NULL, dept_id INT)",
+		"INSERT INTO dept VALUES (1, 'eng'), (2, 'ops'), (3, 'hr')",
+		"INSERT INTO staff VALUES (1, 'ann', 1), (2, 'bob', 1), (3, 'cid', 2), (4, 'dan', NULL)",
+	)
+	tests := []struct {
+		sql  string
+		plan string
+		want string
+	}{
+		{
+			"SELECT s.name, d.name FROM staff s JOIN dept d ON s.dept_id = d.id",
+			"Projection(IndexNestedLoopJoin(SeqScan(staff), dept))", "ann|eng,bob|eng,cid|ops",
+		},
+		{
+			"SELECT s.name, d.name FROM staff AS s LEFT JOIN dept AS d ON d.id = s.dept_id",
+			"Projection(IndexNestedLoopJoin(SeqScan(staff), dept))", "ann|eng,bob|eng,cid|ops,dan|NULL",
+		},
+		{
+			"SELECT s.name, d.name FROM staff s LEFT JOIN dept d ON d.id = s.dept_id AND s.name = 'bob'",
+			"Projection(IndexNestedLoopJoin(SeqScan(staff), dept))", "ann|NULL,bob|eng,cid|NULL,dan|NULL",
+		},
+		{
+			"SELECT s.name FROM staff s JOIN dept d ON s.dept_id = d.id WHERE s.id = 1",
+			"Projection(IndexNestedLoopJoin(Filter(IndexScan(staff)), dept))", "ann",
+		},
+		{
+			"SELECT d.name, COUNT(s.id) FROM dept d LEFT JOIN staff s ON s.dept_id = d.id GROUP BY d.name ORDER BY d.name",
+			"Projection(Sort(HashAggregate(HashJoin(SeqScan(dept), SeqScan(staff)))))", "eng|2,hr|0,ops|1",
+		},
+		{
+			"SELECT s.name, d.name FROM staff s, dept d WHERE s.dept_id = d.id AND d.name = 'ops'",
+			"Projection(Filter(NestedLoopJoin(SeqScan(staff), SeqScan(dept))))", "cid|ops",
+		},
+		{
+			"SELECT COUNT(*) FROM staff CROSS JOIN dept",
+			"Projection(HashAggregate(NestedLoopJoin(SeqScan(staff), SeqScan(dept))))", "12",
+		},
+		{
+			"SELECT a.name, b.name FROM staff a JOIN staff b ON a.dept_id = b.dept_id AND a.id < b.id",
+			"Projection(HashJoin(SeqScan(staff), SeqScan(staff)))", "ann|bob",
+		},
+		{
+			"SELECT d.* FROM staff s JOIN dept d ON d.id = s.dept_id WHERE s.id = 3",
+			"Projection(IndexNestedLoopJoin(Filter(IndexScan(staff)), dept))", "2|ops",
+		},
+		{
+			"SELECT staff.name FROM staff JOIN dept ON staff.dept_id = dept.id WHERE dept.id = 2",
+			"Projection(Filter(IndexNestedLoopJoin(SeqScan(staff), dept)))", "cid",
+		},
+		{
+			"SELECT s.name FROM staff s LEFT JOIN dept d ON d.id = s.dept_id WHERE d.id IS NULL",
+			"Projection(Filter(IndexNestedLoopJoin(SeqScan(staff), dept)))", "dan",
+		},
+	}
+	for _, tc := range tests {
+		if got := explain(planOf(t, engine, tc.sql)); got != tc.plan {
+			t.Errorf("plan of %q = %s, want %s", tc.sql, got, tc.plan)
+		}
+		if result, err := engine.ExecuteSQL(context.Background(), "s", tc.sql); err != nil || result != tc.want {
+			t.Errorf("ExecuteSQL(%q) = (%q, %v), want %q", tc.sql, result, err, tc.want)
+		}
+	}
+
+	failures := []struct {
+		sql  string
+		want error
+	}{
+		{"SELECT name FROM staff s JOIN dept d ON s.dept_id = d.id", ErrAmbiguousColumn},
+		{"SELECT * FROM staff JOIN staff ON staff.id = staff.id", ErrNotUniqueTable},
+		{"SELECT staff.name FROM staff s", catalog.ErrColumnNotFound},
+		{"SELECT x.* FROM staff s", catalog.ErrTableNotFound},
+		{"SELECT * FROM staff s JOIN nope ON 1 = 1", catalog.ErrTableNotFound},
+	}
+	for _, tc := range failures {
+		if result, err := engine.ExecuteSQL(context.Background(), "s", tc.sql); !errors.Is(err, tc.want) {
+			t.Errorf("ExecuteSQL(%q) = (%q, %v), want %v", tc.sql, result, err, tc.want)
+		}
+	}
+}
+
+// newJoinDataset 生成随机数据：a 的 g 列部分为 NULL，b 以 (a_id, seq) 为主键且含没有对应 a 的行，
+// c 只覆盖部分 g，d 没有主键且以 DOUBLE 存放与 a.g 比较的值。
+func newJoinDataset(t *testing.T, seed int64) *Engine {
+	rng := rand.New(rand.NewSource(seed))
+	statements := []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, g INT, name VARCHAR(16) NOT NULL)",
+		"CREATE TABLE b (a_id INT, seq INT, qty INT, PRIMARY KEY (a_id, seq))",
+		"CREATE TABLE c (g INT PRIMARY KEY, label VARCHAR(16))",
+		"CREATE TABLE d (x DOUBLE, tag VARCHAR(8))",
+	}
+	for id := 1; id <= 60; id++ {
+		g := fmt.Sprint(rng.Intn(10))
+		if rng.Intn(10) == 0 {
+			g = "NULL"
+		}
+		statements = append(statements, fmt.Sprintf("INSERT INTO a VALUES (%d, %s, 'n%d')", id, g, rng.Intn(20)))
+	}
+	for aID := 1; aID <= 70; aID++ {
+		for seq := 1; seq <= rng.Intn(4); seq++ {
+			statements = append(statements, fmt.Sprintf("INSERT INTO b VALUES (%d, %d, %d)", aID, seq, rng.Intn(10)))
+		}
+	}
+	for g := 0; g < 8; g++ {
+		statements = append(statements, fmt.Sprintf("INSERT INTO c VALUES (%d, 'l%d')", g, g%3))
+	}
+	for i := 0; i < 25; i++ {
+		x := fmt.Sprintf("%d.0", rng.Intn(12))
+		if i%7 == 0 {
+			x = "NULL"
+		} else if i%5 == 0 {
+			x = "2.5"
+		}
+		statements = append(statements, fmt.Sprintf("INSERT INTO d VALUES (%s, 't%d')", x, i))
+	}
+	return newTestEngine(t, statements...)
+}
+
+func queryRows(t *testing.T, engine *Engine, sql string) []string {
+	t.Helper()
+	ctx := context.Background()
+	statement, err := parser.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", sql, err)
+	}
+	rows, err := engine.Query(ctx, statement.(*parser.SelectStmt))
+	if err != nil {
+		t.Fatalf("Query(%q) error = %v", sql, err)
+	}
+	var out []string
+	for {
+		row, err := rows.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next(%q) error = %v", sql, err)
+		}
+		out = append(out, row.String())
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatalf("Close(%q) error = %v", sql, err)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestJoinStrategiesAgree(t *testing.T) {
+	queries := []struct {
+		sql   string
+		equi  bool
+		index bool
+	}{
+		{"SELECT a.id, b.seq, b.qty FROM a JOIN b ON a.id = b.a_id", true, true},
+		{"SELECT a.id, b.seq FROM a LEFT JOIN b ON b.a_id = a.id AND b.qty > 5", true, true},
+		{"SELECT a.name, c.label FROM a JOIN c ON a.g = c.g", true, true},
+		{"SELECT a.id, c.label FROM a LEFT JOIN c ON c.g = a.g WHERE c.label IS NULL", true, true},
+		{"SELECT a.id, b.seq, c.label FROM a JOIN b ON b.a_id = a.id LEFT JOIN c ON c.g = b.qty", true, true},
+		{"SELECT x.id, y.id FROM a x JOIN a y ON x.g = y.g AND x.id < y.id", true, false},
+		{"SELECT a.id, d.tag FROM a JOIN d ON d.x = a.g", true, false},
+		{"SELECT a.id, d.tag FROM a LEFT JOIN d ON a.g = d.x", true, false},
+		{"SELECT c.label, COUNT(*), SUM(b.qty) FROM c JOIN a ON a.g = c.g JOIN b ON b.a_id = a.id GROUP BY c.label", true, true},
+		{"SELECT b.a_id, b.seq, a.name FROM b LEFT JOIN a ON a.id = b.a_id", true, true},
+		{"SELECT a.id, b.seq FROM a JOIN b ON b.a_id = a.id AND b.seq = a.g", true, true},
+		{"SELECT a.id, c.g FROM a CROSS JOIN c WHERE a.id < 5", false, false},
+		{"SELECT a.id, c.label FROM a JOIN c ON a.g < c.g WHERE a.id <= 10", false, false},
+	}
+	strategies := []struct {
+		strategy JoinStrategy
+		operator string
+	}{
+		{JoinIndexNestedLoop, "IndexNestedLoopJoin"},
+		{JoinHash, "HashJoin"},
+		{JoinSortMerge, "SortMergeJoin"},
+		{JoinAuto, ""},
+	}
+
+	for _, seed := range []int64{1, 2, 3} {
+		engine := newJoinDataset(t, seed)
+		for _, q := range queries {
+			engine.SetJoinStrategy(JoinNestedLoop)
+			engine.SetWorkMem(DefaultWorkMem)
+			want := queryRows(t, engine, q.sql)
+			if len(want) == 0 {
+				t.Fatalf("seed %d: %q returned no rows, dataset too sparse", seed, q.sql)
+			}
+			for _, s := range strategies {
+				for _, budget := range []int{DefaultWorkMem, 256} {
+					dir := t.TempDir()
+					engine.SetJoinStrategy(s.strategy)
+					engine.SetWorkMem(budget)
+					engine.SetTempDir(dir)
+
+					applicable := q.equi && (s.strategy != JoinIndexNestedLoop || q.index)
+					if plan := explain(planOf(t, engine, q.sql)); s.operator != "" && strings.Contains(plan, s.operator) != applicable {
+						t.Fatalf("seed %d: plan of %q with %s = %s", seed, q.sql, s.operator, plan)
+					}
+					if got := queryRows(t, engine, q.sql); !slices.Equal(got, want) {
+						t.Fatalf("seed %d, %s, budget %d: %q\ngot  %v\nwant %v", seed, s.operator, budget, q.sql, got, want)
+					}
+					if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+						t.Fatalf("seed %d: %q left %d temp files", seed, q.sql, len(entries))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestHashJoinGracePartitions(t *testing.T) {
+	ctx := context.Background()
+	engine := newJoinDataset(t, 4)
+	engine.SetJoinStrategy(JoinHash)
+	engine.SetWorkMem(256)
+	engine.SetTempDir(t.TempDir())
+
+	op := planOf(t, engine, "SELECT a.id, b.qty FROM a JOIN b ON a.id = b.a_id")
+	join := op.(*Projection).child.(*HashJoin)
+	if err := op.Open(ctx); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(join.parts) != graceFanout {
+		t.Fatalf("hash join with a 256-byte budget has %d partitions, want %d", len(join.parts), graceFanout)
+	}
+	count := 0
+	for {
+		if _, err := op.Next(ctx); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		count++
+	}
+	if err := op.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if want := len(queryRows(t, engine, "SELECT a_id FROM b WHERE a_id <= 60")); count != want {
+		t.Fatalf("grace hash join returned %d rows, want %d", count, want)
+	}
+}
@@ -0,0 +1,280 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
+)
+
+// Operator 火山模型（迭代器模型）中的算子。Open 打开子算子并准备状态，Next 每次返回一行，没有更多行时返回 io.EOF；
+// Close 释放资源并关闭子算子，在 Open 失败或结果未读完时也必须调用。Next 返回的行在下一次调用 Next 之前有效。
+type Operator interface {
+	Fields() []Field
+	Open(ctx context.Context) error
+	Next(ctx context.Context) (Row, error)
+	Close() error
+}
+
+// tableScan 按键顺序读取表 B+Tree 中 [start, end] 范围内的行，end 为空表示读到末尾。
+type tableScan struct {
+	table  *catalog.Table
+	fields []Field
+	start  []byte
+	end    []byte
+	it     *storage.Iterator
+	key    []byte
+}
+
+func newTableScan(table *catalog.Table, alias string, start, end []byte) tableScan {
+	return tableScan{table: table, fields: tableFields(table, alias), start: start, end: end}
+}
+
+// tableFields 返回表的全部列，以 alias 为表名。
+func tableFields(table *catalog.Table, alias string) []Field {
+	fields := make([]Field, len(table.Schema.Columns))
+	for i, col := range table.Schema.Columns {
+		fields[i] = Field{Table: alias, Name: col.Name}
+	}
+	return fields
+}
+
+func (s *tableScan) Fields() []Field { return s.fields }
+
+func (s *tableScan) Open(ctx context.Context) error {
+	it, err := s.table.Tree.RangeScan(ctx, s.start, s.end)
+	if err != nil {
+		return err
+	}
+	s.it = it
+	return nil
+}
+
+func (s *tableScan) Next(ctx context.Context) (Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !s.it.Next() {
+		if err := s.it.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	item := s.it.Item()
+	values, err := catalog.DecodeTuple(s.table.Schema, item.Value)
+	if err != nil {
+		return nil, err
+	}
+	s.key = item.Key
+	return values, nil
+}
+
+func (s *tableScan) Close() error {
+	s.it = nil
+	return nil
+}
+
+// lastKey 返回最近一次 Next 返回的行的键，UPDATE / DELETE 据此改写该行。
+func (s *tableScan) lastKey() []byte { return s.key }
+
+// SeqScan 全表扫描。
+type SeqScan struct {
+	tableScan
+}
+
+// NewSeqScan 创建全表扫描，输出列以 alias 为表名。
+func NewSeqScan(table *catalog.Table, alias string) *SeqScan {
+	return &SeqScan{tableScan: newTableScan(table, alias, nil, nil)}
+}
+
+// IndexScan 主键索引上的范围扫描，start 与 end 为 catalog.EncodeKey 编码的边界（均包含），start 等于 end 时即点查。
+// 范围只用于缩小扫描区间，精确的条件仍由上层 Filter 判断。
+type IndexScan struct {
+	tableScan
+}
+
+// NewIndexScan 创建主键范围扫描，start 为空表示从头开始，end 为空表示扫描到末尾。
+func NewIndexScan(table *catalog.Table, alias string, start, end []byte) *IndexScan {
+	return &IndexScan{tableScan: newTableScan(table, alias, start, end)}
+}
+
+// Filter 只输出条件为 TRUE 的行。
+type Filter struct {
+	child Operator
+	cond  parser.Expr
+	match func(Row) (bool, error)
+}
+
+// NewFilter 创建过滤算子，cond 按子算子的输出列编译。
+func NewFilter(child Operator, cond parser.Expr) (*Filter, error) {
+	match, err := predicate(cond, child.Fields())
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{child: child, cond: cond, match: match}, nil
+}
+
+func (f *Filter) Fields() []Field { return f.child.Fields() }
+
+func (f *Filter) Open(ctx context.Context) error { return f.child.Open(ctx) }
+
+func (f *Filter) Next(ctx context.Context) (Row, error) {
+	for {
+		row, err := f.child.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := f.match(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return row, nil
+		}
+	}
+}
+
+func (f *Filter) Close() error { return f.child.Close() }
+
+// Projection 计算查询列表，* 与 t.* 展开为子算子的全部（或该表的）列。
+type Projection struct {
+	child  Operator
+	fields []Field
+	exprs  []evalFunc
+}
+
+// NewProjection 创建投影算子。
+func NewProjection(child Operator, items []parser.SelectItem) (*Projection, error) {
+	p := &Projection{child: child}
+	input := child.Fields()
+	for _, item := range items {
+		if star, ok := item.Expr.(*parser.StarExpr); ok {
+			matched := false
+			for i, f := range input {
+				if star.Table == "" || f.Table == star.Table {
+					p.fields = append(p.fields, f)
+					p.exprs = append(p.exprs, columnAt(i))
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("%w: %s", catalog.ErrTableNotFound, star.Table)
+			}
+			continue
+		}
+		eval, err := compileExpr(item.Expr, input)
+		if err != nil {
+			return nil, err
+		}
+		field := Field{Name: item.Alias}
+		if ref, ok := item.Expr.(*parser.ColumnRef); ok && item.Alias == "" {
+			i, _ := resolveColumn(input, ref)
+			field = input[i]
+		} else if item.Alias == "" {
+			field.Name = item.Expr.String()
+		}
+		p.fields = append(p.fields, field)
+		p.exprs = append(p.exprs, eval)
+	}
+	return p, nil
+}
+
+func (p *Projection) Fields() []Field { return p.fields }
+
+func (p *Projection) Open(ctx context.Context) error { return p.child.Open(ctx) }
+
+func (p *Projection) Next(ctx context.Context) (Row, error) {
+	row, err := p.child.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(Row, len(p.exprs))
+	for i, eval := range p.exprs {
+		if out[i], err = eval(row); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (p *Projection) Close() error { return p.child.Close() }
+
+// Limit 跳过前 offset 行后最多输出 count 行，达到 count 后不再从子算子读取。
+type Limit struct {
+	child  Operator
+	count  int64
+	offset int64
+	seen   int64
+}
+
+// NewLimit 创建 LIMIT / OFFSET 算子。
+func NewLimit(child Operator, count, offset int64) *Limit {
+	return &Limit{child: child, count: count, offset: offset}
+}
+
+func (l *Limit) Fields() []Field { return l.child.Fields() }
+
+func (l *Limit) Open(ctx context.Context) error {
+	l.seen = 0
+	return l.child.Open(ctx)
+}
+
+func (l *Limit) Next(ctx context.Context) (Row, error) {
+	for l.seen < l.offset {
+		if _, err := l.child.Next(ctx); err != nil {
+			return nil, err
+		}
+		l.seen++
+	}
+	if l.seen-l.offset >= l.count {
+		return nil, io.EOF
+	}
+	row, err := l.child.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.seen++
+	return row, nil
+}
+
+func (l *Limit) Close() error { return l.child.Close() }
+
+// Distinct 去掉重复行，保留每个不同行第一次出现的位置。
+type Distinct struct {
+	child Operator
+	seen  map[string]struct{}
+}
+
+// NewDistinct 创建去重算子。
+func NewDistinct(child Operator) *Distinct {
+	return &Distinct{child: child}
+}
+
+func (d *Distinct) Fields() []Field { return d.child.Fields() }
+
+func (d *Distinct) Open(ctx context.Context) error {
+	d.seen = make(map[string]struct{})
+	return d.child.Open(ctx)
+}
+
+func (d *Distinct) Next(ctx context.Context) (Row, error) {
+	for {
+		row, err := d.child.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		key := string(appendRow(nil, row))
+		if _, dup := d.seen[key]; !dup {
+			d.seen[key] = struct{}{}
+			return row, nil
+		}
+	}
+}
+
+func (d *Distinct) Close() error {
+	d.seen = nil
+	return d.child.Close()
+}
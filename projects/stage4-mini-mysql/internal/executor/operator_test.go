@@ -0,0 +1,210 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/txn"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+func newTestEngine(t *testing.T, statements ...string) *Engine {
+	t.Helper()
+	ctx := context.Background()
+	cat, err := catalog.Create(ctx, nil)
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine := NewEngine(cat, txn.NewManager(nil))
+	for _, sql := range statements {
+		if _, err = engine.ExecuteSQL(ctx, "s", sql); err != nil {
+			t.Fatalf("ExecuteSQL(%q) error = %v", sql, err)
+		}
+	}
+	return engine
+}
+
+// newEmpEngine 创建带 emp 表的引擎，表以 (dept, id) 为主键，按键顺序为 eng 1-3、hr 1、ops 1-2。
+func newEmpEngine(t *testing.T) *Engine {
+	t.Helper()
+	return newTestEngine(t,
+		"CREATE TABLE emp (dept VARCHAR(8) NOT NULL, id INT NOT NULL, name VARCHAR(16) NOT NULL, salary DOUBLE, PRIMARY KEY (dept, id))",
+		"INSERT INTO emp VALUES ('ops', 2, 'eve', 50), ('eng', 1, 'ann', 100), ('hr', 1, 'fay', 70)",
+		"INSERT INTO emp VALUES ('eng', 3, 'cid', NULL), ('ops', 1, 'dan', 50), ('eng', 2, 'bob', 80)",
+	)
+}
+
+func TestSelectOperators(t *testing.T) {
+	engine := newEmpEngine(t)
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT name FROM emp WHERE salary > 60", "ann,bob,fay"},
+		{"SELECT name, salary * 2 AS twice FROM emp WHERE dept = 'ops'", "dan|100,eve|100"},
+		{"SELECT emp.name FROM emp WHERE emp.id = 3", "cid"},
+		{"SELECT id + 1 FROM emp WHERE dept = 'hr'", "2"},
+		{"SELECT name FROM emp WHERE name LIKE '_a%'", "fay,dan"},
+		{"SELECT name FROM emp WHERE salary IS NULL OR id IN (2)", "bob,cid,eve"},
+		{"SELECT name FROM emp ORDER BY salary DESC, name", "ann,bob,fay,dan,eve,cid"},
+		{"SELECT name, salary FROM emp ORDER BY salary LIMIT 3", "cid|NULL,dan|50,eve|50"},
+		{"SELECT name FROM emp ORDER BY name DESC LIMIT 2 OFFSET 1", "eve,dan"},
+		{"SELECT name FROM emp LIMIT 1, 2", "bob,cid"},
+		{"SELECT name AS n FROM emp ORDER BY n LIMIT 2", "ann,bob"},
+		{"SELECT dept, name FROM emp ORDER BY 2 DESC LIMIT 1", "hr|fay"},
+		{"SELECT DISTINCT dept FROM emp", "eng,hr,ops"},
+		{"SELECT DISTINCT salary FROM emp WHERE dept = 'ops'", "50"},
+		{
+			"SELECT dept, COUNT(*), COUNT(salary), SUM(salary), AVG(salary), MIN(name), MAX(salary) FROM emp GROUP BY dept",
+			"eng|3|2|180|90|ann|100,hr|1|1|70|70|fay|70,ops|2|2|100|50|dan|50",
+		},
+		{"SELECT dept, COUNT(*) AS n FROM emp GROUP BY dept HAVING COUNT(*) > 1 ORDER BY n, dept", "ops|2,eng|3"},
+		{"SELECT dept, SUM(salary) FROM emp GROUP BY dept ORDER BY SUM(salary) DESC", "eng|180,ops|100,hr|70"},
+		{"SELECT dept, MAX(salary) - MIN(salary) AS spread FROM emp GROUP BY dept", "eng|20,hr|0,ops|0"},
+		{"SELECT id % 2, COUNT(*) FROM emp GROUP BY id % 2", "1|4,0|2"},
+		{"SELECT COUNT(DISTINCT salary), SUM(id) FROM emp", "4|10"},
+		{"SELECT COUNT(*), SUM(salary) FROM emp WHERE id > 10", "0|NULL"},
+		{"SELECT dept FROM emp WHERE id > 10 GROUP BY dept", "NULL"},
+	}
+	for _, tc := range tests {
+		if result, err := engine.ExecuteSQL(context.Background(), "s", tc.sql); err != nil || result != tc.want {
+			t.Errorf("ExecuteSQL(%q) = (%q, %v), want %q", tc.sql, result, err, tc.want)
+		}
+	}
+}
+
+func TestSelectOperatorErrors(t *testing.T) {
+	engine := newEmpEngine(t)
+	tests := []struct {
+		sql  string
+		want error
+	}{
+		{"SELECT name, COUNT(*) FROM emp GROUP BY dept", ErrNotGrouped},
+		{"SELECT * FROM emp GROUP BY dept", ErrNotGrouped},
+		{"SELECT dept FROM emp GROUP BY dept ORDER BY salary", ErrNotGrouped},
+		{"SELECT SUM(COUNT(*)) FROM emp", ErrUnsupported},
+		{"SELECT name FROM emp WHERE COUNT(*) > 1", ErrUnsupported},
+		{"SELECT nope FROM emp", catalog.ErrColumnNotFound},
+		{"SELECT name FROM emp ORDER BY 3", catalog.ErrColumnNotFound},
+		{"SELECT SUM(name) FROM emp", types.ErrTypeMismatch},
+		{"SELECT name + 1 FROM emp", types.ErrTypeMismatch},
+	}
+	for _, tc := range tests {
+		if result, err := engine.ExecuteSQL(context.Background(), "s", tc.sql); !errors.Is(err, tc.want) {
+			t.Errorf("ExecuteSQL(%q) = (%q, %v), want %v", tc.sql, result, err, tc.want)
+		}
+	}
+}
+
+func TestPlanAccessPath(t *testing.T) {
+	engine := newEmpEngine(t)
+	tests := []struct {
+		sql  string
+		plan string
+		want string
+	}{
+		{"SELECT name FROM emp", "Projection(SeqScan(emp))", "ann,bob,cid,fay,dan,eve"},
+		{"SELECT name FROM emp WHERE dept = 'eng' AND id = 2", "Projection(Filter(IndexScan(emp)))", "bob"},
+		{"SELECT name FROM emp WHERE dept = 'eng' AND id >= 2", "Projection(Filter(IndexScan(emp)))", "bob,cid"},
+		{"SELECT name FROM emp WHERE 'eng' = dept AND 2 > id", "Projection(Filter(IndexScan(emp)))", "ann"},
+		{"SELECT name FROM emp WHERE dept = 'hr'", "Projection(Filter(IndexScan(emp)))", "fay"},
+		{"SELECT name FROM emp WHERE dept BETWEEN 'f' AND 'i'", "Projection(Filter(IndexScan(emp)))", "fay"},
+		{"SELECT name FROM emp WHERE dept > 'eng'", "Projection(Filter(IndexScan(emp)))", "fay,dan,eve"},
+		{"SELECT name FROM emp WHERE id = 1", "Projection(Filter(SeqScan(emp)))", "ann,fay,dan"},
+		{"SELECT name FROM emp WHERE dept = 'eng' OR id = 1", "Projection(Filter(SeqScan(emp)))", "ann,bob,cid,fay,dan"},
+		{"SELECT name FROM emp WHERE dept = 'much too long'", "Projection(Filter(SeqScan(emp)))", "NULL"},
+		{
+			"SELECT name FROM emp WHERE dept = 'ops' ORDER BY name DESC LIMIT 1",
+			"Limit(Projection(Sort(Filter(IndexScan(emp)))))", "eve",
+		},
+		{
+			"SELECT DISTINCT dept FROM emp GROUP BY dept HAVING COUNT(*) > 1",
+			"Distinct(Projection(Filter(HashAggregate(SeqScan(emp)))))", "eng,ops",
+		},
+	}
+	for _, tc := range tests {
+		statement, err := parser.Parse(tc.sql)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.sql, err)
+		}
+		op, err := engine.planSelect(statement.(*parser.SelectStmt))
+		if err != nil {
+			t.Fatalf("planSelect(%q) error = %v", tc.sql, err)
+		}
+		if got := explain(op); got != tc.plan {
+			t.Errorf("plan of %q = %s, want %s", tc.sql, got, tc.plan)
+		}
+		if result, err := engine.Execute(context.Background(), "s", statement); err != nil || result != tc.want {
+			t.Errorf("Execute(%q) = (%q, %v), want %q", tc.sql, result, err, tc.want)
+		}
+	}
+}
+
+func TestQueryStreamsRows(t *testing.T) {
+	ctx := context.Background()
+	engine := newEmpEngine(t)
+	dir := t.TempDir()
+	engine.SetWorkMem(1)
+	engine.SetTempDir(dir)
+
+	statement, err := parser.Parse("SELECT name, salary AS pay FROM emp ORDER BY id DESC, name LIMIT 3")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rows, err := engine.Query(ctx, statement.(*parser.SelectStmt))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got := rows.Columns(); len(got) != 2 || got[0] != "name" || got[1] != "pay" {
+		t.Fatalf("Columns() = %v, want [name pay]", got)
+	}
+	var got []string
+	for {
+		row, err := rows.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		got = append(got, row.String())
+	}
+	if len(got) != 3 || got[0] != "cid|NULL" || got[1] != "bob|80" || got[2] != "eve|50" {
+		t.Fatalf("rows = %v, want [cid|NULL bob|80 eve|50]", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) == 0 {
+		t.Fatalf("sort with a 1-byte budget did not spill")
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("Close() left %d temp files", len(entries))
+	}
+}
+
+func TestUpdateDeleteWithExpressions(t *testing.T) {
+	ctx := context.Background()
+	engine := newEmpEngine(t)
+	steps := []struct {
+		sql  string
+		want string
+	}{
+		{"UPDATE emp SET salary = salary + 5, name = 'x' WHERE dept = 'ops' AND salary < 100", "OK"},
+		{"SELECT name, salary FROM emp WHERE dept = 'ops'", "x|55,x|55"},
+		{"UPDATE emp SET id = id + 10 WHERE dept = 'eng'", "OK"},
+		{"SELECT id FROM emp WHERE dept = 'eng'", "11,12,13"},
+		{"DELETE FROM emp WHERE salary IS NULL OR name = 'fay'", "OK"},
+		{"SELECT dept, COUNT(*) FROM emp GROUP BY dept", "eng|2,ops|2"},
+	}
+	for _, step := range steps {
+		if result, err := engine.ExecuteSQL(ctx, "s", step.sql); err != nil || result != step.want {
+			t.Fatalf("ExecuteSQL(%q) = (%q, %v), want %q", step.sql, result, err, step.want)
+		}
+	}
+}
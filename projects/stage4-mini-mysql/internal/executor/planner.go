@@ -0,0 +1,529 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+// scanOperator 读取表 B+Tree 的算子，UPDATE / DELETE 通过 lastKey 定位要改写的行。
+type scanOperator interface {
+	Operator
+	lastKey() []byte
+}
+
+// planSelect 为查询构建算子树：
+// Scan / Join → Filter(WHERE) → HashAggregate → Filter(HAVING) → Sort → Projection → Distinct → Limit。
+// 排序在投影之前进行，因此 ORDER BY 可以引用不在查询列表中的列。
+func (e *Engine) planSelect(stmt *parser.SelectStmt) (Operator, error) {
+	op, where, err := e.planFrom(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if where != nil {
+		if op, err = NewFilter(op, where); err != nil {
+			return nil, err
+		}
+	}
+
+	orderBy, err := resolveOrderBy(stmt.OrderBy, stmt.Columns)
+	if err != nil {
+		return nil, err
+	}
+	var calls []*parser.FuncCall
+	for _, item := range stmt.Columns {
+		calls = collectAggregates(item.Expr, calls)
+	}
+	calls = collectAggregates(stmt.Having, calls)
+	for _, item := range orderBy {
+		calls = collectAggregates(item.Expr, calls)
+	}
+	if len(calls) > 0 || len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		input := op.Fields()
+		agg, err := NewHashAggregate(op, stmt.GroupBy, calls)
+		if err != nil {
+			return nil, err
+		}
+		exprs := []parser.Expr{stmt.Having}
+		for _, item := range stmt.Columns {
+			exprs = append(exprs, item.Expr)
+		}
+		for _, item := range orderBy {
+			exprs = append(exprs, item.Expr)
+		}
+		for _, expr := range exprs {
+			if err = checkGrouped(expr, input, agg.Fields()); err != nil {
+				return nil, err
+			}
+		}
+		op = agg
+		if stmt.Having != nil {
+			if op, err = NewFilter(op, stmt.Having); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(orderBy) > 0 {
+		if op, err = NewSort(op, orderBy, e.workMem, e.tempDir); err != nil {
+			return nil, err
+		}
+	}
+	if op, err = NewProjection(op, stmt.Columns); err != nil {
+		return nil, err
+	}
+	if stmt.Distinct {
+		op = NewDistinct(op)
+	}
+	if stmt.Limit != nil {
+		op = NewLimit(op, stmt.Limit.Count, stmt.Limit.Offset)
+	}
+	return op, nil
+}
+
+// planFrom 构建 FROM 子句的算子，返回尚未判断的 WHERE 条件。WHERE 中只引用第一张表的合取项用于选择其访问路径，
+// 并在连接之前过滤该表；其余表按出现顺序与之前的结果左深连接。
+func (e *Engine) planFrom(stmt *parser.SelectStmt) (Operator, parser.Expr, error) {
+	refs := append([]parser.Join{{Table: stmt.Table, Alias: stmt.Alias}}, stmt.Joins...)
+	tables := make([]*catalog.Table, len(refs))
+	names := make([]string, len(refs))
+	var all []Field
+	for i, ref := range refs {
+		table, err := e.catalog.Table(ref.Table)
+		if err != nil {
+			return nil, nil, err
+		}
+		names[i] = ref.Alias
+		if names[i] == "" {
+			names[i] = ref.Table
+		}
+		if slices.Contains(names[:i], names[i]) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotUniqueTable, names[i])
+		}
+		tables[i] = table
+		all = append(all, tableFields(table, names[i])...)
+	}
+
+	var pushed, rest parser.Expr
+	if stmt.Where != nil {
+		split := len(tables[0].Schema.Columns)
+		for _, cond := range conjuncts(stmt.Where, nil) {
+			if _, right, ok := referencedSides(cond, all, split); ok && !right {
+				pushed = and(pushed, cond)
+			} else {
+				rest = and(rest, cond)
+			}
+		}
+	}
+	var op Operator
+	var err error
+	if op, err = planScan(tables[0], names[0], pushed); err != nil {
+		return nil, nil, err
+	}
+	if len(stmt.Joins) == 0 {
+		return op, stmt.Where, nil
+	}
+	if pushed != nil {
+		if op, err = NewFilter(op, pushed); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i, join := range stmt.Joins {
+		if op, err = e.planJoin(op, tables[i+1], names[i+1], join); err != nil {
+			return nil, nil, err
+		}
+	}
+	return op, rest, nil
+}
+
+// planJoin 按 e.joinStrategy 为一个连接选择算法，指定的算法不适用（没有等值条件或无法使用主键）时退回嵌套循环。
+func (e *Engine) planJoin(left Operator, table *catalog.Table, alias string, join parser.Join) (Operator, error) {
+	leftJoin := join.Kind == "LEFT"
+	leftKeys, rightKeys := equiKeys(join.On, left.Fields(), tableFields(table, alias))
+	lookup := indexKeys(table, alias, leftKeys, rightKeys)
+	strategy := e.joinStrategy
+	if strategy == JoinAuto {
+		switch {
+		case len(lookup) > 0:
+			strategy = JoinIndexNestedLoop
+		case len(leftKeys) > 0:
+			strategy = JoinHash
+		}
+	}
+	switch {
+	case strategy == JoinIndexNestedLoop && len(lookup) > 0:
+		return NewIndexNestedLoopJoin(left, table, alias, leftJoin, join.On, lookup)
+	case strategy == JoinHash && len(leftKeys) > 0:
+		return NewHashJoin(left, NewSeqScan(table, alias), leftJoin, join.On, leftKeys, rightKeys, e.workMem, e.tempDir)
+	case strategy == JoinSortMerge && len(leftKeys) > 0:
+		return NewSortMergeJoin(left, NewSeqScan(table, alias), leftJoin, join.On, leftKeys, rightKeys, e.workMem, e.tempDir)
+	}
+	return NewNestedLoopJoin(left, NewSeqScan(table, alias), leftJoin, join.On)
+}
+
+// equiKeys 从 ON 的合取项中提取 左侧表达式 = 右侧表达式 形式的等值连接键，两侧各自只引用一边的列。
+func equiKeys(on parser.Expr, left, right []Field) (leftKeys, rightKeys []parser.Expr) {
+	if on == nil {
+		return nil, nil
+	}
+	all := append(slices.Clip(left), right...)
+	for _, cond := range conjuncts(on, nil) {
+		eq, ok := cond.(*parser.BinaryExpr)
+		if !ok || eq.Op != "=" {
+			continue
+		}
+		aLeft, aRight, aOK := referencedSides(eq.Left, all, len(left))
+		bLeft, bRight, bOK := referencedSides(eq.Right, all, len(left))
+		switch {
+		case !aOK || !bOK:
+		case aLeft && !aRight && bRight && !bLeft:
+			leftKeys, rightKeys = append(leftKeys, eq.Left), append(rightKeys, eq.Right)
+		case aRight && !aLeft && bLeft && !bRight:
+			leftKeys, rightKeys = append(leftKeys, eq.Right), append(rightKeys, eq.Left)
+		}
+	}
+	return leftKeys, rightKeys
+}
+
+// indexKeys 返回依次确定内表主键前若干列的外表连接键；第一列主键没有对应的等值条件时返回 nil。
+func indexKeys(table *catalog.Table, alias string, leftKeys, rightKeys []parser.Expr) []parser.Expr {
+	fields := tableFields(table, alias)
+	var keys []parser.Expr
+	for _, pk := range table.Schema.PrimaryKey {
+		i := slices.IndexFunc(rightKeys, func(key parser.Expr) bool {
+			ref, ok := key.(*parser.ColumnRef)
+			if !ok {
+				return false
+			}
+			col, err := resolveColumn(fields, ref)
+			return err == nil && col == pk
+		})
+		if i < 0 {
+			break
+		}
+		keys = append(keys, leftKeys[i])
+	}
+	return keys
+}
+
+// referencedSides 报告表达式引用了 fields 中 split 之前（左侧）与之后（右侧）的哪些列，有列无法解析时 ok 为 false。
+func referencedSides(expr parser.Expr, fields []Field, split int) (left, right, ok bool) {
+	if ref, isRef := expr.(*parser.ColumnRef); isRef {
+		i, err := resolveColumn(fields, ref)
+		return err == nil && i < split, err == nil && i >= split, err == nil
+	}
+	if _, isStar := expr.(*parser.StarExpr); isStar {
+		return false, false, false
+	}
+	ok = true
+	for _, child := range children(expr) {
+		l, r, childOK := referencedSides(child, fields, split)
+		left, right, ok = left || l, right || r, ok && childOK
+	}
+	return left, right, ok
+}
+
+func and(left, right parser.Expr) parser.Expr {
+	if left == nil {
+		return right
+	}
+	return &parser.BinaryExpr{Op: "AND", Left: left, Right: right}
+}
+
+// resolveOrderBy 将 ORDER BY 中的查询列别名与列序号（从 1 开始）替换为对应的查询列表达式。
+func resolveOrderBy(items []parser.OrderItem, columns []parser.SelectItem) ([]parser.OrderItem, error) {
+	resolved := make([]parser.OrderItem, len(items))
+	for i, item := range items {
+		resolved[i] = item
+		switch e := item.Expr.(type) {
+		case *parser.Literal:
+			if e.Kind != parser.LiteralInt {
+				continue
+			}
+			n, err := strconv.Atoi(e.Value)
+			if err != nil || n < 1 || n > len(columns) {
+				return nil, fmt.Errorf("%w: ORDER BY position %s", catalog.ErrColumnNotFound, e.Value)
+			}
+			if _, star := columns[n-1].Expr.(*parser.StarExpr); star {
+				return nil, fmt.Errorf("%w: ORDER BY position of *", ErrUnsupported)
+			}
+			resolved[i].Expr = columns[n-1].Expr
+		case *parser.ColumnRef:
+			if e.Table != "" {
+				continue
+			}
+			for _, col := range columns {
+				if col.Alias != "" && strings.EqualFold(col.Alias, e.Name) {
+					resolved[i].Expr = col.Expr
+					break
+				}
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// collectAggregates 收集表达式中的聚合函数调用，文本相同的调用只保留一个。
+func collectAggregates(expr parser.Expr, calls []*parser.FuncCall) []*parser.FuncCall {
+	if call, ok := expr.(*parser.FuncCall); ok && isAggregate(call.Name) {
+		for _, c := range calls {
+			if c.String() == call.String() {
+				return calls
+			}
+		}
+		return append(calls, call)
+	}
+	for _, child := range children(expr) {
+		calls = collectAggregates(child, calls)
+	}
+	return calls
+}
+
+// checkGrouped 检查聚合之后求值的表达式只引用分组列与聚合结果。input 为聚合前的列，grouped 为聚合算子的输出列。
+func checkGrouped(expr parser.Expr, input, grouped []Field) error {
+	if expr == nil {
+		return nil
+	}
+	name := expr.String()
+	for _, f := range grouped {
+		if f.Table == "" && f.Name == name {
+			return nil
+		}
+	}
+	switch e := expr.(type) {
+	case *parser.FuncCall:
+		if isAggregate(e.Name) {
+			return nil
+		}
+	case *parser.StarExpr:
+		return fmt.Errorf("%w: %s", ErrNotGrouped, e)
+	case *parser.ColumnRef:
+		if _, err := resolveColumn(grouped, e); err == nil {
+			return nil
+		}
+		if _, err := resolveColumn(input, e); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrNotGrouped, e)
+	}
+	for _, child := range children(expr) {
+		if err := checkGrouped(child, input, grouped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// children 返回表达式的直接子表达式。
+func children(expr parser.Expr) []parser.Expr {
+	switch e := expr.(type) {
+	case *parser.UnaryExpr:
+		return []parser.Expr{e.Expr}
+	case *parser.BinaryExpr:
+		return []parser.Expr{e.Left, e.Right}
+	case *parser.InExpr:
+		return append([]parser.Expr{e.Expr}, e.List...)
+	case *parser.BetweenExpr:
+		return []parser.Expr{e.Expr, e.Low, e.High}
+	case *parser.LikeExpr:
+		return []parser.Expr{e.Expr, e.Pattern}
+	case *parser.IsNullExpr:
+		return []parser.Expr{e.Expr}
+	case *parser.FuncCall:
+		return e.Args
+	}
+	return nil
+}
+
+// planScan 选择访问路径：WHERE 中与字面量比较的主键条件构成主键前缀上的等值匹配加下一列的范围时使用 IndexScan，
+// 否则使用 SeqScan。扫描范围只是 WHERE 的必要条件，调用方仍需用完整的 WHERE 过滤。
+func planScan(table *catalog.Table, alias string, where parser.Expr) (scanOperator, error) {
+	schema := table.Schema
+	if len(schema.PrimaryKey) == 0 || where == nil {
+		return NewSeqScan(table, alias), nil
+	}
+	bounds := make([]keyBounds, len(schema.PrimaryKey))
+	for _, cond := range conjuncts(where, nil) {
+		collectBounds(schema, alias, cond, bounds)
+	}
+
+	var prefix []types.Value
+	for _, b := range bounds {
+		if b.eq == nil {
+			break
+		}
+		prefix = append(prefix, *b.eq)
+	}
+	if len(prefix) == 0 && bounds[0].low == nil && bounds[0].high == nil {
+		return NewSeqScan(table, alias), nil
+	}
+	if len(prefix) == len(bounds) {
+		key, err := catalog.EncodeKey(schema, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return NewIndexScan(table, alias, key, key), nil
+	}
+
+	next := bounds[len(prefix)]
+	start, err := catalog.EncodeKey(schema, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if next.low != nil {
+		if start, err = catalog.EncodeKey(schema, append(prefix[:len(prefix):len(prefix)], *next.low)); err != nil {
+			return nil, err
+		}
+	}
+	var end []byte
+	if len(prefix) > 0 || next.high != nil {
+		endValues := prefix
+		if next.high != nil {
+			endValues = append(prefix[:len(prefix):len(prefix)], *next.high)
+		}
+		if end, err = catalog.EncodeKey(schema, endValues); err != nil {
+			return nil, err
+		}
+		if len(endValues) < len(schema.PrimaryKey) {
+			end = prefixSuccessor(end)
+		}
+	}
+	return NewIndexScan(table, alias, start, end), nil
+}
+
+// keyBounds 一个主键列上由 WHERE 推出的约束：等值，或下界 / 上界（均按包含处理）。
+type keyBounds struct {
+	eq   *types.Value
+	low  *types.Value
+	high *types.Value
+}
+
+// conjuncts 将条件按 AND 拆开。
+func conjuncts(expr parser.Expr, out []parser.Expr) []parser.Expr {
+	if bin, ok := expr.(*parser.BinaryExpr); ok && bin.Op == "AND" {
+		return conjuncts(bin.Right, conjuncts(bin.Left, out))
+	}
+	return append(out, expr)
+}
+
+// collectBounds 从一个合取项中提取主键列与字面量的比较，多个约束取最紧的一个。
+func collectBounds(schema *catalog.Schema, alias string, cond parser.Expr, bounds []keyBounds) {
+	switch c := cond.(type) {
+	case *parser.BetweenExpr:
+		if c.Not {
+			return
+		}
+		collectBounds(schema, alias, &parser.BinaryExpr{Op: ">=", Left: c.Expr, Right: c.Low}, bounds)
+		collectBounds(schema, alias, &parser.BinaryExpr{Op: "<=", Left: c.Expr, Right: c.High}, bounds)
+	case *parser.BinaryExpr:
+		op, column, literal := c.Op, c.Left, c.Right
+		if _, ok := column.(*parser.Literal); ok {
+			column, literal = literal, column
+			op = flipComparison(op)
+		}
+		ref, ok := column.(*parser.ColumnRef)
+		lit, isLit := literal.(*parser.Literal)
+		if !ok || !isLit || (ref.Table != "" && ref.Table != alias) {
+			return
+		}
+		pos := -1
+		for i, pk := range schema.PrimaryKey {
+			if strings.EqualFold(schema.Columns[pk].Name, ref.Name) {
+				pos = i
+			}
+		}
+		if pos < 0 {
+			return
+		}
+		v, err := literalValue(lit)
+		if err != nil || v.IsNull() {
+			return
+		}
+		col := schema.Columns[schema.PrimaryKey[pos]]
+		if v, err = types.Coerce(v, col.Type, col.Length); err != nil {
+			return
+		}
+		b := &bounds[pos]
+		switch op {
+		case "=":
+			b.eq = &v
+		case ">", ">=":
+			if b.low == nil || mustCompare(v, *b.low) > 0 {
+				b.low = &v
+			}
+		case "<", "<=":
+			if b.high == nil || mustCompare(v, *b.high) < 0 {
+				b.high = &v
+			}
+		}
+	}
+}
+
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// mustCompare 比较两个已转换为同一列类型的值，不会失败。
+func mustCompare(a, b types.Value) int {
+	c, _ := types.Compare(a, b)
+	return c
+}
+
+// prefixSuccessor 返回大于所有以 prefix 开头的键的最短键，prefix 全为 0xFF 时返回 nil（不设上界）。
+func prefixSuccessor(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xFF {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// explain 以 Name(child) 的形式描述算子树，用于测试访问路径与算子顺序。
+func explain(op Operator) string {
+	switch o := op.(type) {
+	case *SeqScan:
+		return "SeqScan(" + o.table.Schema.Name + ")"
+	case *IndexScan:
+		return "IndexScan(" + o.table.Schema.Name + ")"
+	case *Filter:
+		return "Filter(" + explain(o.child) + ")"
+	case *Projection:
+		return "Projection(" + explain(o.child) + ")"
+	case *Sort:
+		return "Sort(" + explain(o.child) + ")"
+	case *Limit:
+		return "Limit(" + explain(o.child) + ")"
+	case *Distinct:
+		return "Distinct(" + explain(o.child) + ")"
+	case *HashAggregate:
+		return "HashAggregate(" + explain(o.child) + ")"
+	case *NestedLoopJoin:
+		return "NestedLoopJoin(" + explain(o.left) + ", " + explain(o.inner.op) + ")"
+	case *IndexNestedLoopJoin:
+		return "IndexNestedLoopJoin(" + explain(o.left) + ", " + o.lookup.scan.table.Schema.Name + ")"
+	case *HashJoin:
+		return "HashJoin(" + explain(o.left) + ", " + explain(o.right) + ")"
+	case *SortMergeJoin:
+		return "SortMergeJoin(" + explain(o.left) + ", " + explain(o.merge.right) + ")"
+	}
+	return fmt.Sprintf("%T", op)
+}
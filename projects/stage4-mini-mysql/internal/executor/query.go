@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+)
+
+// Rows 查询结果的游标，结果由算子树逐行产生，不会一次性缓存在内存中。
+type Rows struct {
+	op      Operator
+	columns []string
+}
+
+// Query 为查询构建并打开算子树，调用方读完或放弃结果后必须调用 Close。
+func (e *Engine) Query(ctx context.Context, stmt *parser.SelectStmt) (*Rows, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	op, err := e.planSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if err = op.Open(ctx); err != nil {
+		return nil, errors.Join(err, op.Close())
+	}
+	fields := op.Fields()
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Name
+	}
+	return &Rows{op: op, columns: columns}, nil
+}
+
+// Columns 返回结果列名。
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Next 返回下一行，没有更多行时返回 io.EOF。
+func (r *Rows) Next(ctx context.Context) (Row, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.op.Next(ctx)
+}
+
+// Close 关闭算子树并删除排序等产生的临时文件。
+func (r *Rows) Close() error {
+	return r.op.Close()
+}
+
+// execSelect 读完查询结果并按 Execute 的字符串格式返回。
+func (e *Engine) execSelect(ctx context.Context, stmt *parser.SelectStmt) (result string, err error) {
+	rows, err := e.Query(ctx, stmt)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	var lines []string
+	for {
+		row, err := rows.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, row.String())
+	}
+	if len(lines) == 0 {
+		return "NULL", nil
+	}
+	return strings.Join(lines, ","), nil
+}
@@ -0,0 +1,119 @@
+package executor
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+var errCorruptRow = errors.New("corrupt spilled row")
+
+// Row 算子之间传递的一行。
+type Row []types.Value
+
+// Field 算子输出的一列。Table 为列所属的表名，计算列为空；聚合算子输出的计算列以表达式文本为 Name。
+type Field struct {
+	Table string
+	Name  string
+}
+
+func (r Row) String() string {
+	fields := make([]string, len(r))
+	for i, v := range r {
+		fields[i] = v.String()
+	}
+	return strings.Join(fields, "|")
+}
+
+// size 估算一行占用的内存字节数，用于判断是否超出排序等算子的内存预算。
+func (r Row) size() int {
+	n := 24
+	for _, v := range r {
+		n += 64 + len(v.Str)
+	}
+	return n
+}
+
+// appendRow 将一行编码追加到 buf：列数后跟每列的类型字节与内容。编码与列结构无关，相等的行编码相同，
+// 因此也用作分组与去重的哈希键。
+func appendRow(buf []byte, r Row) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(r)))
+	for _, v := range r {
+		buf = append(buf, byte(v.Kind))
+		switch v.Kind {
+		case types.KindInt:
+			buf = binary.AppendVarint(buf, v.Int)
+		case types.KindFloat:
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float))
+		case types.KindString:
+			buf = binary.AppendUvarint(buf, uint64(len(v.Str)))
+			buf = append(buf, v.Str...)
+		case types.KindBool:
+			if v.Bool {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		case types.KindTime:
+			buf = binary.AppendVarint(buf, v.Time.UnixMicro())
+		}
+	}
+	return buf
+}
+
+// decodeRow 解码 appendRow 的结果。
+func decodeRow(data []byte) (Row, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, errCorruptRow
+	}
+	data = data[n:]
+	r := make(Row, count)
+	for i := range r {
+		if len(data) == 0 {
+			return nil, errCorruptRow
+		}
+		kind := types.Kind(data[0])
+		data = data[1:]
+		switch kind {
+		case types.KindNull:
+		case types.KindInt, types.KindTime:
+			v, n := binary.Varint(data)
+			if n <= 0 {
+				return nil, errCorruptRow
+			}
+			data = data[n:]
+			if kind == types.KindInt {
+				r[i] = types.NewInt(v)
+			} else {
+				r[i] = types.NewTime(time.UnixMicro(v))
+			}
+		case types.KindFloat:
+			if len(data) < 8 {
+				return nil, errCorruptRow
+			}
+			r[i] = types.NewFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case types.KindString:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, errCorruptRow
+			}
+			r[i] = types.NewString(string(data[n : n+int(length)]))
+			data = data[n+int(length):]
+		case types.KindBool:
+			if len(data) < 1 {
+				return nil, errCorruptRow
+			}
+			r[i] = types.NewBool(data[0] == 1)
+			data = data[1:]
+		default:
+			return nil, errCorruptRow
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,260 @@
+package executor
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"slices"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+// DefaultWorkMem 排序、哈希连接等算子在内存中缓存数据的默认上限（字节），超出后溢出到临时文件。
+const DefaultWorkMem = 4 << 20
+
+type sortKey struct {
+	eval evalFunc
+	desc bool
+}
+
+// sortedRow 待排序的行及其排序键。
+type sortedRow struct {
+	keys Row
+	row  Row
+}
+
+// Sort 外部归并排序。行先缓存在内存中，估算大小超过 budget 时把排好序的一段写入临时文件，
+// 输入读完后对所有段做多路归并；没有溢出时直接在内存中排序。相等的键保持输入顺序，NULL 排在最前。
+type Sort struct {
+	child  Operator
+	keys   []sortKey
+	budget int
+	dir    string
+
+	rows  []sortedRow
+	pos   int
+	runs  []*sortRun
+	merge runHeap
+}
+
+// NewSort 创建排序算子，排序键按子算子的输出列编译；临时文件创建在 dir 中，dir 为空时使用系统临时目录。
+func NewSort(child Operator, items []parser.OrderItem, budget int, dir string) (*Sort, error) {
+	s := &Sort{child: child, budget: budget, dir: dir}
+	for _, item := range items {
+		eval, err := compileExpr(item.Expr, child.Fields())
+		if err != nil {
+			return nil, err
+		}
+		s.keys = append(s.keys, sortKey{eval: eval, desc: item.Desc})
+	}
+	return s, nil
+}
+
+func (s *Sort) Fields() []Field { return s.child.Fields() }
+
+func (s *Sort) Open(ctx context.Context) error {
+	if err := s.child.Open(ctx); err != nil {
+		return err
+	}
+	size := 0
+	for {
+		row, err := s.child.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		keys := make(Row, len(s.keys))
+		for i, key := range s.keys {
+			if keys[i], err = key.eval(row); err != nil {
+				return err
+			}
+		}
+		s.rows = append(s.rows, sortedRow{keys: keys, row: row})
+		size += keys.size() + row.size()
+		if size > s.budget {
+			if err = s.spill(); err != nil {
+				return err
+			}
+			size = 0
+		}
+	}
+	if len(s.runs) == 0 {
+		return s.sortRows()
+	}
+	if len(s.rows) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	s.merge = runHeap{sort: s}
+	for _, run := range s.runs {
+		ok, err := run.advance(len(s.keys))
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.merge.runs = append(s.merge.runs, run)
+		}
+	}
+	heap.Init(&s.merge)
+	return s.merge.err
+}
+
+func (s *Sort) Next(ctx context.Context) (Row, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.runs) == 0 {
+		if s.pos >= len(s.rows) {
+			return nil, io.EOF
+		}
+		s.pos++
+		return s.rows[s.pos-1].row, nil
+	}
+	if len(s.merge.runs) == 0 {
+		return nil, io.EOF
+	}
+	top := s.merge.runs[0]
+	row := top.head.row
+	ok, err := top.advance(len(s.keys))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		heap.Fix(&s.merge, 0)
+	} else {
+		heap.Pop(&s.merge)
+	}
+	return row, s.merge.err
+}
+
+func (s *Sort) Close() error {
+	var errs []error
+	for _, run := range s.runs {
+		errs = append(errs, run.file.remove())
+	}
+	s.runs, s.rows, s.merge = nil, nil, runHeap{}
+	errs = append(errs, s.child.Close())
+	return errors.Join(errs...)
+}
+
+func (s *Sort) sortRows() error {
+	var cmpErr error
+	slices.SortStableFunc(s.rows, func(a, b sortedRow) int {
+		c, err := s.compare(a.keys, b.keys)
+		if err != nil && cmpErr == nil {
+			cmpErr = err
+		}
+		return c
+	})
+	return cmpErr
+}
+
+// spill 把内存中的行排序后写入一个新的临时文件，每条记录为排序键加行。
+func (s *Sort) spill() error {
+	if err := s.sortRows(); err != nil {
+		return err
+	}
+	file, err := newSpillFile(s.dir)
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, &sortRun{file: file, index: len(s.runs)})
+	for _, r := range s.rows {
+		if err = file.write(append(slices.Clip(r.keys), r.row...)); err != nil {
+			return err
+		}
+	}
+	if err = file.rewind(); err != nil {
+		return err
+	}
+	clear(s.rows)
+	s.rows = s.rows[:0]
+	return nil
+}
+
+// compare 按排序键比较两行，NULL 小于任何值；DESC 的键取反。
+func (s *Sort) compare(a, b Row) (int, error) {
+	for i, key := range s.keys {
+		c, err := compareNullsFirst(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+func compareNullsFirst(a, b types.Value) (int, error) {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0, nil
+	case a.IsNull():
+		return -1, nil
+	case b.IsNull():
+		return 1, nil
+	}
+	return types.Compare(a, b)
+}
+
+// sortRun 溢出到临时文件的一个有序段，head 为当前读到的行。
+type sortRun struct {
+	file  *spillFile
+	index int
+	head  sortedRow
+}
+
+// advance 读取下一条记录到 head，段读完时返回 false。
+func (r *sortRun) advance(keyCount int) (bool, error) {
+	row, err := r.file.read()
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(row) < keyCount {
+		return false, errCorruptRow
+	}
+	r.head = sortedRow{keys: row[:keyCount:keyCount], row: row[keyCount:]}
+	return true, nil
+}
+
+// runHeap 按各段当前行排序的最小堆，键相等时先输出较早写出的段以保持稳定。
+type runHeap struct {
+	sort *Sort
+	runs []*sortRun
+	err  error
+}
+
+func (h *runHeap) Len() int { return len(h.runs) }
+
+func (h *runHeap) Less(i, j int) bool {
+	c, err := h.sort.compare(h.runs[i].head.keys, h.runs[j].head.keys)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	if c != 0 {
+		return c < 0
+	}
+	return h.runs[i].index < h.runs[j].index
+}
+
+func (h *runHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+
+func (h *runHeap) Push(x any) { h.runs = append(h.runs, x.(*sortRun)) }
+
+func (h *runHeap) Pop() any {
+	last := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return last
+}
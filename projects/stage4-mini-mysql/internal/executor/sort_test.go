@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/types"
+)
+
+// sliceOperator 依次输出给定的行。
+type sliceOperator struct {
+	fields []Field
+	rows   []Row
+	pos    int
+}
+
+func (s *sliceOperator) Fields() []Field { return s.fields }
+
+func (s *sliceOperator) Open(context.Context) error {
+	s.pos = 0
+	return nil
+}
+
+func (s *sliceOperator) Next(context.Context) (Row, error) {
+	if s.pos >= len(s.rows) {
+		return nil, io.EOF
+	}
+	s.pos++
+	return s.rows[s.pos-1], nil
+}
+
+func (s *sliceOperator) Close() error { return nil }
+
+func TestSortSpillsAndMerges(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(1))
+	input := &sliceOperator{fields: []Field{{Name: "k"}, {Name: "seq"}}}
+	for i := 0; i < 2000; i++ {
+		k := types.NewInt(int64(rng.Intn(50)))
+		if i%97 == 0 {
+			k = types.Null()
+		}
+		input.rows = append(input.rows, Row{k, types.NewInt(int64(i))})
+	}
+
+	for _, budget := range []int{DefaultWorkMem, 4096} {
+		dir := t.TempDir()
+		items := []parser.OrderItem{{Expr: &parser.ColumnRef{Name: "k"}}}
+		s, err := NewSort(input, items, budget, dir)
+		if err != nil {
+			t.Fatalf("NewSort() error = %v", err)
+		}
+		if err = s.Open(ctx); err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		if spilled := len(s.runs) > 1; spilled != (budget < DefaultWorkMem) {
+			t.Fatalf("budget %d: %d runs", budget, len(s.runs))
+		}
+
+		var prev Row
+		count := 0
+		for {
+			row, err := s.Next(ctx)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if prev != nil {
+				c, _ := compareNullsFirst(prev[0], row[0])
+				if c > 0 || (c == 0 && prev[1].Int > row[1].Int) {
+					t.Fatalf("budget %d: row %v after %v breaks stable order", budget, row, prev)
+				}
+			}
+			prev = row
+			count++
+		}
+		if count != len(input.rows) {
+			t.Fatalf("budget %d: sorted %d rows, want %d", budget, count, len(input.rows))
+		}
+		if err = s.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Fatalf("budget %d: Close() left %d temp files", budget, len(entries))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spillFile 算子溢出到磁盘的一组行：先顺序写入，rewind 后从头顺序读出。
+// 每条记录为 uvarint 长度加 appendRow 编码。
+type spillFile struct {
+	file *os.File
+	w    *bufio.Writer
+	r    *bufio.Reader
+	buf  []byte
+}
+
+// newSpillFile 在 dir 中创建临时文件，dir 为空时使用系统临时目录。
+func newSpillFile(dir string) (*spillFile, error) {
+	file, err := os.CreateTemp(dir, "mini-mysql-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (f *spillFile) write(row Row) error {
+	f.buf = appendRow(f.buf[:0], row)
+	if _, err := f.w.Write(binary.AppendUvarint(nil, uint64(len(f.buf)))); err != nil {
+		return err
+	}
+	_, err := f.w.Write(f.buf)
+	return err
+}
+
+// rewind 刷新写缓冲并回到文件开头，之后只能读。
+func (f *spillFile) rewind() error {
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f.r = bufio.NewReader(f.file)
+	return nil
+}
+
+// read 读出下一行，读完时返回 io.EOF。
+func (f *spillFile) read() (Row, error) {
+	length, err := binary.ReadUvarint(f.r)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(f.r, buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRow, err)
+	}
+	return decodeRow(buf)
+}
+
+// remove 关闭并删除临时文件。
+func (f *spillFile) remove() error {
+	return errors.Join(f.file.Close(), os.Remove(f.file.Name()))
+}
@@ -1,42 +1,126 @@
 package parser
 
+import "strings"
+
 // Statement SQL 语句抽象。
 type Statement interface {
 	statementName() string
 }
 
-// CreateTableStmt CREATE TABLE。
+// ColumnDef 列定义。Type 为大写的类型名，Length 为类型参数（如 VARCHAR(64) 的 64），未指定时为 0。
+type ColumnDef struct {
+	Name       string
+	Type       string
+	Length     int
+	NotNull    bool
+	PrimaryKey bool
+}
+
+// CreateTableStmt CREATE TABLE。主键既可以写在列定义上，也可以写成表级 PRIMARY KEY (...)，两者都会汇总到 PrimaryKey。
 type CreateTableStmt struct {
-	Table string
+	Table       string
+	IfNotExists bool
+	Columns     []ColumnDef
+	PrimaryKey  []string
 }
 
 func (s *CreateTableStmt) statementName() string { return "create_table" }
 
-// InsertStmt INSERT。
+// DropTableStmt DROP TABLE。
+type DropTableStmt struct {
+	Table    string
+	IfExists bool
+}
+
+func (s *DropTableStmt) statementName() string { return "drop_table" }
+
+// InsertStmt INSERT。Columns 为空表示按表定义的列顺序提供值。
 type InsertStmt struct {
-	Table string
-	Key   string
-	Value string
+	Table   string
+	Columns []string
+	Rows    [][]Expr
 }
 
 func (s *InsertStmt) statementName() string { return "insert" }
 
-// SelectStmt SELECT。
-type SelectStmt struct {
+// SelectItem 查询列表中的一项，Expr 为 *StarExpr 时表示 *。
+type SelectItem struct {
+	Expr  Expr
+	Alias string
+}
+
+// OrderItem ORDER BY 中的一项。
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// Limit LIMIT count [OFFSET offset]，MySQL 的 LIMIT offset, count 写法解析为同一结构。
+type Limit struct {
+	Count  int64
+	Offset int64
+}
+
+// Join FROM 中的一个连接。Kind 为 INNER、LEFT 或 CROSS（逗号分隔的表也按 CROSS 处理），
+// Alias 为空时以表名引用该表；On 为 nil 表示没有连接条件。
+type Join struct {
+	Kind  string
 	Table string
-	Key   string
+	Alias string
+	On    Expr
+}
+
+// SelectStmt SELECT。Table / Alias 为 FROM 中的第一张表，其余表按出现顺序依次与之前的结果连接。
+// Where / Having 为 nil 表示无条件，Limit 为 nil 表示不限制行数。
+type SelectStmt struct {
+	Distinct bool
+	Columns  []SelectItem
+	Table    string
+	Alias    string
+	Joins    []Join
+	Where    Expr
+	GroupBy  []Expr
+	Having   Expr
+	OrderBy  []OrderItem
+	Limit    *Limit
 }
 
 func (s *SelectStmt) statementName() string { return "select" }
 
-// SelectRangeStmt 范围查询。
-type SelectRangeStmt struct {
+// Assignment UPDATE 中的 column = expr。
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+// UpdateStmt UPDATE。
+type UpdateStmt struct {
 	Table string
-	Start string
-	End   string
+	Set   []Assignment
+	Where Expr
 }
 
-func (s *SelectRangeStmt) statementName() string { return "select_range" }
+func (s *UpdateStmt) statementName() string { return "update" }
+
+// DeleteStmt DELETE。
+type DeleteStmt struct {
+	Table string
+	Where Expr
+}
+
+func (s *DeleteStmt) statementName() string { return "delete" }
+
+// ShowTablesStmt SHOW TABLES。
+type ShowTablesStmt struct{}
+
+func (s *ShowTablesStmt) statementName() string { return "show_tables" }
+
+// DescribeStmt DESCRIBE / DESC t。
+type DescribeStmt struct {
+	Table string
+}
+
+func (s *DescribeStmt) statementName() string { return "describe" }
 
 // TxStmt 事务语句。
 type TxStmt struct {
@@ -44,3 +128,186 @@ type TxStmt struct {
 }
 
 func (s *TxStmt) statementName() string { return "tx" }
+
+// Expr 表达式。String 返回带完整括号的 SQL 文本，便于调试与生成结果列名。
+type Expr interface {
+	exprNode()
+	String() string
+}
+
+// LiteralKind 字面量类型。
+type LiteralKind int
+
+const (
+	LiteralNull LiteralKind = iota
+	LiteralInt
+	LiteralFloat
+	LiteralString
+	LiteralBool
+)
+
+// Literal 字面量。Value 保存原始文本：数字为十进制文本，字符串为去掉引号后的内容，布尔为 TRUE / FALSE。
+type Literal struct {
+	Kind  LiteralKind
+	Value string
+}
+
+func (*Literal) exprNode() {}
+
+func (e *Literal) String() string {
+	switch e.Kind {
+	case LiteralNull:
+		return "NULL"
+	case LiteralString:
+		return "'" + strings.ReplaceAll(e.Value, "'", "''") + "'"
+	default:
+		return e.Value
+	}
+}
+
+// ColumnRef 列引用，Table 为可选的表名限定。
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+func (*ColumnRef) exprNode() {}
+
+func (e *ColumnRef) String() string {
+	if e.Table != "" {
+		return e.Table + "." + e.Name
+	}
+	return e.Name
+}
+
+// StarExpr 查询列表中的 * 或 t.*。
+type StarExpr struct {
+	Table string
+}
+
+func (*StarExpr) exprNode() {}
+
+func (e *StarExpr) String() string {
+	if e.Table != "" {
+		return e.Table + ".*"
+	}
+	return "*"
+}
+
+// FuncCall 函数调用，Name 为大写的函数名。COUNT(*) 的 Star 为 true 且 Args 为空。
+type FuncCall struct {
+	Name     string
+	Args     []Expr
+	Distinct bool
+	Star     bool
+}
+
+func (*FuncCall) exprNode() {}
+
+func (e *FuncCall) String() string {
+	if e.Star {
+		return e.Name + "(*)"
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	if e.Distinct {
+		return e.Name + "(DISTINCT " + strings.Join(args, ", ") + ")"
+	}
+	return e.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// UnaryExpr 一元运算：NOT、-。
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+func (*UnaryExpr) exprNode() {}
+
+func (e *UnaryExpr) String() string {
+	if e.Op == "NOT" {
+		return "(NOT " + e.Expr.String() + ")"
+	}
+	return "(" + e.Op + e.Expr.String() + ")"
+}
+
+// BinaryExpr 二元运算：AND、OR、比较运算（!= 统一为 <>）与算术运算。
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (*BinaryExpr) exprNode() {}
+
+func (e *BinaryExpr) String() string {
+	return "(" + e.Left.String() + " " + e.Op + " " + e.Right.String() + ")"
+}
+
+// InExpr expr [NOT] IN (list)。
+type InExpr struct {
+	Expr Expr
+	List []Expr
+	Not  bool
+}
+
+func (*InExpr) exprNode() {}
+
+func (e *InExpr) String() string {
+	items := make([]string, len(e.List))
+	for i, item := range e.List {
+		items[i] = item.String()
+	}
+	return "(" + e.Expr.String() + notPrefix(e.Not) + " IN (" + strings.Join(items, ", ") + "))"
+}
+
+// BetweenExpr expr [NOT] BETWEEN low AND high。
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+func (*BetweenExpr) exprNode() {}
+
+func (e *BetweenExpr) String() string {
+	return "(" + e.Expr.String() + notPrefix(e.Not) + " BETWEEN " + e.Low.String() + " AND " + e.High.String() + ")"
+}
+
+// LikeExpr expr [NOT] LIKE pattern。
+type LikeExpr struct {
+	Expr    Expr
+	Pattern Expr
+	Not     bool
+}
+
+func (*LikeExpr) exprNode() {}
+
+func (e *LikeExpr) String() string {
+	return "(" + e.Expr.String() + notPrefix(e.Not) + " LIKE " + e.Pattern.String() + ")"
+}
+
+// IsNullExpr expr IS [NOT] NULL。
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+func (*IsNullExpr) exprNode() {}
+
+func (e *IsNullExpr) String() string {
+	if e.Not {
+		return "(" + e.Expr.String() + " IS NOT NULL)"
+	}
+	return "(" + e.Expr.String() + " IS NULL)"
+}
+
+func notPrefix(not bool) string {
+	if not {
+		return " NOT"
+	}
+	return ""
+}
@@ -1,18 +1,259 @@
 package parser
 
-import "strings"
-
-// Tokenize 将 SQL 粗粒度分词。
-func Tokenize(sql string) []string {
-	sql = strings.TrimSpace(sql)
-	sql = strings.ReplaceAll(sql, ",", " ")
-	sql = strings.ReplaceAll(sql, "(", " ")
-	sql = strings.ReplaceAll(sql, ")", " ")
-	sql = strings.ReplaceAll(sql, "=", " = ")
-	sql = strings.ReplaceAll(sql, ";", "")
-	parts := strings.Fields(sql)
-	for i := range parts {
-		parts[i] = strings.TrimSpace(parts[i])
-	}
-	return parts
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind 词法单元类型。
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	// TokenIdent 标识符，包括关键字与反引号括起的标识符。
+	TokenIdent
+	TokenNumber
+	TokenString
+	// TokenSymbol 运算符与标点：= <> != < <= > >= + - * / % ( ) , ; .
+	TokenSymbol
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenEOF:
+		return "EOF"
+	case TokenIdent:
+		return "identifier"
+	case TokenNumber:
+		return "number"
+	case TokenString:
+		return "string"
+	default:
+		return "symbol"
+	}
+}
+
+// Token 词法单元。Text 对字符串与反引号标识符是去掉引号并处理转义后的内容；Pos 为在 SQL 中的字节偏移。
+type Token struct {
+	Kind   TokenKind
+	Text   string
+	Quoted bool
+	Pos    int
+	Line   int
+	Column int
+}
+
+// Tokenize 将 SQL 切分为词法单元，跳过空白与注释（-- 、# 与 /* */），末尾附加一个 TokenEOF。
+func Tokenize(sql string) ([]Token, error) {
+	lx := &lexer{src: sql, line: 1, col: 1}
+	var tokens []Token
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == TokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (lx *lexer) peekByte(offset int) byte {
+	if lx.pos+offset < len(lx.src) {
+		return lx.src[lx.pos+offset]
+	}
+	return 0
+}
+
+// advance 前进 n 个字节并维护行列号。
+func (lx *lexer) advance(n int) {
+	for i := 0; i < n && lx.pos < len(lx.src); i++ {
+		if lx.src[lx.pos] == '\n' {
+			lx.line++
+			lx.col = 1
+		} else if lx.src[lx.pos]&0xC0 != 0x80 {
+			lx.col++
+		}
+		lx.pos++
+	}
+}
+
+func (lx *lexer) errorAt(tok Token, msg string) error {
+	return &SyntaxError{Pos: tok.Pos, Line: tok.Line, Column: tok.Column, Msg: msg}
+}
+
+func (lx *lexer) skipSpaceAndComments() error {
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case isSpace(c):
+			lx.advance(1)
+		case c == '#' || (c == '-' && lx.peekByte(1) == '-' && (lx.peekByte(2) == 0 || isSpace(lx.peekByte(2)))):
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.advance(1)
+			}
+		case c == '/' && lx.peekByte(1) == '*':
+			start := Token{Pos: lx.pos, Line: lx.line, Column: lx.col}
+			end := strings.Index(lx.src[lx.pos+2:], "*/")
+			if end < 0 {
+				return lx.errorAt(start, "unterminated comment")
+			}
+			lx.advance(end + 4)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (lx *lexer) next() (Token, error) {
+	if err := lx.skipSpaceAndComments(); err != nil {
+		return Token{}, err
+	}
+	tok := Token{Pos: lx.pos, Line: lx.line, Column: lx.col}
+	if lx.pos >= len(lx.src) {
+		tok.Kind = TokenEOF
+		return tok, nil
+	}
+	c := lx.src[lx.pos]
+	switch {
+	case c == '\'' || c == '"':
+		tok.Kind = TokenString
+		return lx.quoted(tok, c)
+	case c == '`':
+		tok.Kind = TokenIdent
+		tok.Quoted = true
+		return lx.quoted(tok, c)
+	case isDigit(c) || (c == '.' && isDigit(lx.peekByte(1))):
+		tok.Kind = TokenNumber
+		return lx.number(tok)
+	case isIdentStart(lx.src[lx.pos:]):
+		start := lx.pos
+		for lx.pos < len(lx.src) && isIdentPart(lx.src[lx.pos:]) {
+			_, size := utf8.DecodeRuneInString(lx.src[lx.pos:])
+			lx.advance(size)
+		}
+		tok.Kind = TokenIdent
+		tok.Text = lx.src[start:lx.pos]
+		return tok, nil
+	}
+	tok.Kind = TokenSymbol
+	for _, op := range []string{"<>", "!=", "<=", ">="} {
+		if strings.HasPrefix(lx.src[lx.pos:], op) {
+			tok.Text = op
+			lx.advance(2)
+			return tok, nil
+		}
+	}
+	if strings.IndexByte("=<>+-*/%(),;.", c) >= 0 {
+		tok.Text = string(c)
+		lx.advance(1)
+		return tok, nil
+	}
+	r, _ := utf8.DecodeRuneInString(lx.src[lx.pos:])
+	return Token{}, lx.errorAt(tok, "unexpected character "+strconv.QuoteRune(r))
+}
+
+// quoted 读取以 quote 括起的内容：连续两个 quote 表示 quote 本身；字符串中支持 MySQL 的反斜杠转义。
+func (lx *lexer) quoted(tok Token, quote byte) (Token, error) {
+	lx.advance(1)
+	var b strings.Builder
+	for {
+		if lx.pos >= len(lx.src) {
+			if quote == '`' {
+				return Token{}, lx.errorAt(tok, "unterminated quoted identifier")
+			}
+			return Token{}, lx.errorAt(tok, "unterminated string")
+		}
+		c := lx.src[lx.pos]
+		switch {
+		case c == quote && lx.peekByte(1) == quote:
+			b.WriteByte(quote)
+			lx.advance(2)
+		case c == quote:
+			lx.advance(1)
+			tok.Text = b.String()
+			return tok, nil
+		case c == '\\' && quote != '`' && lx.pos+1 < len(lx.src):
+			b.WriteByte(unescape(lx.src[lx.pos+1]))
+			lx.advance(2)
+		default:
+			b.WriteByte(c)
+			lx.advance(1)
+		}
+	}
+}
+
+// number 读取整数、小数与科学计数法数字，例如 42、3.14、.5、1e-3。
+func (lx *lexer) number(tok Token) (Token, error) {
+	start := lx.pos
+	for isDigit(lx.peekByte(0)) {
+		lx.advance(1)
+	}
+	if lx.peekByte(0) == '.' {
+		lx.advance(1)
+		for isDigit(lx.peekByte(0)) {
+			lx.advance(1)
+		}
+	}
+	if c := lx.peekByte(0); c == 'e' || c == 'E' {
+		n := 1
+		if s := lx.peekByte(1); s == '+' || s == '-' {
+			n++
+		}
+		if isDigit(lx.peekByte(n)) {
+			lx.advance(n)
+			for isDigit(lx.peekByte(0)) {
+				lx.advance(1)
+			}
+		}
+	}
+	if isIdentStart(lx.src[lx.pos:]) {
+		return Token{}, lx.errorAt(tok, "invalid number "+strconv.Quote(lx.src[start:lx.pos+1]))
+	}
+	tok.Text = lx.src[start:lx.pos]
+	return tok, nil
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	default:
+		return c
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
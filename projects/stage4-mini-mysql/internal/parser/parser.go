@@ -2,40 +2,848 @@ package parser
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
 var ErrInvalidSQL = errors.New("invalid sql")
 
-// Parse 解析简化 SQL。
+// SyntaxError 带位置的语法错误，Line / Column 从 1 开始。errors.Is(err, ErrInvalidSQL) 成立。
+type SyntaxError struct {
+	Pos    int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrInvalidSQL
+}
+
+// reserved 不能直接用作表名、列名或别名的关键字，需用反引号括起。
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AS": true,
+	"INSERT": true, "INTO": true, "VALUES": true,
+	"UPDATE": true, "SET": true, "DELETE": true,
+	"CREATE": true, "DROP": true, "TABLE": true, "PRIMARY": true,
+	"AND": true, "OR": true, "NOT": true, "IN": true, "BETWEEN": true, "LIKE": true, "IS": true,
+	"NULL": true, "TRUE": true, "FALSE": true,
+	"DISTINCT": true, "GROUP": true, "BY": true, "HAVING": true, "ORDER": true, "ASC": true, "DESC": true,
+	"LIMIT": true, "OFFSET": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "OUTER": true, "CROSS": true, "ON": true,
+}
+
+// Parse 解析一条 SQL 语句，末尾的分号可选。
 func Parse(sql string) (Statement, error) {
-	tokens := Tokenize(sql)
-	if len(tokens) == 0 {
-		return nil, ErrInvalidSQL
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
 	}
+	p.acceptSymbol(";")
+	if tok := p.peek(); tok.Kind != TokenEOF {
+		return nil, p.unexpected(tok, "end of statement")
+	}
+	return stmt, nil
+}
 
-	switch strings.ToUpper(tokens[0]) {
-	case "CREATE":
-		if len(tokens) >= 3 && strings.ToUpper(tokens[1]) == "TABLE" {
-			return &CreateTableStmt{Table: tokens[2]}, nil
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isKeyword(tok Token, kw string) bool {
+	return tok.Kind == TokenIdent && !tok.Quoted && strings.EqualFold(tok.Text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(p.peek(), kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.unexpected(p.peek(), kw)
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(sym string) bool {
+	if tok := p.peek(); tok.Kind == TokenSymbol && tok.Text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		return p.unexpected(p.peek(), strconv.Quote(sym))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(tok Token, expected string) error {
+	got := "end of input"
+	if tok.Kind != TokenEOF {
+		got = strconv.Quote(tok.Text)
+	}
+	return &SyntaxError{Pos: tok.Pos, Line: tok.Line, Column: tok.Column, Msg: "expected " + expected + ", got " + got}
+}
+
+// ident 读取标识符：未加引号的保留字不能作为标识符。
+func (p *parser) ident(what string) (string, error) {
+	tok := p.peek()
+	if tok.Kind != TokenIdent || (!tok.Quoted && reserved[strings.ToUpper(tok.Text)]) {
+		return "", p.unexpected(tok, what)
+	}
+	p.pos++
+	return tok.Text, nil
+}
+
+func (p *parser) identList(what string) ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.ident(what)
+		if err != nil {
+			return nil, err
 		}
-	case "INSERT":
-		// INSERT INTO t key value
-		if len(tokens) >= 5 && strings.ToUpper(tokens[1]) == "INTO" {
-			return &InsertStmt{Table: tokens[2], Key: tokens[3], Value: tokens[4]}, nil
+		names = append(names, name)
+		if !p.acceptSymbol(",") {
+			break
 		}
+	}
+	return names, p.expectSymbol(")")
+}
+
+func (p *parser) parseStatement() (Statement, error) {
+	tok := p.peek()
+	if tok.Kind != TokenIdent || tok.Quoted {
+		return nil, p.unexpected(tok, "statement")
+	}
+	switch strings.ToUpper(tok.Text) {
+	case "CREATE":
+		return p.parseCreateTable()
+	case "DROP":
+		return p.parseDropTable()
+	case "INSERT":
+		return p.parseInsert()
 	case "SELECT":
-		// SELECT * FROM t WHERE key = k
-		if len(tokens) >= 8 && strings.ToUpper(tokens[1]) == "*" && strings.ToUpper(tokens[2]) == "FROM" && strings.ToUpper(tokens[4]) == "WHERE" && strings.EqualFold(tokens[5], "key") {
-			return &SelectStmt{Table: tokens[3], Key: tokens[7]}, nil
+		return p.parseSelect()
+	case "UPDATE":
+		return p.parseUpdate()
+	case "DELETE":
+		return p.parseDelete()
+	case "SHOW":
+		p.pos++
+		if err := p.expectKeyword("TABLES"); err != nil {
+			return nil, err
 		}
-		// SELECT RANGE FROM t start end
-		if len(tokens) >= 6 && strings.ToUpper(tokens[1]) == "RANGE" && strings.ToUpper(tokens[2]) == "FROM" {
-			return &SelectRangeStmt{Table: tokens[3], Start: tokens[4], End: tokens[5]}, nil
+		return &ShowTablesStmt{}, nil
+	case "DESCRIBE", "DESC":
+		p.pos++
+		table, err := p.ident("table name")
+		if err != nil {
+			return nil, err
 		}
+		return &DescribeStmt{Table: table}, nil
 	case "BEGIN", "COMMIT", "ROLLBACK":
-		return &TxStmt{Action: strings.ToUpper(tokens[0])}, nil
+		p.pos++
+		return &TxStmt{Action: strings.ToUpper(tok.Text)}, nil
+	case "START":
+		p.pos++
+		if err := p.expectKeyword("TRANSACTION"); err != nil {
+			return nil, err
+		}
+		return &TxStmt{Action: "BEGIN"}, nil
 	}
+	return nil, p.unexpected(tok, "statement")
+}
 
-	return nil, ErrInvalidSQL
+// parseCreateTable CREATE TABLE [IF NOT EXISTS] t (col type[(n)] [NOT NULL | NULL] [PRIMARY KEY], ..., [PRIMARY KEY (cols)])
+func (p *parser) parseCreateTable() (Statement, error) {
+	p.advance()
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateTableStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeyword("NOT"); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	var err error
+	if stmt.Table, err = p.ident("table name"); err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		if p.isKeyword(p.peek(), "PRIMARY") {
+			pkTok := p.advance()
+			if err = p.expectKeyword("KEY"); err != nil {
+				return nil, err
+			}
+			if len(stmt.PrimaryKey) > 0 {
+				return nil, &SyntaxError{Pos: pkTok.Pos, Line: pkTok.Line, Column: pkTok.Column, Msg: "multiple primary keys defined"}
+			}
+			if stmt.PrimaryKey, err = p.identList("column name"); err != nil {
+				return nil, err
+			}
+		} else {
+			colTok := p.peek()
+			col, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			if col.PrimaryKey {
+				if len(stmt.PrimaryKey) > 0 {
+					return nil, &SyntaxError{Pos: colTok.Pos, Line: colTok.Line, Column: colTok.Column, Msg: "multiple primary keys defined"}
+				}
+				stmt.PrimaryKey = []string{col.Name}
+			}
+			stmt.Columns = append(stmt.Columns, col)
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err = p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if len(stmt.Columns) == 0 {
+		return nil, p.unexpected(p.peek(), "column definition")
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseColumnDef() (ColumnDef, error) {
+	var col ColumnDef
+	var err error
+	if col.Name, err = p.ident("column name"); err != nil {
+		return col, err
+	}
+	typeName, err := p.ident("column type")
+	if err != nil {
+		return col, err
+	}
+	col.Type = strings.ToUpper(typeName)
+	if p.acceptSymbol("(") {
+		tok := p.peek()
+		if tok.Kind != TokenNumber {
+			return col, p.unexpected(tok, "type length")
+		}
+		if col.Length, err = strconv.Atoi(tok.Text); err != nil || col.Length <= 0 {
+			return col, &SyntaxError{Pos: tok.Pos, Line: tok.Line, Column: tok.Column, Msg: "invalid type length " + tok.Text}
+		}
+		p.advance()
+		if err = p.expectSymbol(")"); err != nil {
+			return col, err
+		}
+	}
+	for {
+		switch {
+		case p.acceptKeyword("NOT"):
+			if err = p.expectKeyword("NULL"); err != nil {
+				return col, err
+			}
+			col.NotNull = true
+		case p.acceptKeyword("NULL"):
+			col.NotNull = false
+		case p.acceptKeyword("PRIMARY"):
+			if err = p.expectKeyword("KEY"); err != nil {
+				return col, err
+			}
+			col.PrimaryKey = true
+			col.NotNull = true
+		default:
+			return col, nil
+		}
+	}
+}
+
+// parseDropTable DROP TABLE [IF EXISTS] t
+func (p *parser) parseDropTable() (Statement, error) {
+	p.advance()
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &DropTableStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfExists = true
+	}
+	var err error
+	stmt.Table, err = p.ident("table name")
+	return stmt, err
+}
+
+// parseInsert INSERT INTO t [(cols)] VALUES (exprs), (exprs)...
+func (p *parser) parseInsert() (Statement, error) {
+	p.advance()
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	stmt := &InsertStmt{}
+	var err error
+	if stmt.Table, err = p.ident("table name"); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind == TokenSymbol && tok.Text == "(" {
+		if stmt.Columns, err = p.identList("column name"); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		rowTok := p.peek()
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		row, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		want := len(stmt.Columns)
+		if want == 0 && len(stmt.Rows) > 0 {
+			want = len(stmt.Rows[0])
+		}
+		if want > 0 && len(row) != want {
+			return nil, &SyntaxError{Pos: rowTok.Pos, Line: rowTok.Line, Column: rowTok.Column,
+				Msg: fmt.Sprintf("row has %d values, want %d", len(row), want)}
+		}
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.acceptSymbol(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// parseSelect SELECT [DISTINCT] items FROM t [WHERE expr] [GROUP BY exprs [HAVING expr]] [ORDER BY expr [ASC|DESC], ...] [LIMIT n [OFFSET m] | LIMIT m, n]
+func (p *parser) parseSelect() (Statement, error) {
+	p.advance()
+	stmt := &SelectStmt{Distinct: p.acceptKeyword("DISTINCT")}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = append(stmt.Columns, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.Table, err = p.ident("table name"); err != nil {
+		return nil, err
+	}
+	if stmt.Alias, err = p.alias(); err != nil {
+		return nil, err
+	}
+	for {
+		join, ok, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		stmt.Joins = append(stmt.Joins, join)
+	}
+	if stmt.Where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.GroupBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			var item OrderItem
+			if item.Expr, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		stmt.Limit = &Limit{}
+		if stmt.Limit.Count, err = p.count(); err != nil {
+			return nil, err
+		}
+		if p.acceptSymbol(",") {
+			stmt.Limit.Offset = stmt.Limit.Count
+			if stmt.Limit.Count, err = p.count(); err != nil {
+				return nil, err
+			}
+		} else if p.acceptKeyword("OFFSET") {
+			if stmt.Limit.Offset, err = p.count(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stmt, nil
+}
+
+// count 读取 LIMIT / OFFSET 的非负整数。
+func (p *parser) count() (int64, error) {
+	tok := p.peek()
+	if tok.Kind != TokenNumber {
+		return 0, p.unexpected(tok, "row count")
+	}
+	n, err := strconv.ParseInt(tok.Text, 10, 64)
+	if err != nil || n < 0 {
+		return 0, &SyntaxError{Pos: tok.Pos, Line: tok.Line, Column: tok.Column, Msg: "invalid row count " + tok.Text}
+	}
+	p.advance()
+	return n, nil
+}
+
+func (p *parser) parseSelectItem() (SelectItem, error) {
+	if p.acceptSymbol("*") {
+		return SelectItem{Expr: &StarExpr{}}, nil
+	}
+	// t.* 需要向前看三个词法单元，其余情况按表达式解析。
+	if tok := p.peek(); tok.Kind == TokenIdent && p.pos+2 < len(p.tokens) {
+		dot, star := p.tokens[p.pos+1], p.tokens[p.pos+2]
+		if dot.Kind == TokenSymbol && dot.Text == "." && star.Kind == TokenSymbol && star.Text == "*" {
+			p.pos += 3
+			return SelectItem{Expr: &StarExpr{Table: tok.Text}}, nil
+		}
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	item := SelectItem{Expr: expr}
+	item.Alias, err = p.alias()
+	return item, err
+}
+
+// alias 读取可选的 [AS] alias，省略 AS 时别名不能是保留字。
+func (p *parser) alias() (string, error) {
+	if p.acceptKeyword("AS") {
+		return p.ident("alias")
+	}
+	if tok := p.peek(); tok.Kind == TokenIdent && (tok.Quoted || !reserved[strings.ToUpper(tok.Text)]) {
+		return p.ident("alias")
+	}
+	return "", nil
+}
+
+// parseJoin 读取一个连接：, t | CROSS JOIN t | [INNER] JOIN t [ON expr] | LEFT [OUTER] JOIN t ON expr，
+// 表名后可跟别名。没有连接时 ok 为 false。
+func (p *parser) parseJoin() (join Join, ok bool, err error) {
+	switch {
+	case p.acceptSymbol(","):
+		join.Kind = "CROSS"
+	case p.acceptKeyword("CROSS"):
+		join.Kind = "CROSS"
+		err = p.expectKeyword("JOIN")
+	case p.acceptKeyword("INNER"):
+		join.Kind = "INNER"
+		err = p.expectKeyword("JOIN")
+	case p.acceptKeyword("JOIN"):
+		join.Kind = "INNER"
+	case p.acceptKeyword("LEFT"):
+		join.Kind = "LEFT"
+		p.acceptKeyword("OUTER")
+		err = p.expectKeyword("JOIN")
+	default:
+		return Join{}, false, nil
+	}
+	if err != nil {
+		return Join{}, false, err
+	}
+	if join.Table, err = p.ident("table name"); err != nil {
+		return Join{}, false, err
+	}
+	if join.Alias, err = p.alias(); err != nil {
+		return Join{}, false, err
+	}
+	if join.Kind == "LEFT" {
+		if err = p.expectKeyword("ON"); err != nil {
+			return Join{}, false, err
+		}
+	} else if join.Kind == "CROSS" || !p.acceptKeyword("ON") {
+		return join, true, nil
+	}
+	if join.On, err = p.parseExpr(); err != nil {
+		return Join{}, false, err
+	}
+	return join, true, nil
+}
+
+// parseUpdate UPDATE t SET col = expr, ... [WHERE expr]
+func (p *parser) parseUpdate() (Statement, error) {
+	p.advance()
+	stmt := &UpdateStmt{}
+	var err error
+	if stmt.Table, err = p.ident("table name"); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		var set Assignment
+		if set.Column, err = p.ident("column name"); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		if set.Value, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, set)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	stmt.Where, err = p.parseWhere()
+	return stmt, err
+}
+
+// parseDelete DELETE FROM t [WHERE expr]
+func (p *parser) parseDelete() (Statement, error) {
+	p.advance()
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	stmt := &DeleteStmt{}
+	var err error
+	if stmt.Table, err = p.ident("table name"); err != nil {
+		return nil, err
+	}
+	stmt.Where, err = p.parseWhere()
+	return stmt, err
+}
+
+func (p *parser) parseWhere() (Expr, error) {
+	if !p.acceptKeyword("WHERE") {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+func (p *parser) parseExprList() ([]Expr, error) {
+	var list []Expr
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if !p.acceptSymbol(",") {
+			return list, nil
+		}
+	}
+}
+
+// 表达式按优先级从低到高：OR < AND < NOT < 比较 / IS / IN / BETWEEN / LIKE < + - < * / % < 一元负号 < 基本表达式。
+
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+// parsePredicate 解析比较与 IS / IN / BETWEEN / LIKE 谓词，它们互不结合：a = b = c 是语法错误。
+func (p *parser) parsePredicate() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.Kind == TokenSymbol {
+		switch tok.Text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.advance()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := tok.Text
+			if op == "!=" {
+				op = "<>"
+			}
+			return &BinaryExpr{Op: op, Left: left, Right: right}, nil
+		}
+		return left, nil
+	}
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: left, Not: not}, nil
+	}
+	not := false
+	if p.isKeyword(tok, "NOT") {
+		next := p.tokens[p.pos+1]
+		if !p.isKeyword(next, "IN") && !p.isKeyword(next, "BETWEEN") && !p.isKeyword(next, "LIKE") {
+			return nil, p.unexpected(next, "IN, BETWEEN or LIKE")
+		}
+		p.advance()
+		not = true
+	}
+	switch {
+	case p.acceptKeyword("IN"):
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		return &InExpr{Expr: left, List: list, Not: not}, p.expectSymbol(")")
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Expr: left, Pattern: pattern, Not: not}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.Kind != TokenSymbol || (tok.Text != "+" && tok.Text != "-") {
+			return left, nil
+		}
+		p.advance()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: tok.Text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.Kind != TokenSymbol || (tok.Text != "*" && tok.Text != "/" && tok.Text != "%") {
+			return left, nil
+		}
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: tok.Text, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.acceptSymbol("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// 负数字面量直接折叠，使 INSERT ... VALUES (-1) 得到 Literal。
+		if lit, ok := expr.(*Literal); ok && (lit.Kind == LiteralInt || lit.Kind == LiteralFloat) && !strings.HasPrefix(lit.Value, "-") {
+			return &Literal{Kind: lit.Kind, Value: "-" + lit.Value}, nil
+		}
+		return &UnaryExpr{Op: "-", Expr: expr}, nil
+	}
+	if p.acceptSymbol("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+	switch tok.Kind {
+	case TokenNumber:
+		p.advance()
+		if strings.ContainsAny(tok.Text, ".eE") {
+			return &Literal{Kind: LiteralFloat, Value: tok.Text}, nil
+		}
+		return &Literal{Kind: LiteralInt, Value: tok.Text}, nil
+	case TokenString:
+		p.advance()
+		return &Literal{Kind: LiteralString, Value: tok.Text}, nil
+	case TokenSymbol:
+		if tok.Text == "(" {
+			p.advance()
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expectSymbol(")")
+		}
+	case TokenIdent:
+		if !tok.Quoted {
+			switch strings.ToUpper(tok.Text) {
+			case "NULL":
+				p.advance()
+				return &Literal{Kind: LiteralNull}, nil
+			case "TRUE", "FALSE":
+				p.advance()
+				return &Literal{Kind: LiteralBool, Value: strings.ToUpper(tok.Text)}, nil
+			}
+		}
+		name, err := p.ident("expression")
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptSymbol("(") {
+			return p.parseFuncCall(name)
+		}
+		if p.acceptSymbol(".") {
+			column, err := p.ident("column name")
+			if err != nil {
+				return nil, err
+			}
+			return &ColumnRef{Table: name, Name: column}, nil
+		}
+		return &ColumnRef{Name: name}, nil
+	}
+	return nil, p.unexpected(tok, "expression")
+}
+
+// parseFuncCall 解析函数名与左括号之后的部分：name(*)、name(DISTINCT args) 或 name(args)。
+func (p *parser) parseFuncCall(name string) (Expr, error) {
+	call := &FuncCall{Name: strings.ToUpper(name)}
+	if p.acceptSymbol("*") {
+		call.Star = true
+		return call, p.expectSymbol(")")
+	}
+	if p.acceptSymbol(")") {
+		return call, nil
+	}
+	call.Distinct = p.acceptKeyword("DISTINCT")
+	args, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	call.Args = args
+	return call, p.expectSymbol(")")
 }
@@ -1,14 +1,26 @@
 package parser
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestParseStatements(t *testing.T) {
 	cases := []string{
-		"CREATE TABLE kv;",
-		"INSERT INTO kv k1 v1;",
-		"SELECT * FROM kv WHERE key = k1;",
-		"SELECT RANGE FROM kv a z;",
+		"CREATE TABLE kv (key VARCHAR(64) PRIMARY KEY, value TEXT);",
+		"INSERT INTO kv VALUES ('k1', 'v1');",
+		"SELECT * FROM kv WHERE key = 'k1';",
+		"SELECT key, value FROM kv WHERE key BETWEEN 'a' AND 'z'",
+		"UPDATE kv SET value = 'v2' WHERE key = 'k1'",
+		"DELETE FROM kv WHERE key IN ('a', 'b')",
+		"DROP TABLE IF EXISTS kv",
+		"SHOW TABLES;",
+		"DESCRIBE kv",
+		"DESC kv",
 		"BEGIN;",
+		"START TRANSACTION",
 		"COMMIT;",
 		"ROLLBACK;",
 	}
@@ -19,8 +31,235 @@ func TestParseStatements(t *testing.T) {
 	}
 }
 
+func TestParseCreateTable(t *testing.T) {
+	stmt, err := Parse(`CREATE TABLE IF NOT EXISTS users (
+		id BIGINT NOT NULL,
+		name varchar(32) NOT NULL,
+		email VARCHAR(128) NULL,
+		active BOOL,
+		PRIMARY KEY (id)
+	)`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := &CreateTableStmt{
+		Table:       "users",
+		IfNotExists: true,
+		Columns: []ColumnDef{
+			{Name: "id", Type: "BIGINT", NotNull: true},
+			{Name: "name", Type: "VARCHAR", Length: 32, NotNull: true},
+			{Name: "email", Type: "VARCHAR", Length: 128},
+			{Name: "active", Type: "BOOL"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	if !reflect.DeepEqual(stmt, want) {
+		t.Fatalf("Parse() = %+v, want %+v", stmt, want)
+	}
+
+	stmt, err = Parse("CREATE TABLE t (`select` INT PRIMARY KEY)")
+	if err != nil {
+		t.Fatalf("Parse(quoted) error = %v", err)
+	}
+	create := stmt.(*CreateTableStmt)
+	if create.Columns[0].Name != "select" || !create.Columns[0].NotNull || !reflect.DeepEqual(create.PrimaryKey, []string{"select"}) {
+		t.Fatalf("Parse(quoted) = %+v", create)
+	}
+}
+
+func TestParseInsertMultipleRows(t *testing.T) {
+	stmt, err := Parse("INSERT INTO t (id, name, score) VALUES (1, 'a''b', -2.5), (2, \"c\\nd\", NULL)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	insert := stmt.(*InsertStmt)
+	if insert.Table != "t" || !reflect.DeepEqual(insert.Columns, []string{"id", "name", "score"}) || len(insert.Rows) != 2 {
+		t.Fatalf("Parse() = %+v", insert)
+	}
+	want := [][]Expr{
+		{&Literal{Kind: LiteralInt, Value: "1"}, &Literal{Kind: LiteralString, Value: "a'b"}, &Literal{Kind: LiteralFloat, Value: "-2.5"}},
+		{&Literal{Kind: LiteralInt, Value: "2"}, &Literal{Kind: LiteralString, Value: "c\nd"}, &Literal{Kind: LiteralNull}},
+	}
+	if !reflect.DeepEqual(insert.Rows, want) {
+		t.Fatalf("rows = %v, want %v", insert.Rows, want)
+	}
+}
+
+func TestParseSelectExpressions(t *testing.T) {
+	cases := []struct {
+		sql   string
+		where string
+	}{
+		{"SELECT * FROM t WHERE a = 1 OR b = 2 AND NOT c = 3", "((a = 1) OR ((b = 2) AND (NOT (c = 3))))"},
+		{"SELECT * FROM t WHERE (a = 1 OR b = 2) AND c != 3", "(((a = 1) OR (b = 2)) AND (c <> 3))"},
+		{"SELECT * FROM t WHERE a + b * 2 >= 10 - -c", "((a + (b * 2)) >= (10 - (-c)))"},
+		{"SELECT * FROM t WHERE a NOT IN (1, 2) AND b BETWEEN 1 AND 5", "((a NOT IN (1, 2)) AND (b BETWEEN 1 AND 5))"},
+		{"SELECT * FROM t WHERE name LIKE 'a%' OR name NOT LIKE '%z'", "((name LIKE 'a%') OR (name NOT LIKE '%z'))"},
+		{"SELECT * FROM t WHERE a IS NULL AND t.b IS NOT NULL", "((a IS NULL) AND (t.b IS NOT NULL))"},
+		{"SELECT * FROM t WHERE flag = TRUE -- trailing comment", "(flag = TRUE)"},
+		{"SELECT * /* all */ FROM t # comment\nWHERE a <> 1", "(a <> 1)"},
+	}
+	for _, tc := range cases {
+		stmt, err := Parse(tc.sql)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.sql, err)
+		}
+		if got := stmt.(*SelectStmt).Where.String(); got != tc.where {
+			t.Fatalf("Parse(%q) where = %s, want %s", tc.sql, got, tc.where)
+		}
+	}
+
+	stmt, err := Parse("SELECT id, t.name AS n, score * 2 doubled, t.* FROM t")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	sel := stmt.(*SelectStmt)
+	want := []SelectItem{
+		{Expr: &ColumnRef{Name: "id"}},
+		{Expr: &ColumnRef{Table: "t", Name: "name"}, Alias: "n"},
+		{Expr: &BinaryExpr{Op: "*", Left: &ColumnRef{Name: "score"}, Right: &Literal{Kind: LiteralInt, Value: "2"}}, Alias: "doubled"},
+		{Expr: &StarExpr{Table: "t"}},
+	}
+	if !reflect.DeepEqual(sel.Columns, want) || sel.Where != nil {
+		t.Fatalf("Parse() = %+v", sel)
+	}
+}
+
+func TestParseSelectClauses(t *testing.T) {
+	stmt, err := Parse("SELECT DISTINCT dept, COUNT(*) AS n, AVG(salary) FROM emp WHERE age > 30 " +
+		"GROUP BY dept HAVING count(DISTINCT name) >= 2 ORDER BY n DESC, dept LIMIT 5 OFFSET 10")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	sel := stmt.(*SelectStmt)
+	if !sel.Distinct || sel.Table != "emp" || sel.Where.String() != "(age > 30)" {
+		t.Fatalf("Parse() = %+v", sel)
+	}
+	if got := []string{sel.Columns[1].Expr.String(), sel.Columns[1].Alias, sel.Columns[2].Expr.String()}; !reflect.DeepEqual(got, []string{"COUNT(*)", "n", "AVG(salary)"}) {
+		t.Fatalf("select items = %v", got)
+	}
+	if len(sel.GroupBy) != 1 || sel.GroupBy[0].String() != "dept" || sel.Having.String() != "(COUNT(DISTINCT name) >= 2)" {
+		t.Fatalf("group by = %v, having = %v", sel.GroupBy, sel.Having)
+	}
+	wantOrder := []OrderItem{{Expr: &ColumnRef{Name: "n"}, Desc: true}, {Expr: &ColumnRef{Name: "dept"}}}
+	if !reflect.DeepEqual(sel.OrderBy, wantOrder) || !reflect.DeepEqual(sel.Limit, &Limit{Count: 5, Offset: 10}) {
+		t.Fatalf("order by = %+v, limit = %+v", sel.OrderBy, sel.Limit)
+	}
+
+	stmt, err = Parse("SELECT a FROM t ORDER BY 1 ASC LIMIT 3, 7")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if sel = stmt.(*SelectStmt); !reflect.DeepEqual(sel.Limit, &Limit{Count: 7, Offset: 3}) || sel.OrderBy[0].Desc {
+		t.Fatalf("Parse() = %+v", sel)
+	}
+}
+
+func TestParseJoins(t *testing.T) {
+	stmt, err := Parse("SELECT u.name, o.total FROM users AS u JOIN orders o ON o.user_id = u.id " +
+		"LEFT OUTER JOIN items i ON i.order_id = o.id AND i.qty > 1 CROSS JOIN regions, tags t INNER JOIN misc WHERE u.id > 3")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	sel := stmt.(*SelectStmt)
+	if sel.Table != "users" || sel.Alias != "u" || sel.Where.String() != "(u.id > 3)" {
+		t.Fatalf("Parse() = %+v", sel)
+	}
+	type join struct{ kind, table, alias, on string }
+	var got []join
+	for _, j := range sel.Joins {
+		on := ""
+		if j.On != nil {
+			on = j.On.String()
+		}
+		got = append(got, join{j.Kind, j.Table, j.Alias, on})
+	}
+	want := []join{
+		{"INNER", "orders", "o", "(o.user_id = u.id)"},
+		{"LEFT", "items", "i", "((i.order_id = o.id) AND (i.qty > 1))"},
+		{"CROSS", "regions", "", ""},
+		{"CROSS", "tags", "t", ""},
+		{"INNER", "misc", "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("joins = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseUpdateDelete(t *testing.T) {
+	stmt, err := Parse("UPDATE t SET a = a + 1, b = 'x' WHERE id = 7")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	update := stmt.(*UpdateStmt)
+	if len(update.Set) != 2 || update.Set[0].Column != "a" || update.Set[0].Value.String() != "(a + 1)" || update.Where.String() != "(id = 7)" {
+		t.Fatalf("Parse() = %+v", update)
+	}
+
+	stmt, err = Parse("DELETE FROM t")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if del := stmt.(*DeleteStmt); del.Table != "t" || del.Where != nil {
+		t.Fatalf("Parse() = %+v", del)
+	}
+}
+
 func TestParseInvalid(t *testing.T) {
-	if _, err := Parse("DROP TABLE kv;"); err == nil {
-		t.Fatal("Parse(invalid) should fail")
+	cases := []struct {
+		sql  string
+		line int
+		col  int
+		msg  string
+	}{
+		{"SELEC * FROM t", 1, 1, `expected statement, got "SELEC"`},
+		{"SELECT * FROM", 1, 14, "expected table name, got end of input"},
+		{"SELECT * FROM select", 1, 15, `expected table name, got "select"`},
+		{"SELECT a FROM t WHERE a = ", 1, 27, "expected expression, got end of input"},
+		{"SELECT a FROM t WHERE a = 1 = 2", 1, 29, `expected end of statement, got "="`},
+		{"SELECT a FROM t\nWHERE a NOT 1", 2, 13, `expected IN, BETWEEN or LIKE, got "1"`},
+		{"INSERT INTO t (a, b) VALUES (1)", 1, 29, "row has 1 values, want 2"},
+		{"INSERT INTO t VALUES (1, 2), (3)", 1, 30, "row has 1 values, want 2"},
+		{"CREATE TABLE t (a INT PRIMARY KEY, PRIMARY KEY (a))", 1, 36, "multiple primary keys defined"},
+		{"CREATE TABLE t (a VARCHAR(x))", 1, 27, `expected type length, got "x"`},
+		{"SELECT 'abc FROM t", 1, 8, "unterminated string"},
+		{"SELECT a FROM t WHERE a = 1 /* x", 1, 29, "unterminated comment"},
+		{"SELECT a FROM t WHERE a = 12abc", 1, 27, `invalid number "12a"`},
+		{"SELECT a FROM t WHERE a = @x", 1, 27, `unexpected character '@'`},
+		{"SELECT a FROM t LIMIT -1", 1, 23, `expected row count, got "-"`},
+		{"SELECT a FROM t ORDER a", 1, 23, `expected BY, got "a"`},
+		{"SELECT COUNT(* FROM t", 1, 16, `expected ")", got "FROM"`},
+		{"SELECT * FROM a LEFT JOIN b", 1, 28, "expected ON, got end of input"},
+		{"SELECT * FROM a JOIN ON x", 1, 22, `expected table name, got "ON"`},
+		{"SELECT * FROM a CROSS b", 1, 23, `expected JOIN, got "b"`},
+	}
+	for _, tc := range cases {
+		_, err := Parse(tc.sql)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || !errors.Is(err, ErrInvalidSQL) {
+			t.Fatalf("Parse(%q) error = %v, want SyntaxError", tc.sql, err)
+		}
+		if syntaxErr.Line != tc.line || syntaxErr.Column != tc.col || syntaxErr.Msg != tc.msg {
+			t.Fatalf("Parse(%q) error = %v, want line %d column %d: %s", tc.sql, err, tc.line, tc.col, tc.msg)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize("SELECT `a b`, 'it''s', 1.5e3 FROM t\n WHERE x<=.5")
+	if err != nil {
+		t.Fatalf("Tokenize() error = %v", err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Kind.String()+":"+tok.Text)
+	}
+	want := "identifier:SELECT identifier:a b symbol:, string:it's symbol:, number:1.5e3 identifier:FROM identifier:t " +
+		"identifier:WHERE identifier:x symbol:<= number:.5 EOF:"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("Tokenize() = %s, want %s", strings.Join(got, " "), want)
+	}
+	if last := tokens[len(tokens)-2]; last.Line != 2 || last.Column != 11 {
+		t.Fatalf("token %q at %d:%d, want 2:11", last.Text, last.Line, last.Column)
 	}
 }
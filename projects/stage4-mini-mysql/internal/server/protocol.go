@@ -2,7 +2,19 @@ package server
 
 import "strings"
 
+// fieldEscaper 转义结果中的字段，使 | 只作分隔符、换行只作行结束。
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", `\n`, "\r", `\r`)
+
 // normalizeSQL 清理 SQL 输入。
 func normalizeSQL(line string) string {
 	return strings.TrimSpace(strings.TrimSuffix(line, ";"))
 }
+
+// formatRow 将一行字段转义后以 | 连接。
+func formatRow(fields []string) string {
+	escaped := make([]string, len(fields))
+	for i, f := range fields {
+		escaped[i] = fieldEscaper.Replace(f)
+	}
+	return strings.Join(escaped, "|")
+}
@@ -0,0 +1,20 @@
+package server
+
+import "testing"
+
+func TestFormatRow(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   string
+	}{
+		{[]string{"a", "NULL", "1.5"}, "a|NULL|1.5"},
+		{[]string{"x|y", `back\slash`}, `x\|y|back\\slash`},
+		{[]string{"two\nlines\r"}, `two\nlines\r`},
+		{nil, ""},
+	}
+	for _, tc := range tests {
+		if got := formatRow(tc.fields); got != tc.want {
+			t.Errorf("formatRow(%q) = %q, want %q", tc.fields, got, tc.want)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package server
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"sync"
@@ -74,7 +76,9 @@ func (s *TCPServer) handleConn(ctx context.Context, conn net.Conn) {
 	}()
 
 	sessionID := fmt.Sprintf("session-%d", s.nextID.Add(1))
-	_, _ = conn.Write([]byte("WELCOME mini-mysql\n"))
+	w := bufio.NewWriter(conn)
+	_, _ = w.WriteString("WELCOME mini-mysql\n")
+	_ = w.Flush()
 
 	scanner := bufio.NewScanner(conn)
 	for scanner.Scan() {
@@ -83,23 +87,64 @@ func (s *TCPServer) handleConn(ctx context.Context, conn net.Conn) {
 			continue
 		}
 		if line == "QUIT" || line == "EXIT" {
-			_, _ = conn.Write([]byte("BYE\n"))
+			_, _ = w.WriteString("BYE\n")
+			_ = w.Flush()
 			return
 		}
 
 		statement, err := parser.Parse(line)
+		if err == nil {
+			opCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			if query, ok := statement.(*parser.SelectStmt); ok {
+				err = s.streamQuery(opCtx, w, query)
+			} else {
+				var result string
+				if result, err = s.engine.Execute(opCtx, sessionID, statement); err == nil {
+					_, _ = w.WriteString("OK " + result + "\n")
+				}
+			}
+			cancel()
+		}
 		if err != nil {
-			_, _ = conn.Write([]byte("ERR invalid sql\n"))
-			continue
+			_, _ = w.WriteString("ERR " + err.Error() + "\n")
+		}
+		if err = w.Flush(); err != nil {
+			return
 		}
+	}
+}
 
-		opCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
-		result, execErr := s.engine.Execute(opCtx, sessionID, statement)
-		cancel()
-		if execErr != nil {
-			_, _ = conn.Write([]byte("ERR " + execErr.Error() + "\n"))
-			continue
+// streamQuery 逐行写出查询结果：先写 COLUMNS 行，每行结果写一行 ROW，最后写 OK <n> rows。
+// 中途出错时已写出的行不会撤回，调用方随后写 ERR。
+func (s *TCPServer) streamQuery(ctx context.Context, w *bufio.Writer, stmt *parser.SelectStmt) (err error) {
+	rows, err := s.engine.Query(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, rows.Close())
+	}()
+	if _, err = w.WriteString("COLUMNS " + formatRow(rows.Columns()) + "\n"); err != nil {
+		return err
+	}
+	count := 0
+	for {
+		row, err := rows.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fields := make([]string, len(row))
+		for i, v := range row {
+			fields[i] = v.String()
+		}
+		if _, err = w.WriteString("ROW " + formatRow(fields) + "\n"); err != nil {
+			return err
 		}
-		_, _ = conn.Write([]byte("OK " + result + "\n"))
+		count++
 	}
+	_, err = fmt.Fprintf(w, "OK %d rows\n", count)
+	return err
 }
@@ -3,33 +3,104 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
-	"sort"
 	"sync"
 )
 
 var (
-	ErrKeyNotFound = errors.New("key not found")
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrNotBPlusTree = errors.New("page is not a b+tree meta page")
 )
 
-// BPlusTree 简化 B+Tree（内存索引 + 有序键集合）。
+// 元数据页：魔数(4) + 根页号(4) + 键数量(8)。
+var bplusTreeMagic = []byte("BPT1")
+
+// BPlusTree 基于页的 B+Tree。内部节点与叶子节点各占一页，经缓冲池获取与 pin；
+// 叶子按键序以右兄弟指针相连供范围扫描；根页号与键数量保存在元数据页，重新打开时由 OpenBPlusTree 读取。
+// 节点按编码后的字节数分裂（超过一页）与合并/重分配（不足 minNodeSize），因此键值长度可变。
+// 写操作持有整棵树的写锁，同一时刻只 pin 一两个页，容量很小的缓冲池也能工作。
 type BPlusTree struct {
-	mu    sync.RWMutex
-	order int
-	pager PageManager
-	store map[string][]byte
-	keys  []string
+	mu      sync.RWMutex
+	pool    BufferPool
+	metaID  PageID
+	root    PageID
+	count   uint64
+	version uint64
+}
+
+// pathStep 自根向下查找时经过的内部节点及所选子节点下标。
+type pathStep struct {
+	node  *node
+	index int
 }
 
-// NewBPlusTree 创建简化 B+Tree。
-func NewBPlusTree(order int, pager PageManager) *BPlusTree {
-	if order <= 0 {
-		order = 16
+// NewBPlusTree 在缓冲池上新建一棵空树（分配元数据页与根叶子页），pool 为 nil 时使用不落盘的内存页。
+// 新树的元数据页号由 MetaPageID 返回，需由调用方记录以便重新打开。
+func NewBPlusTree(ctx context.Context, pool BufferPool) (*BPlusTree, error) {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	return &BPlusTree{order: order, pager: pager, store: make(map[string][]byte), keys: make([]string, 0)}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		pool = newMemoryPool()
+	}
+
+	meta, err := pool.NewPage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := &BPlusTree{pool: pool, metaID: meta.ID}
+	if err = pool.UnpinPage(ctx, meta.ID, true); err != nil {
+		return nil, err
+	}
+	root, err := t.newNode(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	t.root = root.id
+	if err = t.writeNode(ctx, root); err != nil {
+		return nil, err
+	}
+	if err = t.writeMeta(ctx); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
-// Insert 插入键值。
+// OpenBPlusTree 从元数据页打开已有的树。
+func OpenBPlusTree(ctx context.Context, pool BufferPool, metaID PageID) (*BPlusTree, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	page, err := pool.FetchPage(ctx, metaID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pool.UnpinPage(ctx, metaID, false) }()
+	if !bytes.Equal(page.Data[:4], bplusTreeMagic) {
+		return nil, ErrNotBPlusTree
+	}
+	return &BPlusTree{
+		pool:   pool,
+		metaID: metaID,
+		root:   PageID(binary.LittleEndian.Uint32(page.Data[4:])),
+		count:  binary.LittleEndian.Uint64(page.Data[8:]),
+	}, nil
+}
+
+// MetaPageID 返回树的元数据页号。
+func (t *BPlusTree) MetaPageID() PageID {
+	return t.metaID
+}
+
+// Insert 插入键值，键已存在时覆盖。
 func (t *BPlusTree) Insert(ctx context.Context, key, value []byte) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -37,16 +108,39 @@ func (t *BPlusTree) Insert(ctx context.Context, key, value []byte) error {
 	if err := ctx.Err(); err != nil {
 		return err
 	}
+	if len(key) > MaxKeySize {
+		return ErrKeyTooLarge
+	}
 
-	sKey := string(key)
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if _, ok := t.store[sKey]; !ok {
-		t.keys = append(t.keys, sKey)
-		sort.Strings(t.keys)
+	path, leaf, err := t.findLeaf(ctx, key)
+	if err != nil {
+		return err
 	}
-	t.store[sKey] = append([]byte(nil), value...)
-	return nil
+	stored, err := t.storeValue(ctx, value)
+	if err != nil {
+		return err
+	}
+	i, found := leaf.search(key)
+	if found {
+		if err = t.freeValue(ctx, leaf.values[i]); err != nil {
+			return err
+		}
+		leaf.values[i] = stored
+	} else {
+		leaf.keys = insertAt(leaf.keys, i, bytes.Clone(key))
+		leaf.values = insertAt(leaf.values, i, stored)
+		t.count++
+	}
+	t.version++
+	if err = t.rebalance(ctx, path, leaf); err != nil {
+		return err
+	}
+	if found {
+		return nil
+	}
+	return t.writeMeta(ctx)
 }
 
 // Delete 删除键。
@@ -58,18 +152,27 @@ func (t *BPlusTree) Delete(ctx context.Context, key []byte) error {
 		return err
 	}
 
-	sKey := string(key)
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if _, ok := t.store[sKey]; !ok {
+	path, leaf, err := t.findLeaf(ctx, key)
+	if err != nil {
+		return err
+	}
+	i, found := leaf.search(key)
+	if !found {
 		return ErrKeyNotFound
 	}
-	delete(t.store, sKey)
-	idx := sort.SearchStrings(t.keys, sKey)
-	if idx < len(t.keys) && t.keys[idx] == sKey {
-		t.keys = append(t.keys[:idx], t.keys[idx+1:]...)
+	if err = t.freeValue(ctx, leaf.values[i]); err != nil {
+		return err
 	}
-	return nil
+	leaf.keys = removeAt(leaf.keys, i)
+	leaf.values = removeAt(leaf.values, i)
+	t.count--
+	t.version++
+	if err = t.rebalance(ctx, path, leaf); err != nil {
+		return err
+	}
+	return t.writeMeta(ctx)
 }
 
 // Search 点查。
@@ -83,14 +186,19 @@ func (t *BPlusTree) Search(ctx context.Context, key []byte) ([]byte, error) {
 
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	value, ok := t.store[string(key)]
-	if !ok {
+	_, leaf, err := t.findLeaf(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	i, found := leaf.search(key)
+	if !found {
 		return nil, ErrKeyNotFound
 	}
-	return append([]byte(nil), value...), nil
+	return t.loadValue(ctx, leaf.values[i])
 }
 
-// RangeScan 范围扫描。
+// RangeScan 范围扫描 [startKey, endKey]，endKey 为空表示扫描到末尾。
+// 迭代器沿叶子兄弟指针逐页读取，不在两次读取之间持有锁或 pin。
 func (t *BPlusTree) RangeScan(ctx context.Context, startKey, endKey []byte) (*Iterator, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -99,26 +207,358 @@ func (t *BPlusTree) RangeScan(ctx context.Context, startKey, endKey []byte) (*It
 		return nil, err
 	}
 
-	start := string(startKey)
-	end := string(endKey)
+	it := &Iterator{index: -1, tree: t, ctx: ctx, end: bytes.Clone(endKey), from: bytes.Clone(startKey), inclusive: true, next: InvalidPageID}
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	pairs := make([]KeyValue, 0)
-	for _, key := range t.keys {
-		if bytes.Compare([]byte(key), []byte(start)) < 0 {
-			continue
-		}
-		if end != "" && bytes.Compare([]byte(key), []byte(end)) > 0 {
-			break
-		}
-		pairs = append(pairs, KeyValue{Key: []byte(key), Value: append([]byte(nil), t.store[key]...)})
+	if err := it.loadLeafLocked(); err != nil {
+		return nil, err
 	}
-	return NewIterator(pairs), nil
+	return it, nil
 }
 
 // Len 当前键数量。
 func (t *BPlusTree) Len() int {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	return len(t.keys)
+	return int(t.count)
+}
+
+// Destroy 释放树占用的全部页（节点、溢出页与元数据页），之后不能再使用该树。
+func (t *BPlusTree) Destroy(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.destroyNode(ctx, t.root); err != nil {
+		return err
+	}
+	t.version++
+	t.root, t.count = InvalidPageID, 0
+	return t.pool.DeletePage(ctx, t.metaID)
+}
+
+func (t *BPlusTree) destroyNode(ctx context.Context, id PageID) error {
+	n, err := t.readNode(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, child := range n.children {
+		if err = t.destroyNode(ctx, child); err != nil {
+			return err
+		}
+	}
+	for _, value := range n.values {
+		if err = t.freeValue(ctx, value); err != nil {
+			return err
+		}
+	}
+	return t.pool.DeletePage(ctx, id)
+}
+
+// findLeaf 自根向下查找 key 所在的叶子，返回途经的内部节点路径。
+func (t *BPlusTree) findLeaf(ctx context.Context, key []byte) ([]pathStep, *node, error) {
+	var path []pathStep
+	n, err := t.readNode(ctx, t.root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for !n.leaf {
+		i := n.childIndex(key)
+		path = append(path, pathStep{node: n, index: i})
+		if n, err = t.readNode(ctx, n.children[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return path, n, nil
+}
+
+// rebalance 写回被修改的节点 n：超过一页时分裂，过空时与兄弟合并或重分配，
+// 两种情况都会修改父节点，于是沿 path 向上继续处理，直到某个节点无需调整。
+func (t *BPlusTree) rebalance(ctx context.Context, path []pathStep, n *node) error {
+	for level := len(path) - 1; ; level-- {
+		if level < 0 {
+			return t.rebalanceRoot(ctx, n)
+		}
+		parent, index := path[level].node, path[level].index
+		switch {
+		case n.size() > PageSize:
+			sep, right, err := t.split(ctx, n)
+			if err != nil {
+				return err
+			}
+			parent.keys = insertAt(parent.keys, index, sep)
+			parent.children = insertAt(parent.children, index+1, right)
+		case n.size() < minNodeSize:
+			if err := t.fixUnderflow(ctx, parent, index, n); err != nil {
+				return err
+			}
+		default:
+			return t.writeNode(ctx, n)
+		}
+		n = parent
+	}
+}
+
+// rebalanceRoot 根节点超过一页时分裂并长出新根；内部根节点只剩一个子节点时由该子节点成为新根。
+func (t *BPlusTree) rebalanceRoot(ctx context.Context, root *node) error {
+	switch {
+	case root.size() > PageSize:
+		sep, right, err := t.split(ctx, root)
+		if err != nil {
+			return err
+		}
+		newRoot, err := t.newNode(ctx, false)
+		if err != nil {
+			return err
+		}
+		newRoot.keys = [][]byte{sep}
+		newRoot.children = []PageID{root.id, right}
+		t.root = newRoot.id
+		if err = t.writeNode(ctx, newRoot); err != nil {
+			return err
+		}
+		return t.writeMeta(ctx)
+	case !root.leaf && len(root.keys) == 0:
+		t.root = root.children[0]
+		if err := t.pool.DeletePage(ctx, root.id); err != nil {
+			return err
+		}
+		return t.writeMeta(ctx)
+	}
+	return t.writeNode(ctx, root)
+}
+
+// split 把 n 的后半部分移到新的右兄弟并写回两页，返回应插入父节点的分隔键与右兄弟页号。
+// 叶子分裂时分隔键复制自右兄弟的首键；内部节点分裂时中间键上移，不再保留在子节点中。
+func (t *BPlusTree) split(ctx context.Context, n *node) ([]byte, PageID, error) {
+	right, err := t.newNode(ctx, n.leaf)
+	if err != nil {
+		return nil, InvalidPageID, err
+	}
+	var sep []byte
+	if n.leaf {
+		k := n.splitPoint(1)
+		right.keys = append(right.keys, n.keys[k:]...)
+		right.values = append(right.values, n.values[k:]...)
+		n.keys, n.values = n.keys[:k:k], n.values[:k:k]
+		right.next, n.next = n.next, right.id
+		sep = right.keys[0]
+	} else {
+		k := n.splitPoint(1)
+		k = min(k, len(n.keys)-2)
+		sep = n.keys[k]
+		right.keys = append(right.keys, n.keys[k+1:]...)
+		right.children = append(right.children, n.children[k+1:]...)
+		n.keys, n.children = n.keys[:k:k], n.children[:k+1:k+1]
+	}
+	if err = t.writeNode(ctx, n); err != nil {
+		return nil, InvalidPageID, err
+	}
+	if err = t.writeNode(ctx, right); err != nil {
+		return nil, InvalidPageID, err
+	}
+	return sep, right.id, nil
+}
+
+// fixUnderflow 处理父节点第 index 个子节点 n 过空：与相邻兄弟（优先左兄弟）合并后能装进一页则合并，
+// 否则在两者之间重新平均分配条目并更新父节点中的分隔键。
+func (t *BPlusTree) fixUnderflow(ctx context.Context, parent *node, index int, n *node) error {
+	if len(parent.children) < 2 {
+		return t.writeNode(ctx, n)
+	}
+	sepIndex := max(index-1, 0)
+	siblingID := parent.children[sepIndex]
+	if index == 0 {
+		siblingID = parent.children[1]
+	}
+	sibling, err := t.readNode(ctx, siblingID)
+	if err != nil {
+		return err
+	}
+	left, right := sibling, n
+	if index == 0 {
+		left, right = n, sibling
+	}
+	sep := parent.keys[sepIndex]
+
+	merged := &node{id: left.id, leaf: left.leaf, next: InvalidPageID}
+	merged.keys = append(append(merged.keys, left.keys...), right.keys...)
+	if left.leaf {
+		merged.values = append(append(merged.values, left.values...), right.values...)
+		merged.next = right.next
+	} else {
+		merged.keys = insertAt(merged.keys, len(left.keys), sep)
+		merged.children = append(append(merged.children, left.children...), right.children...)
+	}
+	if merged.size() <= PageSize {
+		if err = t.writeNode(ctx, merged); err != nil {
+			return err
+		}
+		if err = t.pool.DeletePage(ctx, right.id); err != nil {
+			return err
+		}
+		parent.keys = removeAt(parent.keys, sepIndex)
+		parent.children = removeAt(parent.children, sepIndex+1)
+		return nil
+	}
+
+	// 合并后放不下：以合并结果为整体重新切成两半，写回原来的两页。
+	k := merged.splitPoint(1)
+	left.keys, right.keys = nil, nil
+	if merged.leaf {
+		left.keys = append(left.keys, merged.keys[:k]...)
+		left.values = append(left.values[:0:0], merged.values[:k]...)
+		right.keys = append(right.keys, merged.keys[k:]...)
+		right.values = append(right.values[:0:0], merged.values[k:]...)
+		parent.keys[sepIndex] = right.keys[0]
+	} else {
+		k = min(k, len(merged.keys)-2)
+		left.keys = append(left.keys, merged.keys[:k]...)
+		left.children = append(left.children[:0:0], merged.children[:k+1]...)
+		right.keys = append(right.keys, merged.keys[k+1:]...)
+		right.children = append(right.children[:0:0], merged.children[k+1:]...)
+		parent.keys[sepIndex] = merged.keys[k]
+	}
+	if err = t.writeNode(ctx, left); err != nil {
+		return err
+	}
+	return t.writeNode(ctx, right)
+}
+
+func (t *BPlusTree) newNode(ctx context.Context, leaf bool) (*node, error) {
+	page, err := t.pool.NewPage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.pool.UnpinPage(ctx, page.ID, true); err != nil {
+		return nil, err
+	}
+	n := &node{id: page.ID, leaf: leaf, next: InvalidPageID}
+	if !leaf {
+		n.children = []PageID{}
+	}
+	return n, nil
+}
+
+func (t *BPlusTree) readNode(ctx context.Context, id PageID) (*node, error) {
+	page, err := t.pool.FetchPage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeNode(page)
+	if unpinErr := t.pool.UnpinPage(ctx, id, false); err == nil {
+		err = unpinErr
+	}
+	return n, err
+}
+
+func (t *BPlusTree) writeNode(ctx context.Context, n *node) error {
+	page, err := t.pool.FetchPage(ctx, n.id)
+	if err != nil {
+		return err
+	}
+	err = encodeNode(n, page)
+	if unpinErr := t.pool.UnpinPage(ctx, n.id, true); err == nil {
+		err = unpinErr
+	}
+	return err
+}
+
+func (t *BPlusTree) writeMeta(ctx context.Context) error {
+	page, err := t.pool.FetchPage(ctx, t.metaID)
+	if err != nil {
+		return err
+	}
+	copy(page.Data[:4], bplusTreeMagic)
+	binary.LittleEndian.PutUint32(page.Data[4:], uint32(t.root))
+	binary.LittleEndian.PutUint64(page.Data[8:], t.count)
+	return t.pool.UnpinPage(ctx, t.metaID, true)
+}
+
+// storeValue 短值内联，长值写入溢出页链。
+func (t *BPlusTree) storeValue(ctx context.Context, value []byte) (leafValue, error) {
+	if len(value) <= maxInlineValue {
+		return leafValue{inline: bytes.Clone(value), overflow: InvalidPageID, length: uint32(len(value))}, nil
+	}
+	// 从尾部向前写，每页都能直接记录下一页的页号。
+	next := InvalidPageID
+	for end := len(value); end > 0; {
+		start := (end - 1) / overflowCapacity * overflowCapacity
+		page, err := t.pool.NewPage(ctx)
+		if err != nil {
+			return leafValue{}, err
+		}
+		clear(page.Data[:])
+		binary.LittleEndian.PutUint32(page.Data[0:], uint32(next))
+		binary.LittleEndian.PutUint16(page.Data[4:], uint16(end-start))
+		copy(page.Data[overflowHeaderSize:], value[start:end])
+		next = page.ID
+		if err = t.pool.UnpinPage(ctx, page.ID, true); err != nil {
+			return leafValue{}, err
+		}
+		end = start
+	}
+	return leafValue{overflow: next, length: uint32(len(value))}, nil
+}
+
+func (t *BPlusTree) loadValue(ctx context.Context, v leafValue) ([]byte, error) {
+	if v.overflow == InvalidPageID {
+		return bytes.Clone(v.inline), nil
+	}
+	value := make([]byte, 0, v.length)
+	for id := v.overflow; id != InvalidPageID; {
+		page, err := t.pool.FetchPage(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		used := int(binary.LittleEndian.Uint16(page.Data[4:]))
+		next := PageID(binary.LittleEndian.Uint32(page.Data[0:]))
+		if used > overflowCapacity {
+			_ = t.pool.UnpinPage(ctx, id, false)
+			return nil, ErrCorruptPage
+		}
+		value = append(value, page.Data[overflowHeaderSize:overflowHeaderSize+used]...)
+		if err = t.pool.UnpinPage(ctx, id, false); err != nil {
+			return nil, err
+		}
+		id = next
+	}
+	if len(value) != int(v.length) {
+		return nil, ErrCorruptPage
+	}
+	return value, nil
+}
+
+func (t *BPlusTree) freeValue(ctx context.Context, v leafValue) error {
+	for id := v.overflow; id != InvalidPageID; {
+		page, err := t.pool.FetchPage(ctx, id)
+		if err != nil {
+			return err
+		}
+		next := PageID(binary.LittleEndian.Uint32(page.Data[0:]))
+		if err = t.pool.UnpinPage(ctx, id, false); err != nil {
+			return err
+		}
+		if err = t.pool.DeletePage(ctx, id); err != nil {
+			return err
+		}
+		id = next
+	}
+	return nil
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	s = append(s, v)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	return append(s[:i], s[i+1:]...)
 }
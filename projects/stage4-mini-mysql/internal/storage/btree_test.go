@@ -1,11 +1,58 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"path/filepath"
+	"sort"
 	"testing"
 )
 
+// pagerPool 直接读写 PageManager 的缓冲池（每次 unpin 脏页即写盘），用于在本包内测试持久化；
+// buffer.BufferPoolManager 依赖本包，不能在这里引用。
+type pagerPool struct {
+	pager PageManager
+	pages map[PageID]*Page
+}
+
+func newPagerPool(pager PageManager) *pagerPool {
+	return &pagerPool{pager: pager, pages: make(map[PageID]*Page)}
+}
+
+func (p *pagerPool) FetchPage(ctx context.Context, id PageID) (*Page, error) {
+	page, err := p.pager.ReadPage(ctx, id)
+	if err == nil {
+		p.pages[id] = page
+	}
+	return page, err
+}
+
+func (p *pagerPool) NewPage(ctx context.Context) (*Page, error) {
+	id, err := p.pager.AllocatePage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{ID: id}
+	p.pages[id] = page
+	return page, nil
+}
+
+func (p *pagerPool) UnpinPage(ctx context.Context, id PageID, isDirty bool) error {
+	page := p.pages[id]
+	delete(p.pages, id)
+	if !isDirty || page == nil {
+		return nil
+	}
+	return p.pager.WritePage(ctx, page)
+}
+
+func (p *pagerPool) DeletePage(ctx context.Context, id PageID) error {
+	return p.pager.FreePage(ctx, id)
+}
+
 func TestBPlusTreeCRUDAndRange(t *testing.T) {
 	pager, err := NewFilePageManager(filepath.Join(t.TempDir(), "btree.db"))
 	if err != nil {
@@ -15,8 +62,11 @@ func TestBPlusTreeCRUDAndRange(t *testing.T) {
 		_ = pager.Close()
 	}()
 
-	tree := NewBPlusTree(16, pager)
 	ctx := context.Background()
+	tree, err := NewBPlusTree(ctx, newPagerPool(pager))
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
 	if err = tree.Insert(ctx, []byte("a"), []byte("1")); err != nil {
 		t.Fatalf("Insert(a) error = %v", err)
 	}
@@ -52,9 +102,245 @@ func TestBPlusTreeCRUDAndRange(t *testing.T) {
 	}
 }
 
+// checkTree 校验树的结构：各节点装得进一页、键有序且落在父节点分隔键的范围内、非根节点不为空、
+// 所有叶子深度相同、叶子链表按序串起全部叶子，并返回树中全部键。
+func checkTree(t *testing.T, tree *BPlusTree) [][]byte {
+	t.Helper()
+	ctx := context.Background()
+	var leaves []PageID
+	var keys [][]byte
+	leafDepth := -1
+	var walk func(id PageID, lo, hi []byte, depth int)
+	walk = func(id PageID, lo, hi []byte, depth int) {
+		n, err := tree.readNode(ctx, id)
+		if err != nil {
+			t.Fatalf("readNode(%d) error = %v", id, err)
+		}
+		if n.size() > PageSize {
+			t.Fatalf("node %d size %d exceeds page", id, n.size())
+		}
+		if id != tree.root && len(n.keys) == 0 {
+			t.Fatalf("non-root node %d is empty", id)
+		}
+		for i, key := range n.keys {
+			if i > 0 && bytes.Compare(n.keys[i-1], key) >= 0 {
+				t.Fatalf("node %d keys out of order", id)
+			}
+			if (lo != nil && bytes.Compare(key, lo) < 0) || (hi != nil && bytes.Compare(key, hi) >= 0) {
+				t.Fatalf("node %d key %q outside [%q, %q)", id, key, lo, hi)
+			}
+		}
+		if n.leaf {
+			if leafDepth >= 0 && depth != leafDepth {
+				t.Fatalf("leaf %d at depth %d, want %d", id, depth, leafDepth)
+			}
+			leafDepth = depth
+			leaves = append(leaves, id)
+			keys = append(keys, n.keys...)
+			return
+		}
+		if len(n.children) != len(n.keys)+1 {
+			t.Fatalf("internal node %d has %d keys and %d children", id, len(n.keys), len(n.children))
+		}
+		for i, child := range n.children {
+			childLo, childHi := lo, hi
+			if i > 0 {
+				childLo = n.keys[i-1]
+			}
+			if i < len(n.keys) {
+				childHi = n.keys[i]
+			}
+			walk(child, childLo, childHi, depth+1)
+		}
+	}
+	walk(tree.root, nil, nil, 0)
+
+	for i, id := range leaves {
+		n, _ := tree.readNode(ctx, id)
+		want := InvalidPageID
+		if i+1 < len(leaves) {
+			want = leaves[i+1]
+		}
+		if n.next != want {
+			t.Fatalf("leaf %d next = %d, want %d", id, n.next, want)
+		}
+	}
+	if uint64(len(keys)) != tree.count {
+		t.Fatalf("tree has %d keys, count = %d", len(keys), tree.count)
+	}
+	return keys
+}
+
+func TestBPlusTreeMatchesModel(t *testing.T) {
+	ctx := context.Background()
+	pool := newMemoryPool()
+	tree, err := NewBPlusTree(ctx, pool)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	model := make(map[string][]byte)
+	randomKey := func() []byte {
+		// 键长从几字节到 MaxKeySize 不等，覆盖按字节数分裂与重分配的各种情况。
+		key := fmt.Sprintf("k%05d", rng.IntN(3000))
+		if rng.IntN(10) == 0 {
+			key += string(bytes.Repeat([]byte{'x'}, rng.IntN(MaxKeySize-len(key))))
+		}
+		return []byte(key)
+	}
+	randomValue := func() []byte {
+		size := rng.IntN(64)
+		if rng.IntN(20) == 0 {
+			size = maxInlineValue + rng.IntN(3*PageSize)
+		}
+		value := make([]byte, size)
+		for i := range value {
+			value[i] = byte(rng.IntN(256))
+		}
+		return value
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4000; i++ {
+			key := randomKey()
+			if rng.IntN(3) == 0 {
+				err := tree.Delete(ctx, key)
+				if _, ok := model[string(key)]; ok != (err == nil) {
+					t.Fatalf("Delete(%q) error = %v, present = %v", key, err, ok)
+				}
+				delete(model, string(key))
+				continue
+			}
+			value := randomValue()
+			if err := tree.Insert(ctx, key, value); err != nil {
+				t.Fatalf("Insert(%q) error = %v", key, err)
+			}
+			model[string(key)] = value
+		}
+		keys := checkTree(t, tree)
+		want := make([]string, 0, len(model))
+		for key := range model {
+			want = append(want, key)
+		}
+		sort.Strings(want)
+		if len(keys) != len(want) {
+			t.Fatalf("round %d: tree has %d keys, model %d", round, len(keys), len(want))
+		}
+		it, err := tree.RangeScan(ctx, nil, nil)
+		if err != nil {
+			t.Fatalf("RangeScan() error = %v", err)
+		}
+		i := 0
+		for it.Next() {
+			item := it.Item()
+			if string(item.Key) != want[i] || !bytes.Equal(item.Value, model[want[i]]) {
+				t.Fatalf("round %d: scan item %d = %q, want %q", round, i, item.Key, want[i])
+			}
+			i++
+		}
+		if it.Err() != nil || i != len(want) {
+			t.Fatalf("round %d: scanned %d items (err %v), want %d", round, i, it.Err(), len(want))
+		}
+	}
+
+	// 删除全部键后只剩元数据页与空的根叶子，溢出页与合并掉的节点页都已回收。
+	for key := range model {
+		if err := tree.Delete(ctx, []byte(key)); err != nil {
+			t.Fatalf("Delete(%q) error = %v", key, err)
+		}
+	}
+	checkTree(t, tree)
+	if tree.Len() != 0 || len(pool.pages) != 2 {
+		t.Fatalf("after deleting everything: Len() = %d, %d pages in use", tree.Len(), len(pool.pages))
+	}
+	if err := tree.Insert(ctx, bytes.Repeat([]byte{'k'}, MaxKeySize+1), nil); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("Insert(oversized key) error = %v", err)
+	}
+}
+
+func TestBPlusTreeReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reopen.db")
+	pager, err := NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	ctx := context.Background()
+	tree, err := NewBPlusTree(ctx, newPagerPool(pager))
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
+	big := bytes.Repeat([]byte("overflow"), 1000)
+	for i := 0; i < 2000; i++ {
+		if err = tree.Insert(ctx, []byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	if err = tree.Insert(ctx, []byte("big"), big); err != nil {
+		t.Fatalf("Insert(big) error = %v", err)
+	}
+	metaID := tree.MetaPageID()
+	_ = pager.Close()
+
+	if pager, err = NewFilePageManager(path); err != nil {
+		t.Fatalf("NewFilePageManager() reopen error = %v", err)
+	}
+	defer func() { _ = pager.Close() }()
+	if _, err = OpenBPlusTree(ctx, newPagerPool(pager), metaID+1); !errors.Is(err, ErrNotBPlusTree) {
+		t.Fatalf("OpenBPlusTree(non-meta page) error = %v", err)
+	}
+	reopened, err := OpenBPlusTree(ctx, newPagerPool(pager), metaID)
+	if err != nil {
+		t.Fatalf("OpenBPlusTree() error = %v", err)
+	}
+	if reopened.Len() != 2001 {
+		t.Fatalf("Len() after reopen = %d, want 2001", reopened.Len())
+	}
+	checkTree(t, reopened)
+	if value, err := reopened.Search(ctx, []byte("key-1234")); err != nil || string(value) != "value-1234" {
+		t.Fatalf("Search(key-1234) = (%q, %v)", value, err)
+	}
+	if value, err := reopened.Search(ctx, []byte("big")); err != nil || !bytes.Equal(value, big) {
+		t.Fatalf("Search(big) = (%d bytes, %v)", len(value), err)
+	}
+}
+
+func TestBPlusTreeScanWithConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	tree, err := NewBPlusTree(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
+	for i := 0; i < 1000; i += 2 {
+		_ = tree.Insert(ctx, []byte(fmt.Sprintf("%04d", i)), []byte("v"))
+	}
+	it, err := tree.RangeScan(ctx, []byte("0100"), []byte("0899"))
+	if err != nil {
+		t.Fatalf("RangeScan() error = %v", err)
+	}
+	var prev []byte
+	seen := 0
+	for it.Next() {
+		key := it.Item().Key
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			t.Fatalf("scan returned %q after %q", key, prev)
+		}
+		prev = key
+		seen++
+		// 扫描过程中在已扫描与未扫描区域都写入，迭代器应重新定位而不重复或乱序。
+		_ = tree.Insert(ctx, []byte(fmt.Sprintf("%04d", seen*7%1000)), []byte("new"))
+		_ = tree.Delete(ctx, []byte(fmt.Sprintf("%04d", (seen*13+1)%1000)))
+	}
+	if it.Err() != nil || seen < 300 || string(prev) > "0899" {
+		t.Fatalf("scan saw %d keys, last %q, err %v", seen, prev, it.Err())
+	}
+}
+
 func BenchmarkBPlusTreeInsert(b *testing.B) {
-	tree := NewBPlusTree(16, nil)
 	ctx := context.Background()
+	tree, err := NewBPlusTree(ctx, nil)
+	if err != nil {
+		b.Fatalf("NewBPlusTree() error = %v", err)
+	}
 	for i := 0; i < b.N; i++ {
 		key := []byte{byte(i), byte(i >> 8), byte(i >> 16)}
 		if err := tree.Insert(ctx, key, key); err != nil {
@@ -62,3 +348,56 @@ func BenchmarkBPlusTreeInsert(b *testing.B) {
 		}
 	}
 }
+
+func TestBPlusTreeLongKeysRebalanceInternalNodes(t *testing.T) {
+	ctx := context.Background()
+	tree, err := NewBPlusTree(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
+	// 接近 MaxKeySize 的键使内部节点每页只能容纳几个分隔键；按区间删除让某个内部节点变空而兄弟仍较满，触发内部节点重分配。
+	key := func(i int) []byte {
+		return append([]byte(fmt.Sprintf("%05d", i)), bytes.Repeat([]byte{'x'}, MaxKeySize-5)...)
+	}
+	const n = 2000
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, i := range rng.Perm(n) {
+		if err = tree.Insert(ctx, key(i), []byte{byte(i)}); err != nil {
+			t.Fatalf("Insert(%d) error = %v", i, err)
+		}
+	}
+	checkTree(t, tree)
+	remaining := n
+	for _, r := range [][2]int{{100, 400}, {1500, 1900}, {0, 100}, {600, 1400}} {
+		for i := r[0]; i < r[1]; i++ {
+			if err = tree.Delete(ctx, key(i)); err != nil {
+				t.Fatalf("Delete(%d) error = %v", i, err)
+			}
+			remaining--
+		}
+		if keys := checkTree(t, tree); len(keys) != remaining {
+			t.Fatalf("%d keys left, want %d", len(keys), remaining)
+		}
+	}
+}
+
+func TestBPlusTreeDestroyFreesAllPages(t *testing.T) {
+	ctx := context.Background()
+	pool := newMemoryPool()
+	tree, err := NewBPlusTree(ctx, pool)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
+	for i := 0; i < 500; i++ {
+		value := bytes.Repeat([]byte{byte(i)}, 10+i%3*maxInlineValue)
+		if err = tree.Insert(ctx, []byte(fmt.Sprintf("key-%04d", i)), value); err != nil {
+			t.Fatalf("Insert(%d) error = %v", i, err)
+		}
+	}
+	if err = tree.Destroy(ctx); err != nil {
+		t.Fatalf("Destroy() error = %v", err)
+	}
+	if len(pool.pages) != 0 {
+		t.Fatalf("%d pages still in use after Destroy()", len(pool.pages))
+	}
+}
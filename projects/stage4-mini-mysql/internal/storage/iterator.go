@@ -1,15 +1,31 @@
 package storage
 
+import (
+	"bytes"
+	"context"
+)
+
 // KeyValue 键值对。
 type KeyValue struct {
 	Key   []byte
 	Value []byte
 }
 
-// Iterator 范围扫描迭代器。
+// Iterator 范围扫描迭代器。由 NewIterator 创建时遍历给定的切片；由 BPlusTree.RangeScan 创建时每次读取一个叶子，
+// 树未被修改则沿右兄弟指针读下一叶子，否则从上次读到的最大键重新自根定位，因此扫描期间可以并发写入。
 type Iterator struct {
 	items []KeyValue
 	index int
+
+	tree      *BPlusTree
+	ctx       context.Context
+	end       []byte
+	from      []byte
+	inclusive bool
+	next      PageID
+	version   uint64
+	done      bool
+	err       error
 }
 
 // NewIterator 创建迭代器。
@@ -20,6 +36,10 @@ func NewIterator(items []KeyValue) *Iterator {
 // Next 移动到下一个元素。
 func (it *Iterator) Next() bool {
 	it.index++
+	for it.index >= len(it.items) && it.tree != nil && !it.done && it.err == nil {
+		it.items, it.index = it.items[:0], 0
+		it.err = it.refill()
+	}
 	return it.index >= 0 && it.index < len(it.items)
 }
 
@@ -30,3 +50,54 @@ func (it *Iterator) Item() KeyValue {
 	}
 	return it.items[it.index]
 }
+
+// Err 返回遍历过程中读取页失败等错误。
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) refill() error {
+	if err := it.ctx.Err(); err != nil {
+		return err
+	}
+	it.tree.mu.RLock()
+	defer it.tree.mu.RUnlock()
+	return it.loadLeafLocked()
+}
+
+// loadLeafLocked 读取下一个叶子中位于 (from, end] 的条目（首次读取包含 from），调用方需持有树的读锁。
+func (it *Iterator) loadLeafLocked() error {
+	t := it.tree
+	var leaf *node
+	var err error
+	if it.next != InvalidPageID && it.version == t.version {
+		leaf, err = t.readNode(it.ctx, it.next)
+	} else {
+		_, leaf, err = t.findLeaf(it.ctx, it.from)
+	}
+	if err != nil {
+		return err
+	}
+	it.version = t.version
+	for i, key := range leaf.keys {
+		c := bytes.Compare(key, it.from)
+		if c < 0 || (c == 0 && !it.inclusive) {
+			continue
+		}
+		if len(it.end) > 0 && bytes.Compare(key, it.end) > 0 {
+			it.done = true
+			return nil
+		}
+		value, err := t.loadValue(it.ctx, leaf.values[i])
+		if err != nil {
+			return err
+		}
+		it.items = append(it.items, KeyValue{Key: key, Value: value})
+	}
+	if n := len(leaf.keys); n > 0 && bytes.Compare(leaf.keys[n-1], it.from) >= 0 {
+		it.from, it.inclusive = leaf.keys[n-1], false
+	}
+	it.next = leaf.next
+	it.done = leaf.next == InvalidPageID
+	return nil
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// InvalidPageID 空页号，例如最右叶子的右兄弟。
+const InvalidPageID = PageID(math.MaxUint32)
+
+// MaxKeySize 键的最大字节数。限制键长使一页总能容纳多个条目，分裂或重分配后两半都装得进一页。
+const MaxKeySize = 512
+
+const (
+	nodeLeaf     = 1
+	nodeInternal = 2
+
+	// 节点页头：类型(1) + 键数(2) + 叶子的右兄弟页号或内部节点的最左子页号(4)。
+	nodeHeaderSize = 7
+	// 超过 maxInlineValue 的值写入溢出页链，叶子中只记录总长度与首个溢出页。
+	maxInlineValue = 512
+	// 溢出页头：下一溢出页号(4) + 本页数据长度(2)。
+	overflowHeaderSize = 6
+	overflowCapacity   = PageSize - overflowHeaderSize
+	// 非根节点编码后小于 minNodeSize 字节时与兄弟合并或重分配。
+	minNodeSize = PageSize / 4
+)
+
+var (
+	ErrKeyTooLarge  = errors.New("key too large")
+	ErrCorruptPage  = errors.New("corrupt b+tree page")
+	errNodeOverflow = errors.New("node does not fit in a page")
+)
+
+// leafValue 叶子中的值：内联保存，或 overflow 指向溢出页链。
+type leafValue struct {
+	inline   []byte
+	overflow PageID
+	length   uint32
+}
+
+func (v leafValue) size() int {
+	if v.overflow != InvalidPageID {
+		return 1 + 4 + 4
+	}
+	return 1 + 2 + len(v.inline)
+}
+
+// node 解码后的 B+Tree 节点。内部节点的 children 比 keys 多一个，children[i] 子树中的键 < keys[i] ≤ children[i+1] 子树中的键。
+type node struct {
+	id       PageID
+	leaf     bool
+	keys     [][]byte
+	values   []leafValue
+	children []PageID
+	next     PageID
+}
+
+func (n *node) entrySize(i int) int {
+	if n.leaf {
+		return 2 + len(n.keys[i]) + n.values[i].size()
+	}
+	return 2 + len(n.keys[i]) + 4
+}
+
+// size 节点编码后的字节数。
+func (n *node) size() int {
+	total := nodeHeaderSize
+	for i := range n.keys {
+		total += n.entrySize(i)
+	}
+	return total
+}
+
+// search 返回第一个 ≥ key 的位置以及该位置的键是否等于 key。
+func (n *node) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 })
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+// childIndex 返回内部节点中应包含 key 的子节点下标。
+func (n *node) childIndex(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) > 0 })
+}
+
+// splitPoint 返回使前 k 个条目约占一半字节数的 k，且保证两侧都至少留下 least 个条目。
+func (n *node) splitPoint(least int) int {
+	half := (n.size() - nodeHeaderSize) / 2
+	k, used := 0, 0
+	for k < len(n.keys) && used < half {
+		used += n.entrySize(k)
+		k++
+	}
+	return min(max(k, least), len(n.keys)-least)
+}
+
+func decodeNode(page *Page) (*node, error) {
+	data := page.Data[:]
+	n := &node{id: page.ID}
+	switch data[0] {
+	case nodeLeaf:
+		n.leaf = true
+	case nodeInternal:
+	default:
+		return nil, ErrCorruptPage
+	}
+	count := int(binary.LittleEndian.Uint16(data[1:]))
+	link := PageID(binary.LittleEndian.Uint32(data[3:]))
+	if n.leaf {
+		n.next = link
+		n.values = make([]leafValue, 0, count)
+	} else {
+		n.children = append(make([]PageID, 0, count+1), link)
+	}
+	n.keys = make([][]byte, 0, count)
+	off := nodeHeaderSize
+	read := func(size int) ([]byte, bool) {
+		if off+size > PageSize {
+			return nil, false
+		}
+		b := data[off : off+size]
+		off += size
+		return b, true
+	}
+	for i := 0; i < count; i++ {
+		raw, ok := read(2)
+		if !ok {
+			return nil, ErrCorruptPage
+		}
+		key, ok := read(int(binary.LittleEndian.Uint16(raw)))
+		if !ok {
+			return nil, ErrCorruptPage
+		}
+		n.keys = append(n.keys, bytes.Clone(key))
+		if !n.leaf {
+			raw, ok = read(4)
+			if !ok {
+				return nil, ErrCorruptPage
+			}
+			n.children = append(n.children, PageID(binary.LittleEndian.Uint32(raw)))
+			continue
+		}
+		flag, ok := read(1)
+		if !ok {
+			return nil, ErrCorruptPage
+		}
+		value := leafValue{overflow: InvalidPageID}
+		if flag[0] == 1 {
+			raw, ok = read(8)
+			if !ok {
+				return nil, ErrCorruptPage
+			}
+			value.length = binary.LittleEndian.Uint32(raw)
+			value.overflow = PageID(binary.LittleEndian.Uint32(raw[4:]))
+		} else {
+			if raw, ok = read(2); !ok {
+				return nil, ErrCorruptPage
+			}
+			inline, ok := read(int(binary.LittleEndian.Uint16(raw)))
+			if !ok {
+				return nil, ErrCorruptPage
+			}
+			value.inline = bytes.Clone(inline)
+			value.length = uint32(len(inline))
+		}
+		n.values = append(n.values, value)
+	}
+	return n, nil
+}
+
+func encodeNode(n *node, page *Page) error {
+	if n.size() > PageSize {
+		return errNodeOverflow
+	}
+	data := page.Data[:]
+	clear(data)
+	link := n.next
+	data[0] = nodeLeaf
+	if !n.leaf {
+		data[0] = nodeInternal
+		link = n.children[0]
+	}
+	binary.LittleEndian.PutUint16(data[1:], uint16(len(n.keys)))
+	binary.LittleEndian.PutUint32(data[3:], uint32(link))
+	off := nodeHeaderSize
+	for i, key := range n.keys {
+		binary.LittleEndian.PutUint16(data[off:], uint16(len(key)))
+		off += 2
+		off += copy(data[off:], key)
+		if !n.leaf {
+			binary.LittleEndian.PutUint32(data[off:], uint32(n.children[i+1]))
+			off += 4
+			continue
+		}
+		value := n.values[i]
+		if value.overflow != InvalidPageID {
+			data[off] = 1
+			binary.LittleEndian.PutUint32(data[off+1:], value.length)
+			binary.LittleEndian.PutUint32(data[off+5:], uint32(value.overflow))
+			off += 9
+			continue
+		}
+		data[off] = 0
+		binary.LittleEndian.PutUint16(data[off+1:], uint16(len(value.inline)))
+		off += 3
+		off += copy(data[off:], value.inline)
+	}
+	return nil
+}
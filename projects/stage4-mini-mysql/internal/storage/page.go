@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -33,12 +34,19 @@ var (
 	ErrPageNotFound = errors.New("page not found")
 )
 
+// freePageMagic 空闲页标记，Close 时写在空闲页开头，重新打开时据此恢复空闲链表。
+// 8 字节标记不会与其他页开头混淆：节点页首字节为节点类型，溢出页第 5~6 字节的数据长度不超过一页。
+var freePageMagic = []byte("FREEPAGE")
+
 // FilePageManager 基于文件的页管理器。
 type FilePageManager struct {
 	mu         sync.Mutex
 	file       *os.File
 	nextPageID PageID
-	freeList   []PageID
+	// freeList 回收的页。运行期间只记在内存里，正常 Close 时才给这些页写上 freePageMagic：
+	// 若在 FreePage 时立即落盘，引用该页的父节点可能尚未刷盘，崩溃后会出现仍被引用却被标记为空闲的页。
+	// 因此崩溃时本次运行回收的页会泄漏（不会被重用），但不会破坏数据。
+	freeList []PageID
 }
 
 // NewFilePageManager 创建文件页管理器。
@@ -52,15 +60,40 @@ func NewFilePageManager(path string) (*FilePageManager, error) {
 		_ = file.Close()
 		return nil, err
 	}
-	next := PageID(stat.Size() / PageSize)
-	return &FilePageManager{file: file, nextPageID: next}, nil
+	m := &FilePageManager{file: file, nextPageID: PageID(stat.Size() / PageSize)}
+	if err = m.loadFreeList(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadFreeList 扫描数据文件，把带 freePageMagic 的页恢复到空闲链表。
+func (m *FilePageManager) loadFreeList() error {
+	buf := make([]byte, len(freePageMagic))
+	for id := PageID(0); id < m.nextPageID; id++ {
+		if _, err := m.file.ReadAt(buf, int64(id)*PageSize); err != nil {
+			return err
+		}
+		if bytes.Equal(buf, freePageMagic) {
+			m.freeList = append(m.freeList, id)
+		}
+	}
+	return nil
 }
 
-// Close 关闭底层文件。
+// Close 给空闲链表中的页写上 freePageMagic 后关闭底层文件，调用方需先把缓冲池中的脏页刷盘。
 func (m *FilePageManager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.file.Close()
+	var markErr error
+	for _, id := range m.freeList {
+		if _, err := m.file.WriteAt(freePageMagic, int64(id)*PageSize); err != nil {
+			markErr = err
+			break
+		}
+	}
+	return errors.Join(markErr, m.file.Close())
 }
 
 // ReadPage 读取指定页。
@@ -113,7 +146,7 @@ func (m *FilePageManager) WritePage(ctx context.Context, page *Page) error {
 	return nil
 }
 
-// AllocatePage 分配新页。
+// AllocatePage 分配新页，优先复用空闲页。复用时先把该页清零落盘，擦掉可能残留的 freePageMagic。
 func (m *FilePageManager) AllocatePage(ctx context.Context) (PageID, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -126,6 +159,9 @@ func (m *FilePageManager) AllocatePage(ctx context.Context) (PageID, error) {
 	defer m.mu.Unlock()
 	if len(m.freeList) > 0 {
 		id := m.freeList[len(m.freeList)-1]
+		if _, err := m.file.WriteAt(make([]byte, PageSize), int64(id)*PageSize); err != nil {
+			return 0, err
+		}
 		m.freeList = m.freeList[:len(m.freeList)-1]
 		return id, nil
 	}
@@ -134,7 +170,7 @@ func (m *FilePageManager) AllocatePage(ctx context.Context) (PageID, error) {
 	return id, nil
 }
 
-// FreePage 回收页。
+// FreePage 回收页，页号在 Close 时才持久化（见 freeList）。
 func (m *FilePageManager) FreePage(ctx context.Context, id PageID) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -35,6 +35,69 @@ func TestFilePageManagerReadWrite(t *testing.T) {
 	}
 }
 
+func TestFilePageManagerFreeListSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "free.db")
+	pager, err := NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		pageID, allocErr := pager.AllocatePage(ctx)
+		if allocErr != nil {
+			t.Fatalf("AllocatePage() error = %v", allocErr)
+		}
+		page := &Page{ID: pageID}
+		copy(page.Data[:], []byte("data"))
+		if err = pager.WritePage(ctx, page); err != nil {
+			t.Fatalf("WritePage() error = %v", err)
+		}
+	}
+	if err = pager.FreePage(ctx, 1); err != nil {
+		t.Fatalf("FreePage() error = %v", err)
+	}
+	if err = pager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	pager, err = NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	pageID, err := pager.AllocatePage(ctx)
+	if err != nil {
+		t.Fatalf("AllocatePage() error = %v", err)
+	}
+	if pageID != 1 {
+		t.Fatalf("AllocatePage() after reopen = %d, want freed page 1", pageID)
+	}
+	page, err := pager.ReadPage(ctx, pageID)
+	if err != nil {
+		t.Fatalf("ReadPage() error = %v", err)
+	}
+	if page.Data != ([PageSize]byte{}) {
+		t.Fatalf("reused page is not zeroed")
+	}
+	if err = pager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// 复用过的页不再是空闲页，再次打开后应分配新页。
+	pager, err = NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	defer func() {
+		_ = pager.Close()
+	}()
+	if pageID, err = pager.AllocatePage(ctx); err != nil {
+		t.Fatalf("AllocatePage() error = %v", err)
+	}
+	if pageID != 3 {
+		t.Fatalf("AllocatePage() = %d, want new page 3", pageID)
+	}
+}
+
 func BenchmarkPageWrite(b *testing.B) {
 	path := filepath.Join(b.TempDir(), "bench.db")
 	pager, err := NewFilePageManager(path)
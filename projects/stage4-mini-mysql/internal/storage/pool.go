@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// BufferPool B+Tree 通过它获取与 pin 页，由 buffer.BufferPoolManager 实现。
+// FetchPage / NewPage 返回的页已被 pin，使用后需 UnpinPage。
+type BufferPool interface {
+	FetchPage(ctx context.Context, id PageID) (*Page, error)
+	NewPage(ctx context.Context) (*Page, error)
+	UnpinPage(ctx context.Context, id PageID, isDirty bool) error
+	DeletePage(ctx context.Context, id PageID) error
+}
+
+// memoryPool 纯内存页池，B+Tree 未指定缓冲池时使用，页不落盘。
+type memoryPool struct {
+	mu       sync.Mutex
+	pages    map[PageID]*Page
+	nextID   PageID
+	freeList []PageID
+}
+
+// NewMemoryPool 创建纯内存页池。多棵树共享同一个内存页池时页号互不冲突。
+func NewMemoryPool() BufferPool {
+	return newMemoryPool()
+}
+
+func newMemoryPool() *memoryPool {
+	return &memoryPool{pages: make(map[PageID]*Page)}
+}
+
+func (p *memoryPool) FetchPage(ctx context.Context, id PageID) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	page, ok := p.pages[id]
+	if !ok {
+		return nil, ErrPageNotFound
+	}
+	return page, nil
+}
+
+func (p *memoryPool) NewPage(ctx context.Context) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID
+	if len(p.freeList) > 0 {
+		id = p.freeList[len(p.freeList)-1]
+		p.freeList = p.freeList[:len(p.freeList)-1]
+	} else {
+		p.nextID++
+	}
+	page := &Page{ID: id}
+	p.pages[id] = page
+	return page, nil
+}
+
+func (p *memoryPool) UnpinPage(ctx context.Context, id PageID, isDirty bool) error {
+	return nil
+}
+
+func (p *memoryPool) DeletePage(ctx context.Context, id PageID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pages[id]; !ok {
+		return ErrPageNotFound
+	}
+	delete(p.pages, id)
+	p.freeList = append(p.freeList, id)
+	return nil
+}
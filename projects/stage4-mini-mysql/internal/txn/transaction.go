@@ -1,6 +1,9 @@
 package txn
 
-import "github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/wal"
+import (
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/wal"
+)
 
 type State uint8
 
@@ -12,6 +15,7 @@ const (
 
 // WriteRecord 事务写集。
 type WriteRecord struct {
+	Tree     *storage.BPlusTree
 	Key      []byte
 	OldValue []byte
 	NewValue []byte
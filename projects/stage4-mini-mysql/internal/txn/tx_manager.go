@@ -3,6 +3,7 @@ package txn
 import (
 	"context"
 	"errors"
+	"strconv"
 	"sync"
 
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
@@ -11,18 +12,22 @@ import (
 
 var ErrTxNotActive = errors.New("transaction is not active")
 
-// Manager 事务管理器。
+// Manager 事务管理器。写集记录目标表的 B+Tree，提交时依次应用，日志记录的 PageID 为该树的元数据页号。
 type Manager struct {
 	mu       sync.Mutex
 	nextTxID wal.TxID
 	wal      *wal.Writer
-	tree     *storage.BPlusTree
 	lockMgr  *LockManager
 }
 
 // NewManager 创建事务管理器。
-func NewManager(walWriter *wal.Writer, tree *storage.BPlusTree) *Manager {
-	return &Manager{nextTxID: 1, wal: walWriter, tree: tree, lockMgr: NewLockManager()}
+func NewManager(walWriter *wal.Writer) *Manager {
+	return &Manager{nextTxID: 1, wal: walWriter, lockMgr: NewLockManager()}
+}
+
+// lockName 行锁名：不同表的相同键互不冲突。
+func lockName(tree *storage.BPlusTree, key []byte) string {
+	return strconv.FormatUint(uint64(tree.MetaPageID()), 10) + "/" + string(key)
 }
 
 // Begin 开启事务。
@@ -47,8 +52,8 @@ func (m *Manager) Begin(ctx context.Context) (*Transaction, error) {
 	return tx, nil
 }
 
-// Put 在事务内写入 key。
-func (m *Manager) Put(ctx context.Context, tx *Transaction, key, value []byte) error {
+// Put 在事务内向 tree 写入 key。
+func (m *Manager) Put(ctx context.Context, tx *Transaction, tree *storage.BPlusTree, key, value []byte) error {
 	if tx == nil || tx.State != Active {
 		return ErrTxNotActive
 	}
@@ -59,18 +64,19 @@ func (m *Manager) Put(ctx context.Context, tx *Transaction, key, value []byte) e
 		return err
 	}
 
-	if err := m.lockMgr.LockKey(ctx, string(key)); err != nil {
+	name := lockName(tree, key)
+	if err := m.lockMgr.LockKey(ctx, name); err != nil {
 		return err
 	}
-	defer m.lockMgr.UnlockKey(string(key))
+	defer m.lockMgr.UnlockKey(name)
 
-	oldValue, _ := m.tree.Search(ctx, key)
-	tx.WriteSets = append(tx.WriteSets, WriteRecord{Key: append([]byte(nil), key...), OldValue: oldValue, NewValue: append([]byte(nil), value...), Type: wal.LogInsert})
+	oldValue, _ := tree.Search(ctx, key)
+	tx.WriteSets = append(tx.WriteSets, WriteRecord{Tree: tree, Key: append([]byte(nil), key...), OldValue: oldValue, NewValue: append([]byte(nil), value...), Type: wal.LogInsert})
 	return nil
 }
 
-// Delete 在事务内删除 key。
-func (m *Manager) Delete(ctx context.Context, tx *Transaction, key []byte) error {
+// Delete 在事务内从 tree 删除 key。
+func (m *Manager) Delete(ctx context.Context, tx *Transaction, tree *storage.BPlusTree, key []byte) error {
 	if tx == nil || tx.State != Active {
 		return ErrTxNotActive
 	}
@@ -81,13 +87,14 @@ func (m *Manager) Delete(ctx context.Context, tx *Transaction, key []byte) error
 		return err
 	}
 
-	if err := m.lockMgr.LockKey(ctx, string(key)); err != nil {
+	name := lockName(tree, key)
+	if err := m.lockMgr.LockKey(ctx, name); err != nil {
 		return err
 	}
-	defer m.lockMgr.UnlockKey(string(key))
+	defer m.lockMgr.UnlockKey(name)
 
-	oldValue, _ := m.tree.Search(ctx, key)
-	tx.WriteSets = append(tx.WriteSets, WriteRecord{Key: append([]byte(nil), key...), OldValue: oldValue, Type: wal.LogDelete})
+	oldValue, _ := tree.Search(ctx, key)
+	tx.WriteSets = append(tx.WriteSets, WriteRecord{Tree: tree, Key: append([]byte(nil), key...), OldValue: oldValue, Type: wal.LogDelete})
 	return nil
 }
 
@@ -104,19 +111,20 @@ func (m *Manager) Commit(ctx context.Context, tx *Transaction) error {
 	}
 
 	for _, writeSet := range tx.WriteSets {
-		if err := m.lockMgr.LockKey(ctx, string(writeSet.Key)); err != nil {
+		name := lockName(writeSet.Tree, writeSet.Key)
+		if err := m.lockMgr.LockKey(ctx, name); err != nil {
 			return err
 		}
 		if writeSet.Type == wal.LogInsert {
-			if err := m.tree.Insert(ctx, writeSet.Key, writeSet.NewValue); err != nil {
-				m.lockMgr.UnlockKey(string(writeSet.Key))
+			if err := writeSet.Tree.Insert(ctx, writeSet.Key, writeSet.NewValue); err != nil {
+				m.lockMgr.UnlockKey(name)
 				return err
 			}
 		} else if writeSet.Type == wal.LogDelete {
-			_ = m.tree.Delete(ctx, writeSet.Key)
+			_ = writeSet.Tree.Delete(ctx, writeSet.Key)
 		}
-		_, err := m.wal.Append(ctx, &wal.LogRecord{TxID: tx.TxID, Type: writeSet.Type, OldValue: writeSet.Key, NewValue: writeSet.NewValue})
-		m.lockMgr.UnlockKey(string(writeSet.Key))
+		_, err := m.wal.Append(ctx, &wal.LogRecord{TxID: tx.TxID, Type: writeSet.Type, PageID: writeSet.Tree.MetaPageID(), OldValue: writeSet.Key, NewValue: writeSet.NewValue})
+		m.lockMgr.UnlockKey(name)
 		if err != nil {
 			return err
 		}
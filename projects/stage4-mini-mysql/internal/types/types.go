@@ -0,0 +1,89 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownType  = errors.New("unknown column type")
+	ErrTypeMismatch = errors.New("type mismatch")
+	ErrOutOfRange   = errors.New("value out of range")
+	ErrTooLong      = errors.New("value too long")
+	ErrNotNull      = errors.New("column cannot be null")
+)
+
+// Type 列类型。
+type Type uint8
+
+const (
+	TypeInt Type = iota + 1
+	TypeBigInt
+	TypeDouble
+	TypeVarchar
+	TypeText
+	TypeBool
+	TypeDatetime
+)
+
+var typeNames = map[Type]string{
+	TypeInt:      "INT",
+	TypeBigInt:   "BIGINT",
+	TypeDouble:   "DOUBLE",
+	TypeVarchar:  "VARCHAR",
+	TypeText:     "TEXT",
+	TypeBool:     "BOOL",
+	TypeDatetime: "DATETIME",
+}
+
+// typeAliases SQL 中的类型名到列类型，包含常见同义词。
+var typeAliases = map[string]Type{
+	"INT":      TypeInt,
+	"INTEGER":  TypeInt,
+	"BIGINT":   TypeBigInt,
+	"DOUBLE":   TypeDouble,
+	"FLOAT":    TypeDouble,
+	"REAL":     TypeDouble,
+	"VARCHAR":  TypeVarchar,
+	"TEXT":     TypeText,
+	"BOOL":     TypeBool,
+	"BOOLEAN":  TypeBool,
+	"DATETIME": TypeDatetime,
+}
+
+// ParseType 解析 SQL 类型名与长度参数，VARCHAR 必须指定长度，其他类型不接受长度。
+func ParseType(name string, length int) (Type, error) {
+	t, ok := typeAliases[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+	if t == TypeVarchar && length <= 0 {
+		return 0, fmt.Errorf("%w: VARCHAR requires a length", ErrUnknownType)
+	}
+	if t != TypeVarchar && length > 0 {
+		return 0, fmt.Errorf("%w: %s does not take a length", ErrUnknownType, name)
+	}
+	return t, nil
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Type(%d)", uint8(t))
+}
+
+// Format 返回带长度的类型名，例如 VARCHAR(64)。
+func (t Type) Format(length int) string {
+	if t == TypeVarchar {
+		return fmt.Sprintf("VARCHAR(%d)", length)
+	}
+	return t.String()
+}
+
+// Valid 报告 t 是否为已知类型。
+func (t Type) Valid() bool {
+	_, ok := typeNames[t]
+	return ok
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseType(t *testing.T) {
+	cases := []struct {
+		name   string
+		length int
+		want   Type
+		err    error
+	}{
+		{"int", 0, TypeInt, nil},
+		{"INTEGER", 0, TypeInt, nil},
+		{"bigint", 0, TypeBigInt, nil},
+		{"FLOAT", 0, TypeDouble, nil},
+		{"varchar", 20, TypeVarchar, nil},
+		{"boolean", 0, TypeBool, nil},
+		{"DATETIME", 0, TypeDatetime, nil},
+		{"VARCHAR", 0, 0, ErrUnknownType},
+		{"INT", 11, 0, ErrUnknownType},
+		{"BLOB", 0, 0, ErrUnknownType},
+	}
+	for _, tc := range cases {
+		got, err := ParseType(tc.name, tc.length)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Fatalf("ParseType(%q, %d) = (%v, %v), want (%v, %v)", tc.name, tc.length, got, err, tc.want, tc.err)
+		}
+	}
+	if got := TypeVarchar.Format(12); got != "VARCHAR(12)" {
+		t.Fatalf("Format() = %q", got)
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	cases := []struct {
+		value  Value
+		typ    Type
+		length int
+		want   string
+		err    error
+	}{
+		{NewInt(math.MaxInt32), TypeInt, 0, "2147483647", nil},
+		{NewInt(math.MaxInt32 + 1), TypeInt, 0, "", ErrOutOfRange},
+		{NewInt(math.MinInt64), TypeBigInt, 0, "-9223372036854775808", nil},
+		{NewBool(true), TypeInt, 0, "1", nil},
+		{NewFloat(1.5), TypeInt, 0, "", ErrTypeMismatch},
+		{NewInt(3), TypeDouble, 0, "3", nil},
+		{NewString("1.5"), TypeDouble, 0, "", ErrTypeMismatch},
+		{NewString("héllo"), TypeVarchar, 5, "héllo", nil},
+		{NewString("héllo!"), TypeVarchar, 5, "", ErrTooLong},
+		{NewInt(1), TypeText, 0, "", ErrTypeMismatch},
+		{NewInt(0), TypeBool, 0, "FALSE", nil},
+		{NewInt(2), TypeBool, 0, "", ErrTypeMismatch},
+		{NewString("2024-01-02 03:04:05"), TypeDatetime, 0, "2024-01-02 03:04:05", nil},
+		{NewString("2024-01-02"), TypeDatetime, 0, "2024-01-02 00:00:00", nil},
+		{NewString("yesterday"), TypeDatetime, 0, "", ErrTypeMismatch},
+		{Null(), TypeInt, 0, "NULL", nil},
+	}
+	for _, tc := range cases {
+		got, err := Coerce(tc.value, tc.typ, tc.length)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("Coerce(%v, %v) error = %v, want %v", tc.value, tc.typ, err, tc.err)
+		}
+		if err == nil && got.String() != tc.want {
+			t.Fatalf("Coerce(%v, %v) = %s, want %s", tc.value, tc.typ, got, tc.want)
+		}
+	}
+
+	ts := NewTime(time.Date(2024, 5, 6, 7, 8, 9, 1234567, time.FixedZone("X", 3600)))
+	if got := ts.String(); got != "2024-05-06 06:08:09.001234" {
+		t.Fatalf("NewTime().String() = %s", got)
+	}
+}
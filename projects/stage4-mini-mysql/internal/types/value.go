@@ -0,0 +1,212 @@
+package types
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// DatetimeLayout DATETIME 的文本格式。
+const DatetimeLayout = "2006-01-02 15:04:05"
+
+// Kind 值的运行时类型；INT 与 BIGINT 列的值都是 KindInt。
+type Kind uint8
+
+const (
+	KindNull Kind = iota
+	KindInt
+	KindFloat
+	KindString
+	KindBool
+	KindTime
+)
+
+// Value SQL 值，零值为 NULL。
+type Value struct {
+	Kind  Kind
+	Int   int64
+	Float float64
+	Str   string
+	Bool  bool
+	Time  time.Time
+}
+
+// Null 返回 NULL。
+func Null() Value { return Value{} }
+
+// NewInt 返回整数值。
+func NewInt(v int64) Value { return Value{Kind: KindInt, Int: v} }
+
+// NewFloat 返回浮点值。
+func NewFloat(v float64) Value { return Value{Kind: KindFloat, Float: v} }
+
+// NewString 返回字符串值。
+func NewString(v string) Value { return Value{Kind: KindString, Str: v} }
+
+// NewBool 返回布尔值。
+func NewBool(v bool) Value { return Value{Kind: KindBool, Bool: v} }
+
+// NewTime 返回时间值，统一为 UTC 并截断到微秒。
+func NewTime(v time.Time) Value {
+	return Value{Kind: KindTime, Time: v.UTC().Truncate(time.Microsecond)}
+}
+
+// IsNull 报告是否为 NULL。
+func (v Value) IsNull() bool { return v.Kind == KindNull }
+
+func (v Value) String() string {
+	switch v.Kind {
+	case KindInt:
+		return strconv.FormatInt(v.Int, 10)
+	case KindFloat:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case KindString:
+		return v.Str
+	case KindBool:
+		if v.Bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case KindTime:
+		if v.Time.Nanosecond() != 0 {
+			return v.Time.Format(DatetimeLayout + ".000000")
+		}
+		return v.Time.Format(DatetimeLayout)
+	default:
+		return "NULL"
+	}
+}
+
+var datetimeLayouts = []string{DatetimeLayout, DatetimeLayout + ".999999", "2006-01-02T15:04:05", "2006-01-02"}
+
+// Coerce 将 v 转换为可存入 t 列的值，length 为 VARCHAR 的最大字符数。
+// 转换是严格的：只允许不丢失信息的转换，例如整数存入 DOUBLE、0/1 存入 BOOL、日期文本存入 DATETIME。NULL 原样返回，可空性由调用方检查。
+func Coerce(v Value, t Type, length int) (Value, error) {
+	if v.IsNull() {
+		return v, nil
+	}
+	switch t {
+	case TypeInt, TypeBigInt:
+		switch v.Kind {
+		case KindInt:
+			if t == TypeInt && (v.Int < math.MinInt32 || v.Int > math.MaxInt32) {
+				return Value{}, fmt.Errorf("%w: %d for INT", ErrOutOfRange, v.Int)
+			}
+			return v, nil
+		case KindBool:
+			if v.Bool {
+				return NewInt(1), nil
+			}
+			return NewInt(0), nil
+		}
+	case TypeDouble:
+		switch v.Kind {
+		case KindFloat:
+			return v, nil
+		case KindInt:
+			return NewFloat(float64(v.Int)), nil
+		}
+	case TypeVarchar, TypeText:
+		if v.Kind == KindString {
+			if t == TypeVarchar && utf8.RuneCountInString(v.Str) > length {
+				return Value{}, fmt.Errorf("%w: %d characters for VARCHAR(%d)", ErrTooLong, utf8.RuneCountInString(v.Str), length)
+			}
+			return v, nil
+		}
+	case TypeBool:
+		switch {
+		case v.Kind == KindBool:
+			return v, nil
+		case v.Kind == KindInt && (v.Int == 0 || v.Int == 1):
+			return NewBool(v.Int == 1), nil
+		}
+	case TypeDatetime:
+		switch v.Kind {
+		case KindTime:
+			return v, nil
+		case KindString:
+			for _, layout := range datetimeLayouts {
+				if parsed, err := time.Parse(layout, v.Str); err == nil {
+					return NewTime(parsed), nil
+				}
+			}
+			return Value{}, fmt.Errorf("%w: invalid DATETIME %q", ErrTypeMismatch, v.Str)
+		}
+	}
+	return Value{}, fmt.Errorf("%w: cannot store %s in %s", ErrTypeMismatch, v.kindName(), t)
+}
+
+// Compare 比较两个非 NULL 值，返回 -1、0 或 1。整数、浮点数与布尔值按数值比较，字符串按字节比较，
+// DATETIME 可以与日期文本比较；其余不同类型的值不可比较，返回 ErrTypeMismatch。
+func Compare(a, b Value) (int, error) {
+	if a.IsNull() || b.IsNull() {
+		return 0, fmt.Errorf("%w: cannot compare NULL", ErrTypeMismatch)
+	}
+	if a.Kind == KindTime && b.Kind == KindString {
+		t, err := Coerce(b, TypeDatetime, 0)
+		if err != nil {
+			return 0, err
+		}
+		b = t
+	} else if a.Kind == KindString && b.Kind == KindTime {
+		c, err := Compare(b, a)
+		return -c, err
+	}
+	if a.Kind == b.Kind {
+		switch a.Kind {
+		case KindInt:
+			return cmp.Compare(a.Int, b.Int), nil
+		case KindFloat:
+			return cmp.Compare(a.Float, b.Float), nil
+		case KindString:
+			return cmp.Compare(a.Str, b.Str), nil
+		case KindTime:
+			return a.Time.Compare(b.Time), nil
+		}
+	}
+	x, okA := a.number()
+	y, okB := b.number()
+	if !okA || !okB {
+		return 0, fmt.Errorf("%w: cannot compare %s with %s", ErrTypeMismatch, a.kindName(), b.kindName())
+	}
+	if a.Kind != KindFloat && b.Kind != KindFloat {
+		return cmp.Compare(int64(x), int64(y)), nil
+	}
+	return cmp.Compare(x, y), nil
+}
+
+// number 返回整数、浮点数或布尔值（TRUE 为 1）的数值。
+func (v Value) number() (float64, bool) {
+	switch v.Kind {
+	case KindInt:
+		return float64(v.Int), true
+	case KindFloat:
+		return v.Float, true
+	case KindBool:
+		if v.Bool {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (v Value) kindName() string {
+	switch v.Kind {
+	case KindInt:
+		return "integer"
+	case KindFloat:
+		return "float"
+	case KindString:
+		return "string"
+	case KindBool:
+		return "boolean"
+	case KindTime:
+		return "datetime"
+	default:
+		return "NULL"
+	}
+}
@@ -1,18 +1,25 @@
 package test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"path/filepath"
 	"testing"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
 )
 
 func TestBTreeRangeWithManyKeys(t *testing.T) {
-	tree := storage.NewBPlusTree(32, nil)
 	ctx := context.Background()
+	tree, err := storage.NewBPlusTree(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
 	for i := 0; i < 100; i++ {
 		key := []byte{byte(i)}
-		if err := tree.Insert(ctx, key, key); err != nil {
+		if err = tree.Insert(ctx, key, key); err != nil {
 			t.Fatalf("Insert() error = %v", err)
 		}
 	}
@@ -29,3 +36,75 @@ func TestBTreeRangeWithManyKeys(t *testing.T) {
 		t.Fatalf("count = %d, want 11", count)
 	}
 }
+
+// TestBTreeLargerThanBufferPoolSurvivesRestart 数据量远超 Buffer Pool 容量，刷盘并重新打开后仍能读到全部数据。
+func TestBTreeLargerThanBufferPoolSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "btree.db")
+	ctx := context.Background()
+	const rows = 5000
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%06d", i)) }
+	value := func(i int) []byte { return bytes.Repeat([]byte{byte('a' + i%26)}, 100+i%700) }
+
+	pager, err := storage.NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	bpm := buffer.NewBufferPoolManager(8, pager)
+	tree, err := storage.NewBPlusTree(ctx, bpm)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
+	for i := 0; i < rows; i++ {
+		if err = tree.Insert(ctx, key(i), value(i)); err != nil {
+			t.Fatalf("Insert(%d) error = %v", i, err)
+		}
+	}
+	for i := 0; i < rows; i += 3 {
+		if err = tree.Delete(ctx, key(i)); err != nil {
+			t.Fatalf("Delete(%d) error = %v", i, err)
+		}
+	}
+	metaID := tree.MetaPageID()
+	if err = bpm.FlushAllPages(ctx); err != nil {
+		t.Fatalf("FlushAllPages() error = %v", err)
+	}
+	if err = pager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	pager, err = storage.NewFilePageManager(path)
+	if err != nil {
+		t.Fatalf("NewFilePageManager() error = %v", err)
+	}
+	defer func() { _ = pager.Close() }()
+	tree, err = storage.OpenBPlusTree(ctx, buffer.NewBufferPoolManager(8, pager), metaID)
+	if err != nil {
+		t.Fatalf("OpenBPlusTree() error = %v", err)
+	}
+	if got, want := tree.Len(), rows-(rows+2)/3; got != want {
+		t.Fatalf("Len() = %d, want %d", got, want)
+	}
+	it, err := tree.RangeScan(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("RangeScan() error = %v", err)
+	}
+	i := 1
+	for it.Next() {
+		item := it.Item()
+		if !bytes.Equal(item.Key, key(i)) || !bytes.Equal(item.Value, value(i)) {
+			t.Fatalf("item = %q, want %q", item.Key, key(i))
+		}
+		if i++; i%3 == 0 {
+			i++
+		}
+	}
+	if err = it.Err(); err != nil {
+		t.Fatalf("iterator error = %v", err)
+	}
+	if i != rows {
+		t.Fatalf("scan stopped before %q", key(i))
+	}
+	if _, err = tree.Search(ctx, key(0)); err != storage.ErrKeyNotFound {
+		t.Fatalf("Search(deleted) error = %v, want %v", err, storage.ErrKeyNotFound)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/executor"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
@@ -24,21 +26,28 @@ func TestChaosRollback(t *testing.T) {
 	}
 	defer func() { _ = walWriter.Close() }()
 
-	engine := executor.NewWithDefaults(storage.NewBPlusTree(16, pager), walWriter)
+	cat, err := catalog.Create(context.Background(), buffer.NewBufferPoolManager(64, pager))
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine, err := executor.NewWithDefaults(context.Background(), cat, walWriter)
+	if err != nil {
+		t.Fatalf("NewWithDefaults() error = %v", err)
+	}
 	ctx := context.Background()
 	sessionID := "chaos-session"
 
 	if _, err = engine.Execute(ctx, sessionID, &parser.TxStmt{Action: "BEGIN"}); err != nil {
 		t.Fatalf("BEGIN error = %v", err)
 	}
-	if _, err = engine.Execute(ctx, sessionID, &parser.InsertStmt{Table: "kv", Key: "k1", Value: "v1"}); err != nil {
+	if _, err = engine.ExecuteSQL(ctx, sessionID, "INSERT INTO kv VALUES ('k1', 'v1')"); err != nil {
 		t.Fatalf("INSERT error = %v", err)
 	}
 	if _, err = engine.Execute(ctx, sessionID, &parser.TxStmt{Action: "ROLLBACK"}); err != nil {
 		t.Fatalf("ROLLBACK error = %v", err)
 	}
 
-	result, err := engine.Execute(ctx, sessionID, &parser.SelectStmt{Table: "kv", Key: "k1"})
+	result, err := engine.ExecuteSQL(ctx, sessionID, "SELECT value FROM kv WHERE key = 'k1'")
 	if err != nil {
 		t.Fatalf("SELECT error = %v", err)
 	}
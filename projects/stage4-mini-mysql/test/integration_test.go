@@ -2,9 +2,12 @@ package test
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/executor"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
@@ -25,8 +28,15 @@ func newEngine(t *testing.T) *executor.Engine {
 	}
 	t.Cleanup(func() { _ = walWriter.Close() })
 
-	tree := storage.NewBPlusTree(16, pager)
-	return executor.NewWithDefaults(tree, walWriter)
+	cat, err := catalog.Create(context.Background(), buffer.NewBufferPoolManager(64, pager))
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine, err := executor.NewWithDefaults(context.Background(), cat, walWriter)
+	if err != nil {
+		t.Fatalf("NewWithDefaults() error = %v", err)
+	}
+	return engine
 }
 
 func TestTransactionFlow(t *testing.T) {
@@ -37,14 +47,14 @@ func TestTransactionFlow(t *testing.T) {
 	if _, err := engine.Execute(ctx, sessionID, &parser.TxStmt{Action: "BEGIN"}); err != nil {
 		t.Fatalf("BEGIN error = %v", err)
 	}
-	if _, err := engine.Execute(ctx, sessionID, &parser.InsertStmt{Table: "kv", Key: "k1", Value: "v1"}); err != nil {
+	if _, err := engine.ExecuteSQL(ctx, sessionID, "INSERT INTO kv VALUES ('k1', 'v1')"); err != nil {
 		t.Fatalf("INSERT error = %v", err)
 	}
 	if _, err := engine.Execute(ctx, sessionID, &parser.TxStmt{Action: "COMMIT"}); err != nil {
 		t.Fatalf("COMMIT error = %v", err)
 	}
 
-	result, err := engine.Execute(ctx, sessionID, &parser.SelectStmt{Table: "kv", Key: "k1"})
+	result, err := engine.ExecuteSQL(ctx, sessionID, "SELECT value FROM kv WHERE key = 'k1'")
 	if err != nil {
 		t.Fatalf("SELECT error = %v", err)
 	}
@@ -52,3 +62,65 @@ func TestTransactionFlow(t *testing.T) {
 		t.Fatalf("SELECT result = %q, want v1", result)
 	}
 }
+
+func TestCatalogSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	walWriter, err := wal.NewWriter(filepath.Join(dir, "restart.wal"))
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	t.Cleanup(func() { _ = walWriter.Close() })
+
+	open := func() (*storage.FilePageManager, *buffer.BufferPoolManager, *executor.Engine) {
+		pager, err := storage.NewFilePageManager(filepath.Join(dir, "restart.db"))
+		if err != nil {
+			t.Fatalf("NewFilePageManager() error = %v", err)
+		}
+		pool := buffer.NewBufferPoolManager(16, pager)
+		cat, err := catalog.Open(ctx, pool, 0)
+		if errors.Is(err, storage.ErrPageNotFound) {
+			cat, err = catalog.Create(ctx, pool)
+		}
+		if err != nil {
+			t.Fatalf("open catalog error = %v", err)
+		}
+		engine, err := executor.NewWithDefaults(ctx, cat, walWriter)
+		if err != nil {
+			t.Fatalf("NewWithDefaults() error = %v", err)
+		}
+		return pager, pool, engine
+	}
+
+	pager, pool, engine := open()
+	for _, sql := range []string{
+		"CREATE TABLE orders (id INT PRIMARY KEY, amount DOUBLE NOT NULL, placed DATETIME)",
+		"INSERT INTO orders VALUES (1, 9.5, '2024-03-01 10:00:00'), (2, 20, NULL)",
+		"INSERT INTO kv VALUES ('k', 'v')",
+	} {
+		if _, err = engine.ExecuteSQL(ctx, "s", sql); err != nil {
+			t.Fatalf("ExecuteSQL(%q) error = %v", sql, err)
+		}
+	}
+	if err = pool.FlushAllPages(ctx); err != nil {
+		t.Fatalf("FlushAllPages() error = %v", err)
+	}
+	_ = pager.Close()
+
+	pager, _, engine = open()
+	defer func() { _ = pager.Close() }()
+	steps := []struct {
+		sql  string
+		want string
+	}{
+		{"SHOW TABLES", "kv,orders"},
+		{"DESCRIBE orders", "id|INT|NO|PRI,amount|DOUBLE|NO|,placed|DATETIME|YES|"},
+		{"SELECT * FROM orders", "1|9.5|2024-03-01 10:00:00,2|20|NULL"},
+		{"SELECT value FROM kv WHERE key = 'k'", "v"},
+	}
+	for _, step := range steps {
+		if result, execErr := engine.ExecuteSQL(ctx, "s", step.sql); execErr != nil || result != step.want {
+			t.Fatalf("ExecuteSQL(%q) = (%q, %v), want %q", step.sql, result, execErr, step.want)
+		}
+	}
+}
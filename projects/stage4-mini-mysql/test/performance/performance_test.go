@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/executor"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
@@ -25,11 +27,21 @@ func TestInsertPerformance(t *testing.T) {
 	}
 	defer func() { _ = walWriter.Close() }()
 
-	engine := executor.NewWithDefaults(storage.NewBPlusTree(16, pager), walWriter)
+	cat, err := catalog.Create(context.Background(), buffer.NewBufferPoolManager(64, pager))
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine, err := executor.NewWithDefaults(context.Background(), cat, walWriter)
+	if err != nil {
+		t.Fatalf("NewWithDefaults() error = %v", err)
+	}
 	ctx := context.Background()
 	start := time.Now()
 	for i := 0; i < 5000; i++ {
-		stmt := &parser.InsertStmt{Table: "kv", Key: string(rune(i % 20000)), Value: "v"}
+		stmt := &parser.InsertStmt{Table: "kv", Rows: [][]parser.Expr{{
+			&parser.Literal{Kind: parser.LiteralString, Value: string(rune(i % 20000))},
+			&parser.Literal{Kind: parser.LiteralString, Value: "v"},
+		}}}
 		if _, err = engine.Execute(ctx, "perf-session", stmt); err != nil {
 			t.Fatalf("Execute() error = %v", err)
 		}
@@ -7,8 +7,9 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/buffer"
+	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/catalog"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/executor"
-	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/parser"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/storage"
 	"github.com/EfreetZ/SWAI/projects/stage4-mini-mysql/internal/wal"
 )
@@ -26,7 +27,14 @@ func TestStressConcurrentInsert(t *testing.T) {
 	}
 	defer func() { _ = walWriter.Close() }()
 
-	engine := executor.NewWithDefaults(storage.NewBPlusTree(16, pager), walWriter)
+	cat, err := catalog.Create(context.Background(), buffer.NewBufferPoolManager(64, pager))
+	if err != nil {
+		t.Fatalf("catalog.Create() error = %v", err)
+	}
+	engine, err := executor.NewWithDefaults(context.Background(), cat, walWriter)
+	if err != nil {
+		t.Fatalf("NewWithDefaults() error = %v", err)
+	}
 	ctx := context.Background()
 
 	const workers = 32
@@ -39,7 +47,7 @@ func TestStressConcurrentInsert(t *testing.T) {
 			defer wg.Done()
 			for i := 0; i < each; i++ {
 				key := "k" + strconv.Itoa(workerID) + "-" + strconv.Itoa(i)
-				_, _ = engine.Execute(ctx, "stress-session", &parser.InsertStmt{Table: "kv", Key: key, Value: "v"})
+				_, _ = engine.ExecuteSQL(ctx, "stress-session", "INSERT INTO kv VALUES ('"+key+"', 'v')")
 			}
 		}(w)
 	}
@@ -20,7 +20,10 @@ func TestWALRecoveryReplay(t *testing.T) {
 	_, _ = writer.Append(context.Background(), &wal.LogRecord{TxID: 1, Type: wal.LogInsert, OldValue: []byte("k"), NewValue: []byte("v")})
 	_ = writer.Flush(context.Background())
 
-	tree := storage.NewBPlusTree(16, nil)
+	tree, err := storage.NewBPlusTree(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("NewBPlusTree() error = %v", err)
+	}
 	recovery := wal.NewRecovery(writer, tree)
 	if err = recovery.Replay(context.Background(), 1); err != nil {
 		t.Fatalf("Replay() error = %v", err)
@@ -0,0 +1,116 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ttl"
+)
+
+// pipelineDepth 每批发送的命令数，与 redis-benchmark -P 16 相当。
+const pipelineDepth = 16
+
+// BenchmarkPipelinedSetGet 通过 TCP 以 pipeline 方式执行 SET/GET，每个并发 goroutine 使用独立连接，
+// 每批发送 pipelineDepth 条命令后再读取全部回复；ns/op 为单条命令的耗时。
+func BenchmarkPipelinedSetGet(b *testing.B) {
+	addr := startServer(b)
+	for _, cmd := range []string{"SET", "GET"} {
+		b.Run(cmd, func(b *testing.B) {
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					b.Errorf("dial error = %v", err)
+					return
+				}
+				defer func() { _ = conn.Close() }()
+				reader := bufio.NewReader(conn)
+				writer := bufio.NewWriter(conn)
+				for {
+					n := 0
+					for ; n < pipelineDepth && pb.Next(); n++ {
+						key := "key:" + strconv.FormatInt(next.Add(1)%10000, 10)
+						args := []string{cmd, key}
+						if cmd == "SET" {
+							args = append(args, "value")
+						}
+						_, _ = writer.Write(protocol.Serialize(protocol.CommandValue(args)))
+					}
+					if n == 0 {
+						return
+					}
+					if err := writer.Flush(); err != nil {
+						b.Errorf("write error = %v", err)
+						return
+					}
+					for i := 0; i < n; i++ {
+						if _, err := protocol.Parse(reader); err != nil {
+							b.Errorf("read reply error = %v", err)
+							return
+						}
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkParallelSetGet 多个 goroutine 直接并发调用 DB，衡量 key 空间锁的竞争。
+func BenchmarkParallelSetGet(b *testing.B) {
+	d := db.New()
+	ctx := context.Background()
+	for i := 0; i < 10000; i++ {
+		_, _ = d.ExecuteCommand(ctx, []string{"SET", "key:" + strconv.Itoa(i), "value"})
+	}
+	for _, cmd := range []string{"SET", "GET"} {
+		b.Run(cmd, func(b *testing.B) {
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := "key:" + strconv.FormatInt(next.Add(1)%10000, 10)
+					args := []string{cmd, key}
+					if cmd == "SET" {
+						args = append(args, "value")
+					}
+					if _, err := d.ExecuteCommand(ctx, args); err != nil {
+						b.Errorf("%s error = %v", cmd, err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func startServer(b *testing.B) string {
+	b.Helper()
+	database := db.New()
+	srv := server.NewTCPServer("127.0.0.1:0", database, ttl.NewManager(database), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = srv.Start(ctx)
+	}()
+	b.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	for deadline := time.Now().Add(2 * time.Second); srv.Addr() == ""; {
+		if time.Now().After(deadline) {
+			b.Fatal("server did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return srv.Addr()
+}
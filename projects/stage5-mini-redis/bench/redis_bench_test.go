@@ -32,3 +32,33 @@ func BenchmarkSetGet(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkLeaderboard(b *testing.B) {
+	d := db.New()
+	ctx := context.Background()
+	for i := 0; i < 100000; i++ {
+		_, _ = d.ExecuteCommand(ctx, []string{"ZADD", "board", strconv.Itoa(i % 5000), "player" + strconv.Itoa(i)})
+	}
+
+	b.Run("zrangebyscore", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := d.ExecuteCommand(ctx, []string{"ZRANGEBYSCORE", "board", "(100", "101"}); err != nil {
+				b.Fatalf("ZRANGEBYSCORE error = %v", err)
+			}
+		}
+	})
+	b.Run("zrevrank", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := d.ExecuteCommand(ctx, []string{"ZREVRANK", "board", "player" + strconv.Itoa(i%100000)}); err != nil {
+				b.Fatalf("ZREVRANK error = %v", err)
+			}
+		}
+	})
+	b.Run("zincrby", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := d.ExecuteCommand(ctx, []string{"ZINCRBY", "board", "1", "player" + strconv.Itoa(i%100000)}); err != nil {
+				b.Fatalf("ZINCRBY error = %v", err)
+			}
+		}
+	})
+}
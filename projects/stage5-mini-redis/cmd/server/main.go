@@ -2,28 +2,251 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/persist"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/sentinel"
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ttl"
 )
 
 func main() {
+	addr := flag.String("addr", "127.0.0.1:16379", "监听地址")
+	dataDir := flag.String("dir", "data", "持久化文件目录")
+	dbFilename := flag.String("dbfilename", "dump.rdb", "RDB 快照文件名")
+	appendOnly := flag.Bool("appendonly", true, "是否开启 AOF")
+	appendFilename := flag.String("appendfilename", "appendonly.aof", "AOF 文件名")
+	appendFsync := flag.String("appendfsync", string(persist.FsyncEverySec), "AOF 刷盘策略：always/everysec/no")
+	rewritePercentage := flag.Int("auto-aof-rewrite-percentage", persist.DefaultRewritePercentage, "AOF 增长百分比达到该值时自动重写，0 表示关闭")
+	rewriteMinSize := flag.Int64("auto-aof-rewrite-min-size", persist.DefaultRewriteMinSize, "AOF 自动重写的最小字节数")
+	replicaOf := flag.String("replicaof", "", "以从节点身份启动，格式 \"host port\"")
+	masterUser := flag.String("masteruser", "", "连接主节点时 AUTH 使用的用户名，为空时以默认用户认证")
+	masterAuth := flag.String("masterauth", "", "连接主节点时 AUTH 使用的密码")
+	requirePass := flag.String("requirepass", "", "默认用户的密码，为空表示无需认证")
+	aclFile := flag.String("aclfile", "", "ACL 用户文件，ACL LOAD/SAVE 读写该文件，存在时启动即加载")
+	clusterEnabled := flag.Bool("cluster-enabled", false, "是否开启集群模式")
+	clusterBusAddr := flag.String("cluster-bus-addr", "", "集群总线地址，默认数据端口 + 10000")
+	maxMemory := flag.String("maxmemory", "0", "内存上限，支持 kb/mb/gb 单位，0 表示不限制")
+	maxMemoryPolicy := flag.String("maxmemory-policy", string(db.NoEviction), "淘汰策略：noeviction/allkeys-lru/allkeys-lfu/allkeys-random/volatile-lru/volatile-lfu/volatile-random/volatile-ttl")
+	maxMemorySamples := flag.Int("maxmemory-samples", db.DefaultMaxMemorySamples, "每轮淘汰采样的 key 数")
+	notifyEvents := flag.String("notify-keyspace-events", "", "keyspace 通知的事件类别，格式同 Redis，如 \"KEA\"，空串表示关闭")
+	slowlogThreshold := flag.Int64("slowlog-log-slower-than", server.DefaultSlowlogThreshold, "执行耗时达到该微秒数的命令记入慢日志，负数表示关闭")
+	slowlogMaxLen := flag.Int("slowlog-max-len", server.DefaultSlowlogMaxLen, "慢日志最多保留的条数")
+	pubsubOutputLimit := flag.String("client-output-buffer-limit-pubsub", "32mb 8mb 60", "订阅连接输出缓冲上限：<hard> <soft> <soft-seconds>")
+	sentinelMode := flag.Bool("sentinel", false, "以哨兵模式运行，只监视 -sentinel-monitor 指定的主节点，默认监听 127.0.0.1:26379")
+	var monitors []string
+	flag.Func("sentinel-monitor", "哨兵监视的主节点，格式 \"name host port quorum\"，可重复指定", func(value string) error {
+		monitors = append(monitors, value)
+		return nil
+	})
+	downAfter := flag.Int64("sentinel-down-after-milliseconds", sentinel.DefaultDownAfter.Milliseconds(), "节点超过该毫秒数无有效回复即判定主观下线")
+	failoverTimeout := flag.Int64("sentinel-failover-timeout", sentinel.DefaultFailoverTimeout.Milliseconds(), "故障转移各阶段的超时毫秒数")
+	flag.Parse()
+
 	logger := slog.New(slog.NewTextHandler(io.Writer(os.Stdout), nil))
+	if *sentinelMode {
+		listenAddr := "127.0.0.1:26379"
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "addr" {
+				listenAddr = *addr
+			}
+		})
+		timing := sentinel.Timing{
+			DownAfter:       time.Duration(*downAfter) * time.Millisecond,
+			FailoverTimeout: time.Duration(*failoverTimeout) * time.Millisecond,
+		}
+		if err := runSentinel(listenAddr, monitors, timing, *masterUser, *masterAuth, logger); err != nil {
+			logger.Error("mini-redis sentinel stopped", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 	database := db.New()
+	memoryLimit, err := server.ParseMemory(*maxMemory)
+	if err != nil {
+		logger.Error("invalid maxmemory", "error", err)
+		os.Exit(1)
+	}
+	policy, err := db.ParseEvictionPolicy(*maxMemoryPolicy)
+	if err != nil {
+		logger.Error("invalid maxmemory-policy", "error", err)
+		os.Exit(1)
+	}
+	database.SetMaxMemory(memoryLimit, policy, *maxMemorySamples)
+	notifyClasses, err := db.ParseNotifyKeyspaceEvents(*notifyEvents)
+	if err != nil {
+		logger.Error("invalid notify-keyspace-events", "error", err)
+		os.Exit(1)
+	}
+	database.SetNotifyKeyspaceEvents(notifyClasses)
 	ttlManager := ttl.NewManager(database)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	srv := server.NewTCPServer("127.0.0.1:16379", database, ttlManager, logger)
+	if err := os.MkdirAll(*dataDir, 0o755); err != nil {
+		logger.Error("create data dir failed", "error", err)
+		os.Exit(1)
+	}
+	srv := server.NewTCPServer(*addr, database, ttlManager, logger)
+	outputLimit, err := server.ParseOutputBufferLimit(*pubsubOutputLimit)
+	if err != nil {
+		logger.Error("invalid client-output-buffer-limit-pubsub", "error", err)
+		os.Exit(1)
+	}
+	srv.SetPubSubOutputLimit(outputLimit)
+	if *slowlogMaxLen < 0 {
+		logger.Error("invalid slowlog-max-len", "value", *slowlogMaxLen)
+		os.Exit(1)
+	}
+	srv.SetSlowlog(*slowlogThreshold, *slowlogMaxLen)
+	if *aclFile != "" {
+		if err := srv.EnableACLFile(*aclFile); err != nil {
+			logger.Error("load aclfile failed", "error", err)
+			os.Exit(1)
+		}
+	}
+	if *requirePass != "" {
+		srv.SetRequirePass(*requirePass)
+	}
+	srv.SetMasterAuth(*masterUser, *masterAuth)
+	rdbPath := filepath.Join(*dataDir, *dbFilename)
+	srv.EnableRDB(rdbPath)
+
+	// 与 Redis 一致：开启 AOF 且 AOF 文件存在时以 AOF 为准，否则尝试加载 RDB。
+	aofPath := filepath.Join(*dataDir, *appendFilename)
+	_, statErr := os.Stat(aofPath)
+	aofExists := statErr == nil
+	loadedRDB := false
+	if !*appendOnly || !aofExists {
+		snapshot, err := persist.LoadSnapshot(ctx, rdbPath)
+		switch {
+		case err == nil:
+			database.LoadSnapshot(snapshot)
+			loadedRDB = true
+			logger.Info("rdb loaded", "path", rdbPath, "keys", len(snapshot))
+		case !errors.Is(err, os.ErrNotExist):
+			logger.Error("load rdb failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *appendOnly {
+		policy, err := persist.ParseFsyncPolicy(*appendFsync)
+		if err != nil {
+			logger.Error("invalid appendfsync", "error", err)
+			os.Exit(1)
+		}
+		aof, err := persist.NewAOFWithPolicy(aofPath, policy)
+		if err != nil {
+			logger.Error("open aof failed", "error", err)
+			os.Exit(1)
+		}
+		defer func() {
+			_ = aof.Close()
+		}()
+		if loadedRDB {
+			// 新建的 AOF 需要先写入 RDB 数据作为基线，否则下次启动会只加载空 AOF。
+			if err = aof.BeginRewrite(); err == nil {
+				err = aof.FinishRewrite(database.Snapshot())
+			}
+			if err != nil {
+				logger.Error("seed aof from rdb failed", "error", err)
+				os.Exit(1)
+			}
+		} else {
+			replayed, replayErr := persist.ReplayInto(ctx, aof, database)
+			if replayErr != nil {
+				logger.Error("replay aof failed", "error", replayErr)
+				os.Exit(1)
+			}
+			logger.Info("aof loaded", "path", aof.Path(), "commands", replayed)
+		}
+		aof.SetAutoRewrite(*rewritePercentage, *rewriteMinSize)
+		logger.Info("aof enabled", "path", aof.Path(), "appendfsync", policy)
+		srv.EnableAOF(aof)
+	}
+
+	if *clusterEnabled {
+		busAddr := *clusterBusAddr
+		if busAddr == "" {
+			host, portText, err := net.SplitHostPort(*addr)
+			port, convErr := strconv.Atoi(portText)
+			if err != nil || convErr != nil {
+				logger.Error("invalid addr for cluster bus", "addr", *addr)
+				os.Exit(1)
+			}
+			busAddr = net.JoinHostPort(host, strconv.Itoa(port+10000))
+		}
+		state := cluster.NewLocalState(*addr, busAddr)
+		bus := cluster.NewBus(state, logger)
+		if err := bus.Listen(busAddr); err != nil {
+			logger.Error("listen cluster bus failed", "error", err)
+			os.Exit(1)
+		}
+		srv.EnableCluster(state, bus)
+		logger.Info("cluster mode enabled", "node_id", state.Myself().ID, "bus", busAddr)
+	}
+
+	if *replicaOf != "" {
+		fields := strings.Fields(*replicaOf)
+		port := 0
+		if len(fields) == 2 {
+			port, _ = strconv.Atoi(fields[1])
+		}
+		if port <= 0 {
+			logger.Error("invalid replicaof, want \"host port\"", "value", *replicaOf)
+			os.Exit(1)
+		}
+		srv.ReplicaOf(ctx, fields[0], port)
+	}
+
 	if err := srv.Start(ctx); err != nil {
 		logger.Error("mini-redis server stopped", "error", err)
 		os.Exit(1)
 	}
 }
+
+// runSentinel 以哨兵模式运行：连接被监视节点时使用 -masteruser/-masterauth 认证。
+func runSentinel(addr string, monitors []string, timing sentinel.Timing, user, pass string, logger *slog.Logger) error {
+	if len(monitors) == 0 {
+		return errors.New("sentinel mode requires at least one -sentinel-monitor")
+	}
+	s := sentinel.New(addr, logger)
+	s.SetTiming(timing)
+	s.SetAuth(user, pass)
+	for _, monitor := range monitors {
+		fields := strings.Fields(monitor)
+		if len(fields) != 4 {
+			return fmt.Errorf("invalid sentinel-monitor %q, want \"name host port quorum\"", monitor)
+		}
+		port, err := strconv.Atoi(fields[2])
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid sentinel-monitor port %q", fields[2])
+		}
+		quorum, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("invalid sentinel-monitor quorum %q", fields[3])
+		}
+		if err := s.Monitor(fields[0], fields[1], port, quorum); err != nil {
+			return fmt.Errorf("sentinel-monitor %s: %w", fields[0], err)
+		}
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	return s.Start(ctx)
+}
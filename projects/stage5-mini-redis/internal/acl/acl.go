@@ -0,0 +1,516 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/glob"
+)
+
+// DefaultUser 默认用户：新连接以它的身份开始，默认用户开启且为 nopass 时无需 AUTH。
+const DefaultUser = "default"
+
+var (
+	ErrDefaultUser = errors.New("The 'default' user cannot be removed")
+	ErrUserName    = errors.New("Usernames can't contain spaces or null characters")
+)
+
+// DenyReason 权限检查失败的原因。
+type DenyReason int
+
+const (
+	DenyCommand DenyReason = iota
+	DenyKey
+	DenyChannel
+)
+
+// DeniedError 用户无权执行命令或访问其中的 key、频道，文本与 Redis 的 NOPERM 错误一致（不含错误码）。
+type DeniedError struct {
+	Reason  DenyReason
+	Command string
+}
+
+func (e *DeniedError) Error() string {
+	switch e.Reason {
+	case DenyKey:
+		return "this user has no permissions to access one of the keys used as arguments"
+	case DenyChannel:
+		return "this user has no permissions to access one of the channels used as arguments"
+	default:
+		return fmt.Sprintf("this user has no permissions to run the '%s' command", e.Command)
+	}
+}
+
+// User ACL 用户。commands 为依次生效的命令规则（如 -@all、+@read、-keys），
+// 对某条命令最后一条匹配的规则决定是否允许，没有匹配时拒绝。
+type User struct {
+	name      string
+	enabled   bool
+	nopass    bool
+	passwords []string
+	commands  []string
+	keys      []string
+	channels  []string
+}
+
+func newUser(name string) *User {
+	return &User{name: name, commands: []string{"-@all"}}
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.commands = append([]string(nil), u.commands...)
+	c.keys = append([]string(nil), u.keys...)
+	c.channels = append([]string(nil), u.channels...)
+	return &c
+}
+
+// apply 应用一条 ACL SETUSER 规则。
+func (u *User) apply(rule string) error {
+	if rule == "" {
+		return u.ruleError(rule, "Syntax error")
+	}
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass, u.passwords = true, nil
+		return nil
+	case "resetpass":
+		u.nopass, u.passwords = false, nil
+		return nil
+	case "allkeys":
+		u.keys = []string{"*"}
+		return nil
+	case "resetkeys":
+		u.keys = nil
+		return nil
+	case "allchannels":
+		u.channels = []string{"*"}
+		return nil
+	case "resetchannels":
+		u.channels = nil
+		return nil
+	case "allcommands":
+		u.commands = []string{"+@all"}
+		return nil
+	case "nocommands":
+		u.commands = []string{"-@all"}
+		return nil
+	case "reset":
+		*u = *newUser(u.name)
+		return nil
+	}
+	switch body := rule[1:]; rule[0] {
+	case '>':
+		u.addPassword(hashPassword(body))
+	case '<':
+		if !u.removePassword(hashPassword(body)) {
+			return u.ruleError(rule, "The password you are trying to remove from the user does not exist")
+		}
+	case '#', '!':
+		if !validHash(body) {
+			return u.ruleError(rule, "The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		if rule[0] == '#' {
+			u.addPassword(body)
+		} else if !u.removePassword(body) {
+			return u.ruleError(rule, "The password you are trying to remove from the user does not exist")
+		}
+	case '~':
+		u.keys = addPattern(u.keys, body)
+	case '&':
+		u.channels = addPattern(u.channels, body)
+	case '+', '-':
+		return u.applyCommandRule(rule)
+	default:
+		return u.ruleError(rule, "Syntax error")
+	}
+	return nil
+}
+
+func (u *User) applyCommandRule(rule string) error {
+	name := strings.ToLower(rule[1:])
+	if category, ok := strings.CutPrefix(name, "@"); ok {
+		if !validCategory(category) {
+			return u.ruleError(rule, "Unknown command or category name in ACL")
+		}
+		if category == "all" {
+			u.commands = nil
+		}
+	} else if !knownCommand(strings.ToUpper(name)) {
+		return u.ruleError(rule, "Unknown command or category name in ACL")
+	}
+	u.commands = append(u.commands, rule[:1]+name)
+	return nil
+}
+
+func (u *User) ruleError(rule, reason string) error {
+	return fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, reason)
+}
+
+func (u *User) addPassword(hash string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *User) removePassword(hash string) bool {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// addPattern 追加模式，* 覆盖其余模式。
+func addPattern(patterns []string, pattern string) []string {
+	if pattern == "*" {
+		return []string{"*"}
+	}
+	for _, p := range patterns {
+		if p == pattern || p == "*" {
+			return patterns
+		}
+	}
+	return append(patterns, pattern)
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if c := hash[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *User) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := hashPassword(password)
+	for _, p := range u.passwords {
+		if p == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// check 检查命令、key 与频道权限。
+func (u *User) check(args []string) error {
+	cmd := strings.ToUpper(args[0])
+	sub := ""
+	if containerCommands[cmd] && len(args) > 1 {
+		sub = strings.ToUpper(args[1])
+	}
+	if !u.commandAllowed(cmd, sub) {
+		name := strings.ToLower(cmd)
+		if sub != "" {
+			name += "|" + strings.ToLower(sub)
+		}
+		return &DeniedError{Reason: DenyCommand, Command: name}
+	}
+	for _, key := range commandKeys(cmd, args) {
+		if !matchAny(u.keys, key) {
+			return &DeniedError{Reason: DenyKey}
+		}
+	}
+	switch cmd {
+	case "PUBLISH":
+		if len(args) > 1 && !matchAny(u.channels, args[1]) {
+			return &DeniedError{Reason: DenyChannel}
+		}
+	case "SUBSCRIBE":
+		for _, channel := range args[1:] {
+			if !matchAny(u.channels, channel) {
+				return &DeniedError{Reason: DenyChannel}
+			}
+		}
+	case "PSUBSCRIBE":
+		// 模式订阅只允许与用户频道模式字面相同的模式，否则无法判断它会收到哪些频道。
+		for _, pattern := range args[1:] {
+			if !containsPattern(u.channels, pattern) {
+				return &DeniedError{Reason: DenyChannel}
+			}
+		}
+	}
+	return nil
+}
+
+func (u *User) commandAllowed(cmd, sub string) bool {
+	cats := commandCategories(cmd, sub)
+	name := strings.ToLower(cmd)
+	full := name + "|" + strings.ToLower(sub)
+	allowed := false
+	for _, rule := range u.commands {
+		target := rule[1:]
+		var match bool
+		if category, ok := strings.CutPrefix(target, "@"); ok {
+			match = inCategory(cats, category)
+		} else {
+			match = target == name || (sub != "" && target == full)
+		}
+		if match {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if p == "*" || glob.Match(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPattern(patterns []string, pattern string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// String 以 ACL LIST 与 ACL 文件的格式描述用户，可作为 SETUSER 规则重新应用。
+func (u *User) String() string {
+	parts := []string{"user", u.name}
+	if u.enabled {
+		parts = append(parts, "on")
+	} else {
+		parts = append(parts, "off")
+	}
+	if u.nopass {
+		parts = append(parts, "nopass")
+	}
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	for _, k := range u.keys {
+		parts = append(parts, "~"+k)
+	}
+	if len(u.channels) == 0 {
+		parts = append(parts, "resetchannels")
+	}
+	for _, c := range u.channels {
+		parts = append(parts, "&"+c)
+	}
+	parts = append(parts, u.commands...)
+	return strings.Join(parts, " ")
+}
+
+// UserInfo ACL GETUSER 返回的用户信息。
+type UserInfo struct {
+	Flags     []string
+	Passwords []string
+	Commands  string
+	Keys      string
+	Channels  string
+}
+
+func (u *User) info() UserInfo {
+	info := UserInfo{Passwords: append([]string(nil), u.passwords...), Commands: strings.Join(u.commands, " ")}
+	if u.enabled {
+		info.Flags = append(info.Flags, "on")
+	} else {
+		info.Flags = append(info.Flags, "off")
+	}
+	if u.nopass {
+		info.Flags = append(info.Flags, "nopass")
+	}
+	keys := make([]string, 0, len(u.keys))
+	for _, k := range u.keys {
+		keys = append(keys, "~"+k)
+	}
+	channels := make([]string, 0, len(u.channels))
+	for _, c := range u.channels {
+		channels = append(channels, "&"+c)
+	}
+	info.Keys, info.Channels = strings.Join(keys, " "), strings.Join(channels, " ")
+	return info
+}
+
+// ACL 用户表。权限检查在每条命令前进行，用户规则修改后对已认证的连接立即生效。
+type ACL struct {
+	mu          sync.RWMutex
+	users       map[string]*User
+	requirePass string
+}
+
+// New 创建只有默认用户的 ACL，默认用户开启、无需密码且拥有全部权限（与 Redis 默认配置相同）。
+func New() *ACL {
+	return &ACL{users: map[string]*User{DefaultUser: defaultUser()}}
+}
+
+func defaultUser() *User {
+	return &User{name: DefaultUser, enabled: true, nopass: true, commands: []string{"+@all"}, keys: []string{"*"}, channels: []string{"*"}}
+}
+
+// SetUser 创建或修改用户，规则全部合法时才生效。
+func (a *ACL) SetUser(name string, rules ...string) error {
+	if name == "" || strings.ContainsAny(name, " \x00") {
+		return ErrUserName
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user, ok := a.users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.apply(rule); err != nil {
+			return err
+		}
+	}
+	a.users[name] = user
+	return nil
+}
+
+// GetUser 返回用户信息。
+func (a *ACL) GetUser(name string) (UserInfo, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	user, ok := a.users[name]
+	if !ok {
+		return UserInfo{}, false
+	}
+	return user.info(), true
+}
+
+// DelUser 删除用户，返回实际删除的个数；默认用户不能删除。
+func (a *ACL) DelUser(names ...string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, ErrDefaultUser
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := a.users[name]; ok {
+			delete(a.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Exists 判断用户是否存在。
+func (a *ACL) Exists(name string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.users[name]
+	return ok
+}
+
+// Users 返回排序后的用户名。
+func (a *ACL) Users() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List 按用户名顺序返回每个用户的规则描述。
+func (a *ACL) List() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.listLocked()
+}
+
+func (a *ACL) listLocked() []string {
+	lines := make([]string, 0, len(a.users))
+	for _, user := range a.users {
+		lines = append(lines, user.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Authenticate 校验用户名与密码，用户不存在或已停用时失败。
+func (a *ACL) Authenticate(name, password string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	user, ok := a.users[name]
+	return ok && user.enabled && user.checkPassword(password)
+}
+
+// DefaultNoPass 判断新连接是否无需 AUTH 即以默认用户身份认证。
+func (a *ACL) DefaultNoPass() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	user := a.users[DefaultUser]
+	return user.enabled && user.nopass
+}
+
+// Check 检查用户能否执行 args，用户不存在时拒绝。
+// 停用（off）只阻止新的认证，已认证的连接仍按规则检查，与 Redis 相同。
+func (a *ACL) Check(name string, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	user, ok := a.users[name]
+	if !ok {
+		return &DeniedError{Reason: DenyCommand, Command: strings.ToLower(args[0])}
+	}
+	return user.check(args)
+}
+
+// SetRequirePass 设置默认用户的密码（requirepass），空串表示无需密码。
+func (a *ACL) SetRequirePass(password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user := a.users[DefaultUser].clone()
+	if password == "" {
+		user.nopass, user.passwords = true, nil
+	} else {
+		user.nopass, user.passwords = false, []string{hashPassword(password)}
+	}
+	a.users[DefaultUser] = user
+	a.requirePass = password
+}
+
+// RequirePass 返回最近一次设置的 requirepass。
+func (a *ACL) RequirePass() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.requirePass
+}
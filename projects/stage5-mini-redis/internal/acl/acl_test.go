@@ -0,0 +1,134 @@
+package acl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetUserRulesAndCheck(t *testing.T) {
+	a := New()
+	if err := a.SetUser("alice", "on", ">secret", "~cache:*", "&news.*", "+@read", "-keys", "+set", "+client|setname"); err != nil {
+		t.Fatalf("SetUser error = %v", err)
+	}
+	if !a.Authenticate("alice", "secret") || a.Authenticate("alice", "wrong") {
+		t.Fatal("password check mismatch")
+	}
+
+	cases := []struct {
+		args   []string
+		reason DenyReason
+		ok     bool
+	}{
+		{[]string{"GET", "cache:1"}, 0, true},
+		{[]string{"SET", "cache:1", "v"}, 0, true},
+		{[]string{"GET", "other"}, DenyKey, false},
+		{[]string{"KEYS", "*"}, DenyCommand, false},
+		{[]string{"DEL", "cache:1"}, DenyCommand, false},
+		{[]string{"CONFIG", "GET", "maxmemory"}, DenyCommand, false},
+		{[]string{"CLIENT", "SETNAME", "x"}, 0, true},
+		{[]string{"CLIENT", "KILL", "ID", "1"}, DenyCommand, false},
+		{[]string{"PUBLISH", "news.sport", "hi"}, DenyCommand, false},
+	}
+	for _, tc := range cases {
+		err := a.Check("alice", tc.args)
+		var denied *DeniedError
+		switch {
+		case tc.ok && err != nil:
+			t.Fatalf("Check(%v) error = %v", tc.args, err)
+		case !tc.ok && (!errors.As(err, &denied) || denied.Reason != tc.reason):
+			t.Fatalf("Check(%v) error = %v, want reason %d", tc.args, err, tc.reason)
+		}
+	}
+	if err := a.Check("alice", []string{"CLIENT", "KILL", "ID", "1"}); err.Error() != "this user has no permissions to run the 'client|kill' command" {
+		t.Fatalf("denied message = %q", err)
+	}
+
+	// 频道模式：PUBLISH/SUBSCRIBE 按 glob 匹配，PSUBSCRIBE 只允许字面相同的模式。
+	if err := a.SetUser("alice", "+@pubsub"); err != nil {
+		t.Fatalf("SetUser error = %v", err)
+	}
+	if err := a.Check("alice", []string{"PUBLISH", "news.sport", "hi"}); err != nil {
+		t.Fatalf("PUBLISH allowed channel error = %v", err)
+	}
+	if err := a.Check("alice", []string{"SUBSCRIBE", "news.sport", "private"}); err == nil {
+		t.Fatal("SUBSCRIBE to private channel allowed")
+	}
+	if err := a.Check("alice", []string{"PSUBSCRIBE", "news.*"}); err != nil {
+		t.Fatalf("PSUBSCRIBE same pattern error = %v", err)
+	}
+	if err := a.Check("alice", []string{"PSUBSCRIBE", "news.s*"}); err == nil {
+		t.Fatal("PSUBSCRIBE narrower pattern allowed")
+	}
+
+	want := "user alice on #" + hashPassword("secret") + " ~cache:* &news.* -@all +@read -keys +set +client|setname +@pubsub"
+	if got := a.List()[0]; got != want {
+		t.Fatalf("List()[0] = %q, want %q", got, want)
+	}
+}
+
+func TestSetUserErrorsLeaveUserUnchanged(t *testing.T) {
+	a := New()
+	if err := a.SetUser("bob", "on", "nopass", "+@all", "~*"); err != nil {
+		t.Fatalf("SetUser error = %v", err)
+	}
+	for _, rule := range []string{"+nosuchcommand", "+@nosuchcategory", "#abc", "<missing", "bogus", "+get|x"} {
+		if err := a.SetUser("bob", "off", rule); err == nil || !strings.Contains(err.Error(), "Error in ACL SETUSER modifier '"+rule+"'") {
+			t.Fatalf("SetUser(%q) error = %v", rule, err)
+		}
+	}
+	if info, _ := a.GetUser("bob"); info.Flags[0] != "on" || info.Commands != "+@all" {
+		t.Fatalf("user changed by failed SetUser: %+v", info)
+	}
+	if _, err := a.DelUser("bob", DefaultUser); !errors.Is(err, ErrDefaultUser) {
+		t.Fatalf("DelUser(default) error = %v", err)
+	}
+	if n, err := a.DelUser("bob", "nobody"); err != nil || n != 1 {
+		t.Fatalf("DelUser = %d, %v", n, err)
+	}
+	if err := a.Check("bob", []string{"GET", "k"}); err == nil {
+		t.Fatal("deleted user still allowed")
+	}
+}
+
+func TestRequirePassAndFileRoundTrip(t *testing.T) {
+	a := New()
+	if !a.DefaultNoPass() {
+		t.Fatal("default user should not need a password")
+	}
+	a.SetRequirePass("hunter2")
+	if a.DefaultNoPass() || !a.Authenticate(DefaultUser, "hunter2") {
+		t.Fatal("requirepass not applied to default user")
+	}
+	if err := a.SetUser("reader", "on", ">pw", "allkeys", "+@read"); err != nil {
+		t.Fatalf("SetUser error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.acl")
+	if err := a.Save(path); err != nil {
+		t.Fatalf("Save error = %v", err)
+	}
+	loaded := New()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	if got, want := strings.Join(loaded.List(), "\n"), strings.Join(a.List(), "\n"); got != want {
+		t.Fatalf("loaded users = %q, want %q", got, want)
+	}
+	if !loaded.Authenticate("reader", "pw") || loaded.Check("reader", []string{"SET", "k", "v"}) == nil {
+		t.Fatal("loaded user permissions mismatch")
+	}
+
+	// 出错的文件不修改当前用户，错误带文件名与行号。
+	if err := os.WriteFile(path, []byte("user default on nopass +@all\nuser broken on +nosuch\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	if err := loaded.Load(path); err == nil || !strings.Contains(err.Error(), path+":2:") {
+		t.Fatalf("Load broken file error = %v", err)
+	}
+	if !loaded.Exists("reader") {
+		t.Fatal("failed Load replaced users")
+	}
+}
@@ -0,0 +1,170 @@
+package acl
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+)
+
+// categories 支持的命令类别；@all 包含全部命令，未列出的数据集命令按写标记归入 @write 或 @read。
+var categories = []string{"admin", "all", "connection", "pubsub", "read", "transaction", "write"}
+
+// serverCommands 由服务层处理的命令及其类别，键为大写命令名或 "命令|子命令"。
+// 子命令条目优先于命令条目，例如 CLIENT KILL 属于 @admin 而 CLIENT SETNAME 只属于 @connection。
+// 类别为空的命令只能通过 +@all 或显式的 +命令 授权。
+var serverCommands = map[string][]string{
+	"AUTH":           {"connection"},
+	"HELLO":          {"connection"},
+	"PING":           {"connection"},
+	"ECHO":           {"connection"},
+	"ASKING":         {"connection"},
+	"CLIENT":         {"connection"},
+	"CLIENT|KILL":    {"admin", "connection"},
+	"CLIENT|LIST":    {"admin", "connection"},
+	"MULTI":          {"transaction"},
+	"EXEC":           {"transaction"},
+	"DISCARD":        {"transaction"},
+	"WATCH":          {"transaction"},
+	"UNWATCH":        {"transaction"},
+	"SUBSCRIBE":      {"pubsub"},
+	"PSUBSCRIBE":     {"pubsub"},
+	"UNSUBSCRIBE":    {"pubsub"},
+	"PUNSUBSCRIBE":   {"pubsub"},
+	"PUBLISH":        {"pubsub"},
+	"PUBSUB":         {"pubsub"},
+	"MIGRATE":        {"write"},
+	"INFO":           {},
+	"ACL":            {"admin"},
+	"ACL|WHOAMI":     {},
+	"ACL|CAT":        {},
+	"CONFIG":         {"admin"},
+	"SLOWLOG":        {"admin"},
+	"MONITOR":        {"admin"},
+	"SAVE":           {"admin"},
+	"BGSAVE":         {"admin"},
+	"BGREWRITEAOF":   {"admin"},
+	"LASTSAVE":       {"admin"},
+	"REPLICAOF":      {"admin"},
+	"SLAVEOF":        {"admin"},
+	"REPLCONF":       {"admin"},
+	"SYNC":           {"admin"},
+	"PSYNC":          {"admin"},
+	"CLUSTER":        {"admin"},
+	"RESTORE-ASKING": {"write"},
+}
+
+// containerCommands 按子命令区分权限的命令，规则 +命令|子命令 只对它们有效。
+var containerCommands = map[string]bool{"CLIENT": true, "ACL": true, "CONFIG": true, "CLUSTER": true, "XGROUP": true, "PUBSUB": true}
+
+// Categories 返回全部类别名。
+func Categories() []string {
+	return append([]string(nil), categories...)
+}
+
+// CategoryCommands 返回属于类别的命令名（小写、排序），类别不存在时返回 false。
+func CategoryCommands(category string) ([]string, bool) {
+	category = strings.ToLower(category)
+	if !validCategory(category) {
+		return nil, false
+	}
+	var names []string
+	for _, name := range commandNames() {
+		if inCategory(commandCategories(name, ""), category) {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names, true
+}
+
+func validCategory(category string) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func commandNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for name := range serverCommands {
+		if cmd, _, found := strings.Cut(name, "|"); !found {
+			add(cmd)
+		}
+	}
+	for _, name := range db.CommandNames() {
+		add(name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownCommand 判断规则中的命令名（大写，可带 |子命令）是否存在。
+func knownCommand(name string) bool {
+	cmd, sub, found := strings.Cut(name, "|")
+	if found && (!containerCommands[cmd] || sub == "") {
+		return false
+	}
+	if _, ok := serverCommands[cmd]; ok {
+		return true
+	}
+	_, ok := db.LookupCommand(cmd)
+	return ok
+}
+
+// commandCategories 返回命令（大写）及子命令所属的类别，子命令条目优先。
+func commandCategories(cmd, sub string) []string {
+	if sub != "" {
+		if cats, ok := serverCommands[cmd+"|"+sub]; ok {
+			return cats
+		}
+	}
+	if cats, ok := serverCommands[cmd]; ok {
+		return cats
+	}
+	spec, ok := db.LookupCommand(cmd)
+	switch {
+	case !ok:
+		return nil
+	case spec.Write:
+		return []string{"write"}
+	default:
+		return []string{"read"}
+	}
+}
+
+func inCategory(cats []string, category string) bool {
+	if category == "all" {
+		return true
+	}
+	for _, c := range cats {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// commandKeys 返回命令访问的 key；MIGRATE 的 key 位置不固定，单独处理。
+func commandKeys(cmd string, args []string) []string {
+	if cmd != "MIGRATE" {
+		return db.CommandKeys(args)
+	}
+	if len(args) > 3 && args[3] != "" {
+		return []string{args[3]}
+	}
+	for i := 6; i < len(args); i++ {
+		if strings.EqualFold(args[i], "KEYS") {
+			return args[i+1:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Load 从 ACL 文件加载用户，替换当前全部用户。文件每行格式与 ACL LIST 相同：user <name> <rule> ...，
+// 空行与 # 开头的行被忽略；任一行出错时不做任何修改。文件中没有默认用户时使用默认配置。
+func (a *ACL) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	users := make(map[string]*User)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "user" {
+			return fmt.Errorf("%s:%d: line should start with user keyword", path, lineNo)
+		}
+		name := fields[1]
+		if _, dup := users[name]; dup {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", path, lineNo, name)
+		}
+		user := newUser(name)
+		for _, rule := range fields[2:] {
+			if err := user.apply(rule); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		}
+		users[name] = user
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := users[DefaultUser]; !ok {
+		users[DefaultUser] = defaultUser()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users = users
+	return nil
+}
+
+// Save 把全部用户写入 ACL 文件，先写临时文件再原子替换。
+func (a *ACL) Save(path string) error {
+	a.mu.RLock()
+	lines := a.listLocked()
+	a.mu.RUnlock()
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, line := range lines {
+		_, _ = writer.WriteString(line + "\n")
+	}
+	if err = writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,158 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultGossipInterval 默认 gossip 周期。
+const DefaultGossipInterval = 500 * time.Millisecond
+
+// DefaultNodeTimeout 默认节点超时（对应 Redis 的 cluster-node-timeout）。
+const DefaultNodeTimeout = 15 * time.Second
+
+// Bus 集群总线：节点之间通过 TCP 交换 JSON 编码的 GossipMessage。
+// 每次交换使用一条短连接：发送方写入 PING/MEET，接收方合并后回复 PONG。
+type Bus struct {
+	state    *State
+	logger   *slog.Logger
+	interval time.Duration
+	// nodeTimeout 超过该时长没有收到 PONG 的节点视为连接断开。
+	nodeTimeout time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewBus 创建集群总线。
+func NewBus(state *State, logger *slog.Logger) *Bus {
+	return &Bus{state: state, logger: logger, interval: DefaultGossipInterval, nodeTimeout: DefaultNodeTimeout}
+}
+
+// SetInterval 设置 gossip 周期。
+func (b *Bus) SetInterval(interval time.Duration) {
+	if interval > 0 {
+		b.interval = interval
+	}
+}
+
+// SetNodeTimeout 设置节点超时。
+func (b *Bus) SetNodeTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		b.nodeTimeout = timeout
+	}
+}
+
+// NodeTimeout 返回节点超时。
+func (b *Bus) NodeTimeout() time.Duration {
+	return b.nodeTimeout
+}
+
+// Listen 绑定总线地址。
+func (b *Bus) Listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.listener = ln
+	b.mu.Unlock()
+	return nil
+}
+
+// Addr 返回总线监听地址。
+func (b *Bus) Addr() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.listener == nil {
+		return ""
+	}
+	return b.listener.Addr().String()
+}
+
+// Serve 处理入站 gossip 并周期性 PING 已知节点，直到 ctx 取消。
+func (b *Bus) Serve(ctx context.Context) {
+	b.mu.Lock()
+	ln := b.listener
+	b.mu.Unlock()
+	if ln == nil {
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	go b.pingLoop(ctx)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+// Meet 向指定总线地址发送 MEET，握手成功后对方即加入本节点视图。
+func (b *Bus) Meet(ctx context.Context, busAddr string) error {
+	reply, err := b.exchange(ctx, busAddr, b.state.NewMessage(GossipMeet))
+	if err != nil {
+		return err
+	}
+	b.state.HandleMessage(reply)
+	return nil
+}
+
+func (b *Bus) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var msg GossipMessage
+	if err := json.NewDecoder(conn).Decode(&msg); err != nil {
+		return
+	}
+	if discovered := b.state.HandleMessage(msg); discovered > 0 {
+		b.logger.Info("cluster nodes discovered", "from", msg.SenderID, "count", discovered)
+	}
+	_ = json.NewEncoder(conn).Encode(b.state.NewMessage(GossipPong))
+}
+
+func (b *Bus) pingLoop(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, addr := range b.state.BusAddrs() {
+				reply, err := b.exchange(ctx, addr, b.state.NewMessage(GossipPing))
+				if err != nil {
+					continue
+				}
+				b.state.HandleMessage(reply)
+			}
+		}
+	}
+}
+
+func (b *Bus) exchange(ctx context.Context, addr string, msg GossipMessage) (GossipMessage, error) {
+	dialer := net.Dialer{Timeout: time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return GossipMessage{}, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if err = json.NewEncoder(conn).Encode(msg); err != nil {
+		return GossipMessage{}, err
+	}
+	var reply GossipMessage
+	if err = json.NewDecoder(conn).Decode(&reply); err != nil {
+		return GossipMessage{}, err
+	}
+	return reply, nil
+}
@@ -1,28 +1,82 @@
 package cluster
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"hash/crc32"
+	"sort"
+	"sync"
+	"time"
 )
 
-var ErrMoved = errors.New("moved")
+var (
+	ErrMoved    = errors.New("moved")
+	ErrSlotBusy = errors.New("slot is already busy")
+)
 
 // Node 集群节点。
 type Node struct {
-	ID    string
-	Addr  string
-	Slots []SlotRange
+	ID          string
+	Addr        string
+	BusAddr     string
+	Slots       []SlotRange
+	ConfigEpoch uint64
+	LastPong    time.Time
 }
 
-// State 集群状态。
+// State 集群状态，方法均为并发安全。
 type State struct {
-	Nodes   map[string]*Node
-	SlotMap [TotalSlots]*Node
+	mu           sync.RWMutex
+	Nodes        map[string]*Node
+	SlotMap      [TotalSlots]*Node
+	myself       *Node
+	currentEpoch uint64
+	migrating    map[uint16]*Node
+	importing    map[uint16]*Node
 }
 
 // NewState 创建集群状态。
 func NewState() *State {
-	return &State{Nodes: make(map[string]*Node)}
+	return &State{
+		Nodes:     make(map[string]*Node),
+		migrating: make(map[uint16]*Node),
+		importing: make(map[uint16]*Node),
+	}
+}
+
+// NewLocalState 创建以本节点为起点的集群状态。
+func NewLocalState(addr, busAddr string) *State {
+	s := NewState()
+	s.myself = &Node{ID: NewNodeID(), Addr: addr, BusAddr: busAddr}
+	s.Nodes[s.myself.ID] = s.myself
+	return s
+}
+
+// NewNodeID 生成 40 位十六进制节点 ID。
+func NewNodeID() string {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Myself 返回本节点副本。
+func (s *State) Myself() Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.myself == nil {
+		return Node{}
+	}
+	return s.copyNode(s.myself)
+}
+
+// SetMyAddr 更新本节点地址（监听随机端口时在启动后回填）。
+func (s *State) SetMyAddr(addr, busAddr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.myself != nil {
+		s.myself.Addr = addr
+		s.myself.BusAddr = busAddr
+	}
 }
 
 // AddNode 添加节点并建立 slot 映射。
@@ -30,9 +84,11 @@ func (s *State) AddNode(node *Node) {
 	if node == nil {
 		return
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.Nodes[node.ID] = node
 	for _, r := range node.Slots {
-		for slot := r.Start; slot <= r.End && slot < TotalSlots; slot++ {
+		for slot := int(r.Start); slot <= int(r.End) && slot < TotalSlots; slot++ {
 			s.SlotMap[slot] = node
 		}
 	}
@@ -41,14 +97,157 @@ func (s *State) AddNode(node *Node) {
 // ResolveNode 根据 key 定位节点。
 func (s *State) ResolveNode(key string) (*Node, uint16, error) {
 	slot := KeyToSlot(key)
+	s.mu.RLock()
 	node := s.SlotMap[slot]
+	s.mu.RUnlock()
 	if node == nil {
 		return nil, slot, ErrMoved
 	}
 	return node, slot, nil
 }
 
-// KeyToSlot 计算 key slot。
-func KeyToSlot(key string) uint16 {
-	return uint16(crc32.ChecksumIEEE([]byte(key)) % TotalSlots)
+// Lookup 返回 slot 负责节点的副本，未分配时 ok 为 false。
+func (s *State) Lookup(slot uint16) (Node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	node := s.SlotMap[slot]
+	if node == nil {
+		return Node{}, false
+	}
+	return s.copyNode(node), true
+}
+
+// IsMine 判断 slot 是否由本节点负责。
+func (s *State) IsMine(slot uint16) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.myself != nil && s.SlotMap[slot] == s.myself
+}
+
+// AddSlots 将 slot 分配给本节点，任一 slot 已被占用时整体失败。
+func (s *State) AddSlots(slots []uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, slot := range slots {
+		if s.SlotMap[slot] != nil {
+			return ErrSlotBusy
+		}
+	}
+	for _, slot := range slots {
+		s.SlotMap[slot] = s.myself
+	}
+	s.rebuildSlotsLocked(s.myself)
+	return nil
+}
+
+// CurrentEpoch 返回当前纪元。
+func (s *State) CurrentEpoch() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.currentEpoch
+}
+
+// Meet 记录通过 CLUSTER MEET 或 gossip 得知的节点，返回是否为新节点。
+func (s *State) Meet(info NodeInfo) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mergeLocked(info, false)
+}
+
+// Snapshot 返回按 ID 排序的节点副本列表。
+func (s *State) Snapshot() []Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nodes := make([]Node, 0, len(s.Nodes))
+	for _, node := range s.Nodes {
+		nodes = append(nodes, s.copyNode(node))
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// AssignedSlots 返回已分配的 slot 数。
+func (s *State) AssignedSlots() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	count := 0
+	for _, node := range s.SlotMap {
+		if node != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *State) copyNode(node *Node) Node {
+	copied := *node
+	copied.Slots = append([]SlotRange(nil), node.Slots...)
+	return copied
+}
+
+// rebuildSlotsLocked 根据 SlotMap 重新计算节点的 slot 区间。
+func (s *State) rebuildSlotsLocked(node *Node) {
+	if node == nil {
+		return
+	}
+	slots := make([]uint16, 0)
+	for slot, owner := range s.SlotMap {
+		if owner == node {
+			slots = append(slots, uint16(slot))
+		}
+	}
+	node.Slots = rangesFromSlots(slots)
+}
+
+// mergeLocked 合并一条节点信息，返回是否为新节点。
+// authoritative 为 true 表示信息来自节点本身；第三方转述的信息只用于发现新节点。
+// slot 冲突时按 ConfigEpoch 取较新者，与 Redis 的 slot 冲突解决规则一致。
+func (s *State) mergeLocked(info NodeInfo, authoritative bool) bool {
+	if info.ID == "" || (s.myself != nil && info.ID == s.myself.ID) {
+		return false
+	}
+	node, exists := s.Nodes[info.ID]
+	if !exists {
+		node = &Node{ID: info.ID}
+		s.Nodes[info.ID] = node
+	}
+	if info.Addr != "" {
+		node.Addr = info.Addr
+	}
+	if info.BusAddr != "" {
+		node.BusAddr = info.BusAddr
+	}
+	if exists && !authoritative {
+		return false
+	}
+
+	if info.ConfigEpoch > node.ConfigEpoch {
+		node.ConfigEpoch = info.ConfigEpoch
+	}
+	if info.ConfigEpoch > s.currentEpoch {
+		s.currentEpoch = info.ConfigEpoch
+	}
+	affected := map[*Node]struct{}{node: {}}
+	for _, r := range info.Slots {
+		for slot := int(r.Start); slot <= int(r.End) && slot < TotalSlots; slot++ {
+			owner := s.SlotMap[slot]
+			if owner == node {
+				continue
+			}
+			if owner == nil || node.ConfigEpoch > owner.ConfigEpoch {
+				if owner != nil {
+					affected[owner] = struct{}{}
+				}
+				if owner == s.myself {
+					// slot 已被目标节点接管，迁出状态随之结束。
+					delete(s.migrating, uint16(slot))
+				}
+				s.SlotMap[slot] = node
+			}
+		}
+	}
+	for changed := range affected {
+		s.rebuildSlotsLocked(changed)
+	}
+	return !exists
 }
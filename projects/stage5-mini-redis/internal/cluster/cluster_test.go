@@ -15,3 +15,104 @@ func TestClusterResolve(t *testing.T) {
 		t.Fatalf("node is nil for slot %d", slot)
 	}
 }
+
+func TestKeyToSlotMatchesRedis(t *testing.T) {
+	cases := map[string]uint16{
+		"foo":                  12182,
+		"bar":                  5061,
+		"{user1000}.following": 3443,
+		"{user1000}.followers": 3443,
+		"foo{}{bar}":           8363,
+		"foo{{bar}}zap":        4015,
+	}
+	for key, want := range cases {
+		if got := KeyToSlot(key); got != want {
+			t.Fatalf("KeyToSlot(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestGossipMergeResolvesSlotConflictsByEpoch(t *testing.T) {
+	a := NewLocalState("127.0.0.1:7001", "127.0.0.1:17001")
+	if err := a.AddSlots([]uint16{0, 1, 2}); err != nil {
+		t.Fatalf("AddSlots() error = %v", err)
+	}
+	if err := a.AddSlots([]uint16{2, 3}); err != ErrSlotBusy {
+		t.Fatalf("AddSlots(busy) error = %v, want ErrSlotBusy", err)
+	}
+
+	b := NewLocalState("127.0.0.1:7002", "127.0.0.1:17002")
+	_ = b.AddSlots([]uint16{100})
+	c := NewLocalState("127.0.0.1:7003", "127.0.0.1:17003")
+
+	// b 认识 c，a 从 b 的 gossip 中同时学到 b 与 c。
+	b.HandleMessage(c.NewMessage(GossipPong))
+	if discovered := a.HandleMessage(b.NewMessage(GossipPing)); discovered != 2 {
+		t.Fatalf("discovered = %d, want 2", discovered)
+	}
+	if owner, ok := a.Lookup(100); !ok || owner.ID != b.Myself().ID {
+		t.Fatalf("slot 100 owner = %+v, want b", owner)
+	}
+
+	msg := b.NewMessage(GossipPing)
+	msg.Sender.Slots = []SlotRange{{Start: 1, End: 1}}
+	msg.Sender.ConfigEpoch = 0
+	a.HandleMessage(msg)
+	if !a.IsMine(1) {
+		t.Fatal("claim with equal epoch must not steal the slot")
+	}
+	msg.Sender.ConfigEpoch = 5
+	a.HandleMessage(msg)
+	if a.IsMine(1) {
+		t.Fatal("claim with higher epoch should win the slot")
+	}
+	if got := a.Myself().Slots; len(got) != 2 || got[0].String() != "0" || got[1].String() != "2" {
+		t.Fatalf("myself slots = %v, want [0 2]", got)
+	}
+}
+
+func TestSlotMigrationHandoffBumpsEpoch(t *testing.T) {
+	source := NewLocalState("127.0.0.1:7001", "127.0.0.1:17001")
+	target := NewLocalState("127.0.0.1:7002", "127.0.0.1:17002")
+	_ = source.AddSlots([]uint16{42})
+	source.HandleMessage(target.NewMessage(GossipPing))
+	target.HandleMessage(source.NewMessage(GossipPong))
+	targetID, sourceID := target.Myself().ID, source.Myself().ID
+
+	if err := target.SetMigrating(42, sourceID); err != ErrNotSlotOwner {
+		t.Fatalf("SetMigrating on non-owner error = %v, want ErrNotSlotOwner", err)
+	}
+	if err := source.SetImporting(42, targetID); err != ErrSlotIsMine {
+		t.Fatalf("SetImporting on owner error = %v, want ErrSlotIsMine", err)
+	}
+	if err := source.SetMigrating(42, "unknown"); err != ErrUnknownNode {
+		t.Fatalf("SetMigrating(unknown) error = %v, want ErrUnknownNode", err)
+	}
+	if err := target.SetImporting(42, sourceID); err != nil {
+		t.Fatalf("SetImporting() error = %v", err)
+	}
+	if err := source.SetMigrating(42, targetID); err != nil {
+		t.Fatalf("SetMigrating() error = %v", err)
+	}
+	if node, ok := source.Migrating(42); !ok || node.ID != targetID {
+		t.Fatalf("Migrating(42) = %+v, %v", node, ok)
+	}
+
+	// 只在目标节点执行 SETSLOT NODE，源节点通过 gossip 得知新的归属并结束迁出状态。
+	if err := target.SetSlotNode(42, targetID); err != nil {
+		t.Fatalf("SetSlotNode() error = %v", err)
+	}
+	if _, ok := target.Importing(42); ok {
+		t.Fatal("importing state should be cleared after SETSLOT NODE")
+	}
+	if target.Myself().ConfigEpoch <= source.Myself().ConfigEpoch {
+		t.Fatal("new owner must bump its config epoch")
+	}
+	source.HandleMessage(target.NewMessage(GossipPing))
+	if source.IsMine(42) {
+		t.Fatal("source should learn the new owner from gossip")
+	}
+	if _, ok := source.Migrating(42); ok {
+		t.Fatal("migrating state should be cleared once the slot is taken over")
+	}
+}
@@ -8,12 +8,89 @@ type GossipType string
 const (
 	GossipPing GossipType = "PING"
 	GossipPong GossipType = "PONG"
+	GossipMeet GossipType = "MEET"
 )
 
+// NodeInfo gossip 中携带的节点视图。
+type NodeInfo struct {
+	ID          string
+	Addr        string
+	BusAddr     string
+	ConfigEpoch uint64
+	Slots       []SlotRange
+}
+
 // GossipMessage gossip 消息。
+// Sender 为发送方自身信息（权威），Known 为发送方已知的其他节点（用于传播发现）。
 type GossipMessage struct {
 	SenderID string
 	Type     GossipType
 	Epoch    uint64
 	SentAt   time.Time
+	Sender   NodeInfo
+	Known    []NodeInfo
+}
+
+// NewMessage 基于当前状态构造 gossip 消息。
+func (s *State) NewMessage(msgType GossipType) GossipMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	msg := GossipMessage{Type: msgType, Epoch: s.currentEpoch, SentAt: time.Now()}
+	if s.myself != nil {
+		msg.SenderID = s.myself.ID
+		msg.Sender = nodeInfo(s.myself)
+	}
+	for id, node := range s.Nodes {
+		if s.myself != nil && id == s.myself.ID {
+			continue
+		}
+		msg.Known = append(msg.Known, nodeInfo(node))
+	}
+	return msg
+}
+
+// HandleMessage 合并收到的 gossip 消息，返回新发现的节点数。
+func (s *State) HandleMessage(msg GossipMessage) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.Epoch > s.currentEpoch {
+		s.currentEpoch = msg.Epoch
+	}
+	discovered := 0
+	if s.mergeLocked(msg.Sender, true) {
+		discovered++
+	}
+	if sender, ok := s.Nodes[msg.Sender.ID]; ok && msg.Type != GossipPing {
+		sender.LastPong = time.Now()
+	}
+	for _, info := range msg.Known {
+		if s.mergeLocked(info, false) {
+			discovered++
+		}
+	}
+	return discovered
+}
+
+// BusAddrs 返回除本节点外所有节点的 gossip 地址。
+func (s *State) BusAddrs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addrs := make([]string, 0, len(s.Nodes))
+	for id, node := range s.Nodes {
+		if (s.myself != nil && id == s.myself.ID) || node.BusAddr == "" {
+			continue
+		}
+		addrs = append(addrs, node.BusAddr)
+	}
+	return addrs
+}
+
+func nodeInfo(node *Node) NodeInfo {
+	return NodeInfo{
+		ID:          node.ID,
+		Addr:        node.Addr,
+		BusAddr:     node.BusAddr,
+		ConfigEpoch: node.ConfigEpoch,
+		Slots:       append([]SlotRange(nil), node.Slots...),
+	}
 }
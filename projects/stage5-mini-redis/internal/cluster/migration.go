@@ -0,0 +1,108 @@
+package cluster
+
+import "errors"
+
+var (
+	ErrUnknownNode  = errors.New("unknown node id")
+	ErrNotSlotOwner = errors.New("i'm not the owner of hash slot")
+	ErrSlotIsMine   = errors.New("i'm already the owner of hash slot")
+)
+
+// SetMigrating 标记 slot 正在从本节点迁出到 nodeID。
+func (s *State) SetMigrating(slot uint16, nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.SlotMap[slot] != s.myself {
+		return ErrNotSlotOwner
+	}
+	target, ok := s.Nodes[nodeID]
+	if !ok || target == s.myself {
+		return ErrUnknownNode
+	}
+	s.migrating[slot] = target
+	return nil
+}
+
+// SetImporting 标记 slot 正在从 nodeID 迁入本节点。
+func (s *State) SetImporting(slot uint16, nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.SlotMap[slot] == s.myself {
+		return ErrSlotIsMine
+	}
+	source, ok := s.Nodes[nodeID]
+	if !ok || source == s.myself {
+		return ErrUnknownNode
+	}
+	s.importing[slot] = source
+	return nil
+}
+
+// SetStable 清除 slot 的迁移状态。
+func (s *State) SetStable(slot uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+}
+
+// SetSlotNode 将 slot 归属改为 nodeID 并清除迁移状态。
+// 归属改为本节点时提升本节点 ConfigEpoch，使新归属通过 gossip 覆盖其他节点的旧视图。
+func (s *State) SetSlotNode(slot uint16, nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, ok := s.Nodes[nodeID]
+	if !ok {
+		return ErrUnknownNode
+	}
+	previous := s.SlotMap[slot]
+	s.SlotMap[slot] = node
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+	if node == s.myself && previous != s.myself {
+		s.currentEpoch++
+		s.myself.ConfigEpoch = s.currentEpoch
+	}
+	s.rebuildSlotsLocked(node)
+	if previous != nil && previous != node {
+		s.rebuildSlotsLocked(previous)
+	}
+	return nil
+}
+
+// Migrating 返回 slot 的迁出目标节点。
+func (s *State) Migrating(slot uint16) (Node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	node, ok := s.migrating[slot]
+	if !ok {
+		return Node{}, false
+	}
+	return s.copyNode(node), true
+}
+
+// Importing 返回 slot 的迁入来源节点。
+func (s *State) Importing(slot uint16) (Node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	node, ok := s.importing[slot]
+	if !ok {
+		return Node{}, false
+	}
+	return s.copyNode(node), true
+}
+
+// MigrationStates 返回本节点全部迁移中的 slot，键为 slot，值为对端节点 ID。
+func (s *State) MigrationStates() (migrating, importing map[uint16]string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	migrating = make(map[uint16]string, len(s.migrating))
+	for slot, node := range s.migrating {
+		migrating[slot] = node.ID
+	}
+	importing = make(map[uint16]string, len(s.importing))
+	for slot, node := range s.importing {
+		importing[slot] = node.ID
+	}
+	return migrating, importing
+}
@@ -1,5 +1,11 @@
 package cluster
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 const TotalSlots = 16384
 
 // SlotRange slot 范围。
@@ -12,3 +18,66 @@ type SlotRange struct {
 func (r SlotRange) Contains(slot uint16) bool {
 	return slot >= r.Start && slot <= r.End
 }
+
+// String 返回 Redis 风格的范围表示（单个 slot 不带连字符）。
+func (r SlotRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(int(r.Start))
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// ParseSlot 解析并校验 slot 编号。
+func ParseSlot(value string) (uint16, error) {
+	slot, err := strconv.Atoi(value)
+	if err != nil || slot < 0 || slot >= TotalSlots {
+		return 0, fmt.Errorf("invalid slot %q", value)
+	}
+	return uint16(slot), nil
+}
+
+// KeyToSlot 计算 key slot：CRC16(XMODEM) mod 16384，存在非空 {hash tag} 时只对 tag 计算。
+func KeyToSlot(key string) uint16 {
+	return crc16([]byte(HashTag(key))) % TotalSlots
+}
+
+// HashTag 返回 key 中参与 slot 计算的部分。
+func HashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// rangesFromSlots 将有序 slot 列表压缩为连续区间。
+func rangesFromSlots(slots []uint16) []SlotRange {
+	ranges := make([]SlotRange, 0)
+	for _, slot := range slots {
+		if n := len(ranges); n > 0 && ranges[n-1].End+1 == slot {
+			ranges[n-1].End = slot
+			continue
+		}
+		ranges = append(ranges, SlotRange{Start: slot, End: slot})
+	}
+	return ranges
+}
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
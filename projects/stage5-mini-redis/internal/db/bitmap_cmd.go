@@ -0,0 +1,400 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// maxBitOffset 位偏移上限（不含），与 Redis 相同限制字符串最多 512MB。
+const maxBitOffset = 1 << 32
+
+var (
+	ErrBitOffset = errors.New("bit offset is not an integer or out of range")
+	ErrBitValue  = errors.New("bit is not an integer or out of range")
+	ErrBitOpNot  = errors.New("BITOP NOT must be called with a single source key.")
+)
+
+// BitRange BITCOUNT / BITPOS 的区间参数，Start、End 为闭区间且可为负数（从末尾倒数）。
+// Bit 为 true 时按位计，否则按字节计；HasEnd 为 false 表示未指定 End（取到末尾）。
+type BitRange struct {
+	Start  int64
+	End    int64
+	HasEnd bool
+	Bit    bool
+}
+
+// SetBit 设置字符串第 offset 位（最高位为第 0 位）并返回原值，字符串不够长时以 0 字节补齐。
+func (d *DB) SetBit(ctx context.Context, key string, offset uint64, value byte) (byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if offset >= maxBitOffset {
+		return 0, ErrBitOffset
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if ok && entry.Type != TypeString {
+		return 0, ErrWrongType
+	}
+	var old string
+	if ok {
+		old = entry.Value.(string)
+	}
+	byteIndex := int(offset >> 3)
+	buf := []byte(old)
+	if byteIndex >= len(buf) {
+		buf = append(buf, make([]byte, byteIndex+1-len(buf))...)
+	}
+	mask := byte(0x80) >> (offset & 7)
+	prev := byte(0)
+	if buf[byteIndex]&mask != 0 {
+		prev = 1
+	}
+	if value == 1 {
+		buf[byteIndex] |= mask
+	} else {
+		buf[byteIndex] &^= mask
+	}
+	if ok {
+		entry.Value = string(buf)
+		d.growLocked(key, entry, int64(len(buf)-len(old)))
+	} else {
+		d.setEntryLocked(key, &Entry{Type: TypeString, Value: string(buf)})
+	}
+	d.notify(NotifyString, "setbit", key)
+	return prev, nil
+}
+
+// GetBit 返回字符串第 offset 位，超出长度或 key 不存在时为 0。
+func (d *DB) GetBit(ctx context.Context, key string, offset uint64) (byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if offset >= maxBitOffset {
+		return 0, ErrBitOffset
+	}
+
+	value, _, err := d.bitmapValue(key)
+	if err != nil {
+		return 0, err
+	}
+	byteIndex := offset >> 3
+	if byteIndex >= uint64(len(value)) {
+		return 0, nil
+	}
+	return value[byteIndex] >> (7 - offset&7) & 1, nil
+}
+
+// BitCount 统计区间内值为 1 的位数，r 为 nil 时统计整个字符串。
+func (d *DB) BitCount(ctx context.Context, key string, r *BitRange) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	value, _, err := d.bitmapValue(key)
+	if err != nil {
+		return 0, err
+	}
+	first, last, ok := bitSpan(len(value), r)
+	if !ok {
+		return 0, nil
+	}
+	return countBits(value, first, last), nil
+}
+
+// BitPos 返回区间内第一个值为 bit 的位的位置。查找 0 且未指定 End 时，字符串右侧视为补 0；
+// 找不到时返回 -1。key 不存在时查找 1 返回 -1，查找 0 返回 0。
+func (d *DB) BitPos(ctx context.Context, key string, bit byte, r *BitRange) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	value, ok, err := d.bitmapValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		if bit == 1 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+	first, last, ok := bitSpan(len(value), r)
+	if !ok {
+		return -1, nil
+	}
+	for pos := first; pos <= last; pos++ {
+		// 整字节都不含目标位时直接跳过。
+		if pos&7 == 0 && pos+7 <= last {
+			b := value[pos>>3]
+			if (bit == 1 && b == 0) || (bit == 0 && b == 0xff) {
+				pos += 7
+				continue
+			}
+		}
+		if value[pos>>3]>>(7-pos&7)&1 == bit {
+			return pos, nil
+		}
+	}
+	if bit == 0 && (r == nil || !r.HasEnd) {
+		return last + 1, nil
+	}
+	return -1, nil
+}
+
+// BitOp 对 keys 对应的字符串做按位运算并写入 dest，返回结果长度。较短的字符串视为以 0 补齐，
+// 不存在的 key 视为空串；结果为空时删除 dest。op 为 AND、OR、XOR 或 NOT（大写）。
+func (d *DB) BitOp(ctx context.Context, op, dest string, keys []string) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(keys) != 1 {
+			return 0, ErrBitOpNot
+		}
+	default:
+		return 0, ErrInvalidCommand
+	}
+
+	unlock := d.lockKeys(append([]string{dest}, keys...)...)
+	defer unlock()
+	sources := make([]string, len(keys))
+	size := 0
+	for i, key := range keys {
+		entry, ok := d.lookupLocked(key)
+		if !ok {
+			continue
+		}
+		if entry.Type != TypeString {
+			return 0, ErrWrongType
+		}
+		sources[i] = entry.Value.(string)
+		size = max(size, len(sources[i]))
+	}
+	if size == 0 {
+		if d.deleteLocked(dest) {
+			d.notify(NotifyGeneric, "del", dest)
+		}
+		return 0, nil
+	}
+
+	result := make([]byte, size)
+	copy(result, sources[0])
+	if op == "NOT" {
+		for i := range result {
+			result[i] = ^result[i]
+		}
+	}
+	for _, src := range sources[1:] {
+		for i := range result {
+			var b byte
+			if i < len(src) {
+				b = src[i]
+			}
+			switch op {
+			case "AND":
+				result[i] &= b
+			case "OR":
+				result[i] |= b
+			case "XOR":
+				result[i] ^= b
+			}
+		}
+	}
+	d.setEntryLocked(dest, &Entry{Type: TypeString, Value: string(result)})
+	d.notify(NotifyString, "set", dest)
+	return int64(size), nil
+}
+
+// bitmapValue 读取字符串值，key 不存在时返回空串与 false。
+func (d *DB) bitmapValue(key string) (string, bool, error) {
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
+		return "", false, nil
+	}
+	if entry.Type != TypeString {
+		return "", false, ErrWrongType
+	}
+	return entry.Value.(string), true, nil
+}
+
+// bitSpan 按 Redis 的规则把区间参数规整为长度为 n 字节的字符串中的位区间 [first, last]，区间为空时返回 false。
+func bitSpan(n int, r *BitRange) (int64, int64, bool) {
+	total := int64(n)
+	start, end := int64(0), total-1
+	if r != nil {
+		if r.Bit {
+			total *= 8
+		}
+		start, end = r.Start, total-1
+		if r.HasEnd {
+			end = r.End
+		}
+		if start < 0 {
+			start += total
+		}
+		if end < 0 {
+			end += total
+		}
+		start, end = max(start, 0), max(end, 0)
+		end = min(end, total-1)
+	}
+	if start > end {
+		return 0, 0, false
+	}
+	if r != nil && r.Bit {
+		return start, end, true
+	}
+	return start * 8, end*8 + 7, true
+}
+
+// countBits 统计 value 中位区间 [first, last] 内值为 1 的位数。
+func countBits(value string, first, last int64) int64 {
+	var count int64
+	for i := first >> 3; i <= last>>3; i++ {
+		b := value[i]
+		if i == first>>3 {
+			b &= 0xff >> (first & 7)
+		}
+		if i == last>>3 {
+			b &= 0xff << (7 - last&7)
+		}
+		count += int64(bits.OnesCount8(b))
+	}
+	return count
+}
+
+func (d *DB) executeBitmapCommand(ctx context.Context, cmd string, args []string) (*protocol.Value, error) {
+	switch cmd {
+	case "SETBIT":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
+		}
+		offset, err := parseBitOffset(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if args[3] != "0" && args[3] != "1" {
+			return nil, ErrBitValue
+		}
+		prev, err := d.SetBit(ctx, args[1], offset, args[3][0]-'0')
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(prev)), nil
+	case "GETBIT":
+		if len(args) != 3 {
+			return nil, ErrInvalidCommand
+		}
+		offset, err := parseBitOffset(args[2])
+		if err != nil {
+			return nil, err
+		}
+		bit, err := d.GetBit(ctx, args[1], offset)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(bit)), nil
+	case "BITCOUNT":
+		if len(args) != 2 && len(args) != 4 && len(args) != 5 {
+			return nil, ErrInvalidCommand
+		}
+		r, err := parseBitRange(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		count, err := d.BitCount(ctx, args[1], r)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(count), nil
+	case "BITPOS":
+		if len(args) < 3 || len(args) > 6 {
+			return nil, ErrInvalidCommand
+		}
+		if args[2] != "0" && args[2] != "1" {
+			return nil, errors.New("the bit argument must be 1 or 0.")
+		}
+		r, err := parseBitRange(args[3:])
+		if err != nil {
+			return nil, err
+		}
+		pos, err := d.BitPos(ctx, args[1], args[2][0]-'0', r)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(pos), nil
+	case "BITOP":
+		if len(args) < 4 {
+			return nil, ErrInvalidCommand
+		}
+		n, err := d.BitOp(ctx, strings.ToUpper(args[1]), args[2], args[3:])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(n), nil
+	}
+	return nil, ErrInvalidCommand
+}
+
+func parseBitOffset(arg string) (uint64, error) {
+	offset, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil || offset >= maxBitOffset {
+		return 0, ErrBitOffset
+	}
+	return offset, nil
+}
+
+// parseBitRange 解析 [start [end [BYTE|BIT]]]，无参数时返回 nil。
+func parseBitRange(args []string) (*BitRange, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	r := &BitRange{}
+	var err error
+	if r.Start, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+		return nil, err
+	}
+	if len(args) > 1 {
+		if r.End, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return nil, err
+		}
+		r.HasEnd = true
+	}
+	if len(args) > 2 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			r.Bit = true
+		default:
+			return nil, ErrInvalidCommand
+		}
+	}
+	return r, nil
+}
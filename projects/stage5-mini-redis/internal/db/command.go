@@ -3,84 +3,109 @@ package db
 import (
 	"context"
 	"errors"
-	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 )
 
 var ErrInvalidCommand = errors.New("invalid command")
 
-// ExecuteCommand 执行命令并返回字符串结果。
-func (d *DB) ExecuteCommand(ctx context.Context, args []string) (string, error) {
+// ErrInvalidExpireTime SET 的 EX 不是正数（与 Redis 一致，拒绝而不是写入不带过期时间的 key）。
+var ErrInvalidExpireTime = errors.New("invalid expire time in 'set' command")
+
+// ExecuteCommand 执行命令并返回类型化的 RESP 回复。执行期间持有命令涉及分片的命令锁：
+// 读命令共享、写命令独占，因此不会看到事务或其他写命令的中间状态。
+func (d *DB) ExecuteCommand(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) == 0 {
+		return nil, ErrInvalidCommand
+	}
+	var result *protocol.Value
+	var err error
+	d.AtomicCommand(args, func(tx *Tx) {
+		result, err = tx.ExecuteCommand(ctx, args)
+	})
+	return result, err
+}
+
+func (d *DB) executeCommand(ctx context.Context, args []string) (*protocol.Value, error) {
 	if len(args) == 0 {
-		return "", ErrInvalidCommand
+		return nil, ErrInvalidCommand
 	}
 	cmd := strings.ToUpper(args[0])
 
 	switch cmd {
 	case "PING":
-		return "PONG", nil
+		return protocol.SimpleStringValue("PONG"), nil
 	case "ECHO":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
-		return args[1], nil
+		return protocol.BulkStringValue(args[1]), nil
 	case "SET":
 		if len(args) < 3 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		ttl := time.Duration(0)
 		if len(args) >= 5 && strings.EqualFold(args[3], "EX") {
 			seconds, err := strconv.Atoi(args[4])
 			if err != nil {
-				return "", err
+				return nil, err
+			}
+			if seconds <= 0 {
+				return nil, ErrInvalidExpireTime
 			}
 			ttl = time.Duration(seconds) * time.Second
 		}
 		if err := d.SetString(ctx, args[1], args[2], ttl); err != nil {
-			return "", err
+			return nil, err
 		}
-		return "OK", nil
+		return protocol.OK(), nil
 	case "GET":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		value, ok, err := d.GetString(ctx, args[1])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if !ok {
-			return "(nil)", nil
+			return protocol.NullValue(), nil
 		}
-		return value, nil
+		return protocol.BulkStringValue(value), nil
 	case "DEL":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
-		}
-		deleted, err := d.Del(ctx, args[1])
-		if err != nil {
-			return "", err
+			return nil, ErrInvalidCommand
 		}
-		if deleted {
-			return "1", nil
+		deleted := 0
+		for _, key := range args[1:] {
+			ok, err := d.Del(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				deleted++
+			}
 		}
-		return "0", nil
+		return protocol.IntegerValue(int64(deleted)), nil
 	case "EXISTS":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
-		exists, err := d.Exists(ctx, args[1])
-		if err != nil {
-			return "", err
-		}
-		if exists {
-			return "1", nil
+		count := 0
+		for _, key := range args[1:] {
+			exists, err := d.Exists(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				count++
+			}
 		}
-		return "0", nil
+		return protocol.IntegerValue(int64(count)), nil
 	case "KEYS":
 		pattern := "*"
 		if len(args) >= 2 {
@@ -88,172 +113,467 @@ func (d *DB) ExecuteCommand(ctx context.Context, args []string) (string, error)
 		}
 		keys, err := d.Keys(ctx, pattern)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return strings.Join(keys, ","), nil
+		return protocol.StringArray(keys), nil
+	case "SCAN", "SSCAN", "HSCAN", "ZSCAN":
+		return d.executeScanCommand(ctx, cmd, args)
+	case "TYPE":
+		if len(args) != 2 {
+			return nil, ErrInvalidCommand
+		}
+		name, err := d.Type(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.SimpleStringValue(name), nil
 	case "EXPIRE":
 		if len(args) < 3 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		seconds, err := strconv.Atoi(args[2])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		ok, err := d.Expire(ctx, args[1], time.Duration(seconds)*time.Second)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		if ok {
+			return protocol.IntegerValue(1), nil
+		}
+		return protocol.IntegerValue(0), nil
+	case "PEXPIREAT":
+		if len(args) < 3 {
+			return nil, ErrInvalidCommand
+		}
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := d.ExpireAt(ctx, args[1], time.UnixMilli(ms))
+		if err != nil {
+			return nil, err
 		}
 		if ok {
-			return "1", nil
+			return protocol.IntegerValue(1), nil
 		}
-		return "0", nil
+		return protocol.IntegerValue(0), nil
 	case "TTL":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		ttl, err := d.TTL(ctx, args[1])
 		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("%d", ttl), nil
-	case "LPUSH":
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(ttl)), nil
+	case "SETBIT", "GETBIT", "BITCOUNT", "BITPOS", "BITOP":
+		return d.executeBitmapCommand(ctx, cmd, args)
+	case "PFADD", "PFCOUNT", "PFMERGE":
+		return d.executeHLLCommand(ctx, cmd, args)
+	case "LPUSH", "RPUSH":
 		if len(args) < 3 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
+		}
+		push := d.LPush
+		if cmd == "RPUSH" {
+			push = d.RPush
 		}
-		length, err := d.LPush(ctx, args[1], args[2])
+		length, err := push(ctx, args[1], args[2:]...)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(length)), nil
+	case "LPOP", "RPOP":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, ErrInvalidCommand
+		}
+		left := cmd == "LPOP"
+		if len(args) == 2 {
+			pop := d.RPop
+			if left {
+				pop = d.LPop
+			}
+			value, ok, err := pop(ctx, args[1])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return protocol.NullValue(), nil
+			}
+			return protocol.BulkStringValue(value), nil
 		}
-		return fmt.Sprintf("%d", length), nil
-	case "RPUSH":
-		if len(args) < 3 {
-			return "", ErrInvalidCommand
+		count, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, err
 		}
-		length, err := d.RPush(ctx, args[1], args[2])
+		if count < 0 {
+			return nil, errors.New("value is out of range, must be positive")
+		}
+		popCount := d.RPopCount
+		if left {
+			popCount = d.LPopCount
+		}
+		values, err := popCount(ctx, args[1], count)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return fmt.Sprintf("%d", length), nil
-	case "LPOP":
-		if len(args) < 2 {
-			return "", ErrInvalidCommand
+		if values == nil {
+			return protocol.NullValue(), nil
+		}
+		return protocol.StringArray(values), nil
+	case "LLEN":
+		if len(args) != 2 {
+			return nil, ErrInvalidCommand
+		}
+		n, err := d.LLen(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(n)), nil
+	case "LINDEX":
+		if len(args) != 3 {
+			return nil, ErrInvalidCommand
+		}
+		index, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, err
 		}
-		value, ok, err := d.LPop(ctx, args[1])
+		value, ok, err := d.LIndex(ctx, args[1], index)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if !ok {
-			return "(nil)", nil
+			return protocol.NullValue(), nil
+		}
+		return protocol.BulkStringValue(value), nil
+	case "LSET":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
+		}
+		index, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if err = d.LSet(ctx, args[1], index, args[3]); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case "LREM":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
+		}
+		count, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, err
+		}
+		removed, err := d.LRem(ctx, args[1], count, args[3])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(removed)), nil
+	case "LTRIM":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
+		}
+		start, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, err
+		}
+		stop, err := strconv.Atoi(args[3])
+		if err != nil {
+			return nil, err
+		}
+		if err = d.LTrim(ctx, args[1], start, stop); err != nil {
+			return nil, err
 		}
-		return value, nil
+		return protocol.OK(), nil
+	case "LMOVE", "BLMOVE":
+		if (cmd == "LMOVE" && len(args) != 5) || (cmd == "BLMOVE" && len(args) != 6) {
+			return nil, ErrInvalidCommand
+		}
+		if cmd == "BLMOVE" {
+			// 阻塞由服务层实现，这里（如事务内）只做一次非阻塞移动。
+			if _, err := ParseTimeout(args[5]); err != nil {
+				return nil, err
+			}
+		}
+		fromLeft, err := parseListEnd(args[3])
+		if err != nil {
+			return nil, err
+		}
+		toLeft, err := parseListEnd(args[4])
+		if err != nil {
+			return nil, err
+		}
+		value, ok, err := d.LMove(ctx, args[1], args[2], fromLeft, toLeft)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return protocol.NullValue(), nil
+		}
+		return protocol.BulkStringValue(value), nil
+	case "BLPOP", "BRPOP":
+		if len(args) < 3 {
+			return nil, ErrInvalidCommand
+		}
+		if _, err := ParseTimeout(args[len(args)-1]); err != nil {
+			return nil, err
+		}
+		pop := d.RPop
+		if cmd == "BLPOP" {
+			pop = d.LPop
+		}
+		for _, key := range args[1 : len(args)-1] {
+			value, ok, err := pop(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return protocol.StringArray([]string{key, value}), nil
+			}
+		}
+		return protocol.NullArrayValue(), nil
 	case "LRANGE":
 		if len(args) < 4 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		start, err := strconv.Atoi(args[2])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		stop, err := strconv.Atoi(args[3])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		items, err := d.LRange(ctx, args[1], start, stop)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return strings.Join(items, ","), nil
+		return protocol.StringArray(items), nil
 	case "SADD":
 		if len(args) < 3 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
-		added, err := d.SAdd(ctx, args[1], args[2])
+		added, err := d.SAdd(ctx, args[1], args[2:]...)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		if added {
-			return "1", nil
-		}
-		return "0", nil
+		return protocol.IntegerValue(int64(added)), nil
 	case "SMEMBERS":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		members, err := d.SMembers(ctx, args[1])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return strings.Join(members, ","), nil
+		return stringSet(members), nil
 	case "ZADD":
-		if len(args) < 4 {
-			return "", ErrInvalidCommand
+		if len(args) < 4 || len(args)%2 != 0 {
+			return nil, ErrInvalidCommand
+		}
+		items := make([]ds.ZItem, 0, (len(args)-2)/2)
+		for i := 2; i < len(args); i += 2 {
+			score, err := ParseScore(args[i])
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, ds.ZItem{Member: args[i+1], Score: score})
+		}
+		added, err := d.ZAdd(ctx, args[1], items...)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(added)), nil
+	case "ZINCRBY":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
+		}
+		delta, err := ParseScore(args[2])
+		if err != nil {
+			return nil, err
+		}
+		score, err := d.ZIncrBy(ctx, args[1], args[3], delta)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.DoubleValue(score), nil
+	case "ZREM":
+		if len(args) < 3 {
+			return nil, ErrInvalidCommand
+		}
+		removed, err := d.ZRem(ctx, args[1], args[2:]...)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(removed)), nil
+	case "ZSCORE":
+		if len(args) != 3 {
+			return nil, ErrInvalidCommand
+		}
+		score, ok, err := d.ZScore(ctx, args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return protocol.NullValue(), nil
+		}
+		return protocol.DoubleValue(score), nil
+	case "ZCARD":
+		if len(args) != 2 {
+			return nil, ErrInvalidCommand
+		}
+		count, err := d.ZCard(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(count)), nil
+	case "ZCOUNT":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
 		}
-		score, err := strconv.ParseFloat(args[2], 64)
+		r, err := ParseScoreRange(args[2], args[3])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		if err = d.ZAdd(ctx, args[1], args[3], score); err != nil {
-			return "", err
+		count, err := d.ZCount(ctx, args[1], r)
+		if err != nil {
+			return nil, err
 		}
-		return "1", nil
-	case "ZRANGEBYSCORE":
+		return protocol.IntegerValue(int64(count)), nil
+	case "ZRANK", "ZREVRANK":
+		if len(args) != 3 {
+			return nil, ErrInvalidCommand
+		}
+		rank, ok, err := d.ZRank(ctx, args[1], args[2], cmd == "ZREVRANK")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return protocol.NullValue(), nil
+		}
+		return protocol.IntegerValue(int64(rank)), nil
+	case "ZRANGE", "ZREVRANGE":
 		if len(args) < 4 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
-		min, err := strconv.ParseFloat(args[2], 64)
+		withScores, err := parseWithScores(args[4:])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		max, err := strconv.ParseFloat(args[3], 64)
+		start, err := strconv.Atoi(args[2])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		items, err := d.ZRangeByScore(ctx, args[1], min, max)
+		stop, err := strconv.Atoi(args[3])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		res := make([]string, 0, len(items))
-		for _, item := range items {
-			res = append(res, item.Member)
+		items, err := d.ZRange(ctx, args[1], start, stop, cmd == "ZREVRANGE")
+		if err != nil {
+			return nil, err
 		}
-		return strings.Join(res, ","), nil
-	case "HSET":
+		return zItemsValue(items, withScores), nil
+	case "ZRANGEBYSCORE", "ZREVRANGEBYSCORE":
 		if len(args) < 4 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
+		}
+		withScores, err := parseWithScores(args[4:])
+		if err != nil {
+			return nil, err
+		}
+		// ZREVRANGEBYSCORE 的参数顺序为 max min。
+		min, max := args[2], args[3]
+		if cmd == "ZREVRANGEBYSCORE" {
+			min, max = max, min
+		}
+		r, err := ParseScoreRange(min, max)
+		if err != nil {
+			return nil, err
 		}
-		if err := d.HSet(ctx, args[1], args[2], args[3]); err != nil {
-			return "", err
+		items, err := d.ZRangeByScoreRange(ctx, args[1], r, cmd == "ZREVRANGEBYSCORE")
+		if err != nil {
+			return nil, err
+		}
+		return zItemsValue(items, withScores), nil
+	case "HSET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return nil, ErrInvalidCommand
+		}
+		added, err := d.HSet(ctx, args[1], args[2:]...)
+		if err != nil {
+			return nil, err
 		}
-		return "1", nil
+		return protocol.IntegerValue(int64(added)), nil
 	case "HGET":
 		if len(args) < 3 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		value, ok, err := d.HGet(ctx, args[1], args[2])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if !ok {
-			return "(nil)", nil
+			return protocol.NullValue(), nil
 		}
-		return value, nil
+		return protocol.BulkStringValue(value), nil
 	case "HGETALL":
 		if len(args) < 2 {
-			return "", ErrInvalidCommand
+			return nil, ErrInvalidCommand
 		}
 		values, err := d.HGetAll(ctx, args[1])
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		pairs := make([]string, 0, len(values))
-		for field, value := range values {
-			pairs = append(pairs, field+"="+value)
+		fields := make([]string, 0, len(values))
+		for field := range values {
+			fields = append(fields, field)
 		}
-		sort.Strings(pairs)
-		return strings.Join(pairs, ","), nil
+		sort.Strings(fields)
+		pairs := make([]protocol.Value, 0, len(fields)*2)
+		for _, field := range fields {
+			pairs = append(pairs, *protocol.BulkStringValue(field), *protocol.BulkStringValue(values[field]))
+		}
+		return protocol.MapValue(pairs...), nil
+	case "XADD", "XLEN", "XRANGE", "XREVRANGE", "XREAD", "XREADGROUP", "XGROUP", "XSETID", "XACK", "XPENDING", "XCLAIM":
+		return d.executeStreamCommand(ctx, cmd, args)
 	default:
-		return "", ErrInvalidCommand
+		return nil, ErrInvalidCommand
+	}
+}
+
+func parseWithScores(options []string) (bool, error) {
+	switch {
+	case len(options) == 0:
+		return false, nil
+	case len(options) == 1 && strings.EqualFold(options[0], "WITHSCORES"):
+		return true, nil
+	default:
+		return false, ErrInvalidCommand
+	}
+}
+
+// zItemsValue 返回成员数组，withScores 时成员与分数交替出现（分数为 Double）。
+func zItemsValue(items []ds.ZItem, withScores bool) *protocol.Value {
+	values := make([]protocol.Value, 0, len(items)*2)
+	for _, item := range items {
+		values = append(values, *protocol.BulkStringValue(item.Member))
+		if withScores {
+			values = append(values, *protocol.DoubleValue(item.Score))
+		}
+	}
+	return protocol.ArrayValue(values...)
+}
+
+func stringSet(members []string) *protocol.Value {
+	values := make([]protocol.Value, 0, len(members))
+	for _, member := range members {
+		values = append(values, *protocol.BulkStringValue(member))
 	}
+	return protocol.SetValue(values...)
 }
 
 // ExportZItems 导出 zset 项（供持久化使用）。
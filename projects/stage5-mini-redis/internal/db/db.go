@@ -3,15 +3,23 @@ package db
 import (
 	"context"
 	"errors"
+	"hash/maphash"
+	"math"
 	"sort"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/glob"
 )
 
-var ErrWrongType = errors.New("wrong type operation")
+var (
+	ErrWrongType       = errors.New("wrong type operation")
+	ErrBusyKey         = errors.New("target key name already exists")
+	ErrNoSuchKey       = errors.New("no such key")
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
 
 type ValueType uint8
 
@@ -21,6 +29,7 @@ const (
 	TypeSet
 	TypeZSet
 	TypeHash
+	TypeStream
 )
 
 // Entry 键值条目。
@@ -28,17 +37,52 @@ type Entry struct {
 	Type     ValueType
 	Value    any
 	ExpireAt time.Time
+
+	// size 为近似内存占用；lastAccess（UnixNano）与 freq（对数计数，取值 0-255）供 LRU/LFU 淘汰采样使用，
+	// 读锁下以原子操作更新。
+	size       int64
+	lastAccess int64
+	freq       uint32
 }
 
-// DB 核心内存数据库。
+// DB 核心内存数据库。key 空间按哈希分为 shardCount 个分片，各自持有命令锁与数据锁（见 shard）；
+// 内存占用与统计计数为原子变量，淘汰配置与淘汰池由 evictMu 保护（加锁顺序为 evictMu → 分片锁）。
 type DB struct {
-	mu   sync.RWMutex
-	data map[string]*Entry
+	seed   maphash.Seed
+	shards [shardCount]*shard
+	// tx Tx 不带状态，所有回调共用这一个句柄。
+	tx Tx
+	// notifier keyspace 通知（notify-keyspace-events）。
+	notifier notifier
+
+	evictMu sync.Mutex
+	// maxMemory 在 evictMu 内修改，以原子变量存放使写命令无需加锁即可判断是否超限。
+	maxMemory    atomic.Int64
+	policy       EvictionPolicy
+	samples      int
+	evictionPool []evictionCandidate
+
+	usedMemory  atomic.Int64
+	evictedKeys atomic.Int64
+	expiredKeys atomic.Int64
+	// dirty 为累计修改次数，服务层据此计算上次保存以来的变更数。
+	dirty atomic.Int64
+	// expireCursor 为 ActiveExpire 下一轮开始采样的分片。
+	expireCursor atomic.Uint32
 }
 
 // New 创建 DB。
 func New() *DB {
-	return &DB{data: make(map[string]*Entry)}
+	d := &DB{
+		seed:    maphash.MakeSeed(),
+		policy:  NoEviction,
+		samples: DefaultMaxMemorySamples,
+	}
+	for i := range d.shards {
+		d.shards[i] = newShard(i, d.seed)
+	}
+	d.tx = Tx{d: d}
+	return d
 }
 
 // SetString 设置字符串。
@@ -49,13 +93,18 @@ func (d *DB) SetString(ctx context.Context, key, value string, ttl time.Duration
 	if err := ctx.Err(); err != nil {
 		return err
 	}
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
 	entry := &Entry{Type: TypeString, Value: value}
 	if ttl > 0 {
 		entry.ExpireAt = time.Now().Add(ttl)
 	}
-	d.data[key] = entry
+	d.setEntryLocked(key, entry)
+	d.notify(NotifyString, "set", key)
+	if ttl > 0 {
+		// 与 Redis 相同，带过期时间的 SET 在 set 之后再发出 expire 事件。
+		d.notify(NotifyGeneric, "expire", key)
+	}
 	return nil
 }
 
@@ -68,16 +117,12 @@ func (d *DB) GetString(ctx context.Context, key string) (string, bool, error) {
 		return "", false, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
 	if !ok {
 		return "", false, nil
 	}
-	if d.isExpired(entry) {
-		delete(d.data, key)
-		return "", false, nil
-	}
 	if entry.Type != TypeString {
 		return "", false, ErrWrongType
 	}
@@ -94,12 +139,13 @@ func (d *DB) Del(ctx context.Context, key string) (bool, error) {
 		return false, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	if _, ok := d.data[key]; !ok {
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	if _, ok := d.peekLocked(key); !ok {
 		return false, nil
 	}
-	delete(d.data, key)
+	d.deleteLocked(key)
+	d.notify(NotifyGeneric, "del", key)
 	return true, nil
 }
 
@@ -112,20 +158,13 @@ func (d *DB) Exists(ctx context.Context, key string) (bool, error) {
 		return false, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok {
-		return false, nil
-	}
-	if d.isExpired(entry) {
-		delete(d.data, key)
-		return false, nil
-	}
-	return true, nil
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	_, ok := d.peekRLocked(key)
+	return ok, nil
 }
 
-// Keys 返回匹配 pattern 的 key（支持 * 前后缀模糊）。
+// Keys 返回匹配 glob 模式 pattern 的全部 key，需要遍历整个数据集，大数据量时应使用 Scan。
 func (d *DB) Keys(ctx context.Context, pattern string) ([]string, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -134,17 +173,19 @@ func (d *DB) Keys(ctx context.Context, pattern string) ([]string, error) {
 		return nil, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
 	result := make([]string, 0)
-	for key, entry := range d.data {
-		if d.isExpired(entry) {
-			delete(d.data, key)
-			continue
-		}
-		if matchPattern(key, pattern) {
-			result = append(result, key)
+	for _, sh := range d.shards {
+		sh.mu.Lock()
+		for key, entry := range sh.data {
+			if isExpired(entry) {
+				d.expireLocked(key)
+				continue
+			}
+			if glob.Match(pattern, key) {
+				result = append(result, key)
+			}
 		}
+		sh.mu.Unlock()
 	}
 	sort.Strings(result)
 	return result, nil
@@ -159,13 +200,28 @@ func (d *DB) Expire(ctx context.Context, key string, ttl time.Duration) (bool, e
 		return false, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
+	return d.ExpireAt(ctx, key, time.Now().Add(ttl))
+}
+
+// ExpireAt 设置绝对过期时间。
+func (d *DB) ExpireAt(ctx context.Context, key string, at time.Time) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.peekLocked(key)
 	if !ok {
 		return false, nil
 	}
-	entry.ExpireAt = time.Now().Add(ttl)
+	entry.ExpireAt = at
+	sh.expires[key] = struct{}{}
+	d.touchLocked(key)
+	d.notify(NotifyGeneric, "expire", key)
 	return true, nil
 }
 
@@ -178,107 +234,152 @@ func (d *DB) TTL(ctx context.Context, key string) (int64, error) {
 		return -1, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.peekRLocked(key)
 	if !ok {
 		return -2, nil
 	}
 	if entry.ExpireAt.IsZero() {
 		return -1, nil
 	}
-	if d.isExpired(entry) {
-		delete(d.data, key)
-		return -2, nil
-	}
 	return int64(time.Until(entry.ExpireAt).Seconds()), nil
 }
 
-// Snapshot 返回全量快照副本。
+// Snapshot 返回全量快照副本，复制期间锁住全部分片，得到同一时刻的一致视图。
 func (d *DB) Snapshot() map[string]*Entry {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-	copyData := make(map[string]*Entry, len(d.data))
-	for key, entry := range d.data {
-		entryCopy := *entry
-		switch entry.Type {
-		case TypeSet:
-			s := entry.Value.(map[string]struct{})
-			sCopy := make(map[string]struct{}, len(s))
-			for m := range s {
-				sCopy[m] = struct{}{}
-			}
-			entryCopy.Value = sCopy
-		case TypeHash:
-			h := entry.Value.(map[string]string)
-			hCopy := make(map[string]string, len(h))
-			for f, v := range h {
-				hCopy[f] = v
-			}
-			entryCopy.Value = hCopy
-		case TypeList:
-			list := entry.Value.(*ds.LinkedList)
-			lCopy := &ds.LinkedList{}
-			for _, item := range list.Range(0, 1<<20) {
-				lCopy.RPush(item)
-			}
-			entryCopy.Value = lCopy
-		case TypeZSet:
-			z := entry.Value.(*ds.SkipList)
-			zCopy := ds.NewSkipList()
-			for _, item := range z.RangeByScore(-1<<20, 1<<20) {
-				zCopy.Insert(item.Member, item.Score)
-			}
-			entryCopy.Value = zCopy
+	unlock := d.lockAll()
+	defer unlock()
+	size := 0
+	for _, sh := range d.shards {
+		size += len(sh.data)
+	}
+	copyData := make(map[string]*Entry, size)
+	for _, sh := range d.shards {
+		for key, entry := range sh.data {
+			copyData[key] = copyEntry(entry)
 		}
-		copyData[key] = &entryCopy
 	}
 	return copyData
 }
 
+// Dump 返回 key 对应条目的深拷贝，key 不存在或已过期时 ok 为 false。
+func (d *DB) Dump(ctx context.Context, key string) (*Entry, bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.peekLocked(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return copyEntry(entry), true, nil
+}
+
+// Restore 写入完整条目，key 已存在且 replace 为 false 时返回 ErrBusyKey。
+func (d *DB) Restore(ctx context.Context, key string, entry *Entry, replace bool) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	if _, ok := d.peekLocked(key); ok && !replace {
+		return ErrBusyKey
+	}
+	d.setEntryLocked(key, entry)
+	d.notify(NotifyGeneric, "restore", key)
+	return nil
+}
+
 // LoadSnapshot 加载快照。
 func (d *DB) LoadSnapshot(snapshot map[string]*Entry) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	d.data = snapshot
+	unlock := d.lockAll()
+	defer unlock()
+	for _, sh := range d.shards {
+		sh.data = make(map[string]*Entry)
+	}
+	for key, entry := range snapshot {
+		d.shardFor(key).data[key] = entry
+	}
+	var used int64
+	for _, sh := range d.shards {
+		used += sh.rebuildIndexesLocked()
+		sh.touchAllLocked()
+	}
+	d.usedMemory.Store(used)
 }
 
-// ActiveExpire 定期清理过期键。
+// ActiveExpire 定期清理过期键，只在带过期时间的 key 中采样；各轮从不同分片开始，
+// 依次采样直到达到 sampleLimit，每次只锁住一个分片。
 func (d *DB) ActiveExpire(ctx context.Context, sampleLimit int) {
 	if sampleLimit <= 0 {
 		sampleLimit = 20
 	}
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	start := int(d.expireCursor.Add(1))
 	count := 0
-	for key, entry := range d.data {
-		if d.isExpired(entry) {
-			delete(d.data, key)
-		}
-		count++
-		if count >= sampleLimit {
-			break
+	for i := 0; i < shardCount && count < sampleLimit; i++ {
+		sh := d.shards[(start+i)%shardCount]
+		sh.mu.Lock()
+		for key := range sh.expires {
+			if isExpired(sh.data[key]) {
+				d.expireLocked(key)
+			}
+			count++
+			if count >= sampleLimit {
+				break
+			}
 		}
+		sh.mu.Unlock()
 	}
 }
 
-func (d *DB) isExpired(entry *Entry) bool {
-	return entry != nil && !entry.ExpireAt.IsZero() && time.Now().After(entry.ExpireAt)
+// copyEntry 深拷贝条目，避免调用方持有内部数据结构。
+func copyEntry(entry *Entry) *Entry {
+	entryCopy := *entry
+	switch entry.Type {
+	case TypeSet:
+		s := entry.Value.(map[string]struct{})
+		sCopy := make(map[string]struct{}, len(s))
+		for m := range s {
+			sCopy[m] = struct{}{}
+		}
+		entryCopy.Value = sCopy
+	case TypeHash:
+		h := entry.Value.(map[string]string)
+		hCopy := make(map[string]string, len(h))
+		for f, v := range h {
+			hCopy[f] = v
+		}
+		entryCopy.Value = hCopy
+	case TypeList:
+		list := entry.Value.(*ds.LinkedList)
+		lCopy := &ds.LinkedList{}
+		for _, item := range list.Range(0, list.Len()-1) {
+			lCopy.RPush(item)
+		}
+		entryCopy.Value = lCopy
+	case TypeZSet:
+		z := entry.Value.(*ds.SkipList)
+		zCopy := ds.NewSkipList()
+		for _, item := range z.RangeByScore(math.Inf(-1), math.Inf(1)) {
+			zCopy.Insert(item.Member, item.Score)
+		}
+		entryCopy.Value = zCopy
+	case TypeStream:
+		entryCopy.Value = entry.Value.(*ds.Stream).Clone()
+	}
+	return &entryCopy
 }
 
-func matchPattern(key, pattern string) bool {
-	if pattern == "" || pattern == "*" {
-		return true
-	}
-	if strings.HasPrefix(pattern, "*") && strings.HasSuffix(pattern, "*") {
-		inner := strings.Trim(pattern, "*")
-		return strings.Contains(key, inner)
-	}
-	if strings.HasPrefix(pattern, "*") {
-		return strings.HasSuffix(key, strings.TrimPrefix(pattern, "*"))
-	}
-	if strings.HasSuffix(pattern, "*") {
-		return strings.HasPrefix(key, strings.TrimSuffix(pattern, "*"))
-	}
-	return key == pattern
+func isExpired(entry *Entry) bool {
+	return entry != nil && !entry.ExpireAt.IsZero() && time.Now().After(entry.ExpireAt)
 }
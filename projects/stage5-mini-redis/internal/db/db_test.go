@@ -2,8 +2,16 @@ package db
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 )
 
 func TestStringCommands(t *testing.T) {
@@ -35,11 +43,11 @@ func TestTTLExpire(t *testing.T) {
 func TestExecuteCommand(t *testing.T) {
 	d := New()
 	ctx := context.Background()
-	if result, err := d.ExecuteCommand(ctx, []string{"SET", "k", "v"}); err != nil || result != "OK" {
-		t.Fatalf("SET result = (%q, %v)", result, err)
+	if result, err := d.ExecuteCommand(ctx, []string{"SET", "k", "v"}); err != nil || result.Type != protocol.SimpleString || result.Str != "OK" {
+		t.Fatalf("SET result = (%+v, %v)", result, err)
 	}
-	if result, err := d.ExecuteCommand(ctx, []string{"GET", "k"}); err != nil || result != "v" {
-		t.Fatalf("GET result = (%q, %v)", result, err)
+	if result, err := d.ExecuteCommand(ctx, []string{"GET", "k"}); err != nil || result.Type != protocol.BulkString || result.Str != "v" {
+		t.Fatalf("GET result = (%+v, %v)", result, err)
 	}
 }
 
@@ -51,3 +59,772 @@ func BenchmarkSetGet(b *testing.B) {
 		_, _, _ = d.GetString(ctx, "k")
 	}
 }
+
+func BenchmarkPFAddDense(b *testing.B) {
+	d := New()
+	ctx := context.Background()
+	elements := make([]string, 100000)
+	for i := range elements {
+		elements[i] = "user:" + strconv.Itoa(i)
+	}
+	if _, err := d.PFAdd(ctx, "hll", elements...); err != nil {
+		b.Fatalf("PFAdd() error = %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = d.PFAdd(ctx, "hll", elements[i%len(elements)])
+	}
+}
+
+func TestSortedSetCommands(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	run := func(args ...string) string {
+		t.Helper()
+		result, err := d.ExecuteCommand(ctx, args)
+		if err != nil {
+			t.Fatalf("%v error = %v", args, err)
+		}
+		return replyString(result)
+	}
+	if got := run("ZADD", "board", "100", "alice", "80", "bob", "95", "carol"); got != "3" {
+		t.Fatalf("ZADD = %s, want 3", got)
+	}
+	if got := run("ZADD", "board", "85", "bob", "70", "dave"); got != "1" {
+		t.Fatalf("ZADD with update = %s, want 1", got)
+	}
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ZRANGE", "board", "0", "-1"}, "dave,bob,carol,alice"},
+		{[]string{"ZREVRANGE", "board", "0", "1", "WITHSCORES"}, "alice,100,carol,95"},
+		{[]string{"ZRANK", "board", "bob"}, "1"},
+		{[]string{"ZREVRANK", "board", "bob"}, "2"},
+		{[]string{"ZRANK", "board", "nobody"}, "(nil)"},
+		{[]string{"ZSCORE", "board", "carol"}, "95"},
+		{[]string{"ZINCRBY", "board", "2.5", "dave"}, "72.5"},
+		{[]string{"ZCARD", "board"}, "4"},
+		{[]string{"ZCOUNT", "board", "(72.5", "+inf"}, "3"},
+		{[]string{"ZCOUNT", "board", "-inf", "(85"}, "1"},
+		{[]string{"ZRANGEBYSCORE", "board", "(85", "100"}, "carol,alice"},
+		{[]string{"ZREVRANGEBYSCORE", "board", "+inf", "(95", "WITHSCORES"}, "alice,100"},
+		{[]string{"ZREM", "board", "bob", "nobody"}, "1"},
+		{[]string{"ZRANGE", "board", "-2", "-1"}, "carol,alice"},
+	}
+	for _, tc := range cases {
+		if got := run(tc.args...); got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if _, err := d.ExecuteCommand(ctx, []string{"ZADD", "board", "nan", "x"}); err == nil {
+		t.Fatal("ZADD with NaN score should fail")
+	}
+	if _, err := d.ExecuteCommand(ctx, []string{"ZCOUNT", "board", "(abc", "1"}); err != ErrMinMaxFloat {
+		t.Fatalf("ZCOUNT invalid bound error = %v, want ErrMinMaxFloat", err)
+	}
+	run("ZREM", "board", "alice", "carol", "dave")
+	if exists, _ := d.Exists(ctx, "board"); exists {
+		t.Fatal("empty sorted set should be removed")
+	}
+}
+
+func TestExecuteCommandReplyTypes(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	_, _ = d.ExecuteCommand(ctx, []string{"SET", "s", "v"})
+	_, _ = d.ExecuteCommand(ctx, []string{"SADD", "set", "a", "b"})
+	_, _ = d.ExecuteCommand(ctx, []string{"HSET", "h", "f1", "v1", "f2", "v2"})
+	_, _ = d.ExecuteCommand(ctx, []string{"ZADD", "z", "1.5", "m"})
+	cases := []struct {
+		args []string
+		want protocol.RESPType
+		text string
+	}{
+		{[]string{"GET", "missing"}, protocol.Null, "(nil)"},
+		{[]string{"BLPOP", "missing", "0"}, protocol.NullArray, "(nil array)"},
+		{[]string{"DEL", "s", "missing"}, protocol.Integer, "1"},
+		{[]string{"KEYS", "*"}, protocol.Array, "h,set,z"},
+		{[]string{"SMEMBERS", "set"}, protocol.Set, "a,b"},
+		{[]string{"HGETALL", "h"}, protocol.Map, "f1,v1,f2,v2"},
+		{[]string{"HSET", "h", "f2", "x", "f3", "y"}, protocol.Integer, "1"},
+		{[]string{"ZSCORE", "z", "m"}, protocol.Double, "1.5"},
+		{[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, protocol.Array, "m,1.5"},
+	}
+	for _, tc := range cases {
+		result, err := d.ExecuteCommand(ctx, tc.args)
+		if err != nil {
+			t.Fatalf("%v error = %v", tc.args, err)
+		}
+		if result.Type != tc.want || replyString(result) != tc.text {
+			t.Fatalf("%v = %c %q, want %c %q", tc.args, result.Type, replyString(result), tc.want, tc.text)
+		}
+	}
+}
+
+// replyString 将回复渲染为便于断言的文本：聚合类型以逗号拼接（集合按字典序），空值为 (nil)，空数组为 (nil array)。
+func replyString(value *protocol.Value) string {
+	switch value.Type {
+	case protocol.Null:
+		return "(nil)"
+	case protocol.NullArray:
+		return "(nil array)"
+	case protocol.Integer:
+		return strconv.FormatInt(value.Num, 10)
+	case protocol.Double:
+		return protocol.FormatDouble(value.Double)
+	case protocol.Array, protocol.Set, protocol.Map:
+		items := make([]string, 0, len(value.Array))
+		for i := range value.Array {
+			items = append(items, replyString(&value.Array[i]))
+		}
+		if value.Type == protocol.Set {
+			sort.Strings(items)
+		}
+		return strings.Join(items, ",")
+	default:
+		return value.Str
+	}
+}
+
+func TestWatchDetectsModificationAndExpiry(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	_ = d.SetString(ctx, "stock", "10", 0)
+	_ = d.SetString(ctx, "session", "s", 30*time.Millisecond)
+
+	watched, err := d.Watch(ctx, "stock", "missing")
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if _, _, err = d.GetString(ctx, "stock"); err != nil || d.WatchChanged(watched) {
+		t.Fatal("reads must not invalidate WATCH")
+	}
+	_, _ = d.ExecuteCommand(ctx, []string{"SADD", "missing", "x"})
+	if !d.WatchChanged(watched) {
+		t.Fatal("creating a watched key should invalidate WATCH")
+	}
+	d.Unwatch(watched)
+	for _, sh := range d.shards {
+		if len(sh.watches) != 0 {
+			t.Fatalf("shard %d watches after Unwatch = %d, want 0", sh.index, len(sh.watches))
+		}
+	}
+
+	watched, _ = d.Watch(ctx, "session")
+	time.Sleep(40 * time.Millisecond)
+	if !d.WatchChanged(watched) {
+		t.Fatal("expired watched key should invalidate WATCH")
+	}
+	d.Unwatch(watched)
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	commands := [][]string{
+		{"SET", "s", "value"},
+		{"RPUSH", "l", "a", "b", "c"},
+		{"SADD", "set", "x", "y"},
+		{"HSET", "h", "f", "v", "g", "w"},
+		{"ZADD", "z", "1", "m", "2", "n"},
+		{"HSET", "h", "f", "longer-value"},
+		{"ZINCRBY", "z", "1", "o"},
+		{"XADD", "x", "*", "f", "v"},
+		{"XADD", "x", "*", "f", "longer-value"},
+		{"XADD", "x", "MAXLEN", "1", "*", "g", "w"},
+	}
+	for _, args := range commands {
+		if _, err := d.ExecuteCommand(ctx, args); err != nil {
+			t.Fatalf("%v error = %v", args, err)
+		}
+	}
+	var want int64
+	for key, entry := range d.Snapshot() {
+		want += entrySize(key, entry)
+	}
+	if got := d.UsedMemory(); got != want {
+		t.Fatalf("UsedMemory() = %d, want %d (recomputed)", got, want)
+	}
+	for _, args := range [][]string{{"LPOP", "l"}, {"ZREM", "z", "m", "n", "o"}, {"DEL", "s", "l", "set", "h", "x"}} {
+		_, _ = d.ExecuteCommand(ctx, args)
+	}
+	if got := d.UsedMemory(); got != 0 {
+		t.Fatalf("UsedMemory() after deleting everything = %d, want 0", got)
+	}
+}
+
+func TestFreeMemoryPolicies(t *testing.T) {
+	ctx := context.Background()
+	fill := func(policy EvictionPolicy) *DB {
+		d := New()
+		for i := 0; i < 10; i++ {
+			ttl := time.Duration(0)
+			if i%2 == 0 {
+				ttl = time.Duration(i+1) * time.Hour
+			}
+			_ = d.SetString(ctx, "k"+strconv.Itoa(i), strings.Repeat("v", 100), ttl)
+		}
+		d.SetMaxMemory(d.UsedMemory()-1, policy, 10)
+		return d
+	}
+
+	d := fill(NoEviction)
+	if _, err := d.FreeMemory(ctx); err != ErrOOM {
+		t.Fatalf("noeviction FreeMemory() error = %v, want ErrOOM", err)
+	}
+
+	d = fill(AllKeysLRU)
+	for i := 1; i < 10; i++ {
+		_, _, _ = d.GetString(ctx, "k"+strconv.Itoa(i))
+	}
+	if evicted, err := d.FreeMemory(ctx); err != nil || len(evicted) != 1 || evicted[0] != "k0" {
+		t.Fatalf("allkeys-lru evicted %v (err %v), want [k0]", evicted, err)
+	}
+
+	d = fill(AllKeysLFU)
+	for round := 0; round < 50; round++ {
+		for i := 0; i < 10; i++ {
+			if i != 3 {
+				_, _, _ = d.GetString(ctx, "k"+strconv.Itoa(i))
+			}
+		}
+	}
+	if evicted, _ := d.FreeMemory(ctx); len(evicted) != 1 || evicted[0] != "k3" {
+		t.Fatalf("allkeys-lfu evicted %v, want [k3]", evicted)
+	}
+
+	d = fill(VolatileTTL)
+	if evicted, _ := d.FreeMemory(ctx); len(evicted) != 1 || evicted[0] != "k0" {
+		t.Fatalf("volatile-ttl evicted %v, want [k0] (soonest expiry)", evicted)
+	}
+
+	d = fill(VolatileRandom)
+	evicted, _ := d.FreeMemory(ctx)
+	if num, _ := strconv.Atoi(strings.TrimPrefix(evicted[0], "k")); len(evicted) != 1 || num%2 != 0 {
+		t.Fatalf("volatile-random evicted %v, want a key with TTL", evicted)
+	}
+
+	d = fill(VolatileLRU)
+	d.SetMaxMemory(0, VolatileLRU, 10)
+	d.SetMaxMemory(entrySize("k1", &Entry{Type: TypeString, Value: strings.Repeat("v", 100)})*5, VolatileLRU, 10)
+	if evicted, err := d.FreeMemory(ctx); err != nil || len(evicted) != 5 || d.EvictedKeys() != 5 {
+		t.Fatalf("volatile-lru evicted %v (err %v), want all 5 volatile keys", evicted, err)
+	}
+	d.SetMaxMemory(1, VolatileLRU, 10)
+	if _, err := d.FreeMemory(ctx); err != ErrOOM {
+		t.Fatalf("volatile-lru without volatile keys error = %v, want ErrOOM", err)
+	}
+}
+
+func TestStreamCommands(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"XADD", "s", "1-1", "f", "a"}, "1-1"},
+		{[]string{"XADD", "s", "1-*", "f", "b"}, "1-2"},
+		{[]string{"XADD", "s", "3", "f", "c"}, "3-0"},
+		{[]string{"XADD", "s", "2-0", "f", "x"}, "ERR"},
+		{[]string{"XADD", "empty", "0-0", "f", "x"}, "ERR"},
+		{[]string{"XADD", "missing", "NOMKSTREAM", "*", "f", "x"}, "(nil)"},
+		{[]string{"XLEN", "s"}, "3"},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "2"}, "1-1,f,a,1-2,f,b"},
+		{[]string{"XRANGE", "s", "(1-1", "1"}, "1-2,f,b"},
+		{[]string{"XREVRANGE", "s", "+", "(1-2"}, "3-0,f,c"},
+		{[]string{"XREAD", "COUNT", "1", "STREAMS", "s", "missing", "1-1", "0"}, "s,1-2,f,b"},
+		{[]string{"XREAD", "STREAMS", "s", "$"}, "(nil array)"},
+		{[]string{"XREAD", "STREAMS", "s"}, "ERR"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "0"}, "OK"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "$"}, "BUSYGROUP"},
+		{[]string{"XGROUP", "CREATE", "new", "g", "$"}, "ERR"},
+		{[]string{"XGROUP", "CREATE", "new", "g", "$", "MKSTREAM"}, "OK"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">"}, "s,1-1,f,a,1-2,f,b"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "s,3-0,f,c"},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "(nil array)"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"}, "s,1-1,f,a,1-2,f,b"},
+		{[]string{"XREADGROUP", "GROUP", "nope", "alice", "STREAMS", "s", ">"}, "NOGROUP"},
+		{[]string{"XPENDING", "s", "g"}, "3,1-1,3-0,alice,2,bob,1"},
+		{[]string{"XACK", "s", "g", "1-1", "9-9"}, "1"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1-2", "JUSTID"}, "1-2"},
+		{[]string{"XPENDING", "s", "g", "-", "+", "10", "bob"}, "1-2,bob,0,1,3-0,bob,0,1"},
+		{[]string{"XGROUP", "DELCONSUMER", "s", "g", "bob"}, "2"},
+		{[]string{"XPENDING", "s", "g"}, "0,(nil),(nil),(nil)"},
+		{[]string{"XADD", "s", "MAXLEN", "=", "1", "*", "f", "d"}, ""},
+		{[]string{"XLEN", "s"}, "1"},
+	}
+	for _, tc := range cases {
+		result, err := d.ExecuteCommand(ctx, tc.args)
+		got := ""
+		switch {
+		case err != nil:
+			got = "ERR"
+			if errors.Is(err, ErrNoGroup) {
+				got = "NOGROUP"
+			} else if errors.Is(err, ErrBusyGroup) {
+				got = "BUSYGROUP"
+			}
+		default:
+			got = replyString(result)
+		}
+		if tc.want == "" {
+			if err != nil {
+				t.Fatalf("%v error = %v", tc.args, err)
+			}
+			continue
+		}
+		// XPENDING 扩展形式中的空闲时间取决于执行耗时，统一按 0 比较。
+		if tc.args[0] == "XPENDING" && len(tc.args) > 3 {
+			parts := strings.Split(got, ",")
+			for i := 2; i < len(parts); i += 4 {
+				parts[i] = "0"
+			}
+			got = strings.Join(parts, ",")
+		}
+		if got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestBitmapCommands(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SETBIT", "b", "7", "1"}, "0"},
+		{[]string{"SETBIT", "b", "7", "1"}, "1"},
+		{[]string{"SETBIT", "b", "7", "2"}, "ERR"},
+		{[]string{"SETBIT", "b", "4294967296", "1"}, "ERR"},
+		{[]string{"GET", "b"}, "\x01"},
+		{[]string{"GETBIT", "b", "7"}, "1"},
+		{[]string{"GETBIT", "b", "100"}, "0"},
+		{[]string{"GETBIT", "missing", "0"}, "0"},
+		{[]string{"SET", "s", "foobar"}, "OK"},
+		{[]string{"BITCOUNT", "s"}, "26"},
+		{[]string{"BITCOUNT", "s", "0", "0"}, "4"},
+		{[]string{"BITCOUNT", "s", "1", "-1"}, "22"},
+		{[]string{"BITCOUNT", "s", "5", "30", "BIT"}, "17"},
+		{[]string{"BITCOUNT", "s", "0"}, "ERR"},
+		{[]string{"BITCOUNT", "missing"}, "0"},
+		{[]string{"SET", "p", "\xff\xf0\x00"}, "OK"},
+		{[]string{"BITPOS", "p", "0"}, "12"},
+		{[]string{"SET", "p", "\x00\xff\xf0"}, "OK"},
+		{[]string{"BITPOS", "p", "1", "0"}, "8"},
+		{[]string{"BITPOS", "p", "1", "2"}, "16"},
+		{[]string{"BITPOS", "p", "1", "2", "-1", "BYTE"}, "16"},
+		{[]string{"BITPOS", "p", "1", "7", "15", "BIT"}, "8"},
+		{[]string{"BITPOS", "p", "1", "3"}, "-1"},
+		{[]string{"SET", "ones", "\xff\xff"}, "OK"},
+		{[]string{"BITPOS", "ones", "0"}, "16"},
+		{[]string{"BITPOS", "ones", "0", "0", "-1"}, "-1"},
+		{[]string{"BITPOS", "missing", "0"}, "0"},
+		{[]string{"BITPOS", "missing", "1"}, "-1"},
+		{[]string{"SET", "k2", "abcdef"}, "OK"},
+		{[]string{"BITOP", "AND", "dest", "s", "k2"}, "6"},
+		{[]string{"GET", "dest"}, "`bc`ab"},
+		{[]string{"BITOP", "OR", "dest", "b", "missing"}, "1"},
+		{[]string{"GET", "dest"}, "\x01"},
+		{[]string{"BITOP", "NOT", "dest", "b"}, "1"},
+		{[]string{"GET", "dest"}, "\xfe"},
+		{[]string{"BITOP", "XOR", "dest", "s", "s"}, "6"},
+		{[]string{"BITCOUNT", "dest"}, "0"},
+		{[]string{"BITOP", "NOT", "dest", "s", "k2"}, "ERR"},
+		{[]string{"BITOP", "NAND", "dest", "s"}, "ERR"},
+		{[]string{"BITOP", "OR", "dest", "missing"}, "0"},
+		{[]string{"EXISTS", "dest"}, "0"},
+		{[]string{"LPUSH", "l", "x"}, "1"},
+		{[]string{"GETBIT", "l", "0"}, "ERR"},
+		{[]string{"BITOP", "AND", "dest", "s", "l"}, "ERR"},
+	}
+	for _, tc := range cases {
+		result, err := d.ExecuteCommand(ctx, tc.args)
+		got := "ERR"
+		if err == nil {
+			got = replyString(result)
+		}
+		if got != tc.want {
+			t.Fatalf("%q = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestHyperLogLogCommands(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PFADD", "h", "a", "b", "c", "d"}, "1"},
+		{[]string{"PFADD", "h", "a"}, "0"},
+		{[]string{"PFCOUNT", "h"}, "4"},
+		{[]string{"PFADD", "empty"}, "1"},
+		{[]string{"PFADD", "empty"}, "0"},
+		{[]string{"PFCOUNT", "empty", "missing"}, "0"},
+		{[]string{"PFADD", "h2", "c", "d", "e"}, "1"},
+		{[]string{"PFCOUNT", "h", "h2"}, "5"},
+		{[]string{"PFMERGE", "m", "h", "h2"}, "OK"},
+		{[]string{"PFCOUNT", "m"}, "5"},
+		{[]string{"PFMERGE", "m", "missing"}, "OK"},
+		{[]string{"PFCOUNT", "m"}, "5"},
+		{[]string{"SET", "plain", "x"}, "OK"},
+		{[]string{"PFADD", "plain", "a"}, "ERR"},
+		{[]string{"PFCOUNT", "h", "plain"}, "ERR"},
+		{[]string{"LPUSH", "l", "x"}, "1"},
+		{[]string{"PFMERGE", "m", "l"}, "ERR"},
+	}
+	for _, tc := range cases {
+		result, err := d.ExecuteCommand(ctx, tc.args)
+		got := "ERR"
+		if err == nil {
+			got = replyString(result)
+		}
+		if got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// 单 key PFCOUNT 把基数缓存回字符串头部（第 15 字节最高位清零表示缓存有效）。
+	_, _ = d.ExecuteCommand(ctx, []string{"PFADD", "h", "z"})
+	value, _, _ := d.GetString(ctx, "h")
+	if value[15]&0x80 == 0 {
+		t.Fatal("cached cardinality should be invalid after PFADD")
+	}
+	_, _ = d.ExecuteCommand(ctx, []string{"PFCOUNT", "h"})
+	value, _, _ = d.GetString(ctx, "h")
+	if value[15]&0x80 != 0 || value[8] != 5 {
+		t.Fatalf("cached cardinality header = %q", value[8:16])
+	}
+	if _, err := d.PFAdd(ctx, "plain", "a"); !errors.Is(err, ds.ErrNotHLL) {
+		t.Fatalf("PFAdd on plain string error = %v", err)
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"RPUSH", "q", "a", "b", "c", "b", "d"}, "5"},
+		{[]string{"LLEN", "q"}, "5"},
+		{[]string{"LINDEX", "q", "-1"}, "d"},
+		{[]string{"LINDEX", "q", "9"}, "(nil)"},
+		{[]string{"LSET", "q", "0", "A"}, "OK"},
+		{[]string{"LSET", "q", "9", "x"}, "ERR"},
+		{[]string{"LSET", "missing", "0", "x"}, "ERR"},
+		{[]string{"LREM", "q", "-1", "b"}, "1"},
+		{[]string{"LRANGE", "q", "0", "-1"}, "A,b,c,d"},
+		{[]string{"LTRIM", "q", "1", "-1"}, "OK"},
+		{[]string{"RPOP", "q"}, "d"},
+		{[]string{"LPOP", "q", "5"}, "b,c"},
+		{[]string{"LPOP", "q", "-1"}, "ERR"},
+		{[]string{"EXISTS", "q"}, "0"},
+		{[]string{"RPUSH", "src", "1", "2", "3"}, "3"},
+		{[]string{"LMOVE", "src", "dst", "LEFT", "RIGHT"}, "1"},
+		{[]string{"LMOVE", "src", "src", "RIGHT", "LEFT"}, "3"},
+		{[]string{"LRANGE", "src", "0", "-1"}, "3,2"},
+		{[]string{"LMOVE", "missing", "dst", "LEFT", "LEFT"}, "(nil)"},
+		{[]string{"LMOVE", "src", "dst", "UP", "LEFT"}, "ERR"},
+		{[]string{"BLPOP", "missing", "src", "0"}, "src,3"},
+		{[]string{"BRPOP", "missing", "0.1"}, "(nil array)"},
+		{[]string{"BLPOP", "src", "-1"}, "ERR"},
+		{[]string{"BLMOVE", "src", "dst", "LEFT", "LEFT", "0"}, "2"},
+		{[]string{"EXISTS", "src"}, "0"},
+		{[]string{"LRANGE", "dst", "0", "-1"}, "2,1"},
+	}
+	for _, tc := range cases {
+		result, err := d.ExecuteCommand(ctx, tc.args)
+		got := "ERR"
+		if err == nil {
+			got = replyString(result)
+		}
+		if got != tc.want {
+			t.Fatalf("%v = %q (err %v), want %q", tc.args, got, err, tc.want)
+		}
+	}
+}
+
+func TestScanReturnsStableKeysAcrossResize(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		_ = d.SetString(ctx, "stable:"+strconv.Itoa(i), "v", 0)
+	}
+	seen := make(map[string]bool)
+	cursor, calls := uint64(0), 0
+	for {
+		next, keys, err := d.Scan(ctx, cursor, ScanOptions{Count: 7})
+		if err != nil {
+			t.Fatalf("Scan error = %v", err)
+		}
+		for _, key := range keys {
+			seen[key] = true
+		}
+		// 遍历期间增删其他 key，迫使索引扩容与缩容。
+		calls++
+		switch {
+		case calls < 5:
+			for i := 0; i < 200; i++ {
+				_ = d.SetString(ctx, "temp:"+strconv.Itoa(calls*1000+i), "v", 0)
+			}
+		case calls == 5:
+			keys, _ := d.Keys(ctx, "temp:*")
+			for _, key := range keys {
+				_, _ = d.Del(ctx, key)
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if !seen["stable:"+strconv.Itoa(i)] {
+			t.Fatalf("stable:%d not returned by SCAN", i)
+		}
+	}
+}
+
+func TestScanCommands(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"SET", "user:1", "a"},
+		{"SET", "user:2", "b"},
+		{"RPUSH", "user:list", "x"},
+		{"SADD", "tags", "a", "b", "c", "d", "e"},
+		{"HSET", "profile", "name", "n", "age", "1"},
+		{"ZADD", "board", "1", "a", "2", "b", "3", "c"},
+	} {
+		if _, err := d.ExecuteCommand(ctx, args); err != nil {
+			t.Fatalf("%v error = %v", args, err)
+		}
+	}
+	scanAll := func(args ...string) []string {
+		var items []string
+		cursor := "0"
+		for {
+			// SCAN 的游标紧跟命令名，SSCAN/HSCAN/ZSCAN 的游标在 key 之后。
+			command := append([]string{"SCAN", cursor}, args[1:]...)
+			if args[0] != "SCAN" {
+				command = append([]string{args[0], args[1], cursor}, args[2:]...)
+			}
+			result, err := d.ExecuteCommand(ctx, command)
+			if err != nil {
+				t.Fatalf("%v error = %v", command, err)
+			}
+			items = append(items, strings.Split(replyString(&result.Array[1]), ",")...)
+			if cursor = result.Array[0].Str; cursor == "0" {
+				break
+			}
+		}
+		var nonEmpty []string
+		for _, item := range items {
+			if item != "" {
+				nonEmpty = append(nonEmpty, item)
+			}
+		}
+		sort.Strings(nonEmpty)
+		return nonEmpty
+	}
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SCAN", "MATCH", "user:*", "COUNT", "1"}, "user:1,user:2,user:list"},
+		{[]string{"SCAN", "MATCH", "user:[0-9]"}, "user:1,user:2"},
+		{[]string{"SCAN", "TYPE", "LIST"}, "user:list"},
+		{[]string{"SSCAN", "tags", "COUNT", "2"}, "a,b,c,d,e"},
+		{[]string{"SSCAN", "tags", "MATCH", "[ae]"}, "a,e"},
+		{[]string{"HSCAN", "profile", "COUNT", "1"}, "1,age,n,name"},
+		{[]string{"ZSCAN", "board", "COUNT", "1"}, "1,2,3,a,b,c"},
+		{[]string{"SSCAN", "missing"}, ""},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(scanAll(tc.args...), ","); got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	for _, args := range [][]string{
+		{"SCAN", "x"},
+		{"SCAN", "0", "COUNT", "0"},
+		{"SCAN", "0", "TYPE", "nope"},
+		{"SSCAN", "tags", "0", "TYPE", "set"},
+		{"HSCAN", "tags", "0"},
+	} {
+		if _, err := d.ExecuteCommand(ctx, args); err == nil {
+			t.Fatalf("%v should fail", args)
+		}
+	}
+	if result, _ := d.ExecuteCommand(ctx, []string{"TYPE", "board"}); result.Str != "zset" {
+		t.Fatalf("TYPE board = %q, want zset", result.Str)
+	}
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	var events []string
+	d.SetNotifier(func(channel, message string) {
+		events = append(events, channel+" "+message)
+	})
+	classes, err := ParseNotifyKeyspaceEvents("KEA")
+	if err != nil || classes.String() != "AKE" {
+		t.Fatalf("ParseNotifyKeyspaceEvents(KEA) = (%v, %v)", classes, err)
+	}
+	d.SetNotifyKeyspaceEvents(classes)
+	for _, args := range [][]string{
+		{"SET", "s", "v"},
+		{"SET", "t", "v", "EX", "100"},
+		{"RPUSH", "l", "a", "b"},
+		{"LPOP", "l", "2"},
+		{"ZADD", "z", "1", "m"},
+		{"ZREM", "z", "m"},
+		{"DEL", "s", "t", "missing"},
+	} {
+		if _, err := d.ExecuteCommand(ctx, args); err != nil {
+			t.Fatalf("%v error = %v", args, err)
+		}
+	}
+	want := []string{
+		"__keyspace@0__:s set", "__keyevent@0__:set s",
+		"__keyspace@0__:t set", "__keyevent@0__:set t",
+		"__keyspace@0__:t expire", "__keyevent@0__:expire t",
+		"__keyspace@0__:l rpush", "__keyevent@0__:rpush l",
+		"__keyspace@0__:l lpop", "__keyevent@0__:lpop l",
+		"__keyspace@0__:l del", "__keyevent@0__:del l",
+		"__keyspace@0__:z zadd", "__keyevent@0__:zadd z",
+		"__keyspace@0__:z zrem", "__keyevent@0__:zrem z",
+		"__keyspace@0__:z del", "__keyevent@0__:del z",
+		"__keyspace@0__:s del", "__keyevent@0__:del s",
+		"__keyspace@0__:t del", "__keyevent@0__:del t",
+	}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+
+	// 只订阅 keyevent 通道的过期与淘汰事件。
+	classes, _ = ParseNotifyKeyspaceEvents("Exe")
+	d.SetNotifyKeyspaceEvents(classes)
+	events = nil
+	_ = d.SetString(ctx, "ttl", "v", 0)
+	_, _ = d.ExpireAt(ctx, "ttl", time.Now().Add(-time.Second))
+	_, _, _ = d.GetString(ctx, "ttl")
+	_ = d.SetString(ctx, "big", strings.Repeat("v", 100), 0)
+	d.SetMaxMemory(1, AllKeysRandom, 5)
+	if _, err := d.FreeMemory(ctx); err != nil {
+		t.Fatalf("FreeMemory error = %v", err)
+	}
+	want = []string{"__keyevent@0__:expired ttl", "__keyevent@0__:evicted big"}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+
+	if _, err := ParseNotifyKeyspaceEvents("KEq"); err == nil {
+		t.Fatal("ParseNotifyKeyspaceEvents(KEq) should fail")
+	}
+}
+
+func TestShardedConcurrentAccess(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	// 选两个位于不同分片的 key，相向 LMOVE 时若加锁顺序不固定会死锁。
+	left, right := "list:a", ""
+	for i := 0; right == ""; i++ {
+		if key := "list:" + strconv.Itoa(i); d.shardFor(key) != d.shardFor(left) {
+			right = key
+		}
+	}
+	for i := 0; i < 100; i++ {
+		_, _ = d.ExecuteCommand(ctx, []string{"RPUSH", left, strconv.Itoa(i)})
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			from, to := left, right
+			if worker%2 == 1 {
+				from, to = right, left
+			}
+			for i := 0; i < 500; i++ {
+				if _, err := d.ExecuteCommand(ctx, []string{"LMOVE", from, to, "LEFT", "RIGHT"}); err != nil {
+					t.Errorf("LMOVE error = %v", err)
+					return
+				}
+				key := "k:" + strconv.Itoa(worker) + ":" + strconv.Itoa(i)
+				_, _ = d.ExecuteCommand(ctx, []string{"SET", key, "v"})
+				_, _ = d.ExecuteCommand(ctx, []string{"GET", key})
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, key := range []string{left, right} {
+		n, err := d.LLen(ctx, key)
+		if err != nil {
+			t.Fatalf("LLen error = %v", err)
+		}
+		total += n
+	}
+	if total != 100 {
+		t.Fatalf("list elements after concurrent LMOVE = %d, want 100", total)
+	}
+	if keys, _ := d.Keys(ctx, "k:*"); len(keys) != 8*500 {
+		t.Fatalf("KEYS k:* = %d keys, want %d", len(keys), 8*500)
+	}
+}
+
+func TestCommandLocksAllowParallelReadsAndOtherShardWrites(t *testing.T) {
+	d := New()
+	ctx := context.Background()
+	key, other := "k", ""
+	for i := 0; other == ""; i++ {
+		if candidate := "k" + strconv.Itoa(i); d.shardFor(candidate) != d.shardFor(key) {
+			other = candidate
+		}
+	}
+	_, _ = d.ExecuteCommand(ctx, []string{"SET", key, "v"})
+
+	// 持有 key 所在分片的共享命令锁期间，同一 key 的读命令与其他分片上的写命令都不应被阻塞。
+	done := make(chan struct{})
+	d.AtomicCommand([]string{"GET", key}, func(*Tx) {
+		go func() {
+			defer close(done)
+			if value, err := d.ExecuteCommand(ctx, []string{"GET", key}); err != nil || value.Str != "v" {
+				t.Errorf("GET while read-locked = (%v, %v), want v", value, err)
+			}
+			if _, err := d.ExecuteCommand(ctx, []string{"SET", other, "v"}); err != nil {
+				t.Errorf("SET other shard error = %v", err)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("read or other-shard write blocked by a shared command lock")
+		}
+	})
+
+	// 独占命令锁期间，同一分片上的读命令需要等待。
+	blocked := make(chan struct{})
+	d.AtomicKeys([]string{key}, func(*Tx) {
+		go func() {
+			defer close(blocked)
+			_, _ = d.ExecuteCommand(ctx, []string{"GET", key})
+		}()
+		select {
+		case <-blocked:
+			t.Fatal("GET ran while the shard was exclusively locked")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	<-blocked
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy maxmemory 淘汰策略，取值与 Redis maxmemory-policy 一致。
+type EvictionPolicy string
+
+const (
+	NoEviction     EvictionPolicy = "noeviction"
+	AllKeysLRU     EvictionPolicy = "allkeys-lru"
+	AllKeysLFU     EvictionPolicy = "allkeys-lfu"
+	AllKeysRandom  EvictionPolicy = "allkeys-random"
+	VolatileLRU    EvictionPolicy = "volatile-lru"
+	VolatileLFU    EvictionPolicy = "volatile-lfu"
+	VolatileRandom EvictionPolicy = "volatile-random"
+	VolatileTTL    EvictionPolicy = "volatile-ttl"
+)
+
+// DefaultMaxMemorySamples 每轮淘汰采样的 key 数，与 Redis maxmemory-samples 默认值一致。
+const DefaultMaxMemorySamples = 5
+
+var (
+	ErrOOM                   = errors.New("command not allowed when used memory > 'maxmemory'")
+	ErrInvalidEvictionPolicy = errors.New("invalid maxmemory-policy")
+)
+
+// evictionCandidate 淘汰池中的候选 key，idle 越大越优先淘汰。
+type evictionCandidate struct {
+	key  string
+	idle int64
+}
+
+// ParseEvictionPolicy 解析淘汰策略名称。
+func ParseEvictionPolicy(value string) (EvictionPolicy, error) {
+	policy := EvictionPolicy(strings.ToLower(value))
+	switch policy {
+	case NoEviction, AllKeysLRU, AllKeysLFU, AllKeysRandom, VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidEvictionPolicy, value)
+	}
+}
+
+// SetMaxMemory 设置内存上限（字节，0 表示不限制）、淘汰策略与采样数。
+func (d *DB) SetMaxMemory(limit int64, policy EvictionPolicy, samples int) {
+	if samples <= 0 {
+		samples = DefaultMaxMemorySamples
+	}
+	d.evictMu.Lock()
+	defer d.evictMu.Unlock()
+	if policy != d.policy {
+		d.evictionPool = nil
+	}
+	d.maxMemory.Store(limit)
+	d.policy = policy
+	d.samples = samples
+}
+
+// MaxMemory 返回内存上限与淘汰策略。
+func (d *DB) MaxMemory() (int64, EvictionPolicy) {
+	d.evictMu.Lock()
+	defer d.evictMu.Unlock()
+	return d.maxMemory.Load(), d.policy
+}
+
+// MaxMemorySamples 返回每轮淘汰的采样数。
+func (d *DB) MaxMemorySamples() int {
+	d.evictMu.Lock()
+	defer d.evictMu.Unlock()
+	return d.samples
+}
+
+// UsedMemory 返回数据集的近似内存占用。
+func (d *DB) UsedMemory() int64 {
+	return d.usedMemory.Load()
+}
+
+// EvictedKeys 返回累计淘汰的 key 数。
+func (d *DB) EvictedKeys() int64 {
+	return d.evictedKeys.Load()
+}
+
+// OverMemoryLimit 判断内存占用是否超过上限，不加锁，供写命令快速判断是否需要淘汰。
+func (d *DB) OverMemoryLimit() bool {
+	limit := d.maxMemory.Load()
+	return limit > 0 && d.usedMemory.Load() > limit
+}
+
+// FreeMemory 在内存占用超过上限时按策略淘汰 key，返回被淘汰的 key（调用方负责传播 DEL）。
+// noeviction 或已无可淘汰的 key 时返回 ErrOOM。
+func (d *DB) FreeMemory(ctx context.Context) ([]string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !d.OverMemoryLimit() {
+		return nil, nil
+	}
+	d.evictMu.Lock()
+	defer d.evictMu.Unlock()
+	evicted := make([]string, 0)
+	for d.OverMemoryLimit() {
+		if d.policy == NoEviction {
+			return evicted, ErrOOM
+		}
+		key, ok := d.evictOneLocked(time.Now())
+		if !ok {
+			return evicted, ErrOOM
+		}
+		evicted = append(evicted, key)
+	}
+	return evicted, nil
+}
+
+// evictOneLocked 选出并删除下一个淘汰的 key：random 策略直接随机取，
+// 其余策略与 Redis 相同，每轮采样若干 key 合并进淘汰池，再从池中取最适合淘汰的一个。
+// 调用方需持有 evictMu，候选 key 所在的分片在确认与删除期间加锁。
+func (d *DB) evictOneLocked(now time.Time) (string, bool) {
+	volatile := strings.HasPrefix(string(d.policy), "volatile-")
+	if d.policy == AllKeysRandom || d.policy == VolatileRandom {
+		for _, sh := range d.shardsFrom(rand.IntN(shardCount)) {
+			sh.mu.Lock()
+			key, ok := sh.randomKeyLocked(volatile)
+			if ok {
+				d.evictLocked(key)
+			}
+			sh.mu.Unlock()
+			if ok {
+				return key, true
+			}
+		}
+		return "", false
+	}
+	for {
+		if !d.populatePoolLocked(volatile, now) {
+			return "", false
+		}
+		for len(d.evictionPool) > 0 {
+			best := d.evictionPool[len(d.evictionPool)-1]
+			d.evictionPool = d.evictionPool[:len(d.evictionPool)-1]
+			sh := d.lockKey(best.key)
+			// 池中的候选可能已被删除或移除了过期时间。
+			_, exists := sh.data[best.key]
+			_, expires := sh.expires[best.key]
+			evictable := exists && (!volatile || expires)
+			if evictable {
+				d.evictLocked(best.key)
+			}
+			sh.mu.Unlock()
+			if evictable {
+				return best.key, true
+			}
+		}
+	}
+}
+
+// evictLocked 删除被淘汰的 key，调用方需持有 key 所在分片的锁。
+func (d *DB) evictLocked(key string) {
+	d.deleteLocked(key)
+	d.evictedKeys.Add(1)
+	d.notify(NotifyEvicted, "evicted", key)
+}
+
+// shardsFrom 返回从 start 开始循环排列的全部分片，用于随机起点的采样。
+func (d *DB) shardsFrom(start int) []*shard {
+	shards := make([]*shard, 0, shardCount)
+	for i := 0; i < shardCount; i++ {
+		shards = append(shards, d.shards[(start+i)%shardCount])
+	}
+	return shards
+}
+
+// populatePoolLocked 从随机分片开始采样 samples 个 key 放入淘汰池（按 idle 升序，最多 16 个），
+// 没有候选时返回 false。调用方需持有 evictMu。
+func (d *DB) populatePoolLocked(volatile bool, now time.Time) bool {
+	sampled := 0
+	for _, sh := range d.shardsFrom(rand.IntN(shardCount)) {
+		sh.mu.Lock()
+		sample := func(key string) bool {
+			d.insertPoolLocked(evictionCandidate{key: key, idle: d.idleScore(sh.data[key], now)})
+			sampled++
+			return sampled < d.samples
+		}
+		if volatile {
+			for key := range sh.expires {
+				if !sample(key) {
+					break
+				}
+			}
+		} else {
+			for key := range sh.data {
+				if !sample(key) {
+					break
+				}
+			}
+		}
+		sh.mu.Unlock()
+		if sampled >= d.samples {
+			break
+		}
+	}
+	return sampled > 0
+}
+
+func (d *DB) insertPoolLocked(candidate evictionCandidate) {
+	for _, existing := range d.evictionPool {
+		if existing.key == candidate.key {
+			return
+		}
+	}
+	pos := sort.Search(len(d.evictionPool), func(i int) bool { return d.evictionPool[i].idle > candidate.idle })
+	if len(d.evictionPool) >= maxEvictionPoolSize {
+		if pos == 0 {
+			// 比池中所有候选都更不适合淘汰。
+			return
+		}
+		// 丢弃最不适合淘汰的一个腾出位置。
+		d.evictionPool = d.evictionPool[1:]
+		pos--
+	}
+	d.evictionPool = append(d.evictionPool, evictionCandidate{})
+	copy(d.evictionPool[pos+1:], d.evictionPool[pos:])
+	d.evictionPool[pos] = candidate
+}
+
+// idleScore 计算淘汰优先级，数值越大越应淘汰。
+func (d *DB) idleScore(entry *Entry, now time.Time) int64 {
+	switch d.policy {
+	case AllKeysLFU, VolatileLFU:
+		return math.MaxUint8 - int64(lfuDecay(entry, now.UnixNano()))
+	case VolatileTTL:
+		// 越早过期越优先淘汰。
+		return math.MaxInt64 - entry.ExpireAt.UnixNano()
+	default:
+		return now.UnixNano() - atomic.LoadInt64(&entry.lastAccess)
+	}
+}
+
+// randomKeyLocked 返回分片中任意一个 key（map 遍历顺序随机），调用方需持有分片的锁。
+func (sh *shard) randomKeyLocked(volatile bool) (string, bool) {
+	if volatile {
+		for key := range sh.expires {
+			return key, true
+		}
+		return "", false
+	}
+	for key := range sh.data {
+		return key, true
+	}
+	return "", false
+}
@@ -2,29 +2,44 @@ package db
 
 import "context"
 
-// HSet 设置 hash 字段值。
-func (d *DB) HSet(ctx context.Context, key, field, value string) error {
+// HSet 设置 hash 字段值，fieldValues 为交替排列的字段与值，返回新字段数。
+func (d *DB) HSet(ctx context.Context, key string, fieldValues ...string) (int, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	if err := ctx.Err(); err != nil {
-		return err
+		return 0, err
+	}
+	if len(fieldValues)%2 != 0 {
+		return 0, ErrInvalidCommand
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		h := map[string]string{field: value}
-		d.data[key] = &Entry{Type: TypeHash, Value: h}
-		return nil
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if ok && entry.Type != TypeHash {
+		return 0, ErrWrongType
 	}
-	if entry.Type != TypeHash {
-		return ErrWrongType
+	if !ok {
+		entry = &Entry{Type: TypeHash, Value: make(map[string]string, len(fieldValues)/2)}
+		d.setEntryLocked(key, entry)
 	}
 	h := entry.Value.(map[string]string)
-	h[field] = value
-	return nil
+	added := 0
+	var delta int64
+	for i := 0; i < len(fieldValues); i += 2 {
+		field, value := fieldValues[i], fieldValues[i+1]
+		if old, existed := h[field]; existed {
+			delta += int64(len(value) - len(old))
+		} else {
+			delta += hashFieldSize(field, value)
+			added++
+		}
+		h[field] = value
+	}
+	d.growLocked(key, entry, delta)
+	d.notify(NotifyHash, "hset", key)
+	return added, nil
 }
 
 // HGet 获取 hash 字段值。
@@ -36,11 +51,10 @@ func (d *DB) HGet(ctx context.Context, key, field string) (string, bool, error)
 		return "", false, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		delete(d.data, key)
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
 		return "", false, nil
 	}
 	if entry.Type != TypeHash {
@@ -60,11 +74,10 @@ func (d *DB) HGetAll(ctx context.Context, key string) (map[string]string, error)
 		return nil, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		delete(d.data, key)
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
 		return map[string]string{}, nil
 	}
 	if entry.Type != TypeHash {
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// PFAdd 向 HyperLogLog 加入元素，key 不存在时创建；返回估计值是否可能变化（新建也算变化）。
+// 已有 key 直接在编码上更新寄存器，没有寄存器变化时不写回。
+func (d *DB) PFAdd(ctx context.Context, key string, elements ...string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		h := ds.NewHLL()
+		for _, element := range elements {
+			h.Add(element)
+		}
+		d.storeHLLLocked(key, nil, h.String())
+		d.notify(NotifyString, "pfadd", key)
+		return true, nil
+	}
+	if entry.Type != TypeString {
+		return false, ErrWrongType
+	}
+	value, changed, err := ds.AddHLL(entry.Value.(string), elements...)
+	if err != nil || !changed {
+		return false, err
+	}
+	d.storeHLLLocked(key, entry, value)
+	d.notify(NotifyString, "pfadd", key)
+	return true, nil
+}
+
+// PFCount 返回基数估计。单个 key 时把计算结果缓存回字符串头部（PFCOUNT 是读命令，缓存不复制到从节点，
+// 各节点按相同的寄存器各自计算）；多个 key 时返回合并后的估计，不修改各 key。不存在的 key 视为空集合。
+func (d *DB) PFCount(ctx context.Context, keys ...string) (uint64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(keys) == 1 {
+		sh := d.lockKey(keys[0])
+		defer sh.mu.Unlock()
+		entry, h, err := d.hllLocked(keys[0])
+		if err != nil || entry == nil {
+			return 0, err
+		}
+		_, cached := h.CachedCount()
+		count := h.Count()
+		if !cached {
+			d.storeHLLLocked(keys[0], entry, h.String())
+		}
+		return count, nil
+	}
+
+	unlock := d.lockKeys(keys...)
+	defer unlock()
+	merged := ds.NewHLL()
+	for _, key := range keys {
+		_, h, err := d.hllLocked(key)
+		if err != nil {
+			return 0, err
+		}
+		merged.Merge(h)
+	}
+	return merged.Count(), nil
+}
+
+// PFMerge 把 sources 合并进 dest（dest 原有内容也参与合并），dest 不存在时创建。
+func (d *DB) PFMerge(ctx context.Context, dest string, sources ...string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock := d.lockKeys(append([]string{dest}, sources...)...)
+	defer unlock()
+	entry, merged, err := d.hllLocked(dest)
+	if err != nil {
+		return err
+	}
+	for _, key := range sources {
+		_, h, err := d.hllLocked(key)
+		if err != nil {
+			return err
+		}
+		merged.Merge(h)
+	}
+	d.storeHLLLocked(dest, entry, merged.String())
+	d.notify(NotifyString, "pfadd", dest)
+	return nil
+}
+
+// hllLocked 解码 key 上的 HyperLogLog；key 不存在时返回 nil 条目与空的 HyperLogLog。
+func (d *DB) hllLocked(key string) (*Entry, *ds.HLL, error) {
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		return nil, ds.NewHLL(), nil
+	}
+	if entry.Type != TypeString {
+		return nil, nil, ErrWrongType
+	}
+	h, err := ds.ParseHLL(entry.Value.(string))
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, h, nil
+}
+
+// storeHLLLocked 把 HyperLogLog 编码 value 写回 key：已有条目原地替换值并保留过期时间，entry 为 nil 时新建字符串条目。
+func (d *DB) storeHLLLocked(key string, entry *Entry, value string) {
+	if entry == nil {
+		d.setEntryLocked(key, &Entry{Type: TypeString, Value: value})
+		return
+	}
+	delta := int64(len(value) - len(entry.Value.(string)))
+	entry.Value = value
+	d.growLocked(key, entry, delta)
+}
+
+func (d *DB) executeHLLCommand(ctx context.Context, cmd string, args []string) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, ErrInvalidCommand
+	}
+	switch cmd {
+	case "PFADD":
+		changed, err := d.PFAdd(ctx, args[1], args[2:]...)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			return protocol.IntegerValue(1), nil
+		}
+		return protocol.IntegerValue(0), nil
+	case "PFCOUNT":
+		count, err := d.PFCount(ctx, args[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(count)), nil
+	case "PFMERGE":
+		if err := d.PFMerge(ctx, args[1], args[2:]...); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	}
+	return nil, ErrInvalidCommand
+}
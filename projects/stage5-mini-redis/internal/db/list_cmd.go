@@ -2,12 +2,26 @@ package db
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
 )
 
-// LPush 头插列表。
-func (d *DB) LPush(ctx context.Context, key, value string) (int, error) {
+// LPush 依次将 values 插入列表头部，返回插入后的长度。
+func (d *DB) LPush(ctx context.Context, key string, values ...string) (int, error) {
+	return d.pushList(ctx, key, values, true)
+}
+
+// RPush 依次将 values 追加到列表尾部，返回插入后的长度。
+func (d *DB) RPush(ctx context.Context, key string, values ...string) (int, error) {
+	return d.pushList(ctx, key, values, false)
+}
+
+func (d *DB) pushList(ctx context.Context, key string, values []string, left bool) (int, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -15,25 +29,154 @@ func (d *DB) LPush(ctx context.Context, key, value string) (int, error) {
 		return 0, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		list := &ds.LinkedList{}
-		list.LPush(value)
-		d.data[key] = &Entry{Type: TypeList, Value: list}
-		return 1, nil
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, list, err := d.listLocked(key)
+	if err != nil {
+		return 0, err
+	}
+	if list == nil {
+		list = &ds.LinkedList{}
+		entry = &Entry{Type: TypeList, Value: list}
+		pushValues(list, values, left)
+		d.setEntryLocked(key, entry)
+	} else {
+		var delta int64
+		for _, value := range values {
+			delta += listItemSize(value)
+		}
+		pushValues(list, values, left)
+		d.growLocked(key, entry, delta)
+	}
+	d.notify(NotifyList, pushEvent(left), key)
+	return list.Len(), nil
+}
+
+func pushValues(list *ds.LinkedList, values []string, left bool) {
+	for _, value := range values {
+		if left {
+			list.LPush(value)
+		} else {
+			list.RPush(value)
+		}
+	}
+}
+
+func pushEvent(left bool) string {
+	if left {
+		return "lpush"
+	}
+	return "rpush"
+}
+
+func popEvent(left bool) string {
+	if left {
+		return "lpop"
+	}
+	return "rpop"
+}
+
+// LPop 头删列表。
+func (d *DB) LPop(ctx context.Context, key string) (string, bool, error) {
+	values, err := d.popList(ctx, key, 1, true)
+	if err != nil || len(values) == 0 {
+		return "", false, err
+	}
+	return values[0], true, nil
+}
+
+// RPop 尾删列表。
+func (d *DB) RPop(ctx context.Context, key string) (string, bool, error) {
+	values, err := d.popList(ctx, key, 1, false)
+	if err != nil || len(values) == 0 {
+		return "", false, err
+	}
+	return values[0], true, nil
+}
+
+// LPopCount 从头部弹出至多 count 个元素。
+func (d *DB) LPopCount(ctx context.Context, key string, count int) ([]string, error) {
+	return d.popList(ctx, key, count, true)
+}
+
+// RPopCount 从尾部弹出至多 count 个元素。
+func (d *DB) RPopCount(ctx context.Context, key string, count int) ([]string, error) {
+	return d.popList(ctx, key, count, false)
+}
+
+func (d *DB) popList(ctx context.Context, key string, count int, left bool) ([]string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		return nil, nil
 	}
 	if entry.Type != TypeList {
-		return 0, ErrWrongType
+		return nil, ErrWrongType
 	}
 	list := entry.Value.(*ds.LinkedList)
-	list.LPush(value)
-	return len(list.Range(0, 1<<20)), nil
+	values := make([]string, 0, min(count, list.Len()))
+	var delta int64
+	for len(values) < count {
+		pop := list.RPop
+		if left {
+			pop = list.LPop
+		}
+		value, exists := pop()
+		if !exists {
+			break
+		}
+		values = append(values, value)
+		delta -= listItemSize(value)
+	}
+	if len(values) > 0 {
+		d.notify(NotifyList, popEvent(left), key)
+	}
+	d.shrinkListLocked(key, entry, delta)
+	return values, nil
 }
 
-// RPush 尾插列表。
-func (d *DB) RPush(ctx context.Context, key, value string) (int, error) {
+// shrinkListLocked 记录列表元素被删除后的内存变化，列表为空时删除 key（与 Redis 相同，不保留空列表），调用方需持有锁。
+func (d *DB) shrinkListLocked(key string, entry *Entry, delta int64) {
+	if entry.Value.(*ds.LinkedList).Len() == 0 {
+		d.deleteLocked(key)
+		d.notify(NotifyGeneric, "del", key)
+		return
+	}
+	if delta != 0 {
+		d.growLocked(key, entry, delta)
+	}
+}
+
+// listLocked 返回 key 对应的列表，key 不存在时返回 nil，调用方需持有锁。
+func (d *DB) listLocked(key string) (*Entry, *ds.LinkedList, error) {
+	return listOf(d.lookupLocked(key))
+}
+
+// listRLocked 是 listLocked 的读锁版本。
+func (d *DB) listRLocked(key string) (*Entry, *ds.LinkedList, error) {
+	return listOf(d.lookupRLocked(key))
+}
+
+func listOf(entry *Entry, ok bool) (*Entry, *ds.LinkedList, error) {
+	if !ok {
+		return nil, nil, nil
+	}
+	if entry.Type != TypeList {
+		return nil, nil, ErrWrongType
+	}
+	return entry, entry.Value.(*ds.LinkedList), nil
+}
+
+// LLen 返回列表长度。
+func (d *DB) LLen(ctx context.Context, key string) (int, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -41,25 +184,111 @@ func (d *DB) RPush(ctx context.Context, key, value string) (int, error) {
 		return 0, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		list := &ds.LinkedList{}
-		list.RPush(value)
-		d.data[key] = &Entry{Type: TypeList, Value: list}
-		return 1, nil
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	_, list, err := d.listRLocked(key)
+	if err != nil || list == nil {
+		return 0, err
 	}
-	if entry.Type != TypeList {
-		return 0, ErrWrongType
+	return list.Len(), nil
+}
+
+// LIndex 返回下标处的元素，负数下标从尾部倒数。
+func (d *DB) LIndex(ctx context.Context, key string, index int) (string, bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	list := entry.Value.(*ds.LinkedList)
-	list.RPush(value)
-	return len(list.Range(0, 1<<20)), nil
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	_, list, err := d.listRLocked(key)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+	value, ok := list.Index(index)
+	return value, ok, nil
 }
 
-// LPop 头删列表。
-func (d *DB) LPop(ctx context.Context, key string) (string, bool, error) {
+// LSet 覆盖下标处的元素。
+func (d *DB) LSet(ctx context.Context, key string, index int, value string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, list, err := d.listLocked(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return ErrNoSuchKey
+	}
+	old, ok := list.Set(index, value)
+	if !ok {
+		return ErrIndexOutOfRange
+	}
+	d.growLocked(key, entry, int64(len(value)-len(old)))
+	d.notify(NotifyList, "lset", key)
+	return nil
+}
+
+// LRem 删除与 value 相等的元素，count 的含义与 LREM 相同，返回删除个数。
+func (d *DB) LRem(ctx context.Context, key string, count int, value string) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, list, err := d.listLocked(key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	removed := list.Remove(count, value)
+	if removed > 0 {
+		d.notify(NotifyList, "lrem", key)
+		d.shrinkListLocked(key, entry, -int64(removed)*listItemSize(value))
+	}
+	return removed, nil
+}
+
+// LTrim 只保留 [start, stop] 区间内的元素。
+func (d *DB) LTrim(ctx context.Context, key string, start, stop int) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, list, err := d.listLocked(key)
+	if err != nil || list == nil {
+		return err
+	}
+	var delta int64
+	for _, value := range list.Trim(start, stop) {
+		delta -= listItemSize(value)
+	}
+	d.notify(NotifyList, "ltrim", key)
+	d.shrinkListLocked(key, entry, delta)
+	return nil
+}
+
+// LMove 从 source 的一端弹出元素并压入 destination 的一端，source 为空时返回 false。
+// fromLeft/toLeft 分别对应 LMOVE 的 wherefrom/whereto 是否为 LEFT；source 与 destination 可以相同（旋转列表）。
+func (d *DB) LMove(ctx context.Context, source, destination string, fromLeft, toLeft bool) (string, bool, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -67,19 +296,43 @@ func (d *DB) LPop(ctx context.Context, key string) (string, bool, error) {
 		return "", false, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		delete(d.data, key)
-		return "", false, nil
+	unlock := d.lockKeys(source, destination)
+	defer unlock()
+	srcEntry, src, err := d.listLocked(source)
+	if err != nil || src == nil {
+		return "", false, err
 	}
-	if entry.Type != TypeList {
-		return "", false, ErrWrongType
+	// 先检查目标类型，避免弹出后才发现无法写入。
+	dstEntry, dst, err := d.listLocked(destination)
+	if err != nil {
+		return "", false, err
 	}
-	list := entry.Value.(*ds.LinkedList)
-	value, exists := list.LPop()
-	return value, exists, nil
+	pop := src.RPop
+	if fromLeft {
+		pop = src.LPop
+	}
+	value, _ := pop()
+	moved := []string{value}
+	// 与 Redis 相同的通知顺序：先目标的 push，再源的 pop，源被清空时最后是 del。
+	if source == destination {
+		pushValues(src, moved, toLeft)
+		d.touchLocked(source)
+		d.notify(NotifyList, pushEvent(toLeft), destination)
+		d.notify(NotifyList, popEvent(fromLeft), source)
+		return value, true, nil
+	}
+	if dst == nil {
+		dst = &ds.LinkedList{}
+		pushValues(dst, moved, toLeft)
+		d.setEntryLocked(destination, &Entry{Type: TypeList, Value: dst})
+	} else {
+		pushValues(dst, moved, toLeft)
+		d.growLocked(destination, dstEntry, listItemSize(value))
+	}
+	d.notify(NotifyList, pushEvent(toLeft), destination)
+	d.notify(NotifyList, popEvent(fromLeft), source)
+	d.shrinkListLocked(source, srcEntry, -listItemSize(value))
+	return value, true, nil
 }
 
 // LRange 返回区间列表。
@@ -91,11 +344,10 @@ func (d *DB) LRange(ctx context.Context, key string, start, stop int) ([]string,
 		return nil, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		delete(d.data, key)
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
 		return nil, nil
 	}
 	if entry.Type != TypeList {
@@ -104,3 +356,27 @@ func (d *DB) LRange(ctx context.Context, key string, start, stop int) ([]string,
 	list := entry.Value.(*ds.LinkedList)
 	return list.Range(start, stop), nil
 }
+
+// ParseTimeout 解析阻塞命令的超时秒数（可带小数），0 表示一直等待。
+func ParseTimeout(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errors.New("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, errors.New("timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseListEnd 解析 LMOVE 的 LEFT/RIGHT 参数，返回是否为 LEFT。
+func parseListEnd(s string) (bool, error) {
+	switch strings.ToUpper(s) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	default:
+		return false, ErrInvalidCommand
+	}
+}
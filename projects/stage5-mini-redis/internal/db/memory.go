@@ -0,0 +1,233 @@
+package db
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+)
+
+// 近似内存开销（字节），参照 Redis 的 dictEntry、robj 与各编码节点大小估算，只用于 maxmemory 判定。
+const (
+	entryOverhead       = 64
+	listNodeOverhead    = 32
+	setMemberOverhead   = 24
+	hashFieldOverhead   = 32
+	zsetMemberOverhead  = 56
+	streamEntryOverhead = 48
+	lfuInitVal          = 5
+	lfuLogFactor        = 10
+	lfuDecayTime        = time.Minute
+	maxEvictionPoolSize = 16
+)
+
+// lookupLocked 返回未过期的条目并记录访问（LRU 时间与 LFU 计数），过期条目被惰性删除，
+// 调用方需持有 key 所在分片的锁（下同）。
+func (d *DB) lookupLocked(key string) (*Entry, bool) {
+	entry, ok := d.peekLocked(key)
+	if !ok {
+		return nil, false
+	}
+	recordAccess(entry)
+	return entry, true
+}
+
+// lookupRLocked 是 lookupLocked 的读锁版本：过期条目视为不存在但不删除，调用方需持有分片的读锁。
+func (d *DB) lookupRLocked(key string) (*Entry, bool) {
+	entry, ok := d.peekRLocked(key)
+	if !ok {
+		return nil, false
+	}
+	recordAccess(entry)
+	return entry, true
+}
+
+// peekRLocked 与 lookupRLocked 相同但不记录访问。
+func (d *DB) peekRLocked(key string) (*Entry, bool) {
+	entry, ok := d.shardFor(key).data[key]
+	if !ok || isExpired(entry) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// recordAccess 记录一次访问（LRU 时间与 LFU 计数）。同一分片的多个读者可能并发访问同一条目，
+// 两个字段以原子操作读写；并发递增偶尔丢失一次计数对近似的 LFU 没有影响。
+func recordAccess(entry *Entry) {
+	now := time.Now().UnixNano()
+	atomic.StoreUint32(&entry.freq, uint32(lfuIncr(lfuDecay(entry, now))))
+	atomic.StoreInt64(&entry.lastAccess, now)
+}
+
+// peekLocked 与 lookupLocked 相同但不记录访问，用于内部检查。
+func (d *DB) peekLocked(key string) (*Entry, bool) {
+	entry, ok := d.shardFor(key).data[key]
+	if !ok {
+		return nil, false
+	}
+	if isExpired(entry) {
+		d.expireLocked(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// expireLocked 删除已过期的 key 并发出 expired 通知。
+func (d *DB) expireLocked(key string) {
+	d.deleteLocked(key)
+	d.expiredKeys.Add(1)
+	d.notify(NotifyExpired, "expired", key)
+}
+
+// setEntryLocked 写入（或整体替换）条目并更新内存统计与过期索引。
+func (d *DB) setEntryLocked(key string, entry *Entry) {
+	sh := d.shardFor(key)
+	if old, ok := sh.data[key]; ok {
+		d.usedMemory.Add(-old.size)
+	} else {
+		sh.keys.add(key)
+	}
+	entry.size = entrySize(key, entry)
+	if entry.lastAccess == 0 {
+		entry.lastAccess = time.Now().UnixNano()
+		entry.freq = lfuInitVal
+	}
+	d.usedMemory.Add(entry.size)
+	sh.data[key] = entry
+	if entry.ExpireAt.IsZero() {
+		delete(sh.expires, key)
+	} else {
+		sh.expires[key] = struct{}{}
+	}
+	d.touchLocked(key)
+}
+
+// deleteLocked 删除 key 并更新内存统计与过期索引。
+func (d *DB) deleteLocked(key string) bool {
+	sh := d.shardFor(key)
+	entry, ok := sh.data[key]
+	if !ok {
+		return false
+	}
+	d.usedMemory.Add(-entry.size)
+	delete(sh.data, key)
+	delete(sh.expires, key)
+	sh.keys.remove(key)
+	d.touchLocked(key)
+	return true
+}
+
+// growLocked 记录对已有条目的原地修改，delta 为近似内存变化量。
+func (d *DB) growLocked(key string, entry *Entry, delta int64) {
+	entry.size += delta
+	d.usedMemory.Add(delta)
+	d.touchLocked(key)
+}
+
+// rebuildIndexesLocked 分片数据整体替换后重算过期索引与 SCAN 索引，返回分片的内存占用，调用方需持有分片的锁。
+func (sh *shard) rebuildIndexesLocked() int64 {
+	var used int64
+	sh.expires = make(map[string]struct{})
+	sh.keys = newKeyIndex(sh.keys.seed)
+	now := time.Now().UnixNano()
+	for key, entry := range sh.data {
+		entry.size = entrySize(key, entry)
+		if entry.lastAccess == 0 {
+			entry.lastAccess = now
+			entry.freq = lfuInitVal
+		}
+		used += entry.size
+		sh.keys.add(key)
+		if !entry.ExpireAt.IsZero() {
+			sh.expires[key] = struct{}{}
+		}
+	}
+	return used
+}
+
+// entrySize 估算条目占用的内存。
+func entrySize(key string, entry *Entry) int64 {
+	size := int64(len(key)) + entryOverhead
+	switch entry.Type {
+	case TypeString:
+		value, _ := entry.Value.(string)
+		size += int64(len(value))
+	case TypeList:
+		list := entry.Value.(*ds.LinkedList)
+		for _, item := range list.Range(0, list.Len()-1) {
+			size += listItemSize(item)
+		}
+	case TypeSet:
+		for member := range entry.Value.(map[string]struct{}) {
+			size += setMemberSize(member)
+		}
+	case TypeHash:
+		for field, value := range entry.Value.(map[string]string) {
+			size += hashFieldSize(field, value)
+		}
+	case TypeZSet:
+		for _, item := range entry.Value.(*ds.SkipList).RangeByScore(math.Inf(-1), math.Inf(1)) {
+			size += zsetMemberSize(item.Member)
+		}
+	case TypeStream:
+		for _, e := range entry.Value.(*ds.Stream).Range(ds.StreamID{}, ds.MaxStreamID, 0, false) {
+			size += streamEntrySize(e.Fields)
+		}
+	}
+	return size
+}
+
+func listItemSize(item string) int64 {
+	return int64(len(item)) + listNodeOverhead
+}
+
+func setMemberSize(member string) int64 {
+	return int64(len(member)) + setMemberOverhead
+}
+
+func hashFieldSize(field, value string) int64 {
+	return int64(len(field)+len(value)) + hashFieldOverhead
+}
+
+func zsetMemberSize(member string) int64 {
+	return int64(len(member)) + zsetMemberOverhead
+}
+
+// streamEntrySize 估算一条流消息的内存，消费者组与 PEL 不计入。
+func streamEntrySize(fields []string) int64 {
+	size := int64(streamEntryOverhead)
+	for _, field := range fields {
+		size += int64(len(field))
+	}
+	return size
+}
+
+// lfuIncr 对数递增访问计数：计数越大递增概率越低，与 Redis LFULogIncr 相同。
+func lfuIncr(counter uint8) uint8 {
+	if counter == math.MaxUint8 {
+		return counter
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// lfuDecay 按距上次访问经过的衰减周期数降低计数，与 Redis LFUDecrAndReturn 相同。
+func lfuDecay(entry *Entry, now int64) uint8 {
+	freq := uint8(atomic.LoadUint32(&entry.freq))
+	periods := (now - atomic.LoadInt64(&entry.lastAccess)) / int64(lfuDecayTime)
+	if periods <= 0 {
+		return freq
+	}
+	if periods >= int64(freq) {
+		return 0
+	}
+	return freq - uint8(periods)
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// NotifyClass keyspace 事件类别的位集合，与 notify-keyspace-events 配置中的字符一一对应。
+type NotifyClass uint32
+
+const (
+	NotifyKeyspace NotifyClass = 1 << iota // K：发布到 __keyspace@0__:<key>，消息为事件名
+	NotifyKeyevent                         // E：发布到 __keyevent@0__:<event>，消息为 key
+	NotifyGeneric                          // g：DEL、EXPIRE、RESTORE 等与类型无关的命令
+	NotifyString                           // $：字符串命令
+	NotifyList                             // l：列表命令
+	NotifySet                              // s：集合命令
+	NotifyHash                             // h：哈希命令
+	NotifyZSet                             // z：有序集合命令
+	NotifyExpired                          // x：key 过期删除
+	NotifyEvicted                          // e：maxmemory 淘汰
+	NotifyStream                           // t：Stream 命令
+
+	// NotifyAll 对应配置字符 A，即 g$lshzxet。
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash | NotifyZSet |
+		NotifyExpired | NotifyEvicted | NotifyStream
+)
+
+const (
+	keyspaceChannelPrefix = "__keyspace@0__:"
+	keyeventChannelPrefix = "__keyevent@0__:"
+)
+
+var notifyClassChars = []struct {
+	char  byte
+	class NotifyClass
+}{
+	{'g', NotifyGeneric}, {'$', NotifyString}, {'l', NotifyList}, {'s', NotifySet}, {'h', NotifyHash},
+	{'z', NotifyZSet}, {'x', NotifyExpired}, {'e', NotifyEvicted}, {'t', NotifyStream},
+	{'K', NotifyKeyspace}, {'E', NotifyKeyevent},
+}
+
+// ParseNotifyKeyspaceEvents 按 Redis notify-keyspace-events 的格式解析事件配置，空串表示关闭通知。
+func ParseNotifyKeyspaceEvents(flags string) (NotifyClass, error) {
+	var classes NotifyClass
+next:
+	for i := 0; i < len(flags); i++ {
+		if flags[i] == 'A' {
+			classes |= NotifyAll
+			continue
+		}
+		for _, c := range notifyClassChars {
+			if c.char == flags[i] {
+				classes |= c.class
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("invalid notify-keyspace-events class %q", flags[i])
+	}
+	return classes, nil
+}
+
+// String 返回规范化的配置字符串，全部类别以 A 表示。
+func (c NotifyClass) String() string {
+	var b strings.Builder
+	if c&NotifyAll == NotifyAll {
+		b.WriteByte('A')
+	}
+	for _, item := range notifyClassChars {
+		if c&item.class == 0 || (item.class&NotifyAll != 0 && c&NotifyAll == NotifyAll) {
+			continue
+		}
+		b.WriteByte(item.char)
+	}
+	return b.String()
+}
+
+// notifier keyspace 通知配置。publish 由服务层注入（通常是 pub/sub Hub 的发布），
+// 必须非阻塞：通知在持有 DB 锁时发出，保证与引发它的修改同序。
+type notifier struct {
+	classes atomic.Uint32
+	publish func(channel, message string)
+}
+
+// SetNotifier 设置 keyspace 通知的发布函数，需在处理命令之前调用。
+func (d *DB) SetNotifier(publish func(channel, message string)) {
+	d.notifier.publish = publish
+}
+
+// SetNotifyKeyspaceEvents 设置启用的事件类别；K 与 E 都未设置时不发送任何通知。
+func (d *DB) SetNotifyKeyspaceEvents(classes NotifyClass) {
+	d.notifier.classes.Store(uint32(classes))
+}
+
+// NotifyKeyspaceEvents 返回当前启用的事件类别。
+func (d *DB) NotifyKeyspaceEvents() NotifyClass {
+	return NotifyClass(d.notifier.classes.Load())
+}
+
+// notify 在类别启用时发布 key 上的事件。
+func (d *DB) notify(class NotifyClass, event, key string) {
+	classes := d.NotifyKeyspaceEvents()
+	if d.notifier.publish == nil || classes&class == 0 {
+		return
+	}
+	if classes&NotifyKeyspace != 0 {
+		d.notifier.publish(keyspaceChannelPrefix+key, event)
+	}
+	if classes&NotifyKeyevent != 0 {
+		d.notifier.publish(keyeventChannelPrefix+event, key)
+	}
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// PropagateCommands 将写命令改写为可安全重放的形式。
+// 相对过期时间会被换算为 PEXPIREAT 绝对时间，避免重放时 TTL 被重新计时；
+// 非正数的 EXPIRE 在本地立即使 key 过期，传播为 DEL。非正数 EX 的 SET 会被拒绝，不会走到这里，
+// 为保险起见也不生成 PEXPIREAT，以免重放端删除本地仍存在的 key。
+func PropagateCommands(args []string, now time.Time) [][]string {
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "SET":
+		if len(args) >= 5 && strings.EqualFold(args[3], "EX") {
+			seconds, err := strconv.Atoi(args[4])
+			if err != nil {
+				return [][]string{args}
+			}
+			if seconds <= 0 {
+				return [][]string{{"SET", args[1], args[2]}}
+			}
+			at := now.Add(time.Duration(seconds) * time.Second)
+			return [][]string{
+				{"SET", args[1], args[2]},
+				{"PEXPIREAT", args[1], strconv.FormatInt(at.UnixMilli(), 10)},
+			}
+		}
+	case "EXPIRE":
+		if len(args) >= 3 {
+			seconds, err := strconv.Atoi(args[2])
+			if err != nil {
+				return [][]string{args}
+			}
+			if seconds <= 0 {
+				return [][]string{{"DEL", args[1]}}
+			}
+			at := now.Add(time.Duration(seconds) * time.Second)
+			return [][]string{{"PEXPIREAT", args[1], strconv.FormatInt(at.UnixMilli(), 10)}}
+		}
+	}
+	return [][]string{args}
+}
+
+// ResolveCommand 按执行结果改写依赖执行时状态的写命令，使 AOF 重放与从节点得到相同结果：
+// XADD 的自动 ID 替换为实际生成的 ID；XCLAIM 只认领实际转移的消息，投递时间统一换算为绝对的 TIME；
+// BLPOP/BRPOP/BLMOVE 改写为对实际弹出 key 的 LPOP/RPOP/LMOVE，重放时不会阻塞；没有弹出元素时返回 nil，无需传播。
+func ResolveCommand(args []string, result *protocol.Value, now time.Time) []string {
+	if len(args) == 0 || result == nil {
+		return args
+	}
+	switch cmd := strings.ToUpper(args[0]); cmd {
+	case "BLPOP", "BRPOP":
+		if result.Type != protocol.Array || len(result.Array) != 2 {
+			return nil
+		}
+		return []string{cmd[1:], result.Array[0].Str}
+	case "BLMOVE":
+		if len(args) != 6 || result.Type == protocol.Null {
+			return nil
+		}
+		return append([]string{"LMOVE"}, args[1:5]...)
+	case "XADD":
+		_, idIndex, err := parseXAdd(args)
+		if err != nil || result.Type != protocol.BulkString {
+			return args
+		}
+		resolved := append([]string(nil), args...)
+		resolved[idIndex] = result.Str
+		return resolved
+	case "XCLAIM":
+		if len(args) < 6 {
+			return args
+		}
+		_, opts, err := parseXClaim(args[5:])
+		if err != nil {
+			return args
+		}
+		resolved := []string{"XCLAIM", args[1], args[2], args[3], "0"}
+		for _, item := range result.Array {
+			if opts.JustID {
+				resolved = append(resolved, item.Str)
+			} else if len(item.Array) > 0 {
+				resolved = append(resolved, item.Array[0].Str)
+			}
+		}
+		if len(resolved) == 5 {
+			// 没有认领到消息时只剩创建消费者的副作用。
+			return []string{"XGROUP", "CREATECONSUMER", args[1], args[2], args[3]}
+		}
+		switch {
+		case opts.Time >= 0:
+			resolved = append(resolved, "TIME", strconv.FormatInt(opts.Time, 10))
+		case opts.Idle >= 0:
+			resolved = append(resolved, "TIME", strconv.FormatInt(now.UnixMilli()-opts.Idle, 10))
+		default:
+			resolved = append(resolved, "TIME", strconv.FormatInt(now.UnixMilli(), 10))
+		}
+		if opts.RetryCount >= 0 {
+			resolved = append(resolved, "RETRYCOUNT", strconv.FormatInt(opts.RetryCount, 10))
+		}
+		if opts.Force {
+			resolved = append(resolved, "FORCE")
+		}
+		if opts.JustID {
+			resolved = append(resolved, "JUSTID")
+		}
+		return resolved
+	}
+	return args
+}
@@ -0,0 +1,394 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/glob"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+const (
+	minKeyIndexBuckets = 16
+	defaultScanCount   = 10
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrUnknownType   = errors.New("unknown type name")
+)
+
+var typeNames = [...]string{
+	TypeString: "string",
+	TypeList:   "list",
+	TypeSet:    "set",
+	TypeZSet:   "zset",
+	TypeHash:   "hash",
+	TypeStream: "stream",
+}
+
+// String 返回 TYPE 命令使用的类型名。
+func (t ValueType) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return "unknown"
+}
+
+// ParseValueType 按 TYPE 命令的类型名（不区分大小写）解析类型。
+func ParseValueType(name string) (ValueType, bool) {
+	for t, typeName := range typeNames {
+		if strings.EqualFold(name, typeName) {
+			return ValueType(t), true
+		}
+	}
+	return 0, false
+}
+
+// keyIndex 按哈希分桶的 key 索引。桶数为 2 的幂，随 key 数量翻倍或减半；
+// 游标按反向二进制递增（与 Redis dictScan 相同），桶数在两次 SCAN 之间变化时，
+// 整个遍历期间一直存在的 key 仍至少返回一次，代价是可能重复返回。
+type keyIndex struct {
+	seed    maphash.Seed
+	buckets [][]string
+	count   int
+}
+
+func newKeyIndex(seed maphash.Seed) *keyIndex {
+	return &keyIndex{seed: seed, buckets: make([][]string, minKeyIndexBuckets)}
+}
+
+func (idx *keyIndex) hash(key string) uint64 {
+	return maphash.String(idx.seed, key)
+}
+
+func (idx *keyIndex) bucket(key string) int {
+	return int(idx.hash(key) & uint64(len(idx.buckets)-1))
+}
+
+// add 登记新 key，调用方保证 key 尚未登记。
+func (idx *keyIndex) add(key string) {
+	i := idx.bucket(key)
+	idx.buckets[i] = append(idx.buckets[i], key)
+	idx.count++
+	if idx.count > len(idx.buckets) {
+		idx.resize(len(idx.buckets) * 2)
+	}
+}
+
+func (idx *keyIndex) remove(key string) {
+	i := idx.bucket(key)
+	bucket := idx.buckets[i]
+	for j, other := range bucket {
+		if other == key {
+			last := len(bucket) - 1
+			bucket[j] = bucket[last]
+			bucket[last] = ""
+			idx.buckets[i] = bucket[:last]
+			idx.count--
+			break
+		}
+	}
+	if len(idx.buckets) > minKeyIndexBuckets && idx.count < len(idx.buckets)/8 {
+		idx.resize(len(idx.buckets) / 2)
+	}
+}
+
+func (idx *keyIndex) resize(size int) {
+	old := idx.buckets
+	idx.buckets = make([][]string, size)
+	for _, bucket := range old {
+		for _, key := range bucket {
+			i := idx.bucket(key)
+			idx.buckets[i] = append(idx.buckets[i], key)
+		}
+	}
+}
+
+// scan 将游标所在桶的 key 追加到 keys，返回下一个游标，0 表示遍历结束。
+func (idx *keyIndex) scan(cursor uint64, keys []string) ([]string, uint64) {
+	mask := uint64(len(idx.buckets) - 1)
+	keys = append(keys, idx.buckets[cursor&mask]...)
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return keys, bits.Reverse64(cursor)
+}
+
+// ScanOptions SCAN 系列命令的过滤条件：Match 为 glob 模式，Count 为每次遍历量的提示，
+// Type 仅 SCAN 使用，按值类型过滤。
+type ScanOptions struct {
+	Match   string
+	Count   int
+	Type    ValueType
+	HasType bool
+}
+
+func (o ScanOptions) match(s string) bool {
+	return o.Match == "" || glob.Match(o.Match, s)
+}
+
+// Scan 从 cursor 开始增量遍历 key 空间，返回下一个游标（0 表示结束）与本次的 key。
+// 游标的低 shardBits 位为分片下标，其余位为分片内 SCAN 索引的游标，分片按下标依次遍历，空分片直接跳过。
+// 每次最多访问 Count*10 个桶，过期 key 在遍历中顺带删除；MATCH 与 TYPE 在取出之后过滤，
+// 因此单次返回可能为空而游标未结束。
+func (d *DB) Scan(ctx context.Context, cursor uint64, opts ScanOptions) (uint64, []string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	count := opts.Count
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	index, inner := int(cursor&(shardCount-1)), cursor>>shardBits
+	var keys, result []string
+	for visits, visited := count*10, 0; ; {
+		sh := d.shards[index]
+		sh.mu.Lock()
+		if sh.keys.count > 0 {
+			keys, inner = sh.keys.scan(inner, keys[:0])
+			visits--
+			visited += len(keys)
+			for _, key := range keys {
+				entry, ok := d.peekLocked(key)
+				if !ok || !opts.match(key) || (opts.HasType && entry.Type != opts.Type) {
+					continue
+				}
+				result = append(result, key)
+			}
+		} else {
+			inner = 0
+		}
+		sh.mu.Unlock()
+		if inner == 0 {
+			if index++; index == shardCount {
+				return 0, result, nil
+			}
+		}
+		if visited >= count || visits <= 0 {
+			break
+		}
+	}
+	return inner<<shardBits | uint64(index), result, nil
+}
+
+// SScan 增量遍历集合成员。
+func (d *DB) SScan(ctx context.Context, key string, cursor uint64, opts ScanOptions) (uint64, []string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
+		return 0, nil, nil
+	}
+	if entry.Type != TypeSet {
+		return 0, nil, ErrWrongType
+	}
+	set := entry.Value.(map[string]struct{})
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	members, next := scanWindow(d.seed, members, cursor, opts, func(member string) string { return member })
+	return next, members, nil
+}
+
+// HScan 增量遍历哈希，返回交替排列的字段与值。
+func (d *DB) HScan(ctx context.Context, key string, cursor uint64, opts ScanOptions) (uint64, []string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
+		return 0, nil, nil
+	}
+	if entry.Type != TypeHash {
+		return 0, nil, ErrWrongType
+	}
+	hash := entry.Value.(map[string]string)
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	fields, next := scanWindow(d.seed, fields, cursor, opts, func(field string) string { return field })
+	pairs := make([]string, 0, len(fields)*2)
+	for _, field := range fields {
+		pairs = append(pairs, field, hash[field])
+	}
+	return next, pairs, nil
+}
+
+// ZScan 增量遍历有序集合。
+func (d *DB) ZScan(ctx context.Context, key string, cursor uint64, opts ScanOptions) (uint64, []ds.ZItem, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
+		return 0, nil, nil
+	}
+	if entry.Type != TypeZSet {
+		return 0, nil, ErrWrongType
+	}
+	z := entry.Value.(*ds.SkipList)
+	items := make([]ds.ZItem, 0, z.Len())
+	z.Each(func(member string, score float64) {
+		items = append(items, ds.ZItem{Member: member, Score: score})
+	})
+	items, next := scanWindow(d.seed, items, cursor, opts, func(item ds.ZItem) string { return item.Member })
+	return next, items, nil
+}
+
+// scanWindow 容器内的成员没有分桶索引，以成员哈希按位反转后的值作为游标空间：
+// 每次取位置不小于 cursor 的前 Count 个成员，成员的位置与容器的增删无关，
+// 因此遍历期间一直存在的成员恰好返回一次。每次调用都要遍历整个容器，但只在本次调用内持锁。
+func scanWindow[T any](seed maphash.Seed, items []T, cursor uint64, opts ScanOptions, member func(T) string) ([]T, uint64) {
+	count := opts.Count
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	type positioned struct {
+		pos  uint64
+		item T
+	}
+	window := make([]positioned, 0, len(items))
+	for _, item := range items {
+		if pos := bits.Reverse64(maphash.String(seed, member(item))); pos >= cursor {
+			window = append(window, positioned{pos: pos, item: item})
+		}
+	}
+	sort.Slice(window, func(i, j int) bool { return window[i].pos < window[j].pos })
+	next := uint64(0)
+	if len(window) > count {
+		// 位置相同的成员必须在同一批返回，否则下一个游标会跳过它们。
+		end := count
+		for end < len(window) && window[end].pos == window[count-1].pos {
+			end++
+		}
+		if end < len(window) {
+			next = window[end-1].pos + 1
+			window = window[:end]
+		}
+	}
+	result := items[:0]
+	for _, w := range window {
+		if opts.match(member(w.item)) {
+			result = append(result, w.item)
+		}
+	}
+	return result, next
+}
+
+// Type 返回 key 的类型名，不存在时返回 "none"。
+func (d *DB) Type(ctx context.Context, key string) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.peekRLocked(key)
+	if !ok {
+		return "none", nil
+	}
+	return entry.Type.String(), nil
+}
+
+func (d *DB) executeScanCommand(ctx context.Context, cmd string, args []string) (*protocol.Value, error) {
+	optionStart := 2
+	if cmd != "SCAN" {
+		optionStart = 3
+	}
+	if len(args) < optionStart {
+		return nil, ErrInvalidCommand
+	}
+	cursor, err := strconv.ParseUint(args[optionStart-1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	opts, err := parseScanOptions(args[optionStart:], cmd == "SCAN")
+	if err != nil {
+		return nil, err
+	}
+
+	var next uint64
+	var items []string
+	switch cmd {
+	case "SCAN":
+		next, items, err = d.Scan(ctx, cursor, opts)
+	case "SSCAN":
+		next, items, err = d.SScan(ctx, args[1], cursor, opts)
+	case "HSCAN":
+		next, items, err = d.HScan(ctx, args[1], cursor, opts)
+	case "ZSCAN":
+		var zItems []ds.ZItem
+		next, zItems, err = d.ZScan(ctx, args[1], cursor, opts)
+		for _, item := range zItems {
+			items = append(items, item.Member, protocol.FormatDouble(item.Score))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return protocol.ArrayValue(*protocol.BulkStringValue(strconv.FormatUint(next, 10)), *protocol.StringArray(items)), nil
+}
+
+// parseScanOptions 解析 [MATCH pattern] [COUNT count] [TYPE type]，TYPE 只对 SCAN 有效。
+func parseScanOptions(args []string, allowType bool) (ScanOptions, error) {
+	var opts ScanOptions
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return opts, ErrInvalidCommand
+		}
+		switch option := strings.ToUpper(args[i]); {
+		case option == "MATCH":
+			opts.Match = args[i+1]
+		case option == "COUNT":
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				return opts, ErrInvalidCommand
+			}
+			opts.Count = count
+		case option == "TYPE" && allowType:
+			typ, ok := ParseValueType(args[i+1])
+			if !ok {
+				return opts, ErrUnknownType
+			}
+			opts.Type, opts.HasType = typ, true
+		default:
+			return opts, ErrInvalidCommand
+		}
+	}
+	return opts, nil
+}
@@ -2,30 +2,40 @@ package db
 
 import "context"
 
-// SAdd 向集合添加元素。
-func (d *DB) SAdd(ctx context.Context, key, member string) (bool, error) {
+// SAdd 向集合添加元素，返回新加入的成员数。
+func (d *DB) SAdd(ctx context.Context, key string, members ...string) (int, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	if err := ctx.Err(); err != nil {
-		return false, err
+		return 0, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		set := map[string]struct{}{member: {}}
-		d.data[key] = &Entry{Type: TypeSet, Value: set}
-		return true, nil
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if ok && entry.Type != TypeSet {
+		return 0, ErrWrongType
 	}
-	if entry.Type != TypeSet {
-		return false, ErrWrongType
+	if !ok {
+		entry = &Entry{Type: TypeSet, Value: make(map[string]struct{}, len(members))}
+		d.setEntryLocked(key, entry)
 	}
 	set := entry.Value.(map[string]struct{})
-	_, existed := set[member]
-	set[member] = struct{}{}
-	return !existed, nil
+	added := 0
+	var delta int64
+	for _, member := range members {
+		if _, existed := set[member]; !existed {
+			set[member] = struct{}{}
+			delta += setMemberSize(member)
+			added++
+		}
+	}
+	d.growLocked(key, entry, delta)
+	if added > 0 {
+		d.notify(NotifySet, "sadd", key)
+	}
+	return added, nil
 }
 
 // SMembers 获取集合全部成员。
@@ -37,11 +47,10 @@ func (d *DB) SMembers(ctx context.Context, key string) ([]string, error) {
 		return nil, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		delete(d.data, key)
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
 		return nil, nil
 	}
 	if entry.Type != TypeSet {
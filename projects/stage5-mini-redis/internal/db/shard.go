@@ -0,0 +1,155 @@
+package db
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+// shardBits 决定 key 空间的分片数（2 的幂），分片按 key 哈希的高位选择，
+// 与 SCAN 索引使用的低位互不相关。
+const (
+	shardBits  = 6
+	shardCount = 1 << shardBits
+)
+
+// shard 一部分 key 的数据与索引，由各自的锁保护。单 key 命令只锁住所在分片，
+// 不同分片上的命令可以并行执行；涉及多个分片时按下标升序加锁，避免死锁。
+type shard struct {
+	index int
+	// cmd 命令锁，覆盖一条命令从执行到服务层传播完成的全过程：读命令共享、写命令独占，
+	// 事务等需要一致视图的操作独占全部分片。mu 只保护分片数据，加锁顺序为 cmd → mu。
+	cmd sync.RWMutex
+	// mu 读操作持读锁，修改数据（包括惰性删除过期 key）持写锁。
+	mu   sync.RWMutex
+	data map[string]*Entry
+	// expires 为带过期时间的 key 索引，供定期删除与 volatile-* 淘汰策略采样。
+	expires map[string]struct{}
+	// keys 为按哈希分桶的 key 索引，供 SCAN 增量遍历。
+	keys    *keyIndex
+	watches map[string]*watchState
+}
+
+func newShard(index int, seed maphash.Seed) *shard {
+	return &shard{
+		index:   index,
+		data:    make(map[string]*Entry),
+		expires: make(map[string]struct{}),
+		keys:    newKeyIndex(seed),
+		watches: make(map[string]*watchState),
+	}
+}
+
+// shardFor 返回 key 所在的分片。
+func (d *DB) shardFor(key string) *shard {
+	return d.shards[maphash.String(d.seed, key)>>(64-shardBits)]
+}
+
+// lockKey 锁住 key 所在的分片并返回它，由调用方解锁。
+func (d *DB) lockKey(key string) *shard {
+	sh := d.shardFor(key)
+	sh.mu.Lock()
+	return sh
+}
+
+// rlockKey 以读锁锁住 key 所在的分片并返回它，由调用方 RUnlock。
+// key 已过期时先短暂持写锁完成惰性删除，之后读锁下的 peekRLocked 只把过期 key 视为不存在。
+func (d *DB) rlockKey(key string) *shard {
+	sh := d.shardFor(key)
+	sh.mu.RLock()
+	if !isExpired(sh.data[key]) {
+		return sh
+	}
+	sh.mu.RUnlock()
+	sh.mu.Lock()
+	d.peekLocked(key)
+	sh.mu.Unlock()
+	sh.mu.RLock()
+	return sh
+}
+
+// shardsOf 返回 keys 所在的分片，按下标升序且去重。
+func (d *DB) shardsOf(keys []string) []*shard {
+	if len(keys) == 1 {
+		// d.shards 按下标排列，单个分片直接切出，不必分配。
+		sh := d.shardFor(keys[0])
+		return d.shards[sh.index : sh.index+1]
+	}
+	shards := make([]*shard, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, d.shardFor(key))
+	}
+	slices.SortFunc(shards, func(a, b *shard) int { return a.index - b.index })
+	unique := shards[:0]
+	for _, sh := range shards {
+		if len(unique) == 0 || unique[len(unique)-1] != sh {
+			unique = append(unique, sh)
+		}
+	}
+	return unique
+}
+
+// lockKeys 按分片下标升序锁住 keys 所在的全部分片（同一分片只锁一次），返回解锁函数。
+func (d *DB) lockKeys(keys ...string) func() {
+	locked := d.shardsOf(keys)
+	for _, sh := range locked {
+		sh.mu.Lock()
+	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].mu.Unlock()
+		}
+	}
+}
+
+// lockCommands 按下标升序获取 shards 的命令锁，exclusive 为 false 时共享；由 unlockCommands 释放。
+func lockCommands(shards []*shard, exclusive bool) {
+	for _, sh := range shards {
+		if exclusive {
+			sh.cmd.Lock()
+		} else {
+			sh.cmd.RLock()
+		}
+	}
+}
+
+func unlockCommands(shards []*shard, exclusive bool) {
+	for i := len(shards) - 1; i >= 0; i-- {
+		if exclusive {
+			shards[i].cmd.Unlock()
+		} else {
+			shards[i].cmd.RUnlock()
+		}
+	}
+}
+
+// commandShards 返回命令需要加命令锁的分片以及是否独占：带 key 的命令为 key 所在分片，
+// 遍历整个 key 空间的命令（KEYS、SCAN）与未知命令为全部分片，其余无 key 命令（PING、ECHO）不加锁。
+func (d *DB) commandShards(args []string) ([]*shard, bool) {
+	spec, ok := LookupCommand(args[0])
+	if !ok {
+		return d.shards[:], false
+	}
+	if key, single := spec.singleKey(args); single {
+		return d.shardsOf([]string{key}), spec.Write
+	}
+	if keys := spec.commandKeys(args); len(keys) > 0 {
+		return d.shardsOf(keys), spec.Write
+	}
+	if spec.AllKeys {
+		return d.shards[:], spec.Write
+	}
+	return nil, spec.Write
+}
+
+// lockAll 按下标顺序锁住全部分片，用于快照、整体替换等需要一致视图的操作。
+func (d *DB) lockAll() func() {
+	for _, sh := range d.shards {
+		sh.mu.Lock()
+	}
+	return func() {
+		for i := len(d.shards) - 1; i >= 0; i-- {
+			d.shards[i].mu.Unlock()
+		}
+	}
+}
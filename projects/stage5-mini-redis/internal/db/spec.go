@@ -0,0 +1,186 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CommandSpec 命令元信息：参数个数、是否写命令以及 key 参数位置。
+// Arity 与 Redis 相同：正数表示参数个数（含命令名）必须相等，负数表示至少为其绝对值。
+// DenyOOM 表示命令可能增加内存占用，超过 maxmemory 且无法淘汰时拒绝执行。
+// FirstKey 为 0 表示无 key；LastKey 为负数时表示从参数末尾倒数（-1 为最后一个参数）。
+// key 位置不固定的命令（如 XREAD）由 keys 函数提取；AllKeys 表示命令遍历整个 key 空间。
+type CommandSpec struct {
+	Arity    int
+	Write    bool
+	DenyOOM  bool
+	AllKeys  bool
+	FirstKey int
+	LastKey  int
+	Step     int
+
+	keys func(args []string) []string
+}
+
+var commandSpecs = map[string]CommandSpec{
+	"PING":             {Arity: -1},
+	"ECHO":             {Arity: 2},
+	"KEYS":             {Arity: -1, AllKeys: true},
+	"SCAN":             {Arity: -2, AllKeys: true},
+	"TYPE":             {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"SET":              {Arity: -3, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"GET":              {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"DEL":              {Arity: -2, Write: true, FirstKey: 1, LastKey: -1, Step: 1},
+	"EXISTS":           {Arity: -2, FirstKey: 1, LastKey: -1, Step: 1},
+	"EXPIRE":           {Arity: 3, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"PEXPIREAT":        {Arity: 3, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"TTL":              {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"SETBIT":           {Arity: 4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"GETBIT":           {Arity: 3, FirstKey: 1, LastKey: 1, Step: 1},
+	"BITCOUNT":         {Arity: -2, FirstKey: 1, LastKey: 1, Step: 1},
+	"BITPOS":           {Arity: -3, FirstKey: 1, LastKey: 1, Step: 1},
+	"BITOP":            {Arity: -4, Write: true, DenyOOM: true, FirstKey: 2, LastKey: -1, Step: 1},
+	"PFADD":            {Arity: -2, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"PFCOUNT":          {Arity: -2, FirstKey: 1, LastKey: -1, Step: 1},
+	"PFMERGE":          {Arity: -2, Write: true, DenyOOM: true, FirstKey: 1, LastKey: -1, Step: 1},
+	"LPUSH":            {Arity: -3, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"RPUSH":            {Arity: -3, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"LPOP":             {Arity: -2, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"RPOP":             {Arity: -2, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"LLEN":             {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"LINDEX":           {Arity: 3, FirstKey: 1, LastKey: 1, Step: 1},
+	"LSET":             {Arity: 4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"LREM":             {Arity: 4, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"LTRIM":            {Arity: 4, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"LMOVE":            {Arity: 5, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 2, Step: 1},
+	"BLMOVE":           {Arity: 6, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 2, Step: 1},
+	"BLPOP":            {Arity: -3, Write: true, FirstKey: 1, LastKey: -2, Step: 1},
+	"BRPOP":            {Arity: -3, Write: true, FirstKey: 1, LastKey: -2, Step: 1},
+	"LRANGE":           {Arity: 4, FirstKey: 1, LastKey: 1, Step: 1},
+	"SADD":             {Arity: -3, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"SMEMBERS":         {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"SSCAN":            {Arity: -3, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZADD":             {Arity: -4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZINCRBY":          {Arity: 4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZREM":             {Arity: -3, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZSCORE":           {Arity: 3, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZCARD":            {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZCOUNT":           {Arity: 4, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZRANK":            {Arity: 3, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZREVRANK":         {Arity: 3, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZSCAN":            {Arity: -3, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZRANGE":           {Arity: -4, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZREVRANGE":        {Arity: -4, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZRANGEBYSCORE":    {Arity: -4, FirstKey: 1, LastKey: 1, Step: 1},
+	"ZREVRANGEBYSCORE": {Arity: -4, FirstKey: 1, LastKey: 1, Step: 1},
+	"HSET":             {Arity: -4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"HGET":             {Arity: 3, FirstKey: 1, LastKey: 1, Step: 1},
+	"HGETALL":          {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"HSCAN":            {Arity: -3, FirstKey: 1, LastKey: 1, Step: 1},
+	"DUMP":             {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"RESTORE":          {Arity: -4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"RESTORE-ASKING":   {Arity: -4, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"WATCH":            {Arity: -2, FirstKey: 1, LastKey: -1, Step: 1},
+	"UNWATCH":          {Arity: 1},
+	"PUBLISH":          {Arity: 3},
+	"XADD":             {Arity: -5, Write: true, DenyOOM: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"XLEN":             {Arity: 2, FirstKey: 1, LastKey: 1, Step: 1},
+	"XRANGE":           {Arity: -4, FirstKey: 1, LastKey: 1, Step: 1},
+	"XREVRANGE":        {Arity: -4, FirstKey: 1, LastKey: 1, Step: 1},
+	"XREAD":            {Arity: -4, keys: streamReadKeys},
+	"XREADGROUP":       {Arity: -7, Write: true, keys: streamReadKeys},
+	"XGROUP":           {Arity: -4, Write: true, FirstKey: 2, LastKey: 2, Step: 1},
+	"XSETID":           {Arity: 3, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"XACK":             {Arity: -4, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+	"XPENDING":         {Arity: -3, FirstKey: 1, LastKey: 1, Step: 1},
+	"XCLAIM":           {Arity: -6, Write: true, FirstKey: 1, LastKey: 1, Step: 1},
+}
+
+// LookupCommand 查询命令元信息。
+func LookupCommand(name string) (CommandSpec, bool) {
+	spec, ok := commandSpecs[strings.ToUpper(name)]
+	return spec, ok
+}
+
+// CommandNames 返回命令表中的全部命令名（大写、排序）。
+func CommandNames() []string {
+	names := make([]string, 0, len(commandSpecs))
+	for name := range commandSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsWriteCommand 判断命令是否会修改数据集。
+func IsWriteCommand(name string) bool {
+	spec, ok := LookupCommand(name)
+	return ok && spec.Write
+}
+
+// IsDenyOOMCommand 判断命令在内存超限时是否应被拒绝。
+func IsDenyOOMCommand(name string) bool {
+	spec, ok := LookupCommand(name)
+	return ok && spec.DenyOOM
+}
+
+// CommandKeys 按命令元信息提取参数中的 key。
+func CommandKeys(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	spec, ok := LookupCommand(args[0])
+	if !ok {
+		return nil
+	}
+	return spec.commandKeys(args)
+}
+
+func (spec CommandSpec) commandKeys(args []string) []string {
+	if spec.keys != nil {
+		return spec.keys(args)
+	}
+	if spec.FirstKey <= 0 || spec.FirstKey >= len(args) {
+		return nil
+	}
+	last := spec.LastKey
+	if last < 0 {
+		last = len(args) + last
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+	step := spec.Step
+	if step <= 0 {
+		step = 1
+	}
+	keys := make([]string, 0, (last-spec.FirstKey)/step+1)
+	for i := spec.FirstKey; i <= last; i += step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// singleKey 在命令只有 FirstKey 一个 key 时返回它，加锁路径借此免去 key 切片的分配。
+func (spec CommandSpec) singleKey(args []string) (string, bool) {
+	if spec.keys != nil || spec.FirstKey <= 0 || spec.FirstKey >= len(args) || spec.LastKey != spec.FirstKey {
+		return "", false
+	}
+	return args[spec.FirstKey], true
+}
+
+// ValidateCommand 按命令表检查命令名与参数个数，MULTI 入队时据此提前拒绝错误命令。
+func ValidateCommand(args []string) error {
+	if len(args) == 0 {
+		return ErrInvalidCommand
+	}
+	spec, ok := LookupCommand(args[0])
+	if !ok {
+		return fmt.Errorf("unknown command '%s'", args[0])
+	}
+	if (spec.Arity > 0 && len(args) != spec.Arity) || (spec.Arity < 0 && len(args) < -spec.Arity) {
+		return fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(args[0]))
+	}
+	return nil
+}
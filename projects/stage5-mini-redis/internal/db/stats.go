@@ -0,0 +1,35 @@
+package db
+
+// Stats 数据集的统计信息，供 INFO 使用。
+type Stats struct {
+	Keys        int
+	Expires     int
+	UsedMemory  int64
+	ExpiredKeys int64
+	EvictedKeys int64
+	// Dirty 为累计修改次数，单调递增（RESETSTAT 不清零）。
+	Dirty int64
+}
+
+// Stats 返回当前统计信息，key 数按分片逐个累加，不保证是同一时刻的值。
+func (d *DB) Stats() Stats {
+	stats := Stats{
+		UsedMemory:  d.usedMemory.Load(),
+		ExpiredKeys: d.expiredKeys.Load(),
+		EvictedKeys: d.evictedKeys.Load(),
+		Dirty:       d.dirty.Load(),
+	}
+	for _, sh := range d.shards {
+		sh.mu.RLock()
+		stats.Keys += len(sh.data)
+		stats.Expires += len(sh.expires)
+		sh.mu.RUnlock()
+	}
+	return stats
+}
+
+// ResetStats 清零过期与淘汰计数（CONFIG RESETSTAT）。
+func (d *DB) ResetStats() {
+	d.expiredKeys.Store(0)
+	d.evictedKeys.Store(0)
+}
@@ -0,0 +1,1124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+var (
+	ErrStreamID          = errors.New("invalid stream ID specified as stream command argument")
+	ErrStreamIDTooSmall  = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero      = errors.New("the ID specified in XADD must be greater than 0-0")
+	ErrStreamExhausted   = errors.New("the stream has exhausted the last possible ID, unable to add more items")
+	ErrStreamSetIDSmall  = errors.New("the ID specified in XSETID is smaller than the target stream top item")
+	ErrStreamKeyRequired = errors.New("the XGROUP subcommand requires the key to exist, use MKSTREAM to create an empty stream automatically")
+	ErrStreamUnbalanced  = errors.New("unbalanced list of streams: for each stream key an ID must be specified")
+	ErrNoGroup           = errors.New("no such key or consumer group")
+	ErrBusyGroup         = errors.New("consumer group name already exists")
+)
+
+// XAddOptions XADD 的可选参数，MaxLen < 0 表示不裁剪，Approx 对应 MAXLEN ~。
+type XAddOptions struct {
+	NoMkStream bool
+	MaxLen     int
+	Approx     bool
+}
+
+// XReadRequest 解析后的 XREAD / XREADGROUP 参数，Group 为空表示 XREAD。
+// Blocking 为 true 时 Block 为阻塞时长，0 表示一直等待；阻塞由服务层实现，DB 只做一次非阻塞读取。
+type XReadRequest struct {
+	Group    string
+	Consumer string
+	Count    int
+	Block    time.Duration
+	Blocking bool
+	NoAck    bool
+	Keys     []string
+	IDs      []string
+}
+
+// XClaimOptions XCLAIM 的可选参数，Idle、Time、RetryCount 小于 0 表示未指定。
+type XClaimOptions struct {
+	Idle       int64
+	Time       int64
+	RetryCount int64
+	Force      bool
+	JustID     bool
+}
+
+// XAdd 追加消息并按 MAXLEN 裁剪，返回生成的 ID；NOMKSTREAM 且 key 不存在时返回 false。
+func (d *DB) XAdd(ctx context.Context, key, id string, fields []string, opts XAddOptions) (ds.StreamID, bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return ds.StreamID{}, false, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if ok && entry.Type != TypeStream {
+		return ds.StreamID{}, false, ErrWrongType
+	}
+	if !ok && opts.NoMkStream {
+		return ds.StreamID{}, false, nil
+	}
+	s := ds.NewStream()
+	if ok {
+		s = entry.Value.(*ds.Stream)
+	}
+	streamID, err := resolveAddID(s, id)
+	if err != nil {
+		return ds.StreamID{}, false, err
+	}
+	s.Add(streamID, fields)
+	if !ok {
+		entry = &Entry{Type: TypeStream, Value: s}
+		d.setEntryLocked(key, entry)
+	} else {
+		d.growLocked(key, entry, streamEntrySize(fields))
+	}
+	d.notify(NotifyStream, "xadd", key)
+	if opts.MaxLen >= 0 && d.trimStreamLocked(key, entry, opts.MaxLen, opts.Approx) > 0 {
+		d.notify(NotifyStream, "xtrim", key)
+	}
+	return streamID, true, nil
+}
+
+// trimStreamLocked 裁剪流并扣减内存统计，调用方需持有锁。
+func (d *DB) trimStreamLocked(key string, entry *Entry, maxLen int, approx bool) int {
+	removed := entry.Value.(*ds.Stream).Trim(maxLen, approx)
+	var delta int64
+	for _, e := range removed {
+		delta -= streamEntrySize(e.Fields)
+	}
+	if len(removed) > 0 {
+		d.growLocked(key, entry, delta)
+	}
+	return len(removed)
+}
+
+// resolveAddID 解析 XADD 的 ID 参数："*" 自动生成，"ms-*" 自动生成序号，其余为显式 ID。
+func resolveAddID(s *ds.Stream, raw string) (ds.StreamID, error) {
+	last := s.LastID()
+	if raw == "*" {
+		id, ok := s.NextID(uint64(time.Now().UnixMilli()))
+		if !ok {
+			return ds.StreamID{}, ErrStreamExhausted
+		}
+		return id, nil
+	}
+	var id ds.StreamID
+	if msPart, ok := strings.CutSuffix(raw, "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return ds.StreamID{}, ErrStreamID
+		}
+		switch {
+		case ms < last.Ms:
+			return ds.StreamID{}, ErrStreamIDTooSmall
+		case ms == last.Ms:
+			next, ok := last.Next()
+			if !ok || next.Ms != ms {
+				return ds.StreamID{}, ErrStreamIDTooSmall
+			}
+			id = next
+		case ms == 0:
+			id = ds.StreamID{Seq: 1}
+		default:
+			id = ds.StreamID{Ms: ms}
+		}
+	} else {
+		var ok bool
+		if id, ok = ds.ParseStreamID(raw, 0); !ok {
+			return ds.StreamID{}, ErrStreamID
+		}
+	}
+	if id.IsZero() {
+		return ds.StreamID{}, ErrStreamIDZero
+	}
+	if !last.Less(id) {
+		return ds.StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// XLen 返回消息数量。
+func (d *DB) XLen(ctx context.Context, key string) (int, error) {
+	s, sh, err := d.streamForRead(ctx, key)
+	if err != nil || s == nil {
+		return 0, err
+	}
+	defer sh.mu.RUnlock()
+	return s.Len(), nil
+}
+
+// XRange 返回 [start, end] 内的消息，reverse 为 true 时按 ID 降序。
+func (d *DB) XRange(ctx context.Context, key string, start, end ds.StreamID, count int, reverse bool) ([]ds.StreamEntry, error) {
+	s, sh, err := d.streamForRead(ctx, key)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	defer sh.mu.RUnlock()
+	return s.Range(start, end, count, reverse), nil
+}
+
+// streamForRead 以读锁锁住 key 所在分片并查找流，找到时返回的分片仍处于加读锁状态，由调用方 RUnlock；
+// 流不存在时返回 nil。
+func (d *DB) streamForRead(ctx context.Context, key string) (*ds.Stream, *shard, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	sh := d.rlockKey(key)
+	entry, ok := d.lookupRLocked(key)
+	if !ok {
+		sh.mu.RUnlock()
+		return nil, nil, nil
+	}
+	if entry.Type != TypeStream {
+		sh.mu.RUnlock()
+		return nil, nil, ErrWrongType
+	}
+	return entry.Value.(*ds.Stream), sh, nil
+}
+
+// XRead 读取各流中 ID 大于请求 ID 的消息，没有任何消息时返回空数组。
+// "$" 在首次调用时被替换为当时的最后 ID，阻塞重试时只读取之后新增的消息。
+func (d *DB) XRead(ctx context.Context, req *XReadRequest) (*protocol.Value, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := d.lockKeys(req.Keys...)
+	defer unlock()
+	var results []protocol.Value
+	for i, key := range req.Keys {
+		var s *ds.Stream
+		entry, ok := d.lookupLocked(key)
+		if ok {
+			if entry.Type != TypeStream {
+				return nil, ErrWrongType
+			}
+			s = entry.Value.(*ds.Stream)
+		}
+		if req.IDs[i] == "$" {
+			req.IDs[i] = ds.StreamID{}.String()
+			if s != nil {
+				req.IDs[i] = s.LastID().String()
+			}
+		}
+		if s == nil {
+			continue
+		}
+		after, _ := ds.ParseStreamID(req.IDs[i], 0)
+		if entries := s.After(after, req.Count); len(entries) > 0 {
+			results = append(results, *streamKeyValue(key, entries))
+		}
+	}
+	if len(results) == 0 {
+		return protocol.NullArrayValue(), nil
+	}
+	return protocol.ArrayValue(results...), nil
+}
+
+// XReadGroup 以消费者组读取：">" 投递新消息并记入 PEL，其余 ID 读取该消费者 PEL 中的历史消息。
+func (d *DB) XReadGroup(ctx context.Context, req *XReadRequest) (*protocol.Value, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := d.lockKeys(req.Keys...)
+	defer unlock()
+	streams := make([]*ds.Stream, len(req.Keys))
+	groups := make([]*ds.StreamGroup, len(req.Keys))
+	for i, key := range req.Keys {
+		s, g, err := d.streamGroupLocked(key, req.Group)
+		if err != nil {
+			return nil, err
+		}
+		streams[i], groups[i] = s, g
+	}
+
+	now := time.Now().UnixMilli()
+	var results []protocol.Value
+	for i, key := range req.Keys {
+		if req.IDs[i] == ">" {
+			entries := streams[i].ReadGroup(groups[i], req.Consumer, req.Count, req.NoAck, now)
+			if len(entries) > 0 {
+				results = append(results, *streamKeyValue(key, entries))
+			}
+			continue
+		}
+		after, _ := ds.ParseStreamID(req.IDs[i], 0)
+		// 历史读取即使没有消息也返回该 key，便于客户端确认 PEL 已读完。
+		entries := streams[i].ReadPending(groups[i], req.Consumer, after, req.Count, now)
+		results = append(results, *streamKeyValue(key, entries))
+	}
+	if len(results) == 0 {
+		return protocol.NullArrayValue(), nil
+	}
+	return protocol.ArrayValue(results...), nil
+}
+
+// streamGroupLocked 查找流及其消费者组，key 或组不存在时返回 ErrNoGroup，调用方需持有锁。
+func (d *DB) streamGroupLocked(key, group string) (*ds.Stream, *ds.StreamGroup, error) {
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: key '%s' group '%s'", ErrNoGroup, key, group)
+	}
+	if entry.Type != TypeStream {
+		return nil, nil, ErrWrongType
+	}
+	s := entry.Value.(*ds.Stream)
+	g, ok := s.Group(group)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: key '%s' group '%s'", ErrNoGroup, key, group)
+	}
+	return s, g, nil
+}
+
+// XGroupCreate 创建消费者组，id 为 "$" 时从当前最后 ID 之后开始投递。
+func (d *DB) XGroupCreate(ctx context.Context, key, group, id string, mkStream bool) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if ok && entry.Type != TypeStream {
+		return ErrWrongType
+	}
+	if !ok && !mkStream {
+		return ErrStreamKeyRequired
+	}
+	s := ds.NewStream()
+	if ok {
+		s = entry.Value.(*ds.Stream)
+	}
+	lastID, err := parseGroupID(s, id)
+	if err != nil {
+		return err
+	}
+	if s.CreateGroup(group, lastID) == nil {
+		return ErrBusyGroup
+	}
+	if ok {
+		d.touchLocked(key)
+	} else {
+		d.setEntryLocked(key, &Entry{Type: TypeStream, Value: s})
+	}
+	d.notify(NotifyStream, "xgroup-create", key)
+	return nil
+}
+
+// XGroupSetID 修改消费者组的最后投递 ID。
+func (d *DB) XGroupSetID(ctx context.Context, key, group, id string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	s, g, err := d.streamGroupLocked(key, group)
+	if err != nil {
+		return err
+	}
+	lastID, err := parseGroupID(s, id)
+	if err != nil {
+		return err
+	}
+	g.LastID = lastID
+	d.touchLocked(key)
+	d.notify(NotifyStream, "xgroup-setid", key)
+	return nil
+}
+
+// XGroupDestroy 删除消费者组及其 PEL。
+func (d *DB) XGroupDestroy(ctx context.Context, key, group string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		return false, ErrStreamKeyRequired
+	}
+	if entry.Type != TypeStream {
+		return false, ErrWrongType
+	}
+	destroyed := entry.Value.(*ds.Stream).DestroyGroup(group)
+	if destroyed {
+		d.touchLocked(key)
+		d.notify(NotifyStream, "xgroup-destroy", key)
+	}
+	return destroyed, nil
+}
+
+// XGroupCreateConsumer 在组内创建消费者，返回是否新建。
+func (d *DB) XGroupCreateConsumer(ctx context.Context, key, group, consumer string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	_, g, err := d.streamGroupLocked(key, group)
+	if err != nil {
+		return false, err
+	}
+	created := g.CreateConsumer(consumer, time.Now().UnixMilli())
+	if created {
+		d.notify(NotifyStream, "xgroup-createconsumer", key)
+	}
+	return created, nil
+}
+
+// XGroupDelConsumer 删除消费者，返回其被丢弃的待确认消息数。
+func (d *DB) XGroupDelConsumer(ctx context.Context, key, group, consumer string) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	_, g, err := d.streamGroupLocked(key, group)
+	if err != nil {
+		return 0, err
+	}
+	pending := g.DeleteConsumer(consumer)
+	if pending < 0 {
+		return 0, nil
+	}
+	d.notify(NotifyStream, "xgroup-delconsumer", key)
+	return pending, nil
+}
+
+// parseGroupID 解析消费者组的起始 ID，"$" 表示流的最后 ID。
+func parseGroupID(s *ds.Stream, id string) (ds.StreamID, error) {
+	if id == "$" {
+		return s.LastID(), nil
+	}
+	parsed, ok := ds.ParseStreamID(id, 0)
+	if !ok {
+		return ds.StreamID{}, ErrStreamID
+	}
+	return parsed, nil
+}
+
+// XSetID 设置流的最后 ID，用于 AOF 重写还原被裁剪后的 ID 序列。
+func (d *DB) XSetID(ctx context.Context, key string, id ds.StreamID) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		return ErrNoSuchKey
+	}
+	if entry.Type != TypeStream {
+		return ErrWrongType
+	}
+	if !entry.Value.(*ds.Stream).SetLastID(id) {
+		return ErrStreamSetIDSmall
+	}
+	d.touchLocked(key)
+	d.notify(NotifyStream, "xsetid", key)
+	return nil
+}
+
+// XAck 确认消息，返回从 PEL 中删除的条数；key 或组不存在时返回 0。
+func (d *DB) XAck(ctx context.Context, key, group string, ids []ds.StreamID) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	_, g, err := d.streamGroupLocked(key, group)
+	if errors.Is(err, ErrNoGroup) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	acked := g.Ack(ids...)
+	if acked > 0 {
+		d.touchLocked(key)
+	}
+	return acked, nil
+}
+
+// XPendingSummary XPENDING 概要：PEL 长度、最小与最大 ID 以及各消费者的待确认数。
+type XPendingSummary struct {
+	Count     int
+	MinID     ds.StreamID
+	MaxID     ds.StreamID
+	Consumers []ds.StreamConsumer
+}
+
+// XPending 返回消费者组的 PEL 概要。
+func (d *DB) XPending(ctx context.Context, key, group string) (XPendingSummary, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return XPendingSummary{}, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	_, g, err := d.streamGroupLocked(key, group)
+	if err != nil {
+		return XPendingSummary{}, err
+	}
+	summary := XPendingSummary{Count: g.PendingLen()}
+	if summary.Count == 0 {
+		return summary, nil
+	}
+	all := g.Pending(ds.StreamID{}, ds.MaxStreamID, "", 0)
+	summary.MinID, summary.MaxID = all[0].ID, all[len(all)-1].ID
+	for _, c := range g.Consumers() {
+		if c.Pending > 0 {
+			summary.Consumers = append(summary.Consumers, c)
+		}
+	}
+	return summary, nil
+}
+
+// XPendingRange 返回 [start, end] 内空闲至少 minIdle 毫秒的 PEL 项，consumer 非空时只看该消费者。
+func (d *DB) XPendingRange(ctx context.Context, key, group string, start, end ds.StreamID, count int, consumer string, minIdle int64) ([]ds.StreamPending, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	_, g, err := d.streamGroupLocked(key, group)
+	if err != nil {
+		return nil, err
+	}
+	if minIdle <= 0 {
+		return g.Pending(start, end, consumer, count), nil
+	}
+	now := time.Now().UnixMilli()
+	var result []ds.StreamPending
+	for _, p := range g.Pending(start, end, consumer, 0) {
+		if now-p.DeliveryTime < minIdle {
+			continue
+		}
+		result = append(result, p)
+		if count > 0 && len(result) >= count {
+			break
+		}
+	}
+	return result, nil
+}
+
+// XClaim 将空闲至少 minIdle 毫秒的待确认消息转移给 consumer，返回被认领的消息。
+func (d *DB) XClaim(ctx context.Context, key, group, consumer string, minIdle int64, ids []ds.StreamID, opts XClaimOptions) ([]ds.StreamEntry, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	s, g, err := d.streamGroupLocked(key, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	deliveryTime := now
+	switch {
+	case opts.Time >= 0:
+		deliveryTime = opts.Time
+	case opts.Idle >= 0:
+		deliveryTime = now - opts.Idle
+	}
+	claimed := s.Claim(g, consumer, ids, minIdle, now, deliveryTime, opts.RetryCount, opts.Force, opts.JustID)
+	if len(claimed) > 0 {
+		d.touchLocked(key)
+	}
+	return claimed, nil
+}
+
+// executeStreamCommand 解析并执行流相关命令。
+func (d *DB) executeStreamCommand(ctx context.Context, cmd string, args []string) (*protocol.Value, error) {
+	switch cmd {
+	case "XADD":
+		opts, idIndex, err := parseXAdd(args)
+		if err != nil {
+			return nil, err
+		}
+		id, ok, err := d.XAdd(ctx, args[1], args[idIndex], args[idIndex+1:], opts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return protocol.NullValue(), nil
+		}
+		return protocol.BulkStringValue(id.String()), nil
+	case "XLEN":
+		if len(args) != 2 {
+			return nil, ErrInvalidCommand
+		}
+		n, err := d.XLen(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(n)), nil
+	case "XRANGE", "XREVRANGE":
+		if len(args) != 4 && len(args) != 6 {
+			return nil, ErrInvalidCommand
+		}
+		// XREVRANGE 的参数顺序为 end start。
+		startArg, endArg := args[2], args[3]
+		if cmd == "XREVRANGE" {
+			startArg, endArg = endArg, startArg
+		}
+		start, startOK, err := parseRangeID(startArg, false)
+		if err != nil {
+			return nil, err
+		}
+		end, endOK, err := parseRangeID(endArg, true)
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		if len(args) == 6 {
+			if !strings.EqualFold(args[4], "COUNT") {
+				return nil, ErrInvalidCommand
+			}
+			if count, err = strconv.Atoi(args[5]); err != nil {
+				return nil, err
+			}
+			if count <= 0 {
+				return protocol.ArrayValue(), nil
+			}
+		}
+		if !startOK || !endOK {
+			return protocol.ArrayValue(), nil
+		}
+		entries, err := d.XRange(ctx, args[1], start, end, count, cmd == "XREVRANGE")
+		if err != nil {
+			return nil, err
+		}
+		return streamEntriesValue(entries), nil
+	case "XREAD":
+		req, err := ParseXRead(args)
+		if err != nil {
+			return nil, err
+		}
+		return d.XRead(ctx, req)
+	case "XREADGROUP":
+		req, err := ParseXRead(args)
+		if err != nil {
+			return nil, err
+		}
+		return d.XReadGroup(ctx, req)
+	case "XGROUP":
+		return d.executeXGroup(ctx, args)
+	case "XSETID":
+		if len(args) != 3 {
+			return nil, ErrInvalidCommand
+		}
+		id, ok := ds.ParseStreamID(args[2], 0)
+		if !ok {
+			return nil, ErrStreamID
+		}
+		if err := d.XSetID(ctx, args[1], id); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case "XACK":
+		if len(args) < 4 {
+			return nil, ErrInvalidCommand
+		}
+		ids, err := parseStreamIDs(args[3:])
+		if err != nil {
+			return nil, err
+		}
+		acked, err := d.XAck(ctx, args[1], args[2], ids)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(acked)), nil
+	case "XPENDING":
+		return d.executeXPending(ctx, args)
+	case "XCLAIM":
+		if len(args) < 6 {
+			return nil, ErrInvalidCommand
+		}
+		minIdle, err := strconv.ParseInt(args[4], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids, opts, err := parseXClaim(args[5:])
+		if err != nil {
+			return nil, err
+		}
+		claimed, err := d.XClaim(ctx, args[1], args[2], args[3], minIdle, ids, opts)
+		if err != nil {
+			return nil, err
+		}
+		if opts.JustID {
+			values := make([]protocol.Value, 0, len(claimed))
+			for _, e := range claimed {
+				values = append(values, *protocol.BulkStringValue(e.ID.String()))
+			}
+			return protocol.ArrayValue(values...), nil
+		}
+		return streamEntriesValue(claimed), nil
+	default:
+		return nil, ErrInvalidCommand
+	}
+}
+
+func (d *DB) executeXGroup(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) < 4 {
+		return nil, ErrInvalidCommand
+	}
+	key, group := args[2], args[3]
+	switch strings.ToUpper(args[1]) {
+	case "CREATE":
+		if len(args) != 5 && len(args) != 6 {
+			return nil, ErrInvalidCommand
+		}
+		mkStream := len(args) == 6
+		if mkStream && !strings.EqualFold(args[5], "MKSTREAM") {
+			return nil, ErrInvalidCommand
+		}
+		if err := d.XGroupCreate(ctx, key, group, args[4], mkStream); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case "SETID":
+		if len(args) != 5 {
+			return nil, ErrInvalidCommand
+		}
+		if err := d.XGroupSetID(ctx, key, group, args[4]); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case "DESTROY":
+		if len(args) != 4 {
+			return nil, ErrInvalidCommand
+		}
+		destroyed, err := d.XGroupDestroy(ctx, key, group)
+		if err != nil {
+			return nil, err
+		}
+		if destroyed {
+			return protocol.IntegerValue(1), nil
+		}
+		return protocol.IntegerValue(0), nil
+	case "CREATECONSUMER":
+		if len(args) != 5 {
+			return nil, ErrInvalidCommand
+		}
+		created, err := d.XGroupCreateConsumer(ctx, key, group, args[4])
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return protocol.IntegerValue(1), nil
+		}
+		return protocol.IntegerValue(0), nil
+	case "DELCONSUMER":
+		if len(args) != 5 {
+			return nil, ErrInvalidCommand
+		}
+		pending, err := d.XGroupDelConsumer(ctx, key, group, args[4])
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(pending)), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s' for 'xgroup'", args[1])
+	}
+}
+
+// executeXPending 处理 XPENDING key group [[IDLE min-idle] start end count [consumer]]。
+func (d *DB) executeXPending(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) == 3 {
+		summary, err := d.XPending(ctx, args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		if summary.Count == 0 {
+			return protocol.ArrayValue(*protocol.IntegerValue(0), *protocol.NullValue(), *protocol.NullValue(), *protocol.NullValue()), nil
+		}
+		consumers := make([]protocol.Value, 0, len(summary.Consumers))
+		for _, c := range summary.Consumers {
+			consumers = append(consumers, *protocol.ArrayValue(
+				*protocol.BulkStringValue(c.Name),
+				*protocol.BulkStringValue(strconv.Itoa(c.Pending)),
+			))
+		}
+		return protocol.ArrayValue(
+			*protocol.IntegerValue(int64(summary.Count)),
+			*protocol.BulkStringValue(summary.MinID.String()),
+			*protocol.BulkStringValue(summary.MaxID.String()),
+			*protocol.ArrayValue(consumers...),
+		), nil
+	}
+
+	rest := args[3:]
+	var minIdle int64
+	if len(rest) > 0 && strings.EqualFold(rest[0], "IDLE") {
+		if len(rest) < 2 {
+			return nil, ErrInvalidCommand
+		}
+		var err error
+		if minIdle, err = strconv.ParseInt(rest[1], 10, 64); err != nil {
+			return nil, err
+		}
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return nil, ErrInvalidCommand
+	}
+	start, startOK, err := parseRangeID(rest[0], false)
+	if err != nil {
+		return nil, err
+	}
+	end, endOK, err := parseRangeID(rest[1], true)
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return nil, err
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = rest[3]
+	}
+	if count <= 0 || !startOK || !endOK {
+		return protocol.ArrayValue(), nil
+	}
+	pending, err := d.XPendingRange(ctx, args[1], args[2], start, end, count, consumer, minIdle)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	values := make([]protocol.Value, 0, len(pending))
+	for _, p := range pending {
+		values = append(values, *protocol.ArrayValue(
+			*protocol.BulkStringValue(p.ID.String()),
+			*protocol.BulkStringValue(p.Consumer),
+			*protocol.IntegerValue(max(now-p.DeliveryTime, 0)),
+			*protocol.IntegerValue(p.DeliveryCount),
+		))
+	}
+	return protocol.ArrayValue(values...), nil
+}
+
+// parseXAdd 解析 XADD key [NOMKSTREAM] [MAXLEN [=|~] n [LIMIT count]] id field value [field value ...]，返回 ID 参数的下标。
+func parseXAdd(args []string) (XAddOptions, int, error) {
+	opts := XAddOptions{MaxLen: -1}
+	i := 2
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			opts.NoMkStream = true
+			i++
+			continue
+		case "MAXLEN":
+			i++
+			if i < len(args) && (args[i] == "~" || args[i] == "=") {
+				opts.Approx = args[i] == "~"
+				i++
+			}
+			if i >= len(args) {
+				return opts, 0, ErrInvalidCommand
+			}
+			maxLen, err := strconv.Atoi(args[i])
+			if err != nil {
+				return opts, 0, err
+			}
+			if maxLen < 0 {
+				return opts, 0, errors.New("the MAXLEN argument must be >= 0")
+			}
+			opts.MaxLen = maxLen
+			i++
+			// LIMIT 限制单次近似裁剪的工作量，这里按整块裁剪，接受但忽略该参数。
+			if i+1 < len(args) && strings.EqualFold(args[i], "LIMIT") {
+				if !opts.Approx {
+					return opts, 0, errors.New("syntax error, LIMIT cannot be used without the special ~ option")
+				}
+				if _, err := strconv.Atoi(args[i+1]); err != nil {
+					return opts, 0, err
+				}
+				i += 2
+			}
+			continue
+		}
+		break
+	}
+	fields := len(args) - i - 1
+	if fields <= 0 || fields%2 != 0 {
+		return opts, 0, ErrInvalidCommand
+	}
+	return opts, i, nil
+}
+
+// ParseXRead 解析 XREAD [COUNT n] [BLOCK ms] STREAMS key [key ...] id [id ...]
+// 与 XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]。
+func ParseXRead(args []string) (*XReadRequest, error) {
+	req := &XReadRequest{}
+	isGroup := strings.EqualFold(args[0], "XREADGROUP")
+	i := 1
+	for ; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "STREAMS":
+		case option == "GROUP" && isGroup && i+2 < len(args):
+			req.Group, req.Consumer = args[i+1], args[i+2]
+			i += 2
+			continue
+		case option == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			req.Count = max(count, 0)
+			i++
+			continue
+		case option == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if ms < 0 {
+				return nil, errors.New("timeout is negative")
+			}
+			req.Block, req.Blocking = time.Duration(ms)*time.Millisecond, true
+			i++
+			continue
+		case option == "NOACK" && isGroup:
+			req.NoAck = true
+			continue
+		default:
+			return nil, ErrInvalidCommand
+		}
+		break
+	}
+	if isGroup && req.Group == "" {
+		return nil, errors.New("missing GROUP option for XREADGROUP")
+	}
+	streams := args[min(i+1, len(args)):]
+	if i >= len(args) || len(streams) == 0 {
+		return nil, ErrInvalidCommand
+	}
+	if len(streams)%2 != 0 {
+		return nil, ErrStreamUnbalanced
+	}
+	half := len(streams) / 2
+	req.Keys, req.IDs = streams[:half], append([]string(nil), streams[half:]...)
+	for _, id := range req.IDs {
+		switch {
+		case id == "$" && !isGroup, id == ">" && isGroup:
+		case id == "$" || id == ">":
+			return nil, fmt.Errorf("the %s ID is meaningless in the context of %s", id, strings.ToLower(args[0]))
+		default:
+			if _, ok := ds.ParseStreamID(id, 0); !ok {
+				return nil, ErrStreamID
+			}
+		}
+	}
+	return req, nil
+}
+
+// parseXClaim 解析 XCLAIM 的 ID 列表与选项 [IDLE ms] [TIME ms] [RETRYCOUNT n] [FORCE] [JUSTID]。
+func parseXClaim(rest []string) ([]ds.StreamID, XClaimOptions, error) {
+	opts := XClaimOptions{Idle: -1, Time: -1, RetryCount: -1}
+	var ids []ds.StreamID
+	i := 0
+	for ; i < len(rest); i++ {
+		id, ok := ds.ParseStreamID(rest[i], 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, opts, ErrStreamID
+	}
+	for ; i < len(rest); i++ {
+		var target *int64
+		switch strings.ToUpper(rest[i]) {
+		case "FORCE":
+			opts.Force = true
+			continue
+		case "JUSTID":
+			opts.JustID = true
+			continue
+		case "IDLE":
+			target = &opts.Idle
+		case "TIME":
+			target = &opts.Time
+		case "RETRYCOUNT":
+			target = &opts.RetryCount
+		default:
+			return nil, opts, ErrInvalidCommand
+		}
+		if i+1 >= len(rest) {
+			return nil, opts, ErrInvalidCommand
+		}
+		value, err := strconv.ParseInt(rest[i+1], 10, 64)
+		if err != nil {
+			return nil, opts, err
+		}
+		*target = max(value, 0)
+		i++
+	}
+	return ids, opts, nil
+}
+
+// parseRangeID 解析范围端点："-"/"+" 为最小/最大 ID，"(" 前缀表示开区间，省略序号时起点补 0、终点补最大值。
+// 开区间端点越界（如 "(0-0" 作为终点）时返回 false，表示区间为空。
+func parseRangeID(s string, isEnd bool) (ds.StreamID, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	var id ds.StreamID
+	switch {
+	case s == "-" && !exclusive:
+		return ds.StreamID{}, true, nil
+	case s == "+" && !exclusive:
+		return ds.MaxStreamID, true, nil
+	case isEnd:
+		parsed, ok := ds.ParseStreamID(s, ds.MaxStreamID.Seq)
+		if !ok {
+			return id, false, ErrStreamID
+		}
+		id = parsed
+	default:
+		parsed, ok := ds.ParseStreamID(s, 0)
+		if !ok {
+			return id, false, ErrStreamID
+		}
+		id = parsed
+	}
+	if !exclusive {
+		return id, true, nil
+	}
+	if isEnd {
+		prev, ok := id.Prev()
+		return prev, ok, nil
+	}
+	next, ok := id.Next()
+	return next, ok, nil
+}
+
+func parseStreamIDs(args []string) ([]ds.StreamID, error) {
+	ids := make([]ds.StreamID, 0, len(args))
+	for _, arg := range args {
+		id, ok := ds.ParseStreamID(arg, 0)
+		if !ok {
+			return nil, ErrStreamID
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// streamEntriesValue 返回 [[id, [field, value, ...]], ...]，已删除的消息字段为 Null。
+func streamEntriesValue(entries []ds.StreamEntry) *protocol.Value {
+	values := make([]protocol.Value, 0, len(entries))
+	for _, e := range entries {
+		fields := protocol.NullValue()
+		if e.Fields != nil {
+			fields = protocol.StringArray(e.Fields)
+		}
+		values = append(values, *protocol.ArrayValue(*protocol.BulkStringValue(e.ID.String()), *fields))
+	}
+	return protocol.ArrayValue(values...)
+}
+
+// streamKeyValue 返回 XREAD 单个流的结果 [key, entries]。
+func streamKeyValue(key string, entries []ds.StreamEntry) *protocol.Value {
+	return protocol.ArrayValue(*protocol.BulkStringValue(key), *streamEntriesValue(entries))
+}
+
+// streamReadKeys 提取 XREAD/XREADGROUP 中 STREAMS 之后的 key。
+func streamReadKeys(args []string) []string {
+	for i := 1; i < len(args); i++ {
+		if strings.EqualFold(args[i], "GROUP") {
+			// 跳过组名与消费者名，它们可能恰好叫 STREAMS。
+			i += 2
+			continue
+		}
+		if strings.EqualFold(args[i], "STREAMS") {
+			streams := args[i+1:]
+			return streams[:len(streams)/2]
+		}
+	}
+	return nil
+}
+
+// ReadStreams 以命令方式执行一次 XREAD 或 XREADGROUP，与 ExecuteCommand 一样持有相关分片的命令锁。
+// 服务层阻塞重试时复用同一个 req，使 "$" 保持首次解析出的 ID。
+func (d *DB) ReadStreams(ctx context.Context, req *XReadRequest) (*protocol.Value, error) {
+	shards := d.shardsOf(req.Keys)
+	lockCommands(shards, req.Group != "")
+	defer unlockCommands(shards, req.Group != "")
+	return d.readStreams(ctx, req)
+}
+
+func (d *DB) readStreams(ctx context.Context, req *XReadRequest) (*protocol.Value, error) {
+	if req.Group != "" {
+		return d.XReadGroup(ctx, req)
+	}
+	return d.XRead(ctx, req)
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// WatchedKey WATCH 时记录的 key 状态。
+type WatchedKey struct {
+	Key     string
+	Version uint64
+	Exists  bool
+}
+
+// watchState 被监视 key 的版本计数；只为仍被至少一个连接监视的 key 维护，避免版本表无限增长。
+type watchState struct {
+	refs    int
+	version uint64
+}
+
+// Tx 持有命令锁时的执行句柄，仅在 Atomic / AtomicKeys 回调内有效。
+type Tx struct {
+	d *DB
+}
+
+// ExecuteCommand 在已持有的命令锁内执行命令，不再加命令锁；命令涉及的 key 必须在锁住的范围内。
+func (tx *Tx) ExecuteCommand(ctx context.Context, args []string) (*protocol.Value, error) {
+	return tx.d.executeCommand(ctx, args)
+}
+
+// ReadStreams 在已持有的命令锁内执行一次 XREAD 或 XREADGROUP。
+func (tx *Tx) ReadStreams(ctx context.Context, req *XReadRequest) (*protocol.Value, error) {
+	return tx.d.readStreams(ctx, req)
+}
+
+// Atomic 独占全部分片的命令锁执行 fn：期间其他命令都被阻塞，实现 EXEC 的隔离性。
+func (d *DB) Atomic(fn func(tx *Tx)) {
+	lockCommands(d.shards[:], true)
+	defer unlockCommands(d.shards[:], true)
+	fn(&d.tx)
+}
+
+// AtomicCommand 按 ExecuteCommand 的规则持有 args 涉及分片的命令锁执行 fn（读命令共享、写命令独占），
+// 服务层借此把路由检查、执行与传播放在同一次加锁内。
+func (d *DB) AtomicCommand(args []string, fn func(tx *Tx)) {
+	if len(args) == 0 {
+		fn(&d.tx)
+		return
+	}
+	shards, exclusive := d.commandShards(args)
+	lockCommands(shards, exclusive)
+	defer unlockCommands(shards, exclusive)
+	fn(&d.tx)
+}
+
+// AtomicKeys 独占 keys 所在分片的命令锁执行 fn，keys 为空时等同 Atomic。
+// 服务层在 fn 内执行写命令并完成传播，同一分片上的写命令因此按执行顺序进入 AOF 与复制流。
+func (d *DB) AtomicKeys(keys []string, fn func(tx *Tx)) {
+	shards := d.shards[:]
+	if len(keys) > 0 {
+		shards = d.shardsOf(keys)
+	}
+	lockCommands(shards, true)
+	defer unlockCommands(shards, true)
+	fn(&d.tx)
+}
+
+// Watch 开始监视 key，返回当前版本快照；每次 Watch 都需要对应一次 Unwatch。
+func (d *DB) Watch(ctx context.Context, keys ...string) ([]WatchedKey, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := d.lockKeys(keys...)
+	defer unlock()
+	watched := make([]WatchedKey, 0, len(keys))
+	for _, key := range keys {
+		sh := d.shardFor(key)
+		state, ok := sh.watches[key]
+		if !ok {
+			state = &watchState{}
+			sh.watches[key] = state
+		}
+		state.refs++
+		watched = append(watched, WatchedKey{Key: key, Version: state.version, Exists: d.existsLocked(key)})
+	}
+	return watched, nil
+}
+
+// Unwatch 释放 Watch 登记的 key。
+func (d *DB) Unwatch(watched []WatchedKey) {
+	unlock := d.lockKeys(watchedKeys(watched)...)
+	defer unlock()
+	for _, w := range watched {
+		sh := d.shardFor(w.Key)
+		state, ok := sh.watches[w.Key]
+		if !ok {
+			continue
+		}
+		if state.refs--; state.refs <= 0 {
+			delete(sh.watches, w.Key)
+		}
+	}
+}
+
+// WatchChanged 判断被监视的 key 自 Watch 以来是否被修改或已过期。
+// 过期删除不递增版本，因此 Watch 时存在、现在不存在的 key 同样视为已修改（与 Redis 6.0.9+ 一致）。
+func (d *DB) WatchChanged(watched []WatchedKey) bool {
+	unlock := d.lockKeys(watchedKeys(watched)...)
+	defer unlock()
+	for _, w := range watched {
+		state, ok := d.shardFor(w.Key).watches[w.Key]
+		if !ok || state.version != w.Version {
+			return true
+		}
+		if w.Exists && !d.existsLocked(w.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+func watchedKeys(watched []WatchedKey) []string {
+	keys := make([]string, 0, len(watched))
+	for _, w := range watched {
+		keys = append(keys, w.Key)
+	}
+	return keys
+}
+
+// touchLocked 标记 key 被修改，调用方需持有 key 所在分片的锁。
+func (d *DB) touchLocked(key string) {
+	d.dirty.Add(1)
+	if state, ok := d.shardFor(key).watches[key]; ok {
+		state.version++
+	}
+}
+
+// touchAllLocked 分片数据被整体替换时使其中所有监视失效，调用方需持有分片的锁。
+func (sh *shard) touchAllLocked() {
+	for _, state := range sh.watches {
+		state.version++
+	}
+}
+
+func (d *DB) existsLocked(key string) bool {
+	_, ok := d.peekLocked(key)
+	return ok
+}
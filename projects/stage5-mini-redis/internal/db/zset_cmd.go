@@ -2,38 +2,244 @@ package db
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
 )
 
-// ZAdd 写入有序集合。
-func (d *DB) ZAdd(ctx context.Context, key, member string, score float64) error {
+var (
+	ErrNotFloat    = errors.New("value is not a valid float")
+	ErrMinMaxFloat = errors.New("min or max is not a float")
+	ErrScoreNaN    = errors.New("resulting score is not a number (NaN)")
+)
+
+// ZAdd 写入有序集合，已存在的成员更新分数，返回新成员数。
+func (d *DB) ZAdd(ctx context.Context, key string, items ...ds.ZItem) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if ok && entry.Type != TypeZSet {
+		return 0, ErrWrongType
+	}
+	if !ok {
+		entry = &Entry{Type: TypeZSet, Value: ds.NewSkipList()}
+		d.setEntryLocked(key, entry)
+	}
+	z := entry.Value.(*ds.SkipList)
+	added := 0
+	var delta int64
+	for _, item := range items {
+		if z.Insert(item.Member, item.Score) {
+			delta += zsetMemberSize(item.Member)
+			added++
+		}
+	}
+	d.growLocked(key, entry, delta)
+	d.notify(NotifyZSet, "zadd", key)
+	return added, nil
+}
+
+// ZIncrBy 为成员分数增加 delta，返回新分数。
+func (d *DB) ZIncrBy(ctx context.Context, key, member string, delta float64) (float64, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	if err := ctx.Err(); err != nil {
-		return err
+		return 0, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	entry, ok := d.lookupLocked(key)
+	if !ok {
+		if math.IsNaN(delta) {
+			return 0, ErrScoreNaN
+		}
 		z := ds.NewSkipList()
-		z.Insert(member, score)
-		d.data[key] = &Entry{Type: TypeZSet, Value: z}
-		return nil
+		z.Insert(member, delta)
+		d.setEntryLocked(key, &Entry{Type: TypeZSet, Value: z})
+		d.notify(NotifyZSet, "zincr", key)
+		return delta, nil
 	}
 	if entry.Type != TypeZSet {
-		return ErrWrongType
+		return 0, ErrWrongType
 	}
 	z := entry.Value.(*ds.SkipList)
-	z.Insert(member, score)
-	return nil
+	current, existed := z.Score(member)
+	if math.IsNaN(current + delta) {
+		return 0, ErrScoreNaN
+	}
+	score := z.IncrBy(member, delta)
+	if existed {
+		d.touchLocked(key)
+	} else {
+		d.growLocked(key, entry, zsetMemberSize(member))
+	}
+	d.notify(NotifyZSet, "zincr", key)
+	return score, nil
+}
+
+// ZRem 删除成员，返回实际删除的数量；集合为空时删除 key。
+func (d *DB) ZRem(ctx context.Context, key string, members ...string) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.lockKey(key)
+	defer sh.mu.Unlock()
+	z, err := d.zsetLocked(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	removed := 0
+	freed := int64(0)
+	for _, member := range members {
+		if z.Delete(member) {
+			removed++
+			freed += zsetMemberSize(member)
+		}
+	}
+	if removed > 0 {
+		d.notify(NotifyZSet, "zrem", key)
+	}
+	switch {
+	case z.Len() == 0:
+		d.deleteLocked(key)
+		d.notify(NotifyGeneric, "del", key)
+	case removed > 0:
+		d.growLocked(key, sh.data[key], -freed)
+	}
+	return removed, nil
+}
+
+// ZScore 返回成员分数。
+func (d *DB) ZScore(ctx context.Context, key, member string) (float64, bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	z, err := d.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+	score, ok := z.Score(member)
+	return score, ok, nil
+}
+
+// ZCard 返回成员数量。
+func (d *DB) ZCard(ctx context.Context, key string) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	z, err := d.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	return z.Len(), nil
+}
+
+// ZCount 返回分数落在区间内的成员数量。
+func (d *DB) ZCount(ctx context.Context, key string, r ds.ScoreRange) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	z, err := d.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	return z.Count(r), nil
+}
+
+// ZRank 返回成员排名，reverse 为 true 时按分数降序计算。
+func (d *DB) ZRank(ctx context.Context, key, member string, reverse bool) (int, bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	z, err := d.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+	rank, ok := z.Rank(member)
+	if ok && reverse {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, ok, nil
+}
+
+// ZRange 按排名区间查询，start/stop 支持负数下标（-1 为最后一名）。
+func (d *DB) ZRange(ctx context.Context, key string, start, stop int, reverse bool) ([]ds.ZItem, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	z, err := d.zsetRLocked(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	length := z.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return z.RangeByRank(start, stop, reverse), nil
 }
 
 // ZRangeByScore 范围查询有序集合。
 func (d *DB) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]ds.ZItem, error) {
+	return d.ZRangeByScoreRange(ctx, key, ds.ScoreRange{Min: min, Max: max}, false)
+}
+
+// ZRangeByScoreRange 按分数区间查询，支持开区间端点与降序。
+func (d *DB) ZRangeByScoreRange(ctx context.Context, key string, r ds.ScoreRange, reverse bool) ([]ds.ZItem, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -41,16 +247,62 @@ func (d *DB) ZRangeByScore(ctx context.Context, key string, min, max float64) ([
 		return nil, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	entry, ok := d.data[key]
-	if !ok || d.isExpired(entry) {
-		delete(d.data, key)
+	sh := d.rlockKey(key)
+	defer sh.mu.RUnlock()
+	z, err := d.zsetRLocked(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	return z.RangeByScoreRange(r, reverse), nil
+}
+
+// zsetLocked 返回 key 对应的有序集合，不存在时返回 nil，调用方需持有锁。
+func (d *DB) zsetLocked(key string) (*ds.SkipList, error) {
+	return zsetOf(d.lookupLocked(key))
+}
+
+// zsetRLocked 是 zsetLocked 的读锁版本。
+func (d *DB) zsetRLocked(key string) (*ds.SkipList, error) {
+	return zsetOf(d.lookupRLocked(key))
+}
+
+func zsetOf(entry *Entry, ok bool) (*ds.SkipList, error) {
+	if !ok {
 		return nil, nil
 	}
 	if entry.Type != TypeZSet {
 		return nil, ErrWrongType
 	}
-	z := entry.Value.(*ds.SkipList)
-	return z.RangeByScore(min, max), nil
+	return entry.Value.(*ds.SkipList), nil
+}
+
+// ParseScore 解析分数，接受 inf/+inf/-inf，拒绝 NaN。
+func ParseScore(value string) (float64, error) {
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, ErrNotFloat
+	}
+	return score, nil
+}
+
+// ParseScoreRange 解析 ZRANGEBYSCORE/ZCOUNT 的 min max，"(" 前缀表示开区间。
+func ParseScoreRange(min, max string) (ds.ScoreRange, error) {
+	var r ds.ScoreRange
+	var err error
+	if r.Min, r.MinEx, err = parseScoreBound(min); err != nil {
+		return r, err
+	}
+	if r.Max, r.MaxEx, err = parseScoreBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseScoreBound(value string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(value, "(")
+	score, err := ParseScore(strings.TrimPrefix(value, "("))
+	if err != nil {
+		return 0, false, ErrMinMaxFloat
+	}
+	return score, exclusive, nil
 }
@@ -1,6 +1,13 @@
 package ds
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"testing"
+)
 
 func TestLinkedList(t *testing.T) {
 	list := &LinkedList{}
@@ -29,3 +36,294 @@ func TestSkipList(t *testing.T) {
 		t.Fatalf("first member = %s, want b", items[0].Member)
 	}
 }
+
+func TestSkipListMatchesSortedModel(t *testing.T) {
+	sl := NewSkipList()
+	model := make(map[string]float64)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 5000; i++ {
+		member := fmt.Sprintf("m%d", rng.IntN(300))
+		switch rng.IntN(4) {
+		case 0:
+			_, existed := model[member]
+			if sl.Delete(member) != existed {
+				t.Fatalf("Delete(%s) disagrees with model", member)
+			}
+			delete(model, member)
+		default:
+			score := float64(rng.IntN(50))
+			_, existed := model[member]
+			if sl.Insert(member, score) == existed {
+				t.Fatalf("Insert(%s) new-member flag disagrees with model", member)
+			}
+			model[member] = score
+		}
+	}
+
+	sorted := make([]ZItem, 0, len(model))
+	for member, score := range model {
+		sorted = append(sorted, ZItem{Member: member, Score: score})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i].Score, sorted[i].Member, sorted[j].Score, sorted[j].Member) })
+	if sl.Len() != len(sorted) {
+		t.Fatalf("Len() = %d, want %d", sl.Len(), len(sorted))
+	}
+	for i, item := range sorted {
+		if rank, ok := sl.Rank(item.Member); !ok || rank != i {
+			t.Fatalf("Rank(%s) = %d, want %d", item.Member, rank, i)
+		}
+	}
+	if got := sl.RangeByRank(10, 19, false); !reflect.DeepEqual(got, sorted[10:20]) {
+		t.Fatalf("RangeByRank(10, 19) = %v, want %v", got, sorted[10:20])
+	}
+	reversed := sl.RangeByRank(0, 4, true)
+	for i, item := range reversed {
+		if item != sorted[len(sorted)-1-i] {
+			t.Fatalf("reverse rank %d = %v, want %v", i, item, sorted[len(sorted)-1-i])
+		}
+	}
+
+	r := ScoreRange{Min: 10, Max: 20, MinEx: true}
+	want := make([]ZItem, 0)
+	for _, item := range sorted {
+		if item.Score > 10 && item.Score <= 20 {
+			want = append(want, item)
+		}
+	}
+	if got := sl.RangeByScoreRange(r, false); !reflect.DeepEqual(got, want) {
+		t.Fatalf("RangeByScoreRange((10, 20]) = %v, want %v", got, want)
+	}
+	if got := sl.Count(r); got != len(want) {
+		t.Fatalf("Count((10, 20]) = %d, want %d", got, len(want))
+	}
+	if got := sl.RangeByScoreRange(r, true); len(got) != len(want) || (len(got) > 0 && got[0] != want[len(want)-1]) {
+		t.Fatalf("reverse RangeByScoreRange mismatch: %v", got)
+	}
+	if got := sl.Count(ScoreRange{Min: 5, Max: 5, MinEx: true}); got != 0 {
+		t.Fatalf("Count((5, 5]) = %d, want 0", got)
+	}
+	if got := sl.Count(ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}); got != len(sorted) {
+		t.Fatalf("Count(-inf, +inf) = %d, want %d", got, len(sorted))
+	}
+}
+
+func TestStreamAddRangeTrim(t *testing.T) {
+	s := NewStream()
+	id, ok := s.NextID(5)
+	if !ok || id != (StreamID{Ms: 5}) {
+		t.Fatalf("NextID() = %v, want 5-0", id)
+	}
+	s.Add(id, []string{"f", "1"})
+	// 时钟回拨时沿用最后的时间戳并递增序号。
+	next, _ := s.NextID(3)
+	if next != (StreamID{Ms: 5, Seq: 1}) {
+		t.Fatalf("NextID() after clock skew = %v, want 5-1", next)
+	}
+	if s.Add(StreamID{Ms: 5}, nil) {
+		t.Fatal("Add() must reject ids not greater than the last id")
+	}
+	for i := uint64(6); i < 10; i++ {
+		s.Add(StreamID{Ms: i}, []string{"f", "v"})
+	}
+	got := s.Range(StreamID{Ms: 6}, StreamID{Ms: 8}, 0, true)
+	if len(got) != 3 || got[0].ID.Ms != 8 || got[2].ID.Ms != 6 {
+		t.Fatalf("reverse Range() = %v", got)
+	}
+	if after := s.After(StreamID{Ms: 8}, 0); len(after) != 1 || after[0].ID.Ms != 9 {
+		t.Fatalf("After() = %v", after)
+	}
+	if removed := s.Trim(2, false); len(removed) != 3 || s.Len() != 2 {
+		t.Fatalf("Trim() removed %d, len %d", len(removed), s.Len())
+	}
+	if removed := s.Trim(1, true); len(removed) != 0 {
+		t.Fatal("approximate Trim() should only remove whole nodes")
+	}
+	if s.LastID() != (StreamID{Ms: 9}) {
+		t.Fatalf("LastID() = %v, want 9-0", s.LastID())
+	}
+}
+
+func TestStreamGroupPendingEntries(t *testing.T) {
+	s := NewStream()
+	for i := uint64(1); i <= 3; i++ {
+		s.Add(StreamID{Ms: i}, []string{"job", "x"})
+	}
+	g := s.CreateGroup("workers", StreamID{})
+	if s.CreateGroup("workers", StreamID{}) != nil {
+		t.Fatal("CreateGroup() should reject duplicate names")
+	}
+	if got := s.ReadGroup(g, "alice", 2, false, 100); len(got) != 2 {
+		t.Fatalf("ReadGroup(alice) = %v", got)
+	}
+	if got := s.ReadGroup(g, "bob", 0, false, 100); len(got) != 1 || got[0].ID.Ms != 3 {
+		t.Fatalf("ReadGroup(bob) = %v", got)
+	}
+	if history := s.ReadPending(g, "alice", StreamID{}, 0, 100); len(history) != 2 {
+		t.Fatalf("ReadPending(alice) = %v", history)
+	}
+
+	claimed := s.Claim(g, "bob", []StreamID{{Ms: 1}, {Ms: 2}}, 50, 120, 120, -1, false, false)
+	if len(claimed) != 0 {
+		t.Fatalf("Claim() before min idle = %v", claimed)
+	}
+	claimed = s.Claim(g, "bob", []StreamID{{Ms: 1}}, 50, 200, 200, -1, false, false)
+	if len(claimed) != 1 {
+		t.Fatalf("Claim() after min idle = %v", claimed)
+	}
+	pending := g.Pending(StreamID{}, MaxStreamID, "bob", 0)
+	if len(pending) != 2 || pending[0].DeliveryCount != 2 {
+		t.Fatalf("bob pending = %+v", pending)
+	}
+	if acked := g.Ack(StreamID{Ms: 1}, StreamID{Ms: 1}, StreamID{Ms: 9}); acked != 1 {
+		t.Fatalf("Ack() = %d, want 1", acked)
+	}
+	consumers := g.Consumers()
+	if len(consumers) != 2 || consumers[0].Pending != 1 || consumers[1].Pending != 1 {
+		t.Fatalf("consumers = %+v", consumers)
+	}
+	if dropped := g.DeleteConsumer("alice"); dropped != 1 || g.PendingLen() != 1 {
+		t.Fatalf("DeleteConsumer() = %d, pending %d", dropped, g.PendingLen())
+	}
+}
+
+func TestLinkedListIndexing(t *testing.T) {
+	list := &LinkedList{}
+	for _, v := range []string{"a", "b", "a", "c", "a"} {
+		list.RPush(v)
+	}
+	if got := list.Range(-3, -1); !reflect.DeepEqual(got, []string{"a", "c", "a"}) {
+		t.Fatalf("Range(-3, -1) = %v", got)
+	}
+	if got := list.Range(3, 1); got != nil {
+		t.Fatalf("Range(3, 1) = %v, want nil", got)
+	}
+	if v, ok := list.Index(-2); !ok || v != "c" {
+		t.Fatalf("Index(-2) = (%q, %v)", v, ok)
+	}
+	if _, ok := list.Set(5, "x"); ok {
+		t.Fatal("Set() out of range should fail")
+	}
+	if v, ok := list.RPop(); !ok || v != "a" {
+		t.Fatalf("RPop() = (%q, %v)", v, ok)
+	}
+	if removed := list.Remove(-1, "a"); removed != 1 || !reflect.DeepEqual(list.Range(0, -1), []string{"a", "b", "c"}) {
+		t.Fatalf("Remove(-1, a) = %d, list %v", removed, list.Range(0, -1))
+	}
+	if removed := list.Trim(1, -1); !reflect.DeepEqual(removed, []string{"a"}) || list.Len() != 2 {
+		t.Fatalf("Trim(1, -1) removed %v, len %d", removed, list.Len())
+	}
+	if removed := list.Trim(5, 10); len(removed) != 2 || list.Len() != 0 {
+		t.Fatalf("Trim(5, 10) removed %v, len %d", removed, list.Len())
+	}
+	list.LPush("z")
+	if v, ok := list.Index(0); !ok || v != "z" || list.Len() != 1 {
+		t.Fatal("list should be reusable after being emptied by Trim")
+	}
+}
+
+func TestHLLEncodingRoundTrip(t *testing.T) {
+	empty := NewHLL().String()
+	if empty != "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff" {
+		t.Fatalf("empty HLL = %q", empty)
+	}
+	h := NewHLL()
+	for i := 0; i < 100; i++ {
+		h.Add(fmt.Sprintf("item-%d", i))
+	}
+	sparse := h.String()
+	if sparse[4] != hllSparse || len(sparse) > HLLSparseMaxBytes {
+		t.Fatalf("100 items: encoding %d, len %d", sparse[4], len(sparse))
+	}
+	parsed, err := ParseHLL(sparse)
+	if err != nil || parsed.registers != h.registers {
+		t.Fatalf("ParseHLL(sparse) error = %v", err)
+	}
+	if _, valid := parsed.CachedCount(); valid {
+		t.Fatal("cached cardinality should be invalid after Add")
+	}
+
+	for i := 100; i < 5000; i++ {
+		h.Add(fmt.Sprintf("item-%d", i))
+	}
+	count := h.Count()
+	dense := h.String()
+	if dense[4] != hllDense || len(dense) != hllDenseSize {
+		t.Fatalf("5000 items: encoding %d, len %d", dense[4], len(dense))
+	}
+	parsed, err = ParseHLL(dense)
+	if err != nil || parsed.registers != h.registers {
+		t.Fatalf("ParseHLL(dense) error = %v", err)
+	}
+	if cached, valid := parsed.CachedCount(); !valid || cached != count {
+		t.Fatalf("cached cardinality = (%d, %v), want %d", cached, valid, count)
+	}
+
+	for _, bad := range []string{"", "HYLL", "XYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff", empty[:len(empty)-1] + "\xfe"} {
+		if _, err := ParseHLL(bad); err == nil {
+			t.Fatalf("ParseHLL(%q) accepted invalid value", bad)
+		}
+	}
+}
+
+func TestAddHLLUpdatesEncodingInPlace(t *testing.T) {
+	for _, n := range []int{100, 5000} {
+		h := NewHLL()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("item-%d", i))
+		}
+		h.Count()
+		data := h.String()
+
+		same, changed, err := AddHLL(data, "item-0", "item-1")
+		if err != nil || changed || same != data {
+			t.Fatalf("%d items: AddHLL(existing) = (changed %v, err %v), want unchanged", n, changed, err)
+		}
+		fresh := make([]string, 0, 200)
+		for i := 0; i < 200; i++ {
+			fresh = append(fresh, fmt.Sprintf("fresh-%d", i))
+		}
+		updated, changed, err := AddHLL(data, fresh...)
+		if err != nil || !changed {
+			t.Fatalf("%d items: AddHLL(fresh) = (changed %v, err %v)", n, changed, err)
+		}
+		for _, element := range fresh {
+			h.Add(element)
+		}
+		parsed, err := ParseHLL(updated)
+		if err != nil || parsed.registers != h.registers {
+			t.Fatalf("%d items: registers after AddHLL differ from Add, err = %v", n, err)
+		}
+		if _, valid := parsed.CachedCount(); valid {
+			t.Fatalf("%d items: cached cardinality should be invalid after AddHLL", n)
+		}
+	}
+	if _, _, err := AddHLL("not an hll", "x"); err != ErrNotHLL {
+		t.Fatalf("AddHLL(invalid) error = %v, want ErrNotHLL", err)
+	}
+}
+
+func TestHLLCountAccuracyAndMerge(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		h := NewHLL()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("user:%d", i))
+		}
+		got := float64(h.Count())
+		if math.Abs(got-float64(n)) > float64(n)*0.03 {
+			t.Fatalf("Count() with %d items = %.0f", n, got)
+		}
+	}
+
+	a, b := NewHLL(), NewHLL()
+	for i := 0; i < 3000; i++ {
+		a.Add(fmt.Sprintf("k%d", i))
+		b.Add(fmt.Sprintf("k%d", i+2000))
+	}
+	if b.Add("k2000") {
+		t.Fatal("Add() of an existing element changed a register")
+	}
+	a.Merge(b)
+	if got := float64(a.Count()); math.Abs(got-5000) > 150 {
+		t.Fatalf("merged Count() = %.0f, want about 5000", got)
+	}
+}
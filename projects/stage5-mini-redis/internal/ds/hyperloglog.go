@@ -0,0 +1,403 @@
+package ds
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog 参数与编码与 Redis 相同：2^14 个 6 位寄存器，标准误差约 0.81%。
+const (
+	hllP          = 14
+	hllQ          = 64 - hllP
+	hllRegisters  = 1 << hllP
+	hllBits       = 6
+	hllRegMax     = 1<<hllBits - 1
+	hllHeaderSize = 16
+	hllDenseSize  = hllHeaderSize + (hllRegisters*hllBits+7)/8
+	hllDense      = 0
+	hllSparse     = 1
+	// 稀疏编码的操作码：ZERO 00xxxxxx（1~64 个零寄存器）、XZERO 01xxxxxx yyyyyyyy（1~16384 个零寄存器）、
+	// VAL 1vvvvvxx（1~4 个值为 1~32 的寄存器）。
+	hllSparseValMax    = 32
+	hllSparseValRunMax = 4
+	hllZeroRunMax      = 64
+	hllXZeroRunMax     = 16384
+	hllAlphaInf        = 0.721347520444481703680
+	hllHashSeed        = 0xadc83b19
+)
+
+// HLLSparseMaxBytes 稀疏编码的最大字节数（含头部），超过后转为稠密编码，与 Redis 的 hll-sparse-max-bytes 默认值相同。
+const HLLSparseMaxBytes = 3000
+
+var (
+	// ErrNotHLL 字符串不是 HyperLogLog 编码。
+	ErrNotHLL = errors.New("Key is not a valid HyperLogLog string value.")
+	// ErrCorruptHLL HyperLogLog 编码内容损坏。
+	ErrCorruptHLL = errors.New("Corrupted HLL object detected")
+)
+
+// HLL 解码后的 HyperLogLog。以字符串保存，格式与 Redis 兼容：16 字节头部（"HYLL"、编码、
+// 3 字节保留、8 字节小端缓存基数，最高位置 1 表示缓存失效）后接稀疏或稠密寄存器。
+// 寄存器较少被置位时使用稀疏编码，超过 HLLSparseMaxBytes 或出现大于 32 的寄存器值后转为稠密编码且不再转回。
+type HLL struct {
+	registers [hllRegisters]uint8
+	dense     bool
+	card      uint64
+	cardValid bool
+}
+
+// NewHLL 创建空的 HyperLogLog（稀疏编码）。
+func NewHLL() *HLL {
+	return &HLL{cardValid: true}
+}
+
+// ParseHLL 解码字符串形式的 HyperLogLog。
+func ParseHLL(data string) (*HLL, error) {
+	if len(data) < hllHeaderSize || data[:4] != "HYLL" {
+		return nil, ErrNotHLL
+	}
+	h := &HLL{}
+	switch data[4] {
+	case hllDense:
+		if len(data) != hllDenseSize {
+			return nil, ErrNotHLL
+		}
+		h.dense = true
+		regs := data[hllHeaderSize:]
+		for i := range h.registers {
+			h.registers[i] = denseRegister(regs, i)
+		}
+	case hllSparse:
+		if err := h.decodeSparse(data[hllHeaderSize:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNotHLL
+	}
+	card := binary.LittleEndian.Uint64([]byte(data[8:hllHeaderSize]))
+	if card&(1<<63) == 0 {
+		h.card, h.cardValid = card, true
+	}
+	return h, nil
+}
+
+func (h *HLL) decodeSparse(ops string) error {
+	idx := 0
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			idx += int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(ops) {
+				return ErrCorruptHLL
+			}
+			idx += (int(op&0x3f)<<8 | int(ops[i+1])) + 1
+			i++
+		default: // VAL
+			value := (op>>2)&0x1f + 1
+			run := int(op&0x03) + 1
+			if idx+run > hllRegisters {
+				return ErrCorruptHLL
+			}
+			for j := 0; j < run; j++ {
+				h.registers[idx+j] = value
+			}
+			idx += run
+		}
+	}
+	if idx != hllRegisters {
+		return ErrCorruptHLL
+	}
+	return nil
+}
+
+// AddHLL 直接在编码 data 上加入元素，返回新编码与是否有寄存器变大；没有寄存器变化时原样返回 data，不做任何复制。
+// 稠密编码只读写元素对应的寄存器并使缓存基数失效，不展开全部寄存器；稀疏编码先逐个查找寄存器，
+// 确有变化时才解码重编码（稀疏编码不超过 HLLSparseMaxBytes，可能因此转为稠密编码）。
+func AddHLL(data string, elements ...string) (string, bool, error) {
+	if len(data) < hllHeaderSize || data[:4] != "HYLL" {
+		return "", false, ErrNotHLL
+	}
+	switch data[4] {
+	case hllDense:
+		if len(data) != hllDenseSize {
+			return "", false, ErrNotHLL
+		}
+		var buf []byte
+		for _, element := range elements {
+			index, count := hllPatLen(element)
+			if buf == nil {
+				if count <= denseRegister(data[hllHeaderSize:], index) {
+					continue
+				}
+				buf = []byte(data)
+			} else if count <= denseRegister(buf[hllHeaderSize:], index) {
+				continue
+			}
+			setDenseRegister(buf[hllHeaderSize:], index, count)
+		}
+		if buf == nil {
+			return data, false, nil
+		}
+		buf[hllHeaderSize-1] |= 0x80
+		return string(buf), true, nil
+	case hllSparse:
+		changed := false
+		for _, element := range elements {
+			index, count := hllPatLen(element)
+			value, err := sparseRegister(data[hllHeaderSize:], index)
+			if err != nil {
+				return "", false, err
+			}
+			if count > value {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return data, false, nil
+		}
+		h, err := ParseHLL(data)
+		if err != nil {
+			return "", false, err
+		}
+		for _, element := range elements {
+			h.Add(element)
+		}
+		return h.String(), true, nil
+	default:
+		return "", false, ErrNotHLL
+	}
+}
+
+// sparseRegister 在稀疏编码的操作码中查找第 index 个寄存器的值。
+func sparseRegister(ops string, index int) (uint8, error) {
+	idx := 0
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			idx += int(op&0x3f) + 1
+			if index < idx {
+				return 0, nil
+			}
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(ops) {
+				return 0, ErrCorruptHLL
+			}
+			idx += (int(op&0x3f)<<8 | int(ops[i+1])) + 1
+			i++
+			if index < idx {
+				return 0, nil
+			}
+		default: // VAL
+			idx += int(op&0x03) + 1
+			if index < idx {
+				return (op>>2)&0x1f + 1, nil
+			}
+		}
+	}
+	return 0, ErrCorruptHLL
+}
+
+// Add 加入元素，返回是否有寄存器变大（即估计值可能变化）。
+func (h *HLL) Add(element string) bool {
+	index, count := hllPatLen(element)
+	if count <= h.registers[index] {
+		return false
+	}
+	h.registers[index] = count
+	h.cardValid = false
+	return true
+}
+
+// Merge 逐寄存器取最大值合并 other；任一方为稠密编码时结果为稠密编码。
+func (h *HLL) Merge(other *HLL) {
+	for i, value := range other.registers {
+		if value > h.registers[i] {
+			h.registers[i] = value
+			h.cardValid = false
+		}
+	}
+	h.dense = h.dense || other.dense
+}
+
+// CachedCount 返回缓存的基数与缓存是否有效。
+func (h *HLL) CachedCount() (uint64, bool) {
+	return h.card, h.cardValid
+}
+
+// Count 返回基数估计并更新缓存。采用 Redis 使用的 Ertl 改进估计算法，小基数与大基数下均无需偏差修正。
+func (h *HLL) Count() uint64 {
+	if h.cardValid {
+		return h.card
+	}
+	var histogram [hllQ + 2]int
+	for _, value := range h.registers {
+		histogram[value]++
+	}
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	h.card = uint64(math.Round(hllAlphaInf * m * m / z))
+	h.cardValid = true
+	return h.card
+}
+
+// String 编码为字符串：稀疏编码能容纳时保持稀疏，否则转为稠密。
+func (h *HLL) String() string {
+	if !h.dense {
+		if sparse, ok := h.encodeSparse(); ok {
+			return sparse
+		}
+		h.dense = true
+	}
+	buf := make([]byte, hllDenseSize)
+	h.writeHeader(buf, hllDense)
+	regs := buf[hllHeaderSize:]
+	for i, value := range h.registers {
+		setDenseRegister(regs, i, value)
+	}
+	return string(buf)
+}
+
+func (h *HLL) encodeSparse() (string, bool) {
+	buf := make([]byte, hllHeaderSize, hllHeaderSize+64)
+	for i := 0; i < hllRegisters; {
+		value := h.registers[i]
+		run := 1
+		for i+run < hllRegisters && h.registers[i+run] == value {
+			run++
+		}
+		i += run
+		if value > hllSparseValMax {
+			return "", false
+		}
+		for run > 0 {
+			switch {
+			case value != 0:
+				n := min(run, hllSparseValRunMax)
+				buf = append(buf, 0x80|(value-1)<<2|byte(n-1))
+				run -= n
+			case run > hllZeroRunMax:
+				n := min(run, hllXZeroRunMax)
+				buf = append(buf, 0x40|byte((n-1)>>8), byte(n-1))
+				run -= n
+			default:
+				buf = append(buf, byte(run-1))
+				run = 0
+			}
+		}
+		if len(buf) > HLLSparseMaxBytes {
+			return "", false
+		}
+	}
+	h.writeHeader(buf, hllSparse)
+	return string(buf), true
+}
+
+func (h *HLL) writeHeader(buf []byte, encoding byte) {
+	copy(buf, "HYLL")
+	buf[4] = encoding
+	card := h.card
+	if !h.cardValid {
+		card = 1 << 63
+	}
+	binary.LittleEndian.PutUint64(buf[8:hllHeaderSize], card)
+}
+
+// denseRegister 读取稠密编码中第 i 个 6 位寄存器（寄存器按小端位序连续存放，可能跨字节）。
+func denseRegister[T string | []byte](regs T, i int) uint8 {
+	bit := i * hllBits
+	b, shift := bit/8, uint(bit%8)
+	value := uint(regs[b]) >> shift
+	if b+1 < len(regs) {
+		value |= uint(regs[b+1]) << (8 - shift)
+	}
+	return uint8(value & hllRegMax)
+}
+
+func setDenseRegister(regs []byte, i int, value uint8) {
+	bit := i * hllBits
+	b, shift := bit/8, uint(bit%8)
+	regs[b] &^= byte(hllRegMax << shift)
+	regs[b] |= value << shift
+	if b+1 < len(regs) {
+		regs[b+1] &^= byte(hllRegMax >> (8 - shift))
+		regs[b+1] |= value >> (8 - shift)
+	}
+}
+
+// hllPatLen 返回元素对应的寄存器下标，以及哈希剩余位中第一个 1 出现的位置（从 1 开始计）。
+func hllPatLen(element string) (int, uint8) {
+	hash := murmurHash64A(element, hllHashSeed)
+	index := int(hash & (hllRegisters - 1))
+	hash >>= hllP
+	hash |= 1 << hllQ
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+// murmurHash64A 与 Redis 相同的 64 位 MurmurHash2，保证同一元素落在与 Redis 相同的寄存器上。
+func murmurHash64A(data string, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(data))*m
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64([]byte(data[:8]))
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
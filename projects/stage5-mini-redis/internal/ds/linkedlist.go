@@ -45,34 +45,158 @@ func (l *LinkedList) LPop() (string, bool) {
 		return "", false
 	}
 	n := l.head
-	l.head = n.next
-	if l.head != nil {
-		l.head.prev = nil
-	} else {
-		l.tail = nil
+	l.unlink(n)
+	return n.value, true
+}
+
+// Len 返回元素个数。
+func (l *LinkedList) Len() int {
+	return l.len
+}
+
+// RPop 尾删。
+func (l *LinkedList) RPop() (string, bool) {
+	if l.tail == nil {
+		return "", false
 	}
-	l.len--
+	n := l.tail
+	l.unlink(n)
 	return n.value, true
 }
 
-// Range 获取区间元素。
+// Range 获取区间元素，下标语义与 LRANGE 相同：负数从尾部倒数，越界部分被截断。
 func (l *LinkedList) Range(start, stop int) []string {
+	start, stop, ok := l.normalizeRange(start, stop)
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, stop-start+1)
+	node := l.nodeAt(start)
+	for i := start; i <= stop; i++ {
+		result = append(result, node.value)
+		node = node.next
+	}
+	return result
+}
+
+// Index 返回下标处的元素，负数下标从尾部倒数。
+func (l *LinkedList) Index(index int) (string, bool) {
+	n := l.nodeAt(index)
+	if n == nil {
+		return "", false
+	}
+	return n.value, true
+}
+
+// Set 覆盖下标处的元素并返回旧值，下标越界时返回 false。
+func (l *LinkedList) Set(index int, value string) (string, bool) {
+	n := l.nodeAt(index)
+	if n == nil {
+		return "", false
+	}
+	old := n.value
+	n.value = value
+	return old, true
+}
+
+// Remove 删除与 value 相等的元素：count > 0 从头部起删除至多 count 个，count < 0 从尾部起，count == 0 删除全部。
+func (l *LinkedList) Remove(count int, value string) int {
+	removed := 0
+	if count >= 0 {
+		for n := l.head; n != nil && (count == 0 || removed < count); {
+			next := n.next
+			if n.value == value {
+				l.unlink(n)
+				removed++
+			}
+			n = next
+		}
+		return removed
+	}
+	for n := l.tail; n != nil && removed < -count; {
+		prev := n.prev
+		if n.value == value {
+			l.unlink(n)
+			removed++
+		}
+		n = prev
+	}
+	return removed
+}
+
+// Trim 只保留 [start, stop] 区间内的元素，返回被删除的元素。
+func (l *LinkedList) Trim(start, stop int) []string {
+	start, stop, ok := l.normalizeRange(start, stop)
+	if !ok {
+		removed := l.Range(0, -1)
+		*l = LinkedList{}
+		return removed
+	}
+	removed := make([]string, 0, l.len-(stop-start+1))
+	for i := 0; i < start; i++ {
+		value, _ := l.LPop()
+		removed = append(removed, value)
+	}
+	for l.len > stop-start+1 {
+		value, _ := l.RPop()
+		removed = append(removed, value)
+	}
+	return removed
+}
+
+// normalizeRange 将可能为负的区间换算为合法的正向下标，区间为空时返回 false。
+func (l *LinkedList) normalizeRange(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += l.len
+	}
+	if stop < 0 {
+		stop += l.len
+	}
 	if start < 0 {
 		start = 0
 	}
-	if stop < start {
+	if stop >= l.len {
+		stop = l.len - 1
+	}
+	if start > stop {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// nodeAt 返回下标处的节点，从距离较近的一端开始遍历，越界时返回 nil。
+func (l *LinkedList) nodeAt(index int) *listNode {
+	if index < 0 {
+		index += l.len
+	}
+	if index < 0 || index >= l.len {
 		return nil
 	}
-	result := make([]string, 0)
-	idx := 0
-	for node := l.head; node != nil; node = node.next {
-		if idx >= start && idx <= stop {
-			result = append(result, node.value)
-		}
-		if idx > stop {
-			break
+	if index < l.len/2 {
+		n := l.head
+		for ; index > 0; index-- {
+			n = n.next
 		}
-		idx++
+		return n
 	}
-	return result
+	n := l.tail
+	for i := l.len - 1; i > index; i-- {
+		n = n.prev
+	}
+	return n
+}
+
+func (l *LinkedList) unlink(n *listNode) {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		l.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		l.tail = n.prev
+	}
+	n.prev, n.next = nil, nil
+	l.len--
 }
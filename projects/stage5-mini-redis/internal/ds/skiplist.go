@@ -1,6 +1,11 @@
 package ds
 
-import "sort"
+import "math/rand/v2"
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
 
 // ZItem 有序集合项。
 type ZItem struct {
@@ -8,43 +13,337 @@ type ZItem struct {
 	Score  float64
 }
 
-// SkipList 简化跳表实现（底层切片有序维护）。
+// ScoreRange 分数区间，MinEx/MaxEx 为 true 表示对应端点为开区间。
+type ScoreRange struct {
+	Min   float64
+	Max   float64
+	MinEx bool
+	MaxEx bool
+}
+
+// AboveMin 判断 score 是否满足下界。
+func (r ScoreRange) AboveMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+// BelowMax 判断 score 是否满足上界。
+func (r ScoreRange) BelowMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// Empty 判断区间是否不可能包含任何分数。
+func (r ScoreRange) Empty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx))
+}
+
+type skipListLevel struct {
+	forward *skipListNode
+	// span 为 forward 跨越的节点数，用于 O(log n) 计算排名。
+	span int
+}
+
+type skipListNode struct {
+	member   string
+	score    float64
+	backward *skipListNode
+	level    []skipListLevel
+}
+
+// SkipList 与 Redis zskiplist 相同的概率跳表：按 (score, member) 有序，
+// 各层记录跨度以支持按排名访问，dict 提供 O(1) 的成员分数查询。
 type SkipList struct {
-	items map[string]float64
+	header *skipListNode
+	tail   *skipListNode
+	length int
+	level  int
+	dict   map[string]float64
 }
 
 // NewSkipList 创建结构。
 func NewSkipList() *SkipList {
-	return &SkipList{items: make(map[string]float64)}
+	return &SkipList{
+		header: &skipListNode{level: make([]skipListLevel, skipListMaxLevel)},
+		level:  1,
+		dict:   make(map[string]float64),
+	}
+}
+
+// Len 返回成员数量。
+func (s *SkipList) Len() int {
+	return s.length
+}
+
+// Score 返回成员分数。
+func (s *SkipList) Score(member string) (float64, bool) {
+	score, ok := s.dict[member]
+	return score, ok
 }
 
-// Insert 插入成员。
-func (s *SkipList) Insert(member string, score float64) {
-	s.items[member] = score
+// Each 以不确定的顺序遍历全部成员及其分数。
+func (s *SkipList) Each(fn func(member string, score float64)) {
+	for member, score := range s.dict {
+		fn(member, score)
+	}
+}
+
+// Insert 插入成员，已存在时更新分数，返回是否为新成员。
+func (s *SkipList) Insert(member string, score float64) bool {
+	if old, ok := s.dict[member]; ok {
+		if old != score {
+			s.remove(member, old)
+			s.insert(member, score)
+			s.dict[member] = score
+		}
+		return false
+	}
+	s.insert(member, score)
+	s.dict[member] = score
+	return true
+}
+
+// IncrBy 为成员分数增加 delta（成员不存在时视为 0），返回新分数。
+func (s *SkipList) IncrBy(member string, delta float64) float64 {
+	score := s.dict[member] + delta
+	s.Insert(member, score)
+	return score
 }
 
 // Delete 删除成员。
 func (s *SkipList) Delete(member string) bool {
-	if _, ok := s.items[member]; !ok {
+	score, ok := s.dict[member]
+	if !ok {
 		return false
 	}
-	delete(s.items, member)
+	s.remove(member, score)
+	delete(s.dict, member)
 	return true
 }
 
-// RangeByScore 按分数区间查询。
+// Rank 返回成员按分数升序的 0 基排名。
+func (s *SkipList) Rank(member string) (int, bool) {
+	score, ok := s.dict[member]
+	if !ok {
+		return 0, false
+	}
+	rank := 0
+	x := s.header
+	for i := s.level - 1; i >= 0; i-- {
+		for next := x.level[i].forward; next != nil && !less(score, member, next.score, next.member); next = x.level[i].forward {
+			rank += x.level[i].span
+			x = next
+		}
+		if x.member == member && x != s.header {
+			return rank - 1, true
+		}
+	}
+	return 0, false
+}
+
+// RangeByRank 返回升序排名区间 [start, stop] 的成员，下标需已归一化到 [0, Len)。
+func (s *SkipList) RangeByRank(start, stop int, reverse bool) []ZItem {
+	if start < 0 || stop >= s.length || start > stop {
+		return []ZItem{}
+	}
+	result := make([]ZItem, 0, stop-start+1)
+	if reverse {
+		// 倒序第 start 名即升序第 length-1-start 名，沿 backward 指针前移。
+		for x := s.nodeByRank(s.length - 1 - start); x != nil && len(result) < stop-start+1; x = x.backward {
+			result = append(result, ZItem{Member: x.member, Score: x.score})
+		}
+		return result
+	}
+	for x := s.nodeByRank(start); x != nil && len(result) < stop-start+1; x = x.level[0].forward {
+		result = append(result, ZItem{Member: x.member, Score: x.score})
+	}
+	return result
+}
+
+// RangeByScore 按闭区间 [min, max] 升序查询。
 func (s *SkipList) RangeByScore(min, max float64) []ZItem {
+	return s.RangeByScoreRange(ScoreRange{Min: min, Max: max}, false)
+}
+
+// RangeByScoreRange 按分数区间查询，reverse 为 true 时按分数降序返回。
+func (s *SkipList) RangeByScoreRange(r ScoreRange, reverse bool) []ZItem {
 	result := make([]ZItem, 0)
-	for member, score := range s.items {
-		if score >= min && score <= max {
-			result = append(result, ZItem{Member: member, Score: score})
+	if reverse {
+		for x, _ := s.lastInRange(r); x != nil && r.AboveMin(x.score); x = x.backward {
+			result = append(result, ZItem{Member: x.member, Score: x.score})
 		}
+		return result
+	}
+	for x, _ := s.firstInRange(r); x != nil && r.BelowMax(x.score); x = x.level[0].forward {
+		result = append(result, ZItem{Member: x.member, Score: x.score})
 	}
-	sort.Slice(result, func(i, j int) bool {
-		if result[i].Score == result[j].Score {
-			return result[i].Member < result[j].Member
-		}
-		return result[i].Score < result[j].Score
-	})
 	return result
 }
+
+// Count 返回分数落在区间内的成员数，复杂度 O(log n)。
+func (s *SkipList) Count(r ScoreRange) int {
+	first, firstRank := s.firstInRange(r)
+	if first == nil {
+		return 0
+	}
+	_, lastRank := s.lastInRange(r)
+	return lastRank - firstRank + 1
+}
+
+// firstInRange 返回区间内分数最小的节点及其 0 基排名。
+func (s *SkipList) firstInRange(r ScoreRange) (*skipListNode, int) {
+	if !s.inRange(r) {
+		return nil, 0
+	}
+	rank := 0
+	x := s.header
+	for i := s.level - 1; i >= 0; i-- {
+		for next := x.level[i].forward; next != nil && !r.AboveMin(next.score); next = x.level[i].forward {
+			rank += x.level[i].span
+			x = next
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !r.BelowMax(x.score) {
+		return nil, 0
+	}
+	return x, rank
+}
+
+// lastInRange 返回区间内分数最大的节点及其 0 基排名。
+func (s *SkipList) lastInRange(r ScoreRange) (*skipListNode, int) {
+	if !s.inRange(r) {
+		return nil, 0
+	}
+	rank := 0
+	x := s.header
+	for i := s.level - 1; i >= 0; i-- {
+		for next := x.level[i].forward; next != nil && r.BelowMax(next.score); next = x.level[i].forward {
+			rank += x.level[i].span
+			x = next
+		}
+	}
+	if x == s.header || !r.AboveMin(x.score) {
+		return nil, 0
+	}
+	return x, rank - 1
+}
+
+// inRange 快速判断跳表是否可能与区间相交。
+func (s *SkipList) inRange(r ScoreRange) bool {
+	if r.Empty() || s.length == 0 {
+		return false
+	}
+	return r.AboveMin(s.tail.score) && r.BelowMax(s.header.level[0].forward.score)
+}
+
+// nodeByRank 返回 0 基排名对应的节点。
+func (s *SkipList) nodeByRank(rank int) *skipListNode {
+	traversed := 0
+	x := s.header
+	for i := s.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank+1 {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+func (s *SkipList) insert(member string, score float64) {
+	var update [skipListMaxLevel]*skipListNode
+	var rank [skipListMaxLevel]int
+	x := s.header
+	for i := s.level - 1; i >= 0; i-- {
+		if i < s.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for next := x.level[i].forward; next != nil && less(next.score, next.member, score, member); next = x.level[i].forward {
+			rank[i] += x.level[i].span
+			x = next
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = s.header
+			update[i].level[i].span = s.length
+		}
+		s.level = level
+	}
+	node := &skipListNode{member: member, score: score, level: make([]skipListLevel, level)}
+	for i := 0; i < level; i++ {
+		node.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = node
+		node.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < s.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != s.header {
+		node.backward = update[0]
+	}
+	if node.level[0].forward != nil {
+		node.level[0].forward.backward = node
+	} else {
+		s.tail = node
+	}
+	s.length++
+}
+
+func (s *SkipList) remove(member string, score float64) {
+	var update [skipListMaxLevel]*skipListNode
+	x := s.header
+	for i := s.level - 1; i >= 0; i-- {
+		for next := x.level[i].forward; next != nil && less(next.score, next.member, score, member); next = x.level[i].forward {
+			x = next
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return
+	}
+	for i := 0; i < s.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		s.tail = x.backward
+	}
+	for s.level > 1 && s.header.level[s.level-1].forward == nil {
+		s.level--
+	}
+	s.length--
+}
+
+// less 按 (score, member) 比较，分数相同时按成员字典序。
+func less(scoreA float64, memberA string, scoreB float64, memberB string) bool {
+	return scoreA < scoreB || (scoreA == scoreB && memberA < memberB)
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
@@ -0,0 +1,511 @@
+package ds
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// streamNodeSize 近似裁剪（MAXLEN ~）的粒度，对应 Redis 每个 listpack 节点默认容纳的条目数。
+const streamNodeSize = 100
+
+// StreamID 消息 ID，文本形式为 "<毫秒时间戳>-<序号>"。
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID 最大的消息 ID，对应范围查询中的 "+"。
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// String 返回 "ms-seq" 形式。
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 比较两个 ID，返回 -1、0 或 1。
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Less 判断 id 是否小于 other。
+func (id StreamID) Less(other StreamID) bool {
+	return id.Compare(other) < 0
+}
+
+// IsZero 判断是否为 0-0。
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Next 返回紧随其后的 ID，已是最大 ID 时返回 false。
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	default:
+		return id, false
+	}
+}
+
+// Prev 返回紧邻其前的 ID，已是 0-0 时返回 false。
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+// ParseStreamID 解析 "ms-seq" 或 "ms"，省略序号时使用 missingSeq。
+func ParseStreamID(s string, missingSeq uint64) (StreamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	return StreamID{Ms: ms, Seq: seq}, true
+}
+
+// StreamEntry 流中的一条消息，Fields 为 field/value 交替排列。
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// StreamPending 待确认列表（PEL）中的一项：已投递给某个消费者但尚未 XACK 的消息。
+type StreamPending struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  int64 // UnixMilli
+	DeliveryCount int64
+}
+
+// StreamConsumer 消费者组内的消费者。
+type StreamConsumer struct {
+	Name     string
+	SeenTime int64 // UnixMilli
+	Pending  int
+}
+
+// StreamGroup 消费者组，LastID 为最后一次投递给组内消费者的消息 ID。
+type StreamGroup struct {
+	Name      string
+	LastID    StreamID
+	pending   []*StreamPending
+	consumers map[string]*StreamConsumer
+}
+
+// Stream 仅追加的消息流：条目按 ID 递增保存在切片中，查询使用二分查找。
+// 头部裁剪直接重新切片，后续追加扩容时旧的底层数组随之释放。
+type Stream struct {
+	entries []StreamEntry
+	lastID  StreamID
+	groups  map[string]*StreamGroup
+}
+
+// NewStream 创建结构。
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*StreamGroup)}
+}
+
+// Len 返回消息数量。
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+// LastID 返回最后生成的 ID，条目被裁剪后仍保持不变，用于保证 ID 单调递增。
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// SetLastID 设置最后生成的 ID，不能小于当前最大条目 ID。
+func (s *Stream) SetLastID(id StreamID) bool {
+	if n := len(s.entries); n > 0 && id.Less(s.entries[n-1].ID) {
+		return false
+	}
+	s.lastID = id
+	return true
+}
+
+// NextID 按毫秒时间戳生成新 ID：时钟未前进（或回拨）时沿用 lastID 的时间戳并递增序号。
+func (s *Stream) NextID(nowMs uint64) (StreamID, bool) {
+	if nowMs > s.lastID.Ms {
+		return StreamID{Ms: nowMs}, true
+	}
+	return s.lastID.Next()
+}
+
+// Add 追加消息，id 必须大于 LastID。
+func (s *Stream) Add(id StreamID, fields []string) bool {
+	if !s.lastID.Less(id) {
+		return false
+	}
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+	return true
+}
+
+// Trim 将流裁剪到最多 maxLen 条并返回被删除的条目；approx 为 true 时只按 streamNodeSize 整块删除。
+func (s *Stream) Trim(maxLen int, approx bool) []StreamEntry {
+	excess := len(s.entries) - maxLen
+	if approx {
+		excess -= excess % streamNodeSize
+	}
+	if excess <= 0 {
+		return nil
+	}
+	removed := s.entries[:excess:excess]
+	s.entries = s.entries[excess:]
+	return removed
+}
+
+// Range 返回 [start, end] 内的消息，count <= 0 表示不限，reverse 为 true 时从 end 向 start 返回。
+func (s *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	if end.Less(start) {
+		return nil
+	}
+	lo := sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].ID.Less(start) })
+	hi := sort.Search(len(s.entries), func(i int) bool { return end.Less(s.entries[i].ID) })
+	if lo >= hi {
+		return nil
+	}
+	n := hi - lo
+	if count > 0 && count < n {
+		n = count
+	}
+	result := make([]StreamEntry, 0, n)
+	if reverse {
+		for i := hi - 1; i >= lo && len(result) < n; i-- {
+			result = append(result, s.entries[i])
+		}
+		return result
+	}
+	return append(result, s.entries[lo:lo+n]...)
+}
+
+// After 返回 ID 大于 id 的最多 count 条消息。
+func (s *Stream) After(id StreamID, count int) []StreamEntry {
+	next, ok := id.Next()
+	if !ok {
+		return nil
+	}
+	return s.Range(next, MaxStreamID, count, false)
+}
+
+// Get 按 ID 查询消息。
+func (s *Stream) Get(id StreamID) (StreamEntry, bool) {
+	i := sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].ID.Less(id) })
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// CreateGroup 创建消费者组，组名已存在时返回 nil。
+func (s *Stream) CreateGroup(name string, lastID StreamID) *StreamGroup {
+	if _, ok := s.groups[name]; ok {
+		return nil
+	}
+	g := &StreamGroup{Name: name, LastID: lastID, consumers: make(map[string]*StreamConsumer)}
+	s.groups[name] = g
+	return g
+}
+
+// Group 按名称查询消费者组。
+func (s *Stream) Group(name string) (*StreamGroup, bool) {
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+// DestroyGroup 删除消费者组。
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 返回按名称排序的全部消费者组。
+func (s *Stream) Groups() []*StreamGroup {
+	groups := make([]*StreamGroup, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// ReadGroup 向消费者投递 LastID 之后的新消息并推进 LastID；noAck 为 false 时消息进入 PEL。
+func (s *Stream) ReadGroup(g *StreamGroup, consumer string, count int, noAck bool, now int64) []StreamEntry {
+	c := g.touchConsumer(consumer, now)
+	entries := s.After(g.LastID, count)
+	for _, entry := range entries {
+		g.LastID = entry.ID
+		if noAck {
+			continue
+		}
+		// 组 LastID 被 SETID 回拨时消息可能已在 PEL 中，此时转移给当前消费者。
+		if p, ok := g.lookupPending(entry.ID); ok {
+			g.consumers[p.Consumer].Pending--
+			p.Consumer = consumer
+			p.DeliveryTime = now
+			p.DeliveryCount++
+			c.Pending++
+			continue
+		}
+		g.insertPending(&StreamPending{ID: entry.ID, Consumer: consumer, DeliveryTime: now, DeliveryCount: 1})
+		c.Pending++
+	}
+	return entries
+}
+
+// ReadPending 返回消费者 PEL 中 ID 大于 after 的历史消息，已被裁剪的消息 Fields 为 nil。
+func (s *Stream) ReadPending(g *StreamGroup, consumer string, after StreamID, count int, now int64) []StreamEntry {
+	g.touchConsumer(consumer, now)
+	var entries []StreamEntry
+	for _, p := range g.pending {
+		if p.Consumer != consumer || !after.Less(p.ID) {
+			continue
+		}
+		entry, ok := s.Get(p.ID)
+		if !ok {
+			entry = StreamEntry{ID: p.ID}
+		}
+		entries = append(entries, entry)
+		if count > 0 && len(entries) >= count {
+			break
+		}
+	}
+	return entries
+}
+
+// Claim 将 PEL 中空闲至少 minIdle 毫秒的消息转移给 consumer。
+// 消息已被裁剪时从 PEL 删除且不返回；force 为 true 时不在 PEL 中但仍存在的消息会被加入。
+// deliveryTime 为新的投递时间，retryCount 不小于 0 时覆盖投递次数，否则 justID 为 false 时投递次数加一。
+func (s *Stream) Claim(g *StreamGroup, consumer string, ids []StreamID, minIdle, now, deliveryTime, retryCount int64, force, justID bool) []StreamEntry {
+	c := g.touchConsumer(consumer, now)
+	claimed := make([]StreamEntry, 0, len(ids))
+	for _, id := range ids {
+		entry, exists := s.Get(id)
+		p, pending := g.lookupPending(id)
+		if !pending {
+			if !force || !exists {
+				continue
+			}
+			p = &StreamPending{ID: id, Consumer: consumer, DeliveryTime: now}
+			g.insertPending(p)
+			c.Pending++
+		} else {
+			if !exists {
+				g.removePending(id)
+				continue
+			}
+			if minIdle > 0 && now-p.DeliveryTime < minIdle {
+				continue
+			}
+			g.consumers[p.Consumer].Pending--
+			p.Consumer = consumer
+			c.Pending++
+		}
+		p.DeliveryTime = deliveryTime
+		switch {
+		case retryCount >= 0:
+			p.DeliveryCount = retryCount
+		case !justID:
+			p.DeliveryCount++
+		}
+		claimed = append(claimed, entry)
+	}
+	return claimed
+}
+
+// Ack 从 PEL 删除消息，返回实际删除的条数。
+func (g *StreamGroup) Ack(ids ...StreamID) int {
+	acked := 0
+	for _, id := range ids {
+		if g.removePending(id) {
+			acked++
+		}
+	}
+	return acked
+}
+
+// Pending 返回 [start, end] 内按 ID 排序的 PEL 项，consumer 非空时只返回该消费者的项，count <= 0 表示不限。
+func (g *StreamGroup) Pending(start, end StreamID, consumer string, count int) []StreamPending {
+	lo := sort.Search(len(g.pending), func(i int) bool { return !g.pending[i].ID.Less(start) })
+	var result []StreamPending
+	for _, p := range g.pending[lo:] {
+		if end.Less(p.ID) {
+			break
+		}
+		if consumer != "" && p.Consumer != consumer {
+			continue
+		}
+		result = append(result, *p)
+		if count > 0 && len(result) >= count {
+			break
+		}
+	}
+	return result
+}
+
+// PendingLen 返回 PEL 长度。
+func (g *StreamGroup) PendingLen() int {
+	return len(g.pending)
+}
+
+// CreateConsumer 创建消费者，已存在时返回 false。
+func (g *StreamGroup) CreateConsumer(name string, now int64) bool {
+	if _, ok := g.consumers[name]; ok {
+		return false
+	}
+	g.touchConsumer(name, now)
+	return true
+}
+
+// DeleteConsumer 删除消费者及其 PEL 项，返回被丢弃的待确认消息数；消费者不存在时返回 -1。
+func (g *StreamGroup) DeleteConsumer(name string) int {
+	c, ok := g.consumers[name]
+	if !ok {
+		return -1
+	}
+	kept := g.pending[:0]
+	for _, p := range g.pending {
+		if p.Consumer != name {
+			kept = append(kept, p)
+		}
+	}
+	clear(g.pending[len(kept):])
+	g.pending = kept
+	delete(g.consumers, name)
+	return c.Pending
+}
+
+// Consumers 返回按名称排序的消费者快照。
+func (g *StreamGroup) Consumers() []StreamConsumer {
+	consumers := make([]StreamConsumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, *c)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers
+}
+
+func (g *StreamGroup) touchConsumer(name string, now int64) *StreamConsumer {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &StreamConsumer{Name: name}
+		g.consumers[name] = c
+	}
+	c.SeenTime = now
+	return c
+}
+
+func (g *StreamGroup) searchPending(id StreamID) int {
+	return sort.Search(len(g.pending), func(i int) bool { return !g.pending[i].ID.Less(id) })
+}
+
+func (g *StreamGroup) lookupPending(id StreamID) (*StreamPending, bool) {
+	i := g.searchPending(id)
+	if i < len(g.pending) && g.pending[i].ID == id {
+		return g.pending[i], true
+	}
+	return nil, false
+}
+
+// insertPending 按 ID 有序插入；新投递的消息 ID 递增，通常直接追加到末尾。
+func (g *StreamGroup) insertPending(p *StreamPending) {
+	i := g.searchPending(p.ID)
+	g.pending = append(g.pending, nil)
+	copy(g.pending[i+1:], g.pending[i:])
+	g.pending[i] = p
+}
+
+func (g *StreamGroup) removePending(id StreamID) bool {
+	i := g.searchPending(id)
+	if i >= len(g.pending) || g.pending[i].ID != id {
+		return false
+	}
+	if c, ok := g.consumers[g.pending[i].Consumer]; ok {
+		c.Pending--
+	}
+	copy(g.pending[i:], g.pending[i+1:])
+	g.pending[len(g.pending)-1] = nil
+	g.pending = g.pending[:len(g.pending)-1]
+	return true
+}
+
+// RestorePending 加载持久化数据时直接写入 PEL 项，消费者不存在时自动创建。
+func (g *StreamGroup) RestorePending(p StreamPending) {
+	c, ok := g.consumers[p.Consumer]
+	if !ok {
+		c = &StreamConsumer{Name: p.Consumer, SeenTime: p.DeliveryTime}
+		g.consumers[p.Consumer] = c
+	}
+	if old, ok := g.lookupPending(p.ID); ok {
+		g.consumers[old.Consumer].Pending--
+		*old = p
+	} else {
+		pCopy := p
+		g.insertPending(&pCopy)
+	}
+	c.Pending++
+}
+
+// RestoreConsumer 加载持久化数据时恢复消费者（包括没有待确认消息的消费者）。
+func (g *StreamGroup) RestoreConsumer(name string, seenTime int64) {
+	g.touchConsumer(name, seenTime)
+}
+
+// Clone 深拷贝整个流（条目的 Fields 切片不会被修改，可以共享）。
+func (s *Stream) Clone() *Stream {
+	clone := &Stream{
+		entries: append([]StreamEntry(nil), s.entries...),
+		lastID:  s.lastID,
+		groups:  make(map[string]*StreamGroup, len(s.groups)),
+	}
+	for name, g := range s.groups {
+		gCopy := &StreamGroup{
+			Name:      g.Name,
+			LastID:    g.LastID,
+			pending:   make([]*StreamPending, len(g.pending)),
+			consumers: make(map[string]*StreamConsumer, len(g.consumers)),
+		}
+		for i, p := range g.pending {
+			pCopy := *p
+			gCopy.pending[i] = &pCopy
+		}
+		for cname, c := range g.consumers {
+			cCopy := *c
+			gCopy.consumers[cname] = &cCopy
+		}
+		clone.groups[name] = gCopy
+	}
+	return clone
+}
@@ -2,26 +2,119 @@ package persist
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 )
 
+// FsyncPolicy AOF 刷盘策略。
+type FsyncPolicy string
+
+const (
+	// FsyncAlways 每条写命令都 fsync。
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncEverySec 每秒 fsync 一次。
+	FsyncEverySec FsyncPolicy = "everysec"
+	// FsyncNo 只写入内核缓冲区，由操作系统决定刷盘时机。
+	FsyncNo FsyncPolicy = "no"
+)
+
+// ParseFsyncPolicy 解析刷盘策略。
+func ParseFsyncPolicy(value string) (FsyncPolicy, error) {
+	switch policy := FsyncPolicy(strings.ToLower(value)); policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid appendfsync policy %q", value)
+	}
+}
+
 // AOF append-only file。
 type AOF struct {
 	mu     sync.Mutex
+	path   string
 	file   *os.File
 	writer *bufio.Writer
+	policy FsyncPolicy
+	dirty  bool
+
+	// size 为当前文件字节数，baseSize 为上次重写（或启动）后的大小，用于自动重写判断。
+	size              int64
+	baseSize          int64
+	rewritePercentage int
+	rewriteMinSize    int64
+
+	rewriting  bool
+	rewriteBuf bytes.Buffer
 }
 
-// NewAOF 创建 AOF。
+// NewAOF 创建 AOF（默认 everysec）。
 func NewAOF(path string) (*AOF, error) {
+	return NewAOFWithPolicy(path, FsyncEverySec)
+}
+
+// NewAOFWithPolicy 按指定刷盘策略创建 AOF。
+func NewAOFWithPolicy(path string, policy FsyncPolicy) (*AOF, error) {
+	if _, err := ParseFsyncPolicy(string(policy)); err != nil {
+		return nil, err
+	}
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
 	if err != nil {
 		return nil, err
 	}
-	return &AOF{file: file, writer: bufio.NewWriter(file)}, nil
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &AOF{
+		path:              path,
+		file:              file,
+		writer:            bufio.NewWriter(file),
+		policy:            policy,
+		size:              info.Size(),
+		baseSize:          info.Size(),
+		rewritePercentage: DefaultRewritePercentage,
+		rewriteMinSize:    DefaultRewriteMinSize,
+	}, nil
+}
+
+// Path 返回 AOF 文件路径。
+func (a *AOF) Path() string {
+	return a.path
+}
+
+// Policy 返回刷盘策略。
+func (a *AOF) Policy() FsyncPolicy {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.policy
+}
+
+// SetPolicy 运行时切换刷盘策略，切换前先把已写入的数据刷盘。
+func (a *AOF) SetPolicy(policy FsyncPolicy) error {
+	if _, err := ParseFsyncPolicy(string(policy)); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.dirty {
+		if err := a.file.Sync(); err != nil {
+			return err
+		}
+		a.dirty = false
+	}
+	a.policy = policy
+	return nil
 }
 
 // Close 关闭 AOF。
@@ -31,10 +124,13 @@ func (a *AOF) Close() error {
 	if err := a.writer.Flush(); err != nil {
 		return err
 	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
 	return a.file.Close()
 }
 
-// Append 追加命令。
+// Append 以 RESP 格式追加命令。
 func (a *AOF) Append(ctx context.Context, command []string) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -43,12 +139,26 @@ func (a *AOF) Append(ctx context.Context, command []string) error {
 		return err
 	}
 
+	payload := protocol.Serialize(protocol.CommandValue(command))
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	line := strings.Join(command, " ") + "\n"
-	if _, err := a.writer.WriteString(line); err != nil {
+	if a.rewriting {
+		a.rewriteBuf.Write(payload)
+	}
+	if _, err := a.writer.Write(payload); err != nil {
+		return err
+	}
+	a.size += int64(len(payload))
+	// 三种策略都在每条命令后写入内核缓冲区，保证进程崩溃不丢数据；差别只在 fsync 时机。
+	if err := a.writer.Flush(); err != nil {
 		return err
 	}
+	switch a.policy {
+	case FsyncAlways:
+		return a.file.Sync()
+	case FsyncEverySec:
+		a.dirty = true
+	}
 	return nil
 }
 
@@ -65,10 +175,43 @@ func (a *AOF) Flush(ctx context.Context) error {
 	if err := a.writer.Flush(); err != nil {
 		return err
 	}
+	a.dirty = false
 	return a.file.Sync()
 }
 
-// Replay 读取全部命令行。
+// Run 运行 everysec 后台刷盘任务，直到 ctx 取消；其他策略下不产生脏数据，任务空转。
+func (a *AOF) Run(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			if a.dirty {
+				if err := a.file.Sync(); err == nil {
+					a.dirty = false
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Size 返回 AOF 当前字节数。
+func (a *AOF) Size() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size
+}
+
+// Replay 读取全部命令。
+// 文件尾部不完整的命令（写入中途崩溃）会被截断丢弃，兼容旧版按行记录的格式。
 func (a *AOF) Replay(ctx context.Context) ([][]string, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -78,20 +221,74 @@ func (a *AOF) Replay(ctx context.Context) ([][]string, error) {
 	}
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if _, err := a.file.Seek(0, 0); err != nil {
+	if err := a.writer.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := a.file.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
-	scanner := bufio.NewScanner(a.file)
+
+	reader := bufio.NewReader(a.file)
 	commands := make([][]string, 0)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
+	var validSize int64
+	for {
+		prefix, err := reader.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if prefix[0] != byte(protocol.Array) {
+			line, lineErr := reader.ReadString('\n')
+			if lineErr != nil && lineErr != io.EOF {
+				return nil, lineErr
+			}
+			validSize += int64(len(line))
+			if fields := strings.Fields(line); len(fields) > 0 {
+				commands = append(commands, fields)
+			}
+			if lineErr == io.EOF {
+				break
+			}
 			continue
 		}
-		commands = append(commands, strings.Fields(line))
+
+		value, parseErr := protocol.Parse(reader)
+		if parseErr != nil {
+			if errors.Is(parseErr, io.EOF) || errors.Is(parseErr, io.ErrUnexpectedEOF) {
+				if err = a.file.Truncate(validSize); err != nil {
+					return nil, err
+				}
+				a.size = validSize
+				a.baseSize = validSize
+				break
+			}
+			return nil, parseErr
+		}
+		args, argsErr := protocol.CommandArgs(value)
+		if argsErr != nil {
+			return nil, argsErr
+		}
+		validSize += int64(len(protocol.Serialize(value)))
+		commands = append(commands, args)
 	}
-	if _, err := a.file.Seek(0, 2); err != nil {
+	if _, err := a.file.Seek(0, io.SeekEnd); err != nil {
 		return nil, err
 	}
-	return commands, scanner.Err()
+	return commands, nil
+}
+
+// ReplayInto 将 AOF 中的命令重放到 DB，返回重放条数。
+func ReplayInto(ctx context.Context, aof *AOF, database *db.DB) (int, error) {
+	commands, err := aof.Replay(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, command := range commands {
+		if _, err = database.ExecuteCommand(ctx, command); err != nil {
+			return i, fmt.Errorf("replay aof command %d %v: %w", i, command, err)
+		}
+	}
+	return len(commands), nil
 }
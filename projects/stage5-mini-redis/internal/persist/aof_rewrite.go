@@ -0,0 +1,271 @@
+package persist
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+const (
+	// DefaultRewritePercentage AOF 相对上次重写增长超过该百分比时自动重写。
+	DefaultRewritePercentage = 100
+	// DefaultRewriteMinSize AOF 小于该字节数时不自动重写。
+	DefaultRewriteMinSize = 64 << 20
+
+	// rewriteItemsPerCmd 重写时单条命令最多携带的元素个数。
+	rewriteItemsPerCmd = 64
+)
+
+var ErrRewriteInProgress = errors.New("background aof rewrite already in progress")
+
+// SetAutoRewrite 配置自动重写阈值，percentage <= 0 表示关闭自动重写。
+func (a *AOF) SetAutoRewrite(percentage int, minSize int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewritePercentage = percentage
+	a.rewriteMinSize = minSize
+}
+
+// AutoRewrite 返回自动重写阈值。
+func (a *AOF) AutoRewrite() (int, int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewritePercentage, a.rewriteMinSize
+}
+
+// BaseSize 返回上次重写（或启动）后的文件大小。
+func (a *AOF) BaseSize() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.baseSize
+}
+
+// NeedsRewrite 判断 AOF 增长是否达到自动重写条件。
+func (a *AOF) NeedsRewrite() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriting || a.rewritePercentage <= 0 || a.size < a.rewriteMinSize {
+		return false
+	}
+	base := a.baseSize
+	if base <= 0 {
+		base = 1
+	}
+	return (a.size-base)*100/base >= int64(a.rewritePercentage)
+}
+
+// Rewriting 返回是否正在重写。
+func (a *AOF) Rewriting() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewriting
+}
+
+// BeginRewrite 开始重写，此后追加的命令会同时写入重写缓冲区。
+// 调用方需保证 BeginRewrite 与获取数据快照之间没有写命令插入。
+func (a *AOF) BeginRewrite() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriting {
+		return ErrRewriteInProgress
+	}
+	a.rewriting = true
+	a.rewriteBuf.Reset()
+	return nil
+}
+
+// FinishRewrite 将快照写成最小命令集，追加重写期间的增量命令后原子替换 AOF 文件。
+func (a *AOF) FinishRewrite(snapshot map[string]*db.Entry) error {
+	tmpPath := a.path + ".rewrite.tmp"
+	if err := a.finishRewrite(tmpPath, snapshot); err != nil {
+		_ = os.Remove(tmpPath)
+		a.mu.Lock()
+		a.rewriting = false
+		a.rewriteBuf.Reset()
+		a.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (a *AOF) finishRewrite(tmpPath string, snapshot map[string]*db.Entry) error {
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tmp.Close() }()
+
+	// 快照部分不持有锁，重写期间前台写命令照常追加。
+	writer := bufio.NewWriter(tmp)
+	for _, command := range RewriteCommands(snapshot, time.Now()) {
+		if _, err = writer.Write(protocol.Serialize(protocol.CommandValue(command))); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err = tmp.Write(a.rewriteBuf.Bytes()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if err = a.writer.Flush(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, a.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(a.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_ = a.file.Close()
+	a.file = file
+	a.writer.Reset(file)
+	a.size = info.Size()
+	a.baseSize = info.Size()
+	a.dirty = false
+	a.rewriting = false
+	a.rewriteBuf.Reset()
+	return nil
+}
+
+// RewriteCommands 根据数据快照生成最小命令集，已过期的 key 会被跳过。
+func RewriteCommands(snapshot map[string]*db.Entry, now time.Time) [][]string {
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	commands := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		entry := snapshot[key]
+		if entry == nil || (!entry.ExpireAt.IsZero() && now.After(entry.ExpireAt)) {
+			continue
+		}
+		commands = append(commands, entryCommands(key, entry)...)
+		if !entry.ExpireAt.IsZero() {
+			commands = append(commands, []string{"PEXPIREAT", key, strconv.FormatInt(entry.ExpireAt.UnixMilli(), 10)})
+		}
+	}
+	return commands
+}
+
+func entryCommands(key string, entry *db.Entry) [][]string {
+	switch entry.Type {
+	case db.TypeString:
+		value, _ := entry.Value.(string)
+		return [][]string{{"SET", key, value}}
+	case db.TypeList:
+		list := entry.Value.(*ds.LinkedList)
+		return batchCommands("RPUSH", key, list.Range(0, list.Len()-1))
+	case db.TypeSet:
+		set := entry.Value.(map[string]struct{})
+		members := make([]string, 0, len(set))
+		for member := range set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		return batchCommands("SADD", key, members)
+	case db.TypeZSet:
+		z := entry.Value.(*ds.SkipList)
+		items := z.RangeByScore(math.Inf(-1), math.Inf(1))
+		pairs := make([]string, 0, len(items)*2)
+		for _, item := range items {
+			pairs = append(pairs, strconv.FormatFloat(item.Score, 'g', -1, 64), item.Member)
+		}
+		return batchCommands("ZADD", key, pairs)
+	case db.TypeHash:
+		h := entry.Value.(map[string]string)
+		fields := make([]string, 0, len(h))
+		for field := range h {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		pairs := make([]string, 0, len(fields)*2)
+		for _, field := range fields {
+			pairs = append(pairs, field, h[field])
+		}
+		return batchCommands("HSET", key, pairs)
+	case db.TypeStream:
+		return streamCommands(key, entry.Value.(*ds.Stream))
+	default:
+		return nil
+	}
+}
+
+// streamCommands 以显式 ID 的 XADD 重建消息，再用 XSETID 还原被裁剪后的最后 ID；
+// 消费者组用 XGROUP CREATE/CREATECONSUMER 重建，PEL 用带 TIME、RETRYCOUNT 的 XCLAIM FORCE JUSTID 还原。
+func streamCommands(key string, s *ds.Stream) [][]string {
+	entries := s.Range(ds.StreamID{}, ds.MaxStreamID, 0, false)
+	commands := make([][]string, 0, len(entries)+1)
+	for _, entry := range entries {
+		commands = append(commands, append([]string{"XADD", key, entry.ID.String()}, entry.Fields...))
+	}
+	lastID := s.LastID()
+	if len(entries) == 0 {
+		// 空流没有可重放的消息：写入一条占位消息并立即裁剪掉，再设置最后 ID。
+		placeholder := lastID
+		if placeholder.IsZero() {
+			placeholder = ds.StreamID{Seq: 1}
+		}
+		commands = append(commands, []string{"XADD", key, "MAXLEN", "0", placeholder.String(), "x", "y"})
+	}
+	if len(entries) == 0 || entries[len(entries)-1].ID != lastID {
+		commands = append(commands, []string{"XSETID", key, lastID.String()})
+	}
+	for _, g := range s.Groups() {
+		commands = append(commands, []string{"XGROUP", "CREATE", key, g.Name, g.LastID.String()})
+		for _, c := range g.Consumers() {
+			commands = append(commands, []string{"XGROUP", "CREATECONSUMER", key, g.Name, c.Name})
+		}
+		for _, p := range g.Pending(ds.StreamID{}, ds.MaxStreamID, "", 0) {
+			commands = append(commands, []string{
+				"XCLAIM", key, g.Name, p.Consumer, "0", p.ID.String(),
+				"TIME", strconv.FormatInt(p.DeliveryTime, 10),
+				"RETRYCOUNT", strconv.FormatInt(p.DeliveryCount, 10),
+				"FORCE", "JUSTID",
+			})
+		}
+	}
+	return commands
+}
+
+// batchCommands 按 rewriteItemsPerCmd 拆分变长参数命令，ZADD 的 score/member 与 HSET 的 field/value 成对计数。
+func batchCommands(name, key string, items []string) [][]string {
+	step := rewriteItemsPerCmd
+	if name == "ZADD" || name == "HSET" {
+		step *= 2
+	}
+	commands := make([][]string, 0, len(items)/step+1)
+	for start := 0; start < len(items); start += step {
+		end := start + step
+		if end > len(items) {
+			end = len(items)
+		}
+		command := make([]string, 0, end-start+2)
+		command = append(command, name, key)
+		command = append(command, items[start:end]...)
+		commands = append(commands, command)
+	}
+	return commands
+}
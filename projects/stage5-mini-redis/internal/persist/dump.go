@@ -0,0 +1,59 @@
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+	"io"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+)
+
+// DUMP 负载布局（与 Redis 相同的思路）：
+//
+//	type value | version uint16 | crc64 uint64
+//
+// value 复用 RDB 的值编码，过期时间不在负载中，由 RESTORE 的 ttl 参数单独携带。
+
+// DumpEntry 将单个条目序列化为 DUMP 负载。
+func DumpEntry(entry *db.Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := &rdbEncoder{w: &buf, crc: crc64.New(crcTable)}
+	enc.writeByte(byte(entry.Type))
+	if err := enc.writeValue(entry); err != nil {
+		return nil, err
+	}
+	enc.writeUint16(RDBVersion)
+	if enc.err != nil {
+		return nil, enc.err
+	}
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], enc.crc.Sum64())
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// RestoreEntry 校验并反序列化 DUMP 负载，返回的条目不带过期时间。
+func RestoreEntry(payload []byte) (*db.Entry, error) {
+	if len(payload) < 1+2+8 {
+		return nil, ErrRDBFormat
+	}
+	body, trailer := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crc64.Checksum(body, crcTable) != binary.BigEndian.Uint64(trailer) {
+		return nil, ErrRDBChecksum
+	}
+	if binary.BigEndian.Uint16(body[len(body)-2:]) != RDBVersion {
+		return nil, ErrRDBFormat
+	}
+	dec := &rdbDecoder{r: bufio.NewReader(bytes.NewReader(body[:len(body)-2])), crc: crc64.New(crcTable)}
+	entry := &db.Entry{Type: db.ValueType(dec.readByte())}
+	entry.Value = dec.readValue(entry.Type)
+	if dec.err != nil {
+		return nil, ErrRDBFormat
+	}
+	if _, err := dec.r.ReadByte(); err != io.EOF {
+		return nil, ErrRDBFormat
+	}
+	return entry, nil
+}
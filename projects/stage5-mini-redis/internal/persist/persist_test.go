@@ -1,11 +1,19 @@
 package persist
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
 )
 
 func TestAOFAppendReplay(t *testing.T) {
@@ -45,3 +53,435 @@ func TestRDBSnapshot(t *testing.T) {
 		t.Fatalf("len(loaded) = %d, want 1", len(loaded))
 	}
 }
+
+func TestAOFRESPFramingKeepsSpaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spaces.aof")
+	aof, err := NewAOFWithPolicy(path, FsyncAlways)
+	if err != nil {
+		t.Fatalf("NewAOFWithPolicy() error = %v", err)
+	}
+	ctx := context.Background()
+	if err = aof.Append(ctx, []string{"SET", "greeting", "hello world\r\n"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	_ = aof.Close()
+
+	reopened, err := NewAOF(path)
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	d := db.New()
+	replayed, err := ReplayInto(ctx, reopened, d)
+	if err != nil || replayed != 1 {
+		t.Fatalf("ReplayInto() = (%d, %v), want (1, nil)", replayed, err)
+	}
+	value, ok, _ := d.GetString(ctx, "greeting")
+	if !ok || value != "hello world\r\n" {
+		t.Fatalf("GetString() = (%q, %v), want hello world", value, ok)
+	}
+}
+
+func TestAOFReplayTruncatesPartialTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial.aof")
+	aof, err := NewAOF(path)
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	ctx := context.Background()
+	_ = aof.Append(ctx, []string{"SET", "a", "1"})
+	_ = aof.Close()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	_, _ = file.WriteString("*3\r\n$3\r\nSET\r\n$1\r\nb")
+	_ = file.Close()
+
+	reopened, err := NewAOF(path)
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	commands, err := reopened.Replay(ctx)
+	if err != nil || len(commands) != 1 {
+		t.Fatalf("Replay() = (%v, %v), want one command", commands, err)
+	}
+	_ = reopened.Append(ctx, []string{"SET", "c", "3"})
+	commands, err = reopened.Replay(ctx)
+	if err != nil || len(commands) != 2 || commands[1][1] != "c" {
+		t.Fatalf("Replay() after append = (%v, %v)", commands, err)
+	}
+}
+
+func TestAOFReplayKeepsAbsoluteExpire(t *testing.T) {
+	aof, err := NewAOF(filepath.Join(t.TempDir(), "expire.aof"))
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	defer func() { _ = aof.Close() }()
+
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	for _, command := range db.PropagateCommands([]string{"SET", "k", "v", "EX", "1"}, past) {
+		_ = aof.Append(ctx, command)
+	}
+	d := db.New()
+	if _, err = ReplayInto(ctx, aof, d); err != nil {
+		t.Fatalf("ReplayInto() error = %v", err)
+	}
+	if _, ok, _ := d.GetString(ctx, "k"); ok {
+		t.Fatal("key written with an expired absolute ttl should not survive replay")
+	}
+}
+
+func TestAOFReplayMatchesLiveForNonPositiveExpire(t *testing.T) {
+	aof, err := NewAOF(filepath.Join(t.TempDir(), "nonpositive.aof"))
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	defer func() { _ = aof.Close() }()
+
+	ctx := context.Background()
+	live := db.New()
+	write := func(command []string) error {
+		if _, execErr := live.ExecuteCommand(ctx, command); execErr != nil {
+			return execErr
+		}
+		for _, propagated := range db.PropagateCommands(command, time.Now()) {
+			_ = aof.Append(ctx, propagated)
+		}
+		return nil
+	}
+	for _, command := range [][]string{{"SET", "k", "v"}, {"SET", "n", "v"}, {"SET", "e", "v"}} {
+		if err = write(command); err != nil {
+			t.Fatalf("ExecuteCommand(%v) error = %v", command, err)
+		}
+	}
+	for _, seconds := range []string{"0", "-5"} {
+		if err = write([]string{"SET", "k", "new", "EX", seconds}); !errors.Is(err, db.ErrInvalidExpireTime) {
+			t.Fatalf("SET EX %s error = %v, want ErrInvalidExpireTime", seconds, err)
+		}
+	}
+	if err = write([]string{"EXPIRE", "n", "-5"}); err != nil {
+		t.Fatalf("EXPIRE error = %v", err)
+	}
+	if err = write([]string{"EXPIRE", "e", "0"}); err != nil {
+		t.Fatalf("EXPIRE error = %v", err)
+	}
+
+	restored := db.New()
+	if _, err = ReplayInto(ctx, aof, restored); err != nil {
+		t.Fatalf("ReplayInto() error = %v", err)
+	}
+	for _, key := range []string{"k", "n", "e"} {
+		want, wantOK, _ := live.GetString(ctx, key)
+		got, ok, _ := restored.GetString(ctx, key)
+		if ok != wantOK || got != want {
+			t.Fatalf("replayed %s = (%q, %v), live = (%q, %v)", key, got, ok, want, wantOK)
+		}
+	}
+	if got, _, _ := restored.GetString(ctx, "k"); got != "v" {
+		t.Fatalf("replayed k = %q, want v", got)
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, value := range []string{"always", "EVERYSEC", "no"} {
+		if _, err := ParseFsyncPolicy(value); err != nil {
+			t.Fatalf("ParseFsyncPolicy(%q) error = %v", value, err)
+		}
+	}
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Fatal("ParseFsyncPolicy(sometimes) should fail")
+	}
+}
+
+func TestAOFRewriteCompactsAndKeepsConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rewrite.aof")
+	aof, err := NewAOF(path)
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	defer func() { _ = aof.Close() }()
+
+	ctx := context.Background()
+	d := db.New()
+	write := func(command []string) {
+		if _, execErr := d.ExecuteCommand(ctx, command); execErr != nil {
+			t.Fatalf("ExecuteCommand(%v) error = %v", command, execErr)
+		}
+		for _, propagated := range db.PropagateCommands(command, time.Now()) {
+			_ = aof.Append(ctx, propagated)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		write([]string{"SET", "counter", strconv.Itoa(i)})
+	}
+	write([]string{"RPUSH", "list", "a", "b", "c"})
+	write([]string{"SADD", "set", "x", "y"})
+	write([]string{"ZADD", "zset", "1.5", "m1", "-3", "m2"})
+	write([]string{"HSET", "hash", "f", "v"})
+	write([]string{"SET", "session", "s", "EX", "100"})
+	before := aof.Size()
+
+	if err = aof.BeginRewrite(); err != nil {
+		t.Fatalf("BeginRewrite() error = %v", err)
+	}
+	if err = aof.BeginRewrite(); err != ErrRewriteInProgress {
+		t.Fatalf("second BeginRewrite() error = %v, want ErrRewriteInProgress", err)
+	}
+	snapshot := d.Snapshot()
+	write([]string{"SET", "during", "rewrite"})
+	if err = aof.FinishRewrite(snapshot); err != nil {
+		t.Fatalf("FinishRewrite() error = %v", err)
+	}
+	write([]string{"RPUSH", "list", "d"})
+
+	if aof.Size() >= before {
+		t.Fatalf("rewritten size = %d, want < %d", aof.Size(), before)
+	}
+	restored := db.New()
+	if _, err = ReplayInto(ctx, aof, restored); err != nil {
+		t.Fatalf("ReplayInto() error = %v", err)
+	}
+	for _, key := range []string{"counter", "during"} {
+		want, _, _ := d.GetString(ctx, key)
+		got, ok, _ := restored.GetString(ctx, key)
+		if !ok || got != want {
+			t.Fatalf("restored %s = (%q, %v), want %q", key, got, ok, want)
+		}
+	}
+	items, _ := restored.LRange(ctx, "list", 0, 10)
+	if len(items) != 4 || items[3] != "d" {
+		t.Fatalf("restored list = %v, want [a b c d]", items)
+	}
+	zitems, _ := restored.ZRangeByScore(ctx, "zset", -10, 10)
+	if len(zitems) != 2 || zitems[0].Member != "m2" {
+		t.Fatalf("restored zset = %v", zitems)
+	}
+	if ttl, _ := restored.TTL(ctx, "session"); ttl <= 0 {
+		t.Fatalf("restored session ttl = %d, want > 0", ttl)
+	}
+}
+
+func TestRewriteCommandsBatchesHashFields(t *testing.T) {
+	h := make(map[string]string, rewriteItemsPerCmd+1)
+	for i := 0; i <= rewriteItemsPerCmd; i++ {
+		h["f"+strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	commands := RewriteCommands(map[string]*db.Entry{"hash": {Type: db.TypeHash, Value: h}}, time.Now())
+	if len(commands) != 2 {
+		t.Fatalf("rewrite of %d fields = %d commands, want 2", len(h), len(commands))
+	}
+	if first := commands[0]; first[0] != "HSET" || len(first) != 2+2*rewriteItemsPerCmd {
+		t.Fatalf("first command = %s with %d args, want HSET with %d field/value pairs", first[0], len(first)-2, rewriteItemsPerCmd)
+	}
+	if last := commands[1]; len(last) != 4 {
+		t.Fatalf("last command = %v, want one field/value pair", last)
+	}
+}
+
+func TestAOFNeedsRewrite(t *testing.T) {
+	aof, err := NewAOF(filepath.Join(t.TempDir(), "auto.aof"))
+	if err != nil {
+		t.Fatalf("NewAOF() error = %v", err)
+	}
+	defer func() { _ = aof.Close() }()
+
+	aof.SetAutoRewrite(100, 64)
+	ctx := context.Background()
+	if aof.NeedsRewrite() {
+		t.Fatal("empty aof should not need rewrite")
+	}
+	for i := 0; i < 10; i++ {
+		_ = aof.Append(ctx, []string{"SET", "k", "v"})
+	}
+	if !aof.NeedsRewrite() {
+		t.Fatalf("aof of %d bytes should need rewrite", aof.Size())
+	}
+	aof.SetAutoRewrite(0, 64)
+	if aof.NeedsRewrite() {
+		t.Fatal("auto rewrite disabled should not trigger")
+	}
+}
+
+func TestRDBRoundTripAllTypes(t *testing.T) {
+	d := db.New()
+	ctx := context.Background()
+	_ = d.SetString(ctx, "str", "hello world", time.Hour)
+	_, _ = d.ExecuteCommand(ctx, []string{"RPUSH", "list", "a", "b", "c"})
+	_, _ = d.ExecuteCommand(ctx, []string{"SADD", "set", "x", "y"})
+	_, _ = d.ExecuteCommand(ctx, []string{"ZADD", "zset", "2.5", "m1", "-1e9", "m2"})
+	_, _ = d.ExecuteCommand(ctx, []string{"HSET", "hash", "f", "v"})
+	_ = d.SetString(ctx, "gone", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	path := filepath.Join(t.TempDir(), "types.rdb")
+	if err := SaveSnapshot(ctx, path, d.Snapshot()); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	loaded, err := LoadSnapshot(ctx, path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if _, ok := loaded["gone"]; ok {
+		t.Fatal("expired key should be dropped on load")
+	}
+	restored := db.New()
+	restored.LoadSnapshot(loaded)
+
+	if value, ok, _ := restored.GetString(ctx, "str"); !ok || value != "hello world" {
+		t.Fatalf("str = (%q, %v)", value, ok)
+	}
+	if ttl, _ := restored.TTL(ctx, "str"); ttl <= 0 {
+		t.Fatalf("str ttl = %d, want > 0", ttl)
+	}
+	if items, _ := restored.LRange(ctx, "list", 0, 10); len(items) != 3 || items[0] != "a" {
+		t.Fatalf("list = %v", items)
+	}
+	if members, _ := restored.SMembers(ctx, "set"); len(members) != 2 {
+		t.Fatalf("set = %v", members)
+	}
+	if items, _ := restored.ZRangeByScore(ctx, "zset", -2e9, 10); len(items) != 2 || items[0].Score != -1e9 {
+		t.Fatalf("zset = %v", items)
+	}
+	if value, ok, _ := restored.HGet(ctx, "hash", "f"); !ok || value != "v" {
+		t.Fatalf("hash = (%q, %v)", value, ok)
+	}
+}
+
+func TestRDBDetectsCorruption(t *testing.T) {
+	d := db.New()
+	ctx := context.Background()
+	_ = d.SetString(ctx, "k", "value", 0)
+
+	var buf bytes.Buffer
+	if err := EncodeSnapshot(&buf, d.Snapshot()); err != nil {
+		t.Fatalf("EncodeSnapshot() error = %v", err)
+	}
+	payload := buf.Bytes()
+
+	corrupted := append([]byte(nil), payload...)
+	corrupted[len(corrupted)-12] ^= 0xFF
+	if _, err := DecodeSnapshot(bytes.NewReader(corrupted)); err == nil {
+		t.Fatal("DecodeSnapshot() should reject corrupted payload")
+	}
+	if _, err := DecodeSnapshot(bytes.NewReader(payload[:len(payload)-3])); err == nil {
+		t.Fatal("DecodeSnapshot() should reject truncated payload")
+	}
+	if _, err := DecodeSnapshot(bytes.NewReader([]byte("{\"k\":{}}"))); !errors.Is(err, ErrRDBFormat) {
+		t.Fatalf("DecodeSnapshot(json) error = %v, want ErrRDBFormat", err)
+	}
+}
+
+func TestDumpRestoreEntry(t *testing.T) {
+	d := db.New()
+	ctx := context.Background()
+	_, _ = d.ExecuteCommand(ctx, []string{"RPUSH", "list", "a", "b c", "d"})
+	entry, ok, err := d.Dump(ctx, "list")
+	if err != nil || !ok {
+		t.Fatalf("Dump() = %v, %v", ok, err)
+	}
+	payload, err := DumpEntry(entry)
+	if err != nil {
+		t.Fatalf("DumpEntry() error = %v", err)
+	}
+
+	restored, err := RestoreEntry(payload)
+	if err != nil {
+		t.Fatalf("RestoreEntry() error = %v", err)
+	}
+	target := db.New()
+	if err = target.Restore(ctx, "copy", restored, false); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if items, _ := target.LRange(ctx, "copy", 0, 10); len(items) != 3 || items[1] != "b c" {
+		t.Fatalf("restored list = %v", items)
+	}
+	if err = target.Restore(ctx, "copy", restored, false); !errors.Is(err, db.ErrBusyKey) {
+		t.Fatalf("Restore(existing) error = %v, want ErrBusyKey", err)
+	}
+
+	payload[1] ^= 0xFF
+	if _, err = RestoreEntry(payload); !errors.Is(err, ErrRDBChecksum) {
+		t.Fatalf("RestoreEntry(corrupted) error = %v, want ErrRDBChecksum", err)
+	}
+}
+
+// streamState 渲染流的消息、最后 ID 与各消费者组的 PEL，用于比较持久化前后的状态。
+func streamState(t *testing.T, d *db.DB, key string) string {
+	t.Helper()
+	entry, ok, err := d.Dump(context.Background(), key)
+	if err != nil || !ok || entry.Type != db.TypeStream {
+		t.Fatalf("Dump(%s) = (%v, %v)", key, ok, err)
+	}
+	s := entry.Value.(*ds.Stream)
+	var b strings.Builder
+	for _, e := range s.Range(ds.StreamID{}, ds.MaxStreamID, 0, false) {
+		fmt.Fprintf(&b, "%s%v ", e.ID, e.Fields)
+	}
+	fmt.Fprintf(&b, "last=%s", s.LastID())
+	for _, g := range s.Groups() {
+		fmt.Fprintf(&b, " group=%s@%s", g.Name, g.LastID)
+		for _, c := range g.Consumers() {
+			fmt.Fprintf(&b, " consumer=%s:%d", c.Name, c.Pending)
+		}
+		for _, p := range g.Pending(ds.StreamID{}, ds.MaxStreamID, "", 0) {
+			fmt.Fprintf(&b, " pel=%s:%s:%d:%d", p.ID, p.Consumer, p.DeliveryTime, p.DeliveryCount)
+		}
+	}
+	return b.String()
+}
+
+func TestStreamPersistence(t *testing.T) {
+	ctx := context.Background()
+	d := db.New()
+	for _, args := range [][]string{
+		{"XADD", "jobs", "1-1", "task", "a"},
+		{"XADD", "jobs", "1-2", "task", "b"},
+		{"XADD", "jobs", "2-0", "task", "c"},
+		{"XADD", "jobs", "MAXLEN", "2", "5-0", "task", "d"},
+		{"XGROUP", "CREATE", "jobs", "workers", "0"},
+		{"XGROUP", "CREATECONSUMER", "jobs", "workers", "idle"},
+		{"XREADGROUP", "GROUP", "workers", "alice", "COUNT", "1", "STREAMS", "jobs", ">"},
+		{"XCLAIM", "jobs", "workers", "alice", "0", "2-0", "TIME", "1000", "RETRYCOUNT", "3", "FORCE", "JUSTID"},
+		{"XGROUP", "CREATE", "empty", "g", "$", "MKSTREAM"},
+		{"XADD", "trimmed", "MAXLEN", "0", "7-7", "f", "v"},
+	} {
+		if _, err := d.ExecuteCommand(ctx, args); err != nil {
+			t.Fatalf("%v error = %v", args, err)
+		}
+	}
+	keys := []string{"jobs", "empty", "trimmed"}
+
+	var buf bytes.Buffer
+	if err := EncodeSnapshot(&buf, d.Snapshot()); err != nil {
+		t.Fatalf("EncodeSnapshot() error = %v", err)
+	}
+	loaded, err := DecodeSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("DecodeSnapshot() error = %v", err)
+	}
+	fromRDB := db.New()
+	fromRDB.LoadSnapshot(loaded)
+
+	fromAOF := db.New()
+	for _, command := range RewriteCommands(d.Snapshot(), time.Now()) {
+		if _, err = fromAOF.ExecuteCommand(ctx, command); err != nil {
+			t.Fatalf("replay %v error = %v", command, err)
+		}
+	}
+
+	for _, key := range keys {
+		want := streamState(t, d, key)
+		if got := streamState(t, fromRDB, key); got != want {
+			t.Fatalf("rdb %s = %q, want %q", key, got, want)
+		}
+		// AOF 重写不保留消费者的最后活跃时间，其余状态（包括 PEL 投递时间与次数）应一致。
+		if got := streamState(t, fromAOF, key); got != want {
+			t.Fatalf("aof %s = %q, want %q", key, got, want)
+		}
+	}
+}
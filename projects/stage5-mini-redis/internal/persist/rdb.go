@@ -1,14 +1,45 @@
 package persist
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
 )
 
-// SaveSnapshot 保存快照。
+// RDB 文件布局：
+//
+//	magic "MREDIS" | version uint16 | { [opExpireMs int64] type key value }* | opEOF | crc64 uint64
+//
+// 长度与计数使用 uvarint，整数使用大端序，校验和覆盖 opEOF 之前（含）的全部字节。
+const (
+	rdbMagic   = "MREDIS"
+	RDBVersion = uint16(1)
+
+	opExpireMs byte = 0xFC
+	opEOF      byte = 0xFF
+)
+
+var (
+	ErrRDBChecksum = errors.New("rdb checksum mismatch")
+	ErrRDBFormat   = errors.New("invalid rdb format")
+
+	crcTable = crc64.MakeTable(crc64.ECMA)
+)
+
+// SaveSnapshot 将快照写入临时文件后原子替换目标文件。
 func SaveSnapshot(ctx context.Context, path string, snapshot map[string]*db.Entry) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -16,14 +47,29 @@ func SaveSnapshot(ctx context.Context, path string, snapshot map[string]*db.Entr
 	if err := ctx.Err(); err != nil {
 		return err
 	}
-	payload, err := json.Marshal(snapshot)
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err = EncodeSnapshot(writer, snapshot); err == nil {
+		if err = writer.Flush(); err == nil {
+			err = file.Sync()
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		_ = os.Remove(tmpPath)
 		return err
 	}
-	return os.WriteFile(path, payload, 0o644)
+	return os.Rename(tmpPath, path)
 }
 
-// LoadSnapshot 加载快照。
+// LoadSnapshot 加载快照，已过期的 key 会被丢弃。
 func LoadSnapshot(ctx context.Context, path string) (map[string]*db.Entry, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -31,13 +77,400 @@ func LoadSnapshot(ctx context.Context, path string) (map[string]*db.Entry, error
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	data, err := os.ReadFile(path)
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = file.Close() }()
+	return DecodeSnapshot(bufio.NewReader(file))
+}
+
+// EncodeSnapshot 按二进制 RDB 格式编码快照。
+func EncodeSnapshot(w io.Writer, snapshot map[string]*db.Entry) error {
+	enc := &rdbEncoder{w: w, crc: crc64.New(crcTable)}
+	enc.writeRaw([]byte(rdbMagic))
+	enc.writeUint16(RDBVersion)
+
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := snapshot[key]
+		if entry == nil {
+			continue
+		}
+		if !entry.ExpireAt.IsZero() {
+			enc.writeByte(opExpireMs)
+			enc.writeUint64(uint64(entry.ExpireAt.UnixMilli()))
+		}
+		enc.writeByte(byte(entry.Type))
+		enc.writeString(key)
+		if err := enc.writeValue(entry); err != nil {
+			return err
+		}
+	}
+	enc.writeByte(opEOF)
+	if enc.err != nil {
+		return enc.err
+	}
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], enc.crc.Sum64())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+// DecodeSnapshot 解码二进制 RDB 并校验尾部 CRC64。
+func DecodeSnapshot(r io.Reader) (map[string]*db.Entry, error) {
+	dec := &rdbDecoder{r: bufio.NewReader(r), crc: crc64.New(crcTable)}
+	magic := dec.readRaw(len(rdbMagic))
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if string(magic) != rdbMagic {
+		return nil, ErrRDBFormat
+	}
+	if version := dec.readUint16(); dec.err == nil && version != RDBVersion {
+		return nil, fmt.Errorf("unsupported rdb version %d", version)
+	}
+
+	now := time.Now()
 	snapshot := make(map[string]*db.Entry)
-	if err = json.Unmarshal(data, &snapshot); err != nil {
-		return nil, err
+	for dec.err == nil {
+		op := dec.readByte()
+		if dec.err != nil {
+			break
+		}
+		if op == opEOF {
+			expected := dec.crc.Sum64()
+			var sum [8]byte
+			if _, err := io.ReadFull(dec.r, sum[:]); err != nil {
+				return nil, err
+			}
+			if binary.BigEndian.Uint64(sum[:]) != expected {
+				return nil, ErrRDBChecksum
+			}
+			return snapshot, nil
+		}
+
+		var expireAt time.Time
+		if op == opExpireMs {
+			expireAt = time.UnixMilli(int64(dec.readUint64()))
+			op = dec.readByte()
+		}
+		key := dec.readString()
+		entry := &db.Entry{Type: db.ValueType(op), ExpireAt: expireAt}
+		entry.Value = dec.readValue(entry.Type)
+		if dec.err != nil {
+			break
+		}
+		if !expireAt.IsZero() && now.After(expireAt) {
+			continue
+		}
+		snapshot[key] = entry
+	}
+	if errors.Is(dec.err, io.EOF) {
+		return nil, fmt.Errorf("%w: unexpected end of file", ErrRDBFormat)
+	}
+	return nil, dec.err
+}
+
+// rdbEncoder 记录首个错误，同时累计 CRC。
+type rdbEncoder struct {
+	w   io.Writer
+	crc hash.Hash64
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *rdbEncoder) writeRaw(p []byte) {
+	if e.err != nil {
+		return
+	}
+	if _, e.err = e.w.Write(p); e.err == nil {
+		_, _ = e.crc.Write(p)
+	}
+}
+
+func (e *rdbEncoder) writeByte(b byte) {
+	e.writeRaw([]byte{b})
+}
+
+func (e *rdbEncoder) writeUint16(v uint16) {
+	binary.BigEndian.PutUint16(e.buf[:2], v)
+	e.writeRaw(e.buf[:2])
+}
+
+func (e *rdbEncoder) writeUint64(v uint64) {
+	binary.BigEndian.PutUint64(e.buf[:8], v)
+	e.writeRaw(e.buf[:8])
+}
+
+func (e *rdbEncoder) writeLen(n int) {
+	size := binary.PutUvarint(e.buf[:], uint64(n))
+	e.writeRaw(e.buf[:size])
+}
+
+func (e *rdbEncoder) writeString(s string) {
+	e.writeLen(len(s))
+	e.writeRaw([]byte(s))
+}
+
+func (e *rdbEncoder) writeValue(entry *db.Entry) error {
+	switch entry.Type {
+	case db.TypeString:
+		value, _ := entry.Value.(string)
+		e.writeString(value)
+	case db.TypeList:
+		list := entry.Value.(*ds.LinkedList)
+		items := list.Range(0, list.Len()-1)
+		e.writeLen(len(items))
+		for _, item := range items {
+			e.writeString(item)
+		}
+	case db.TypeSet:
+		set := entry.Value.(map[string]struct{})
+		members := make([]string, 0, len(set))
+		for member := range set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		e.writeLen(len(members))
+		for _, member := range members {
+			e.writeString(member)
+		}
+	case db.TypeZSet:
+		items := entry.Value.(*ds.SkipList).RangeByScore(math.Inf(-1), math.Inf(1))
+		e.writeLen(len(items))
+		for _, item := range items {
+			e.writeString(item.Member)
+			e.writeUint64(math.Float64bits(item.Score))
+		}
+	case db.TypeHash:
+		h := entry.Value.(map[string]string)
+		fields := make([]string, 0, len(h))
+		for field := range h {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		e.writeLen(len(fields))
+		for _, field := range fields {
+			e.writeString(field)
+			e.writeString(h[field])
+		}
+	case db.TypeStream:
+		e.writeStream(entry.Value.(*ds.Stream))
+	default:
+		return fmt.Errorf("rdb: unsupported value type %d", entry.Type)
+	}
+	return e.err
+}
+
+// writeStream 编码流：
+//
+//	entries{id fields} | lastID | groups{name lastID consumers{name seenTime} pending{id consumer deliveryTime count}}
+func (e *rdbEncoder) writeStream(s *ds.Stream) {
+	entries := s.Range(ds.StreamID{}, ds.MaxStreamID, 0, false)
+	e.writeLen(len(entries))
+	for _, entry := range entries {
+		e.writeStreamID(entry.ID)
+		e.writeLen(len(entry.Fields))
+		for _, field := range entry.Fields {
+			e.writeString(field)
+		}
+	}
+	e.writeStreamID(s.LastID())
+
+	groups := s.Groups()
+	e.writeLen(len(groups))
+	for _, g := range groups {
+		e.writeString(g.Name)
+		e.writeStreamID(g.LastID)
+		consumers := g.Consumers()
+		e.writeLen(len(consumers))
+		for _, c := range consumers {
+			e.writeString(c.Name)
+			e.writeUint64(uint64(c.SeenTime))
+		}
+		pending := g.Pending(ds.StreamID{}, ds.MaxStreamID, "", 0)
+		e.writeLen(len(pending))
+		for _, p := range pending {
+			e.writeStreamID(p.ID)
+			e.writeString(p.Consumer)
+			e.writeUint64(uint64(p.DeliveryTime))
+			e.writeUint64(uint64(p.DeliveryCount))
+		}
+	}
+}
+
+func (e *rdbEncoder) writeStreamID(id ds.StreamID) {
+	e.writeUint64(id.Ms)
+	e.writeUint64(id.Seq)
+}
+
+// rdbDecoder 记录首个错误，同时累计 CRC。
+type rdbDecoder struct {
+	r   *bufio.Reader
+	crc hash.Hash64
+	err error
+}
+
+func (d *rdbDecoder) readRaw(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, d.err = io.ReadFull(d.r, buf); d.err != nil {
+		return nil
+	}
+	_, _ = d.crc.Write(buf)
+	return buf
+}
+
+func (d *rdbDecoder) readByte() byte {
+	buf := d.readRaw(1)
+	if buf == nil {
+		return 0
+	}
+	return buf[0]
+}
+
+func (d *rdbDecoder) readUint16() uint16 {
+	buf := d.readRaw(2)
+	if buf == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(buf)
+}
+
+func (d *rdbDecoder) readUint64() uint64 {
+	buf := d.readRaw(8)
+	if buf == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(buf)
+}
+
+func (d *rdbDecoder) readLen() int {
+	if d.err != nil {
+		return 0
+	}
+	var raw bytes.Buffer
+	value, err := binary.ReadUvarint(io.ByteReader(byteRecorder{r: d.r, buf: &raw}))
+	if err != nil {
+		d.err = err
+		return 0
+	}
+	_, _ = d.crc.Write(raw.Bytes())
+	if value > math.MaxInt32 {
+		d.err = fmt.Errorf("%w: length %d too large", ErrRDBFormat, value)
+		return 0
+	}
+	return int(value)
+}
+
+func (d *rdbDecoder) readString() string {
+	n := d.readLen()
+	return string(d.readRaw(n))
+}
+
+func (d *rdbDecoder) readValue(valueType db.ValueType) any {
+	switch valueType {
+	case db.TypeString:
+		return d.readString()
+	case db.TypeList:
+		list := &ds.LinkedList{}
+		for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+			list.RPush(d.readString())
+		}
+		return list
+	case db.TypeSet:
+		n := d.readLen()
+		set := make(map[string]struct{}, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			set[d.readString()] = struct{}{}
+		}
+		return set
+	case db.TypeZSet:
+		z := ds.NewSkipList()
+		for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+			member := d.readString()
+			z.Insert(member, math.Float64frombits(d.readUint64()))
+		}
+		return z
+	case db.TypeHash:
+		n := d.readLen()
+		h := make(map[string]string, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			field := d.readString()
+			h[field] = d.readString()
+		}
+		return h
+	case db.TypeStream:
+		return d.readStream()
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("%w: unknown value type %d", ErrRDBFormat, valueType)
+		}
+		return nil
+	}
+}
+
+func (d *rdbDecoder) readStream() *ds.Stream {
+	s := ds.NewStream()
+	for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+		id := d.readStreamID()
+		fields := make([]string, d.readLen())
+		for j := range fields {
+			fields[j] = d.readString()
+		}
+		if d.err == nil && !s.Add(id, fields) {
+			d.err = fmt.Errorf("%w: stream ids out of order", ErrRDBFormat)
+		}
+	}
+	if lastID := d.readStreamID(); d.err == nil && !s.SetLastID(lastID) {
+		d.err = fmt.Errorf("%w: stream last id too small", ErrRDBFormat)
+	}
+
+	for i, n := 0, d.readLen(); i < n && d.err == nil; i++ {
+		name := d.readString()
+		g := s.CreateGroup(name, d.readStreamID())
+		if g == nil {
+			d.err = fmt.Errorf("%w: duplicate consumer group %q", ErrRDBFormat, name)
+			break
+		}
+		for j, m := 0, d.readLen(); j < m && d.err == nil; j++ {
+			consumer := d.readString()
+			g.RestoreConsumer(consumer, int64(d.readUint64()))
+		}
+		for j, m := 0, d.readLen(); j < m && d.err == nil; j++ {
+			p := ds.StreamPending{ID: d.readStreamID(), Consumer: d.readString()}
+			p.DeliveryTime = int64(d.readUint64())
+			p.DeliveryCount = int64(d.readUint64())
+			if d.err == nil {
+				g.RestorePending(p)
+			}
+		}
+	}
+	return s
+}
+
+func (d *rdbDecoder) readStreamID() ds.StreamID {
+	ms := d.readUint64()
+	return ds.StreamID{Ms: ms, Seq: d.readUint64()}
+}
+
+// byteRecorder 在读取 uvarint 时记录原始字节，用于累计 CRC。
+type byteRecorder struct {
+	r   *bufio.Reader
+	buf *bytes.Buffer
+}
+
+func (b byteRecorder) ReadByte() (byte, error) {
+	c, err := b.r.ReadByte()
+	if err == nil {
+		b.buf.WriteByte(c)
 	}
-	return snapshot, nil
+	return c, err
 }
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -17,66 +19,91 @@ const (
 	Integer      RESPType = ':'
 	BulkString   RESPType = '$'
 	Array        RESPType = '*'
+
+	// RESP3 新增类型。
+	Null           RESPType = '_'
+	Boolean        RESPType = '#'
+	Double         RESPType = ','
+	BigNumber      RESPType = '('
+	BulkError      RESPType = '!'
+	VerbatimString RESPType = '='
+	Map            RESPType = '%'
+	Set            RESPType = '~'
+	Push           RESPType = '>'
+
+	// NullArray 不是线上的类型前缀，只用于构造回复：RESP2 下编码为空数组 *-1，RESP3 下与 Null 相同。
+	// EXEC 被 WATCH 打断、阻塞命令超时等 Redis 回复空数组的场景使用它。
+	NullArray RESPType = 'N'
 )
 
-// Value RESP 值。
+// Value RESP 值。Map 的键值按 k1 v1 k2 v2 顺序平铺在 Array 中。
 type Value struct {
-	Type  RESPType
-	Str   string
-	Num   int64
-	Array []Value
+	Type   RESPType
+	Str    string
+	Num    int64
+	Double float64
+	Bool   bool
+	Array  []Value
 }
 
-// Parse 解析 RESP。
+// Parse 解析 RESP2/RESP3，空 bulk string 与空数组（长度 -1）解析为 Null。
 func Parse(reader *bufio.Reader) (*Value, error) {
 	prefix, err := reader.ReadByte()
 	if err != nil {
 		return nil, err
 	}
+	valueType := RESPType(prefix)
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
 
-	switch RESPType(prefix) {
-	case SimpleString, ErrorType:
-		line, readErr := reader.ReadString('\n')
-		if readErr != nil {
-			return nil, readErr
-		}
-		return &Value{Type: RESPType(prefix), Str: strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")}, nil
+	switch valueType {
+	case SimpleString, ErrorType, BigNumber:
+		return &Value{Type: valueType, Str: line}, nil
 	case Integer:
-		line, readErr := reader.ReadString('\n')
-		if readErr != nil {
-			return nil, readErr
-		}
-		n, parseErr := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+		n, parseErr := strconv.ParseInt(line, 10, 64)
 		if parseErr != nil {
 			return nil, parseErr
 		}
 		return &Value{Type: Integer, Num: n}, nil
-	case BulkString:
-		line, readErr := reader.ReadString('\n')
-		if readErr != nil {
-			return nil, readErr
+	case Null:
+		return &Value{Type: Null}, nil
+	case Boolean:
+		if line != "t" && line != "f" {
+			return nil, fmt.Errorf("invalid boolean %q", line)
+		}
+		return &Value{Type: Boolean, Bool: line == "t"}, nil
+	case Double:
+		f, parseErr := parseDouble(line)
+		if parseErr != nil {
+			return nil, parseErr
 		}
-		length, parseErr := strconv.Atoi(strings.TrimSpace(line))
+		return &Value{Type: Double, Double: f}, nil
+	case BulkString, BulkError, VerbatimString:
+		length, parseErr := strconv.Atoi(line)
 		if parseErr != nil {
 			return nil, parseErr
 		}
 		if length < 0 {
-			return &Value{Type: BulkString, Str: ""}, nil
+			return &Value{Type: Null}, nil
 		}
 		buf := make([]byte, length+2)
-		if _, readErr = reader.Read(buf); readErr != nil {
-			return nil, readErr
-		}
-		return &Value{Type: BulkString, Str: string(buf[:length])}, nil
-	case Array:
-		line, readErr := reader.ReadString('\n')
-		if readErr != nil {
+		if _, readErr := io.ReadFull(reader, buf); readErr != nil {
 			return nil, readErr
 		}
-		count, parseErr := strconv.Atoi(strings.TrimSpace(line))
+		return &Value{Type: valueType, Str: string(buf[:length])}, nil
+	case Array, Set, Push, Map:
+		count, parseErr := strconv.Atoi(line)
 		if parseErr != nil {
 			return nil, parseErr
 		}
+		if count < 0 {
+			return &Value{Type: Null}, nil
+		}
+		if valueType == Map {
+			count *= 2
+		}
 		items := make([]Value, 0, count)
 		for i := 0; i < count; i++ {
 			item, itemErr := Parse(reader)
@@ -85,35 +112,169 @@ func Parse(reader *bufio.Reader) (*Value, error) {
 			}
 			items = append(items, *item)
 		}
-		return &Value{Type: Array, Array: items}, nil
+		return &Value{Type: valueType, Array: items}, nil
 	default:
 		return nil, errors.New("unsupported resp type")
 	}
 }
 
-// Serialize 序列化 RESP。
+// Serialize 按值自身的类型序列化，nil 视为 RESP2 空 bulk string。
 func Serialize(value *Value) []byte {
+	return Encode(value, 3)
+}
+
+// Encode 按连接协商的协议版本序列化。proto 小于 3 时 RESP3 类型降级为 RESP2 等价表示：
+// Map/Set/Push 转为数组，Double/BigNumber/VerbatimString 转为 bulk string，Boolean 转为 0/1 整数，
+// Null 转为空 bulk string，NullArray 转为空数组，VerbatimString 去掉格式前缀。
+func Encode(value *Value, proto int) []byte {
 	if value == nil {
 		return []byte("$-1\r\n")
 	}
+	var buf bytes.Buffer
+	writeValue(&buf, value, proto >= 3)
+	return buf.Bytes()
+}
 
+// FormatDouble 按 Redis 风格格式化浮点数：整数不带小数部分，无穷大为 inf/-inf。
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.FormatInt(int64(f), 10)
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, value *Value, resp3 bool) {
 	switch value.Type {
-	case SimpleString:
-		return []byte("+" + value.Str + "\r\n")
-	case ErrorType:
-		return []byte("-" + value.Str + "\r\n")
+	case SimpleString, ErrorType:
+		buf.WriteByte(byte(value.Type))
+		buf.WriteString(value.Str)
+		buf.WriteString("\r\n")
 	case Integer:
-		return []byte(fmt.Sprintf(":%d\r\n", value.Num))
+		buf.WriteString(":" + strconv.FormatInt(value.Num, 10) + "\r\n")
+	case Null:
+		if resp3 {
+			buf.WriteString("_\r\n")
+		} else {
+			buf.WriteString("$-1\r\n")
+		}
+	case NullArray:
+		if resp3 {
+			buf.WriteString("_\r\n")
+		} else {
+			buf.WriteString("*-1\r\n")
+		}
+	case Boolean:
+		switch {
+		case !resp3:
+			buf.WriteString(":" + strconv.FormatInt(boolToInt(value.Bool), 10) + "\r\n")
+		case value.Bool:
+			buf.WriteString("#t\r\n")
+		default:
+			buf.WriteString("#f\r\n")
+		}
+	case Double:
+		if resp3 {
+			buf.WriteString("," + FormatDouble(value.Double) + "\r\n")
+		} else {
+			writeBulk(buf, BulkString, FormatDouble(value.Double))
+		}
+	case BigNumber:
+		if resp3 {
+			buf.WriteString("(" + value.Str + "\r\n")
+		} else {
+			writeBulk(buf, BulkString, value.Str)
+		}
 	case BulkString:
-		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(value.Str), value.Str))
-	case Array:
-		buf := bytes.NewBufferString(fmt.Sprintf("*%d\r\n", len(value.Array)))
+		writeBulk(buf, BulkString, value.Str)
+	case BulkError:
+		if resp3 {
+			writeBulk(buf, BulkError, value.Str)
+		} else {
+			buf.WriteString("-" + value.Str + "\r\n")
+		}
+	case VerbatimString:
+		if resp3 {
+			writeBulk(buf, VerbatimString, value.Str)
+		} else if len(value.Str) >= 4 && value.Str[3] == ':' {
+			// RESP2 下去掉三字符格式前缀，只保留正文。
+			writeBulk(buf, BulkString, value.Str[4:])
+		} else {
+			writeBulk(buf, BulkString, value.Str)
+		}
+	case Array, Set, Push, Map:
+		count := len(value.Array)
+		prefix := value.Type
+		if value.Type == Map && resp3 {
+			count /= 2
+		}
+		if !resp3 {
+			prefix = Array
+		}
+		fmt.Fprintf(buf, "%c%d\r\n", prefix, count)
 		for i := range value.Array {
-			item := value.Array[i]
-			buf.Write(Serialize(&item))
+			writeValue(buf, &value.Array[i], resp3)
 		}
-		return buf.Bytes()
 	default:
-		return []byte("-ERR unsupported type\r\n")
+		buf.WriteString("-ERR unsupported type\r\n")
+	}
+}
+
+func writeBulk(buf *bytes.Buffer, prefix RESPType, s string) {
+	fmt.Fprintf(buf, "%c%d\r\n", prefix, len(s))
+	buf.WriteString(s)
+	buf.WriteString("\r\n")
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+func parseDouble(line string) (float64, error) {
+	switch line {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(line, 64)
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// CommandValue 将命令参数编码为 RESP bulk string 数组。
+func CommandValue(args []string) *Value {
+	items := make([]Value, 0, len(args))
+	for _, arg := range args {
+		items = append(items, Value{Type: BulkString, Str: arg})
+	}
+	return &Value{Type: Array, Array: items}
+}
+
+// CommandArgs 将 RESP 数组还原为命令参数。
+func CommandArgs(value *Value) ([]string, error) {
+	if value == nil || value.Type != Array {
+		return nil, errors.New("command must be array")
+	}
+	args := make([]string, 0, len(value.Array))
+	for _, item := range value.Array {
+		args = append(args, item.Str)
 	}
+	return args, nil
 }
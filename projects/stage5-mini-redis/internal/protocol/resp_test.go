@@ -3,6 +3,8 @@ package protocol
 import (
 	"bufio"
 	"bytes"
+	"math"
+	"reflect"
 	"testing"
 )
 
@@ -31,3 +33,54 @@ func BenchmarkRESPParse(b *testing.B) {
 		}
 	}
 }
+
+func TestRESP3RoundTrip(t *testing.T) {
+	value := MapValue(
+		*BulkStringValue("null"), *NullValue(),
+		*BulkStringValue("bool"), *BooleanValue(true),
+		*BulkStringValue("double"), *DoubleValue(math.Inf(-1)),
+		*BulkStringValue("set"), *SetValue(*IntegerValue(1), *DoubleValue(2.5)),
+		*BulkStringValue("push"), *PushValue(*BulkStringValue("message")),
+		*BulkStringValue("text"), *VerbatimValue("txt", "hello"),
+	)
+	encoded := Serialize(value)
+	want := "%6\r\n$4\r\nnull\r\n_\r\n$4\r\nbool\r\n#t\r\n$6\r\ndouble\r\n,-inf\r\n" +
+		"$3\r\nset\r\n~2\r\n:1\r\n,2.5\r\n$4\r\npush\r\n>1\r\n$7\r\nmessage\r\n$4\r\ntext\r\n=9\r\ntxt:hello\r\n"
+	if string(encoded) != want {
+		t.Fatalf("Serialize() = %q, want %q", encoded, want)
+	}
+	parsed, err := Parse(bufio.NewReader(bytes.NewReader(encoded)))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(parsed, value) {
+		t.Fatalf("Parse() = %+v, want %+v", parsed, value)
+	}
+}
+
+func TestEncodeDowngradesToRESP2(t *testing.T) {
+	value := ArrayValue(
+		*NullValue(),
+		*BooleanValue(false),
+		*DoubleValue(3),
+		*MapValue(*BulkStringValue("k"), *BulkStringValue("v")),
+		*VerbatimValue("txt", "info"),
+	)
+	want := "*5\r\n$-1\r\n:0\r\n$1\r\n3\r\n*2\r\n$1\r\nk\r\n$1\r\nv\r\n$4\r\ninfo\r\n"
+	if got := string(Encode(value, 2)); got != want {
+		t.Fatalf("Encode(v, 2) = %q, want %q", got, want)
+	}
+	if got := string(Encode(NullValue(), 2)); got != "$-1\r\n" {
+		t.Fatalf("Encode(null, 2) = %q", got)
+	}
+	if got := string(Encode(NullArrayValue(), 2)); got != "*-1\r\n" {
+		t.Fatalf("Encode(null array, 2) = %q", got)
+	}
+	if got := string(Encode(NullArrayValue(), 3)); got != "_\r\n" {
+		t.Fatalf("Encode(null array, 3) = %q", got)
+	}
+	parsed, err := Parse(bufio.NewReader(bytes.NewReader([]byte("*-1\r\n"))))
+	if err != nil || parsed.Type != Null {
+		t.Fatalf("Parse(null array) = %+v, %v", parsed, err)
+	}
+}
@@ -0,0 +1,94 @@
+package protocol
+
+// 常用回复的构造函数，命令实现统一通过它们生成类型化的回复。
+
+// OK 返回 +OK。
+func OK() *Value {
+	return &Value{Type: SimpleString, Str: "OK"}
+}
+
+// SimpleStringValue 返回简单字符串。
+func SimpleStringValue(s string) *Value {
+	return &Value{Type: SimpleString, Str: s}
+}
+
+// BulkStringValue 返回 bulk string。
+func BulkStringValue(s string) *Value {
+	return &Value{Type: BulkString, Str: s}
+}
+
+// IntegerValue 返回整数。
+func IntegerValue(n int64) *Value {
+	return &Value{Type: Integer, Num: n}
+}
+
+// NullValue 返回空值（RESP2 下为空 bulk string）。
+func NullValue() *Value {
+	return &Value{Type: Null}
+}
+
+// NullArrayValue 返回空数组（RESP2 下为 *-1，RESP3 下为 Null）。
+func NullArrayValue() *Value {
+	return &Value{Type: NullArray}
+}
+
+// DoubleValue 返回浮点数（RESP2 下为 bulk string）。
+func DoubleValue(f float64) *Value {
+	return &Value{Type: Double, Double: f}
+}
+
+// BooleanValue 返回布尔值（RESP2 下为 0/1 整数）。
+func BooleanValue(b bool) *Value {
+	return &Value{Type: Boolean, Bool: b}
+}
+
+// ErrorValue 返回错误。
+func ErrorValue(msg string) *Value {
+	return &Value{Type: ErrorType, Str: msg}
+}
+
+// VerbatimValue 返回带格式标记的原样字符串，format 为三个字符（如 txt）。
+func VerbatimValue(format, s string) *Value {
+	return &Value{Type: VerbatimString, Str: format + ":" + s}
+}
+
+// ArrayValue 返回数组。
+func ArrayValue(items ...Value) *Value {
+	if items == nil {
+		items = []Value{}
+	}
+	return &Value{Type: Array, Array: items}
+}
+
+// StringArray 将字符串切片编码为 bulk string 数组。
+func StringArray(items []string) *Value {
+	values := make([]Value, 0, len(items))
+	for _, item := range items {
+		values = append(values, Value{Type: BulkString, Str: item})
+	}
+	return &Value{Type: Array, Array: values}
+}
+
+// SetValue 返回集合（RESP2 下为数组）。
+func SetValue(items ...Value) *Value {
+	if items == nil {
+		items = []Value{}
+	}
+	return &Value{Type: Set, Array: items}
+}
+
+// MapValue 返回映射，参数按 k1 v1 k2 v2 顺序传入（RESP2 下为平铺数组）。
+func MapValue(pairs ...Value) *Value {
+	if pairs == nil {
+		pairs = []Value{}
+	}
+	return &Value{Type: Map, Array: pairs}
+}
+
+// PushValue 返回带外推送消息（RESP2 下为数组）。
+func PushValue(items ...Value) *Value {
+	if items == nil {
+		items = []Value{}
+	}
+	return &Value{Type: Push, Array: items}
+}
@@ -0,0 +1,249 @@
+package pubsub
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/glob"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// Subscriber 订阅者。Deliver 由发布方调用，必须非阻塞（通常写入订阅者自己的输出缓冲）。
+type Subscriber interface {
+	Deliver(message *protocol.Value)
+}
+
+type subscriptions struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *subscriptions) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// Hub 管理频道订阅与模式订阅，并把消息扇出给订阅者。
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[Subscriber]struct{}
+	patterns map[string]map[Subscriber]struct{}
+	subs     map[Subscriber]*subscriptions
+}
+
+// NewHub 创建结构。
+func NewHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[Subscriber]struct{}),
+		patterns: make(map[string]map[Subscriber]struct{}),
+		subs:     make(map[Subscriber]*subscriptions),
+	}
+}
+
+// Subscribe 订阅频道，返回订阅者当前的订阅总数（频道 + 模式）。
+func (h *Hub) Subscribe(sub Subscriber, channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := h.stateLocked(sub)
+	if _, ok := state.channels[channel]; !ok {
+		state.channels[channel] = struct{}{}
+		addSubscriber(h.channels, channel, sub)
+	}
+	return state.count()
+}
+
+// PSubscribe 订阅 glob 模式，返回订阅者当前的订阅总数。
+func (h *Hub) PSubscribe(sub Subscriber, pattern string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := h.stateLocked(sub)
+	if _, ok := state.patterns[pattern]; !ok {
+		state.patterns[pattern] = struct{}{}
+		addSubscriber(h.patterns, pattern, sub)
+	}
+	return state.count()
+}
+
+// Unsubscribe 退订频道，返回剩余订阅总数。
+func (h *Hub) Unsubscribe(sub Subscriber, channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.subs[sub]
+	if !ok {
+		return 0
+	}
+	if _, subscribed := state.channels[channel]; subscribed {
+		delete(state.channels, channel)
+		removeSubscriber(h.channels, channel, sub)
+	}
+	return h.releaseLocked(sub, state)
+}
+
+// PUnsubscribe 退订模式，返回剩余订阅总数。
+func (h *Hub) PUnsubscribe(sub Subscriber, pattern string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.subs[sub]
+	if !ok {
+		return 0
+	}
+	if _, subscribed := state.patterns[pattern]; subscribed {
+		delete(state.patterns, pattern)
+		removeSubscriber(h.patterns, pattern, sub)
+	}
+	return h.releaseLocked(sub, state)
+}
+
+// Channels 返回订阅者已订阅的频道（按字典序）。
+func (h *Hub) Channels(sub Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if state, ok := h.subs[sub]; ok {
+		return sortedKeys(state.channels)
+	}
+	return []string{}
+}
+
+// Patterns 返回订阅者已订阅的模式（按字典序）。
+func (h *Hub) Patterns(sub Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if state, ok := h.subs[sub]; ok {
+		return sortedKeys(state.patterns)
+	}
+	return []string{}
+}
+
+// Count 返回订阅者的订阅总数，大于 0 表示处于订阅模式。
+func (h *Hub) Count(sub Subscriber) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if state, ok := h.subs[sub]; ok {
+		return state.count()
+	}
+	return 0
+}
+
+// Remove 移除订阅者的全部订阅，连接断开时调用。
+func (h *Hub) Remove(sub Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.subs[sub]
+	if !ok {
+		return
+	}
+	for channel := range state.channels {
+		removeSubscriber(h.channels, channel, sub)
+	}
+	for pattern := range state.patterns {
+		removeSubscriber(h.patterns, pattern, sub)
+	}
+	delete(h.subs, sub)
+}
+
+// Publish 向频道发布消息，返回收到消息的订阅数（同一连接经频道与模式各计一次）。
+// 投递在锁外进行，慢订阅者不会阻塞其他发布者。
+func (h *Hub) Publish(channel, message string) int {
+	type delivery struct {
+		sub     Subscriber
+		message *protocol.Value
+	}
+	h.mu.RLock()
+	deliveries := make([]delivery, 0, len(h.channels[channel]))
+	if subs := h.channels[channel]; len(subs) > 0 {
+		msg := protocol.PushValue(*protocol.BulkStringValue("message"), *protocol.BulkStringValue(channel), *protocol.BulkStringValue(message))
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub: sub, message: msg})
+		}
+	}
+	for pattern, subs := range h.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		msg := protocol.PushValue(*protocol.BulkStringValue("pmessage"), *protocol.BulkStringValue(pattern), *protocol.BulkStringValue(channel), *protocol.BulkStringValue(message))
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub: sub, message: msg})
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, d := range deliveries {
+		d.sub.Deliver(d.message)
+	}
+	return len(deliveries)
+}
+
+// ActiveChannels 返回至少有一个订阅者且匹配 pattern 的频道，pattern 为空表示全部。
+func (h *Hub) ActiveChannels(pattern string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	channels := make([]string, 0, len(h.channels))
+	for channel := range h.channels {
+		if pattern == "" || glob.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub 返回频道的订阅者数量（不含模式订阅）。
+func (h *Hub) NumSub(channel string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.channels[channel])
+}
+
+// NumPat 返回所有连接的模式订阅总数。
+func (h *Hub) NumPat() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	total := 0
+	for _, subs := range h.patterns {
+		total += len(subs)
+	}
+	return total
+}
+
+func (h *Hub) stateLocked(sub Subscriber) *subscriptions {
+	state, ok := h.subs[sub]
+	if !ok {
+		state = &subscriptions{channels: make(map[string]struct{}), patterns: make(map[string]struct{})}
+		h.subs[sub] = state
+	}
+	return state
+}
+
+// releaseLocked 订阅者不再有任何订阅时释放其状态，返回剩余订阅数。
+func (h *Hub) releaseLocked(sub Subscriber, state *subscriptions) int {
+	count := state.count()
+	if count == 0 {
+		delete(h.subs, sub)
+	}
+	return count
+}
+
+func addSubscriber(index map[string]map[Subscriber]struct{}, name string, sub Subscriber) {
+	subs, ok := index[name]
+	if !ok {
+		subs = make(map[Subscriber]struct{})
+		index[name] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+func removeSubscriber(index map[string]map[Subscriber]struct{}, name string, sub Subscriber) {
+	subs := index[name]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(index, name)
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
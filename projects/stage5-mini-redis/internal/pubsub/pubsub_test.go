@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *recorder) Deliver(message *protocol.Value) {
+	parts := make([]string, 0, len(message.Array))
+	for _, item := range message.Array {
+		parts = append(parts, item.Str)
+	}
+	r.mu.Lock()
+	r.messages = append(r.messages, strings.Join(parts, " "))
+	r.mu.Unlock()
+}
+
+func TestHubPublishChannelsAndPatterns(t *testing.T) {
+	hub := NewHub()
+	a, b := &recorder{}, &recorder{}
+	if got := hub.Subscribe(a, "cache:user"); got != 1 {
+		t.Fatalf("Subscribe() = %d, want 1", got)
+	}
+	if got := hub.PSubscribe(a, "cache:*"); got != 2 {
+		t.Fatalf("PSubscribe() = %d, want 2", got)
+	}
+	hub.PSubscribe(b, "cache:u*")
+
+	if got := hub.Publish("cache:user", "42"); got != 3 {
+		t.Fatalf("Publish() receivers = %d, want 3", got)
+	}
+	if got := hub.Publish("other", "x"); got != 0 {
+		t.Fatalf("Publish() to empty channel = %d, want 0", got)
+	}
+	want := []string{"message cache:user 42", "pmessage cache:* cache:user 42"}
+	if strings.Join(a.messages, "|") != strings.Join(want, "|") {
+		t.Fatalf("subscriber a got %v, want %v", a.messages, want)
+	}
+	if len(b.messages) != 1 || b.messages[0] != "pmessage cache:u* cache:user 42" {
+		t.Fatalf("subscriber b got %v", b.messages)
+	}
+
+	if got := hub.ActiveChannels("cache:*"); len(got) != 1 || got[0] != "cache:user" {
+		t.Fatalf("ActiveChannels() = %v", got)
+	}
+	if hub.NumSub("cache:user") != 1 || hub.NumPat() != 2 {
+		t.Fatalf("NumSub/NumPat = %d/%d, want 1/2", hub.NumSub("cache:user"), hub.NumPat())
+	}
+
+	if got := hub.Unsubscribe(a, "cache:user"); got != 1 {
+		t.Fatalf("Unsubscribe() = %d, want 1", got)
+	}
+	hub.Remove(b)
+	if hub.NumPat() != 1 || hub.Count(b) != 0 || len(hub.ActiveChannels("")) != 0 {
+		t.Fatalf("state after removal: numpat=%d count(b)=%d", hub.NumPat(), hub.Count(b))
+	}
+	if got := hub.PUnsubscribe(a, "cache:*"); got != 0 || hub.Count(a) != 0 {
+		t.Fatalf("PUnsubscribe() = %d, want 0", got)
+	}
+}
@@ -3,6 +3,7 @@ package replication
 import "sync"
 
 // Backlog 复制积压缓冲区（环形）。
+// offset 以命令条数计，主从双方按同样规则递增，用于部分重同步定位。
 type Backlog struct {
 	mu       sync.Mutex
 	capacity int
@@ -30,20 +31,37 @@ func (b *Backlog) Append(command string) int64 {
 	return b.offset
 }
 
+// Offset 返回最新位点。
+func (b *Backlog) Offset() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.offset
+}
+
+// Reset 清空 backlog 并把位点对齐到 offset（从节点全量同步后使用）。
+func (b *Backlog) Reset(offset int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offset = offset
+	b.entries = b.entries[:0]
+}
+
 // EntriesSince 返回 offset 之后的命令。
 func (b *Backlog) EntriesSince(offset int64) []string {
+	entries, _ := b.Since(offset)
+	return entries
+}
+
+// Since 返回 offset 之后的命令；offset 已滑出环形缓冲区或超前时 ok 为 false。
+func (b *Backlog) Since(offset int64) ([]string, bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if offset >= b.offset {
-		return nil
-	}
-	result := make([]string, 0)
-	start := int(offset - (b.offset - int64(len(b.entries))))
-	if start < 0 {
-		start = 0
-	}
-	for i := start; i < len(b.entries); i++ {
-		result = append(result, b.entries[i])
+	first := b.offset - int64(len(b.entries))
+	if offset < first || offset > b.offset {
+		return nil, false
 	}
-	return result
+	start := int(offset - first)
+	result := make([]string, len(b.entries)-start)
+	copy(result, b.entries[start:])
+	return result, true
 }
@@ -1,17 +1,39 @@
 package replication
 
-import "sync"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// DefaultBacklogSize 默认 backlog 容量（命令条数）。
+const DefaultBacklogSize = 4096
 
 // Master 主节点复制管理。
+// replID2/replID2Offset 保存晋升前跟随的复制 ID，使原来的兄弟从节点可以部分重同步。
 type Master struct {
-	mu      sync.Mutex
-	backlog *Backlog
-	slaves  map[string]int64
+	mu            sync.Mutex
+	backlog       *Backlog
+	slaves        map[string]int64
+	replID        string
+	replID2       string
+	replID2Offset int64
+	notify        chan struct{}
 }
 
 // NewMaster 创建主节点复制管理器。
 func NewMaster() *Master {
-	return &Master{backlog: NewBacklog(4096), slaves: make(map[string]int64)}
+	return NewMasterWithBacklog(DefaultBacklogSize)
+}
+
+// NewMasterWithBacklog 以指定 backlog 容量创建主节点复制管理器。
+func NewMasterWithBacklog(capacity int) *Master {
+	return &Master{
+		backlog: NewBacklog(capacity),
+		slaves:  make(map[string]int64),
+		replID:  newReplID(),
+		notify:  make(chan struct{}),
+	}
 }
 
 // RegisterSlave 注册从节点。
@@ -21,12 +43,108 @@ func (m *Master) RegisterSlave(slaveID string) {
 	m.slaves[slaveID] = 0
 }
 
-// Broadcast 传播写命令。
+// UnregisterSlave 移除从节点。
+func (m *Master) UnregisterSlave(slaveID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.slaves, slaveID)
+}
+
+// Ack 记录从节点确认的复制位点。
+func (m *Master) Ack(slaveID string, offset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.slaves[slaveID]; ok && offset > m.slaves[slaveID] {
+		m.slaves[slaveID] = offset
+	}
+}
+
+// Slaves 返回从节点及其确认位点。
+func (m *Master) Slaves() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[string]int64, len(m.slaves))
+	for id, offset := range m.slaves {
+		result[id] = offset
+	}
+	return result
+}
+
+// ReplID 返回当前复制 ID。
+func (m *Master) ReplID() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.replID
+}
+
+// Offset 返回当前复制位点。
+func (m *Master) Offset() int64 {
+	return m.backlog.Offset()
+}
+
+// Broadcast 传播写命令并唤醒等待中的从节点发送协程。
 func (m *Master) Broadcast(command string) int64 {
-	return m.backlog.Append(command)
+	offset := m.backlog.Append(command)
+	m.mu.Lock()
+	close(m.notify)
+	m.notify = make(chan struct{})
+	m.mu.Unlock()
+	return offset
+}
+
+// Changed 返回在下一次 Broadcast 时关闭的通道。
+func (m *Master) Changed() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.notify
 }
 
 // PullSince 从指定 offset 拉取增量命令。
 func (m *Master) PullSince(offset int64) []string {
 	return m.backlog.EntriesSince(offset)
 }
+
+// Since 从指定 offset 拉取增量命令，offset 不在 backlog 中时 ok 为 false。
+func (m *Master) Since(offset int64) ([]string, bool) {
+	return m.backlog.Since(offset)
+}
+
+// CanPartialSync 判断 PSYNC replID offset 能否走部分重同步。
+func (m *Master) CanPartialSync(replID string, offset int64) bool {
+	m.mu.Lock()
+	matched := replID == m.replID || (m.replID2 != "" && replID == m.replID2 && offset <= m.replID2Offset)
+	m.mu.Unlock()
+	if !matched {
+		return false
+	}
+	_, ok := m.backlog.Since(offset)
+	return ok
+}
+
+// Follow 从节点完成全量同步后沿用主节点的复制 ID 与位点。
+func (m *Master) Follow(replID string, offset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replID = replID
+	m.replID2 = ""
+	m.replID2Offset = 0
+	m.backlog.Reset(offset)
+	// 唤醒发送协程，让级联从节点发现复制 ID 变化后重新同步。
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// Promote 从节点晋升为主节点：生成新复制 ID，旧 ID 保留为 replID2。
+func (m *Master) Promote() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replID2 = m.replID
+	m.replID2Offset = m.backlog.Offset()
+	m.replID = newReplID()
+}
+
+func newReplID() string {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -2,17 +2,37 @@ package replication
 
 import "sync"
 
+// LinkState 从节点与主节点的连接状态。
+type LinkState string
+
+const (
+	LinkConnecting LinkState = "connecting"
+	LinkSync       LinkState = "sync"
+	LinkConnected  LinkState = "connected"
+)
+
 // Slave 从节点复制状态。
 type Slave struct {
 	mu         sync.Mutex
 	masterHost string
 	masterPort int
 	offset     int64
+	state      LinkState
 }
 
 // NewSlave 创建从节点状态。
 func NewSlave(masterHost string, masterPort int) *Slave {
-	return &Slave{masterHost: masterHost, masterPort: masterPort}
+	return &Slave{masterHost: masterHost, masterPort: masterPort, state: LinkConnecting}
+}
+
+// MasterHost 返回主节点地址。
+func (s *Slave) MasterHost() string {
+	return s.masterHost
+}
+
+// MasterPort 返回主节点端口。
+func (s *Slave) MasterPort() int {
+	return s.masterPort
 }
 
 // Offset 返回当前复制位点。
@@ -30,3 +50,24 @@ func (s *Slave) Ack(offset int64) {
 		s.offset = offset
 	}
 }
+
+// Reset 全量同步后重置复制位点。
+func (s *Slave) Reset(offset int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = offset
+}
+
+// State 返回连接状态。
+func (s *Slave) State() LinkState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// SetState 更新连接状态。
+func (s *Slave) SetState(state LinkState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
@@ -0,0 +1,287 @@
+package sentinel
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// handleConn 服务一个客户端或其他哨兵的连接，只支持 RESP2。
+func (s *Sentinel) handleConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+		value, err := protocol.Parse(reader)
+		if err != nil {
+			if err != io.EOF && !strings.Contains(err.Error(), "closed") {
+				_, _ = writer.Write(protocol.Serialize(protocol.ErrorValue("ERR invalid protocol")))
+				_ = writer.Flush()
+			}
+			return
+		}
+		args, err := protocol.CommandArgs(value)
+		if err != nil || len(args) == 0 {
+			_, _ = writer.Write(protocol.Serialize(protocol.ErrorValue("ERR invalid command")))
+			continue
+		}
+		_, _ = writer.Write(protocol.Serialize(s.execute(args)))
+	}
+}
+
+func (s *Sentinel) execute(args []string) *protocol.Value {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		if len(args) > 1 {
+			return protocol.BulkStringValue(args[1])
+		}
+		return protocol.SimpleStringValue("PONG")
+	case "INFO":
+		return protocol.BulkStringValue(s.info())
+	case "SENTINEL":
+		if len(args) < 2 {
+			return wrongArgs("sentinel")
+		}
+		return s.sentinelCommand(strings.ToUpper(args[1]), args[2:])
+	}
+	return protocol.ErrorValue(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+}
+
+func wrongArgs(cmd string) *protocol.Value {
+	return protocol.ErrorValue(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd))
+}
+
+// sentinelCommand 处理 SENTINEL 子命令。
+func (s *Sentinel) sentinelCommand(sub string, args []string) *protocol.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch sub {
+	case "MYID":
+		return protocol.BulkStringValue(s.myID)
+	case "MASTERS":
+		items := make([]protocol.Value, 0, len(s.masters))
+		for _, m := range s.sortedMastersLocked() {
+			items = append(items, *protocol.StringArray(s.masterFieldsLocked(m)))
+		}
+		return protocol.ArrayValue(items...)
+	case "IS-MASTER-DOWN-BY-ADDR":
+		if len(args) != 4 {
+			return wrongArgs("sentinel is-master-down-by-addr")
+		}
+		return s.isMasterDownLocked(args)
+	}
+
+	if len(args) != 1 {
+		return wrongArgs("sentinel " + strings.ToLower(sub))
+	}
+	m, ok := s.masters[args[0]]
+	if !ok {
+		if sub == "GET-MASTER-ADDR-BY-NAME" {
+			return protocol.NullValue()
+		}
+		return protocol.ErrorValue("ERR " + ErrNoSuchMaster.Error())
+	}
+	switch sub {
+	case "MASTER":
+		return protocol.StringArray(s.masterFieldsLocked(m))
+	case "REPLICAS", "SLAVES":
+		return instanceList(m.replicas, replicaFields)
+	case "SENTINELS":
+		return instanceList(m.sentinels, sentinelFields)
+	case "GET-MASTER-ADDR-BY-NAME":
+		addr := m.currentAddr()
+		return protocol.StringArray([]string{addr.host, strconv.Itoa(addr.port)})
+	case "CKQUORUM":
+		return s.ckquorumLocked(m)
+	case "FAILOVER":
+		if m.failover != failoverNone {
+			return protocol.ErrorValue("INPROG Failover already in progress")
+		}
+		if s.selectReplicaLocked(m, time.Now()) == nil {
+			return protocol.ErrorValue("NOGOODSLAVE No suitable replica to promote")
+		}
+		s.startFailoverLocked(m, time.Now(), true)
+		return protocol.OK()
+	}
+	return protocol.ErrorValue(fmt.Sprintf("ERR unknown sentinel subcommand '%s'", strings.ToLower(sub)))
+}
+
+// isMasterDownLocked 回复 [本哨兵是否认为该地址的主节点主观下线, 投票的领头哨兵, 投票纪元]；
+// run id 为 * 时只询问状态，否则是在为该哨兵拉票。
+func (s *Sentinel) isMasterDownLocked(args []string) *protocol.Value {
+	port, err1 := strconv.Atoi(args[1])
+	epoch, err2 := strconv.ParseUint(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return protocol.ErrorValue("ERR value is not an integer or out of range")
+	}
+	var down int64
+	leader, leaderEpoch := "*", uint64(0)
+	for _, m := range s.masters {
+		if m.inst.host != args[0] || m.inst.port != port {
+			continue
+		}
+		if !m.inst.sdownSince.IsZero() {
+			down = 1
+		}
+		if args[3] != "*" {
+			leader, leaderEpoch = s.voteLeaderLocked(m, epoch, args[3], time.Now())
+		}
+		break
+	}
+	return protocol.ArrayValue(
+		*protocol.IntegerValue(down),
+		*protocol.BulkStringValue(leader),
+		*protocol.IntegerValue(int64(leaderEpoch)),
+	)
+}
+
+// ckquorumLocked 检查当前可达的哨兵是否足以判定客观下线并授权故障转移。
+func (s *Sentinel) ckquorumLocked(m *master) *protocol.Value {
+	usable := 1
+	for _, peer := range m.sentinels {
+		if peer.sdownSince.IsZero() {
+			usable++
+		}
+	}
+	voters := len(m.sentinels) + 1
+	switch {
+	case usable < m.quorum:
+		return protocol.ErrorValue(fmt.Sprintf("NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the specified quorum for this master", usable))
+	case usable < voters/2+1:
+		return protocol.ErrorValue(fmt.Sprintf("NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the majority and authorize a failover", usable))
+	}
+	return protocol.SimpleStringValue(fmt.Sprintf("OK %d usable Sentinels. Quorum and failover authorization can be reached", usable))
+}
+
+func (s *Sentinel) sortedMastersLocked() []*master {
+	masters := make([]*master, 0, len(s.masters))
+	for _, m := range s.masters {
+		masters = append(masters, m)
+	}
+	sort.Slice(masters, func(i, j int) bool { return masters[i].name < masters[j].name })
+	return masters
+}
+
+func (s *Sentinel) masterFieldsLocked(m *master) []string {
+	flags := m.inst.flags()
+	if !m.odownSince.IsZero() {
+		flags += ",o_down"
+	}
+	if m.failover != failoverNone {
+		flags += ",failover_in_progress"
+	}
+	fields := []string{
+		"name", m.name,
+		"ip", m.inst.host,
+		"port", strconv.Itoa(m.inst.port),
+		"runid", m.inst.runID,
+		"flags", flags,
+		"last-ok-ping-reply", millisSince(m.inst.lastOK),
+		"info-refresh", millisSince(m.inst.infoRefresh),
+		"down-after-milliseconds", strconv.FormatInt(s.timing.DownAfter.Milliseconds(), 10),
+		"config-epoch", strconv.FormatUint(m.configEpoch, 10),
+		"num-slaves", strconv.Itoa(len(m.replicas)),
+		"num-other-sentinels", strconv.Itoa(len(m.sentinels)),
+		"quorum", strconv.Itoa(m.quorum),
+		"failover-timeout", strconv.FormatInt(s.timing.FailoverTimeout.Milliseconds(), 10),
+	}
+	if m.failover != failoverNone {
+		fields = append(fields, "failover-state", m.failover.String())
+	}
+	return fields
+}
+
+func replicaFields(inst *instance) []string {
+	linkStatus := "err"
+	if inst.masterLinkUp {
+		linkStatus = "ok"
+	}
+	return []string{
+		"name", inst.addr,
+		"ip", inst.host,
+		"port", strconv.Itoa(inst.port),
+		"runid", inst.runID,
+		"flags", inst.flags(),
+		"last-ok-ping-reply", millisSince(inst.lastOK),
+		"info-refresh", millisSince(inst.infoRefresh),
+		"master-link-status", linkStatus,
+		"master-host", inst.masterHost,
+		"master-port", strconv.Itoa(inst.masterPort),
+		"slave-repl-offset", strconv.FormatInt(inst.offset, 10),
+	}
+}
+
+func sentinelFields(inst *instance) []string {
+	return []string{
+		"name", inst.runID,
+		"ip", inst.host,
+		"port", strconv.Itoa(inst.port),
+		"runid", inst.runID,
+		"flags", inst.flags(),
+		"last-ok-ping-reply", millisSince(inst.lastOK),
+		"last-hello-message", millisSince(inst.lastHello),
+		"voted-leader", cmp.Or(inst.leader, "?"),
+		"voted-leader-epoch", strconv.FormatUint(inst.leaderEpoch, 10),
+	}
+}
+
+func instanceList(instances map[string]*instance, fields func(*instance) []string) *protocol.Value {
+	keys := make([]string, 0, len(instances))
+	for key := range instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	items := make([]protocol.Value, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, *protocol.StringArray(fields(instances[key])))
+	}
+	return protocol.ArrayValue(items...)
+}
+
+func millisSince(t time.Time) string {
+	if t.IsZero() {
+		return "-1"
+	}
+	return strconv.FormatInt(time.Since(t).Milliseconds(), 10)
+}
+
+// info 生成 INFO 输出：Server 节与 Sentinel 节。
+func (s *Sentinel) info() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	b.WriteString("redis_mode:sentinel\r\n")
+	fmt.Fprintf(&b, "run_id:%s\r\n", s.myID)
+	fmt.Fprintf(&b, "tcp_port:%d\r\n", s.announcePort)
+	b.WriteString("\r\n# Sentinel\r\n")
+	fmt.Fprintf(&b, "sentinel_masters:%d\r\n", len(s.masters))
+	fmt.Fprintf(&b, "sentinel_current_epoch:%d\r\n", s.currentEpoch)
+	for i, m := range s.sortedMastersLocked() {
+		status := "ok"
+		switch {
+		case !m.odownSince.IsZero():
+			status = "odown"
+		case !m.inst.sdownSince.IsZero():
+			status = "sdown"
+		}
+		addr := m.currentAddr()
+		fmt.Fprintf(&b, "master%d:name=%s,status=%s,address=%s,slaves=%d,sentinels=%d\r\n",
+			i, m.name, status, addr.addr, len(m.replicas), len(m.sentinels)+1)
+	}
+	return b.String()
+}
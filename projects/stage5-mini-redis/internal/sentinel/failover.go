@@ -0,0 +1,476 @@
+package sentinel
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// maxDesync 进入客观下线后发起选举前的最大随机等待，降低多个哨兵同时竞选导致选票分散的概率。
+const maxDesync = time.Second
+
+type instanceKind int
+
+const (
+	kindMaster instanceKind = iota
+	kindReplica
+	kindSentinel
+)
+
+// instance 被监视的节点：主节点、从节点或其他哨兵。除 link 外的字段由 Sentinel.mu 保护。
+type instance struct {
+	kind    instanceKind
+	addr    string
+	host    string
+	port    int
+	runID   string
+	link    *link
+	cancel  context.CancelFunc
+	removed bool
+
+	// lastOK 为最近一次有效 PING 回复的时间；pingSent 为最早一个尚未得到回复的 PING 的发送时间，
+	// 它超过 DownAfter 即主观下线，sdownSince 非零表示处于主观下线。
+	lastOK     time.Time
+	pingSent   time.Time
+	sdownSince time.Time
+
+	// 以下来自主从节点的 INFO。
+	infoRefresh  time.Time
+	role         string
+	roleReported time.Time
+	masterHost   string
+	masterPort   int
+	masterLinkUp bool
+	confChanged  time.Time
+	offset       int64
+	// reconfSent 表示故障转移时已向该从节点发送 REPLICAOF 新主节点。
+	reconfSent bool
+
+	// 以下用于其他哨兵：对主节点状态的判断与在某个纪元投出的票。
+	lastHello   time.Time
+	asking      bool
+	lastAsk     time.Time
+	lastReply   time.Time
+	masterDown  bool
+	leader      string
+	leaderEpoch uint64
+}
+
+func (inst *instance) flags() string {
+	flags := [...]string{kindMaster: "master", kindReplica: "slave", kindSentinel: "sentinel"}[inst.kind]
+	if !inst.sdownSince.IsZero() {
+		flags += ",s_down"
+	}
+	return flags
+}
+
+type failoverState int
+
+const (
+	failoverNone failoverState = iota
+	failoverWaitStart
+	failoverSelectSlave
+	failoverSendSlaveofNoOne
+	failoverWaitPromotion
+	failoverReconfSlaves
+	failoverUpdateConfig
+)
+
+var failoverStateNames = [...]string{
+	failoverNone:             "none",
+	failoverWaitStart:        "wait_start",
+	failoverSelectSlave:      "select_slave",
+	failoverSendSlaveofNoOne: "send_slaveof_noone",
+	failoverWaitPromotion:    "wait_promotion",
+	failoverReconfSlaves:     "reconf_slaves",
+	failoverUpdateConfig:     "update_config",
+}
+
+func (st failoverState) String() string {
+	return failoverStateNames[st]
+}
+
+// master 一个被监视的主节点及其从节点、其他哨兵与故障转移状态，由 Sentinel.mu 保护。
+type master struct {
+	name      string
+	quorum    int
+	inst      *instance
+	replicas  map[string]*instance // 按地址
+	sentinels map[string]*instance // 按 run id
+	// configEpoch 为当前主节点配置产生时的纪元，hello 中更大的配置纪元会覆盖本地配置。
+	configEpoch uint64
+	// leader/leaderEpoch 为本哨兵在 leaderEpoch 纪元投票选出的领头哨兵，每个纪元只投一次。
+	leader      string
+	leaderEpoch uint64
+
+	odownSince    time.Time
+	failoverDelay time.Duration
+
+	failover       failoverState
+	failoverEpoch  uint64
+	failoverStart  time.Time
+	stateChanged   time.Time
+	forcedFailover bool
+	promoted       *instance
+}
+
+// currentAddr 故障转移进入重配从节点阶段后，新主节点即为晋升的从节点。
+func (m *master) currentAddr() *instance {
+	if m.failover >= failoverReconfSlaves && m.promoted != nil {
+		return m.promoted
+	}
+	return m.inst
+}
+
+// runMaster 以 10Hz 驱动主节点的下线判断与故障转移状态机，直到 ctx 取消。
+func (s *Sentinel) runMaster(ctx context.Context, m *master) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		now := time.Now()
+		s.checkSubjectivelyDownLocked(m, m.inst, now)
+		for _, inst := range m.replicas {
+			s.checkSubjectivelyDownLocked(m, inst, now)
+		}
+		for _, inst := range m.sentinels {
+			s.checkSubjectivelyDownLocked(m, inst, now)
+		}
+		s.checkObjectivelyDownLocked(m, now)
+		force := false
+		if s.shouldStartFailoverLocked(m, now) {
+			s.startFailoverLocked(m, now, false)
+			force = true
+		}
+		s.failoverStepLocked(ctx, m, now)
+		asks := s.peersToAskLocked(m, now, force)
+		s.mu.Unlock()
+		for _, ask := range asks {
+			go s.askPeer(ctx, ask.peer, ask.args)
+		}
+	}
+}
+
+func (s *Sentinel) checkSubjectivelyDownLocked(m *master, inst *instance, now time.Time) {
+	down := !inst.pingSent.IsZero() && now.Sub(inst.pingSent) > s.timing.DownAfter
+	switch {
+	case down && inst.sdownSince.IsZero():
+		inst.sdownSince = now
+		s.logger.Warn("+sdown", "master", m.name, "instance", inst.addr, "type", inst.flags())
+	case !down && !inst.sdownSince.IsZero():
+		inst.sdownSince = time.Time{}
+		s.logger.Info("-sdown", "master", m.name, "instance", inst.addr)
+	}
+}
+
+// checkObjectivelyDownLocked 本哨兵认为主观下线且连同其他哨兵达到 quorum 时，主节点客观下线。
+func (s *Sentinel) checkObjectivelyDownLocked(m *master, now time.Time) {
+	votes := 0
+	if !m.inst.sdownSince.IsZero() {
+		votes = 1
+		for _, peer := range m.sentinels {
+			if peer.masterDown {
+				votes++
+			}
+		}
+	}
+	odown := votes >= m.quorum
+	switch {
+	case odown && m.odownSince.IsZero():
+		m.odownSince = now
+		m.failoverDelay = rand.N(min(maxDesync, s.timing.DownAfter))
+		s.logger.Warn("+odown", "master", m.name, "instance", m.inst.addr, "quorum", strconv.Itoa(votes)+"/"+strconv.Itoa(m.quorum))
+	case !odown && !m.odownSince.IsZero():
+		m.odownSince = time.Time{}
+		s.logger.Info("-odown", "master", m.name, "instance", m.inst.addr)
+	}
+}
+
+// shouldStartFailoverLocked 客观下线并等过随机延迟后发起故障转移；上次尝试（或投票给他人）
+// 之后的两倍 failover 超时内不再发起。
+func (s *Sentinel) shouldStartFailoverLocked(m *master, now time.Time) bool {
+	if m.odownSince.IsZero() || m.failover != failoverNone || now.Sub(m.odownSince) < m.failoverDelay {
+		return false
+	}
+	return m.failoverStart.IsZero() || now.Sub(m.failoverStart) >= 2*s.timing.FailoverTimeout
+}
+
+func (s *Sentinel) startFailoverLocked(m *master, now time.Time, forced bool) {
+	s.currentEpoch++
+	m.failover = failoverWaitStart
+	m.failoverEpoch = s.currentEpoch
+	m.failoverStart = now
+	m.stateChanged = now
+	m.forcedFailover = forced
+	m.promoted = nil
+	s.logger.Warn("+try-failover", "master", m.name, "instance", m.inst.addr, "epoch", m.failoverEpoch)
+}
+
+func (s *Sentinel) setFailoverStateLocked(m *master, state failoverState, now time.Time) {
+	m.failover = state
+	m.stateChanged = now
+}
+
+func (s *Sentinel) abortFailoverLocked(m *master, reason string) {
+	s.logger.Warn("-failover-abort-"+reason, "master", m.name, "instance", m.inst.addr)
+	m.failover = failoverNone
+	m.forcedFailover = false
+	m.promoted = nil
+}
+
+// failoverStepLocked 推进故障转移状态机；发往节点的命令异步执行，结果通过后续 INFO 观察。
+func (s *Sentinel) failoverStepLocked(ctx context.Context, m *master, now time.Time) {
+	switch m.failover {
+	case failoverWaitStart:
+		leader := s.myID
+		if !m.forcedFailover {
+			leader = s.leaderLocked(m, m.failoverEpoch)
+		}
+		if leader != s.myID {
+			if now.Sub(m.failoverStart) > min(10*time.Second, s.timing.FailoverTimeout) {
+				s.abortFailoverLocked(m, "not-elected")
+			}
+			return
+		}
+		s.logger.Warn("+elected-leader", "master", m.name, "epoch", m.failoverEpoch)
+		s.setFailoverStateLocked(m, failoverSelectSlave, now)
+		fallthrough
+	case failoverSelectSlave:
+		promoted := s.selectReplicaLocked(m, now)
+		if promoted == nil {
+			s.abortFailoverLocked(m, "no-good-slave")
+			return
+		}
+		m.promoted = promoted
+		s.logger.Warn("+selected-slave", "master", m.name, "replica", promoted.addr, "offset", promoted.offset)
+		s.setFailoverStateLocked(m, failoverSendSlaveofNoOne, now)
+		fallthrough
+	case failoverSendSlaveofNoOne:
+		if !m.promoted.sdownSince.IsZero() {
+			if now.Sub(m.stateChanged) > s.timing.FailoverTimeout {
+				s.abortFailoverLocked(m, "slave-timeout")
+			}
+			return
+		}
+		s.logger.Warn("+failover-state-send-slaveof-noone", "master", m.name, "replica", m.promoted.addr)
+		go s.replicaOf(ctx, m.promoted, "", 0)
+		s.setFailoverStateLocked(m, failoverWaitPromotion, now)
+	case failoverWaitPromotion:
+		// 等到晋升的从节点在 INFO 中报告自己已是主节点，新配置才生效。
+		if m.promoted.role == "master" && m.promoted.roleReported.After(m.stateChanged) {
+			m.configEpoch = m.failoverEpoch
+			s.logger.Warn("+promoted-slave", "master", m.name, "replica", m.promoted.addr, "config_epoch", m.configEpoch)
+			s.setFailoverStateLocked(m, failoverReconfSlaves, now)
+			return
+		}
+		if now.Sub(m.stateChanged) > s.timing.FailoverTimeout {
+			s.abortFailoverLocked(m, "slave-timeout")
+		}
+	case failoverReconfSlaves:
+		if s.reconfReplicasLocked(ctx, m) || now.Sub(m.stateChanged) > s.timing.FailoverTimeout {
+			s.setFailoverStateLocked(m, failoverUpdateConfig, now)
+		}
+	case failoverUpdateConfig:
+		s.logger.Warn("+failover-end", "master", m.name, "replica", m.promoted.addr)
+		s.switchMasterLocked(m, m.promoted.host, m.promoted.port)
+	}
+}
+
+// reconfReplicasLocked 让其余从节点改为复制晋升的节点，全部完成（或已下线）时返回 true。
+func (s *Sentinel) reconfReplicasLocked(ctx context.Context, m *master) bool {
+	done := true
+	for _, inst := range m.replicas {
+		if inst == m.promoted || !inst.sdownSince.IsZero() {
+			continue
+		}
+		if inst.masterHost == m.promoted.host && inst.masterPort == m.promoted.port && inst.masterLinkUp {
+			continue
+		}
+		done = false
+		if !inst.reconfSent {
+			inst.reconfSent = true
+			s.logger.Info("+slave-reconf-sent", "master", m.name, "replica", inst.addr)
+			go s.replicaOf(ctx, inst, m.promoted.host, m.promoted.port)
+		}
+	}
+	return done
+}
+
+// selectReplicaLocked 在在线、INFO 新鲜且仍以从节点身份复制的节点中，选复制偏移最大者，
+// 偏移相同时选 run id 较小者。
+func (s *Sentinel) selectReplicaLocked(m *master, now time.Time) *instance {
+	var candidates []*instance
+	for _, inst := range m.replicas {
+		if !inst.sdownSince.IsZero() || inst.role != "slave" {
+			continue
+		}
+		if now.Sub(inst.lastOK) > 5*s.timing.PingPeriod || now.Sub(inst.infoRefresh) > 5*s.infoPeriodLocked(m, inst) {
+			continue
+		}
+		candidates = append(candidates, inst)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].offset != candidates[j].offset {
+			return candidates[i].offset > candidates[j].offset
+		}
+		return candidates[i].runID < candidates[j].runID
+	})
+	return candidates[0]
+}
+
+// switchMasterLocked 把主节点切换到 host:port：原主节点与其余从节点都作为新主节点的从节点继续监视。
+func (s *Sentinel) switchMasterLocked(m *master, host string, port int) {
+	old := m.inst
+	newAddr := net.JoinHostPort(host, strconv.Itoa(port))
+	var replicaAddrs []string
+	for addr, inst := range m.replicas {
+		if addr != newAddr {
+			replicaAddrs = append(replicaAddrs, addr)
+		}
+		releaseInstance(inst)
+	}
+	if old.addr != newAddr {
+		replicaAddrs = append(replicaAddrs, old.addr)
+	}
+	releaseInstance(old)
+
+	m.inst = s.addInstanceLocked(m, kindMaster, host, port)
+	m.replicas = make(map[string]*instance, len(replicaAddrs))
+	for _, addr := range replicaAddrs {
+		h, portText, _ := net.SplitHostPort(addr)
+		p, _ := strconv.Atoi(portText)
+		m.replicas[addr] = s.addInstanceLocked(m, kindReplica, h, p)
+	}
+	m.odownSince = time.Time{}
+	m.failover = failoverNone
+	m.forcedFailover = false
+	m.promoted = nil
+	for _, peer := range m.sentinels {
+		peer.masterDown = false
+	}
+	s.logger.Warn("+switch-master", "master", m.name, "from", old.addr, "to", newAddr)
+}
+
+// voteLeaderLocked 处理 reqRunID 在 reqEpoch 纪元的拉票：每个纪元只投给最先请求的哨兵。
+// 投给其他哨兵后推迟本哨兵自己的故障转移，返回本哨兵当前的投票。
+func (s *Sentinel) voteLeaderLocked(m *master, reqEpoch uint64, reqRunID string, now time.Time) (string, uint64) {
+	if reqEpoch > s.currentEpoch {
+		s.currentEpoch = reqEpoch
+		s.logger.Info("+new-epoch", "epoch", reqEpoch)
+	}
+	if m.leaderEpoch < reqEpoch && s.currentEpoch <= reqEpoch {
+		m.leader, m.leaderEpoch = reqRunID, s.currentEpoch
+		s.logger.Info("+vote-for-leader", "master", m.name, "leader", reqRunID, "epoch", m.leaderEpoch)
+		if reqRunID != s.myID {
+			m.failoverStart = now.Add(rand.N(maxDesync))
+		}
+	}
+	return m.leader, m.leaderEpoch
+}
+
+// leaderLocked 统计 epoch 纪元的选票：本哨兵投给得票最多者（没有时投给自己），
+// 得票同时达到已知哨兵的多数与 quorum 才当选，否则返回空串。
+func (s *Sentinel) leaderLocked(m *master, epoch uint64) string {
+	votes := make(map[string]int)
+	for _, peer := range m.sentinels {
+		if peer.leader != "" && peer.leaderEpoch == epoch {
+			votes[peer.leader]++
+		}
+	}
+	candidate := s.myID
+	if winner, _ := mostVoted(votes); winner != "" {
+		candidate = winner
+	}
+	if leader, leaderEpoch := s.voteLeaderLocked(m, epoch, candidate, time.Now()); leaderEpoch == epoch {
+		votes[leader]++
+	}
+	winner, count := mostVoted(votes)
+	voters := len(m.sentinels) + 1
+	if winner == "" || count < voters/2+1 || count < m.quorum {
+		return ""
+	}
+	return winner
+}
+
+func mostVoted(votes map[string]int) (string, int) {
+	winner, count := "", 0
+	for id, n := range votes {
+		if n > count || (n == count && id < winner) {
+			winner, count = id, n
+		}
+	}
+	return winner, count
+}
+
+type peerAsk struct {
+	peer *instance
+	args []string
+}
+
+// peersToAskLocked 主节点主观下线时，每个 PING 周期询问一次其他哨兵的判断；
+// 故障转移进行中时附带本哨兵的 run id 拉票。过期的回复作废。
+func (s *Sentinel) peersToAskLocked(m *master, now time.Time, force bool) []peerAsk {
+	period := s.timing.PingPeriod
+	var asks []peerAsk
+	for _, peer := range m.sentinels {
+		if now.Sub(peer.lastReply) > 5*period {
+			peer.masterDown, peer.leader = false, ""
+		}
+		if m.inst.sdownSince.IsZero() || peer.asking || !peer.sdownSince.IsZero() {
+			continue
+		}
+		if !force && now.Sub(peer.lastAsk) < period {
+			continue
+		}
+		runID := "*"
+		if m.failover != failoverNone {
+			runID = s.myID
+		}
+		peer.asking, peer.lastAsk = true, now
+		asks = append(asks, peerAsk{peer: peer, args: []string{
+			"SENTINEL", "IS-MASTER-DOWN-BY-ADDR", m.inst.host, strconv.Itoa(m.inst.port),
+			strconv.FormatUint(s.currentEpoch, 10), runID,
+		}})
+	}
+	return asks
+}
+
+// askPeer 发送 SENTINEL IS-MASTER-DOWN-BY-ADDR，回复为 [down, leader, leader_epoch]。
+func (s *Sentinel) askPeer(ctx context.Context, peer *instance, args []string) {
+	reply, err := peer.link.do(ctx, args...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peer.asking = false
+	if err != nil || reply.Type != protocol.Array || len(reply.Array) != 3 {
+		return
+	}
+	epoch, err := strconv.ParseUint(valueText(&reply.Array[2]), 10, 64)
+	if err != nil {
+		return
+	}
+	peer.lastReply = time.Now()
+	peer.masterDown = reply.Array[0].Num == 1
+	if leader := reply.Array[1].Str; leader != "*" {
+		peer.leader, peer.leaderEpoch = leader, epoch
+	}
+}
+
+func valueText(v *protocol.Value) string {
+	if v.Type == protocol.Integer {
+		return strconv.FormatInt(v.Num, 10)
+	}
+	return v.Str
+}
@@ -0,0 +1,179 @@
+package sentinel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// helloChannel 哨兵之间通过被监视节点的该频道交换 hello 消息，互相发现并传播主节点配置。
+const helloChannel = "__sentinel__:hello"
+
+// link 到一个节点的命令连接：请求串行执行，出错后断开，下次请求时重新连接并认证。
+type link struct {
+	addr    string
+	user    string
+	pass    string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newLink(addr, user, pass string, timeout time.Duration) *link {
+	return &link{addr: addr, user: user, pass: pass, timeout: timeout}
+}
+
+// do 发送一条命令并读取回复；错误回复作为 *protocol.Value 返回，只有网络错误返回 error。
+func (l *link) do(ctx context.Context, args ...string) (*protocol.Value, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		conn, reader, err := dial(ctx, l.addr, l.user, l.pass, l.timeout)
+		if err != nil {
+			return nil, err
+		}
+		l.conn, l.reader = conn, reader
+	}
+	reply, err := roundTrip(l.conn, l.reader, l.timeout, args)
+	if err != nil {
+		l.closeLocked()
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (l *link) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closeLocked()
+}
+
+func (l *link) closeLocked() {
+	if l.conn != nil {
+		_ = l.conn.Close()
+		l.conn, l.reader = nil, nil
+	}
+}
+
+// dial 建立连接，配置了密码时先 AUTH。
+func dial(ctx context.Context, addr, user, pass string, timeout time.Duration) (net.Conn, *bufio.Reader, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	if pass != "" {
+		args := []string{"AUTH", pass}
+		if user != "" {
+			args = []string{"AUTH", user, pass}
+		}
+		reply, err := roundTrip(conn, reader, timeout, args)
+		if err == nil && reply.Type == protocol.ErrorType {
+			err = errors.New(reply.Str)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, fmt.Errorf("auth to %s: %w", addr, err)
+		}
+	}
+	return conn, reader, nil
+}
+
+func roundTrip(conn net.Conn, reader *bufio.Reader, timeout time.Duration, args []string) (*protocol.Value, error) {
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(protocol.Serialize(protocol.CommandValue(args))); err != nil {
+		return nil, err
+	}
+	return protocol.Parse(reader)
+}
+
+// parseInfo 把 INFO 文本解析为字段表，忽略节标题与空行。
+func parseInfo(text string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// parseInfoReplicas 从主节点 INFO 的 slave<N>:ip=...,port=... 行中取出从节点地址。
+func parseInfoReplicas(fields map[string]string) []string {
+	var addrs []string
+	for key, value := range fields {
+		if !strings.HasPrefix(key, "slave") {
+			continue
+		}
+		if _, err := strconv.Atoi(key[len("slave"):]); err != nil {
+			continue
+		}
+		var host, port string
+		for _, item := range strings.Split(value, ",") {
+			name, v, _ := strings.Cut(item, "=")
+			switch name {
+			case "ip":
+				host = v
+			case "port":
+				port = v
+			}
+		}
+		if host != "" && port != "" {
+			addrs = append(addrs, net.JoinHostPort(host, port))
+		}
+	}
+	return addrs
+}
+
+// hello 哨兵广播的自身信息与它所认为的主节点配置，格式同 Redis：
+// sentinel_ip,sentinel_port,sentinel_runid,current_epoch,master_name,master_ip,master_port,master_config_epoch
+type hello struct {
+	host        string
+	port        int
+	runID       string
+	epoch       uint64
+	masterName  string
+	masterHost  string
+	masterPort  int
+	configEpoch uint64
+}
+
+func (h hello) String() string {
+	return strings.Join([]string{
+		h.host, strconv.Itoa(h.port), h.runID, strconv.FormatUint(h.epoch, 10),
+		h.masterName, h.masterHost, strconv.Itoa(h.masterPort), strconv.FormatUint(h.configEpoch, 10),
+	}, ",")
+}
+
+func parseHello(payload string) (hello, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) != 8 {
+		return hello{}, fmt.Errorf("invalid hello %q", payload)
+	}
+	port, err1 := strconv.Atoi(fields[1])
+	epoch, err2 := strconv.ParseUint(fields[3], 10, 64)
+	masterPort, err3 := strconv.Atoi(fields[6])
+	configEpoch, err4 := strconv.ParseUint(fields[7], 10, 64)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return hello{}, fmt.Errorf("invalid hello %q: %w", payload, err)
+	}
+	return hello{
+		host: fields[0], port: port, runID: fields[2], epoch: epoch,
+		masterName: fields[4], masterHost: fields[5], masterPort: masterPort, configEpoch: configEpoch,
+	}, nil
+}
@@ -0,0 +1,530 @@
+package sentinel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// 默认周期与超时，与 Redis Sentinel 相同。
+const (
+	DefaultPingPeriod      = time.Second
+	DefaultInfoPeriod      = 10 * time.Second
+	DefaultHelloPeriod     = 2 * time.Second
+	DefaultDownAfter       = 30 * time.Second
+	DefaultFailoverTimeout = 3 * time.Minute
+)
+
+var (
+	// ErrNoSuchMaster 按名字找不到被监视的主节点。
+	ErrNoSuchMaster = errors.New("No such master with that name")
+	// ErrDuplicateMaster 同名主节点已在监视中。
+	ErrDuplicateMaster = errors.New("Duplicated master name")
+	// ErrInvalidQuorum quorum 必须为正数。
+	ErrInvalidQuorum = errors.New("Quorum must be 1 or greater")
+)
+
+// Timing 哨兵的探测周期与超时，零值字段使用默认值。
+type Timing struct {
+	// PingPeriod PING 周期，不超过 DownAfter。
+	PingPeriod time.Duration
+	// InfoPeriod INFO 周期；主节点客观下线或故障转移期间从节点按不超过 1s 的周期刷新。
+	InfoPeriod time.Duration
+	// HelloPeriod 发布 hello 消息的周期。
+	HelloPeriod time.Duration
+	// DownAfter 超过该时长没有有效回复即判定主观下线。
+	DownAfter time.Duration
+	// FailoverTimeout 故障转移各阶段的超时，同一主节点两次故障转移至少间隔其两倍。
+	FailoverTimeout time.Duration
+}
+
+func (t Timing) withDefaults() Timing {
+	if t.DownAfter <= 0 {
+		t.DownAfter = DefaultDownAfter
+	}
+	if t.PingPeriod <= 0 {
+		t.PingPeriod = DefaultPingPeriod
+	}
+	t.PingPeriod = min(t.PingPeriod, t.DownAfter)
+	if t.InfoPeriod <= 0 {
+		t.InfoPeriod = DefaultInfoPeriod
+	}
+	if t.HelloPeriod <= 0 {
+		t.HelloPeriod = DefaultHelloPeriod
+	}
+	if t.FailoverTimeout <= 0 {
+		t.FailoverTimeout = DefaultFailoverTimeout
+	}
+	return t
+}
+
+// Sentinel 监视一组主节点及其从节点：以 PING 判断主观下线，与其他哨兵协商客观下线，
+// 选出领头哨兵后把复制偏移最大的从节点晋升为主节点，并让其余节点改为复制新主节点。
+type Sentinel struct {
+	addr   string
+	logger *slog.Logger
+	myID   string
+
+	mu           sync.Mutex
+	timing       Timing
+	authUser     string
+	authPass     string
+	currentEpoch uint64
+	masters      map[string]*master
+	listener     net.Listener
+	// announceHost/announcePort 为 hello 中公布的本哨兵地址，取自监听地址。
+	announceHost string
+	announcePort int
+	// ctx 为 Start 传入的上下文，之后发现的节点在其下启动探测。
+	ctx context.Context
+}
+
+// New 创建哨兵，addr 为 SENTINEL 等命令的监听地址。
+func New(addr string, logger *slog.Logger) *Sentinel {
+	id := make([]byte, 20)
+	_, _ = rand.Read(id)
+	return &Sentinel{
+		addr:    addr,
+		logger:  logger,
+		myID:    hex.EncodeToString(id),
+		timing:  Timing{}.withDefaults(),
+		masters: make(map[string]*master),
+	}
+}
+
+// ID 返回本哨兵的 run id。
+func (s *Sentinel) ID() string {
+	return s.myID
+}
+
+// SetTiming 设置探测周期与超时，需在 Start 前调用。
+func (s *Sentinel) SetTiming(timing Timing) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timing = timing.withDefaults()
+}
+
+// SetAuth 设置连接被监视节点时 AUTH 使用的用户名与密码，需在 Start 前调用。
+func (s *Sentinel) SetAuth(user, pass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authUser, s.authPass = user, pass
+}
+
+// Monitor 开始监视名为 name 的主节点，quorum 为判定客观下线所需的哨兵数。
+func (s *Sentinel) Monitor(name, host string, port, quorum int) error {
+	if quorum <= 0 {
+		return ErrInvalidQuorum
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.masters[name]; ok {
+		return ErrDuplicateMaster
+	}
+	m := &master{name: name, quorum: quorum, replicas: make(map[string]*instance), sentinels: make(map[string]*instance)}
+	m.inst = s.newInstance(kindMaster, host, port)
+	s.masters[name] = m
+	if s.ctx != nil {
+		s.startMasterLocked(m)
+	}
+	return nil
+}
+
+// MasterAddr 返回 name 当前的主节点地址，与 SENTINEL GET-MASTER-ADDR-BY-NAME 相同。
+func (s *Sentinel) MasterAddr(name string) (string, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.masters[name]
+	if !ok {
+		return "", 0, false
+	}
+	inst := m.currentAddr()
+	return inst.host, inst.port, true
+}
+
+// Addr 返回实际监听地址，未启动时为空。
+func (s *Sentinel) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Start 监听命令端口并开始监视，直到 ctx 取消。
+func (s *Sentinel) Start(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+
+	s.mu.Lock()
+	s.listener = ln
+	s.announceHost, s.announcePort = host, port
+	s.ctx = ctx
+	for _, m := range s.masters {
+		s.startMasterLocked(m)
+	}
+	s.mu.Unlock()
+	s.logger.Info("sentinel started", "addr", ln.Addr().String(), "id", s.myID)
+
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsMu sync.Mutex
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+		connsMu.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		connsMu.Unlock()
+	}()
+	for {
+		conn, acceptErr := ln.Accept()
+		if acceptErr != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return acceptErr
+		}
+		connsMu.Lock()
+		conns[conn] = struct{}{}
+		connsMu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleConn(conn)
+			connsMu.Lock()
+			delete(conns, conn)
+			connsMu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// startMasterLocked 启动主节点及其已知节点的探测和状态机，调用方需持有 mu 且 ctx 已设置。
+func (s *Sentinel) startMasterLocked(m *master) {
+	s.startInstanceLocked(m, m.inst)
+	for _, inst := range m.replicas {
+		s.startInstanceLocked(m, inst)
+	}
+	for _, inst := range m.sentinels {
+		s.startInstanceLocked(m, inst)
+	}
+	go s.runMaster(s.ctx, m)
+}
+
+// newInstance 创建节点记录，s.ctx 已设置时由调用方启动探测。
+func (s *Sentinel) newInstance(kind instanceKind, host string, port int) *instance {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	user, pass := s.authUser, s.authPass
+	if kind == kindSentinel {
+		user, pass = "", ""
+	}
+	timeout := min(s.timing.DownAfter, time.Second)
+	return &instance{
+		kind:   kind,
+		addr:   addr,
+		host:   host,
+		port:   port,
+		link:   newLink(addr, user, pass, timeout),
+		lastOK: time.Now(),
+	}
+}
+
+// addInstanceLocked 创建节点记录并在已启动时开始探测。
+func (s *Sentinel) addInstanceLocked(m *master, kind instanceKind, host string, port int) *instance {
+	inst := s.newInstance(kind, host, port)
+	if s.ctx != nil {
+		s.startInstanceLocked(m, inst)
+	}
+	return inst
+}
+
+func (s *Sentinel) startInstanceLocked(m *master, inst *instance) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	inst.cancel = cancel
+	go s.monitorInstance(ctx, m, inst)
+	if inst.kind != kindSentinel {
+		go s.subscribeHello(ctx, inst)
+	}
+}
+
+// releaseInstance 停止节点的探测并断开连接。
+func releaseInstance(inst *instance) {
+	inst.removed = true
+	if inst.cancel != nil {
+		inst.cancel()
+	}
+	inst.link.close()
+}
+
+// monitorInstance 周期性地 PING 节点；主从节点还要刷新 INFO 并发布 hello。
+func (s *Sentinel) monitorInstance(ctx context.Context, m *master, inst *instance) {
+	s.mu.Lock()
+	timing := s.timing
+	s.mu.Unlock()
+	ticker := time.NewTicker(min(100*time.Millisecond, timing.PingPeriod))
+	defer ticker.Stop()
+	var lastPing, lastInfo, lastHello time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if time.Since(lastPing) >= timing.PingPeriod {
+			lastPing = time.Now()
+			s.ping(ctx, inst)
+		}
+		if inst.kind == kindSentinel {
+			continue
+		}
+		if time.Since(lastInfo) >= s.infoPeriod(m, inst) {
+			lastInfo = time.Now()
+			s.refreshInfo(ctx, m, inst)
+		}
+		if time.Since(lastHello) >= timing.HelloPeriod {
+			lastHello = time.Now()
+			s.sendHello(ctx, m, inst)
+		}
+	}
+}
+
+func (s *Sentinel) ping(ctx context.Context, inst *instance) {
+	s.mu.Lock()
+	if inst.pingSent.IsZero() {
+		inst.pingSent = time.Now()
+	}
+	s.mu.Unlock()
+	reply, err := inst.link.do(ctx, "PING")
+	if err != nil {
+		return
+	}
+	// 与 Redis 相同，LOADING 与 MASTERDOWN 也视为节点存活。
+	if reply.Type == protocol.ErrorType && !hasErrorCode(reply.Str, "LOADING", "MASTERDOWN") {
+		return
+	}
+	s.mu.Lock()
+	inst.lastOK = time.Now()
+	inst.pingSent = time.Time{}
+	s.mu.Unlock()
+}
+
+func hasErrorCode(msg string, codes ...string) bool {
+	for _, code := range codes {
+		if len(msg) >= len(code) && msg[:len(code)] == code {
+			return true
+		}
+	}
+	return false
+}
+
+// infoPeriod 主节点客观下线或故障转移期间，从节点的 INFO 刷新加快到不超过 1s。
+func (s *Sentinel) infoPeriod(m *master, inst *instance) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.infoPeriodLocked(m, inst)
+}
+
+func (s *Sentinel) infoPeriodLocked(m *master, inst *instance) time.Duration {
+	if inst.kind == kindReplica && (!m.odownSince.IsZero() || m.failover != failoverNone) {
+		return min(s.timing.InfoPeriod, time.Second)
+	}
+	return s.timing.InfoPeriod
+}
+
+func (s *Sentinel) refreshInfo(ctx context.Context, m *master, inst *instance) {
+	reply, err := inst.link.do(ctx, "INFO")
+	if err != nil || reply.Type == protocol.ErrorType {
+		return
+	}
+	fields := parseInfo(reply.Str)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applyInfoLocked(m, inst, fields, time.Now())
+}
+
+// applyInfoLocked 用 INFO 结果更新节点状态：发现新的从节点，记录从节点的复制进度，
+// 并纠正角色或所跟随主节点与哨兵配置不一致的节点。
+func (s *Sentinel) applyInfoLocked(m *master, inst *instance, fields map[string]string, now time.Time) {
+	if inst.removed {
+		// 节点已在切换主节点时被移除，忽略迟到的结果。
+		return
+	}
+	inst.infoRefresh = now
+	inst.runID = fields["run_id"]
+	if role := fields["role"]; role != inst.role {
+		inst.role = role
+		inst.roleReported = now
+	}
+	switch inst.role {
+	case "master":
+		if inst == m.inst {
+			for _, addr := range parseInfoReplicas(fields) {
+				if _, ok := m.replicas[addr]; ok || addr == m.inst.addr {
+					continue
+				}
+				host, portText, _ := net.SplitHostPort(addr)
+				port, _ := strconv.Atoi(portText)
+				m.replicas[addr] = s.addInstanceLocked(m, kindReplica, host, port)
+				s.logger.Info("+slave", "master", m.name, "replica", addr)
+			}
+		}
+	case "slave":
+		host := fields["master_host"]
+		port, _ := strconv.Atoi(fields["master_port"])
+		if host != inst.masterHost || port != inst.masterPort {
+			inst.masterHost, inst.masterPort = host, port
+			inst.confChanged = now
+		}
+		inst.masterLinkUp = fields["master_link_status"] == "up"
+		inst.offset, _ = strconv.ParseInt(fields["slave_repl_offset"], 10, 64)
+	}
+
+	if inst.kind != kindReplica || m.failover != failoverNone || !inst.sdownSince.IsZero() || !s.masterLooksSaneLocked(m, now) {
+		return
+	}
+	// 角色变化后等待几轮 hello，给其他哨兵传播新配置留出时间，避免按过期配置改写节点。
+	wait := 4 * s.timing.HelloPeriod
+	switch {
+	case inst.role == "master" && now.Sub(inst.roleReported) > wait:
+		s.logger.Info("+convert-to-slave", "master", m.name, "replica", inst.addr)
+		go s.replicaOf(s.ctx, inst, m.inst.host, m.inst.port)
+		inst.roleReported = now
+	case inst.role == "slave" && (inst.masterHost != m.inst.host || inst.masterPort != m.inst.port) && now.Sub(inst.confChanged) > wait:
+		s.logger.Info("+fix-slave-config", "master", m.name, "replica", inst.addr)
+		go s.replicaOf(s.ctx, inst, m.inst.host, m.inst.port)
+		inst.confChanged = now
+	}
+}
+
+// masterLooksSaneLocked 主节点在线、自认为主节点且 INFO 足够新时，才按本地配置纠正从节点。
+func (s *Sentinel) masterLooksSaneLocked(m *master, now time.Time) bool {
+	return m.inst.sdownSince.IsZero() && m.inst.role == "master" && now.Sub(m.inst.infoRefresh) < 2*s.timing.InfoPeriod
+}
+
+func (s *Sentinel) replicaOf(ctx context.Context, inst *instance, host string, port int) {
+	args := []string{"REPLICAOF", "NO", "ONE"}
+	if host != "" {
+		args = []string{"REPLICAOF", host, strconv.Itoa(port)}
+	}
+	reply, err := inst.link.do(ctx, args...)
+	if err == nil && reply.Type == protocol.ErrorType {
+		err = errors.New(reply.Str)
+	}
+	if err != nil {
+		s.logger.Warn("replicaof failed", "instance", inst.addr, "args", args, "error", err)
+	}
+}
+
+// sendHello 通过节点发布本哨兵的地址、纪元与所认为的主节点配置。
+func (s *Sentinel) sendHello(ctx context.Context, m *master, inst *instance) {
+	s.mu.Lock()
+	current := m.currentAddr()
+	msg := hello{
+		host: s.announceHost, port: s.announcePort, runID: s.myID, epoch: s.currentEpoch,
+		masterName: m.name, masterHost: current.host, masterPort: current.port, configEpoch: m.configEpoch,
+	}
+	s.mu.Unlock()
+	_, _ = inst.link.do(ctx, "PUBLISH", helloChannel, msg.String())
+}
+
+// subscribeHello 订阅节点上的 hello 频道，断开后重连，直到 ctx 取消。
+func (s *Sentinel) subscribeHello(ctx context.Context, inst *instance) {
+	s.mu.Lock()
+	timing, user, pass := s.timing, inst.link.user, inst.link.pass
+	s.mu.Unlock()
+	timeout := min(timing.DownAfter, time.Second)
+	for ctx.Err() == nil {
+		conn, reader, err := dial(ctx, inst.addr, user, pass, timeout)
+		if err == nil {
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			reply, subErr := roundTrip(conn, reader, timeout, []string{"SUBSCRIBE", helloChannel})
+			for subErr == nil && reply.Type != protocol.ErrorType {
+				// 各哨兵每个 hello 周期都会发布，长时间没有消息说明连接已失效。
+				_ = conn.SetReadDeadline(time.Now().Add(3*timing.HelloPeriod + timeout))
+				if reply, subErr = protocol.Parse(reader); subErr == nil {
+					s.handleHelloPush(reply)
+				}
+			}
+			stop()
+			_ = conn.Close()
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(timing.PingPeriod):
+		}
+	}
+}
+
+func (s *Sentinel) handleHelloPush(reply *protocol.Value) {
+	if len(reply.Array) != 3 || reply.Array[0].Str != "message" || reply.Array[1].Str != helloChannel {
+		return
+	}
+	msg, err := parseHello(reply.Array[2].Str)
+	if err != nil {
+		s.logger.Warn("ignore malformed hello", "error", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processHelloLocked(msg, time.Now())
+}
+
+// processHelloLocked 记录发出 hello 的哨兵，采纳更大的纪元与更新的主节点配置。
+func (s *Sentinel) processHelloLocked(msg hello, now time.Time) {
+	if msg.runID == s.myID {
+		return
+	}
+	m, ok := s.masters[msg.masterName]
+	if !ok {
+		return
+	}
+	peer, ok := m.sentinels[msg.runID]
+	if !ok {
+		// 同一地址出现新的 run id 说明该哨兵已重启，旧记录作废。
+		addr := net.JoinHostPort(msg.host, strconv.Itoa(msg.port))
+		for id, other := range m.sentinels {
+			if other.addr == addr {
+				releaseInstance(other)
+				delete(m.sentinels, id)
+			}
+		}
+		peer = s.addInstanceLocked(m, kindSentinel, msg.host, msg.port)
+		peer.runID = msg.runID
+		m.sentinels[msg.runID] = peer
+		s.logger.Info("+sentinel", "master", m.name, "sentinel", addr, "id", msg.runID)
+	}
+	peer.lastHello = now
+	if msg.epoch > s.currentEpoch {
+		s.currentEpoch = msg.epoch
+		s.logger.Info("+new-epoch", "epoch", msg.epoch)
+	}
+	if msg.configEpoch > m.configEpoch {
+		m.configEpoch = msg.configEpoch
+		if msg.masterHost != m.inst.host || msg.masterPort != m.inst.port {
+			s.logger.Info("+config-update-from", "master", m.name, "sentinel", peer.addr, "config_epoch", msg.configEpoch)
+			s.switchMasterLocked(m, msg.masterHost, msg.masterPort)
+		}
+	}
+}
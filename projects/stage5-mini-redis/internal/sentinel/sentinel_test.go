@@ -0,0 +1,119 @@
+package sentinel
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestSentinel(t *testing.T) (*Sentinel, *master) {
+	t.Helper()
+	s := New("127.0.0.1:0", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := s.Monitor("mymaster", "127.0.0.1", 6379, 2); err != nil {
+		t.Fatalf("Monitor error = %v", err)
+	}
+	if err := s.Monitor("mymaster", "127.0.0.1", 6380, 2); err != ErrDuplicateMaster {
+		t.Fatalf("duplicate Monitor error = %v", err)
+	}
+	return s, s.masters["mymaster"]
+}
+
+func TestParseInfoAndHello(t *testing.T) {
+	fields := parseInfo("# Replication\r\nrole:master\r\nconnected_slaves:2\r\n" +
+		"slave0:ip=127.0.0.1,port=6380,state=online,offset=10,lag=0\r\n" +
+		"slave1:ip=127.0.0.1,port=6381,state=online,offset=8,lag=2\r\nslave_read_only:1\r\n")
+	if fields["role"] != "master" {
+		t.Fatalf("role = %q", fields["role"])
+	}
+	replicas := parseInfoReplicas(fields)
+	slices.Sort(replicas)
+	if !slices.Equal(replicas, []string{"127.0.0.1:6380", "127.0.0.1:6381"}) {
+		t.Fatalf("replicas = %v", replicas)
+	}
+
+	msg := hello{host: "127.0.0.1", port: 26379, runID: "abc", epoch: 3, masterName: "mymaster", masterHost: "127.0.0.1", masterPort: 6380, configEpoch: 2}
+	parsed, err := parseHello(msg.String())
+	if err != nil || parsed != msg {
+		t.Fatalf("parseHello(%q) = %+v, %v", msg.String(), parsed, err)
+	}
+	if _, err := parseHello("127.0.0.1,26379,abc"); err == nil {
+		t.Fatal("parseHello accepted truncated message")
+	}
+}
+
+func TestVoteLeaderOncePerEpoch(t *testing.T) {
+	s, m := newTestSentinel(t)
+	now := time.Now()
+	if leader, epoch := s.voteLeaderLocked(m, 5, "a", now); leader != "a" || epoch != 5 || s.currentEpoch != 5 {
+		t.Fatalf("first vote = %s@%d (current %d)", leader, epoch, s.currentEpoch)
+	}
+	if leader, epoch := s.voteLeaderLocked(m, 5, "b", now); leader != "a" || epoch != 5 {
+		t.Fatalf("second vote in same epoch = %s@%d", leader, epoch)
+	}
+	// 投票给其他哨兵后，本哨兵暂不发起自己的故障转移。
+	m.odownSince = now.Add(-time.Minute)
+	if s.shouldStartFailoverLocked(m, now) {
+		t.Fatal("failover started right after voting for another sentinel")
+	}
+	if leader, epoch := s.voteLeaderLocked(m, 6, "b", now); leader != "b" || epoch != 6 {
+		t.Fatalf("vote in new epoch = %s@%d", leader, epoch)
+	}
+}
+
+func TestLeaderNeedsMajorityAndQuorum(t *testing.T) {
+	s, m := newTestSentinel(t)
+	for _, id := range []string{"p1", "p2", "p3", "p4"} {
+		peer := s.newInstance(kindSentinel, "127.0.0.1", 26380)
+		peer.runID = id
+		m.sentinels[id] = peer
+	}
+	s.currentEpoch = 1
+	// 5 个哨兵中只有自己和 p1 投给自己，未过半数。
+	m.sentinels["p1"].leader, m.sentinels["p1"].leaderEpoch = s.myID, 1
+	if leader := s.leaderLocked(m, 1); leader != "" {
+		t.Fatalf("leader with 2/5 votes = %q", leader)
+	}
+	m.sentinels["p2"].leader, m.sentinels["p2"].leaderEpoch = s.myID, 1
+	// 上一纪元的票不计入。
+	m.sentinels["p3"].leader, m.sentinels["p3"].leaderEpoch = "p3", 0
+	if leader := s.leaderLocked(m, 1); leader != s.myID {
+		t.Fatalf("leader with 3/5 votes = %q", leader)
+	}
+}
+
+func TestSelectReplicaPrefersOffset(t *testing.T) {
+	s, m := newTestSentinel(t)
+	now := time.Now()
+	add := func(port, offset int, runID string) *instance {
+		inst := s.newInstance(kindReplica, "127.0.0.1", port)
+		inst.role, inst.offset, inst.runID, inst.infoRefresh = "slave", int64(offset), runID, now
+		m.replicas[inst.addr] = inst
+		return inst
+	}
+	add(6380, 100, "c")
+	best := add(6381, 200, "b")
+	add(6382, 200, "d")
+	down := add(6383, 900, "a")
+	down.sdownSince = now
+	if got := s.selectReplicaLocked(m, now); got != best {
+		t.Fatalf("selected %s, want %s", got.addr, best.addr)
+	}
+}
+
+func TestIsMasterDownByAddr(t *testing.T) {
+	s, m := newTestSentinel(t)
+	m.inst.sdownSince = time.Now()
+	reply := s.execute([]string{"SENTINEL", "IS-MASTER-DOWN-BY-ADDR", "127.0.0.1", "6379", "7", "peer"})
+	if len(reply.Array) != 3 || reply.Array[0].Num != 1 || reply.Array[1].Str != "peer" || reply.Array[2].Num != 7 {
+		t.Fatalf("IS-MASTER-DOWN-BY-ADDR = %+v", reply)
+	}
+	reply = s.execute([]string{"SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"})
+	if len(reply.Array) != 2 || reply.Array[1].Str != "6379" {
+		t.Fatalf("GET-MASTER-ADDR-BY-NAME = %+v", reply)
+	}
+	if reply = s.execute([]string{"SENTINEL", "MASTER", "nosuch"}); reply.Str != "ERR No such master with that name" {
+		t.Fatalf("SENTINEL MASTER unknown = %+v", reply)
+	}
+}
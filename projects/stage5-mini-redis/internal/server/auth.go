@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/acl"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// redactedArg MONITOR 与慢日志中代替密码显示的文本。
+const redactedArg = "(redacted)"
+
+var (
+	errNoAuth      = &replyError{code: "NOAUTH", msg: "Authentication required."}
+	errHelloNoAuth = &replyError{code: "NOAUTH", msg: "HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"}
+	errWrongPass   = &replyError{code: "WRONGPASS", msg: "invalid username-password pair or user is disabled."}
+	errNoPassword  = errors.New("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	errNoACLFile   = errors.New("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+)
+
+// SetRequirePass 设置默认用户的密码，非空时新连接必须先 AUTH，需在 Start 前调用。
+func (s *TCPServer) SetRequirePass(password string) {
+	s.acl.SetRequirePass(password)
+}
+
+// EnableACLFile 指定 ACL LOAD/SAVE 使用的文件，文件存在时立即加载。
+func (s *TCPServer) EnableACLFile(path string) error {
+	s.aclFile = path
+	if err := s.acl.Load(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SetMasterAuth 设置从节点连接主节点时使用的 AUTH 凭据，user 为空时只发送密码。
+func (s *TCPServer) SetMasterAuth(user, password string) {
+	s.replMu.Lock()
+	defer s.replMu.Unlock()
+	s.masterUser, s.masterAuth = user, password
+}
+
+func (s *TCPServer) masterCredentials() (string, string) {
+	s.replMu.Lock()
+	defer s.replMu.Unlock()
+	return s.masterUser, s.masterAuth
+}
+
+// authorize 执行命令前检查连接是否已认证以及用户是否有权执行该命令、访问其中的 key 与频道。
+// AUTH 与 HELLO 负责认证本身，不做检查。
+func (s *TCPServer) authorize(client *Client, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if cmd := strings.ToUpper(args[0]); cmd == "AUTH" || cmd == "HELLO" {
+		return nil
+	}
+	user, ok := client.User()
+	if !ok {
+		return errNoAuth
+	}
+	return s.acl.Check(user, args)
+}
+
+// auth 处理 AUTH [username] password，只有密码时以默认用户认证。
+func (s *TCPServer) auth(client *Client, args []string) (*protocol.Value, error) {
+	var user, password string
+	switch len(args) {
+	case 2:
+		if s.acl.DefaultNoPass() {
+			return nil, errNoPassword
+		}
+		user, password = acl.DefaultUser, args[1]
+	case 3:
+		user, password = args[1], args[2]
+	default:
+		return nil, db.ErrInvalidCommand
+	}
+	if err := s.authenticate(client, user, password); err != nil {
+		return nil, err
+	}
+	return protocol.OK(), nil
+}
+
+func (s *TCPServer) authenticate(client *Client, user, password string) error {
+	if !s.acl.Authenticate(user, password) {
+		return errWrongPass
+	}
+	client.setUser(user)
+	return nil
+}
+
+// aclCommand 处理 ACL SETUSER/GETUSER/DELUSER/WHOAMI/LIST/USERS/CAT/LOAD/SAVE。
+func (s *TCPServer) aclCommand(client *Client, args []string) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch sub := strings.ToUpper(args[1]); {
+	case sub == "SETUSER" && len(args) >= 3:
+		if err := s.acl.SetUser(args[2], args[3:]...); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case sub == "GETUSER" && len(args) == 3:
+		info, ok := s.acl.GetUser(args[2])
+		if !ok {
+			return protocol.NullValue(), nil
+		}
+		return protocol.MapValue(
+			*protocol.BulkStringValue("flags"), *protocol.StringArray(info.Flags),
+			*protocol.BulkStringValue("passwords"), *protocol.StringArray(info.Passwords),
+			*protocol.BulkStringValue("commands"), *protocol.BulkStringValue(info.Commands),
+			*protocol.BulkStringValue("keys"), *protocol.BulkStringValue(info.Keys),
+			*protocol.BulkStringValue("channels"), *protocol.BulkStringValue(info.Channels),
+		), nil
+	case sub == "DELUSER" && len(args) >= 3:
+		deleted, err := s.acl.DelUser(args[2:]...)
+		if err != nil {
+			return nil, err
+		}
+		s.disconnectRemovedUsers(client)
+		return protocol.IntegerValue(int64(deleted)), nil
+	case sub == "WHOAMI" && len(args) == 2:
+		user, _ := client.User()
+		return protocol.BulkStringValue(user), nil
+	case sub == "LIST" && len(args) == 2:
+		return protocol.StringArray(s.acl.List()), nil
+	case sub == "USERS" && len(args) == 2:
+		return protocol.StringArray(s.acl.Users()), nil
+	case sub == "CAT" && len(args) == 2:
+		return protocol.StringArray(acl.Categories()), nil
+	case sub == "CAT" && len(args) == 3:
+		commands, ok := acl.CategoryCommands(args[2])
+		if !ok {
+			return nil, fmt.Errorf("Unknown category '%s'", args[2])
+		}
+		return protocol.StringArray(commands), nil
+	case sub == "LOAD" && len(args) == 2:
+		if s.aclFile == "" {
+			return nil, errNoACLFile
+		}
+		if err := s.acl.Load(s.aclFile); err != nil {
+			return nil, err
+		}
+		s.disconnectRemovedUsers(client)
+		return protocol.OK(), nil
+	case sub == "SAVE" && len(args) == 2:
+		if s.aclFile == "" {
+			return nil, errNoACLFile
+		}
+		if err := s.acl.Save(s.aclFile); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case sub == "SETUSER", sub == "GETUSER", sub == "DELUSER", sub == "WHOAMI", sub == "LIST",
+		sub == "USERS", sub == "CAT", sub == "LOAD", sub == "SAVE":
+		return nil, fmt.Errorf("wrong number of arguments for 'acl|%s' command", strings.ToLower(sub))
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s' for 'acl'", args[1])
+	}
+}
+
+// disconnectRemovedUsers 断开以已删除用户认证的连接，当前连接在回复写出后断开（与 Redis 相同）。
+func (s *TCPServer) disconnectRemovedUsers(self *Client) {
+	for _, c := range s.clientList() {
+		user, ok := c.User()
+		if !ok || s.acl.Exists(user) {
+			continue
+		}
+		if c == self {
+			self.closeAfterReply = true
+		} else {
+			_ = c.Conn.Close()
+		}
+	}
+}
+
+// redactArgs 返回隐藏了密码参数的命令副本，供 MONITOR 与慢日志使用；没有敏感参数时原样返回。
+func redactArgs(args []string) []string {
+	if len(args) < 2 {
+		return args
+	}
+	var redact func(i int) bool
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		redact = func(i int) bool { return i >= 1 }
+	case "HELLO":
+		auth := -1
+		for i := 2; i < len(args); i++ {
+			if strings.EqualFold(args[i], "AUTH") {
+				auth = i
+				break
+			}
+		}
+		if auth < 0 {
+			return args
+		}
+		redact = func(i int) bool { return i == auth+1 || i == auth+2 }
+	case "ACL":
+		if !strings.EqualFold(args[1], "SETUSER") {
+			return args
+		}
+		redact = func(i int) bool { return i >= 3 && args[i] != "" && strings.ContainsRune("><#!", rune(args[i][0])) }
+	case "CONFIG":
+		if !strings.EqualFold(args[1], "SET") {
+			return args
+		}
+		redact = func(i int) bool {
+			return i >= 3 && i%2 == 1 && (strings.EqualFold(args[i-1], "requirepass") || strings.EqualFold(args[i-1], "masterauth"))
+		}
+	default:
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if redact(i) {
+			arg = redactedArg
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
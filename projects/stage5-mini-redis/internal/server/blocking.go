@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// keyReadyCommands 可能让阻塞命令得到满足的写命令，执行后唤醒等待这些 key 的客户端。
+var keyReadyCommands = map[string]struct{}{
+	"XADD":           {},
+	"LPUSH":          {},
+	"RPUSH":          {},
+	"LMOVE":          {},
+	"RESTORE":        {},
+	"RESTORE-ASKING": {},
+}
+
+// keyWaiter 一个阻塞中的客户端。
+// 流读取（list 为 nil）被唤醒后自行重试，ready 容量为 1，等待期间的多次唤醒合并为一次；
+// 列表阻塞命令由写入方在写命令完成后按阻塞先后代为弹出，结果经 result 交付，保证同一 key 上先到先得。
+type keyWaiter struct {
+	keys   []string
+	ready  chan struct{}
+	list   *listBlock
+	result chan blockedResult
+}
+
+// blockedResult 代为执行的弹出结果，value 与 err 均为 nil 表示元素已被其他途径取走，需要重新等待。
+type blockedResult struct {
+	value *protocol.Value
+	err   error
+}
+
+// blockingRegistry 阻塞命令的等待登记：key → 按阻塞先后排列的等待者。
+// ready 为写入后有列表等待者的 key，由写入方在释放命令锁后取走并服务。
+type blockingRegistry struct {
+	mu      sync.Mutex
+	waiters map[string][]*keyWaiter
+	ready   []string
+}
+
+func newBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{waiters: make(map[string][]*keyWaiter)}
+}
+
+// register 登记流读取的等待者，需在首次尝试读取之前调用，避免错过两者之间到达的数据。
+func (r *blockingRegistry) register(keys []string) *keyWaiter {
+	w := &keyWaiter{keys: keys, ready: make(chan struct{}, 1)}
+	r.add(w)
+	return w
+}
+
+// registerList 登记列表阻塞命令的等待者，调用方需持有相关 key 的命令锁，使非阻塞尝试与登记之间不会插入写入。
+func (r *blockingRegistry) registerList(block *listBlock) *keyWaiter {
+	w := &keyWaiter{keys: block.keys, list: block, result: make(chan blockedResult, 1)}
+	r.add(w)
+	return w
+}
+
+func (r *blockingRegistry) add(w *keyWaiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range w.keys {
+		r.waiters[key] = append(r.waiters[key], w)
+	}
+}
+
+// unregister 取消登记，等待者已被写入方认领（结果即将交付）时返回 false。
+func (r *blockingRegistry) unregister(w *keyWaiter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.removeLocked(w)
+}
+
+func (r *blockingRegistry) removeLocked(w *keyWaiter) bool {
+	found := false
+	for _, key := range w.keys {
+		list := r.waiters[key]
+		for i, other := range list {
+			if other == w {
+				list = append(list[:i], list[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(r.waiters, key)
+		} else {
+			r.waiters[key] = list
+		}
+	}
+	return found
+}
+
+// signal 唤醒等待 keys 的全部流读取者，并把其中有列表阻塞命令在等待的 key 记为就绪。
+func (r *blockingRegistry) signal(keys []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		hasList := false
+		for _, w := range r.waiters[key] {
+			if w.list != nil {
+				hasList = true
+				continue
+			}
+			select {
+			case w.ready <- struct{}{}:
+			default:
+			}
+		}
+		if hasList {
+			r.ready = append(r.ready, key)
+		}
+	}
+}
+
+// takeReady 取走当前全部就绪 key。
+func (r *blockingRegistry) takeReady() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := r.ready
+	r.ready = nil
+	return keys
+}
+
+// claimFirst 认领 key 上最早阻塞的列表等待者并将其从全部 key 的队列中移除。
+func (r *blockingRegistry) claimFirst(key string) *keyWaiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range r.waiters[key] {
+		if w.list != nil {
+			r.removeLocked(w)
+			return w
+		}
+	}
+	return nil
+}
+
+// signalKeys 写命令执行后唤醒等待相关 key 的流读取者，并记下有列表等待者的 key。
+// 列表等待者不在这里服务：写入方此时仍持有命令锁，代为弹出需等到 serveBlocked。
+func (s *TCPServer) signalKeys(args []string) {
+	if _, ok := keyReadyCommands[strings.ToUpper(args[0])]; ok {
+		s.blocking.signal(db.CommandKeys(args))
+	}
+}
+
+// serveBlocked 按阻塞先后为就绪 key 上的列表等待者代为弹出并交付结果，弹出以非阻塞命令传播。
+// BLMOVE 的目标 key 可能因此就绪，循环直到没有就绪 key，调用方不能持有命令锁。
+func (s *TCPServer) serveBlocked(ctx context.Context) {
+	for keys := s.blocking.takeReady(); len(keys) > 0; keys = s.blocking.takeReady() {
+		for _, key := range keys {
+			s.serveKey(ctx, key)
+		}
+	}
+}
+
+func (s *TCPServer) serveKey(ctx context.Context, key string) {
+	for {
+		if n, err := s.database.LLen(ctx, key); err != nil || n == 0 {
+			return
+		}
+		w := s.blocking.claimFirst(key)
+		if w == nil {
+			return
+		}
+		args := w.list.popArgs(key)
+		var result *protocol.Value
+		var err error
+		s.database.AtomicKeys(db.CommandKeys(args), func(tx *db.Tx) {
+			if result, err = tx.ExecuteCommand(ctx, args); err == nil && result.Type != protocol.Null {
+				s.propagate(ctx, args)
+			}
+		})
+		switch {
+		case err != nil:
+			w.result <- blockedResult{err: err}
+		case result.Type == protocol.Null:
+			// 元素在认领之前已被其他命令取走，等待者重新登记。
+			w.result <- blockedResult{}
+		default:
+			w.result <- blockedResult{value: w.list.reply(key, result)}
+		}
+	}
+}
+
+// listBlock 解析后的 BLPOP/BRPOP/BLMOVE：move 非空时为 BLMOVE 对应的 LMOVE 参数。
+type listBlock struct {
+	keys    []string
+	timeout time.Duration
+	left    bool
+	move    []string
+}
+
+func parseListBlock(args []string) (*listBlock, error) {
+	if err := db.ValidateCommand(args); err != nil {
+		return nil, err
+	}
+	timeout, err := db.ParseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	switch cmd := strings.ToUpper(args[0]); cmd {
+	case "BLMOVE":
+		for _, end := range args[3:5] {
+			if !strings.EqualFold(end, "LEFT") && !strings.EqualFold(end, "RIGHT") {
+				return nil, db.ErrInvalidCommand
+			}
+		}
+		return &listBlock{keys: args[1:2], timeout: timeout, move: append([]string{"LMOVE"}, args[1:5]...)}, nil
+	default:
+		return &listBlock{keys: args[1 : len(args)-1], timeout: timeout, left: cmd == "BLPOP"}, nil
+	}
+}
+
+// popArgs 返回在 key 上执行的非阻塞弹出命令，同时也是传播到 AOF 与从节点的形式。
+func (b *listBlock) popArgs(key string) []string {
+	switch {
+	case b.move != nil:
+		return b.move
+	case b.left:
+		return []string{"LPOP", key}
+	default:
+		return []string{"RPOP", key}
+	}
+}
+
+// reply BLPOP/BRPOP 回复 [key, value]，BLMOVE 直接回复被移动的元素。
+func (b *listBlock) reply(key string, value *protocol.Value) *protocol.Value {
+	if b.move != nil {
+		return value
+	}
+	return protocol.StringArray([]string{key, value.Str})
+}
+
+// blockingPop 处理 BLPOP/BRPOP/BLMOVE：按 key 顺序尝试非阻塞弹出，全部为空时登记到各 key 的 FIFO 等待队列，
+// 直到写入方代为弹出、超时或连接断开。超时时 BLPOP/BRPOP 回复空数组，BLMOVE 回复空 bulk string（与 Redis 文档一致）。事务中的命令走 EXEC 路径，不会阻塞。
+func (s *TCPServer) blockingPop(ctx context.Context, client *Client, args []string, asking bool) (*protocol.Value, error) {
+	block, err := parseListBlock(args)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsReplica() {
+		return nil, errReadOnly
+	}
+	var deadline time.Time
+	if block.timeout > 0 {
+		deadline = time.Now().Add(block.timeout)
+	}
+	for {
+		result, w, err := s.tryPop(ctx, block, args, asking)
+		if err != nil || w == nil {
+			return result, err
+		}
+		gone, stop := client.watchDisconnect()
+		served := s.waitServed(ctx, w, deadline, gone)
+		stop()
+		if served == nil {
+			if s.blocking.unregister(w) {
+				if block.move != nil {
+					return protocol.NullValue(), nil
+				}
+				return protocol.NullArrayValue(), nil
+			}
+			// 超时与认领同时发生：结果已在交付途中，以它为准，避免元素丢失。
+			r := <-w.result
+			served = &r
+		}
+		if served.value != nil || served.err != nil {
+			return served.value, served.err
+		}
+	}
+}
+
+// tryPop 持有相关 key 的命令锁尝试一次非阻塞弹出，没有元素时登记等待者并返回。
+func (s *TCPServer) tryPop(ctx context.Context, block *listBlock, args []string, asking bool) (*protocol.Value, *keyWaiter, error) {
+	if block.move != nil {
+		if err := s.freeMemory(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	var reply *protocol.Value
+	var w *keyWaiter
+	var err error
+	s.database.AtomicKeys(db.CommandKeys(args), func(tx *db.Tx) {
+		if err = s.routeCommand(ctx, args, asking); err != nil {
+			return
+		}
+		for _, key := range block.keys {
+			popArgs := block.popArgs(key)
+			result, popErr := tx.ExecuteCommand(ctx, popArgs)
+			if popErr != nil {
+				err = popErr
+				return
+			}
+			if result.Type != protocol.Null {
+				s.propagate(ctx, popArgs)
+				reply = block.reply(key, result)
+				return
+			}
+		}
+		w = s.blocking.registerList(block)
+	})
+	if reply != nil {
+		s.afterWrite(ctx)
+	}
+	return reply, w, err
+}
+
+// waitServed 等待写入方交付结果，超时、连接断开或服务关闭时返回 nil。
+func (s *TCPServer) waitServed(ctx context.Context, w *keyWaiter, deadline time.Time, gone <-chan struct{}) *blockedResult {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case r := <-w.result:
+		return &r
+	case <-timeout:
+	case <-gone:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// waitReady 挂起直到被唤醒、超时、连接断开或服务关闭，只有被唤醒时返回 true。
+func (s *TCPServer) waitReady(ctx context.Context, client *Client, w *keyWaiter, deadline time.Time) bool {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	gone, stop := client.watchDisconnect()
+	defer stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timeout:
+	case <-gone:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// streamRead 处理 XREAD / XREADGROUP：带 BLOCK 且暂无数据时挂起，直到相关流有新消息或超时（超时回复 Null）。
+// 事务中的命令走 EXEC 路径，不会阻塞。
+func (s *TCPServer) streamRead(ctx context.Context, client *Client, args []string, asking bool) (*protocol.Value, error) {
+	req, err := db.ParseXRead(args)
+	if err != nil {
+		return nil, err
+	}
+	if req.Group != "" && s.IsReplica() {
+		return nil, errReadOnly
+	}
+	var w *keyWaiter
+	var deadline time.Time
+	if req.Blocking {
+		w = s.blocking.register(req.Keys)
+		defer s.blocking.unregister(w)
+		if req.Block > 0 {
+			deadline = time.Now().Add(req.Block)
+		}
+	}
+	for {
+		result, err := s.readStreams(ctx, req, args, asking)
+		if err != nil || result.Type != protocol.NullArray || w == nil {
+			return result, err
+		}
+		if !s.waitReady(ctx, client, w, deadline) {
+			return protocol.NullArrayValue(), nil
+		}
+	}
+}
+
+// readStreams 执行一次非阻塞读取；XREADGROUP 会修改消费者组状态，按写命令处理并传播。
+func (s *TCPServer) readStreams(ctx context.Context, req *db.XReadRequest, args []string, asking bool) (*protocol.Value, error) {
+	write := req.Group != ""
+	var result *protocol.Value
+	var err error
+	s.database.AtomicCommand(args, func(tx *db.Tx) {
+		if err = s.routeCommand(ctx, args, asking); err != nil {
+			return
+		}
+		if result, err = tx.ReadStreams(ctx, req); err == nil && write {
+			s.propagate(ctx, args)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if write {
+		s.afterWrite(ctx)
+	}
+	return result, nil
+}
@@ -1,8 +1,195 @@
 package server
 
-import "net"
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
 
 // Client 客户端连接。
 type Client struct {
 	Conn net.Conn
+	ID   int64
+	// ListeningPort 从节点通过 REPLCONF listening-port 上报的服务端口。
+	ListeningPort string
+	// Asking 由 ASKING 设置，仅对下一条命令生效，允许访问迁入中的 slot。
+	Asking bool
+
+	// tx 为 MULTI 开启的事务，nil 表示不在事务中。
+	tx *transaction
+	// watched 为 WATCH 登记的 key，EXEC/DISCARD/UNWATCH 或断开连接时释放。
+	watched []db.WatchedKey
+
+	// proto 为 HELLO 协商的 RESP 版本（2 或 3），发布者会并发读取。
+	proto atomic.Int32
+	// reader 为连接的读缓冲，阻塞命令借助它探测客户端断开。
+	reader *bufio.Reader
+	// writer 为连接的写缓冲：pipeline 中的回复先写入缓冲，读缓冲取空、命令阻塞或转交输出缓冲前一次写出。
+	writer *bufio.Writer
+	// output 在首次订阅或 MONITOR 时创建，此后连接的全部回复都经由它异步写出，保证与推送消息的顺序。
+	output *outputBuffer
+	// blockedTime 为当前命令阻塞等待的累计时长，不计入慢日志。
+	blockedTime time.Duration
+	// closeAfterReply 由 CLIENT KILL 杀死自身时设置，回复写出后关闭连接。
+	closeAfterReply bool
+
+	createdAt time.Time
+	// mu 保护以下供 CLIENT LIST 等其他连接读取的状态。
+	mu   sync.Mutex
+	name string
+	// user 为已认证的 ACL 用户名，空表示尚未认证。
+	user       string
+	lastCmd    string
+	lastActive time.Time
+	// multi 为事务中已排队的命令数，-1 表示不在事务中。
+	multi   int
+	blocked bool
+	monitor bool
+	replica bool
+}
+
+func newClient(conn net.Conn, id int64) *Client {
+	now := time.Now()
+	client := &Client{Conn: conn, ID: id, createdAt: now, lastActive: now, multi: -1}
+	client.proto.Store(2)
+	return client
+}
+
+// Name 返回由 CLIENT SETNAME 或 HELLO SETNAME 设置的连接名。
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// SetName 设置连接名。
+func (c *Client) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// User 返回连接认证的用户，未认证时返回 false。
+func (c *Client) User() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user, c.user != ""
+}
+
+func (c *Client) setUser(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user = user
+}
+
+// recordCommand 命令执行完毕后更新连接状态。
+func (c *Client) recordCommand(cmd string) {
+	multi := -1
+	if c.tx != nil {
+		multi = len(c.tx.commands)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCmd = cmd
+	c.lastActive = time.Now()
+	c.multi = multi
+}
+
+// Protocol 返回连接当前使用的 RESP 版本。
+func (c *Client) Protocol() int {
+	return int(c.proto.Load())
+}
+
+// SetProtocol 切换连接的 RESP 版本。
+func (c *Client) SetProtocol(version int) {
+	c.proto.Store(int32(version))
+}
+
+// Deliver 实现 pubsub.Subscriber：把消息编码后放入输出缓冲，不阻塞发布者。
+func (c *Client) Deliver(message *protocol.Value) {
+	c.output.enqueue(protocol.Encode(message, c.Protocol()))
+}
+
+// reply 按连接协议写出回复，订阅模式下经由输出缓冲，否则写入写缓冲，由 flushReplies 写出。
+func (c *Client) reply(value *protocol.Value) {
+	payload := protocol.Encode(value, c.Protocol())
+	switch {
+	case c.output != nil:
+		c.output.enqueue(payload)
+	case c.writer != nil:
+		_, _ = c.writer.Write(payload)
+	default:
+		_, _ = c.Conn.Write(payload)
+	}
+}
+
+// flushReplies 把写缓冲中的回复写到连接，写入失败时由之后的读取发现连接已断开。
+func (c *Client) flushReplies() {
+	if c.writer != nil && c.writer.Buffered() > 0 {
+		_ = c.writer.Flush()
+	}
+}
+
+func (c *Client) isWatching(key string) bool {
+	for _, w := range c.watched {
+		if w.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaID 以 ip:port 标识从节点，port 优先使用从节点上报的监听端口。
+func (c *Client) replicaID() string {
+	host, port, err := net.SplitHostPort(c.Conn.RemoteAddr().String())
+	if err != nil {
+		return c.Conn.RemoteAddr().String()
+	}
+	if c.ListeningPort != "" {
+		port = c.ListeningPort
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// watchDisconnect 在命令阻塞期间探测连接是否断开：后台 Peek 读缓冲，遇到 EOF 等错误时关闭返回的通道。
+// stop 用已过期的读超时打断 Peek 并等待其退出，之后读循环会重新设置超时。
+func (c *Client) watchDisconnect() (<-chan struct{}, func()) {
+	// 阻塞前先写出 pipeline 中此前命令的回复。
+	c.flushReplies()
+	started := time.Now()
+	c.setBlocked(true)
+	unblock := func() {
+		c.blockedTime += time.Since(started)
+		c.setBlocked(false)
+	}
+	gone := make(chan struct{})
+	if c.reader == nil {
+		return gone, unblock
+	}
+	_ = c.Conn.SetReadDeadline(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := c.reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			close(gone)
+		}
+	}()
+	return gone, func() {
+		_ = c.Conn.SetReadDeadline(time.Now())
+		<-done
+		unblock()
+	}
+}
+
+func (c *Client) setBlocked(blocked bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocked = blocked
 }
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+var (
+	errNoSuchClient    = errors.New("No such client")
+	errClientName      = errors.New("Client names cannot contain spaces, newlines or special characters.")
+	errClientType      = errors.New("Unknown client type")
+	errClientKillValue = errors.New("syntax error")
+	errClientID        = errors.New("Invalid client ID")
+)
+
+// addClient 登记新连接，供 CLIENT LIST/KILL 与 INFO clients 使用。
+func (s *TCPServer) addClient(client *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	s.clients[client.ID] = client
+}
+
+func (s *TCPServer) removeClient(client *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	delete(s.clients, client.ID)
+}
+
+// clientList 返回按 ID 排序的全部连接。
+func (s *TCPServer) clientList() []*Client {
+	s.clientsMu.Lock()
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.clientsMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+// clientType 连接类型：replica、pubsub 或 normal（CLIENT LIST/KILL 的 TYPE 过滤）。
+func (s *TCPServer) clientType(client *Client) string {
+	client.mu.Lock()
+	replica := client.replica
+	client.mu.Unlock()
+	switch {
+	case replica:
+		return "replica"
+	case s.pubsub.Count(client) > 0:
+		return "pubsub"
+	default:
+		return "normal"
+	}
+}
+
+// clientInfo 生成与 Redis CLIENT LIST 相同格式的一行（不含换行）。
+func (s *TCPServer) clientInfo(client *Client, now time.Time) string {
+	client.mu.Lock()
+	name, user, cmd, lastActive, multi := client.name, client.user, client.lastCmd, client.lastActive, client.multi
+	var flags strings.Builder
+	if client.replica {
+		flags.WriteByte('S')
+	}
+	if client.monitor {
+		flags.WriteByte('O')
+	}
+	if client.blocked {
+		flags.WriteByte('b')
+	}
+	if multi >= 0 {
+		flags.WriteByte('x')
+	}
+	client.mu.Unlock()
+	sub, psub := len(s.pubsub.Channels(client)), len(s.pubsub.Patterns(client))
+	if sub+psub > 0 {
+		flags.WriteByte('P')
+	}
+	if flags.Len() == 0 {
+		flags.WriteByte('N')
+	}
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=0 sub=%d psub=%d multi=%d cmd=%s user=%s resp=%d",
+		client.ID, client.Conn.RemoteAddr(), client.Conn.LocalAddr(), name,
+		int64(now.Sub(client.createdAt).Seconds()), int64(now.Sub(lastActive).Seconds()),
+		flags.String(), sub, psub, multi, cmd, user, client.Protocol())
+}
+
+// clientCommand 处理 CLIENT ID/GETNAME/SETNAME/LIST/INFO/KILL。
+func (s *TCPServer) clientCommand(client *Client, args []string) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch strings.ToUpper(args[1]) {
+	case "ID":
+		return protocol.IntegerValue(client.ID), nil
+	case "GETNAME":
+		name := client.Name()
+		if name == "" {
+			return protocol.NullValue(), nil
+		}
+		return protocol.BulkStringValue(name), nil
+	case "SETNAME":
+		if len(args) != 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		for _, c := range args[2] {
+			if c <= ' ' || c > '~' {
+				return nil, errClientName
+			}
+		}
+		client.SetName(args[2])
+		return protocol.OK(), nil
+	case "INFO":
+		return protocol.VerbatimValue("txt", s.clientInfo(client, time.Now())+"\n"), nil
+	case "LIST":
+		return s.clientListCommand(args[2:])
+	case "KILL":
+		return s.clientKill(client, args[2:])
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s' for 'client'", args[1])
+	}
+}
+
+// clientListCommand 处理 CLIENT LIST [TYPE normal|replica|pubsub] [ID id ...]。
+func (s *TCPServer) clientListCommand(args []string) (*protocol.Value, error) {
+	var typ string
+	var ids map[int64]bool
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && strings.EqualFold(args[0], "TYPE"):
+		var err error
+		if typ, err = parseClientType(args[1]); err != nil {
+			return nil, err
+		}
+	case len(args) >= 2 && strings.EqualFold(args[0], "ID"):
+		ids = make(map[int64]bool, len(args)-1)
+		for _, raw := range args[1:] {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, errClientID
+			}
+			ids[id] = true
+		}
+	default:
+		return nil, db.ErrInvalidCommand
+	}
+	now := time.Now()
+	var b strings.Builder
+	for _, c := range s.clientList() {
+		if (typ != "" && s.clientType(c) != typ) || (ids != nil && !ids[c.ID]) {
+			continue
+		}
+		b.WriteString(s.clientInfo(c, now))
+		b.WriteByte('\n')
+	}
+	return protocol.VerbatimValue("txt", b.String()), nil
+}
+
+// clientKill 处理旧格式 CLIENT KILL addr:port 与过滤格式
+// CLIENT KILL [ID id] [ADDR addr] [LADDR addr] [TYPE type] [USER username] [SKIPME yes|no]，后者返回关闭的连接数。
+// 杀死自身时在回复写出后再断开。
+func (s *TCPServer) clientKill(self *Client, args []string) (*protocol.Value, error) {
+	if len(args) == 0 {
+		return nil, db.ErrInvalidCommand
+	}
+	legacy := len(args) == 1
+	var (
+		id          int64
+		addr, laddr string
+		typ, user   string
+		skipMe      = !legacy
+	)
+	if legacy {
+		addr = args[0]
+	} else {
+		if len(args)%2 != 0 {
+			return nil, errClientKillValue
+		}
+		for i := 0; i < len(args); i += 2 {
+			value := args[i+1]
+			switch strings.ToUpper(args[i]) {
+			case "ID":
+				parsed, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || parsed <= 0 {
+					return nil, errClientKillValue
+				}
+				id = parsed
+			case "ADDR":
+				addr = value
+			case "LADDR":
+				laddr = value
+			case "TYPE":
+				var err error
+				if typ, err = parseClientType(value); err != nil {
+					return nil, err
+				}
+			case "USER":
+				user = value
+			case "SKIPME":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					return nil, errClientKillValue
+				}
+			default:
+				return nil, errClientKillValue
+			}
+		}
+	}
+
+	killed := 0
+	for _, c := range s.clientList() {
+		switch {
+		case id != 0 && c.ID != id,
+			addr != "" && c.Conn.RemoteAddr().String() != addr,
+			laddr != "" && c.Conn.LocalAddr().String() != laddr,
+			typ != "" && s.clientType(c) != typ,
+			user != "" && !clientHasUser(c, user),
+			skipMe && c == self:
+			continue
+		}
+		if c == self {
+			self.closeAfterReply = true
+		} else {
+			_ = c.Conn.Close()
+		}
+		killed++
+	}
+	if legacy {
+		if killed == 0 {
+			return nil, errNoSuchClient
+		}
+		return protocol.OK(), nil
+	}
+	return protocol.IntegerValue(int64(killed)), nil
+}
+
+// parseClientType 解析 TYPE 过滤条件，slave 为 replica 的旧名称。
+func parseClientType(value string) (string, error) {
+	switch typ := strings.ToLower(value); typ {
+	case "normal", "replica", "pubsub", "master":
+		return typ, nil
+	case "slave":
+		return "replica", nil
+	default:
+		return "", errClientType
+	}
+}
+
+func clientHasUser(c *Client, user string) bool {
+	name, _ := c.User()
+	return name == user
+}
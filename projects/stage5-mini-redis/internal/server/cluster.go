@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// clusterBusPortOffset 未显式指定总线端口时，总线端口 = 数据端口 + 10000（与 Redis 一致）。
+const clusterBusPortOffset = 10000
+
+var (
+	errCrossSlot     = &replyError{code: "CROSSSLOT", msg: "Keys in request don't hash to the same slot"}
+	errClusterDown   = &replyError{code: "CLUSTERDOWN", msg: "Hash slot not served"}
+	errClusterNotSet = errors.New("this instance has cluster support disabled")
+)
+
+// EnableCluster 开启集群模式，bus 需已调用 Listen。
+func (s *TCPServer) EnableCluster(state *cluster.State, bus *cluster.Bus) {
+	s.cluster = state
+	s.clusterBus = bus
+}
+
+// checkClusterRouting 校验命令涉及的 key 是否都落在本节点负责的同一个 slot。
+// slot 迁出中时本地缺失的 key 以 ASK 重定向到目标节点；迁入中的 slot 只接受带 ASKING 标记的请求。
+func (s *TCPServer) checkClusterRouting(ctx context.Context, args []string, asking bool) error {
+	keys := db.CommandKeys(args)
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := cluster.KeyToSlot(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.KeyToSlot(key) != slot {
+			return errCrossSlot
+		}
+	}
+	owner, ok := s.cluster.Lookup(slot)
+	if ok && owner.ID == s.cluster.Myself().ID {
+		target, migrating := s.cluster.Migrating(slot)
+		if !migrating {
+			return nil
+		}
+		switch missing := s.countMissingKeys(ctx, keys); {
+		case missing == 0:
+			return nil
+		case missing == len(keys):
+			return &replyError{code: "ASK", msg: fmt.Sprintf("%d %s", slot, target.Addr)}
+		default:
+			return errTryAgain
+		}
+	}
+	if _, importing := s.cluster.Importing(slot); importing && asking {
+		if len(keys) > 1 && s.countMissingKeys(ctx, keys) > 0 {
+			return errTryAgain
+		}
+		return nil
+	}
+	if !ok {
+		return errClusterDown
+	}
+	return &replyError{code: "MOVED", msg: fmt.Sprintf("%d %s", slot, owner.Addr)}
+}
+
+func (s *TCPServer) countMissingKeys(ctx context.Context, keys []string) int {
+	missing := 0
+	for _, key := range keys {
+		if exists, err := s.database.Exists(ctx, key); err != nil || !exists {
+			missing++
+		}
+	}
+	return missing
+}
+
+func (s *TCPServer) clusterCommand(ctx context.Context, args []string) (*protocol.Value, error) {
+	if s.cluster == nil {
+		return nil, errClusterNotSet
+	}
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch strings.ToUpper(args[1]) {
+	case "MYID":
+		return protocol.BulkStringValue(s.cluster.Myself().ID), nil
+	case "KEYSLOT":
+		if len(args) != 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		return protocol.IntegerValue(int64(cluster.KeyToSlot(args[2]))), nil
+	case "ADDSLOTS":
+		if len(args) < 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		slots := make([]uint16, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			slot, err := cluster.ParseSlot(arg)
+			if err != nil {
+				return nil, err
+			}
+			slots = append(slots, slot)
+		}
+		if err := s.cluster.AddSlots(slots); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case "ADDSLOTSRANGE":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return nil, db.ErrInvalidCommand
+		}
+		slots := make([]uint16, 0)
+		for i := 2; i < len(args); i += 2 {
+			start, err := cluster.ParseSlot(args[i])
+			if err != nil {
+				return nil, err
+			}
+			end, err := cluster.ParseSlot(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			for slot := int(start); slot <= int(end); slot++ {
+				slots = append(slots, uint16(slot))
+			}
+		}
+		if err := s.cluster.AddSlots(slots); err != nil {
+			return nil, err
+		}
+		return protocol.OK(), nil
+	case "SETSLOT":
+		return s.clusterSetSlot(args)
+	case "COUNTKEYSINSLOT":
+		if len(args) != 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		slot, err := cluster.ParseSlot(args[2])
+		if err != nil {
+			return nil, err
+		}
+		keys, err := s.keysInSlot(ctx, slot, 0)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.IntegerValue(int64(len(keys))), nil
+	case "GETKEYSINSLOT":
+		if len(args) != 4 {
+			return nil, db.ErrInvalidCommand
+		}
+		slot, err := cluster.ParseSlot(args[2])
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(args[3])
+		if err != nil || count < 0 {
+			return nil, errors.New("invalid number of keys")
+		}
+		if count == 0 {
+			return protocol.ArrayValue(), nil
+		}
+		keys, err := s.keysInSlot(ctx, slot, count)
+		if err != nil {
+			return nil, err
+		}
+		return protocol.StringArray(keys), nil
+	case "MEET":
+		return s.clusterMeet(ctx, args)
+	case "NODES":
+		return protocol.VerbatimValue("txt", s.clusterNodes()), nil
+	case "SLOTS":
+		return s.clusterSlots(), nil
+	case "INFO":
+		return protocol.VerbatimValue("txt", s.clusterInfo()), nil
+	default:
+		return nil, db.ErrInvalidCommand
+	}
+}
+
+// clusterMeet 处理 CLUSTER MEET ip port [bus-port]。
+func (s *TCPServer) clusterMeet(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) != 4 && len(args) != 5 {
+		return nil, db.ErrInvalidCommand
+	}
+	port, err := strconv.Atoi(args[3])
+	if err != nil {
+		return nil, errors.New("invalid port")
+	}
+	busPort := port + clusterBusPortOffset
+	if len(args) == 5 {
+		if busPort, err = strconv.Atoi(args[4]); err != nil {
+			return nil, errors.New("invalid bus port")
+		}
+	}
+	if err = s.clusterBus.Meet(ctx, net.JoinHostPort(args[2], strconv.Itoa(busPort))); err != nil {
+		return nil, err
+	}
+	return protocol.OK(), nil
+}
+
+// clusterNodes 输出 CLUSTER NODES 格式：id addr@cport flags master ping pong epoch link slots...
+// 从未收到 PONG 的节点（包括本节点）pong 为 0；超过节点超时没有 PONG 的节点 link 为 disconnected。
+// 本节点行末尾追加迁移状态：[slot->-target] 表示迁出，[slot-<-source] 表示迁入。
+func (s *TCPServer) clusterNodes() string {
+	myID := s.cluster.Myself().ID
+	migrating, importing := s.cluster.MigrationStates()
+	timeout := s.clusterBus.NodeTimeout()
+	var b strings.Builder
+	for _, node := range s.cluster.Snapshot() {
+		flags, link := "master", "connected"
+		if node.ID == myID {
+			flags = "myself,master"
+		} else if node.LastPong.IsZero() || time.Since(node.LastPong) > timeout {
+			link = "disconnected"
+		}
+		pong := int64(0)
+		if !node.LastPong.IsZero() {
+			pong = node.LastPong.UnixMilli()
+		}
+		busPort := ""
+		if _, port, err := net.SplitHostPort(node.BusAddr); err == nil {
+			busPort = port
+		}
+		fmt.Fprintf(&b, "%s %s@%s %s - 0 %d %d %s", node.ID, node.Addr, busPort, flags, pong, node.ConfigEpoch, link)
+		for _, r := range node.Slots {
+			b.WriteString(" " + r.String())
+		}
+		if node.ID == myID {
+			writeMigrationStates(&b, migrating, "->-")
+			writeMigrationStates(&b, importing, "-<-")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func writeMigrationStates(b *strings.Builder, states map[uint16]string, arrow string) {
+	slots := make([]int, 0, len(states))
+	for slot := range states {
+		slots = append(slots, int(slot))
+	}
+	sort.Ints(slots)
+	for _, slot := range slots {
+		fmt.Fprintf(b, " [%d%s%s]", slot, arrow, states[uint16(slot)])
+	}
+}
+
+// clusterSlots 每个 slot 区间返回 [start, end, [host, port, id]]。
+func (s *TCPServer) clusterSlots() *protocol.Value {
+	ranges := make([]protocol.Value, 0)
+	for _, node := range s.cluster.Snapshot() {
+		host, portText, err := net.SplitHostPort(node.Addr)
+		if err != nil {
+			continue
+		}
+		port, _ := strconv.Atoi(portText)
+		endpoint := protocol.ArrayValue(*protocol.BulkStringValue(host), *protocol.IntegerValue(int64(port)), *protocol.BulkStringValue(node.ID))
+		for _, r := range node.Slots {
+			ranges = append(ranges, *protocol.ArrayValue(*protocol.IntegerValue(int64(r.Start)), *protocol.IntegerValue(int64(r.End)), *endpoint))
+		}
+	}
+	return protocol.ArrayValue(ranges...)
+}
+
+func (s *TCPServer) clusterInfo() string {
+	assigned := s.cluster.AssignedSlots()
+	state := "fail"
+	if assigned == cluster.TotalSlots {
+		state = "ok"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "cluster_enabled:1\r\n")
+	fmt.Fprintf(&b, "cluster_state:%s\r\n", state)
+	fmt.Fprintf(&b, "cluster_slots_assigned:%d\r\n", assigned)
+	fmt.Fprintf(&b, "cluster_known_nodes:%d\r\n", len(s.cluster.Snapshot()))
+	fmt.Fprintf(&b, "cluster_current_epoch:%d\r\n", s.cluster.CurrentEpoch())
+	return b.String()
+}
@@ -0,0 +1,357 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/glob"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/persist"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+var errOutputBufferLimit = errors.New("invalid client-output-buffer-limit, want \"<hard> <soft> <soft-seconds>\"")
+
+// ParseOutputBufferLimit 解析 "<hard> <soft> <soft-seconds>" 格式的输出缓冲限制，容量支持 kb/mb/gb 单位。
+func ParseOutputBufferLimit(spec string) (OutputBufferLimit, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 3 {
+		return OutputBufferLimit{}, errOutputBufferLimit
+	}
+	hard, err := ParseMemory(fields[0])
+	if err != nil {
+		return OutputBufferLimit{}, errOutputBufferLimit
+	}
+	soft, err := ParseMemory(fields[1])
+	if err != nil {
+		return OutputBufferLimit{}, errOutputBufferLimit
+	}
+	seconds, err := strconv.Atoi(fields[2])
+	if err != nil || seconds < 0 {
+		return OutputBufferLimit{}, errOutputBufferLimit
+	}
+	return OutputBufferLimit{Hard: hard, Soft: soft, SoftDuration: time.Duration(seconds) * time.Second}, nil
+}
+
+// ParseMemory 解析字节数，支持 k/kb/m/mb/g/gb 后缀（k 为 1000，kb 为 1024，与 Redis 配置一致）。
+func ParseMemory(text string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000}, {"b", 1},
+	}
+	lower := strings.ToLower(strings.TrimSpace(text))
+	factor := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, factor = strings.TrimSuffix(lower, unit.suffix), unit.factor
+			break
+		}
+	}
+	value, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid memory value %q", text)
+	}
+	return value * factor, nil
+}
+
+// configParam 可由 CONFIG GET/SET 访问的参数。set 只校验并返回应用函数，
+// CONFIG SET 全部参数校验通过后才依次应用，任一参数非法时不修改任何配置。
+type configParam struct {
+	get func() string
+	set func(value string) (func(), error)
+}
+
+var errImmutableConfig = errors.New("can't set immutable config")
+
+// configParams 返回运行时可读写的参数表。
+func (s *TCPServer) configParams() map[string]configParam {
+	requireAOF := func(apply func() (func(), error)) (func(), error) {
+		if s.aof == nil {
+			return nil, errAOFDisabled
+		}
+		return apply()
+	}
+	immutable := func(string) (func(), error) { return nil, errImmutableConfig }
+	return map[string]configParam{
+		"maxmemory": {
+			get: func() string {
+				limit, _ := s.database.MaxMemory()
+				return strconv.FormatInt(limit, 10)
+			},
+			set: func(value string) (func(), error) {
+				limit, err := ParseMemory(value)
+				if err != nil {
+					return nil, err
+				}
+				return func() {
+					_, policy := s.database.MaxMemory()
+					s.database.SetMaxMemory(limit, policy, s.database.MaxMemorySamples())
+				}, nil
+			},
+		},
+		"maxmemory-policy": {
+			get: func() string {
+				_, policy := s.database.MaxMemory()
+				return string(policy)
+			},
+			set: func(value string) (func(), error) {
+				policy, err := db.ParseEvictionPolicy(value)
+				if err != nil {
+					return nil, err
+				}
+				return func() {
+					limit, _ := s.database.MaxMemory()
+					s.database.SetMaxMemory(limit, policy, s.database.MaxMemorySamples())
+				}, nil
+			},
+		},
+		"maxmemory-samples": {
+			get: func() string { return strconv.Itoa(s.database.MaxMemorySamples()) },
+			set: func(value string) (func(), error) {
+				samples, err := strconv.Atoi(value)
+				if err != nil || samples <= 0 {
+					return nil, errors.New("argument must be a positive integer")
+				}
+				return func() {
+					limit, policy := s.database.MaxMemory()
+					s.database.SetMaxMemory(limit, policy, samples)
+				}, nil
+			},
+		},
+		"notify-keyspace-events": {
+			get: func() string { return s.database.NotifyKeyspaceEvents().String() },
+			set: func(value string) (func(), error) {
+				classes, err := db.ParseNotifyKeyspaceEvents(value)
+				if err != nil {
+					return nil, err
+				}
+				return func() { s.database.SetNotifyKeyspaceEvents(classes) }, nil
+			},
+		},
+		"slowlog-log-slower-than": {
+			get: func() string {
+				threshold, _ := s.slowlog.config()
+				return strconv.FormatInt(threshold, 10)
+			},
+			set: func(value string) (func(), error) {
+				threshold, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil, errors.New("argument couldn't be parsed into an integer")
+				}
+				return func() { s.slowlog.setThreshold(threshold) }, nil
+			},
+		},
+		"slowlog-max-len": {
+			get: func() string {
+				_, maxLen := s.slowlog.config()
+				return strconv.Itoa(maxLen)
+			},
+			set: func(value string) (func(), error) {
+				maxLen, err := strconv.Atoi(value)
+				if err != nil || maxLen < 0 {
+					return nil, errors.New("argument must be a non-negative integer")
+				}
+				return func() { s.slowlog.setMaxLen(maxLen) }, nil
+			},
+		},
+		"appendonly": {
+			get: func() string {
+				if s.aof == nil {
+					return "no"
+				}
+				return "yes"
+			},
+			set: immutable,
+		},
+		"appendfsync": {
+			get: func() string {
+				if s.aof == nil {
+					return string(persist.FsyncEverySec)
+				}
+				return string(s.aof.Policy())
+			},
+			set: func(value string) (func(), error) {
+				return requireAOF(func() (func(), error) {
+					policy, err := persist.ParseFsyncPolicy(value)
+					if err != nil {
+						return nil, err
+					}
+					return func() {
+						if err := s.aof.SetPolicy(policy); err != nil {
+							s.logger.Error("set appendfsync failed", "error", err)
+						}
+					}, nil
+				})
+			},
+		},
+		"auto-aof-rewrite-percentage": {
+			get: func() string {
+				if s.aof == nil {
+					return strconv.Itoa(persist.DefaultRewritePercentage)
+				}
+				percentage, _ := s.aof.AutoRewrite()
+				return strconv.Itoa(percentage)
+			},
+			set: func(value string) (func(), error) {
+				return requireAOF(func() (func(), error) {
+					percentage, err := strconv.Atoi(value)
+					if err != nil || percentage < 0 {
+						return nil, errors.New("argument must be a non-negative integer")
+					}
+					return func() {
+						_, minSize := s.aof.AutoRewrite()
+						s.aof.SetAutoRewrite(percentage, minSize)
+					}, nil
+				})
+			},
+		},
+		"auto-aof-rewrite-min-size": {
+			get: func() string {
+				if s.aof == nil {
+					return strconv.FormatInt(persist.DefaultRewriteMinSize, 10)
+				}
+				_, minSize := s.aof.AutoRewrite()
+				return strconv.FormatInt(minSize, 10)
+			},
+			set: func(value string) (func(), error) {
+				return requireAOF(func() (func(), error) {
+					minSize, err := ParseMemory(value)
+					if err != nil {
+						return nil, err
+					}
+					return func() {
+						percentage, _ := s.aof.AutoRewrite()
+						s.aof.SetAutoRewrite(percentage, minSize)
+					}, nil
+				})
+			},
+		},
+		"requirepass": {
+			get: func() string { return s.acl.RequirePass() },
+			set: func(value string) (func(), error) {
+				return func() { s.acl.SetRequirePass(value) }, nil
+			},
+		},
+		"aclfile": {
+			get: func() string { return s.aclFile },
+			set: immutable,
+		},
+		"masteruser": {
+			get: func() string {
+				user, _ := s.masterCredentials()
+				return user
+			},
+			set: func(value string) (func(), error) {
+				return func() {
+					_, password := s.masterCredentials()
+					s.SetMasterAuth(value, password)
+				}, nil
+			},
+		},
+		"masterauth": {
+			get: func() string {
+				_, password := s.masterCredentials()
+				return password
+			},
+			set: func(value string) (func(), error) {
+				return func() {
+					user, _ := s.masterCredentials()
+					s.SetMasterAuth(user, value)
+				}, nil
+			},
+		},
+		"dir": {
+			get: func() string {
+				if s.rdbPath == "" {
+					return ""
+				}
+				return filepath.Dir(s.rdbPath)
+			},
+			set: immutable,
+		},
+		"dbfilename": {
+			get: func() string {
+				if s.rdbPath == "" {
+					return ""
+				}
+				return filepath.Base(s.rdbPath)
+			},
+			set: immutable,
+		},
+	}
+}
+
+// configCommand 处理 CONFIG GET pattern [pattern ...]、CONFIG SET parameter value [parameter value ...] 与 CONFIG RESETSTAT。
+func (s *TCPServer) configCommand(args []string) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		if len(args) < 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		params := s.configParams()
+		names := make([]string, 0, len(params))
+		for name := range params {
+			for _, pattern := range args[2:] {
+				if glob.Match(strings.ToLower(pattern), name) {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		sort.Strings(names)
+		pairs := make([]protocol.Value, 0, len(names)*2)
+		for _, name := range names {
+			pairs = append(pairs, *protocol.BulkStringValue(name), *protocol.BulkStringValue(params[name].get()))
+		}
+		return protocol.MapValue(pairs...), nil
+	case "SET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return nil, db.ErrInvalidCommand
+		}
+		params := s.configParams()
+		seen := make(map[string]bool, (len(args)-2)/2)
+		applies := make([]func(), 0, (len(args)-2)/2)
+		for i := 2; i < len(args); i += 2 {
+			name := strings.ToLower(args[i])
+			param, ok := params[name]
+			if !ok {
+				return nil, fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - duplicate parameter", args[i])
+			}
+			seen[name] = true
+			apply, err := param.set(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %w", args[i], err)
+			}
+			applies = append(applies, apply)
+		}
+		s.configMu.Lock()
+		for _, apply := range applies {
+			apply()
+		}
+		s.configMu.Unlock()
+		return protocol.OK(), nil
+	case "RESETSTAT":
+		if len(args) != 2 {
+			return nil, db.ErrInvalidCommand
+		}
+		s.stats.reset()
+		s.database.ResetStats()
+		return protocol.OK(), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s' for 'config'", args[1])
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/acl"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ds"
+)
+
+// replyError 自带错误码前缀（如 READONLY）的错误，原样返回给客户端。
+type replyError struct {
+	code string
+	msg  string
+}
+
+func (e *replyError) Error() string {
+	return e.code + " " + e.msg
+}
+
+var (
+	errReadOnly = &replyError{code: "READONLY", msg: "You can't write against a read only replica."}
+	errOOM      = &replyError{code: "OOM", msg: "command not allowed when used memory > 'maxmemory'."}
+)
+
+// errorReply 生成 RESP 错误文本，带专用错误码的 DB 错误补对应前缀，其余补 ERR 前缀。
+func errorReply(err error) string {
+	var coded *replyError
+	var denied *acl.DeniedError
+	switch {
+	case errors.As(err, &coded):
+		return coded.Error()
+	case errors.As(err, &denied):
+		return "NOPERM " + denied.Error()
+	case errors.Is(err, db.ErrNoGroup):
+		return "NOGROUP " + err.Error()
+	case errors.Is(err, db.ErrBusyGroup):
+		return "BUSYGROUP " + err.Error()
+	case errors.Is(err, ds.ErrNotHLL):
+		return "WRONGTYPE " + err.Error()
+	case errors.Is(err, ds.ErrCorruptHLL):
+		return "INVALIDOBJ " + err.Error()
+	}
+	return "ERR " + err.Error()
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// serverVersion HELLO 中上报的兼容版本，客户端据此判断可用特性。
+const serverVersion = "7.0.0"
+
+var (
+	errNoProto      = &replyError{code: "NOPROTO", msg: "unsupported protocol version"}
+	errProtoVersion = errors.New("protocol version is not an integer or out of range")
+)
+
+// hello 处理 HELLO [protover [AUTH username password] [SETNAME clientname]]，
+// 协商成功后返回服务端信息映射，之后的回复按新协议版本编码。
+func (s *TCPServer) hello(client *Client, args []string) (*protocol.Value, error) {
+	proto := client.Protocol()
+	if len(args) >= 2 {
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, errProtoVersion
+		}
+		if version != 2 && version != 3 {
+			return nil, errNoProto
+		}
+		proto = version
+	}
+	name, hasName := "", false
+	user, password, hasAuth := "", "", false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return nil, db.ErrInvalidCommand
+			}
+			user, password, hasAuth = args[i+1], args[i+2], true
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return nil, db.ErrInvalidCommand
+			}
+			name, hasName = args[i+1], true
+			i++
+		default:
+			return nil, db.ErrInvalidCommand
+		}
+	}
+
+	if hasAuth {
+		if err := s.authenticate(client, user, password); err != nil {
+			return nil, err
+		}
+	} else if _, ok := client.User(); !ok {
+		return nil, errHelloNoAuth
+	}
+	client.SetProtocol(proto)
+	if hasName {
+		client.SetName(name)
+	}
+	mode := "standalone"
+	if s.cluster != nil {
+		mode = "cluster"
+	}
+	role := "master"
+	if s.IsReplica() {
+		role = "replica"
+	}
+	return protocol.MapValue(
+		*protocol.BulkStringValue("server"), *protocol.BulkStringValue("redis"),
+		*protocol.BulkStringValue("version"), *protocol.BulkStringValue(serverVersion),
+		*protocol.BulkStringValue("proto"), *protocol.IntegerValue(int64(proto)),
+		*protocol.BulkStringValue("id"), *protocol.IntegerValue(client.ID),
+		*protocol.BulkStringValue("mode"), *protocol.BulkStringValue(mode),
+		*protocol.BulkStringValue("role"), *protocol.BulkStringValue(role),
+		*protocol.BulkStringValue("modules"), *protocol.ArrayValue(),
+	), nil
+}
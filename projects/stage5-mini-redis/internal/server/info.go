@@ -0,0 +1,180 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/replication"
+)
+
+// infoSections INFO 各节的输出顺序，与 Redis 一致。
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "cluster", "keyspace"}
+
+// info 生成 INFO 文本，可指定多个节；不带参数或 all/default/everything 时返回全部。
+func (s *TCPServer) info(args []string) string {
+	wanted := make(map[string]bool, len(args))
+	for _, arg := range args[1:] {
+		wanted[strings.ToLower(arg)] = true
+	}
+	all := len(wanted) == 0 || wanted["all"] || wanted["default"] || wanted["everything"]
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		switch section {
+		case "server":
+			s.writeServerInfo(&b)
+		case "clients":
+			s.writeClientsInfo(&b)
+		case "memory":
+			s.writeMemoryInfo(&b)
+		case "persistence":
+			s.writePersistenceInfo(&b)
+		case "stats":
+			s.writeStatsInfo(&b)
+		case "replication":
+			s.writeReplicationInfo(&b)
+		case "cluster":
+			fmt.Fprintf(&b, "# Cluster\r\ncluster_enabled:%d\r\n", boolToInt(s.cluster != nil))
+		case "keyspace":
+			b.WriteString("# Keyspace\r\n")
+			if stats := s.database.Stats(); stats.Keys > 0 {
+				fmt.Fprintf(&b, "db0:keys=%d,expires=%d\r\n", stats.Keys, stats.Expires)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (s *TCPServer) writeServerInfo(b *strings.Builder) {
+	mode := "standalone"
+	if s.cluster != nil {
+		mode = "cluster"
+	}
+	port := ""
+	if _, p, err := net.SplitHostPort(s.Addr()); err == nil {
+		port = p
+	}
+	uptime := time.Since(s.stats.startTime)
+	b.WriteString("# Server\r\n")
+	fmt.Fprintf(b, "redis_version:%s\r\n", serverVersion)
+	fmt.Fprintf(b, "redis_mode:%s\r\n", mode)
+	fmt.Fprintf(b, "arch_bits:%d\r\n", strconv.IntSize)
+	fmt.Fprintf(b, "go_version:%s\r\n", runtime.Version())
+	fmt.Fprintf(b, "process_id:%d\r\n", os.Getpid())
+	fmt.Fprintf(b, "run_id:%s\r\n", s.stats.runID)
+	fmt.Fprintf(b, "tcp_port:%s\r\n", port)
+	fmt.Fprintf(b, "uptime_in_seconds:%d\r\n", int64(uptime.Seconds()))
+	fmt.Fprintf(b, "uptime_in_days:%d\r\n", int64(uptime.Hours()/24))
+}
+
+func (s *TCPServer) writeClientsInfo(b *strings.Builder) {
+	blocked, pubsub := 0, 0
+	for _, client := range s.clientList() {
+		client.mu.Lock()
+		if client.blocked {
+			blocked++
+		}
+		client.mu.Unlock()
+		if s.pubsub.Count(client) > 0 {
+			pubsub++
+		}
+	}
+	b.WriteString("# Clients\r\n")
+	fmt.Fprintf(b, "connected_clients:%d\r\n", s.connected.Load())
+	fmt.Fprintf(b, "blocked_clients:%d\r\n", blocked)
+	fmt.Fprintf(b, "pubsub_clients:%d\r\n", pubsub)
+}
+
+func (s *TCPServer) writeMemoryInfo(b *strings.Builder) {
+	limit, policy := s.database.MaxMemory()
+	b.WriteString("# Memory\r\n")
+	fmt.Fprintf(b, "used_memory:%d\r\n", s.database.UsedMemory())
+	fmt.Fprintf(b, "maxmemory:%d\r\n", limit)
+	fmt.Fprintf(b, "maxmemory_policy:%s\r\n", policy)
+}
+
+func (s *TCPServer) writePersistenceInfo(b *strings.Builder) {
+	b.WriteString("# Persistence\r\n")
+	b.WriteString("loading:0\r\n")
+	fmt.Fprintf(b, "rdb_changes_since_last_save:%d\r\n", s.database.Stats().Dirty-s.dirtyAtSave.Load())
+	fmt.Fprintf(b, "rdb_bgsave_in_progress:%d\r\n", boolToInt(s.bgSaving.Load()))
+	fmt.Fprintf(b, "rdb_last_save_time:%d\r\n", s.lastSave.Load())
+	fmt.Fprintf(b, "aof_enabled:%d\r\n", boolToInt(s.aof != nil))
+	if s.aof == nil {
+		b.WriteString("aof_rewrite_in_progress:0\r\n")
+		return
+	}
+	fmt.Fprintf(b, "aof_rewrite_in_progress:%d\r\n", boolToInt(s.aof.Rewriting()))
+	fmt.Fprintf(b, "aof_current_size:%d\r\n", s.aof.Size())
+	fmt.Fprintf(b, "aof_base_size:%d\r\n", s.aof.BaseSize())
+}
+
+func (s *TCPServer) writeStatsInfo(b *strings.Builder) {
+	stats := s.database.Stats()
+	b.WriteString("# Stats\r\n")
+	fmt.Fprintf(b, "total_connections_received:%d\r\n", s.stats.totalConnections.Load())
+	fmt.Fprintf(b, "total_commands_processed:%d\r\n", s.stats.totalCommands.Load())
+	fmt.Fprintf(b, "instantaneous_ops_per_sec:%d\r\n", s.stats.opsPerSec())
+	fmt.Fprintf(b, "expired_keys:%d\r\n", stats.ExpiredKeys)
+	fmt.Fprintf(b, "evicted_keys:%d\r\n", stats.EvictedKeys)
+	fmt.Fprintf(b, "pubsub_channels:%d\r\n", len(s.pubsub.ActiveChannels("")))
+	fmt.Fprintf(b, "pubsub_patterns:%d\r\n", s.pubsub.NumPat())
+}
+
+func (s *TCPServer) writeReplicationInfo(b *strings.Builder) {
+	b.WriteString("# Replication\r\n")
+	s.replMu.Lock()
+	slave := s.slave
+	s.replMu.Unlock()
+
+	if slave != nil {
+		linkStatus := "down"
+		if slave.State() == replication.LinkConnected {
+			linkStatus = "up"
+		}
+		fmt.Fprintf(b, "role:slave\r\n")
+		fmt.Fprintf(b, "master_host:%s\r\n", slave.MasterHost())
+		fmt.Fprintf(b, "master_port:%d\r\n", slave.MasterPort())
+		fmt.Fprintf(b, "master_link_status:%s\r\n", linkStatus)
+		fmt.Fprintf(b, "master_sync_in_progress:%d\r\n", boolToInt(slave.State() == replication.LinkSync))
+		fmt.Fprintf(b, "slave_repl_offset:%d\r\n", slave.Offset())
+		fmt.Fprintf(b, "slave_read_only:1\r\n")
+	} else {
+		fmt.Fprintf(b, "role:master\r\n")
+	}
+
+	slaves := s.master.Slaves()
+	ids := make([]string, 0, len(slaves))
+	for id := range slaves {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(b, "connected_slaves:%d\r\n", len(ids))
+	for i, id := range ids {
+		host, port := id, ""
+		if idx := strings.LastIndex(id, ":"); idx >= 0 {
+			host, port = id[:idx], id[idx+1:]
+		}
+		fmt.Fprintf(b, "slave%d:ip=%s,port=%s,state=online,offset=%d,lag=%d\r\n", i, host, port, slaves[id], s.master.Offset()-slaves[id])
+	}
+	fmt.Fprintf(b, "master_replid:%s\r\n", s.master.ReplID())
+	fmt.Fprintf(b, "master_repl_offset:%d\r\n", s.master.Offset())
+}
+
+func boolToInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/persist"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+var (
+	errTryAgain   = &replyError{code: "TRYAGAIN", msg: "Multiple keys request during rehashing of slot"}
+	errBusyKey    = &replyError{code: "BUSYKEY", msg: "Target key name already exists."}
+	errBadPayload = errors.New("dump payload version or checksum are wrong")
+)
+
+// dump 处理 DUMP key，返回条目的序列化负载。
+func (s *TCPServer) dump(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) != 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	entry, ok, err := s.database.Dump(ctx, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return protocol.NullValue(), nil
+	}
+	payload, err := persist.DumpEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.BulkStringValue(string(payload)), nil
+}
+
+// restore 处理 RESTORE key ttl payload [REPLACE] [ABSTTL]。
+// 传播到 AOF 与从节点的是等价的重建命令，回放端无需理解 DUMP 负载。
+func (s *TCPServer) restore(ctx context.Context, args []string, asking bool) (*protocol.Value, error) {
+	if len(args) < 4 {
+		return nil, db.ErrInvalidCommand
+	}
+	if err := s.freeMemory(ctx); err != nil {
+		return nil, err
+	}
+	var reply *protocol.Value
+	var err error
+	s.database.AtomicKeys(args[1:2], func(*db.Tx) {
+		if err = s.routeCommand(ctx, args, asking); err == nil {
+			reply, err = s.restoreLocked(ctx, args)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.afterWrite(ctx)
+	return reply, nil
+}
+
+// restoreLocked 执行 RESTORE 并传播，调用方需独占 key 所在分片的命令锁并已完成路由检查。
+func (s *TCPServer) restoreLocked(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) < 4 {
+		return nil, db.ErrInvalidCommand
+	}
+	if s.IsReplica() {
+		return nil, errReadOnly
+	}
+	key := args[1]
+	ttl, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || ttl < 0 {
+		return nil, errors.New("invalid TTL value, must be >= 0")
+	}
+	replace, absTTL := false, false
+	for _, option := range args[4:] {
+		switch strings.ToUpper(option) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return nil, db.ErrInvalidCommand
+		}
+	}
+	entry, err := persist.RestoreEntry([]byte(args[3]))
+	if err != nil {
+		return nil, errBadPayload
+	}
+	now := time.Now()
+	switch {
+	case ttl > 0 && absTTL:
+		entry.ExpireAt = time.UnixMilli(ttl)
+	case ttl > 0:
+		entry.ExpireAt = now.Add(time.Duration(ttl) * time.Millisecond)
+	}
+	if !entry.ExpireAt.IsZero() && !entry.ExpireAt.After(now) {
+		// 与 Redis 一致：已过期的负载视为成功，但不创建 key。
+		return protocol.OK(), nil
+	}
+	if err = s.database.Restore(ctx, key, entry, replace); err != nil {
+		if errors.Is(err, db.ErrBusyKey) {
+			return nil, errBusyKey
+		}
+		return nil, err
+	}
+	if replace {
+		s.propagate(ctx, []string{"DEL", key})
+	}
+	for _, command := range persist.RewriteCommands(map[string]*db.Entry{key: entry}, now) {
+		s.propagate(ctx, command)
+	}
+	return protocol.OK(), nil
+}
+
+// migrateRequest 解析后的 MIGRATE 参数。
+type migrateRequest struct {
+	addr     string
+	timeout  time.Duration
+	keys     []string
+	copyOnly bool
+	replace  bool
+}
+
+// migrate 处理 MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [KEYS key ...]。
+// 整个过程独占 keys 所在分片的命令锁：序列化、目标节点 RESTORE 成功与本地删除之间不会插入对这些 key 的命令，
+// 迁移对客户端而言是原子的。
+func (s *TCPServer) migrate(ctx context.Context, args []string) (*protocol.Value, error) {
+	req, err := s.parseMigrate(args)
+	if err != nil {
+		return nil, err
+	}
+	var reply *protocol.Value
+	s.database.AtomicKeys(req.keys, func(*db.Tx) {
+		reply, err = s.migrateLocked(ctx, req)
+	})
+	return reply, err
+}
+
+func (s *TCPServer) parseMigrate(args []string) (*migrateRequest, error) {
+	if len(args) < 6 {
+		return nil, db.ErrInvalidCommand
+	}
+	if s.IsReplica() {
+		return nil, errReadOnly
+	}
+	if args[4] != "0" {
+		return nil, errors.New("invalid destination db, only db 0 is supported")
+	}
+	timeoutMs, err := strconv.Atoi(args[5])
+	if err != nil || timeoutMs < 0 {
+		return nil, errors.New("invalid timeout")
+	}
+	req := &migrateRequest{
+		addr:    net.JoinHostPort(args[1], args[2]),
+		timeout: time.Duration(timeoutMs) * time.Millisecond,
+		keys:    []string{args[3]},
+	}
+	if req.timeout == 0 {
+		req.timeout = time.Second
+	}
+	for i := 6; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COPY":
+			req.copyOnly = true
+		case "REPLACE":
+			req.replace = true
+		case "KEYS":
+			if args[3] != "" {
+				return nil, errors.New("when using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			req.keys = args[i+1:]
+			i = len(args)
+		default:
+			return nil, db.ErrInvalidCommand
+		}
+	}
+	if len(req.keys) == 0 {
+		return nil, db.ErrInvalidCommand
+	}
+	return req, nil
+}
+
+// migrateLocked 把 req.keys 序列化后发往目标节点，成功后按需删除本地副本，调用方需独占 keys 所在分片的命令锁。
+func (s *TCPServer) migrateLocked(ctx context.Context, req *migrateRequest) (*protocol.Value, error) {
+	now := time.Now()
+	commands := make([][]string, 0, len(req.keys))
+	moved := make([]string, 0, len(req.keys))
+	for _, key := range req.keys {
+		entry, ok, dumpErr := s.database.Dump(ctx, key)
+		if dumpErr != nil {
+			return nil, dumpErr
+		}
+		if !ok {
+			continue
+		}
+		payload, dumpErr := persist.DumpEntry(entry)
+		if dumpErr != nil {
+			return nil, dumpErr
+		}
+		ttl := int64(0)
+		if !entry.ExpireAt.IsZero() {
+			if ttl = entry.ExpireAt.Sub(now).Milliseconds(); ttl < 1 {
+				ttl = 1
+			}
+		}
+		command := []string{"RESTORE-ASKING", key, strconv.FormatInt(ttl, 10), string(payload)}
+		if req.replace {
+			command = append(command, "REPLACE")
+		}
+		commands = append(commands, command)
+		moved = append(moved, key)
+	}
+	if len(moved) == 0 {
+		return protocol.SimpleStringValue("NOKEY"), nil
+	}
+	if err := sendRestoreCommands(ctx, req.addr, req.timeout, commands); err != nil {
+		return nil, err
+	}
+	if !req.copyOnly {
+		for _, key := range moved {
+			if _, err := s.database.Del(ctx, key); err != nil {
+				return nil, err
+			}
+		}
+		s.propagate(ctx, append([]string{"DEL"}, moved...))
+	}
+	return protocol.OK(), nil
+}
+
+// sendRestoreCommands 以流水线方式向目标节点发送 RESTORE 并校验全部回复。
+func sendRestoreCommands(ctx context.Context, addr string, timeout time.Duration, commands [][]string) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return &replyError{code: "IOERR", msg: "error or timeout connecting to the client"}
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	writer := bufio.NewWriter(conn)
+	for _, command := range commands {
+		_, _ = writer.Write(protocol.Serialize(protocol.CommandValue(command)))
+	}
+	if err = writer.Flush(); err != nil {
+		return &replyError{code: "IOERR", msg: "error or timeout writing to target instance"}
+	}
+	reader := bufio.NewReader(conn)
+	var firstErr error
+	for range commands {
+		reply, parseErr := protocol.Parse(reader)
+		if parseErr != nil {
+			return &replyError{code: "IOERR", msg: "error or timeout reading from target node"}
+		}
+		if reply.Type == protocol.ErrorType && firstErr == nil {
+			firstErr = fmt.Errorf("target instance replied with error: %s", reply.Str)
+		}
+	}
+	return firstErr
+}
+
+// routeCommand 在集群模式下校验命令路由，非集群模式直接放行。
+func (s *TCPServer) routeCommand(ctx context.Context, args []string, asking bool) error {
+	if s.cluster == nil {
+		return nil
+	}
+	return s.checkClusterRouting(ctx, args, asking)
+}
+
+// clusterSetSlot 处理 CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE node-id 与 CLUSTER SETSLOT slot STABLE。
+func (s *TCPServer) clusterSetSlot(args []string) (*protocol.Value, error) {
+	if len(args) < 4 {
+		return nil, db.ErrInvalidCommand
+	}
+	slot, err := cluster.ParseSlot(args[2])
+	if err != nil {
+		return nil, err
+	}
+	action := strings.ToUpper(args[3])
+	if action == "STABLE" {
+		s.cluster.SetStable(slot)
+		return protocol.OK(), nil
+	}
+	if len(args) != 5 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch action {
+	case "MIGRATING":
+		err = s.cluster.SetMigrating(slot, args[4])
+	case "IMPORTING":
+		err = s.cluster.SetImporting(slot, args[4])
+	case "NODE":
+		err = s.cluster.SetSlotNode(slot, args[4])
+	default:
+		return nil, db.ErrInvalidCommand
+	}
+	if err != nil {
+		return nil, err
+	}
+	return protocol.OK(), nil
+}
+
+// keysInSlot 返回本节点落在 slot 内的 key，limit 小于等于 0 表示不限制。
+func (s *TCPServer) keysInSlot(ctx context.Context, slot uint16, limit int) ([]string, error) {
+	keys, err := s.database.Keys(ctx, "*")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for _, key := range keys {
+		if cluster.KeyToSlot(key) != slot {
+			continue
+		}
+		result = append(result, key)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// monitorSkipCommands 不推送给 MONITOR 的管理类命令，与 Redis 对 admin 命令的处理一致。
+var monitorSkipCommands = map[string]struct{}{
+	"MONITOR": {}, "CONFIG": {}, "SLOWLOG": {}, "DEBUG": {},
+	"SAVE": {}, "BGSAVE": {}, "BGREWRITEAOF": {}, "REPLICAOF": {}, "SLAVEOF": {},
+	"SYNC": {}, "PSYNC": {}, "REPLCONF": {},
+}
+
+// monitor 处理 MONITOR：连接转为经输出缓冲异步写出，此后收到服务端执行的每条命令。
+func (s *TCPServer) monitor(client *Client) (*protocol.Value, error) {
+	if client.output == nil {
+		// 先写出写缓冲中已有的回复，此后全部输出都经由输出缓冲。
+		client.flushReplies()
+		client.output = newOutputBuffer(client.Conn, s.pubsubLimit, func(pending int64) {
+			s.logger.Warn("closing slow monitor", "client", client.ID, "addr", client.Conn.RemoteAddr().String(), "pending_bytes", pending)
+		})
+	}
+	client.mu.Lock()
+	client.monitor = true
+	client.mu.Unlock()
+	s.monitorsMu.Lock()
+	s.monitors[client] = struct{}{}
+	s.monitorsMu.Unlock()
+	return protocol.OK(), nil
+}
+
+func (s *TCPServer) removeMonitor(client *Client) {
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+	delete(s.monitors, client)
+}
+
+// feedMonitors 以 Redis MONITOR 的格式推送命令：+<unix 秒.微秒> [0 <addr>] "arg" ...
+func (s *TCPServer) feedMonitors(client *Client, args []string, now time.Time) {
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+	if len(s.monitors) == 0 {
+		return
+	}
+	if _, skip := monitorSkipCommands[strings.ToUpper(args[0])]; skip {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [0 %s]", now.Unix(), now.Nanosecond()/1000, client.Conn.RemoteAddr())
+	for _, arg := range args {
+		b.WriteByte(' ')
+		b.WriteString(quoteArg(arg))
+	}
+	line := protocol.SimpleStringValue(b.String())
+	for monitor := range s.monitors {
+		monitor.Deliver(line)
+	}
+}
+
+// quoteArg 按 Redis sdscatrepr 的规则加引号并转义不可打印字符。
+func quoteArg(arg string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				b.WriteString(`\x`)
+				b.WriteString(strconv.FormatUint(uint64(c)>>4, 16))
+				b.WriteString(strconv.FormatUint(uint64(c)&0xf, 16))
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
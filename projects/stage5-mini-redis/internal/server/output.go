@@ -0,0 +1,157 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// OutputBufferLimit 订阅连接的输出缓冲上限：积压超过 Hard 立即断开，
+// 持续超过 Soft 达到 SoftDuration 也会断开；字段为 0 表示不限制。
+type OutputBufferLimit struct {
+	Hard         int64
+	Soft         int64
+	SoftDuration time.Duration
+}
+
+// DefaultPubSubOutputLimit 与 Redis client-output-buffer-limit pubsub 默认值一致。
+var DefaultPubSubOutputLimit = OutputBufferLimit{Hard: 32 << 20, Soft: 8 << 20, SoftDuration: 60 * time.Second}
+
+// outputBuffer 连接的异步输出缓冲：入队不阻塞，由独立的写协程刷到连接。
+// 积压字节数超过限制时关闭连接，读循环随之退出，避免慢订阅者拖垮发布者或耗尽内存。
+type outputBuffer struct {
+	conn       net.Conn
+	limit      OutputBufferLimit
+	onOverflow func(pending int64)
+
+	mu        sync.Mutex
+	pending   [][]byte
+	size      int64
+	softSince time.Time
+	closed    bool
+	// idle 在积压全部写出或缓冲关闭时广播，供 flush 等待。
+	idle *sync.Cond
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newOutputBuffer(conn net.Conn, limit OutputBufferLimit, onOverflow func(pending int64)) *outputBuffer {
+	o := &outputBuffer{
+		conn:       conn,
+		limit:      limit,
+		onOverflow: onOverflow,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	o.idle = sync.NewCond(&o.mu)
+	go o.run()
+	return o
+}
+
+// enqueue 追加待写数据，超出限制时断开连接并丢弃积压。
+func (o *outputBuffer) enqueue(payload []byte) {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return
+	}
+	o.pending = append(o.pending, payload)
+	o.size += int64(len(payload))
+	overflow := o.overLimitLocked(time.Now())
+	size := o.size
+	if overflow {
+		o.closed = true
+		o.pending = nil
+		o.idle.Broadcast()
+	}
+	o.mu.Unlock()
+
+	if overflow {
+		if o.onOverflow != nil {
+			o.onOverflow(size)
+		}
+		_ = o.conn.Close()
+		return
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// overLimitLocked 判断积压是否触发硬限制或持续超过软限制，调用方需持有锁。
+func (o *outputBuffer) overLimitLocked(now time.Time) bool {
+	if o.limit.Hard > 0 && o.size > o.limit.Hard {
+		return true
+	}
+	if o.limit.Soft <= 0 || o.size <= o.limit.Soft {
+		o.softSince = time.Time{}
+		return false
+	}
+	if o.softSince.IsZero() {
+		o.softSince = now
+		return false
+	}
+	return now.Sub(o.softSince) >= o.limit.SoftDuration
+}
+
+// flush 等待已入队的数据全部写出，缓冲关闭（连接出错或溢出）时提前返回。
+func (o *outputBuffer) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for o.size > 0 && !o.closed {
+		o.idle.Wait()
+	}
+}
+
+// close 停止写协程，连接本身由调用方关闭。
+func (o *outputBuffer) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		o.pending = nil
+		o.idle.Broadcast()
+	}
+	select {
+	case <-o.done:
+	default:
+		close(o.done)
+	}
+}
+
+func (o *outputBuffer) run() {
+	for {
+		select {
+		case <-o.wake:
+		case <-o.done:
+			return
+		}
+		for {
+			o.mu.Lock()
+			batch := o.pending
+			o.pending = nil
+			closed := o.closed
+			o.mu.Unlock()
+			if closed || len(batch) == 0 {
+				break
+			}
+			buffers := net.Buffers(batch)
+			written, err := buffers.WriteTo(o.conn)
+			o.mu.Lock()
+			o.size -= written
+			if err != nil {
+				o.closed = true
+				o.pending = nil
+			}
+			if o.size == 0 || o.closed {
+				o.idle.Broadcast()
+			}
+			o.mu.Unlock()
+			if err != nil {
+				_ = o.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/persist"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+var (
+	errAOFDisabled = errors.New("aof is disabled")
+	errRDBDisabled = errors.New("rdb is disabled")
+	errBgSaving    = errors.New("background save already in progress")
+)
+
+// EnableAOF 开启 AOF，写命令执行成功后追加到 aof。
+func (s *TCPServer) EnableAOF(aof *persist.AOF) {
+	s.aof = aof
+}
+
+// EnableRDB 开启 RDB 快照，SAVE/BGSAVE 写入 path。
+func (s *TCPServer) EnableRDB(path string) {
+	s.rdbPath = path
+}
+
+func (s *TCPServer) bgRewriteAOF(ctx context.Context) (*protocol.Value, error) {
+	var reply *protocol.Value
+	var err error
+	s.database.Atomic(func(*db.Tx) {
+		reply, err = s.bgRewriteAOFLocked(ctx)
+	})
+	return reply, err
+}
+
+// bgRewriteAOFLocked 是 BGREWRITEAOF 的实现，调用方需独占全部分片的命令锁（EXEC 中直接调用）。
+func (s *TCPServer) bgRewriteAOFLocked(ctx context.Context) (*protocol.Value, error) {
+	if s.aof == nil {
+		return nil, errAOFDisabled
+	}
+	if err := s.startRewriteLocked(ctx); err != nil {
+		return nil, err
+	}
+	return protocol.SimpleStringValue("Background append only file rewriting started"), nil
+}
+
+// startRewriteLocked 获取快照并开启重写缓冲，调用方需独占全部分片的命令锁：
+// 此时没有已执行但尚未追加到 AOF 的写命令，快照与重写缓冲之间不会重复或遗漏命令。
+func (s *TCPServer) startRewriteLocked(ctx context.Context) error {
+	if err := s.aof.BeginRewrite(); err != nil {
+		return err
+	}
+	snapshot := s.database.Snapshot()
+	go func() {
+		started := time.Now()
+		if err := s.aof.FinishRewrite(snapshot); err != nil {
+			s.logger.Error("aof rewrite failed", "error", err)
+			return
+		}
+		s.logger.Info("aof rewrite finished", "size", s.aof.Size(), "elapsed", time.Since(started))
+	}()
+	return nil
+}
+
+func (s *TCPServer) save(ctx context.Context) (*protocol.Value, error) {
+	if s.rdbPath == "" {
+		return nil, errRDBDisabled
+	}
+	if s.bgSaving.Load() {
+		return nil, errBgSaving
+	}
+	dirty := s.database.Stats().Dirty
+	if err := persist.SaveSnapshot(ctx, s.rdbPath, s.database.Snapshot()); err != nil {
+		return nil, err
+	}
+	s.lastSave.Store(time.Now().Unix())
+	s.dirtyAtSave.Store(dirty)
+	return protocol.OK(), nil
+}
+
+func (s *TCPServer) bgSave(ctx context.Context) (*protocol.Value, error) {
+	if s.rdbPath == "" {
+		return nil, errRDBDisabled
+	}
+	if !s.bgSaving.CompareAndSwap(false, true) {
+		return nil, errBgSaving
+	}
+	dirty := s.database.Stats().Dirty
+	snapshot := s.database.Snapshot()
+	go func() {
+		defer s.bgSaving.Store(false)
+		started := time.Now()
+		if err := persist.SaveSnapshot(ctx, s.rdbPath, snapshot); err != nil {
+			s.logger.Error("background save failed", "error", err)
+			return
+		}
+		s.lastSave.Store(time.Now().Unix())
+		s.dirtyAtSave.Store(dirty)
+		s.logger.Info("background save finished", "path", s.rdbPath, "keys", len(snapshot), "elapsed", time.Since(started))
+	}()
+	return protocol.SimpleStringValue("Background saving started"), nil
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+// subscriberCommands RESP2 订阅模式下仍允许执行的命令。
+var subscriberCommands = map[string]struct{}{
+	"SUBSCRIBE":    {},
+	"PSUBSCRIBE":   {},
+	"UNSUBSCRIBE":  {},
+	"PUNSUBSCRIBE": {},
+	"PING":         {},
+}
+
+// SetPubSubOutputLimit 设置订阅连接的输出缓冲上限，需在 Start 前调用。
+func (s *TCPServer) SetPubSubOutputLimit(limit OutputBufferLimit) {
+	s.pubsubLimit = limit
+}
+
+// checkSubscriberMode RESP2 连接在订阅模式下只能执行订阅相关命令与 PING；RESP3 通过 Push 类型区分消息，不受限制。
+func (s *TCPServer) checkSubscriberMode(client *Client, cmd string) error {
+	if client.Protocol() >= 3 || s.pubsub.Count(client) == 0 {
+		return nil
+	}
+	if _, ok := subscriberCommands[cmd]; ok {
+		return nil
+	}
+	return &replyError{code: "ERR", msg: fmt.Sprintf("Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context", strings.ToLower(cmd))}
+}
+
+// subscribe 处理 SUBSCRIBE/PSUBSCRIBE，每个频道各回复一条确认，确认与消息经同一输出缓冲保证有序。
+func (s *TCPServer) subscribe(client *Client, args []string, pattern bool) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	if client.output == nil {
+		// 此前写入写缓冲的回复必须先于输出缓冲中的内容写出。
+		client.flushReplies()
+		client.output = newOutputBuffer(client.Conn, s.pubsubLimit, func(pending int64) {
+			s.logger.Warn("closing slow subscriber", "client", client.ID, "addr", client.Conn.RemoteAddr().String(), "pending_bytes", pending)
+		})
+	}
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+	for _, name := range args[1:] {
+		var count int
+		if pattern {
+			count = s.pubsub.PSubscribe(client, name)
+		} else {
+			count = s.pubsub.Subscribe(client, name)
+		}
+		client.reply(subscriptionReply(kind, protocol.BulkStringValue(name), count))
+	}
+	return nil, nil
+}
+
+// unsubscribe 处理 UNSUBSCRIBE/PUNSUBSCRIBE，不带参数时退订全部。
+func (s *TCPServer) unsubscribe(client *Client, args []string, pattern bool) (*protocol.Value, error) {
+	kind := "unsubscribe"
+	names := args[1:]
+	if pattern {
+		kind = "punsubscribe"
+		if len(names) == 0 {
+			names = s.pubsub.Patterns(client)
+		}
+	} else if len(names) == 0 {
+		names = s.pubsub.Channels(client)
+	}
+	if len(names) == 0 {
+		client.reply(subscriptionReply(kind, protocol.NullValue(), s.pubsub.Count(client)))
+		return nil, nil
+	}
+	for _, name := range names {
+		var count int
+		if pattern {
+			count = s.pubsub.PUnsubscribe(client, name)
+		} else {
+			count = s.pubsub.Unsubscribe(client, name)
+		}
+		client.reply(subscriptionReply(kind, protocol.BulkStringValue(name), count))
+	}
+	return nil, nil
+}
+
+func subscriptionReply(kind string, name *protocol.Value, count int) *protocol.Value {
+	return protocol.PushValue(*protocol.BulkStringValue(kind), *name, *protocol.IntegerValue(int64(count)))
+}
+
+// publish 处理 PUBLISH channel message，返回接收者数量。
+func (s *TCPServer) publish(args []string) (*protocol.Value, error) {
+	if len(args) != 3 {
+		return nil, db.ErrInvalidCommand
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.publishLocked(args), nil
+}
+
+// publishLocked 本地扇出消息，调用方需持有 writeMu，使 PUBLISH 与写命令在复制流中的顺序确定。
+// 主节点把 PUBLISH 传播给从节点（不写 AOF），使订阅从节点的客户端同样收到失效通知；
+// 从节点上客户端直接 PUBLISH 只在本地扇出，避免打乱复制偏移。集群模式下消息只在本节点扇出。
+func (s *TCPServer) publishLocked(args []string) *protocol.Value {
+	receivers := s.pubsub.Publish(args[1], args[2])
+	if !s.IsReplica() {
+		s.master.Broadcast(string(protocol.Serialize(protocol.CommandValue(args))))
+	}
+	return protocol.IntegerValue(int64(receivers))
+}
+
+// pubsubCommand 处理 PUBSUB CHANNELS [pattern] / NUMSUB [channel ...] / NUMPAT。
+func (s *TCPServer) pubsubCommand(args []string) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch strings.ToUpper(args[1]) {
+	case "CHANNELS":
+		if len(args) > 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		pattern := ""
+		if len(args) == 3 {
+			pattern = args[2]
+		}
+		return protocol.StringArray(s.pubsub.ActiveChannels(pattern)), nil
+	case "NUMSUB":
+		items := make([]protocol.Value, 0, (len(args)-2)*2)
+		for _, channel := range args[2:] {
+			items = append(items, *protocol.BulkStringValue(channel), *protocol.IntegerValue(int64(s.pubsub.NumSub(channel))))
+		}
+		return protocol.ArrayValue(items...), nil
+	case "NUMPAT":
+		if len(args) != 2 {
+			return nil, db.ErrInvalidCommand
+		}
+		return protocol.IntegerValue(int64(s.pubsub.NumPat())), nil
+	default:
+		return nil, db.ErrInvalidCommand
+	}
+}
+
+// subscriberPing RESP2 订阅模式下 PING 以 ["pong", message] 数组回复。
+func subscriberPing(args []string) *protocol.Value {
+	message := ""
+	if len(args) >= 2 {
+		message = args[1]
+	}
+	return protocol.ArrayValue(*protocol.BulkStringValue("pong"), *protocol.BulkStringValue(message))
+}
+
+// publishReplicated 从节点收到主节点传播的 PUBLISH 时本地扇出，并继续传给级联从节点。
+func (s *TCPServer) publishReplicated(args []string) error {
+	if len(args) != 3 {
+		return db.ErrInvalidCommand
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.pubsub.Publish(args[1], args[2])
+	s.master.Broadcast(string(protocol.Serialize(protocol.CommandValue(args))))
+	return nil
+}
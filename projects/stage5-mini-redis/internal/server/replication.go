@@ -0,0 +1,380 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/persist"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/replication"
+)
+
+const (
+	replicaRetryInterval = time.Second
+	replicaAckInterval   = time.Second
+	replicaWriteTimeout  = 10 * time.Second
+)
+
+var errReplicationProtocol = errors.New("unexpected replication reply")
+
+// IsReplica 返回当前是否为从节点。
+func (s *TCPServer) IsReplica() bool {
+	s.replMu.Lock()
+	defer s.replMu.Unlock()
+	return s.slave != nil
+}
+
+// ReplicaOf 成为 host:port 的从节点，已有复制链路会被替换。
+func (s *TCPServer) ReplicaOf(ctx context.Context, host string, port int) {
+	s.replMu.Lock()
+	defer s.replMu.Unlock()
+	if s.slave != nil && s.slave.MasterHost() == host && s.slave.MasterPort() == port {
+		return
+	}
+	if s.replicaCancel != nil {
+		s.replicaCancel()
+	}
+	slave := replication.NewSlave(host, port)
+	slave.Reset(s.master.Offset())
+	linkCtx, cancel := context.WithCancel(ctx)
+	s.slave = slave
+	s.replicaCancel = cancel
+	go s.runReplication(linkCtx, slave)
+	s.logger.Info("replication enabled", "master", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// PromoteToMaster 断开复制链路并晋升为主节点（REPLICAOF NO ONE）。
+func (s *TCPServer) PromoteToMaster() {
+	s.replMu.Lock()
+	defer s.replMu.Unlock()
+	if s.slave == nil {
+		return
+	}
+	s.replicaCancel()
+	s.slave = nil
+	s.replicaCancel = nil
+	s.master.Promote()
+	s.logger.Info("promoted to master", "replid", s.master.ReplID(), "offset", s.master.Offset())
+}
+
+func (s *TCPServer) replicaOfCommand(ctx context.Context, args []string) (*protocol.Value, error) {
+	if len(args) != 3 {
+		return nil, db.ErrInvalidCommand
+	}
+	if strings.EqualFold(args[1], "NO") && strings.EqualFold(args[2], "ONE") {
+		s.PromoteToMaster()
+		return protocol.OK(), nil
+	}
+	port, err := strconv.Atoi(args[2])
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, errors.New("invalid master port")
+	}
+	s.ReplicaOf(ctx, args[1], port)
+	return protocol.OK(), nil
+}
+
+func (s *TCPServer) replconf(client *Client, args []string) (*protocol.Value, error) {
+	if len(args) < 3 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch strings.ToLower(args[1]) {
+	case "listening-port":
+		client.ListeningPort = args[2]
+	}
+	return protocol.OK(), nil
+}
+
+// serveReplica 处理 PSYNC：按需全量同步，然后持续把 backlog 中的写命令推送给从节点。
+func (s *TCPServer) serveReplica(ctx context.Context, client *Client, reader *bufio.Reader, args []string) {
+	replID, offset := "?", int64(-1)
+	if len(args) >= 3 {
+		replID = args[1]
+		if parsed, err := strconv.ParseInt(args[2], 10, 64); err == nil {
+			offset = parsed
+		}
+	}
+
+	// 独占全部命令锁并持有 writeMu：快照与复制偏移之间没有尚未传播的写命令或 PUBLISH。
+	var full bool
+	var snapshot map[string]*db.Entry
+	var currentID string
+	s.database.Atomic(func(*db.Tx) {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		full = !s.master.CanPartialSync(replID, offset)
+		if full {
+			snapshot = s.database.Snapshot()
+			offset = s.master.Offset()
+		}
+		currentID = s.master.ReplID()
+	})
+
+	conn := client.Conn
+	var header bytes.Buffer
+	if full {
+		var payload bytes.Buffer
+		if err := persist.EncodeSnapshot(&payload, snapshot); err != nil {
+			s.logger.Error("encode snapshot for replica failed", "error", err)
+			return
+		}
+		fmt.Fprintf(&header, "+FULLRESYNC %s %d\r\n$%d\r\n", currentID, offset, payload.Len())
+		header.Write(payload.Bytes())
+	} else {
+		fmt.Fprintf(&header, "+CONTINUE %s\r\n", currentID)
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(replicaWriteTimeout))
+	if _, err := conn.Write(header.Bytes()); err != nil {
+		return
+	}
+
+	id := client.replicaID()
+	s.master.RegisterSlave(id)
+	s.master.Ack(id, offset)
+	defer s.master.UnregisterSlave(id)
+	s.logger.Info("replica attached", "replica", id, "full_sync", full, "offset", offset)
+
+	linkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// 从节点只会发送 REPLCONF ACK，读失败即视为链路断开。
+		defer cancel()
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+			value, err := protocol.Parse(reader)
+			if err != nil {
+				return
+			}
+			ackArgs, err := protocol.CommandArgs(value)
+			if err != nil || len(ackArgs) < 3 || !strings.EqualFold(ackArgs[0], "REPLCONF") || !strings.EqualFold(ackArgs[1], "ACK") {
+				continue
+			}
+			if ackOffset, parseErr := strconv.ParseInt(ackArgs[2], 10, 64); parseErr == nil {
+				s.master.Ack(id, ackOffset)
+			}
+		}
+	}()
+	go func() {
+		<-linkCtx.Done()
+		_ = conn.Close()
+	}()
+
+	for {
+		changed := s.master.Changed()
+		if s.master.ReplID() != currentID {
+			// 本节点已转为跟随其他主节点，历史不再连续，断开让从节点重新同步。
+			return
+		}
+		entries, ok := s.master.Since(offset)
+		if !ok {
+			s.logger.Warn("replica fell out of backlog", "replica", id, "offset", offset)
+			return
+		}
+		if len(entries) > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(replicaWriteTimeout))
+			if _, err := io.WriteString(conn, strings.Join(entries, "")); err != nil {
+				return
+			}
+			offset += int64(len(entries))
+		}
+		select {
+		case <-changed:
+		case <-linkCtx.Done():
+			return
+		}
+	}
+}
+
+// runReplication 维持到主节点的复制链路，断线后按当前位点重试 PSYNC。
+func (s *TCPServer) runReplication(ctx context.Context, slave *replication.Slave) {
+	for {
+		err := s.syncWithMaster(ctx, slave)
+		if ctx.Err() != nil {
+			return
+		}
+		slave.SetState(replication.LinkConnecting)
+		s.logger.Warn("replication link lost", "master", net.JoinHostPort(slave.MasterHost(), strconv.Itoa(slave.MasterPort())), "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(replicaRetryInterval):
+		}
+	}
+}
+
+func (s *TCPServer) syncWithMaster(ctx context.Context, slave *replication.Slave) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(slave.MasterHost(), strconv.Itoa(slave.MasterPort())))
+	if err != nil {
+		return err
+	}
+	linkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-linkCtx.Done()
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	if user, password := s.masterCredentials(); password != "" {
+		auth := []string{"AUTH", password}
+		if user != "" {
+			auth = []string{"AUTH", user, password}
+		}
+		if err = replicaHandshake(conn, reader, auth); err != nil {
+			return err
+		}
+	}
+	if err = replicaHandshake(conn, reader, []string{"PING"}); err != nil {
+		return err
+	}
+	listenAddr := s.Addr()
+	if listenAddr == "" {
+		listenAddr = s.addr
+	}
+	if _, port, splitErr := net.SplitHostPort(listenAddr); splitErr == nil {
+		if err = replicaHandshake(conn, reader, []string{"REPLCONF", "listening-port", port}); err != nil {
+			return err
+		}
+	}
+
+	slave.SetState(replication.LinkSync)
+	psync := []string{"PSYNC", s.master.ReplID(), strconv.FormatInt(s.master.Offset(), 10)}
+	if _, err = conn.Write(protocol.Serialize(protocol.CommandValue(psync))); err != nil {
+		return err
+	}
+	line, err := readReplicationLine(reader)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, parseErr := strconv.ParseInt(fields[2], 10, 64)
+		if parseErr != nil {
+			return parseErr
+		}
+		if err = s.loadFromMaster(ctx, reader, fields[1], offset); err != nil {
+			return err
+		}
+		slave.Reset(offset)
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		if len(fields) == 2 && fields[1] != s.master.ReplID() {
+			s.master.Follow(fields[1], s.master.Offset())
+		}
+	default:
+		return fmt.Errorf("%w: %q", errReplicationProtocol, line)
+	}
+	slave.SetState(replication.LinkConnected)
+	s.logger.Info("replication link established", "master", conn.RemoteAddr().String(), "offset", s.master.Offset())
+
+	go func() {
+		ticker := time.NewTicker(replicaAckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-linkCtx.Done():
+				return
+			case <-ticker.C:
+				ack := []string{"REPLCONF", "ACK", strconv.FormatInt(slave.Offset(), 10)}
+				if _, writeErr := conn.Write(protocol.Serialize(protocol.CommandValue(ack))); writeErr != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		value, parseErr := protocol.Parse(reader)
+		if parseErr != nil {
+			return parseErr
+		}
+		args, argsErr := protocol.CommandArgs(value)
+		if argsErr != nil {
+			return argsErr
+		}
+		if err = s.applyReplicated(ctx, args); err != nil {
+			s.logger.Error("apply replicated command failed", "command", args[0], "error", err)
+		}
+		slave.Ack(s.master.Offset())
+	}
+}
+
+// loadFromMaster 读取主节点发送的 RDB 负载并替换本地数据集。
+func (s *TCPServer) loadFromMaster(ctx context.Context, reader *bufio.Reader, replID string, offset int64) error {
+	line, err := readReplicationLine(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return fmt.Errorf("%w: %q", errReplicationProtocol, line)
+	}
+	size, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return err
+	}
+	snapshot, err := persist.DecodeSnapshot(io.LimitReader(reader, int64(size)))
+	if err != nil {
+		return err
+	}
+
+	s.database.Atomic(func(*db.Tx) {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		s.database.LoadSnapshot(snapshot)
+		s.master.Follow(replID, offset)
+		if s.aof != nil {
+			// 数据集被整体替换，旧 AOF 已无意义，立即基于新数据集重写。
+			if rewriteErr := s.startRewriteLocked(ctx); rewriteErr != nil {
+				s.logger.Error("rewrite aof after full sync failed", "error", rewriteErr)
+			}
+		}
+	})
+	s.logger.Info("full resync finished", "keys", len(snapshot), "replid", replID, "offset", offset)
+	return nil
+}
+
+// applyReplicated 执行主节点推送的写命令，并继续写入本地 AOF 与 backlog 以支持级联复制。
+func (s *TCPServer) applyReplicated(ctx context.Context, args []string) error {
+	if strings.EqualFold(args[0], "PUBLISH") {
+		return s.publishReplicated(args)
+	}
+	var err error
+	s.database.AtomicKeys(db.CommandKeys(args), func(tx *db.Tx) {
+		_, err = tx.ExecuteCommand(ctx, args)
+		s.propagate(ctx, args)
+	})
+	s.afterWrite(ctx)
+	return err
+}
+
+func replicaHandshake(conn net.Conn, reader *bufio.Reader, command []string) error {
+	if _, err := conn.Write(protocol.Serialize(protocol.CommandValue(command))); err != nil {
+		return err
+	}
+	value, err := protocol.Parse(reader)
+	if err != nil {
+		return err
+	}
+	if value.Type == protocol.ErrorType {
+		return fmt.Errorf("%s: %s", command[0], value.Str)
+	}
+	return nil
+}
+
+func readReplicationLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
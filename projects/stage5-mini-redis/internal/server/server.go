@@ -3,15 +3,23 @@ package server
 import (
 	"bufio"
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/acl"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/monitoring"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/persist"
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/pubsub"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/replication"
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ttl"
 )
 
@@ -21,14 +29,82 @@ type TCPServer struct {
 	database   *db.DB
 	ttlManager *ttl.Manager
 	logger     *slog.Logger
+	aof        *persist.AOF
+	rdbPath    string
+	master     *replication.Master
+	cluster    *cluster.State
+	clusterBus *cluster.Bus
+	pubsub     *pubsub.Hub
+	blocking   *blockingRegistry
+	acl        *acl.ACL
+	// aclFile 为 ACL LOAD/SAVE 使用的文件，空表示未配置。
+	aclFile string
+	// pubsubLimit 订阅连接的输出缓冲上限，超出后断开慢订阅者。
+	pubsubLimit OutputBufferLimit
 
-	listener net.Listener
-	wg       sync.WaitGroup
+	// replMu 保护从节点状态，slave 非空表示当前为只读从节点。
+	replMu        sync.Mutex
+	slave         *replication.Slave
+	replicaCancel context.CancelFunc
+	// masterUser 与 masterAuth 为连接需要认证的主节点时使用的凭据。
+	masterUser string
+	masterAuth string
+
+	// writeMu 只保证 AOF 与复制流中的命令顺序一致，不覆盖命令执行；写命令之间的互斥由 DB 的分片命令锁负责。
+	writeMu      sync.Mutex
+	listenerMu   sync.Mutex
+	listener     net.Listener
+	wg           sync.WaitGroup
+	connected    atomic.Int64
+	nextClientID atomic.Int64
+	bgSaving     atomic.Bool
+	lastSave     atomic.Int64
+	// dirtyAtSave 为上次成功保存快照时 DB 的累计修改次数，用于 rdb_changes_since_last_save。
+	dirtyAtSave atomic.Int64
+
+	clientsMu  sync.Mutex
+	clients    map[int64]*Client
+	monitorsMu sync.Mutex
+	monitors   map[*Client]struct{}
+	stats      *serverStats
+	slowlog    *slowlog
+	// configMu 串行化 CONFIG SET，避免并发修改同一组参数时互相覆盖。
+	configMu sync.Mutex
 }
 
 // NewTCPServer 创建 TCP 服务。
 func NewTCPServer(addr string, database *db.DB, ttlManager *ttl.Manager, logger *slog.Logger) *TCPServer {
-	return &TCPServer{addr: addr, database: database, ttlManager: ttlManager, logger: logger}
+	srv := &TCPServer{
+		addr:        addr,
+		database:    database,
+		ttlManager:  ttlManager,
+		logger:      logger,
+		master:      replication.NewMaster(),
+		pubsub:      pubsub.NewHub(),
+		blocking:    newBlockingRegistry(),
+		acl:         acl.New(),
+		pubsubLimit: DefaultPubSubOutputLimit,
+		clients:     make(map[int64]*Client),
+		monitors:    make(map[*Client]struct{}),
+		stats:       newServerStats(),
+		slowlog:     newSlowlog(DefaultSlowlogThreshold, DefaultSlowlogMaxLen),
+	}
+	srv.lastSave.Store(time.Now().Unix())
+	// keyspace 通知经 Hub 发布给订阅 __keyspace@0__ / __keyevent@0__ 频道的连接，只在本节点产生，不传播。
+	database.SetNotifier(func(channel, message string) {
+		srv.pubsub.Publish(channel, message)
+	})
+	return srv
+}
+
+// Addr 返回实际监听地址，未启动时返回空字符串。
+func (s *TCPServer) Addr() string {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
 }
 
 // Start 启动服务。
@@ -44,13 +120,27 @@ func (s *TCPServer) Start(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	s.listenerMu.Lock()
 	s.listener = ln
-	s.logger.Info("mini-redis server started", "addr", s.addr)
+	s.listenerMu.Unlock()
+	s.logger.Info("mini-redis server started", "addr", ln.Addr().String())
 
 	go s.ttlManager.Start(ctx, 100*time.Millisecond)
+	go s.stats.run(ctx)
+	if s.cluster != nil {
+		s.cluster.SetMyAddr(ln.Addr().String(), s.clusterBus.Addr())
+		go s.clusterBus.Serve(ctx)
+	}
+	if s.aof != nil {
+		go s.aof.Run(ctx)
+	}
 	go func() {
 		<-ctx.Done()
 		_ = ln.Close()
+		// 关闭已有连接，使阻塞在读上的连接（复制链路、哨兵、订阅者等）退出，下面的 wg.Wait 才能返回。
+		for _, client := range s.clientList() {
+			_ = client.Conn.Close()
+		}
 	}()
 
 	for {
@@ -71,9 +161,37 @@ func (s *TCPServer) Start(ctx context.Context) error {
 func (s *TCPServer) handleConn(ctx context.Context, conn net.Conn) {
 	defer s.wg.Done()
 	defer func() { _ = conn.Close() }()
+	s.connected.Add(1)
+	defer s.connected.Add(-1)
+	s.stats.totalConnections.Add(1)
 
+	client := newClient(conn, s.nextClientID.Add(1))
+	if s.acl.DefaultNoPass() {
+		client.setUser(acl.DefaultUser)
+	}
+	s.addClient(client)
+	if ctx.Err() != nil {
+		// 关闭时的连接清理可能早于 addClient，此时不再服务该连接。
+		s.removeClient(client)
+		return
+	}
+	defer func() {
+		s.removeClient(client)
+		s.removeMonitor(client)
+		s.unwatch(client)
+		s.pubsub.Remove(client)
+		if client.output != nil {
+			client.output.close()
+		}
+	}()
 	reader := bufio.NewReader(conn)
+	client.reader = reader
+	client.writer = bufio.NewWriter(conn)
 	for {
+		// pipeline 中已读入的命令全部处理完（读缓冲取空）后才写出回复，一批请求只需一次写系统调用。
+		if reader.Buffered() == 0 {
+			client.flushReplies()
+		}
 		if err := conn.SetReadDeadline(time.Now().Add(10 * time.Minute)); err != nil {
 			return
 		}
@@ -82,11 +200,11 @@ func (s *TCPServer) handleConn(ctx context.Context, conn net.Conn) {
 			if err == io.EOF || strings.Contains(err.Error(), "closed") {
 				return
 			}
-			_, _ = conn.Write(protocol.Serialize(&protocol.Value{Type: protocol.ErrorType, Str: "ERR invalid protocol"}))
+			client.reply(protocol.ErrorValue("ERR invalid protocol"))
 			continue
 		}
 		if value.Type != protocol.Array {
-			_, _ = conn.Write(protocol.Serialize(&protocol.Value{Type: protocol.ErrorType, Str: "ERR command must be array"}))
+			client.reply(protocol.ErrorValue("ERR command must be array"))
 			continue
 		}
 
@@ -94,12 +212,272 @@ func (s *TCPServer) handleConn(ctx context.Context, conn net.Conn) {
 		for _, item := range value.Array {
 			args = append(args, item.Str)
 		}
+		if len(args) > 0 && (strings.EqualFold(args[0], "PSYNC") || strings.EqualFold(args[0], "SYNC")) {
+			if err := s.authorize(client, args); err != nil {
+				client.reply(protocol.ErrorValue(errorReply(err)))
+				continue
+			}
+			// 连接转为复制链路，由 serveReplica 接管直到断开。
+			client.flushReplies()
+			client.mu.Lock()
+			client.replica = true
+			client.mu.Unlock()
+			s.serveReplica(ctx, client, reader, args)
+			return
+		}
 
-		result, execErr := s.database.ExecuteCommand(ctx, args)
-		if execErr != nil {
-			_, _ = conn.Write(protocol.Serialize(&protocol.Value{Type: protocol.ErrorType, Str: "ERR " + execErr.Error()}))
-			continue
+		result := s.call(ctx, client, args)
+		if result != nil {
+			// 订阅类命令会逐条写出回复并返回 nil。
+			client.reply(result)
+		}
+		if client.closeAfterReply {
+			client.flushReplies()
+			if client.output != nil {
+				client.output.flush()
+			}
+			return
+		}
+	}
+}
+
+// call 检查权限后执行一条命令并记录统计：推送给 MONITOR、计入命令总数，
+// 执行耗时（不含阻塞等待）达到阈值时写入慢日志。事务中排队的命令不计入慢日志，密码参数在两者中都被隐藏。
+// 事务中被拒绝的命令与排队失败一样，使 EXEC 返回 EXECABORT。
+func (s *TCPServer) call(ctx context.Context, client *Client, args []string) *protocol.Value {
+	if err := s.authorize(client, args); err != nil {
+		if client.tx != nil {
+			client.tx.dirty = true
 		}
-		_, _ = conn.Write(protocol.Serialize(&protocol.Value{Type: protocol.BulkString, Str: result}))
+		return protocol.ErrorValue(errorReply(err))
+	}
+	started := time.Now()
+	logged := redactArgs(args)
+	if len(args) > 0 {
+		s.feedMonitors(client, logged, started)
+	}
+	inTx := client.tx != nil
+	client.blockedTime = 0
+	result, err := s.execute(ctx, client, args)
+	elapsed := time.Since(started) - client.blockedTime
+	if err != nil {
+		result = protocol.ErrorValue(errorReply(err))
+	}
+	s.stats.totalCommands.Add(1)
+	if len(args) > 0 {
+		client.recordCommand(strings.ToLower(args[0]))
+		if !inTx || client.tx == nil {
+			s.slowlog.record(client, logged, elapsed, started)
+		}
+	}
+	return result
+}
+
+// Metrics 采集当前服务指标。
+func (s *TCPServer) Metrics() monitoring.Metrics {
+	var aofSize uint64
+	if s.aof != nil {
+		aofSize = uint64(s.aof.Size())
+	}
+	return monitoring.Snapshot(uint64(s.stats.opsPerSec()), int(s.connected.Load()), 0, aofSize)
+}
+
+func (s *TCPServer) execute(ctx context.Context, client *Client, args []string) (*protocol.Value, error) {
+	if len(args) == 0 {
+		return nil, db.ErrInvalidCommand
+	}
+	asking := client.Asking
+	client.Asking = false
+	cmd := strings.ToUpper(args[0])
+	if err := s.checkSubscriberMode(client, cmd); err != nil {
+		return nil, err
+	}
+	if client.tx != nil {
+		switch cmd {
+		case "MULTI", "EXEC", "DISCARD", "WATCH":
+		default:
+			return s.queueCommand(ctx, client, args, asking)
+		}
+	}
+	switch cmd {
+	case "MULTI":
+		return s.multi(client)
+	case "EXEC":
+		return s.exec(ctx, client)
+	case "DISCARD":
+		return s.discard(client)
+	case "WATCH":
+		return s.watch(ctx, client, args, asking)
+	case "UNWATCH":
+		s.unwatch(client)
+		return protocol.OK(), nil
+	case "PING":
+		if client.Protocol() < 3 && s.pubsub.Count(client) > 0 {
+			return subscriberPing(args), nil
+		}
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		return s.subscribe(client, args, cmd == "PSUBSCRIBE")
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return s.unsubscribe(client, args, cmd == "PUNSUBSCRIBE")
+	case "HELLO":
+		return s.hello(client, args)
+	case "AUTH":
+		return s.auth(client, args)
+	case "XREAD", "XREADGROUP":
+		return s.streamRead(ctx, client, args, asking)
+	case "BLPOP", "BRPOP", "BLMOVE":
+		return s.blockingPop(ctx, client, args, asking)
+	case "DUMP":
+		var result *protocol.Value
+		var err error
+		s.database.AtomicCommand(args, func(*db.Tx) {
+			if err = s.routeCommand(ctx, args, asking); err == nil {
+				result, err = s.dump(ctx, args)
+			}
+		})
+		return result, err
+	case "RESTORE":
+		return s.restore(ctx, args, asking)
+	case "RESTORE-ASKING":
+		return s.restore(ctx, args, true)
+	case "MIGRATE":
+		return s.migrate(ctx, args)
+	case "BGREWRITEAOF":
+		return s.bgRewriteAOF(ctx)
+	case "REPLICAOF", "SLAVEOF":
+		return s.replicaOfCommand(ctx, args)
+	case "MONITOR":
+		return s.monitor(client)
+	}
+	if result, ok, err := s.serverCommand(ctx, client, cmd, args); ok {
+		return result, err
+	}
+	write := db.IsWriteCommand(args[0])
+	if write && s.IsReplica() {
+		return nil, errReadOnly
+	}
+	if db.IsDenyOOMCommand(args[0]) {
+		if err := s.freeMemory(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// 命令持有 key 所在分片的命令锁（读共享、写独占）完成路由检查、执行与传播：检查之后 MIGRATE 不会把 key 迁走，
+	// 同一分片上的写命令按执行顺序进入 AOF 与复制流，不同分片上的命令互不等待。
+	var result *protocol.Value
+	var err error
+	s.database.AtomicCommand(args, func(tx *db.Tx) {
+		if err = s.routeCommand(ctx, args, asking); err != nil {
+			return
+		}
+		if result, err = tx.ExecuteCommand(ctx, args); err != nil || !write {
+			return
+		}
+		s.propagate(ctx, db.ResolveCommand(args, result, time.Now()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if write {
+		s.afterWrite(ctx)
+	}
+	return result, nil
+}
+
+// serverCommand 执行由服务层实现且不加命令锁的命令，ok 为 false 表示 cmd 不属于这类命令。
+// EXEC 持有全部命令锁时也经它执行排队的同名命令。
+func (s *TCPServer) serverCommand(ctx context.Context, client *Client, cmd string, args []string) (result *protocol.Value, ok bool, err error) {
+	switch cmd {
+	case "PUBLISH":
+		result, err = s.publish(args)
+	case "PUBSUB":
+		result, err = s.pubsubCommand(args)
+	case "ACL":
+		result, err = s.aclCommand(client, args)
+	case "ASKING":
+		if s.cluster == nil {
+			return nil, true, errClusterNotSet
+		}
+		client.Asking = true
+		result = protocol.OK()
+	case "SAVE":
+		result, err = s.save(ctx)
+	case "BGSAVE":
+		result, err = s.bgSave(ctx)
+	case "LASTSAVE":
+		result = protocol.IntegerValue(s.lastSave.Load())
+	case "REPLCONF":
+		result, err = s.replconf(client, args)
+	case "INFO":
+		result = protocol.VerbatimValue("txt", s.info(args))
+	case "CONFIG":
+		result, err = s.configCommand(args)
+	case "SLOWLOG":
+		result, err = s.slowlogCommand(args)
+	case "CLIENT":
+		result, err = s.clientCommand(client, args)
+	case "CLUSTER":
+		result, err = s.clusterCommand(ctx, args)
+	default:
+		return nil, false, nil
+	}
+	return result, true, err
+}
+
+// freeMemory 内存超过 maxmemory 时按策略淘汰 key，并把淘汰以 DEL 传播到 AOF 与从节点。
+// 被淘汰的 key 事先无法确定，淘汰期间独占全部分片的命令锁，调用方不能持有命令锁；未超限时直接返回。
+// 从节点不主动淘汰，由主节点传播的 DEL 保持数据一致（与 Redis replica-ignore-maxmemory 默认行为相同）。
+func (s *TCPServer) freeMemory(ctx context.Context) error {
+	if !s.database.OverMemoryLimit() {
+		return nil
+	}
+	var err error
+	s.database.Atomic(func(*db.Tx) {
+		var evicted []string
+		evicted, err = s.database.FreeMemory(ctx)
+		for _, key := range evicted {
+			s.propagate(ctx, []string{"DEL", key})
+		}
+	})
+	if errors.Is(err, db.ErrOOM) {
+		return errOOM
+	}
+	return err
+}
+
+// propagate 将写命令追加到 AOF 与复制 backlog，args 为空表示无需传播。调用方需持有命令涉及分片的命令锁，
+// 使同一 key 上的命令按执行顺序传播；writeMu 保证 AOF 与复制流中的顺序相同。
+func (s *TCPServer) propagate(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	s.writeMu.Lock()
+	for _, command := range db.PropagateCommands(args, time.Now()) {
+		if s.aof != nil {
+			if err := s.aof.Append(ctx, command); err != nil {
+				s.logger.Error("append aof failed", "command", command[0], "error", err)
+			}
+		}
+		s.master.Broadcast(string(protocol.Serialize(protocol.CommandValue(command))))
+	}
+	s.writeMu.Unlock()
+	s.signalKeys(args)
+}
+
+// afterWrite 写命令释放命令锁之后调用：为就绪 key 上的列表等待者代为弹出，AOF 超过阈值时自动重写。
+func (s *TCPServer) afterWrite(ctx context.Context) {
+	s.serveBlocked(ctx)
+	if s.aof == nil || !s.aof.NeedsRewrite() {
+		return
+	}
+	var err error
+	s.database.Atomic(func(*db.Tx) {
+		// 并发的写命令可能已经开始了重写。
+		if s.aof.NeedsRewrite() {
+			err = s.startRewriteLocked(ctx)
+		}
+	})
+	if err != nil {
+		s.logger.Error("auto aof rewrite failed", "error", err)
 	}
 }
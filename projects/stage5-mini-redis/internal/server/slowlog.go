@@ -0,0 +1,193 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+const (
+	// DefaultSlowlogThreshold 与 Redis slowlog-log-slower-than 默认值一致（微秒）。
+	DefaultSlowlogThreshold = 10000
+	// DefaultSlowlogMaxLen 与 Redis slowlog-max-len 默认值一致。
+	DefaultSlowlogMaxLen = 128
+
+	defaultSlowlogGetCount = 10
+	// slowlogMaxArgs 与 slowlogMaxArgLen 限制单条记录保存的参数，避免大命令占满内存。
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+)
+
+var errSlowlogCount = errors.New("count should be greater than or equal to -1")
+
+// slowlogEntry 一条慢日志。
+type slowlogEntry struct {
+	id       int64
+	time     int64
+	duration int64
+	args     []string
+	addr     string
+	name     string
+}
+
+// slowlog 慢日志环形缓冲，超过 maxLen 时覆盖最旧的记录。
+type slowlog struct {
+	mu        sync.Mutex
+	entries   []slowlogEntry
+	start     int
+	nextID    int64
+	threshold int64
+	maxLen    int
+}
+
+func newSlowlog(threshold int64, maxLen int) *slowlog {
+	return &slowlog{threshold: threshold, maxLen: maxLen}
+}
+
+// SetSlowlog 设置慢日志阈值（微秒，负数表示关闭）与最大条数，需在 Start 前调用。
+func (s *TCPServer) SetSlowlog(threshold int64, maxLen int) {
+	s.slowlog.setThreshold(threshold)
+	s.slowlog.setMaxLen(maxLen)
+}
+
+// record 耗时不低于阈值时追加记录，阈值为负数表示关闭。
+func (l *slowlog) record(client *Client, args []string, elapsed time.Duration, now time.Time) {
+	micros := elapsed.Microseconds()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.threshold < 0 || micros < l.threshold || l.maxLen == 0 {
+		return
+	}
+	entry := slowlogEntry{
+		id:       l.nextID,
+		time:     now.Unix(),
+		duration: micros,
+		args:     slowlogArgs(args),
+		addr:     client.Conn.RemoteAddr().String(),
+		name:     client.Name(),
+	}
+	l.nextID++
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.start] = entry
+	l.start = (l.start + 1) % len(l.entries)
+}
+
+// slowlogArgs 按 Redis 的方式截断参数：最多保存 32 个，超长的字符串只保留前 128 字节。
+func slowlogArgs(args []string) []string {
+	n := min(len(args), slowlogMaxArgs)
+	saved := make([]string, n)
+	for i := 0; i < n; i++ {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			saved[i] = fmt.Sprintf("... (%d more arguments)", len(args)-slowlogMaxArgs+1)
+			break
+		}
+		if arg := args[i]; len(arg) > slowlogMaxArgLen {
+			saved[i] = fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		} else {
+			saved[i] = arg
+		}
+	}
+	return saved
+}
+
+// latest 返回最新的至多 count 条记录，count 为负数表示全部。
+func (l *slowlog) latest(count int) []slowlogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	result := make([]slowlogEntry, 0, count)
+	for i := 0; i < count; i++ {
+		idx := (l.start + len(l.entries) - 1 - i) % len(l.entries)
+		result = append(result, l.entries[idx])
+	}
+	return result
+}
+
+func (l *slowlog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowlog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+	l.start = 0
+}
+
+func (l *slowlog) config() (int64, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.threshold, l.maxLen
+}
+
+func (l *slowlog) setThreshold(micros int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.threshold = micros
+}
+
+// setMaxLen 调整容量，缩小时只保留最新的记录。
+func (l *slowlog) setMaxLen(maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keep := min(maxLen, len(l.entries))
+	entries := make([]slowlogEntry, keep)
+	for i := 0; i < keep; i++ {
+		entries[keep-1-i] = l.entries[(l.start+len(l.entries)-1-i)%len(l.entries)]
+	}
+	l.entries, l.start, l.maxLen = entries, 0, maxLen
+}
+
+// slowlogCommand 处理 SLOWLOG GET [count]/LEN/RESET。
+func (s *TCPServer) slowlogCommand(args []string) (*protocol.Value, error) {
+	if len(args) < 2 {
+		return nil, db.ErrInvalidCommand
+	}
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		count := defaultSlowlogGetCount
+		if len(args) > 3 {
+			return nil, db.ErrInvalidCommand
+		}
+		if len(args) == 3 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < -1 {
+				return nil, errSlowlogCount
+			}
+			count = n
+		}
+		entries := s.slowlog.latest(count)
+		items := make([]protocol.Value, 0, len(entries))
+		for _, e := range entries {
+			items = append(items, *protocol.ArrayValue(
+				*protocol.IntegerValue(e.id),
+				*protocol.IntegerValue(e.time),
+				*protocol.IntegerValue(e.duration),
+				*protocol.StringArray(e.args),
+				*protocol.BulkStringValue(e.addr),
+				*protocol.BulkStringValue(e.name),
+			))
+		}
+		return protocol.ArrayValue(items...), nil
+	case "LEN":
+		return protocol.IntegerValue(int64(s.slowlog.len())), nil
+	case "RESET":
+		s.slowlog.reset()
+		return protocol.OK(), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s' for 'slowlog'", args[1])
+	}
+}
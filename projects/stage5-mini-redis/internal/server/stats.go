@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// opsSampleInterval 与 opsSamples 对应 Redis 的 instantaneous_ops_per_sec：每 100ms 采样一次，取最近 16 次的平均。
+	opsSampleInterval = 100 * time.Millisecond
+	opsSamples        = 16
+)
+
+// serverStats INFO server/stats 使用的服务级计数器。
+type serverStats struct {
+	startTime        time.Time
+	runID            string
+	totalConnections atomic.Int64
+	totalCommands    atomic.Int64
+
+	mu           sync.Mutex
+	samples      [opsSamples]int64
+	sampleIndex  int
+	lastSample   time.Time
+	lastCommands int64
+}
+
+func newServerStats() *serverStats {
+	id := make([]byte, 20)
+	_, _ = rand.Read(id)
+	now := time.Now()
+	return &serverStats{startTime: now, runID: hex.EncodeToString(id), lastSample: now}
+}
+
+// run 周期性采样已处理命令数，直到 ctx 取消。
+func (st *serverStats) run(ctx context.Context) {
+	ticker := time.NewTicker(opsSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			st.sample(now)
+		}
+	}
+}
+
+func (st *serverStats) sample(now time.Time) {
+	commands := st.totalCommands.Load()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	elapsed := now.Sub(st.lastSample)
+	if elapsed <= 0 {
+		return
+	}
+	st.samples[st.sampleIndex] = (commands - st.lastCommands) * int64(time.Second) / int64(elapsed)
+	st.sampleIndex = (st.sampleIndex + 1) % opsSamples
+	st.lastSample = now
+	st.lastCommands = commands
+}
+
+// opsPerSec 返回最近采样窗口内的平均每秒命令数。
+func (st *serverStats) opsPerSec() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var sum int64
+	for _, v := range st.samples {
+		sum += v
+	}
+	return sum / opsSamples
+}
+
+// reset 清零计数器与采样窗口（CONFIG RESETSTAT），启动时间与 run_id 不变。
+func (st *serverStats) reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.totalConnections.Store(0)
+	st.totalCommands.Store(0)
+	st.samples = [opsSamples]int64{}
+	st.lastSample = time.Now()
+	st.lastCommands = 0
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+var (
+	errNestedMulti       = errors.New("MULTI calls can not be nested")
+	errExecWithoutMulti  = errors.New("EXEC without MULTI")
+	errDiscardWithoutTx  = errors.New("DISCARD without MULTI")
+	errWatchInsideMulti  = errors.New("WATCH inside MULTI is not allowed")
+	errCommandNotAllowed = errors.New("command not allowed inside a transaction")
+	errExecAbort         = &replyError{code: "EXECABORT", msg: "Transaction discarded because of previous errors."}
+)
+
+// nonTransactionalCommands 改变连接状态、不能在 MULTI 中排队的命令（与 Redis 的 no-multi 标记相同）。
+var nonTransactionalCommands = map[string]struct{}{
+	"SUBSCRIBE": {}, "PSUBSCRIBE": {}, "UNSUBSCRIBE": {}, "PUNSUBSCRIBE": {}, "MONITOR": {},
+	"WATCH": {}, "REPLICAOF": {}, "SLAVEOF": {}, "HELLO": {}, "AUTH": {},
+}
+
+// serverOnlyCommands 由服务层实现、不在 DB 命令表中的命令，排队时不做命令表的参数检查，
+// 参数错误在 EXEC 时体现在对应位置。
+var serverOnlyCommands = map[string]struct{}{
+	"ASKING": {}, "MIGRATE": {}, "BGREWRITEAOF": {}, "SAVE": {}, "BGSAVE": {}, "LASTSAVE": {},
+	"REPLCONF": {}, "INFO": {}, "CLUSTER": {}, "PUBSUB": {}, "CONFIG": {}, "SLOWLOG": {}, "CLIENT": {}, "ACL": {},
+}
+
+// transaction MULTI 之后排队的命令。
+type transaction struct {
+	commands [][]string
+	// dirty 表示排队阶段出现过错误，EXEC 将整体放弃（EXECABORT）。
+	dirty bool
+	// slot 集群模式下事务涉及的 slot，-1 表示尚无带 key 的命令。
+	slot int
+}
+
+// multi 开启事务。
+func (s *TCPServer) multi(client *Client) (*protocol.Value, error) {
+	if client.tx != nil {
+		return nil, errNestedMulti
+	}
+	client.tx = &transaction{slot: -1}
+	return protocol.OK(), nil
+}
+
+// queueCommand 事务中的命令先做语法、只读与路由检查再排队；检查失败会标记事务，EXEC 时返回 EXECABORT。
+func (s *TCPServer) queueCommand(ctx context.Context, client *Client, args []string, asking bool) (*protocol.Value, error) {
+	tx := client.tx
+	err := s.checkQueuedCommand(ctx, tx, args, asking)
+	if err != nil {
+		tx.dirty = true
+		return nil, err
+	}
+	tx.commands = append(tx.commands, args)
+	return protocol.SimpleStringValue("QUEUED"), nil
+}
+
+func (s *TCPServer) checkQueuedCommand(ctx context.Context, tx *transaction, args []string, asking bool) error {
+	cmd := strings.ToUpper(args[0])
+	if _, ok := nonTransactionalCommands[cmd]; ok {
+		return errCommandNotAllowed
+	}
+	if _, ok := serverOnlyCommands[cmd]; ok {
+		return nil
+	}
+	if err := db.ValidateCommand(args); err != nil {
+		return err
+	}
+	if db.IsWriteCommand(args[0]) && s.IsReplica() {
+		return errReadOnly
+	}
+	if s.cluster == nil {
+		return nil
+	}
+	if err := s.routeCommand(ctx, args, asking); err != nil {
+		return err
+	}
+	if keys := db.CommandKeys(args); len(keys) > 0 {
+		slot := int(cluster.KeyToSlot(keys[0]))
+		if tx.slot >= 0 && tx.slot != slot {
+			return errCrossSlot
+		}
+		tx.slot = slot
+	}
+	return nil
+}
+
+// exec 原子执行排队的命令。被 WATCH 的 key 已被修改时返回空数组；
+// 单条命令的运行时错误（如 WRONGTYPE）只体现在对应位置，不影响其余命令。
+// 执行期间独占全部分片的命令锁，写命令按执行顺序逐条追加到 AOF 与复制流。
+func (s *TCPServer) exec(ctx context.Context, client *Client) (*protocol.Value, error) {
+	tx := client.tx
+	if tx == nil {
+		return nil, errExecWithoutMulti
+	}
+	client.tx = nil
+	defer s.unwatch(client)
+	if tx.dirty {
+		return nil, errExecAbort
+	}
+	hasWrite := false
+	for _, args := range tx.commands {
+		hasWrite = hasWrite || db.IsWriteCommand(args[0])
+	}
+	if hasWrite && s.IsReplica() {
+		return nil, errReadOnly
+	}
+
+	for _, args := range tx.commands {
+		if db.IsDenyOOMCommand(args[0]) {
+			if err := s.freeMemory(ctx); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	var reply *protocol.Value
+	var err error
+	s.database.Atomic(func(dbTx *db.Tx) {
+		// 排队之后 slot 可能已迁走，独占命令锁后再校验一次，保证事务不会写入已交出的 slot。
+		for _, args := range tx.commands {
+			if err = s.routeCommand(ctx, args, false); err != nil {
+				return
+			}
+		}
+		if s.database.WatchChanged(client.watched) {
+			reply = protocol.NullArrayValue()
+			return
+		}
+		results := make([]protocol.Value, 0, len(tx.commands))
+		for _, args := range tx.commands {
+			result, err := s.execQueued(ctx, client, dbTx, args)
+			if err != nil {
+				results = append(results, *protocol.ErrorValue(errorReply(err)))
+				continue
+			}
+			results = append(results, *result)
+		}
+		reply = protocol.ArrayValue(results...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.afterWrite(ctx)
+	return reply, nil
+}
+
+// execQueued 在 EXEC 持有的全部命令锁内执行一条排队的命令并传播写命令；
+// 服务层命令使用不再加命令锁的版本。
+func (s *TCPServer) execQueued(ctx context.Context, client *Client, dbTx *db.Tx, args []string) (*protocol.Value, error) {
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "UNWATCH":
+		// EXEC 结束时总会释放全部 WATCH，事务内的 UNWATCH 无需额外动作。
+		return protocol.OK(), nil
+	case "DUMP":
+		return s.dump(ctx, args)
+	case "RESTORE", "RESTORE-ASKING":
+		return s.restoreLocked(ctx, args)
+	case "MIGRATE":
+		req, err := s.parseMigrate(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.migrateLocked(ctx, req)
+	case "BGREWRITEAOF":
+		return s.bgRewriteAOFLocked(ctx)
+	}
+	if result, ok, err := s.serverCommand(ctx, client, cmd, args); ok {
+		return result, err
+	}
+	result, err := dbTx.ExecuteCommand(ctx, args)
+	if err == nil && db.IsWriteCommand(args[0]) {
+		s.propagate(ctx, db.ResolveCommand(args, result, time.Now()))
+	}
+	return result, err
+}
+
+// discard 放弃事务并释放 WATCH。
+func (s *TCPServer) discard(client *Client) (*protocol.Value, error) {
+	if client.tx == nil {
+		return nil, errDiscardWithoutTx
+	}
+	client.tx = nil
+	s.unwatch(client)
+	return protocol.OK(), nil
+}
+
+// watch 处理 WATCH key [key ...]，记录 key 当前版本供 EXEC 比对。
+func (s *TCPServer) watch(ctx context.Context, client *Client, args []string, asking bool) (*protocol.Value, error) {
+	if client.tx != nil {
+		return nil, errWatchInsideMulti
+	}
+	if err := db.ValidateCommand(args); err != nil {
+		return nil, err
+	}
+	if err := s.routeCommand(ctx, args, asking); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(args)-1)
+	for _, key := range args[1:] {
+		if !client.isWatching(key) {
+			keys = append(keys, key)
+		}
+	}
+	watched, err := s.database.Watch(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	client.watched = append(client.watched, watched...)
+	return protocol.OK(), nil
+}
+
+// unwatch 释放连接的全部 WATCH。
+func (s *TCPServer) unwatch(client *Client) {
+	if len(client.watched) == 0 {
+		return
+	}
+	s.database.Unwatch(client.watched)
+	client.watched = nil
+}
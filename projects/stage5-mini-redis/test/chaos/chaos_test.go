@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 )
 
 // TestChaosTTLAndWrongType 模拟过期与错误类型访问场景。
@@ -19,8 +20,8 @@ func TestChaosTTLAndWrongType(t *testing.T) {
 	if err != nil {
 		t.Fatalf("GET expired key error = %v", err)
 	}
-	if result != "(nil)" {
-		t.Fatalf("expired key result = %q, want (nil)", result)
+	if result.Type != protocol.Null {
+		t.Fatalf("expired key result = %+v, want null", result)
 	}
 
 	_, _ = d.ExecuteCommand(ctx, []string{"SET", "a", "1"})
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ttl"
+)
+
+// testNode 测试用的进程内 mini-redis 节点。
+type testNode struct {
+	srv      *server.TCPServer
+	database *db.DB
+	addr     string
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// startNode 在随机端口启动节点，configure 可在 Start 前调整服务配置。
+func startNode(t *testing.T, configure func(*server.TCPServer)) *testNode {
+	t.Helper()
+	database := db.New()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := server.NewTCPServer("127.0.0.1:0", database, ttl.NewManager(database), logger)
+	if configure != nil {
+		configure(srv)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	node := &testNode{srv: srv, database: database, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(node.done)
+		_ = srv.Start(ctx)
+	}()
+	waitFor(t, 2*time.Second, func() bool { return srv.Addr() != "" })
+	node.addr = srv.Addr()
+	t.Cleanup(node.stop)
+	return node
+}
+
+func (n *testNode) stop() {
+	n.cancel()
+	<-n.done
+}
+
+// respClient 最小 RESP 客户端。
+type respClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialNode(t *testing.T, addr string) *respClient {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatalf("dial %s error = %v", addr, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &respClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *respClient) send(args ...string) error {
+	_, err := c.conn.Write(protocol.Serialize(protocol.CommandValue(args)))
+	return err
+}
+
+func (c *respClient) read() (*protocol.Value, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	return protocol.Parse(c.reader)
+}
+
+func (c *respClient) do(t *testing.T, args ...string) *protocol.Value {
+	t.Helper()
+	if err := c.send(args...); err != nil {
+		t.Fatalf("send %v error = %v", args, err)
+	}
+	value, err := c.read()
+	if err != nil {
+		t.Fatalf("read reply of %v error = %v", args, err)
+	}
+	return value
+}
+
+// doRaw 发送命令并返回回复的首行原文，用于区分 $-1 与 *-1 这类解析后相同的单行回复。
+func (c *respClient) doRaw(t *testing.T, args ...string) string {
+	t.Helper()
+	if err := c.send(args...); err != nil {
+		t.Fatalf("send %v error = %v", args, err)
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read reply of %v error = %v", args, err)
+	}
+	return line
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met before timeout")
+}
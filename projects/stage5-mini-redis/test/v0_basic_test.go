@@ -5,19 +5,20 @@ import (
 	"testing"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 )
 
 func TestV0BasicCommands(t *testing.T) {
 	d := db.New()
 	ctx := context.Background()
 
-	if result, err := d.ExecuteCommand(ctx, []string{"PING"}); err != nil || result != "PONG" {
-		t.Fatalf("PING = (%q, %v)", result, err)
+	if result, err := d.ExecuteCommand(ctx, []string{"PING"}); err != nil || result.Type != protocol.SimpleString || result.Str != "PONG" {
+		t.Fatalf("PING = (%+v, %v)", result, err)
 	}
-	if result, err := d.ExecuteCommand(ctx, []string{"SET", "k", "v"}); err != nil || result != "OK" {
-		t.Fatalf("SET = (%q, %v)", result, err)
+	if result, err := d.ExecuteCommand(ctx, []string{"SET", "k", "v"}); err != nil || result.Str != "OK" {
+		t.Fatalf("SET = (%+v, %v)", result, err)
 	}
-	if result, err := d.ExecuteCommand(ctx, []string{"GET", "k"}); err != nil || result != "v" {
-		t.Fatalf("GET = (%q, %v)", result, err)
+	if result, err := d.ExecuteCommand(ctx, []string{"GET", "k"}); err != nil || result.Type != protocol.BulkString || result.Str != "v" {
+		t.Fatalf("GET = (%+v, %v)", result, err)
 	}
 }
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV0TypedRepliesOverRESP2(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+
+	if reply := client.do(t, "SET", "k", "v"); reply.Type != protocol.SimpleString || reply.Str != "OK" {
+		t.Fatalf("SET = %+v, want +OK", reply)
+	}
+	if reply := client.do(t, "GET", "missing"); reply.Type != protocol.Null {
+		t.Fatalf("GET missing = %+v, want null bulk", reply)
+	}
+	if reply := client.do(t, "RPUSH", "list", "a", "b"); reply.Type != protocol.Integer || reply.Num != 2 {
+		t.Fatalf("RPUSH = %+v, want :2", reply)
+	}
+	client.do(t, "HSET", "h", "f", "v")
+	if reply := client.do(t, "HGETALL", "h"); reply.Type != protocol.Array || len(reply.Array) != 2 {
+		t.Fatalf("HGETALL over RESP2 = %+v, want flat array", reply)
+	}
+	client.do(t, "ZADD", "z", "2.5", "m")
+	if reply := client.do(t, "ZSCORE", "z", "m"); reply.Type != protocol.BulkString || reply.Str != "2.5" {
+		t.Fatalf("ZSCORE over RESP2 = %+v, want bulk 2.5", reply)
+	}
+	if reply := client.do(t, "INFO", "replication"); reply.Type != protocol.BulkString || !strings.HasPrefix(reply.Str, "# Replication") {
+		t.Fatalf("INFO over RESP2 = %+v", reply)
+	}
+}
+
+func TestV0HelloNegotiatesRESP3(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+
+	if reply := client.do(t, "HELLO", "4"); reply.Type != protocol.ErrorType || !strings.HasPrefix(reply.Str, "NOPROTO") {
+		t.Fatalf("HELLO 4 = %+v, want NOPROTO", reply)
+	}
+	hello := client.do(t, "HELLO", "3", "SETNAME", "worker")
+	if hello.Type != protocol.Map {
+		t.Fatalf("HELLO 3 = %+v, want map", hello)
+	}
+	fields := make(map[string]protocol.Value)
+	for i := 0; i+1 < len(hello.Array); i += 2 {
+		fields[hello.Array[i].Str] = hello.Array[i+1]
+	}
+	if fields["proto"].Num != 3 || fields["server"].Str != "redis" || fields["role"].Str != "master" {
+		t.Fatalf("HELLO 3 fields = %+v", fields)
+	}
+
+	client.do(t, "SADD", "s", "a", "b")
+	client.do(t, "HSET", "h", "f1", "v1", "f2", "v2")
+	client.do(t, "ZADD", "z", "1", "low", "2", "high")
+	cases := []struct {
+		args []string
+		want protocol.RESPType
+	}{
+		{[]string{"GET", "missing"}, protocol.Null},
+		{[]string{"SMEMBERS", "s"}, protocol.Set},
+		{[]string{"HGETALL", "h"}, protocol.Map},
+		{[]string{"ZSCORE", "z", "high"}, protocol.Double},
+		{[]string{"EXISTS", "s", "h"}, protocol.Integer},
+		{[]string{"INFO"}, protocol.VerbatimString},
+	}
+	for _, tc := range cases {
+		if reply := client.do(t, tc.args...); reply.Type != tc.want {
+			t.Fatalf("%v over RESP3 = %+v, want type %c", tc.args, reply, tc.want)
+		}
+	}
+	if reply := client.do(t, "HGETALL", "h"); len(reply.Array) != 4 || reply.Array[0].Str != "f1" || reply.Array[3].Str != "v2" {
+		t.Fatalf("HGETALL map = %+v", reply)
+	}
+	if reply := client.do(t, "ZRANGE", "z", "0", "-1", "WITHSCORES"); len(reply.Array) != 4 || reply.Array[3].Type != protocol.Double || reply.Array[3].Double != 2 {
+		t.Fatalf("ZRANGE WITHSCORES = %+v", reply)
+	}
+
+	// 降回 RESP2 后同一命令恢复为数组。
+	client.do(t, "HELLO", "2")
+	if reply := client.do(t, "HGETALL", "h"); reply.Type != protocol.Array {
+		t.Fatalf("HGETALL after HELLO 2 = %+v, want array", reply)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 )
 
 func TestV1PipelineAndTTL(t *testing.T) {
@@ -25,7 +26,7 @@ func TestV1PipelineAndTTL(t *testing.T) {
 	if err != nil {
 		t.Fatalf("GET ttl-key error = %v", err)
 	}
-	if result != "(nil)" {
-		t.Fatalf("ttl key result = %q, want (nil)", result)
+	if result.Type != protocol.Null {
+		t.Fatalf("ttl key result = %+v, want null", result)
 	}
 }
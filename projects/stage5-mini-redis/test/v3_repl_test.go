@@ -1,7 +1,13 @@
 package test
 
 import (
+	"context"
+	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/replication"
 )
@@ -23,3 +29,108 @@ func TestV3Replication(t *testing.T) {
 		t.Fatalf("slave offset = %d, want %d", slave.Offset(), offset)
 	}
 }
+
+func TestV3NetworkedReplication(t *testing.T) {
+	master := startNode(t, nil)
+	replica := startNode(t, nil)
+	ctx := context.Background()
+
+	mc := dialNode(t, master.addr)
+	mc.do(t, "SET", "before", "sync")
+	mc.do(t, "RPUSH", "queue", "a", "b")
+
+	host, port, _ := net.SplitHostPort(master.addr)
+	rc := dialNode(t, replica.addr)
+	if reply := rc.do(t, "REPLICAOF", host, port); reply.Str != "OK" {
+		t.Fatalf("REPLICAOF = %+v", reply)
+	}
+	waitFor(t, 3*time.Second, func() bool {
+		value, ok, _ := replica.database.GetString(ctx, "before")
+		return ok && value == "sync"
+	})
+
+	mc.do(t, "SET", "streamed", "1")
+	mc.do(t, "EXPIRE", "streamed", "100")
+	waitFor(t, 3*time.Second, func() bool {
+		ttl, _ := replica.database.TTL(ctx, "streamed")
+		return ttl > 0
+	})
+	if items, _ := replica.database.LRange(ctx, "queue", 0, 10); len(items) != 2 {
+		t.Fatalf("replica queue = %v, want 2 items", items)
+	}
+
+	if reply := rc.do(t, "SET", "local", "x"); reply.Type != protocol.ErrorType || !strings.HasPrefix(reply.Str, "READONLY") {
+		t.Fatalf("write on replica = %+v, want READONLY error", reply)
+	}
+
+	waitFor(t, 3*time.Second, func() bool {
+		info := mc.do(t, "INFO", "replication").Str
+		return strings.Contains(info, "connected_slaves:1") && strings.Contains(info, "offset=4")
+	})
+	info := rc.do(t, "INFO", "replication").Str
+	if !strings.Contains(info, "role:slave") || !strings.Contains(info, "master_link_status:up") {
+		t.Fatalf("replica INFO = %q", info)
+	}
+
+	if reply := rc.do(t, "REPLICAOF", "NO", "ONE"); reply.Str != "OK" {
+		t.Fatalf("REPLICAOF NO ONE = %+v", reply)
+	}
+	if reply := rc.do(t, "SET", "local", "x"); reply.Str != "OK" {
+		t.Fatalf("write after promotion = %+v", reply)
+	}
+}
+
+func TestV3PartialResync(t *testing.T) {
+	master := startNode(t, nil)
+	mc := dialNode(t, master.addr)
+	info := mc.do(t, "INFO", "replication").Str
+	replID := infoField(info, "master_replid")
+
+	mc.do(t, "SET", "a", "1")
+	mc.do(t, "SET", "b", "2")
+
+	// 位点仍在 backlog 内：+CONTINUE 并从位点 1 之后续传。
+	link := dialNode(t, master.addr)
+	reply := link.do(t, "PSYNC", replID, "1")
+	if reply.Type != protocol.SimpleString || reply.Str != "CONTINUE "+replID {
+		t.Fatalf("PSYNC in range = %+v, want CONTINUE", reply)
+	}
+	command, err := link.read()
+	if err != nil || len(command.Array) != 3 || command.Array[1].Str != "b" {
+		t.Fatalf("streamed command = (%+v, %v), want SET b 2", command, err)
+	}
+
+	// 复制 ID 不匹配：回退到全量同步。
+	full := dialNode(t, master.addr)
+	reply = full.do(t, "PSYNC", "unknown-replid", "1")
+	if reply.Type != protocol.SimpleString || !strings.HasPrefix(reply.Str, "FULLRESYNC "+replID+" 2") {
+		t.Fatalf("PSYNC unknown id = %+v, want FULLRESYNC", reply)
+	}
+}
+
+func TestV3PartialResyncFallsBackWhenBacklogAgedOut(t *testing.T) {
+	m := replication.NewMasterWithBacklog(2)
+	for i := 0; i < 5; i++ {
+		m.Broadcast("SET k v")
+	}
+	if m.CanPartialSync(m.ReplID(), 1) {
+		t.Fatal("offset outside the backlog ring must require full resync")
+	}
+	if !m.CanPartialSync(m.ReplID(), 3) {
+		t.Fatal("offset inside the backlog ring should allow partial resync")
+	}
+	old := m.ReplID()
+	m.Promote()
+	if !m.CanPartialSync(old, 4) {
+		t.Fatal("previous replid should still be accepted up to the promotion offset")
+	}
+}
+
+func infoField(info, name string) string {
+	for _, line := range strings.Split(info, "\r\n") {
+		if value, ok := strings.CutPrefix(line, name+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
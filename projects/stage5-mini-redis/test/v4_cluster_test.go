@@ -1,9 +1,16 @@
 package test
 
 import (
+	"io"
+	"log/slog"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
 )
 
 func TestV4ClusterSlotRouting(t *testing.T) {
@@ -20,3 +27,97 @@ func TestV4ClusterSlotRouting(t *testing.T) {
 		t.Fatalf("resolved node invalid for slot %d", slot)
 	}
 }
+
+func TestV4ClusterRedirectsAndGossip(t *testing.T) {
+	nodes := make([]*testNode, 3)
+	buses := make([]*cluster.Bus, 3)
+	for i := range nodes {
+		state := cluster.NewLocalState("", "")
+		bus := cluster.NewBus(state, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		bus.SetInterval(50 * time.Millisecond)
+		bus.SetNodeTimeout(500 * time.Millisecond)
+		if err := bus.Listen("127.0.0.1:0"); err != nil {
+			t.Fatalf("bus.Listen() error = %v", err)
+		}
+		buses[i] = bus
+		nodes[i] = startNode(t, func(srv *server.TCPServer) { srv.EnableCluster(state, bus) })
+	}
+	clients := make([]*respClient, len(nodes))
+	for i, node := range nodes {
+		clients[i] = dialNode(t, node.addr)
+	}
+	clients[0].do(t, "CLUSTER", "ADDSLOTSRANGE", "0", "8191")
+	clients[1].do(t, "CLUSTER", "ADDSLOTSRANGE", "8192", "16383")
+
+	// 节点 0 只 MEET 节点 1，节点 2 只 MEET 节点 0，其余关系靠 gossip 传播。
+	meet := func(from *respClient, to int) {
+		host, port, _ := net.SplitHostPort(nodes[to].addr)
+		_, busPort, _ := net.SplitHostPort(buses[to].Addr())
+		if reply := from.do(t, "CLUSTER", "MEET", host, port, busPort); reply.Str != "OK" {
+			t.Fatalf("CLUSTER MEET = %+v", reply)
+		}
+	}
+	meet(clients[0], 1)
+	meet(clients[2], 0)
+	for _, client := range clients {
+		waitFor(t, 3*time.Second, func() bool {
+			return strings.Contains(client.do(t, "CLUSTER", "INFO").Str, "cluster_state:ok") &&
+				strings.Count(client.do(t, "CLUSTER", "NODES").Str, "\n") == 3
+		})
+	}
+
+	if slot := clients[2].do(t, "CLUSTER", "KEYSLOT", "foo"); slot.Type != protocol.Integer || slot.Num != 12182 {
+		t.Fatalf("CLUSTER KEYSLOT foo = %+v, want 12182", slot)
+	}
+	reply := clients[0].do(t, "SET", "foo", "bar")
+	if reply.Type != protocol.ErrorType || reply.Str != "MOVED 12182 "+nodes[1].addr {
+		t.Fatalf("SET on wrong node = %+v, want MOVED to node 1", reply)
+	}
+	if reply = clients[1].do(t, "SET", "foo", "bar"); reply.Str != "OK" {
+		t.Fatalf("SET on owner = %+v", reply)
+	}
+	if reply = clients[2].do(t, "GET", "foo"); !strings.HasPrefix(reply.Str, "MOVED 12182") {
+		t.Fatalf("GET via node without slots = %+v, want MOVED", reply)
+	}
+
+	if reply = clients[0].do(t, "DEL", "{user1000}.following", "{user1000}.followers"); reply.Type == protocol.ErrorType && strings.HasPrefix(reply.Str, "CROSSSLOT") {
+		t.Fatalf("keys sharing a hash tag must not be CROSSSLOT: %+v", reply)
+	}
+	if reply = clients[0].do(t, "DEL", "foo", "bar"); !strings.HasPrefix(reply.Str, "CROSSSLOT") {
+		t.Fatalf("DEL across slots = %+v, want CROSSSLOT", reply)
+	}
+	slots := clients[2].do(t, "CLUSTER", "SLOTS")
+	if len(slots.Array) != 2 {
+		t.Fatalf("CLUSTER SLOTS = %+v, want two ranges", slots)
+	}
+	for _, r := range slots.Array {
+		if len(r.Array) != 3 || len(r.Array[2].Array) != 3 {
+			t.Fatalf("CLUSTER SLOTS entry = %+v, want [start end [host port id]]", r)
+		}
+		if r.Array[0].Num == 8192 && r.Array[2].Array[2].Str != clients[1].do(t, "CLUSTER", "MYID").Str {
+			t.Fatalf("slots 8192-16383 should belong to node 1: %+v", r)
+		}
+	}
+
+	// 本节点行的 pong 为 0；节点 2 停止后，超过节点超时没有 PONG 即标记为 disconnected。
+	myID := clients[0].do(t, "CLUSTER", "MYID").Str
+	goneID := clients[2].do(t, "CLUSTER", "MYID").Str
+	for _, line := range strings.Split(strings.TrimSpace(clients[0].do(t, "CLUSTER", "NODES").Str), "\n") {
+		fields := strings.Fields(line)
+		if fields[0] == myID && fields[5] != "0" {
+			t.Fatalf("myself pong = %s, want 0: %s", fields[5], line)
+		}
+		if fields[0] != myID && (fields[5] == "0" || fields[7] != "connected") {
+			t.Fatalf("peer row = %s, want a pong time and connected", line)
+		}
+	}
+	nodes[2].stop()
+	waitFor(t, 3*time.Second, func() bool {
+		for _, line := range strings.Split(clients[0].do(t, "CLUSTER", "NODES").Str, "\n") {
+			if fields := strings.Fields(line); len(fields) > 7 && fields[0] == goneID {
+				return fields[7] == "disconnected"
+			}
+		}
+		return false
+	})
+}
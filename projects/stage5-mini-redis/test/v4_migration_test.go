@@ -0,0 +1,234 @@
+package test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/cluster"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
+)
+
+// clusterClient 跟随 MOVED/ASK/TRYAGAIN 的最小集群客户端，测试只访问单个 slot，
+// 因此用 owner 缓存该 slot 的当前归属即可。
+type clusterClient struct {
+	owner string
+	conns map[string]*respClient
+}
+
+func newClusterClient(addr string) *clusterClient {
+	return &clusterClient{owner: addr, conns: make(map[string]*respClient)}
+}
+
+func (c *clusterClient) conn(addr string) (*respClient, error) {
+	if client, ok := c.conns[addr]; ok {
+		return client, nil
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	client := &respClient{conn: conn, reader: bufio.NewReader(conn)}
+	c.conns[addr] = client
+	return client, nil
+}
+
+func (c *clusterClient) roundTrip(addr string, args ...string) (*protocol.Value, error) {
+	client, err := c.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err = client.send(args...); err != nil {
+		return nil, err
+	}
+	return client.read()
+}
+
+func (c *clusterClient) do(args ...string) (*protocol.Value, error) {
+	addr, asking := c.owner, false
+	for attempt := 0; attempt < 100; attempt++ {
+		if asking {
+			if _, err := c.roundTrip(addr, "ASKING"); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := c.roundTrip(addr, args...)
+		if err != nil {
+			return nil, err
+		}
+		if reply.Type != protocol.ErrorType {
+			return reply, nil
+		}
+		fields := strings.Fields(reply.Str)
+		switch fields[0] {
+		case "MOVED":
+			c.owner, addr, asking = fields[2], fields[2], false
+		case "ASK":
+			addr, asking = fields[2], true
+		case "TRYAGAIN":
+			time.Sleep(5 * time.Millisecond)
+			addr, asking = c.owner, false
+		default:
+			return reply, nil
+		}
+	}
+	return nil, errors.New("too many redirects")
+}
+
+func (c *clusterClient) close() {
+	for _, client := range c.conns {
+		_ = client.conn.Close()
+	}
+}
+
+func TestV4LiveSlotMigrationUnderLoad(t *testing.T) {
+	nodes := make([]*testNode, 2)
+	buses := make([]*cluster.Bus, 2)
+	for i := range nodes {
+		state := cluster.NewLocalState("", "")
+		bus := cluster.NewBus(state, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		bus.SetInterval(50 * time.Millisecond)
+		if err := bus.Listen("127.0.0.1:0"); err != nil {
+			t.Fatalf("bus.Listen() error = %v", err)
+		}
+		buses[i] = bus
+		nodes[i] = startNode(t, func(srv *server.TCPServer) { srv.EnableCluster(state, bus) })
+	}
+	source, target := dialNode(t, nodes[0].addr), dialNode(t, nodes[1].addr)
+	source.do(t, "CLUSTER", "ADDSLOTSRANGE", "0", "16383")
+	host, port, _ := net.SplitHostPort(nodes[1].addr)
+	_, busPort, _ := net.SplitHostPort(buses[1].Addr())
+	source.do(t, "CLUSTER", "MEET", host, port, busPort)
+	waitFor(t, 3*time.Second, func() bool {
+		return strings.Contains(target.do(t, "CLUSTER", "INFO").Str, "cluster_state:ok") &&
+			strings.Count(source.do(t, "CLUSTER", "NODES").Str, "\n") == 2
+	})
+	sourceID, targetID := source.do(t, "CLUSTER", "MYID").Str, target.do(t, "CLUSTER", "MYID").Str
+	slot := strconv.FormatInt(target.do(t, "CLUSTER", "KEYSLOT", "{mig}").Num, 10)
+
+	const keyCount = 200
+	for i := 0; i < keyCount; i++ {
+		source.do(t, "SET", fmt.Sprintf("{mig}:k%d", i), fmt.Sprintf("v%d", i))
+	}
+	source.do(t, "HSET", "{mig}:hash", "field", "value")
+	source.do(t, "SET", "{mig}:ttl", "soon", "EX", "100")
+
+	// 写入方不断 RPUSH 递增序号，RPUSH 返回的长度必须与序号严格对应：
+	// 迁移过程中一旦 key 在两个节点间分裂，长度就会回退。
+	const writers = 4
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+1)
+	pushed := make([]int, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			client := newClusterClient(nodes[0].addr)
+			defer client.close()
+			key := fmt.Sprintf("{mig}:w%d", w)
+			for seq := 0; !stop.Load(); seq++ {
+				reply, err := client.do("RPUSH", key, strconv.Itoa(seq))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if reply.Type != protocol.Integer || reply.Num != int64(seq+1) {
+					errs <- fmt.Errorf("RPUSH %s #%d = %+v, want length %d", key, seq, reply, seq+1)
+					return
+				}
+				pushed[w] = seq + 1
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client := newClusterClient(nodes[0].addr)
+		defer client.close()
+		for i := 0; !stop.Load(); i = (i + 7) % keyCount {
+			reply, err := client.do("GET", fmt.Sprintf("{mig}:k%d", i))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if want := fmt.Sprintf("v%d", i); reply.Str != want {
+				errs <- fmt.Errorf("GET {mig}:k%d = %+v, want %q", i, reply, want)
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if reply := target.do(t, "CLUSTER", "SETSLOT", slot, "IMPORTING", sourceID); reply.Str != "OK" {
+		t.Fatalf("SETSLOT IMPORTING = %+v", reply)
+	}
+	if reply := source.do(t, "CLUSTER", "SETSLOT", slot, "MIGRATING", targetID); reply.Str != "OK" {
+		t.Fatalf("SETSLOT MIGRATING = %+v", reply)
+	}
+	if nodesText := source.do(t, "CLUSTER", "NODES").Str; !strings.Contains(nodesText, "["+slot+"->-"+targetID+"]") {
+		t.Fatalf("CLUSTER NODES should show migrating state:\n%s", nodesText)
+	}
+	for {
+		keys := source.do(t, "CLUSTER", "GETKEYSINSLOT", slot, "16").Array
+		if len(keys) == 0 {
+			break
+		}
+		args := []string{"MIGRATE", host, port, "", "0", "5000", "KEYS"}
+		for _, key := range keys {
+			args = append(args, key.Str)
+		}
+		if reply := source.do(t, args...); reply.Str != "OK" {
+			t.Fatalf("MIGRATE = %+v", reply)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	target.do(t, "CLUSTER", "SETSLOT", slot, "NODE", targetID)
+	source.do(t, "CLUSTER", "SETSLOT", slot, "NODE", targetID)
+
+	time.Sleep(50 * time.Millisecond)
+	stop.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if count := source.do(t, "CLUSTER", "COUNTKEYSINSLOT", slot).Num; count != 0 {
+		t.Fatalf("source still holds %d keys in slot %s", count, slot)
+	}
+	if count := target.do(t, "CLUSTER", "COUNTKEYSINSLOT", slot).Num; count != keyCount+2+writers {
+		t.Fatalf("target COUNTKEYSINSLOT = %d, want %d", count, keyCount+2+writers)
+	}
+	for w := 0; w < writers; w++ {
+		if pushed[w] == 0 {
+			t.Fatalf("writer %d made no progress", w)
+		}
+		items := target.do(t, "LRANGE", fmt.Sprintf("{mig}:w%d", w), "0", strconv.Itoa(pushed[w]-1)).Array
+		if len(items) != pushed[w] || items[len(items)-1].Str != strconv.Itoa(pushed[w]-1) {
+			t.Fatalf("writer %d list has %d items, want %d", w, len(items), pushed[w])
+		}
+	}
+	if reply := target.do(t, "HGET", "{mig}:hash", "field"); reply.Str != "value" {
+		t.Fatalf("HGET after migration = %+v", reply)
+	}
+	if ttl := target.do(t, "TTL", "{mig}:ttl").Num; ttl <= 0 || ttl > 100 {
+		t.Fatalf("TTL after migration = %d, want (0, 100]", ttl)
+	}
+	if reply := source.do(t, "GET", "{mig}:k1"); reply.Str != "MOVED "+slot+" "+nodes[1].addr {
+		t.Fatalf("GET on source after handoff = %+v, want MOVED", reply)
+	}
+	if reply := target.do(t, "GET", "{mig}:k1"); reply.Str != "v1" {
+		t.Fatalf("GET on target after handoff = %+v", reply)
+	}
+}
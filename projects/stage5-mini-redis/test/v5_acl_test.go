@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
+)
+
+func TestV5RequirePass(t *testing.T) {
+	node := startNode(t, func(srv *server.TCPServer) { srv.SetRequirePass("s3cret") })
+	client := dialNode(t, node.addr)
+	if reply := client.do(t, "GET", "k"); reply.Str != "NOAUTH Authentication required." {
+		t.Fatalf("GET before AUTH = %+v", reply)
+	}
+	if reply := client.do(t, "AUTH", "wrong"); !strings.HasPrefix(reply.Str, "WRONGPASS") {
+		t.Fatalf("AUTH wrong = %+v", reply)
+	}
+	if reply := client.do(t, "AUTH", "s3cret"); reply.Str != "OK" {
+		t.Fatalf("AUTH = %+v", reply)
+	}
+	if reply := client.do(t, "SET", "k", "v"); reply.Str != "OK" {
+		t.Fatalf("SET after AUTH = %+v", reply)
+	}
+
+	hello := dialNode(t, node.addr)
+	if reply := hello.do(t, "HELLO", "3"); reply.Type != protocol.ErrorType || !strings.HasPrefix(reply.Str, "NOAUTH") {
+		t.Fatalf("HELLO without AUTH = %+v", reply)
+	}
+	if reply := hello.do(t, "HELLO", "3", "AUTH", "default", "s3cret"); reply.Type != protocol.Map {
+		t.Fatalf("HELLO AUTH = %+v", reply)
+	}
+	if reply := hello.do(t, "GET", "k"); reply.Str != "v" {
+		t.Fatalf("GET after HELLO AUTH = %+v", reply)
+	}
+}
+
+func TestV5ACLUserPermissions(t *testing.T) {
+	node := startNode(t, nil)
+	admin := dialNode(t, node.addr)
+	monitor := dialNode(t, node.addr)
+	monitor.do(t, "MONITOR")
+	if reply := admin.do(t, "ACL", "SETUSER", "alice", "on", ">pw", "~cache:*", "+@read", "+multi", "+exec"); reply.Str != "OK" {
+		t.Fatalf("ACL SETUSER = %+v", reply)
+	}
+	admin.do(t, "SET", "secret", "x")
+
+	alice := dialNode(t, node.addr)
+	if reply := alice.do(t, "AUTH", "alice", "pw"); reply.Str != "OK" {
+		t.Fatalf("AUTH alice = %+v", reply)
+	}
+	// MONITOR 中 AUTH 的参数被隐藏。
+	for _, want := range []string{`"ACL" "SETUSER" "alice" "on" "(redacted)"`, `"SET" "secret" "x"`, `"AUTH" "(redacted)" "(redacted)"`} {
+		reply, err := monitor.read()
+		if err != nil || !strings.Contains(reply.Str, want) {
+			t.Fatalf("monitor line = %+v (%v), want %q", reply, err, want)
+		}
+	}
+
+	if reply := alice.do(t, "GET", "cache:1"); reply.Type != protocol.BulkString && reply.Type != protocol.Null {
+		t.Fatalf("GET allowed key = %+v", reply)
+	}
+	if reply := alice.do(t, "GET", "secret"); !strings.HasPrefix(reply.Str, "NOPERM") || !strings.Contains(reply.Str, "keys") {
+		t.Fatalf("GET denied key = %+v", reply)
+	}
+	if reply := alice.do(t, "SET", "cache:1", "v"); reply.Str != "NOPERM this user has no permissions to run the 'set' command" {
+		t.Fatalf("SET without @write = %+v", reply)
+	}
+	if reply := alice.do(t, "CONFIG", "GET", "maxmemory"); !strings.HasPrefix(reply.Str, "NOPERM") {
+		t.Fatalf("CONFIG without @admin = %+v", reply)
+	}
+
+	// 事务中被拒绝的命令使整个事务放弃。
+	alice.do(t, "MULTI")
+	if reply := alice.do(t, "SET", "cache:1", "v"); !strings.HasPrefix(reply.Str, "NOPERM") {
+		t.Fatalf("queued SET = %+v", reply)
+	}
+	if reply := alice.do(t, "EXEC"); !strings.HasPrefix(reply.Str, "EXECABORT") {
+		t.Fatalf("EXEC = %+v", reply)
+	}
+
+	info := admin.do(t, "ACL", "GETUSER", "alice")
+	if len(info.Array) != 10 || info.Array[5].Str != "-@all +@read +multi +exec" || info.Array[7].Str != "~cache:*" {
+		t.Fatalf("ACL GETUSER = %+v", info)
+	}
+	if reply := admin.do(t, "ACL", "WHOAMI"); reply.Str != "default" {
+		t.Fatalf("ACL WHOAMI = %+v", reply)
+	}
+	if !strings.Contains(admin.do(t, "CLIENT", "LIST").Str, "user=alice") {
+		t.Fatal("CLIENT LIST missing user=alice")
+	}
+
+	// 删除用户会断开以该用户认证的连接。
+	if reply := admin.do(t, "ACL", "DELUSER", "alice"); reply.Num != 1 {
+		t.Fatalf("ACL DELUSER = %+v", reply)
+	}
+	if _, err := alice.read(); err == nil {
+		t.Fatal("connection of deleted user still open")
+	}
+}
+
+func TestV5ACLFileSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	node := startNode(t, func(srv *server.TCPServer) {
+		if err := srv.EnableACLFile(path); err != nil {
+			t.Fatalf("EnableACLFile error = %v", err)
+		}
+	})
+	client := dialNode(t, node.addr)
+	client.do(t, "ACL", "SETUSER", "worker", "on", ">pw", "allkeys", "+@write")
+	if reply := client.do(t, "ACL", "SAVE"); reply.Str != "OK" {
+		t.Fatalf("ACL SAVE = %+v", reply)
+	}
+	client.do(t, "ACL", "DELUSER", "worker")
+	if reply := client.do(t, "ACL", "LOAD"); reply.Str != "OK" {
+		t.Fatalf("ACL LOAD = %+v", reply)
+	}
+	if users := pushText(client.do(t, "ACL", "USERS")); users != "default worker" {
+		t.Fatalf("ACL USERS = %q", users)
+	}
+
+	// 重启后从文件加载。
+	restarted := startNode(t, func(srv *server.TCPServer) {
+		if err := srv.EnableACLFile(path); err != nil {
+			t.Fatalf("EnableACLFile error = %v", err)
+		}
+	})
+	worker := dialNode(t, restarted.addr)
+	if reply := worker.do(t, "AUTH", "worker", "pw"); reply.Str != "OK" {
+		t.Fatalf("AUTH worker after restart = %+v", reply)
+	}
+	if reply := worker.do(t, "SET", "k", "v"); reply.Str != "OK" {
+		t.Fatalf("SET as worker = %+v", reply)
+	}
+}
+
+func TestV5ReplicaMasterAuth(t *testing.T) {
+	master := startNode(t, func(srv *server.TCPServer) { srv.SetRequirePass("pw") })
+	replica := startNode(t, func(srv *server.TCPServer) { srv.SetMasterAuth("", "pw") })
+	host, port, _ := net.SplitHostPort(master.addr)
+	dialNode(t, replica.addr).do(t, "REPLICAOF", host, port)
+
+	client := dialNode(t, master.addr)
+	client.do(t, "AUTH", "pw")
+	client.do(t, "SET", "replicated", "yes")
+	waitFor(t, 3*time.Second, func() bool {
+		value, ok, _ := replica.database.GetString(context.Background(), "replicated")
+		return ok && value == "yes"
+	})
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV5InfoSections(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+	client.do(t, "SET", "a", "1")
+	client.do(t, "SET", "b", "2", "EX", "100")
+	client.do(t, "SET", "gone", "v")
+	client.do(t, "PEXPIREAT", "gone", strconv.FormatInt(time.Now().UnixMilli()+1, 10))
+	time.Sleep(10 * time.Millisecond)
+	client.do(t, "GET", "gone")
+
+	// 4 条写命令加上 gone 过期删除，共 5 次修改。
+	info := client.do(t, "INFO").Str
+	for _, header := range []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Stats", "# Replication", "# Keyspace"} {
+		if !strings.Contains(info, header+"\r\n") {
+			t.Fatalf("INFO missing %q: %q", header, info)
+		}
+	}
+	for _, field := range []string{"connected_clients:1", "expired_keys:1", "db0:keys=2,expires=1", "rdb_changes_since_last_save:5"} {
+		if !strings.Contains(info, field+"\r\n") {
+			t.Fatalf("INFO missing %q: %q", field, info)
+		}
+	}
+
+	// 可同时请求多个节，只返回请求的节。
+	partial := client.do(t, "INFO", "server", "KEYSPACE").Str
+	if !strings.HasPrefix(partial, "# Server\r\n") || !strings.Contains(partial, "# Keyspace\r\n") || strings.Contains(partial, "# Stats") {
+		t.Fatalf("INFO server keyspace = %q", partial)
+	}
+	if stats := client.do(t, "INFO", "stats").Str; !strings.Contains(stats, "total_commands_processed:") || strings.Contains(stats, "total_commands_processed:0\r\n") {
+		t.Fatalf("INFO stats = %q", stats)
+	}
+
+	client.do(t, "CONFIG", "RESETSTAT")
+	if stats := client.do(t, "INFO", "stats").Str; !strings.Contains(stats, "expired_keys:0\r\n") || !strings.Contains(stats, "total_commands_processed:1\r\n") {
+		t.Fatalf("INFO stats after RESETSTAT = %q", stats)
+	}
+}
+
+func TestV5ConfigGetSet(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+
+	if reply := client.do(t, "CONFIG", "SET", "maxmemory", "1mb", "maxmemory-policy", "allkeys-lru"); reply.Str != "OK" {
+		t.Fatalf("CONFIG SET = %+v", reply)
+	}
+	limit, policy := node.database.MaxMemory()
+	if limit != 1<<20 || policy != "allkeys-lru" {
+		t.Fatalf("maxmemory = %d %s", limit, policy)
+	}
+	reply := client.do(t, "CONFIG", "GET", "maxmemory*")
+	if got := pushText(reply); got != "maxmemory 1048576 maxmemory-policy allkeys-lru maxmemory-samples 5" {
+		t.Fatalf("CONFIG GET maxmemory* = %q", got)
+	}
+
+	// 任一参数非法时整条 CONFIG SET 不生效。
+	reply = client.do(t, "CONFIG", "SET", "maxmemory", "2mb", "maxmemory-policy", "bogus")
+	if reply.Type != protocol.ErrorType || !strings.Contains(reply.Str, "argument 'maxmemory-policy'") {
+		t.Fatalf("CONFIG SET invalid = %+v", reply)
+	}
+	if limit, _ := node.database.MaxMemory(); limit != 1<<20 {
+		t.Fatalf("maxmemory after failed CONFIG SET = %d", limit)
+	}
+	if reply := client.do(t, "CONFIG", "SET", "no-such-option", "1"); reply.Type != protocol.ErrorType || !strings.Contains(reply.Str, "Unknown option") {
+		t.Fatalf("CONFIG SET unknown = %+v", reply)
+	}
+	if reply := client.do(t, "CONFIG", "SET", "dbfilename", "x.rdb"); reply.Type != protocol.ErrorType || !strings.Contains(reply.Str, "immutable") {
+		t.Fatalf("CONFIG SET immutable = %+v", reply)
+	}
+	client.do(t, "CONFIG", "SET", "notify-keyspace-events", "KEA")
+	if got := pushText(client.do(t, "CONFIG", "GET", "notify-keyspace-events")); got != "notify-keyspace-events AKE" {
+		t.Fatalf("CONFIG GET notify-keyspace-events = %q", got)
+	}
+}
+
+func TestV5Slowlog(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+	client.do(t, "CLIENT", "SETNAME", "worker")
+	client.do(t, "CONFIG", "SET", "slowlog-log-slower-than", "0", "slowlog-max-len", "2")
+	client.do(t, "SET", "k", strings.Repeat("x", 200))
+	client.do(t, "GET", "k")
+	client.do(t, "MULTI")
+	client.do(t, "INCR", "n")
+	client.do(t, "EXEC")
+
+	// 容量为 2，只保留最新的 EXEC 与 MULTI；排队的 INCR 不记录。
+	entries := client.do(t, "SLOWLOG", "GET", "-1")
+	if len(entries.Array) != 2 || entries.Array[0].Array[3].Array[0].Str != "EXEC" || entries.Array[1].Array[3].Array[0].Str != "MULTI" {
+		t.Fatalf("SLOWLOG GET = %+v", entries)
+	}
+	if name := entries.Array[0].Array[5].Str; name != "worker" {
+		t.Fatalf("slowlog client name = %q", name)
+	}
+
+	client.do(t, "CONFIG", "SET", "slowlog-max-len", "10")
+	client.do(t, "SET", "k", strings.Repeat("x", 200))
+	args := client.do(t, "SLOWLOG", "GET", "1").Array[0].Array[3].Array
+	if len(args) != 3 || args[2].Str != strings.Repeat("x", 128)+"... (72 more bytes)" {
+		t.Fatalf("slowlog args = %+v", args)
+	}
+
+	client.do(t, "CONFIG", "SET", "slowlog-log-slower-than", "-1")
+	length := client.do(t, "SLOWLOG", "LEN").Num
+	client.do(t, "GET", "k")
+	if reply := client.do(t, "SLOWLOG", "LEN"); reply.Num != length {
+		t.Fatalf("SLOWLOG LEN with slowlog disabled = %d, want %d", reply.Num, length)
+	}
+	client.do(t, "SLOWLOG", "RESET")
+	if reply := client.do(t, "SLOWLOG", "LEN"); reply.Num != 0 {
+		t.Fatalf("SLOWLOG LEN after RESET = %d", reply.Num)
+	}
+}
+
+func TestV5ClientListAndKill(t *testing.T) {
+	node := startNode(t, nil)
+	admin := dialNode(t, node.addr)
+	victim := dialNode(t, node.addr)
+	victim.do(t, "CLIENT", "SETNAME", "victim")
+	victimID := victim.do(t, "CLIENT", "ID").Num
+	if reply := victim.do(t, "CLIENT", "SETNAME", "bad name"); reply.Type != protocol.ErrorType {
+		t.Fatalf("CLIENT SETNAME with space = %+v", reply)
+	}
+
+	list := admin.do(t, "CLIENT", "LIST").Str
+	if lines := strings.Split(strings.TrimSpace(list), "\n"); len(lines) != 2 {
+		t.Fatalf("CLIENT LIST = %q", list)
+	}
+	if !strings.Contains(list, "name=victim ") || !strings.Contains(list, "cmd=client") {
+		t.Fatalf("CLIENT LIST = %q", list)
+	}
+
+	if reply := admin.do(t, "CLIENT", "KILL", "ID", "999999"); reply.Num != 0 {
+		t.Fatalf("CLIENT KILL unknown id = %+v", reply)
+	}
+	if reply := admin.do(t, "CLIENT", "KILL", "ID", strconv.FormatInt(victimID, 10)); reply.Num != 1 {
+		t.Fatalf("CLIENT KILL ID = %+v", reply)
+	}
+	if _, err := victim.read(); err == nil {
+		t.Fatal("killed client still connected")
+	}
+	waitFor(t, time.Second, func() bool {
+		return !strings.Contains(admin.do(t, "CLIENT", "LIST").Str, "name=victim")
+	})
+	// 默认 SKIPME yes，不会杀死自己。
+	if reply := admin.do(t, "CLIENT", "KILL", "TYPE", "normal"); reply.Num != 0 {
+		t.Fatalf("CLIENT KILL TYPE normal = %+v", reply)
+	}
+}
+
+func TestV5Monitor(t *testing.T) {
+	node := startNode(t, nil)
+	monitor := dialNode(t, node.addr)
+	client := dialNode(t, node.addr)
+	if reply := monitor.do(t, "MONITOR"); reply.Str != "OK" {
+		t.Fatalf("MONITOR = %+v", reply)
+	}
+	client.do(t, "SET", "greeting", "hello \"world\"\n")
+	client.do(t, "CONFIG", "GET", "maxmemory")
+	client.do(t, "GET", "greeting")
+
+	// CONFIG 属于管理命令，不推送给 MONITOR。
+	for _, want := range []string{`"SET" "greeting" "hello \"world\"\n"`, `"GET" "greeting"`} {
+		reply, err := monitor.read()
+		if err != nil {
+			t.Fatalf("read monitor line error = %v", err)
+		}
+		addr := client.conn.LocalAddr().String()
+		if reply.Type != protocol.SimpleString || !strings.HasSuffix(reply.Str, "[0 "+addr+"] "+want) {
+			t.Fatalf("monitor line = %q, want suffix %q", reply.Str, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestV5BitmapAndHyperLogLog(t *testing.T) {
+	master := startNode(t, nil)
+	replica := startNode(t, nil)
+	host, port, _ := net.SplitHostPort(master.addr)
+	dialNode(t, replica.addr).do(t, "REPLICAOF", host, port)
+	client := dialNode(t, master.addr)
+
+	// 按用户 ID 记录功能开关。
+	for _, uid := range []string{"3", "10", "1000"} {
+		if reply := client.do(t, "SETBIT", "flags:beta", uid, "1"); reply.Num != 0 {
+			t.Fatalf("SETBIT %s = %+v", uid, reply)
+		}
+	}
+	if reply := client.do(t, "GETBIT", "flags:beta", "10"); reply.Num != 1 {
+		t.Fatalf("GETBIT = %+v", reply)
+	}
+	if reply := client.do(t, "BITCOUNT", "flags:beta"); reply.Num != 3 {
+		t.Fatalf("BITCOUNT = %+v", reply)
+	}
+	if reply := client.do(t, "BITPOS", "flags:beta", "1", "4", "-1", "BIT"); reply.Num != 10 {
+		t.Fatalf("BITPOS = %+v", reply)
+	}
+	client.do(t, "SETBIT", "flags:new", "10", "1")
+	if reply := client.do(t, "BITOP", "AND", "flags:both", "flags:beta", "flags:new"); reply.Num != 126 {
+		t.Fatalf("BITOP AND = %+v", reply)
+	}
+	if reply := client.do(t, "BITCOUNT", "flags:both"); reply.Num != 1 {
+		t.Fatalf("BITCOUNT after BITOP = %+v", reply)
+	}
+	if reply := client.do(t, "SETBIT", "flags:beta", "-1", "1"); reply.Str != "ERR bit offset is not an integer or out of range" {
+		t.Fatalf("SETBIT negative offset = %+v", reply)
+	}
+
+	// 按天统计独立访客。
+	for i := 0; i < 2000; i++ {
+		day := "uv:mon"
+		if i >= 1000 {
+			day = "uv:tue"
+		}
+		client.do(t, "PFADD", day, "user:"+strconv.Itoa(i%1500))
+	}
+	assertNear := func(key string, want int64) {
+		t.Helper()
+		reply := client.do(t, "PFCOUNT", key)
+		if diff := reply.Num - want; diff < -want/50 || diff > want/50 {
+			t.Fatalf("PFCOUNT %s = %d, want about %d", key, reply.Num, want)
+		}
+	}
+	assertNear("uv:mon", 1000)
+	assertNear("uv:tue", 1000)
+	if reply := client.do(t, "PFMERGE", "uv:week", "uv:mon", "uv:tue"); reply.Str != "OK" {
+		t.Fatalf("PFMERGE = %+v", reply)
+	}
+	assertNear("uv:week", 1500)
+
+	client.do(t, "LPUSH", "list", "x")
+	client.do(t, "SET", "plain", "not an hll")
+	if reply := client.do(t, "PFADD", "plain", "a"); reply.Str != "WRONGTYPE Key is not a valid HyperLogLog string value." {
+		t.Fatalf("PFADD on plain string = %+v", reply)
+	}
+	if reply := client.do(t, "BITOP", "NOT", "dest", "flags:beta", "flags:new"); reply.Str != "ERR BITOP NOT must be called with a single source key." {
+		t.Fatalf("BITOP NOT with two keys = %+v", reply)
+	}
+
+	// 位图与 HyperLogLog 都是普通字符串，随写命令复制到从节点。
+	want := client.do(t, "PFCOUNT", "uv:week").Num
+	rc := dialNode(t, replica.addr)
+	waitFor(t, 3*time.Second, func() bool {
+		return rc.do(t, "PFCOUNT", "uv:week").Num == want
+	})
+	if reply := rc.do(t, "GETBIT", "flags:both", "10"); reply.Num != 1 {
+		t.Fatalf("GETBIT on replica = %+v", reply)
+	}
+}
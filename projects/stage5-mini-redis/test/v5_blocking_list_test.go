@@ -0,0 +1,96 @@
+package test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV5BlockingListFIFO(t *testing.T) {
+	node := startNode(t, nil)
+	first := dialNode(t, node.addr)
+	second := dialNode(t, node.addr)
+	producer := dialNode(t, node.addr)
+
+	if reply := first.doRaw(t, "BLPOP", "jobs", "0.05"); reply != "*-1\r\n" {
+		t.Fatalf("BLPOP timeout = %q, want null array", reply)
+	}
+	if reply := first.doRaw(t, "BLMOVE", "jobs", "done", "LEFT", "RIGHT", "0.05"); reply != "$-1\r\n" {
+		t.Fatalf("BLMOVE timeout = %q, want null bulk string", reply)
+	}
+
+	// 先阻塞的客户端先得到元素，一次推入多个元素时每个等待者各取一个。
+	if err := first.send("BRPOP", "other", "jobs", "2"); err != nil {
+		t.Fatalf("send BRPOP error = %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := second.send("BLPOP", "jobs", "2"); err != nil {
+		t.Fatalf("send BLPOP error = %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	producer.do(t, "RPUSH", "jobs", "a", "b", "c")
+	for _, tc := range []struct {
+		client *respClient
+		want   string
+	}{{first, "c"}, {second, "a"}} {
+		reply, err := tc.client.read()
+		if err != nil || len(reply.Array) != 2 || reply.Array[0].Str != "jobs" || reply.Array[1].Str != tc.want {
+			t.Fatalf("blocked pop = (%+v, %v), want [jobs %s]", reply, err, tc.want)
+		}
+	}
+	if reply := producer.do(t, "LRANGE", "jobs", "0", "-1"); len(reply.Array) != 1 || reply.Array[0].Str != "b" {
+		t.Fatalf("LRANGE = %+v, want [b]", reply)
+	}
+
+	// 断开的等待者不会吞掉元素。
+	gone := dialNode(t, node.addr)
+	if err := gone.send("BLPOP", "tasks", "0"); err != nil {
+		t.Fatalf("send BLPOP error = %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	_ = gone.conn.Close()
+	time.Sleep(30 * time.Millisecond)
+	producer.do(t, "LPUSH", "tasks", "x")
+	if reply := producer.do(t, "LLEN", "tasks"); reply.Num != 1 {
+		t.Fatalf("LLEN = %d, want 1", reply.Num)
+	}
+}
+
+func TestV5BlockingListMoveAndReplication(t *testing.T) {
+	master := startNode(t, nil)
+	replica := startNode(t, nil)
+	mc := dialNode(t, master.addr)
+	rc := dialNode(t, replica.addr)
+	host, port, _ := net.SplitHostPort(master.addr)
+	rc.do(t, "REPLICAOF", host, port)
+
+	mover := dialNode(t, master.addr)
+	popper := dialNode(t, master.addr)
+	if err := mover.send("BLMOVE", "inbox", "processing", "RIGHT", "LEFT", "2"); err != nil {
+		t.Fatalf("send BLMOVE error = %v", err)
+	}
+	if err := popper.send("BLPOP", "processing", "2"); err != nil {
+		t.Fatalf("send BLPOP error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	// BLMOVE 放入 processing 的元素随即唤醒等待 processing 的客户端。
+	mc.do(t, "LPUSH", "inbox", "job1", "job2")
+	if reply, err := mover.read(); err != nil || reply.Str != "job1" {
+		t.Fatalf("blocked BLMOVE = (%+v, %v), want job1", reply, err)
+	}
+	if reply, err := popper.read(); err != nil || len(reply.Array) != 2 || reply.Array[1].Str != "job1" {
+		t.Fatalf("blocked BLPOP = (%+v, %v), want [processing job1]", reply, err)
+	}
+
+	want := mc.do(t, "LRANGE", "inbox", "0", "-1")
+	waitFor(t, 3*time.Second, func() bool {
+		got := rc.do(t, "LRANGE", "inbox", "0", "-1")
+		return len(got.Array) == 1 && len(want.Array) == 1 && got.Array[0].Str == want.Array[0].Str &&
+			rc.do(t, "EXISTS", "processing").Num == 0
+	})
+	if reply := rc.do(t, "BLPOP", "inbox", "0"); reply.Type != protocol.ErrorType {
+		t.Fatalf("BLPOP on replica = %+v, want READONLY error", reply)
+	}
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+)
+
+func TestV5KeyspaceNotifications(t *testing.T) {
+	node := startNode(t, nil)
+	classes, err := db.ParseNotifyKeyspaceEvents("Eg$lx")
+	if err != nil {
+		t.Fatalf("ParseNotifyKeyspaceEvents error = %v", err)
+	}
+	node.database.SetNotifyKeyspaceEvents(classes)
+	sub := dialNode(t, node.addr)
+	client := dialNode(t, node.addr)
+	if reply := sub.do(t, "PSUBSCRIBE", "__keyevent@0__:*"); pushText(reply) != "psubscribe __keyevent@0__:* 1" {
+		t.Fatalf("PSUBSCRIBE = %q", pushText(reply))
+	}
+
+	client.do(t, "SET", "session", "v")
+	client.do(t, "LPUSH", "queue", "a", "b")
+	client.do(t, "HSET", "ignored", "f", "v")
+	client.do(t, "PEXPIREAT", "session", strconv.FormatInt(time.Now().Add(30*time.Millisecond).UnixMilli(), 10))
+	time.Sleep(60 * time.Millisecond)
+	client.do(t, "GET", "session")
+
+	// 未启用 h 类别，HSET 不产生通知；过期 key 被惰性或定期删除时发出 expired。
+	for _, event := range []string{"set session", "lpush queue", "expire session", "expired session"} {
+		name, key, _ := strings.Cut(event, " ")
+		sub.expectPush(t, "pmessage __keyevent@0__:* __keyevent@0__:"+name+" "+key)
+	}
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV5MaxMemoryNoEvictionRejectsWrites(t *testing.T) {
+	node := startNode(t, nil)
+	node.database.SetMaxMemory(4<<10, db.NoEviction, 0)
+	client := dialNode(t, node.addr)
+
+	value := strings.Repeat("x", 512)
+	var oom *protocol.Value
+	for i := 0; i < 20 && oom == nil; i++ {
+		if reply := client.do(t, "SET", "k"+strconv.Itoa(i), value); reply.Type == protocol.ErrorType {
+			oom = reply
+		}
+	}
+	if oom == nil || !strings.HasPrefix(oom.Str, "OOM") {
+		t.Fatalf("SET over maxmemory = %+v, want OOM error", oom)
+	}
+	// 不会增加内存的写命令仍然可以执行，释放空间后写入恢复。
+	if reply := client.do(t, "DEL", "k0", "k1", "k2"); reply.Num != 3 {
+		t.Fatalf("DEL under OOM = %+v", reply)
+	}
+	if reply := client.do(t, "SET", "after", "v"); reply.Str != "OK" {
+		t.Fatalf("SET after freeing memory = %+v", reply)
+	}
+	info := client.do(t, "INFO", "memory").Str
+	if !strings.Contains(info, "maxmemory:4096") || !strings.Contains(info, "maxmemory_policy:noeviction") {
+		t.Fatalf("INFO memory = %q", info)
+	}
+}
+
+func TestV5MaxMemoryLRUEvictsAndPropagates(t *testing.T) {
+	master := startNode(t, nil)
+	replica := startNode(t, nil)
+	master.database.SetMaxMemory(16<<10, db.AllKeysLRU, 0)
+	host, port, _ := net.SplitHostPort(master.addr)
+	dialNode(t, replica.addr).do(t, "REPLICAOF", host, port)
+
+	client := dialNode(t, master.addr)
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < 100; i++ {
+		if reply := client.do(t, "SET", "k"+strconv.Itoa(i), value); reply.Str != "OK" {
+			t.Fatalf("SET k%d = %+v, want OK under allkeys-lru", i, reply)
+		}
+		// 持续访问热点 key，它不应被淘汰。
+		client.do(t, "GET", "k0")
+	}
+	// 与 Redis 一样在执行写命令前淘汰，上限最多被最后一条写命令超出一个条目。
+	if used := master.database.UsedMemory(); used > 16<<10+2048 {
+		t.Fatalf("used memory = %d, want about %d", used, 16<<10)
+	}
+	if reply := client.do(t, "GET", "k0"); reply.Str != value {
+		t.Fatal("hot key k0 was evicted")
+	}
+	if master.database.EvictedKeys() == 0 {
+		t.Fatal("expected evictions")
+	}
+
+	ctx := context.Background()
+	waitFor(t, 3*time.Second, func() bool {
+		masterKeys, _ := master.database.Keys(ctx, "*")
+		replicaKeys, _ := replica.database.Keys(ctx, "*")
+		return strings.Join(masterKeys, ",") == strings.Join(replicaKeys, ",")
+	})
+}
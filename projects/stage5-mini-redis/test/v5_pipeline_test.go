@@ -0,0 +1,61 @@
+package test
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV5PipelinedReplies(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+
+	// 一次写入整批命令，回复按顺序返回。
+	var batch bytes.Buffer
+	for i := 0; i < 100; i++ {
+		batch.Write(protocol.Serialize(protocol.CommandValue([]string{"SET", "k" + strconv.Itoa(i), strconv.Itoa(i)})))
+		batch.Write(protocol.Serialize(protocol.CommandValue([]string{"GET", "k" + strconv.Itoa(i)})))
+	}
+	if _, err := client.conn.Write(batch.Bytes()); err != nil {
+		t.Fatalf("write pipeline error = %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if reply, err := client.read(); err != nil || reply.Str != "OK" {
+			t.Fatalf("SET reply %d = %+v (%v)", i, reply, err)
+		}
+		if reply, err := client.read(); err != nil || reply.Str != strconv.Itoa(i) {
+			t.Fatalf("GET reply %d = %+v (%v)", i, reply, err)
+		}
+	}
+
+	// 阻塞命令之前的回复在阻塞期间已经写出。
+	batch.Reset()
+	batch.Write(protocol.Serialize(protocol.CommandValue([]string{"SET", "before", "1"})))
+	batch.Write(protocol.Serialize(protocol.CommandValue([]string{"BLPOP", "queue", "0"})))
+	if _, err := client.conn.Write(batch.Bytes()); err != nil {
+		t.Fatalf("write pipeline error = %v", err)
+	}
+	if reply, err := client.read(); err != nil || reply.Str != "OK" {
+		t.Fatalf("reply before BLPOP = %+v (%v)", reply, err)
+	}
+	dialNode(t, node.addr).do(t, "RPUSH", "queue", "job")
+	if reply, err := client.read(); err != nil || len(reply.Array) != 2 || reply.Array[1].Str != "job" {
+		t.Fatalf("BLPOP reply = %+v (%v)", reply, err)
+	}
+
+	// 转入订阅模式前写缓冲中的回复先于订阅确认写出。
+	batch.Reset()
+	batch.Write(protocol.Serialize(protocol.CommandValue([]string{"GET", "before"})))
+	batch.Write(protocol.Serialize(protocol.CommandValue([]string{"SUBSCRIBE", "news"})))
+	if _, err := client.conn.Write(batch.Bytes()); err != nil {
+		t.Fatalf("write pipeline error = %v", err)
+	}
+	if reply, err := client.read(); err != nil || reply.Str != "1" {
+		t.Fatalf("GET before SUBSCRIBE = %+v (%v)", reply, err)
+	}
+	if reply, err := client.read(); err != nil || pushText(reply) != "subscribe news 1" {
+		t.Fatalf("SUBSCRIBE reply = %+v (%v)", reply, err)
+	}
+}
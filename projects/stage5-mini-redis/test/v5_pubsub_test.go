@@ -0,0 +1,149 @@
+package test
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
+)
+
+// pushText 将订阅回复或推送消息渲染为空格分隔文本，便于断言。
+func pushText(value *protocol.Value) string {
+	parts := make([]string, 0, len(value.Array))
+	for _, item := range value.Array {
+		if item.Type == protocol.Integer {
+			parts = append(parts, strconv.FormatInt(item.Num, 10))
+			continue
+		}
+		parts = append(parts, item.Str)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *respClient) expectPush(t *testing.T, want string) {
+	t.Helper()
+	value, err := c.read()
+	if err != nil {
+		t.Fatalf("read push error = %v, want %q", err, want)
+	}
+	if got := pushText(value); got != want {
+		t.Fatalf("push = %q, want %q", got, want)
+	}
+}
+
+func TestV5PublishSubscribe(t *testing.T) {
+	node := startNode(t, nil)
+	sub := dialNode(t, node.addr)
+	psub := dialNode(t, node.addr)
+	pub := dialNode(t, node.addr)
+
+	if err := sub.send("SUBSCRIBE", "cache:user", "cache:order"); err != nil {
+		t.Fatalf("SUBSCRIBE error = %v", err)
+	}
+	sub.expectPush(t, "subscribe cache:user 1")
+	sub.expectPush(t, "subscribe cache:order 2")
+	if reply := psub.do(t, "PSUBSCRIBE", "cache:*"); pushText(reply) != "psubscribe cache:* 1" {
+		t.Fatalf("PSUBSCRIBE = %q", pushText(reply))
+	}
+
+	if reply := pub.do(t, "PUBLISH", "cache:user", "42"); reply.Num != 2 {
+		t.Fatalf("PUBLISH receivers = %d, want 2", reply.Num)
+	}
+	sub.expectPush(t, "message cache:user 42")
+	psub.expectPush(t, "pmessage cache:* cache:user 42")
+
+	if reply := pub.do(t, "PUBSUB", "CHANNELS", "cache:*"); pushText(reply) != "cache:order cache:user" {
+		t.Fatalf("PUBSUB CHANNELS = %q", pushText(reply))
+	}
+	if reply := pub.do(t, "PUBSUB", "NUMSUB", "cache:user", "none"); pushText(reply) != "cache:user 1 none 0" {
+		t.Fatalf("PUBSUB NUMSUB = %q", pushText(reply))
+	}
+	if reply := pub.do(t, "PUBSUB", "NUMPAT"); reply.Num != 1 {
+		t.Fatalf("PUBSUB NUMPAT = %d, want 1", reply.Num)
+	}
+
+	if reply := sub.do(t, "GET", "k"); reply.Type != protocol.ErrorType || !strings.Contains(reply.Str, "only (P)SUBSCRIBE") {
+		t.Fatalf("GET in subscriber mode = %+v, want error", reply)
+	}
+	if reply := sub.do(t, "PING"); pushText(reply) != "pong " {
+		t.Fatalf("PING in subscriber mode = %q", pushText(reply))
+	}
+
+	if err := sub.send("UNSUBSCRIBE"); err != nil {
+		t.Fatalf("UNSUBSCRIBE error = %v", err)
+	}
+	sub.expectPush(t, "unsubscribe cache:order 1")
+	sub.expectPush(t, "unsubscribe cache:user 0")
+	if reply := sub.do(t, "SET", "k", "v"); reply.Str != "OK" {
+		t.Fatalf("SET after unsubscribe = %+v", reply)
+	}
+	if reply := pub.do(t, "PUBLISH", "cache:user", "43"); reply.Num != 1 {
+		t.Fatalf("PUBLISH after unsubscribe = %d, want 1", reply.Num)
+	}
+}
+
+func TestV5RESP3SubscriberReceivesPushes(t *testing.T) {
+	node := startNode(t, nil)
+	sub := dialNode(t, node.addr)
+	pub := dialNode(t, node.addr)
+
+	sub.do(t, "HELLO", "3")
+	if reply := sub.do(t, "SUBSCRIBE", "events"); reply.Type != protocol.Push {
+		t.Fatalf("SUBSCRIBE over RESP3 = %+v, want push", reply)
+	}
+	// RESP3 连接在订阅期间仍可执行普通命令。
+	if reply := sub.do(t, "SET", "k", "v"); reply.Str != "OK" {
+		t.Fatalf("SET while subscribed = %+v", reply)
+	}
+	pub.do(t, "PUBLISH", "events", "hello")
+	value, err := sub.read()
+	if err != nil || value.Type != protocol.Push || pushText(value) != "message events hello" {
+		t.Fatalf("message over RESP3 = (%+v, %v)", value, err)
+	}
+}
+
+func TestV5SlowSubscriberIsDisconnected(t *testing.T) {
+	node := startNode(t, func(srv *server.TCPServer) {
+		srv.SetPubSubOutputLimit(server.OutputBufferLimit{Hard: 256 << 10})
+	})
+	slow := dialNode(t, node.addr)
+	fast := dialNode(t, node.addr)
+	pub := dialNode(t, node.addr)
+	slow.do(t, "SUBSCRIBE", "invalidate")
+	fast.do(t, "SUBSCRIBE", "other")
+
+	// slow 从不读取，积压超过硬限制后会被服务端断开。
+	payload := strings.Repeat("x", 64<<10)
+	deadline := time.Now().Add(5 * time.Second)
+	for pub.do(t, "PUBSUB", "NUMSUB", "invalidate").Array[1].Num > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("slow subscriber was not disconnected")
+		}
+		pub.do(t, "PUBLISH", "invalidate", payload)
+	}
+
+	if reply := pub.do(t, "PUBLISH", "other", "still-alive"); reply.Num != 1 {
+		t.Fatalf("PUBLISH to healthy subscriber = %d, want 1", reply.Num)
+	}
+	fast.expectPush(t, "message other still-alive")
+}
+
+func TestV5PublishPropagatesToReplica(t *testing.T) {
+	master := startNode(t, nil)
+	replica := startNode(t, nil)
+	host, port, _ := net.SplitHostPort(master.addr)
+	dialNode(t, replica.addr).do(t, "REPLICAOF", host, port)
+
+	sub := dialNode(t, replica.addr)
+	sub.do(t, "SUBSCRIBE", "invalidate")
+	mc := dialNode(t, master.addr)
+	waitFor(t, 3*time.Second, func() bool {
+		return strings.Contains(mc.do(t, "INFO", "replication").Str, "connected_slaves:1")
+	})
+	mc.do(t, "PUBLISH", "invalidate", "user:1")
+	sub.expectPush(t, "message invalidate user:1")
+}
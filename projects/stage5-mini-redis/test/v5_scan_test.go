@@ -0,0 +1,36 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestV5ScanIteratesKeyspace(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+	for i := 0; i < 50; i++ {
+		client.do(t, "SET", "item:"+strconv.Itoa(i), "v")
+	}
+	client.do(t, "SADD", "item:set", "m")
+
+	seen := make(map[string]int)
+	cursor := "0"
+	for {
+		reply := client.do(t, "SCAN", cursor, "MATCH", "item:*", "COUNT", "5", "TYPE", "string")
+		if len(reply.Array) != 2 {
+			t.Fatalf("SCAN reply = %+v", reply)
+		}
+		for _, key := range reply.Array[1].Array {
+			seen[key.Str]++
+		}
+		if cursor = reply.Array[0].Str; cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 50 || seen["item:set"] != 0 {
+		t.Fatalf("SCAN returned %d keys, want the 50 string keys", len(seen))
+	}
+	if reply := client.do(t, "TYPE", "item:set"); reply.Str != "set" {
+		t.Fatalf("TYPE = %q, want set", reply.Str)
+	}
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/db"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/sentinel"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/server"
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/ttl"
+)
+
+var sentinelTiming = sentinel.Timing{
+	PingPeriod:      50 * time.Millisecond,
+	InfoPeriod:      100 * time.Millisecond,
+	HelloPeriod:     100 * time.Millisecond,
+	DownAfter:       500 * time.Millisecond,
+	FailoverTimeout: 3 * time.Second,
+}
+
+func startSentinel(t *testing.T, masterAddr string, quorum int) string {
+	t.Helper()
+	s := sentinel.New("127.0.0.1:0", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.SetTiming(sentinelTiming)
+	host, port, _ := net.SplitHostPort(masterAddr)
+	portNum, _ := strconv.Atoi(port)
+	if err := s.Monitor("mymaster", host, portNum, quorum); err != nil {
+		t.Fatalf("Monitor error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	waitFor(t, 2*time.Second, func() bool { return s.Addr() != "" })
+	return s.Addr()
+}
+
+// sentinelField 取 SENTINEL MASTER 等扁平数组回复中的字段值。
+func sentinelField(reply *protocol.Value, name string) string {
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		if reply.Array[i].Str == name {
+			return reply.Array[i+1].Str
+		}
+	}
+	return ""
+}
+
+func TestV5SentinelFailover(t *testing.T) {
+	master := startNode(t, nil)
+	replicas := []*testNode{startNode(t, nil), startNode(t, nil)}
+	host, port, _ := net.SplitHostPort(master.addr)
+	for _, replica := range replicas {
+		dialNode(t, replica.addr).do(t, "REPLICAOF", host, port)
+	}
+	mc := dialNode(t, master.addr)
+	mc.do(t, "SET", "before", "failover")
+	for _, replica := range replicas {
+		waitFor(t, 3*time.Second, func() bool {
+			value, ok, _ := replica.database.GetString(context.Background(), "before")
+			return ok && value == "failover"
+		})
+	}
+
+	var sentinels []*respClient
+	for i := 0; i < 3; i++ {
+		sentinels = append(sentinels, dialNode(t, startSentinel(t, master.addr, 2)))
+	}
+	// 哨兵通过 INFO 发现从节点，通过 hello 消息互相发现。
+	for _, sc := range sentinels {
+		waitFor(t, 5*time.Second, func() bool {
+			info := sc.do(t, "SENTINEL", "MASTER", "mymaster")
+			return sentinelField(info, "num-slaves") == "2" && sentinelField(info, "num-other-sentinels") == "2"
+		})
+	}
+	if reply := sentinels[0].do(t, "SENTINEL", "CKQUORUM", "mymaster"); !strings.HasPrefix(reply.Str, "OK 3 usable Sentinels") {
+		t.Fatalf("SENTINEL CKQUORUM = %+v", reply)
+	}
+	if reply := sentinels[0].do(t, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"); len(reply.Array) != 2 || reply.Array[1].Str != port {
+		t.Fatalf("GET-MASTER-ADDR-BY-NAME before failover = %+v", reply)
+	}
+
+	master.stop()
+
+	// 所有哨兵最终都指向同一个晋升的从节点。
+	var newAddr string
+	for _, sc := range sentinels {
+		waitFor(t, 10*time.Second, func() bool {
+			reply := sc.do(t, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster")
+			if len(reply.Array) != 2 || reply.Array[1].Str == port {
+				return false
+			}
+			addr := net.JoinHostPort(reply.Array[0].Str, reply.Array[1].Str)
+			if newAddr == "" {
+				newAddr = addr
+			}
+			return addr == newAddr
+		})
+	}
+	var promoted, other *testNode
+	for _, replica := range replicas {
+		if replica.addr == newAddr {
+			promoted = replica
+		} else {
+			other = replica
+		}
+	}
+	if promoted == nil {
+		t.Fatalf("new master %s is not one of the replicas", newAddr)
+	}
+	if promoted.srv.IsReplica() {
+		t.Fatal("promoted replica still in replica role")
+	}
+
+	// 另一个从节点改为复制新主节点，新写入继续同步。
+	waitFor(t, 5*time.Second, func() bool {
+		return strings.Contains(dialNode(t, other.addr).do(t, "INFO", "replication").Str, "master_port:"+promoted.addr[strings.LastIndex(promoted.addr, ":")+1:])
+	})
+	if reply := dialNode(t, promoted.addr).do(t, "SET", "after", "failover"); reply.Str != "OK" {
+		t.Fatalf("SET on new master = %+v", reply)
+	}
+	waitFor(t, 3*time.Second, func() bool {
+		value, ok, _ := other.database.GetString(context.Background(), "after")
+		return ok && value == "failover"
+	})
+
+	// 原主节点以原地址重启后被改为新主节点的从节点。
+	database := db.New()
+	restarted := server.NewTCPServer(master.addr, database, ttl.NewManager(database), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = restarted.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	waitFor(t, 10*time.Second, func() bool {
+		value, ok, _ := database.GetString(context.Background(), "after")
+		return restarted.IsReplica() && ok && value == "failover"
+	})
+}
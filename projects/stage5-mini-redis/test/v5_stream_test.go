@@ -0,0 +1,102 @@
+package test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV5StreamBlockingRead(t *testing.T) {
+	node := startNode(t, nil)
+	reader := dialNode(t, node.addr)
+	writer := dialNode(t, node.addr)
+
+	writer.do(t, "XADD", "events", "1-0", "type", "old")
+	if reply := reader.doRaw(t, "XREAD", "BLOCK", "50", "STREAMS", "events", "$"); reply != "*-1\r\n" {
+		t.Fatalf("XREAD BLOCK timeout = %q, want null array", reply)
+	}
+
+	if err := reader.send("XREAD", "BLOCK", "2000", "STREAMS", "events", "$"); err != nil {
+		t.Fatalf("send XREAD error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	// 其他 key 的写入不会唤醒读取方，新消息只从阻塞开始之后算起。
+	writer.do(t, "XADD", "other", "*", "type", "noise")
+	id := writer.do(t, "XADD", "events", "*", "type", "new").Str
+	reply, err := reader.read()
+	if err != nil {
+		t.Fatalf("blocked XREAD error = %v", err)
+	}
+	if len(reply.Array) != 1 || reply.Array[0].Array[0].Str != "events" {
+		t.Fatalf("blocked XREAD = %+v", reply)
+	}
+	entries := reply.Array[0].Array[1].Array
+	if len(entries) != 1 || entries[0].Array[0].Str != id || entries[0].Array[1].Array[1].Str != "new" {
+		t.Fatalf("blocked XREAD entries = %+v, want only %s", entries, id)
+	}
+
+	// 阻塞中断开的客户端不影响后续写入与读取。
+	gone := dialNode(t, node.addr)
+	if err = gone.send("XREAD", "BLOCK", "0", "STREAMS", "events", "$"); err != nil {
+		t.Fatalf("send XREAD error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	_ = gone.conn.Close()
+	writer.do(t, "XADD", "events", "*", "type", "after")
+	if reply := writer.do(t, "XLEN", "events"); reply.Num != 3 {
+		t.Fatalf("XLEN = %d, want 3", reply.Num)
+	}
+}
+
+func TestV5StreamConsumerGroupReplication(t *testing.T) {
+	master := startNode(t, nil)
+	replica := startNode(t, nil)
+	mc := dialNode(t, master.addr)
+	rc := dialNode(t, replica.addr)
+	host, port, _ := net.SplitHostPort(master.addr)
+	rc.do(t, "REPLICAOF", host, port)
+
+	mc.do(t, "XGROUP", "CREATE", "jobs", "workers", "$", "MKSTREAM")
+	worker := dialNode(t, master.addr)
+	if reply := worker.doRaw(t, "XREADGROUP", "GROUP", "workers", "w1", "BLOCK", "50", "STREAMS", "jobs", ">"); reply != "*-1\r\n" {
+		t.Fatalf("XREADGROUP BLOCK timeout = %q, want null array", reply)
+	}
+	if err := worker.send("XREADGROUP", "GROUP", "workers", "w1", "BLOCK", "2000", "STREAMS", "jobs", ">"); err != nil {
+		t.Fatalf("send XREADGROUP error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	id := mc.do(t, "XADD", "jobs", "*", "task", "resize").Str
+	reply, err := worker.read()
+	if err != nil || len(reply.Array) != 1 || reply.Array[0].Array[1].Array[0].Array[0].Str != id {
+		t.Fatalf("blocked XREADGROUP = (%+v, %v), want %s", reply, err, id)
+	}
+	mc.do(t, "XADD", "jobs", "*", "task", "crop")
+	mc.do(t, "XREADGROUP", "GROUP", "workers", "w2", "STREAMS", "jobs", ">")
+	mc.do(t, "XCLAIM", "jobs", "workers", "w2", "0", id)
+
+	// 自动生成的 ID 与 PEL 都以确定的形式传播，从节点状态与主节点一致。
+	want := mc.do(t, "XPENDING", "jobs", "workers")
+	waitFor(t, 3*time.Second, func() bool {
+		got := rc.do(t, "XPENDING", "jobs", "workers")
+		return pendingSummary(got) == pendingSummary(want)
+	})
+	if got := rc.do(t, "XRANGE", "jobs", "-", "+"); len(got.Array) != 2 || got.Array[0].Array[0].Str != id {
+		t.Fatalf("replica XRANGE = %+v, want first id %s", got, id)
+	}
+	if reply := rc.do(t, "XREADGROUP", "GROUP", "workers", "w3", "STREAMS", "jobs", ">"); reply.Type != protocol.ErrorType {
+		t.Fatalf("XREADGROUP on replica = %+v, want READONLY error", reply)
+	}
+}
+
+func pendingSummary(value *protocol.Value) string {
+	if value.Type != protocol.Array || len(value.Array) != 4 {
+		return ""
+	}
+	text := value.Array[1].Str + " " + value.Array[2].Str
+	for _, consumer := range value.Array[3].Array {
+		text += " " + consumer.Array[0].Str + "=" + consumer.Array[1].Str
+	}
+	return text
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/EfreetZ/SWAI/projects/stage5-mini-redis/internal/protocol"
+)
+
+func TestV5MultiExecQueuesAndReportsErrors(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+
+	client.do(t, "SET", "name", "v")
+	client.do(t, "MULTI")
+	if reply := client.do(t, "SET", "a", "1"); reply.Str != "QUEUED" {
+		t.Fatalf("queued SET = %+v, want QUEUED", reply)
+	}
+	client.do(t, "LPUSH", "name", "x")
+	client.do(t, "GET", "a")
+	exec := client.do(t, "EXEC")
+	if exec.Type != protocol.Array || len(exec.Array) != 3 {
+		t.Fatalf("EXEC = %+v, want 3 results", exec)
+	}
+	if exec.Array[0].Str != "OK" || exec.Array[1].Type != protocol.ErrorType || exec.Array[2].Str != "1" {
+		t.Fatalf("EXEC results = %+v, want OK, runtime error, 1", exec.Array)
+	}
+
+	// 排队阶段的错误使整个事务被放弃。
+	client.do(t, "MULTI")
+	client.do(t, "SET", "b", "1")
+	if reply := client.do(t, "GET"); reply.Type != protocol.ErrorType || !strings.Contains(reply.Str, "wrong number of arguments") {
+		t.Fatalf("GET without key = %+v, want arity error", reply)
+	}
+	if reply := client.do(t, "NOSUCHCMD"); reply.Type != protocol.ErrorType {
+		t.Fatalf("unknown command in MULTI = %+v, want error", reply)
+	}
+	if reply := client.do(t, "EXEC"); reply.Type != protocol.ErrorType || !strings.HasPrefix(reply.Str, "EXECABORT") {
+		t.Fatalf("EXEC after queue error = %+v, want EXECABORT", reply)
+	}
+	if reply := client.do(t, "GET", "b"); reply.Type != protocol.Null {
+		t.Fatalf("GET b = %+v, aborted transaction must not apply", reply)
+	}
+
+	if reply := client.do(t, "EXEC"); !strings.Contains(reply.Str, "EXEC without MULTI") {
+		t.Fatalf("EXEC without MULTI = %+v", reply)
+	}
+	client.do(t, "MULTI")
+	if reply := client.do(t, "MULTI"); !strings.Contains(reply.Str, "can not be nested") {
+		t.Fatalf("nested MULTI = %+v", reply)
+	}
+	if reply := client.do(t, "WATCH", "a"); !strings.Contains(reply.Str, "WATCH inside MULTI") {
+		t.Fatalf("WATCH inside MULTI = %+v", reply)
+	}
+	client.do(t, "SET", "c", "1")
+	if reply := client.do(t, "DISCARD"); reply.Str != "OK" {
+		t.Fatalf("DISCARD = %+v", reply)
+	}
+	if reply := client.do(t, "GET", "c"); reply.Type != protocol.Null {
+		t.Fatalf("GET c = %+v, discarded command must not apply", reply)
+	}
+}
+
+func TestV5MultiQueuesServerCommands(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+
+	client.do(t, "SET", "src", "v")
+	payload := client.do(t, "DUMP", "src").Str
+	client.do(t, "MULTI")
+	queued := [][]string{
+		{"INFO", "server"},
+		{"CONFIG", "GET", "maxmemory"},
+		{"DUMP", "src"},
+		{"RESTORE", "dst", "0", payload},
+		{"LASTSAVE"},
+		{"PUBSUB", "CHANNELS"},
+		{"SLOWLOG", "LEN"},
+		{"CLIENT", "GETNAME"},
+		{"BGREWRITEAOF"},
+	}
+	for _, args := range queued {
+		if reply := client.do(t, args...); reply.Str != "QUEUED" {
+			t.Fatalf("%v in MULTI = %+v, want QUEUED", args, reply)
+		}
+	}
+	exec := client.do(t, "EXEC")
+	if exec.Type != protocol.Array || len(exec.Array) != len(queued) {
+		t.Fatalf("EXEC = %+v, want %d results", exec, len(queued))
+	}
+	for i, args := range queued[:len(queued)-1] {
+		if exec.Array[i].Type == protocol.ErrorType {
+			t.Fatalf("EXEC result of %v = %+v", args, exec.Array[i])
+		}
+	}
+	if exec.Array[2].Str != payload || exec.Array[3].Str != "OK" {
+		t.Fatalf("DUMP/RESTORE in EXEC = %+v, %+v", exec.Array[2], exec.Array[3])
+	}
+	// AOF 未开启时 BGREWRITEAOF 的错误只体现在对应位置，不会放弃事务。
+	if last := exec.Array[len(queued)-1]; last.Type != protocol.ErrorType {
+		t.Fatalf("BGREWRITEAOF without AOF in EXEC = %+v, want error", last)
+	}
+	if reply := client.do(t, "GET", "dst"); reply.Str != "v" {
+		t.Fatalf("GET dst = %+v, want v", reply)
+	}
+
+	// 改变连接状态的命令仍不能排队。
+	client.do(t, "MULTI")
+	if reply := client.do(t, "SUBSCRIBE", "ch"); reply.Type != protocol.ErrorType {
+		t.Fatalf("SUBSCRIBE in MULTI = %+v, want error", reply)
+	}
+	if reply := client.do(t, "EXEC"); !strings.HasPrefix(reply.Str, "EXECABORT") {
+		t.Fatalf("EXEC after SUBSCRIBE = %+v, want EXECABORT", reply)
+	}
+}
+
+func TestV5WatchAbortsOnConcurrentWrite(t *testing.T) {
+	node := startNode(t, nil)
+	client := dialNode(t, node.addr)
+	other := dialNode(t, node.addr)
+
+	client.do(t, "SET", "stock", "5")
+	client.do(t, "WATCH", "stock")
+	other.do(t, "SET", "stock", "4")
+	client.do(t, "MULTI")
+	client.do(t, "SET", "stock", "100")
+	if reply := client.doRaw(t, "EXEC"); reply != "*-1\r\n" {
+		t.Fatalf("EXEC after watched write = %q, want null array", reply)
+	}
+	if reply := client.do(t, "GET", "stock"); reply.Str != "4" {
+		t.Fatalf("stock = %q, want 4", reply.Str)
+	}
+
+	// EXEC 会释放 WATCH，之后的事务不受影响。
+	client.do(t, "MULTI")
+	client.do(t, "SET", "stock", "3")
+	if reply := client.do(t, "EXEC"); reply.Type != protocol.Array || len(reply.Array) != 1 {
+		t.Fatalf("EXEC without watch = %+v", reply)
+	}
+
+	client.do(t, "WATCH", "stock")
+	client.do(t, "UNWATCH")
+	other.do(t, "SET", "stock", "2")
+	client.do(t, "MULTI")
+	client.do(t, "SET", "stock", "1")
+	if reply := client.do(t, "EXEC"); reply.Type != protocol.Array {
+		t.Fatalf("EXEC after UNWATCH = %+v, want array", reply)
+	}
+}
+
+// TestV5CheckAndSetCounter 多个客户端以 WATCH/MULTI/EXEC 乐观锁并发扣减库存，结果必须精确。
+func TestV5CheckAndSetCounter(t *testing.T) {
+	node := startNode(t, nil)
+	const workers, perWorker = 4, 25
+	dialNode(t, node.addr).do(t, "SET", "inventory", strconv.Itoa(workers*perWorker))
+
+	var wg sync.WaitGroup
+	errs := make(chan string, workers)
+	for w := 0; w < workers; w++ {
+		client := dialNode(t, node.addr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for done := 0; done < perWorker; {
+				_ = client.send("WATCH", "inventory")
+				_ = client.send("GET", "inventory")
+				_, _ = client.read()
+				current, err := client.read()
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				n, _ := strconv.Atoi(current.Str)
+				for _, args := range [][]string{{"MULTI"}, {"SET", "inventory", strconv.Itoa(n - 1)}, {"EXEC"}} {
+					_ = client.send(args...)
+				}
+				_, _ = client.read()
+				_, _ = client.read()
+				exec, err := client.read()
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				if exec.Type == protocol.Array {
+					done++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if reply := dialNode(t, node.addr).do(t, "GET", "inventory"); reply.Str != "0" {
+		t.Fatalf("inventory = %q, want 0", reply.Str)
+	}
+}